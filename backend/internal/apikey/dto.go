@@ -8,6 +8,7 @@ type apiKeyCreateDto struct {
 	Name        string            `json:"name" binding:"required,min=3,max=50" unorm:"nfc"`
 	Description *string           `json:"description" unorm:"nfc"`
 	ExpiresAt   datatype.DateTime `json:"expiresAt" binding:"required"`
+	Scopes      []string          `json:"scopes" binding:"omitempty,dive,oneof=scim"`
 }
 
 type apiKeyRenewDto struct {
@@ -22,6 +23,7 @@ type apiKeyDto struct {
 	LastUsedAt          *datatype.DateTime `json:"lastUsedAt"`
 	CreatedAt           datatype.DateTime  `json:"createdAt"`
 	ExpirationEmailSent bool               `json:"expirationEmailSent"`
+	Scopes              []string           `json:"scopes"`
 }
 
 type apiKeyResponseDto struct {
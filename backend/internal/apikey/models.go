@@ -5,6 +5,9 @@ import (
 	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
 )
 
+// ScopeScim allows an API key to be used for the inbound SCIM provisioning endpoints
+const ScopeScim = "scim"
+
 // ApiKey is a personal access token a user can use to authenticate against the API
 type ApiKey struct {
 	model.Base
@@ -15,7 +18,26 @@ type ApiKey struct {
 	ExpiresAt           datatype.DateTime  `sortable:"true"`
 	LastUsedAt          *datatype.DateTime `sortable:"true"`
 	ExpirationEmailSent bool
+	// Scopes restricts the key to the listed features; a key without scopes can only be used for the regular API
+	Scopes datatype.StringList
 
 	UserID string
 	User   model.User
 }
+
+// auditLogState is the state of an API key that is recorded in the audit log when the key is changed
+type auditLogState struct {
+	Name        string            `json:"name"`
+	Description *string           `json:"description"`
+	ExpiresAt   datatype.DateTime `json:"expiresAt"`
+	Scopes      []string          `json:"scopes"`
+}
+
+func newAuditLogState(apiKey ApiKey) auditLogState {
+	return auditLogState{
+		Name:        apiKey.Name,
+		Description: apiKey.Description,
+		ExpiresAt:   apiKey.ExpiresAt,
+		Scopes:      apiKey.Scopes,
+	}
+}
@@ -9,9 +9,14 @@ import (
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
+type AuditLogger interface {
+	CreateChange(ctx context.Context, change model.AuditLogChange, tx *gorm.DB)
+}
+
 type Dependencies struct {
 	DB           *gorm.DB
 	StaticApiKey string
+	AuditLog     AuditLogger
 }
 
 type Module struct {
@@ -20,7 +25,7 @@ type Module struct {
 }
 
 func New(ctx context.Context, deps Dependencies) (*Module, error) {
-	service, err := newService(ctx, deps.DB, deps.StaticApiKey)
+	service, err := newService(ctx, deps.DB, deps.StaticApiKey, deps.AuditLog)
 	if err != nil {
 		return nil, err
 	}
@@ -47,6 +52,12 @@ func (m *Module) ValidateApiKey(ctx context.Context, apiKey string) (model.User,
 	return m.service.ValidateApiKey(ctx, apiKey)
 }
 
+// ValidateScopedApiKey resolves the user that owns the given raw API key if the key was granted the given scope
+// It is used by features that only accept dedicated API keys, such as SCIM provisioning
+func (m *Module) ValidateScopedApiKey(ctx context.Context, apiKey, scope string) (model.User, error) {
+	return m.service.ValidateScopedApiKey(ctx, apiKey, scope)
+}
+
 // ListExpiringApiKeys returns API keys expiring within the given number of days that have not been notified yet
 func (m *Module) ListExpiringApiKeys(ctx context.Context, daysAhead int) ([]ApiKey, error) {
 	return m.service.ListExpiringApiKeys(ctx, daysAhead)
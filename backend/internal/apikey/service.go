@@ -3,6 +3,7 @@ package apikey
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,12 +19,14 @@ import (
 type Service struct {
 	db           *gorm.DB
 	staticApiKey string
+	auditLog     AuditLogger
 }
 
-func newService(ctx context.Context, db *gorm.DB, staticApiKey string) (*Service, error) {
+func newService(ctx context.Context, db *gorm.DB, staticApiKey string, auditLog AuditLogger) (*Service, error) {
 	s := &Service{
 		db:           db,
 		staticApiKey: staticApiKey,
+		auditLog:     auditLog,
 	}
 
 	if staticApiKey == "" {
@@ -68,6 +71,7 @@ func (s *Service) CreateApiKey(ctx context.Context, userID string, input apiKeyC
 		Key:         utils.CreateSha256Hash(token), // Hash the token for storage
 		Description: input.Description,
 		ExpiresAt:   input.ExpiresAt,
+		Scopes:      datatype.StringList(input.Scopes),
 		UserID:      userID,
 	}
 
@@ -82,6 +86,16 @@ func (s *Service) CreateApiKey(ctx context.Context, userID string, input apiKeyC
 		return ApiKey{}, "", err
 	}
 
+	if s.auditLog != nil {
+		s.auditLog.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventApiKeyCreated,
+			TargetID:     apiKey.ID,
+			TargetName:   apiKey.Name,
+			TargetUserID: apiKey.UserID,
+			After:        newAuditLogState(apiKey),
+		}, s.db)
+	}
+
 	// Return the raw token only once - it cannot be retrieved later
 	return apiKey, token, nil
 }
@@ -121,6 +135,7 @@ func (s *Service) RenewApiKey(ctx context.Context, userID, apiKeyID string, expi
 		return ApiKey{}, "", err
 	}
 
+	previousState := newAuditLogState(apiKey)
 	apiKey.Key = utils.CreateSha256Hash(token)
 	apiKey.ExpiresAt = datatype.DateTime(expiration)
 
@@ -129,6 +144,17 @@ func (s *Service) RenewApiKey(ctx context.Context, userID, apiKeyID string, expi
 		return ApiKey{}, "", err
 	}
 
+	if s.auditLog != nil {
+		s.auditLog.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventApiKeyRenewed,
+			TargetID:     apiKey.ID,
+			TargetName:   apiKey.Name,
+			TargetUserID: apiKey.UserID,
+			Before:       previousState,
+			After:        newAuditLogState(apiKey),
+		}, tx)
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return ApiKey{}, "", err
 	}
@@ -141,6 +167,7 @@ func (s *Service) RevokeApiKey(ctx context.Context, userID, apiKeyID string) err
 	err := s.db.
 		WithContext(ctx).
 		Where("id = ? AND user_id = ?", apiKeyID, userID).
+		Clauses(clause.Returning{}).
 		Delete(&apiKey).
 		Error
 	if err != nil {
@@ -150,15 +177,36 @@ func (s *Service) RevokeApiKey(ctx context.Context, userID, apiKeyID string) err
 		return err
 	}
 
+	if s.auditLog != nil && apiKey.ID != "" {
+		s.auditLog.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventApiKeyRevoked,
+			TargetID:     apiKey.ID,
+			TargetName:   apiKey.Name,
+			TargetUserID: apiKey.UserID,
+			Before:       newAuditLogState(apiKey),
+		}, s.db)
+	}
+
 	return nil
 }
 
 func (s *Service) ValidateApiKey(ctx context.Context, apiKey string) (model.User, error) {
+	return s.validateApiKey(ctx, apiKey, "")
+}
+
+// ValidateScopedApiKey resolves the user that owns the given raw API key if the key was granted the given scope
+func (s *Service) ValidateScopedApiKey(ctx context.Context, apiKey, scope string) (model.User, error) {
+	return s.validateApiKey(ctx, apiKey, scope)
+}
+
+// validateApiKey validates the raw API key
+// An empty scope only accepts keys without scopes, so scoped keys can't be used for the regular API
+func (s *Service) validateApiKey(ctx context.Context, apiKey, scope string) (model.User, error) {
 	if apiKey == "" {
 		return model.User{}, &common.NoAPIKeyProvidedError{}
 	}
 
-	if s.staticApiKey != "" && apiKey == s.staticApiKey {
+	if scope == "" && s.staticApiKey != "" && apiKey == s.staticApiKey {
 		return s.initStaticApiKeyUser(ctx)
 	}
 
@@ -185,6 +233,10 @@ func (s *Service) ValidateApiKey(ctx context.Context, apiKey string) (model.User
 		return model.User{}, err
 	}
 
+	if (scope == "" && len(key.Scopes) > 0) || (scope != "" && !slices.Contains(key.Scopes, scope)) {
+		return model.User{}, &common.APIKeyScopeError{}
+	}
+
 	return key.User, nil
 }
 
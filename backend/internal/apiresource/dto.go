@@ -0,0 +1,24 @@
+package apiresource
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+type apiResourceInputDto struct {
+	Name                string   `json:"name" binding:"required,max=128" unorm:"nfc"`
+	Identifier          string   `json:"identifier" binding:"required,max=2048"`
+	Scopes              []string `json:"scopes" binding:"dive,min=1"`
+	AccessTokenLifetime int      `json:"accessTokenLifetime" binding:"min=0,max=86400"`
+	AllowedClientIDs    []string `json:"allowedClientIds" binding:"dive,min=1"`
+}
+
+type apiResourceDto struct {
+	ID                  string                      `json:"id"`
+	Name                string                      `json:"name"`
+	Identifier          string                      `json:"identifier"`
+	Scopes              []string                    `json:"scopes"`
+	AccessTokenLifetime int                         `json:"accessTokenLifetime"`
+	AllowedClients      []dto.OidcClientMetaDataDto `json:"allowedClients"`
+	CreatedAt           datatype.DateTime           `json:"createdAt"`
+}
@@ -0,0 +1,149 @@
+package apiresource
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// list godoc
+// @Summary List API resources
+// @Description Get a paginated list of the API resources clients can request access tokens for
+// @Tags OIDC API Resources
+// @Param search query string false "Search term to filter API resources by name or identifier"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[apiResourceDto]
+// @Router /api/oidc/api-resources [get]
+func (h *handler) list(c *gin.Context) {
+	searchTerm := c.Query("search")
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	resources, pagination, err := h.service.ListAPIResources(c.Request.Context(), searchTerm, listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var resourcesDto []apiResourceDto
+	if err := dto.MapStructList(resources, &resourcesDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[apiResourceDto]{
+		Data:       resourcesDto,
+		Pagination: pagination,
+	})
+}
+
+// get godoc
+// @Summary Get API resource
+// @Description Get an API resource by ID
+// @Tags OIDC API Resources
+// @Param id path string true "API resource ID"
+// @Success 200 {object} apiResourceDto
+// @Router /api/oidc/api-resources/{id} [get]
+func (h *handler) get(c *gin.Context) {
+	resource, err := h.service.GetAPIResource(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto apiResourceDto
+	if err := dto.MapStruct(resource, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// create godoc
+// @Summary Create API resource
+// @Description Create an API resource the allowed clients can request audience-restricted access tokens for
+// @Tags OIDC API Resources
+// @Param resource body apiResourceInputDto true "API resource information"
+// @Success 201 {object} apiResourceDto "Created API resource"
+// @Router /api/oidc/api-resources [post]
+func (h *handler) create(c *gin.Context) {
+	var input apiResourceInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	resource, err := h.service.CreateAPIResource(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto apiResourceDto
+	if err := dto.MapStruct(resource, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, responseDto)
+}
+
+// update godoc
+// @Summary Update API resource
+// @Description Update an API resource by ID
+// @Tags OIDC API Resources
+// @Param id path string true "API resource ID"
+// @Param resource body apiResourceInputDto true "API resource information"
+// @Success 200 {object} apiResourceDto "Updated API resource"
+// @Router /api/oidc/api-resources/{id} [put]
+func (h *handler) update(c *gin.Context) {
+	var input apiResourceInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	resource, err := h.service.UpdateAPIResource(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto apiResourceDto
+	if err := dto.MapStruct(resource, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// delete godoc
+// @Summary Delete API resource
+// @Description Delete an API resource by ID
+// @Tags OIDC API Resources
+// @Param id path string true "API resource ID"
+// @Success 204 "No Content"
+// @Router /api/oidc/api-resources/{id} [delete]
+func (h *handler) delete(c *gin.Context) {
+	if err := h.service.DeleteAPIResource(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package apiresource
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Dependencies struct {
+	DB *gorm.DB
+}
+
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(deps.DB)
+	return &Module{
+		service: service,
+		handler: newHandler(service),
+	}
+}
+
+// RegisterRoutes mounts the admin endpoints to manage the API resources clients can request access tokens for
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, adminAuth gin.HandlerFunc) {
+	group := apiGroup.Group("/oidc/api-resources", adminAuth)
+	group.GET("", m.handler.list)
+	group.POST("", m.handler.create)
+	group.GET("/:id", m.handler.get)
+	group.PUT("/:id", m.handler.update)
+	group.DELETE("/:id", m.handler.delete)
+}
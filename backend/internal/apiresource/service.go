@@ -0,0 +1,158 @@
+package apiresource
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// scopeRegex matches a scope-token as defined in RFC 6749 section 3.3
+var scopeRegex = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// Service holds the business logic for managing the API resources clients can request access tokens for
+type Service struct {
+	db *gorm.DB
+}
+
+func newService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) ListAPIResources(ctx context.Context, search string, listRequestOptions utils.ListRequestOptions) ([]model.OidcAPIResource, utils.PaginationResponse, error) {
+	query := s.db.
+		WithContext(ctx).
+		Preload("AllowedClients").
+		Model(&model.OidcAPIResource{})
+
+	if search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("name LIKE ? OR identifier LIKE ?", searchPattern, searchPattern)
+	}
+
+	var resources []model.OidcAPIResource
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &resources)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return resources, pagination, nil
+}
+
+func (s *Service) GetAPIResource(ctx context.Context, id string) (model.OidcAPIResource, error) {
+	var resource model.OidcAPIResource
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedClients").
+		First(&resource, "id = ?", id).
+		Error
+	return resource, err
+}
+
+func (s *Service) CreateAPIResource(ctx context.Context, input apiResourceInputDto) (model.OidcAPIResource, error) {
+	var resource model.OidcAPIResource
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.saveAPIResource(tx, &resource, input)
+	})
+	if err != nil {
+		return model.OidcAPIResource{}, err
+	}
+
+	return resource, nil
+}
+
+func (s *Service) UpdateAPIResource(ctx context.Context, id string, input apiResourceInputDto) (model.OidcAPIResource, error) {
+	var resource model.OidcAPIResource
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&resource, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		return s.saveAPIResource(tx, &resource, input)
+	})
+	if err != nil {
+		return model.OidcAPIResource{}, err
+	}
+
+	return resource, nil
+}
+
+func (s *Service) DeleteAPIResource(ctx context.Context, id string) error {
+	result := s.db.
+		WithContext(ctx).
+		Delete(&model.OidcAPIResource{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// saveAPIResource validates the input, then creates or updates the API resource and replaces its allowed clients
+func (s *Service) saveAPIResource(tx *gorm.DB, resource *model.OidcAPIResource, input apiResourceInputDto) error {
+	if err := validateIdentifier(input.Identifier); err != nil {
+		return err
+	}
+	for _, scope := range input.Scopes {
+		if !scopeRegex.MatchString(scope) {
+			return &common.ValidationError{Message: "scopes must not contain spaces, quotes or backslashes"}
+		}
+	}
+
+	clients := []model.OidcClient{}
+	if len(input.AllowedClientIDs) > 0 {
+		err := tx.Where("id IN ?", input.AllowedClientIDs).Find(&clients).Error
+		if err != nil {
+			return err
+		}
+		if len(clients) != len(slices.Compact(slices.Sorted(slices.Values(input.AllowedClientIDs)))) {
+			return &common.ValidationError{Message: "one or more allowed clients do not exist"}
+		}
+	}
+
+	resource.Name = input.Name
+	resource.Identifier = input.Identifier
+	resource.Scopes = slices.Compact(slices.Sorted(slices.Values(input.Scopes)))
+	if resource.Scopes == nil {
+		resource.Scopes = []string{}
+	}
+	resource.AccessTokenLifetime = input.AccessTokenLifetime
+
+	err := tx.Omit("AllowedClients").Save(resource).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &common.AlreadyInUseError{Property: "Identifier"}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(resource).Association("AllowedClients").Replace(clients)
+	if err != nil {
+		return err
+	}
+	resource.AllowedClients = clients
+
+	return nil
+}
+
+// validateIdentifier checks that the identifier is an absolute URI without fragment, as resource indicators must be (RFC 8707 section 2)
+func validateIdentifier(identifier string) error {
+	u, err := url.Parse(identifier)
+	if err != nil || !u.IsAbs() || strings.Contains(identifier, "#") {
+		return &common.ValidationError{Message: "identifier must be an absolute URI without fragment"}
+	}
+
+	return nil
+}
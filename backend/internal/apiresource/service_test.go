@@ -0,0 +1,78 @@
+package apiresource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestServiceSaveAPIResource(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newService(db)
+
+	for _, id := range []string{"dashboard", "worker"} {
+		require.NoError(t, db.Create(&model.OidcClient{Base: model.Base{ID: id}, Name: id}).Error)
+	}
+
+	resource, err := service.CreateAPIResource(t.Context(), apiResourceInputDto{
+		Name:                "Orders API",
+		Identifier:          "https://api.example.com/orders",
+		Scopes:              []string{"orders:write", "orders:read", "orders:read"},
+		AccessTokenLifetime: 600,
+		AllowedClientIDs:    []string{"dashboard", "worker"},
+	})
+	require.NoError(t, err)
+	require.Len(t, resource.AllowedClients, 2)
+	require.Equal(t, []string{"orders:read", "orders:write"}, []string(resource.Scopes))
+
+	t.Run("update replaces the allowed clients", func(t *testing.T) {
+		updated, err := service.UpdateAPIResource(t.Context(), resource.ID, apiResourceInputDto{
+			Name:             "Orders API",
+			Identifier:       "https://api.example.com/orders",
+			AllowedClientIDs: []string{"worker"},
+		})
+		require.NoError(t, err)
+		require.Empty(t, updated.Scopes)
+		require.Zero(t, updated.AccessTokenLifetime)
+
+		loaded, err := service.GetAPIResource(t.Context(), resource.ID)
+		require.NoError(t, err)
+		require.Len(t, loaded.AllowedClients, 1)
+		require.Equal(t, "worker", loaded.AllowedClients[0].ID)
+	})
+
+	t.Run("duplicate identifier is rejected", func(t *testing.T) {
+		_, err := service.CreateAPIResource(t.Context(), apiResourceInputDto{Name: "Orders", Identifier: "https://api.example.com/orders"})
+		require.ErrorIs(t, err, &common.AlreadyInUseError{})
+	})
+
+	t.Run("invalid identifiers are rejected", func(t *testing.T) {
+		for _, identifier := range []string{"orders", "/orders", "https://api.example.com/orders#v1", "https://api.example.com/orders#"} {
+			_, err := service.CreateAPIResource(t.Context(), apiResourceInputDto{Name: "Orders", Identifier: identifier})
+			var validationErr *common.ValidationError
+			require.ErrorAs(t, err, &validationErr, identifier)
+		}
+	})
+
+	t.Run("scope with a space is rejected", func(t *testing.T) {
+		_, err := service.CreateAPIResource(t.Context(), apiResourceInputDto{Name: "Billing", Identifier: "urn:example:billing", Scopes: []string{"billing read"}})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("unknown client is rejected", func(t *testing.T) {
+		_, err := service.CreateAPIResource(t.Context(), apiResourceInputDto{Name: "Billing", Identifier: "urn:example:billing", AllowedClientIDs: []string{"unknown"}})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("delete removes the API resource", func(t *testing.T) {
+		require.NoError(t, service.DeleteAPIResource(t.Context(), resource.ID))
+		require.ErrorIs(t, service.DeleteAPIResource(t.Context(), resource.ID), gorm.ErrRecordNotFound)
+	})
+}
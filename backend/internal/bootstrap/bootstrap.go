@@ -103,6 +103,14 @@ func Bootstrap(ctx context.Context) error {
 		services = append(services, scheduler.Run)
 	}
 
+	ldapServer, err := initLdapServer(svc.ldapServerModule)
+	if err != nil {
+		return fmt.Errorf("failed to initialize LDAP server: %w", err)
+	}
+	if ldapServer != nil {
+		services = append(services, ldapServer)
+	}
+
 	err = utils.NewServiceRunner(services...).Run(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to run services: %w", err)
@@ -0,0 +1,83 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/ldapserver"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// initLdapServer creates the listeners of the read-only LDAP server and returns the service that serves them, or nil
+// if the LDAP server is disabled
+func initLdapServer(module *ldapserver.Module) (utils.Service, error) {
+	addr := common.EnvConfig.LdapServerAddr
+	tlsAddr := common.EnvConfig.LdapsServerAddr
+	if addr == "" && tlsAddr == "" {
+		return nil, nil
+	}
+
+	var tlsConfig *tls.Config
+	var certProvider *tlsCertProvider
+	if common.EnvConfig.TLSCertFile != "" && common.EnvConfig.TLSKeyFile != "" {
+		var err error
+		certProvider, err = newCertProvider(common.EnvConfig.TLSCertFile, common.EnvConfig.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			GetCertificate: certProvider.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	if tlsConfig == nil && tlsAddr == "" && !common.EnvConfig.LdapServerAllowInsecureBinds {
+		slog.Warn("The LDAP server has no TLS certificate, so clients can only bind anonymously. Set TLS_CERT and TLS_KEY, or LDAP_SERVER_ALLOW_INSECURE_BINDS on trusted networks")
+	}
+
+	var listener, tlsListener net.Listener
+	var err error
+	if addr != "" {
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+	}
+	if tlsAddr != "" {
+		tlsListener, err = net.Listen("tcp", tlsAddr)
+		if err != nil {
+			if listener != nil {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", tlsAddr, err)
+		}
+	}
+
+	return func(ctx context.Context) error {
+		certWatcher, err := startCertWatcher(ctx, certProvider)
+		if err != nil {
+			return err
+		}
+		defer closeCertWatcher(certWatcher)
+
+		var servers []utils.Service
+		if listener != nil {
+			slog.Info("LDAP server listening", slog.String("addr", addr), slog.Bool("starttls", tlsConfig != nil))
+			servers = append(servers, func(ctx context.Context) error {
+				return module.Serve(ctx, listener, tlsConfig, false)
+			})
+		}
+		if tlsListener != nil {
+			slog.Info("LDAPS server listening", slog.String("addr", tlsAddr))
+			servers = append(servers, func(ctx context.Context) error {
+				return module.Serve(ctx, tlsListener, tlsConfig, true)
+			})
+		}
+
+		return utils.NewServiceRunner(servers...).Run(ctx)
+	}, nil
+}
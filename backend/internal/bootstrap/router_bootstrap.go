@@ -117,7 +117,8 @@ func registerRoutes(r *gin.Engine, db *gorm.DB, svc *services) error {
 	}
 
 	// Initialize middleware for specific routes
-	authMiddleware := middleware.NewAuthMiddleware(svc.apiKeyModule, svc.userService, svc.jwtService)
+	authMiddleware := middleware.NewAuthMiddleware(svc.apiKeyModule, svc.userService, svc.jwtService, svc.userSessionService).
+		WithAdminMutationHook(svc.webhookModule.RecordAdminMutation)
 	fileSizeLimitMiddleware := middleware.NewFileSizeLimitMiddleware()
 	apiRateLimitMiddleware := middleware.NewRateLimitMiddleware().Add(rate.Every(time.Second), 100)
 
@@ -135,7 +136,7 @@ func registerRoutes(r *gin.Engine, db *gorm.DB, svc *services) error {
 		webauthnRateLimitMiddleware.Add(rate.Every(10*time.Second), 5),
 	)
 	controller.NewOidcController(apiGroup, authMiddleware, fileSizeLimitMiddleware, svc.oidcService)
-	controller.NewUserController(apiGroup, authMiddleware, middleware.NewRateLimitMiddleware(), svc.userService, svc.oneTimeAccessService, svc.webauthnModule, svc.appConfigService)
+	controller.NewUserController(apiGroup, authMiddleware, middleware.NewRateLimitMiddleware(), svc.userService, svc.oneTimeAccessService, svc.webauthnModule, svc.userSessionService, svc.appConfigService)
 	controller.NewAppConfigController(apiGroup, authMiddleware, svc.appConfigService, svc.emailService, svc.ldapService)
 	controller.NewAppImagesController(apiGroup, authMiddleware, svc.appImagesService)
 	controller.NewAuditLogController(apiGroup, svc.auditLogService, authMiddleware)
@@ -151,10 +152,18 @@ func registerRoutes(r *gin.Engine, db *gorm.DB, svc *services) error {
 	optionalBrowserAuth := authMiddleware.WithAdminNotRequired().WithSuccessOptional().WithApiKeyAuthDisabled().Add()
 	browserAuth := authMiddleware.WithAdminNotRequired().WithApiKeyAuthDisabled().Add()
 	svc.oidcModule.RegisterRoutes(baseGroup, apiGroup, optionalBrowserAuth, browserAuth)
+	svc.clientRegistrationModule.RegisterRoutes(apiGroup, authMiddleware.Add())
+	svc.oidcScopeModule.RegisterRoutes(apiGroup, authMiddleware.Add())
+	svc.apiResourceModule.RegisterRoutes(apiGroup, authMiddleware.Add())
+	svc.samlModule.RegisterRoutes(apiGroup, optionalBrowserAuth, authMiddleware.Add())
+	svc.ldapServerModule.RegisterRoutes(apiGroup, authMiddleware.Add())
+	svc.forwardAuthModule.RegisterRoutes(apiGroup, optionalBrowserAuth)
+	svc.scimServerModule.RegisterRoutes(baseGroup)
+	svc.webhookModule.RegisterRoutes(apiGroup, authMiddleware.Add())
 
 	registerTestRoutes(apiGroup, db, svc)
 
-	controller.NewWellKnownController(baseGroup, svc.jwtService)
+	controller.NewWellKnownController(baseGroup, svc.jwtService, svc.oidcScopeModule, svc.oidcModule.RequestObjectEncryptionKey)
 
 	// These are not rate-limited.
 	controller.NewHealthzController(r)
@@ -220,6 +229,11 @@ func initServerProtocols() (*http.Protocols, *tls.Config, *tlsCertProvider, erro
 		MinVersion:     tls.VersionTLS13,
 		NextProtos:     []string{"h2"},
 	}
+	if common.EnvConfig.TLSClientCAFile != "" {
+		// Client certificates are verified when clients authenticate with them, because self-signed certificates
+		// are accepted too, so the handshake only requests them
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	}
 
 	slog.Info("TLS enabled")
 	return protocols, tlsConfig, certProvider, nil
@@ -35,10 +35,22 @@ func registerScheduledJobs(ctx context.Context, db *gorm.DB, svc *services, http
 	if err != nil {
 		return fmt.Errorf("failed to register analytics job in scheduler: %w", err)
 	}
+	err = scheduler.RegisterSigningKeyRotationJobs(ctx, svc.jwtService)
+	if err != nil {
+		return fmt.Errorf("failed to register signing key rotation job in scheduler: %w", err)
+	}
 	err = scheduler.RegisterScimJobs(ctx, svc.scimService)
 	if err != nil {
 		return fmt.Errorf("failed to register SCIM scheduler job: %w", err)
 	}
+	err = scheduler.RegisterBackchannelLogoutJobs(ctx, svc.oidcModule.BackchannelLogout)
+	if err != nil {
+		return fmt.Errorf("failed to register back-channel logout job in scheduler: %w", err)
+	}
+	err = scheduler.RegisterWebhookJobs(ctx, svc.webhookModule)
+	if err != nil {
+		return fmt.Errorf("failed to register webhook job in scheduler: %w", err)
+	}
 
 	return nil
 }
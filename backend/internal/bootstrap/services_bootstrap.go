@@ -2,19 +2,30 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/pocket-id/pocket-id/backend/internal/apikey"
+	"github.com/pocket-id/pocket-id/backend/internal/apiresource"
+	"github.com/pocket-id/pocket-id/backend/internal/clientregistration"
+	"github.com/pocket-id/pocket-id/backend/internal/forwardauth"
 	"github.com/pocket-id/pocket-id/backend/internal/job"
 	"gorm.io/gorm"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/ldapserver"
 	"github.com/pocket-id/pocket-id/backend/internal/oidc"
+	"github.com/pocket-id/pocket-id/backend/internal/oidcscope"
+	"github.com/pocket-id/pocket-id/backend/internal/saml"
+	"github.com/pocket-id/pocket-id/backend/internal/scimserver"
 	"github.com/pocket-id/pocket-id/backend/internal/service"
 	"github.com/pocket-id/pocket-id/backend/internal/storage"
 	"github.com/pocket-id/pocket-id/backend/internal/usersignup"
 	"github.com/pocket-id/pocket-id/backend/internal/webauthn"
+	"github.com/pocket-id/pocket-id/backend/internal/webhook"
 )
 
 type services struct {
@@ -34,11 +45,20 @@ type services struct {
 	fileStorage          storage.FileStorage
 	appLockService       *service.AppLockService
 	oneTimeAccessService *service.OneTimeAccessService
-
-	apiKeyModule     *apikey.Module
-	oidcModule       *oidc.Module
-	webauthnModule   *webauthn.Module
-	userSignUpModule *usersignup.Module
+	userSessionService   *service.UserSessionService
+
+	apiKeyModule             *apikey.Module
+	oidcModule               *oidc.Module
+	clientRegistrationModule *clientregistration.Module
+	oidcScopeModule          *oidcscope.Module
+	apiResourceModule        *apiresource.Module
+	samlModule               *saml.Module
+	ldapServerModule         *ldapserver.Module
+	forwardAuthModule        *forwardauth.Module
+	scimServerModule         *scimserver.Module
+	webauthnModule           *webauthn.Module
+	userSignUpModule         *usersignup.Module
+	webhookModule            *webhook.Module
 }
 
 // Initializes all services
@@ -60,17 +80,24 @@ func initServices(ctx context.Context, db *gorm.DB, httpClient *http.Client, ima
 	}
 
 	svc.geoLiteService = service.NewGeoLiteService(httpClient)
-	svc.auditLogService = service.NewAuditLogService(db, svc.appConfigService, svc.emailService, svc.geoLiteService)
+	svc.webhookModule = webhook.New(webhook.Dependencies{
+		DB:         db,
+		HTTPClient: httpClient,
+	})
+	svc.auditLogService = service.NewAuditLogService(db, svc.appConfigService, svc.emailService, svc.geoLiteService, svc.webhookModule)
+	svc.appConfigService.SetAuditLogService(svc.auditLogService)
 	svc.jwtService, err = service.NewJwtService(ctx, db, svc.appConfigService)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create JWT service: %w", err)
 	}
 
-	svc.customClaimService = service.NewCustomClaimService(db)
+	svc.userSessionService = service.NewUserSessionService(db, svc.jwtService, svc.appConfigService, svc.geoLiteService)
+	svc.customClaimService = service.NewCustomClaimService(db, svc.auditLogService)
 	svc.webauthnModule, err = webauthn.New(webauthn.Dependencies{
 		DB:        db,
 		AppURL:    common.EnvConfig.AppURL,
 		Signer:    svc.jwtService,
+		Sessions:  svc.userSessionService,
 		AuditLog:  svc.auditLogService,
 		AppConfig: svc.appConfigService,
 	})
@@ -78,37 +105,65 @@ func initServices(ctx context.Context, db *gorm.DB, httpClient *http.Client, ima
 		return nil, fmt.Errorf("failed to create WebAuthn module: %w", err)
 	}
 
-	svc.scimService = service.NewScimService(db, scheduler, httpClient)
+	clientCAs, err := loadTLSClientCAs(common.EnvConfig.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS client CAs: %w", err)
+	}
 
 	svc.oidcModule, err = oidc.New(ctx, oidc.Dependencies{
 		DB:         db,
 		HTTPClient: httpClient,
 		Config: oidc.Config{
 			BaseURL:      common.EnvConfig.AppURL,
-			TokenBaseURL: common.EnvConfig.AppURL,
+			TokenBaseURL: common.EnvConfig.InternalAppURL,
 			Secret:       string(common.EnvConfig.EncryptionKey),
+
+			ClientCAs:               clientCAs,
+			ClientCertificateHeader: common.EnvConfig.TLSClientCertHeader,
 		},
 		Signer:       svc.jwtService,
 		CustomClaims: svc.customClaimService,
 		Reauth:       svc.webauthnModule,
 		AuditLog:     svc.auditLogService,
+
+		BackchannelAuthentication: svc.emailService,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC module: %w", err)
 	}
+	svc.userSessionService.SetBackchannelLogout(svc.oidcModule.BackchannelLogout)
 
-	svc.oidcService, err = service.NewOidcService(db, svc.jwtService, svc.appConfigService, svc.oidcModule.Preview, svc.scimService, httpClient, fileStorage)
+	svc.scimService = service.NewScimService(db, scheduler, httpClient, svc.oidcModule.Subjects, svc.auditLogService)
+	svc.customClaimService.SetScimService(svc.scimService)
+
+	svc.oidcService, err = service.NewOidcService(db, svc.jwtService, svc.appConfigService, svc.oidcModule.Preview, svc.scimService, svc.auditLogService, svc.oidcModule.BackchannelLogout, httpClient, fileStorage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC service: %w", err)
 	}
 
-	svc.userGroupService = service.NewUserGroupService(db, svc.appConfigService, svc.scimService)
-	svc.userService = service.NewUserService(db, svc.jwtService, svc.auditLogService, svc.emailService, svc.appConfigService, svc.customClaimService, svc.appImagesService, svc.scimService, fileStorage)
+	svc.clientRegistrationModule = clientregistration.New(clientregistration.Dependencies{
+		DB:       db,
+		BaseURL:  common.EnvConfig.AppURL,
+		Clients:  svc.oidcService,
+		AuditLog: svc.auditLogService,
+	})
+
+	svc.oidcScopeModule = oidcscope.New(oidcscope.Dependencies{
+		DB: db,
+	})
+
+	svc.apiResourceModule = apiresource.New(apiresource.Dependencies{
+		DB: db,
+	})
+
+	svc.userGroupService = service.NewUserGroupService(db, svc.appConfigService, svc.scimService, svc.auditLogService)
+	svc.userService = service.NewUserService(db, svc.jwtService, svc.auditLogService, svc.emailService, svc.appConfigService, svc.customClaimService, svc.appImagesService, svc.scimService, svc.oidcModule.BackchannelLogout, fileStorage)
 	svc.ldapService = service.NewLdapService(db, httpClient, svc.appConfigService, svc.userService, svc.userGroupService, fileStorage)
 
 	svc.apiKeyModule, err = apikey.New(ctx, apikey.Dependencies{
 		DB:           db,
 		StaticApiKey: common.EnvConfig.StaticApiKey,
+		AuditLog:     svc.auditLogService,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create API key module: %w", err)
@@ -116,14 +171,70 @@ func initServices(ctx context.Context, db *gorm.DB, httpClient *http.Client, ima
 
 	svc.userSignUpModule = usersignup.New(usersignup.Dependencies{
 		DB:          db,
-		Signer:      svc.jwtService,
+		Sessions:    svc.userSessionService,
 		AuditLog:    svc.auditLogService,
 		AppConfig:   svc.appConfigService,
 		UserCreator: svc.userService,
 	})
-	svc.oneTimeAccessService = service.NewOneTimeAccessService(db, svc.userService, svc.jwtService, svc.auditLogService, svc.emailService, svc.appConfigService)
+	svc.samlModule = saml.New(saml.Dependencies{
+		DB:           db,
+		AppURL:       common.EnvConfig.AppURL,
+		Signer:       svc.jwtService,
+		CustomClaims: svc.customClaimService,
+		Sessions:     svc.userSessionService,
+		AuditLog:     svc.auditLogService,
+		AppConfig:    svc.appConfigService,
+	})
+	svc.forwardAuthModule = forwardauth.New(forwardauth.Dependencies{
+		DB:           db,
+		AppURL:       common.EnvConfig.AppURL,
+		Sessions:     svc.userSessionService,
+		CustomClaims: svc.customClaimService,
+		AuditLog:     svc.auditLogService,
+	})
+	svc.ldapServerModule, err = ldapserver.New(ldapserver.Dependencies{
+		DB:                 db,
+		ApiKeys:            svc.apiKeyModule,
+		BaseDN:             common.EnvConfig.LdapServerBaseDN,
+		Addr:               common.EnvConfig.LdapServerAddr,
+		TLSAddr:            common.EnvConfig.LdapsServerAddr,
+		AllowInsecureBinds: common.EnvConfig.LdapServerAllowInsecureBinds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LDAP server module: %w", err)
+	}
+	svc.scimServerModule = scimserver.New(scimserver.Dependencies{
+		DB:           db,
+		AppURL:       common.EnvConfig.AppURL,
+		ApiKeys:      svc.apiKeyModule,
+		Users:        svc.userService,
+		Groups:       svc.userGroupService,
+		CustomClaims: svc.customClaimService,
+		AuditLog:     svc.auditLogService,
+	})
+	svc.oneTimeAccessService = service.NewOneTimeAccessService(db, svc.userService, svc.userSessionService, svc.auditLogService, svc.emailService, svc.appConfigService)
 
 	svc.versionService = service.NewVersionService(httpClient)
 
 	return svc, nil
 }
+
+// loadTLSClientCAs loads the CAs that issue the certificates of clients that authenticate with mutual TLS, or returns
+// nil if no CA file is configured
+func loadTLSClientCAs(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+
+	// #nosec G304 - Path is passed by the admin
+	pemCerts, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, errors.New("the file doesn't contain any PEM-encoded certificate")
+	}
+	return pool, nil
+}
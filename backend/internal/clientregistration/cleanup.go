@@ -0,0 +1,19 @@
+package clientregistration
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+// CleanupExpiredInitialAccessTokens deletes initial access tokens that have expired
+// It returns the number of rows removed
+func CleanupExpiredInitialAccessTokens(ctx context.Context, db *gorm.DB) (int64, error) {
+	st := db.
+		WithContext(ctx).
+		Delete(&InitialAccessToken{}, "expires_at < ?", datatype.DateTime(time.Now()))
+	return st.RowsAffected, st.Error
+}
@@ -0,0 +1,69 @@
+package clientregistration
+
+import (
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// clientMetadataDto contains the client metadata defined in RFC 7591 section 2 that Pocket ID supports
+type clientMetadataDto struct {
+	RedirectURIs                     []string `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs           []string `json:"post_logout_redirect_uris,omitempty"`
+	TokenEndpointAuthMethod          string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes                       []string `json:"grant_types,omitempty"`
+	ResponseTypes                    []string `json:"response_types,omitempty"`
+	ClientName                       string   `json:"client_name,omitempty" unorm:"nfc"`
+	ClientURI                        string   `json:"client_uri,omitempty"`
+	LogoURI                          string   `json:"logo_uri,omitempty"`
+	DPoPBoundAccessTokens            bool     `json:"dpop_bound_access_tokens,omitempty"`
+	SubjectType                      string   `json:"subject_type,omitempty"`
+	SectorIdentifierURI              string   `json:"sector_identifier_uri,omitempty"`
+	BackchannelLogoutURI             string   `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired bool     `json:"backchannel_logout_session_required,omitempty"`
+	FrontchannelLogoutURI            string   `json:"frontchannel_logout_uri,omitempty"`
+	// BackchannelTokenDeliveryMode and BackchannelClientNotificationEndpoint are defined in OpenID Connect CIBA section 4
+	BackchannelTokenDeliveryMode          string `json:"backchannel_token_delivery_mode,omitempty"`
+	BackchannelClientNotificationEndpoint string `json:"backchannel_client_notification_endpoint,omitempty"`
+}
+
+// clientUpdateDto is the body of an RFC 7592 client update request
+type clientUpdateDto struct {
+	clientMetadataDto
+	ClientID string `json:"client_id"`
+}
+
+// clientInformationDto is the client information response defined in RFC 7591 section 3.2.1 and RFC 7592 section 3
+type clientInformationDto struct {
+	clientMetadataDto
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+type registrationErrorDto struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type initialAccessTokenCreateDto struct {
+	Name       string             `json:"name" binding:"required,min=1,max=50" unorm:"nfc"`
+	TTL        utils.JSONDuration `json:"ttl" binding:"required,ttl"`
+	UsageLimit int                `json:"usageLimit" binding:"required,min=1,max=1000"`
+}
+
+type initialAccessTokenDto struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	ExpiresAt  datatype.DateTime `json:"expiresAt"`
+	UsageLimit int               `json:"usageLimit"`
+	UsageCount int               `json:"usageCount"`
+	CreatedAt  datatype.DateTime `json:"createdAt"`
+}
+
+type initialAccessTokenResponseDto struct {
+	InitialAccessToken initialAccessTokenDto `json:"initialAccessToken"`
+	Token              string                `json:"token"`
+}
@@ -0,0 +1,236 @@
+package clientregistration
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+type requestMeta struct {
+	IPAddress string
+	UserAgent string
+}
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// registerClient godoc
+// @Summary Register OIDC client
+// @Description Dynamically register a new OIDC client as defined in RFC 7591. Requires an initial access token issued by an admin.
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Param metadata body clientMetadataDto true "Client metadata"
+// @Success 201 {object} clientInformationDto "Registered client with registration access token"
+// @Router /api/oidc/register [post]
+func (h *handler) registerClient(c *gin.Context) {
+	var input clientMetadataDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		writeError(c, invalidMetadata("the request body must be a valid JSON object"))
+		return
+	}
+
+	client, err := h.service.RegisterClient(c.Request.Context(), bearerToken(c), input, requestMetaFromGin(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	setNoStoreHeaders(c)
+	c.JSON(http.StatusCreated, client)
+}
+
+// getRegisteredClient godoc
+// @Summary Get registered OIDC client
+// @Description Get the configuration of a dynamically registered OIDC client as defined in RFC 7592. Requires the registration access token of the client.
+// @Tags OIDC
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} clientInformationDto "Registered client"
+// @Router /api/oidc/register/{id} [get]
+func (h *handler) getRegisteredClient(c *gin.Context) {
+	client, err := h.service.GetRegisteredClient(c.Request.Context(), c.Param("id"), bearerToken(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	setNoStoreHeaders(c)
+	c.JSON(http.StatusOK, client)
+}
+
+// updateRegisteredClient godoc
+// @Summary Update registered OIDC client
+// @Description Replace the metadata of a dynamically registered OIDC client as defined in RFC 7592. Requires the registration access token of the client.
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param metadata body clientUpdateDto true "Client metadata"
+// @Success 200 {object} clientInformationDto "Updated client"
+// @Router /api/oidc/register/{id} [put]
+func (h *handler) updateRegisteredClient(c *gin.Context) {
+	var input clientUpdateDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		writeError(c, invalidMetadata("the request body must be a valid JSON object"))
+		return
+	}
+
+	client, err := h.service.UpdateRegisteredClient(c.Request.Context(), c.Param("id"), bearerToken(c), input, requestMetaFromGin(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	setNoStoreHeaders(c)
+	c.JSON(http.StatusOK, client)
+}
+
+// deleteRegisteredClient godoc
+// @Summary Delete registered OIDC client
+// @Description Delete a dynamically registered OIDC client as defined in RFC 7592. Requires the registration access token of the client.
+// @Tags OIDC
+// @Param id path string true "Client ID"
+// @Success 204 "No Content"
+// @Router /api/oidc/register/{id} [delete]
+func (h *handler) deleteRegisteredClient(c *gin.Context) {
+	err := h.service.DeleteRegisteredClient(c.Request.Context(), c.Param("id"), bearerToken(c), requestMetaFromGin(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// createInitialAccessToken godoc
+// @Summary Create initial access token
+// @Description Create a new initial access token that allows the dynamic registration of OIDC clients
+// @Tags OIDC
+// @Accept json
+// @Produce json
+// @Param body body initialAccessTokenCreateDto true "Initial access token information"
+// @Success 201 {object} initialAccessTokenResponseDto "Created initial access token with token"
+// @Router /api/oidc/initial-access-tokens [post]
+func (h *handler) createInitialAccessToken(c *gin.Context) {
+	var input initialAccessTokenCreateDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	token, rawToken, err := h.service.CreateInitialAccessToken(c.Request.Context(), c.GetString("userID"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var tokenDto initialAccessTokenDto
+	if err := dto.MapStruct(token, &tokenDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, initialAccessTokenResponseDto{
+		InitialAccessToken: tokenDto,
+		Token:              rawToken,
+	})
+}
+
+// listInitialAccessTokens godoc
+// @Summary List initial access tokens
+// @Description Get a paginated list of initial access tokens for the dynamic registration of OIDC clients
+// @Tags OIDC
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[initialAccessTokenDto]
+// @Router /api/oidc/initial-access-tokens [get]
+func (h *handler) listInitialAccessTokens(c *gin.Context) {
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	tokens, pagination, err := h.service.ListInitialAccessTokens(c.Request.Context(), listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var tokensDto []initialAccessTokenDto
+	if err := dto.MapStructList(tokens, &tokensDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[initialAccessTokenDto]{
+		Data:       tokensDto,
+		Pagination: pagination,
+	})
+}
+
+// deleteInitialAccessToken godoc
+// @Summary Delete initial access token
+// @Description Delete an initial access token. Clients registered with it are not affected.
+// @Tags OIDC
+// @Param id path string true "Initial access token ID"
+// @Success 204 "No Content"
+// @Router /api/oidc/initial-access-tokens/{id} [delete]
+func (h *handler) deleteInitialAccessToken(c *gin.Context) {
+	if err := h.service.DeleteInitialAccessToken(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// writeError writes registration errors in the format defined in RFC 7591 section 3.2.2
+// Other errors are passed on to the error handler middleware
+func writeError(c *gin.Context, err error) {
+	regErr, ok := errors.AsType[*registrationError](err)
+	if !ok {
+		_ = c.Error(err)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if regErr.code == errorInvalidToken {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	c.JSON(status, registrationErrorDto{
+		Error:            regErr.code,
+		ErrorDescription: regErr.description,
+	})
+}
+
+func setNoStoreHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
+
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func requestMetaFromGin(c *gin.Context) requestMeta {
+	return requestMeta{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,46 @@
+package clientregistration
+
+import (
+	"time"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+// InitialAccessToken is an admin-issued token that authorizes the dynamic registration of OIDC clients
+type InitialAccessToken struct {
+	model.Base
+
+	Name       string
+	Token      string
+	ExpiresAt  datatype.DateTime `sortable:"true"`
+	UsageLimit int               `sortable:"true"`
+	UsageCount int               `sortable:"true"`
+
+	CreatedByID *string
+}
+
+func (InitialAccessToken) TableName() string {
+	return "oidc_initial_access_tokens"
+}
+
+func (t *InitialAccessToken) IsExpired() bool {
+	return time.Time(t.ExpiresAt).Before(time.Now())
+}
+
+func (t *InitialAccessToken) IsValid() bool {
+	return !t.IsExpired() && t.UsageCount < t.UsageLimit
+}
+
+// ClientRegistration links a dynamically registered OIDC client to the registration access token used to manage it
+type ClientRegistration struct {
+	ClientID                string `gorm:"primaryKey"`
+	CreatedAt               datatype.DateTime
+	RegistrationAccessToken string
+	TokenEndpointAuthMethod string
+	InitialAccessTokenID    *string
+}
+
+func (ClientRegistration) TableName() string {
+	return "oidc_client_registrations"
+}
@@ -0,0 +1,61 @@
+package clientregistration
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+type AuditLogger interface {
+	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
+}
+
+// ClientManager manages OIDC clients, so registered clients go through the same logic as clients created by an admin
+type ClientManager interface {
+	GetClient(ctx context.Context, clientID string) (model.OidcClient, error)
+	CreateClientInternal(ctx context.Context, input dto.OidcClientCreateDto, userID string, tx *gorm.DB) (model.OidcClient, error)
+	UpdateClientInternal(ctx context.Context, clientID string, input dto.OidcClientUpdateDto, tx *gorm.DB) (model.OidcClient, error)
+	DeleteClientInternal(ctx context.Context, clientID string, tx *gorm.DB) (model.OidcClient, error)
+	CreateClientSecretInternal(ctx context.Context, clientID string, tx *gorm.DB) (string, error)
+	SaveClientLogoFromURL(ctx context.Context, clientID string, logoURL string, light bool) error
+	DeleteClientImages(ctx context.Context, client model.OidcClient)
+}
+
+type Dependencies struct {
+	DB      *gorm.DB
+	BaseURL string
+
+	Clients  ClientManager
+	AuditLog AuditLogger
+}
+
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(deps)
+	return &Module{
+		service: service,
+		handler: newHandler(service),
+	}
+}
+
+// RegisterRoutes mounts the dynamic client registration endpoints (RFC 7591 and RFC 7592)
+// and the admin endpoints to manage initial access tokens
+// The registration endpoints authenticate with initial and registration access tokens instead of a user session
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, adminAuth gin.HandlerFunc) {
+	apiGroup.POST("/oidc/register", m.handler.registerClient)
+	apiGroup.GET("/oidc/register/:id", m.handler.getRegisteredClient)
+	apiGroup.PUT("/oidc/register/:id", m.handler.updateRegisteredClient)
+	apiGroup.DELETE("/oidc/register/:id", m.handler.deleteRegisteredClient)
+
+	apiGroup.GET("/oidc/initial-access-tokens", adminAuth, m.handler.listInitialAccessTokens)
+	apiGroup.POST("/oidc/initial-access-tokens", adminAuth, m.handler.createInitialAccessToken)
+	apiGroup.DELETE("/oidc/initial-access-tokens/:id", adminAuth, m.handler.deleteInitialAccessToken)
+}
@@ -0,0 +1,706 @@
+package clientregistration
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+const (
+	authMethodNone              = "none"
+	authMethodClientSecretBasic = "client_secret_basic"
+	authMethodClientSecretPost  = "client_secret_post"
+
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeCIBA              = "urn:openid:params:grant-type:ciba"
+
+	responseTypeCode = "code"
+
+	// defaultClientName is used when a client registers without a client_name
+	defaultClientName = "Dynamically Registered Client"
+)
+
+// Error codes defined in RFC 7591 section 3.2.2 and RFC 6750 section 3.1
+const (
+	errorInvalidRedirectURI    = "invalid_redirect_uri"
+	errorInvalidClientMetadata = "invalid_client_metadata"
+	errorInvalidToken          = "invalid_token"
+)
+
+// registrationError is an error that is returned to the client in the format defined in RFC 7591 section 3.2.2
+type registrationError struct {
+	code        string
+	description string
+}
+
+func (e *registrationError) Error() string {
+	return e.code + ": " + e.description
+}
+
+func invalidMetadata(description string) error {
+	return &registrationError{code: errorInvalidClientMetadata, description: description}
+}
+
+func invalidToken(description string) error {
+	return &registrationError{code: errorInvalidToken, description: description}
+}
+
+// Service holds the business logic for dynamic client registration
+type Service struct {
+	db       *gorm.DB
+	clients  ClientManager
+	auditLog AuditLogger
+	baseURL  string
+
+	// isURLPrivate is a field so tests can resolve hosts without DNS
+	isURLPrivate func(ctx context.Context, u *url.URL) (bool, error)
+}
+
+func newService(deps Dependencies) *Service {
+	return &Service{
+		db:       deps.DB,
+		clients:  deps.Clients,
+		auditLog: deps.AuditLog,
+		baseURL:  deps.BaseURL,
+
+		isURLPrivate: utils.IsURLPrivate,
+	}
+}
+
+func (s *Service) CreateInitialAccessToken(ctx context.Context, userID string, input initialAccessTokenCreateDto) (InitialAccessToken, string, error) {
+	token, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return InitialAccessToken{}, "", err
+	}
+
+	initialAccessToken := InitialAccessToken{
+		Name:        input.Name,
+		Token:       utils.CreateSha256Hash(token),
+		ExpiresAt:   datatype.DateTime(time.Now().Add(input.TTL.Duration)),
+		UsageLimit:  input.UsageLimit,
+		CreatedByID: &userID,
+	}
+
+	err = s.db.
+		WithContext(ctx).
+		Create(&initialAccessToken).
+		Error
+	if err != nil {
+		return InitialAccessToken{}, "", err
+	}
+
+	// Return the raw token only once - it cannot be retrieved later
+	return initialAccessToken, token, nil
+}
+
+func (s *Service) ListInitialAccessTokens(ctx context.Context, listRequestOptions utils.ListRequestOptions) ([]InitialAccessToken, utils.PaginationResponse, error) {
+	var tokens []InitialAccessToken
+	query := s.db.WithContext(ctx).Model(&InitialAccessToken{})
+
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &tokens)
+	return tokens, pagination, err
+}
+
+func (s *Service) DeleteInitialAccessToken(ctx context.Context, tokenID string) error {
+	return s.db.WithContext(ctx).Delete(&InitialAccessToken{}, "id = ?", tokenID).Error
+}
+
+// RegisterClient creates a new OIDC client from the metadata as described in RFC 7591
+func (s *Service) RegisterClient(ctx context.Context, rawInitialAccessToken string, metadata clientMetadataDto, meta requestMeta) (clientInformationDto, error) {
+	input, authMethod, err := createDtoFromMetadata(metadata)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+	err = s.requirePublicEndpoints(ctx, input)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	registrationAccessToken, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	// The initial access token is only used up if the client is registered
+	var (
+		initialAccessToken InitialAccessToken
+		client             model.OidcClient
+		clientSecret       string
+		registration       ClientRegistration
+	)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		initialAccessToken, err = s.consumeInitialAccessToken(ctx, tx, rawInitialAccessToken)
+		if err != nil {
+			return err
+		}
+
+		client, err = s.clients.CreateClientInternal(ctx, input, *initialAccessToken.CreatedByID, tx)
+		if err != nil {
+			return err
+		}
+
+		if !client.IsPublic {
+			clientSecret, err = s.clients.CreateClientSecretInternal(ctx, client.ID, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		registration = ClientRegistration{
+			ClientID:                client.ID,
+			CreatedAt:               datatype.DateTime(time.Now()),
+			RegistrationAccessToken: utils.CreateSha256Hash(registrationAccessToken),
+			TokenEndpointAuthMethod: authMethod,
+			InitialAccessTokenID:    &initialAccessToken.ID,
+		}
+		return tx.
+			WithContext(ctx).
+			Create(&registration).
+			Error
+	})
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	s.auditLog.Create(ctx, model.AuditLogEventClientRegistration, meta.IPAddress, meta.UserAgent, *initialAccessToken.CreatedByID, model.AuditLogData{
+		"clientName":         client.Name,
+		"initialAccessToken": initialAccessToken.Name,
+	}, s.db.WithContext(ctx))
+
+	// Storage operations must be executed outside of a transaction
+	// The client is already registered at this point, so a logo that can't be downloaded is left out of the response
+	// instead of failing the registration, which would lose the client secret and registration access token
+	if input.LogoURL != nil {
+		client = s.saveLogo(ctx, client, *input.LogoURL)
+	}
+
+	response := s.clientInformation(client, registration)
+	response.ClientSecret = clientSecret
+	response.RegistrationAccessToken = registrationAccessToken
+	return response, nil
+}
+
+// GetRegisteredClient returns the current configuration of a dynamically registered client as described in RFC 7592
+func (s *Service) GetRegisteredClient(ctx context.Context, clientID, rawRegistrationAccessToken string) (clientInformationDto, error) {
+	registration, err := s.authenticateRegistration(ctx, clientID, rawRegistrationAccessToken)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	client, err := s.clients.GetClient(ctx, clientID)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	return s.clientInformation(client, registration), nil
+}
+
+// UpdateRegisteredClient replaces the metadata of a dynamically registered client as described in RFC 7592
+func (s *Service) UpdateRegisteredClient(ctx context.Context, clientID, rawRegistrationAccessToken string, input clientUpdateDto, meta requestMeta) (clientInformationDto, error) {
+	registration, err := s.authenticateRegistration(ctx, clientID, rawRegistrationAccessToken)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	if input.ClientID != clientID {
+		return clientInformationDto{}, invalidMetadata("client_id does not match the client being updated")
+	}
+
+	metadataInput, authMethod, err := createDtoFromMetadata(input.clientMetadataDto)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+	err = s.requirePublicEndpoints(ctx, metadataInput)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	existing, err := s.clients.GetClient(ctx, clientID)
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+
+	// Settings that can't be expressed with client metadata are kept as they were configured by an admin
+	updateInput := updateDtoFromClient(existing)
+	updateInput.Name = metadataInput.Name
+	updateInput.CallbackURLs = metadataInput.CallbackURLs
+	updateInput.LogoutCallbackURLs = metadataInput.LogoutCallbackURLs
+	updateInput.IsPublic = metadataInput.IsPublic
+	updateInput.LaunchURL = metadataInput.LaunchURL
+	updateInput.PkceEnabled = existing.PkceEnabled || metadataInput.PkceEnabled
+	updateInput.RequiresDPoP = metadataInput.RequiresDPoP
+	updateInput.SubjectType = metadataInput.SubjectType
+	updateInput.SectorIdentifierURI = metadataInput.SectorIdentifierURI
+	updateInput.BackchannelLogoutURI = metadataInput.BackchannelLogoutURI
+	updateInput.BackchannelLogoutSessionRequired = metadataInput.BackchannelLogoutSessionRequired
+	updateInput.FrontchannelLogoutURI = metadataInput.FrontchannelLogoutURI
+	updateInput.BackchannelTokenDeliveryMode = metadataInput.BackchannelTokenDeliveryMode
+	updateInput.BackchannelClientNotificationURI = metadataInput.BackchannelClientNotificationURI
+
+	var (
+		client       model.OidcClient
+		clientSecret string
+	)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		client, err = s.clients.UpdateClientInternal(ctx, clientID, updateInput, tx)
+		if err != nil {
+			return err
+		}
+
+		// A client that becomes confidential needs a secret to authenticate
+		if existing.IsPublic && !client.IsPublic {
+			clientSecret, err = s.clients.CreateClientSecretInternal(ctx, client.ID, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.
+			WithContext(ctx).
+			Model(&registration).
+			Update("token_endpoint_auth_method", authMethod).
+			Error
+	})
+	if err != nil {
+		return clientInformationDto{}, err
+	}
+	registration.TokenEndpointAuthMethod = authMethod
+
+	s.createAuditLog(ctx, model.AuditLogEventClientRegistrationUpdate, client, meta)
+
+	if metadataInput.LogoURL != nil {
+		client = s.saveLogo(ctx, client, *metadataInput.LogoURL)
+	}
+
+	response := s.clientInformation(client, registration)
+	response.ClientSecret = clientSecret
+	return response, nil
+}
+
+// DeleteRegisteredClient deletes a dynamically registered client as described in RFC 7592
+func (s *Service) DeleteRegisteredClient(ctx context.Context, clientID, rawRegistrationAccessToken string, meta requestMeta) error {
+	_, err := s.authenticateRegistration(ctx, clientID, rawRegistrationAccessToken)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.clients.GetClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			WithContext(ctx).
+			Delete(&ClientRegistration{}, "client_id = ?", clientID).
+			Error
+		if err != nil {
+			return err
+		}
+
+		client, err = s.clients.DeleteClientInternal(ctx, clientID, tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Storage operations must be executed outside of a transaction
+	s.clients.DeleteClientImages(ctx, client)
+
+	s.createAuditLog(ctx, model.AuditLogEventClientRegistrationDelete, client, meta)
+	return nil
+}
+
+// consumeInitialAccessToken validates the initial access token and increments its usage count in a single statement,
+// so concurrent registrations can't exceed the usage limit
+func (s *Service) consumeInitialAccessToken(ctx context.Context, tx *gorm.DB, rawToken string) (InitialAccessToken, error) {
+	if rawToken == "" {
+		return InitialAccessToken{}, invalidToken("an initial access token is required")
+	}
+
+	hashedToken := utils.CreateSha256Hash(rawToken)
+	res := tx.
+		WithContext(ctx).
+		Model(&InitialAccessToken{}).
+		Where("token = ? AND expires_at > ? AND usage_count < usage_limit AND created_by_id IS NOT NULL", hashedToken, datatype.DateTime(time.Now())).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if res.Error != nil {
+		return InitialAccessToken{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return InitialAccessToken{}, invalidToken("the initial access token is invalid or expired")
+	}
+
+	var token InitialAccessToken
+	err := tx.
+		WithContext(ctx).
+		Where("token = ?", hashedToken).
+		First(&token).
+		Error
+	if err != nil {
+		return InitialAccessToken{}, err
+	}
+
+	return token, nil
+}
+
+func (s *Service) authenticateRegistration(ctx context.Context, clientID, rawToken string) (ClientRegistration, error) {
+	if rawToken == "" {
+		return ClientRegistration{}, invalidToken("a registration access token is required")
+	}
+
+	var registration ClientRegistration
+	err := s.db.
+		WithContext(ctx).
+		Where("client_id = ?", clientID).
+		First(&registration).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Respond the same way as for a wrong token to not leak which clients exist
+		return ClientRegistration{}, invalidToken("the registration access token is invalid")
+	} else if err != nil {
+		return ClientRegistration{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(registration.RegistrationAccessToken), []byte(utils.CreateSha256Hash(rawToken))) != 1 {
+		return ClientRegistration{}, invalidToken("the registration access token is invalid")
+	}
+
+	return registration, nil
+}
+
+func (s *Service) createAuditLog(ctx context.Context, event model.AuditLogEvent, client model.OidcClient, meta requestMeta) {
+	// The audit log is attributed to the admin who issued the initial access token used to register the client
+	if client.CreatedByID == nil || *client.CreatedByID == "" {
+		return
+	}
+
+	s.auditLog.Create(ctx, event, meta.IPAddress, meta.UserAgent, *client.CreatedByID, model.AuditLogData{
+		"clientName": client.Name,
+	}, s.db.WithContext(ctx))
+}
+
+// saveLogo downloads the logo of a registered client and returns the client with the stored logo
+func (s *Service) saveLogo(ctx context.Context, client model.OidcClient, logoURL string) model.OidcClient {
+	err := s.clients.SaveClientLogoFromURL(ctx, client.ID, logoURL, true)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to save the logo of a registered client", slog.String("client", client.ID), slog.Any("error", err))
+		return client
+	}
+
+	updated, err := s.clients.GetClient(ctx, client.ID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load a registered client", slog.String("client", client.ID), slog.Any("error", err))
+		return client
+	}
+	return updated
+}
+
+func (s *Service) clientInformation(client model.OidcClient, registration ClientRegistration) clientInformationDto {
+	grantTypes := []string{grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeDeviceCode}
+	authMethod := registration.TokenEndpointAuthMethod
+	if client.IsPublic {
+		authMethod = authMethodNone
+	} else {
+		grantTypes = append(grantTypes, grantTypeClientCredentials)
+		if client.BackchannelTokenDeliveryMode != "" {
+			grantTypes = append(grantTypes, grantTypeCIBA)
+		}
+		if authMethod == "" || authMethod == authMethodNone {
+			authMethod = authMethodClientSecretBasic
+		}
+	}
+
+	info := clientInformationDto{
+		clientMetadataDto: clientMetadataDto{
+			RedirectURIs:                     client.CallbackURLs,
+			PostLogoutRedirectURIs:           client.LogoutCallbackURLs,
+			TokenEndpointAuthMethod:          authMethod,
+			GrantTypes:                       grantTypes,
+			ResponseTypes:                    []string{responseTypeCode},
+			ClientName:                       client.Name,
+			DPoPBoundAccessTokens:            client.RequiresDPoP,
+			SubjectType:                      string(client.SubjectType),
+			BackchannelLogoutSessionRequired: client.BackchannelLogoutSessionRequired,
+		},
+		ClientID:              client.ID,
+		ClientIDIssuedAt:      client.CreatedAt.ToTime().Unix(),
+		RegistrationClientURI: s.baseURL + "/api/oidc/register/" + url.PathEscape(client.ID),
+	}
+	if client.LaunchURL != nil {
+		info.ClientURI = *client.LaunchURL
+	}
+	if client.HasLogo() {
+		// The logo is served by Pocket ID instead of the URL it was downloaded from
+		info.LogoURI = s.baseURL + "/api/oidc/clients/" + url.PathEscape(client.ID) + "/logo"
+	}
+	if client.SectorIdentifierURI != nil {
+		info.SectorIdentifierURI = *client.SectorIdentifierURI
+	}
+	if client.BackchannelLogoutURI != nil {
+		info.BackchannelLogoutURI = *client.BackchannelLogoutURI
+	}
+	if client.FrontchannelLogoutURI != nil {
+		info.FrontchannelLogoutURI = *client.FrontchannelLogoutURI
+	}
+	info.BackchannelTokenDeliveryMode = client.BackchannelTokenDeliveryMode
+	if client.BackchannelClientNotificationURI != nil {
+		info.BackchannelClientNotificationEndpoint = *client.BackchannelClientNotificationURI
+	}
+	if !client.IsPublic {
+		// Client secrets never expire
+		info.ClientSecretExpiresAt = new(int64(0))
+	}
+
+	return info
+}
+
+// requirePublicEndpoints rejects endpoints of the client that Pocket ID sends requests to if they point to a private IP
+// address, as anyone who can register a client could otherwise make Pocket ID send requests to internal services
+// The requests themselves can only connect to public addresses as well, so this only reports the problem early
+func (s *Service) requirePublicEndpoints(ctx context.Context, input dto.OidcClientCreateDto) error {
+	endpoints := []struct {
+		name string
+		uri  *string
+	}{
+		{name: "backchannel_logout_uri", uri: input.BackchannelLogoutURI},
+		{name: "backchannel_client_notification_endpoint", uri: input.BackchannelClientNotificationURI},
+	}
+
+	for _, endpoint := range endpoints {
+		if endpoint.uri == nil {
+			continue
+		}
+		u, err := url.Parse(*endpoint.uri)
+		if err != nil {
+			return invalidMetadata(fmt.Sprintf("the value of %s is invalid", endpoint.name))
+		}
+		private, err := s.isURLPrivate(ctx, u)
+		if err != nil {
+			return invalidMetadata(fmt.Sprintf("the host of %s can't be resolved", endpoint.name))
+		}
+		if private {
+			return invalidMetadata(endpoint.name + " must not point to a private IP address")
+		}
+	}
+	return nil
+}
+
+func isHTTPSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// createDtoFromMetadata validates the client metadata and maps it to the input used to create OIDC clients
+func createDtoFromMetadata(metadata clientMetadataDto) (dto.OidcClientCreateDto, string, error) {
+	authMethod := metadata.TokenEndpointAuthMethod
+	switch authMethod {
+	case "":
+		authMethod = authMethodClientSecretBasic
+	case authMethodNone, authMethodClientSecretBasic, authMethodClientSecretPost:
+	default:
+		return dto.OidcClientCreateDto{}, "", invalidMetadata(fmt.Sprintf("token_endpoint_auth_method %q is not supported", authMethod))
+	}
+	isPublic := authMethod == authMethodNone
+
+	grantTypes := metadata.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{grantTypeAuthorizationCode}
+	}
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeDeviceCode:
+		case grantTypeClientCredentials:
+			if isPublic {
+				return dto.OidcClientCreateDto{}, "", invalidMetadata("public clients can't use the client_credentials grant")
+			}
+		case grantTypeCIBA:
+			if isPublic {
+				return dto.OidcClientCreateDto{}, "", invalidMetadata("public clients can't use the CIBA grant")
+			}
+		default:
+			return dto.OidcClientCreateDto{}, "", invalidMetadata(fmt.Sprintf("grant_type %q is not supported", grantType))
+		}
+	}
+
+	// The delivery mode enables the CIBA grant, so it must be registered together with it
+	if slices.Contains(grantTypes, grantTypeCIBA) != (metadata.BackchannelTokenDeliveryMode != "") {
+		return dto.OidcClientCreateDto{}, "", invalidMetadata("backchannel_token_delivery_mode is required for the CIBA grant and can't be used without it")
+	}
+
+	for _, responseType := range metadata.ResponseTypes {
+		if responseType != responseTypeCode {
+			return dto.OidcClientCreateDto{}, "", invalidMetadata(fmt.Sprintf("response_type %q is not supported", responseType))
+		}
+	}
+
+	if slices.Contains(grantTypes, grantTypeAuthorizationCode) && len(metadata.RedirectURIs) == 0 {
+		return dto.OidcClientCreateDto{}, "", &registrationError{code: errorInvalidRedirectURI, description: "redirect_uris is required for the authorization_code grant"}
+	}
+	for _, redirectURI := range append(slices.Clone(metadata.RedirectURIs), metadata.PostLogoutRedirectURIs...) {
+		if !dto.ValidateCallbackURL(redirectURI) {
+			return dto.OidcClientCreateDto{}, "", &registrationError{code: errorInvalidRedirectURI, description: fmt.Sprintf("%q is not a valid redirect URI", redirectURI)}
+		}
+	}
+
+	name := metadata.ClientName
+	if name == "" {
+		name = defaultClientName
+	}
+
+	input := dto.OidcClientCreateDto{
+		OidcClientUpdateDto: dto.OidcClientUpdateDto{
+			Name:                             name,
+			CallbackURLs:                     metadata.RedirectURIs,
+			LogoutCallbackURLs:               metadata.PostLogoutRedirectURIs,
+			IsPublic:                         isPublic,
+			PkceEnabled:                      isPublic,
+			RequiresDPoP:                     metadata.DPoPBoundAccessTokens,
+			SubjectType:                      metadata.SubjectType,
+			BackchannelLogoutSessionRequired: metadata.BackchannelLogoutSessionRequired,
+			BackchannelTokenDeliveryMode:     metadata.BackchannelTokenDeliveryMode,
+		},
+	}
+	if metadata.ClientURI != "" {
+		input.LaunchURL = &metadata.ClientURI
+	}
+	if metadata.LogoURI != "" {
+		logoURI, err := url.Parse(metadata.LogoURI)
+		if err != nil || (logoURI.Scheme != "https" && logoURI.Scheme != "http") || logoURI.Host == "" {
+			return dto.OidcClientCreateDto{}, "", invalidMetadata("logo_uri must be an http or https URL")
+		}
+		input.LogoURL = &metadata.LogoURI
+	}
+	if metadata.SectorIdentifierURI != "" {
+		input.SectorIdentifierURI = &metadata.SectorIdentifierURI
+	}
+	if metadata.BackchannelLogoutURI != "" {
+		if !isHTTPSURL(metadata.BackchannelLogoutURI) {
+			return dto.OidcClientCreateDto{}, "", invalidMetadata("backchannel_logout_uri must be an https URL")
+		}
+		input.BackchannelLogoutURI = &metadata.BackchannelLogoutURI
+	}
+	if metadata.FrontchannelLogoutURI != "" {
+		input.FrontchannelLogoutURI = &metadata.FrontchannelLogoutURI
+	}
+	if metadata.BackchannelClientNotificationEndpoint != "" {
+		if !isHTTPSURL(metadata.BackchannelClientNotificationEndpoint) {
+			return dto.OidcClientCreateDto{}, "", invalidMetadata("backchannel_client_notification_endpoint must be an https URL")
+		}
+		input.BackchannelClientNotificationURI = &metadata.BackchannelClientNotificationEndpoint
+	}
+
+	// Run the same validations as for clients created by an admin
+	var validationErrors validator.ValidationErrors
+	err := binding.Validator.ValidateStruct(&input)
+	if errors.As(err, &validationErrors) {
+		field := validationErrors[0].Field()
+		if field == "CallbackURLs" || field == "LogoutCallbackURLs" {
+			return dto.OidcClientCreateDto{}, "", &registrationError{code: errorInvalidRedirectURI, description: "one of the redirect URIs is invalid"}
+		}
+		return dto.OidcClientCreateDto{}, "", invalidMetadata(fmt.Sprintf("the value of %s is invalid", field))
+	} else if err != nil {
+		return dto.OidcClientCreateDto{}, "", invalidMetadata(err.Error())
+	}
+
+	return input, authMethod, nil
+}
+
+func updateDtoFromClient(client model.OidcClient) dto.OidcClientUpdateDto {
+	input := dto.OidcClientUpdateDto{
+		Name:                                client.Name,
+		CallbackURLs:                        client.CallbackURLs,
+		LogoutCallbackURLs:                  client.LogoutCallbackURLs,
+		IsPublic:                            client.IsPublic,
+		PkceEnabled:                         client.PkceEnabled,
+		RequiresReauthentication:            client.RequiresReauthentication,
+		RequiresPushedAuthorizationRequests: client.RequiresPushedAuthorizationRequests,
+		RequiresSignedRequestObject:         client.RequiresSignedRequestObject,
+		RequiresDPoP:                        client.RequiresDPoP,
+		SkipConsent:                         client.SkipConsent,
+		LaunchURL:                           client.LaunchURL,
+		IsGroupRestricted:                   client.IsGroupRestricted,
+		SubjectType:                         string(client.SubjectType),
+		DefaultResponseMode:                 client.DefaultResponseMode,
+		IDTokenEncryptedResponseAlg:         client.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedResponseEnc:         client.IDTokenEncryptedResponseEnc,
+		UserinfoSignedResponseAlg:           client.UserinfoSignedResponseAlg,
+		UserinfoEncryptedResponseAlg:        client.UserinfoEncryptedResponseAlg,
+		UserinfoEncryptedResponseEnc:        client.UserinfoEncryptedResponseEnc,
+		SectorIdentifierURI:                 client.SectorIdentifierURI,
+		BackchannelLogoutURI:                client.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:    client.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:               client.FrontchannelLogoutURI,
+		BackchannelTokenDeliveryMode:        client.BackchannelTokenDeliveryMode,
+		BackchannelClientNotificationURI:    client.BackchannelClientNotificationURI,
+	}
+	input.Credentials.JWKS = client.Credentials.JWKS
+	input.Credentials.JWKSURI = client.Credentials.JWKSURI
+	input.Credentials.TLSClientAuthMethod = client.Credentials.TLSClientAuthMethod
+	input.Credentials.TLSClientAuthSubjectDN = client.Credentials.TLSClientAuthSubjectDN
+	input.Credentials.TLSClientAuthSANDNS = client.Credentials.TLSClientAuthSANDNS
+	input.Credentials.TLSClientAuthSANURI = client.Credentials.TLSClientAuthSANURI
+	input.Credentials.TLSClientAuthSANIP = client.Credentials.TLSClientAuthSANIP
+	input.Credentials.TLSClientAuthSANEmail = client.Credentials.TLSClientAuthSANEmail
+
+	input.Credentials.FederatedIdentities = make([]dto.OidcClientFederatedIdentityDto, len(client.Credentials.FederatedIdentities))
+	for i, fi := range client.Credentials.FederatedIdentities {
+		input.Credentials.FederatedIdentities[i] = dto.OidcClientFederatedIdentityDto{
+			Issuer:           fi.Issuer,
+			Subject:          fi.Subject,
+			Audience:         fi.Audience,
+			JWKS:             fi.JWKS,
+			ReplayProtection: fi.ReplayProtection,
+		}
+	}
+
+	// Token lifetimes can't be set through dynamic client registration, so the ones set by an admin are kept
+	input.TokenLifetimes = dto.OidcClientTokenLifetimesDto{
+		AccessToken:             client.TokenLifetimes.AccessToken,
+		IDToken:                 client.TokenLifetimes.IDToken,
+		AuthorizationCode:       client.TokenLifetimes.AuthorizationCode,
+		RefreshToken:            client.TokenLifetimes.RefreshToken,
+		RefreshTokenExpiry:      string(client.TokenLifetimes.RefreshTokenExpiry),
+		RefreshTokenIdleTimeout: client.TokenLifetimes.RefreshTokenIdleTimeout,
+	}
+
+	input.TokenExchange = dto.OidcClientTokenExchangeDto{
+		SubjectTokenTypes:  client.TokenExchange.SubjectTokenTypes,
+		SubjectClientIDs:   client.TokenExchange.SubjectClientIDs,
+		TrustedIssuers:     make([]dto.OidcClientTokenExchangeIssuerDto, len(client.TokenExchange.TrustedIssuers)),
+		AllowedAudiences:   client.TokenExchange.AllowedAudiences,
+		AllowedScopes:      client.TokenExchange.AllowedScopes,
+		AllowDelegation:    client.TokenExchange.AllowDelegation,
+		AllowImpersonation: client.TokenExchange.AllowImpersonation,
+	}
+	for i, ti := range client.TokenExchange.TrustedIssuers {
+		input.TokenExchange.TrustedIssuers[i] = dto.OidcClientTokenExchangeIssuerDto{
+			Issuer:    ti.Issuer,
+			JWKS:      ti.JWKS,
+			Audience:  ti.Audience,
+			UserClaim: ti.UserClaim,
+		}
+	}
+
+	return input
+}
@@ -0,0 +1,523 @@
+package clientregistration
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+// fakeClientManager stores OIDC clients directly in the database, without the logo and secret handling of the OIDC service
+type fakeClientManager struct {
+	db *gorm.DB
+	// secretErr is returned when a client secret is created
+	secretErr error
+	// deleteErr is returned when a client is deleted
+	deleteErr error
+	// logos are the URLs logos were downloaded from, by client ID
+	logos map[string]string
+}
+
+func (m *fakeClientManager) GetClient(ctx context.Context, clientID string) (model.OidcClient, error) {
+	var client model.OidcClient
+	err := m.db.WithContext(ctx).First(&client, "id = ?", clientID).Error
+	return client, err
+}
+
+func (m *fakeClientManager) CreateClientInternal(ctx context.Context, input dto.OidcClientCreateDto, userID string, tx *gorm.DB) (model.OidcClient, error) {
+	client := model.OidcClient{
+		Base:               model.Base{ID: input.ID},
+		Name:               input.Name,
+		CallbackURLs:       input.CallbackURLs,
+		LogoutCallbackURLs: input.LogoutCallbackURLs,
+		IsPublic:           input.IsPublic,
+		PkceEnabled:        input.PkceEnabled,
+		RequiresDPoP:       input.RequiresDPoP,
+		LaunchURL:          input.LaunchURL,
+		CreatedByID:        &userID,
+	}
+	err := tx.WithContext(ctx).Create(&client).Error
+	return client, err
+}
+
+func (m *fakeClientManager) UpdateClientInternal(ctx context.Context, clientID string, input dto.OidcClientUpdateDto, tx *gorm.DB) (model.OidcClient, error) {
+	var client model.OidcClient
+	err := tx.WithContext(ctx).First(&client, "id = ?", clientID).Error
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+	client.Name = input.Name
+	client.CallbackURLs = input.CallbackURLs
+	client.LogoutCallbackURLs = input.LogoutCallbackURLs
+	client.IsPublic = input.IsPublic
+	client.SkipConsent = input.SkipConsent
+	client.RequiresDPoP = input.RequiresDPoP
+	client.Credentials.JWKS = input.Credentials.JWKS
+	client.Credentials.JWKSURI = input.Credentials.JWKSURI
+	client.TokenExchange.SubjectTokenTypes = input.TokenExchange.SubjectTokenTypes
+	client.TokenExchange.AllowImpersonation = input.TokenExchange.AllowImpersonation
+	err = tx.WithContext(ctx).Save(&client).Error
+	return client, err
+}
+
+func (m *fakeClientManager) DeleteClientInternal(ctx context.Context, clientID string, tx *gorm.DB) (model.OidcClient, error) {
+	if m.deleteErr != nil {
+		return model.OidcClient{}, m.deleteErr
+	}
+	var client model.OidcClient
+	err := tx.WithContext(ctx).First(&client, "id = ?", clientID).Error
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+	return client, tx.WithContext(ctx).Delete(&client).Error
+}
+
+func (m *fakeClientManager) DeleteClientImages(_ context.Context, client model.OidcClient) {
+	delete(m.logos, client.ID)
+}
+
+func (m *fakeClientManager) CreateClientSecretInternal(_ context.Context, _ string, _ *gorm.DB) (string, error) {
+	if m.secretErr != nil {
+		return "", m.secretErr
+	}
+	return "generated-secret", nil
+}
+
+func (m *fakeClientManager) SaveClientLogoFromURL(ctx context.Context, clientID string, logoURL string, _ bool) error {
+	if m.logos == nil {
+		m.logos = map[string]string{}
+	}
+	m.logos[clientID] = logoURL
+	return m.db.WithContext(ctx).Model(&model.OidcClient{}).Where("id = ?", clientID).Update("image_type", "png").Error
+}
+
+type fakeAuditLogger struct {
+	events []model.AuditLogEvent
+}
+
+func (f *fakeAuditLogger) Create(_ context.Context, event model.AuditLogEvent, _, _, _ string, _ model.AuditLogData, _ *gorm.DB) (model.AuditLog, bool) {
+	f.events = append(f.events, event)
+	return model.AuditLog{}, true
+}
+
+func newTestService(t *testing.T) (*Service, *fakeAuditLogger, model.User) {
+	t.Helper()
+
+	db := testutils.NewDatabaseForTest(t)
+	admin := model.User{Username: "admin", IsAdmin: true}
+	require.NoError(t, db.Create(&admin).Error)
+
+	auditLog := &fakeAuditLogger{}
+	service := newService(Dependencies{
+		DB:       db,
+		BaseURL:  "https://id.example.com",
+		Clients:  &fakeClientManager{db: db},
+		AuditLog: auditLog,
+	})
+	service.isURLPrivate = func(_ context.Context, u *url.URL) (bool, error) {
+		return u.Hostname() == "private.example.com", nil
+	}
+	return service, auditLog, admin
+}
+
+func requireRegistrationError(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var regErr *registrationError
+	require.True(t, errors.As(err, &regErr), "expected a registration error, got %v", err)
+	assert.Equal(t, code, regErr.code)
+}
+
+func TestRegisterClient(t *testing.T) {
+	service, auditLog, admin := newTestService(t)
+	ctx := t.Context()
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Preview environments",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 1,
+	})
+	require.NoError(t, err)
+
+	metadata := clientMetadataDto{
+		RedirectURIs: []string{"https://preview.example.com/callback"},
+		ClientName:   "Preview",
+	}
+
+	t.Run("rejects a missing initial access token", func(t *testing.T) {
+		_, err := service.RegisterClient(ctx, "", metadata, requestMeta{})
+		requireRegistrationError(t, err, errorInvalidToken)
+	})
+
+	t.Run("registers a confidential client", func(t *testing.T) {
+		info, err := service.RegisterClient(ctx, initialAccessToken, metadata, requestMeta{})
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, info.ClientID)
+		assert.Equal(t, "generated-secret", info.ClientSecret)
+		assert.Equal(t, authMethodClientSecretBasic, info.TokenEndpointAuthMethod)
+		assert.NotEmpty(t, info.RegistrationAccessToken)
+		assert.Equal(t, "https://id.example.com/api/oidc/register/"+info.ClientID, info.RegistrationClientURI)
+		assert.Equal(t, []model.AuditLogEvent{model.AuditLogEventClientRegistration}, auditLog.events)
+
+		client, err := service.clients.GetClient(ctx, info.ClientID)
+		require.NoError(t, err)
+		require.NotNil(t, client.CreatedByID)
+		assert.Equal(t, admin.ID, *client.CreatedByID)
+	})
+
+	t.Run("enforces the usage limit of the initial access token", func(t *testing.T) {
+		_, err := service.RegisterClient(ctx, initialAccessToken, metadata, requestMeta{})
+		requireRegistrationError(t, err, errorInvalidToken)
+	})
+}
+
+func TestRegisterClientRollback(t *testing.T) {
+	service, _, admin := newTestService(t)
+	ctx := t.Context()
+	clients := service.clients.(*fakeClientManager)
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Single use",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 1,
+	})
+	require.NoError(t, err)
+
+	metadata := clientMetadataDto{
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		ClientName:   "App",
+	}
+
+	clients.secretErr = errors.New("secret generation failed")
+	_, err = service.RegisterClient(ctx, initialAccessToken, metadata, requestMeta{})
+	require.ErrorIs(t, err, clients.secretErr)
+
+	// Neither the client nor the use of the initial access token may be stored
+	var clientCount int64
+	require.NoError(t, service.db.Model(&model.OidcClient{}).Count(&clientCount).Error)
+	assert.Zero(t, clientCount)
+
+	var token InitialAccessToken
+	require.NoError(t, service.db.First(&token, "token = ?", utils.CreateSha256Hash(initialAccessToken)).Error)
+	assert.Zero(t, token.UsageCount)
+
+	clients.secretErr = nil
+	info, err := service.RegisterClient(ctx, initialAccessToken, metadata, requestMeta{})
+	require.NoError(t, err)
+	assert.Equal(t, "generated-secret", info.ClientSecret)
+}
+
+func TestManageRegisteredClientRollback(t *testing.T) {
+	service, _, admin := newTestService(t)
+	ctx := t.Context()
+	clients := service.clients.(*fakeClientManager)
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Single use",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 1,
+	})
+	require.NoError(t, err)
+
+	info, err := service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+		RedirectURIs:            []string{"https://app.example.com/callback"},
+		TokenEndpointAuthMethod: authMethodNone,
+		ClientName:              "App",
+	}, requestMeta{})
+	require.NoError(t, err)
+
+	t.Run("an update that fails changes nothing", func(t *testing.T) {
+		clients.secretErr = errors.New("secret generation failed")
+		t.Cleanup(func() { clients.secretErr = nil })
+
+		_, err := service.UpdateRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, clientUpdateDto{
+			ClientID: info.ClientID,
+			clientMetadataDto: clientMetadataDto{
+				RedirectURIs:            []string{"https://app.example.com/callback"},
+				TokenEndpointAuthMethod: authMethodClientSecretBasic,
+				ClientName:              "Renamed",
+			},
+		}, requestMeta{})
+		require.ErrorIs(t, err, clients.secretErr)
+
+		read, err := service.GetRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, "App", read.ClientName)
+		assert.Equal(t, authMethodNone, read.TokenEndpointAuthMethod)
+	})
+
+	t.Run("a deletion that fails keeps the registration", func(t *testing.T) {
+		clients.deleteErr = errors.New("deletion failed")
+		t.Cleanup(func() { clients.deleteErr = nil })
+
+		err := service.DeleteRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, requestMeta{})
+		require.ErrorIs(t, err, clients.deleteErr)
+
+		_, err = service.GetRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken)
+		require.NoError(t, err)
+	})
+}
+
+func TestRegisterClientLogo(t *testing.T) {
+	service, _, admin := newTestService(t)
+	ctx := t.Context()
+	clients := service.clients.(*fakeClientManager)
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Logos",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 2,
+	})
+	require.NoError(t, err)
+
+	t.Run("rejects an invalid logo URI", func(t *testing.T) {
+		_, err := service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+			RedirectURIs: []string{"https://app.example.com/callback"},
+			LogoURI:      "javascript:alert(1)",
+		}, requestMeta{})
+		requireRegistrationError(t, err, errorInvalidClientMetadata)
+	})
+
+	t.Run("stores the logo", func(t *testing.T) {
+		info, err := service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+			RedirectURIs: []string{"https://app.example.com/callback"},
+			LogoURI:      "https://app.example.com/logo.png",
+		}, requestMeta{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://app.example.com/logo.png", clients.logos[info.ClientID])
+		assert.Equal(t, "https://id.example.com/api/oidc/clients/"+info.ClientID+"/logo", info.LogoURI)
+
+		info, err = service.GetRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, "https://id.example.com/api/oidc/clients/"+info.ClientID+"/logo", info.LogoURI)
+	})
+}
+
+func TestRegisterClientPrivateEndpoints(t *testing.T) {
+	service, _, admin := newTestService(t)
+	ctx := t.Context()
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Endpoints",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 1,
+	})
+	require.NoError(t, err)
+
+	_, err = service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+		RedirectURIs:         []string{"https://app.example.com/callback"},
+		BackchannelLogoutURI: "https://private.example.com/logout",
+	}, requestMeta{})
+	requireRegistrationError(t, err, errorInvalidClientMetadata)
+
+	info, err := service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+		RedirectURIs:         []string{"https://app.example.com/callback"},
+		BackchannelLogoutURI: "https://app.example.com/logout",
+	}, requestMeta{})
+	require.NoError(t, err, "the rejected registration must not use up the initial access token")
+
+	update := clientUpdateDto{ClientID: info.ClientID}
+	update.RedirectURIs = []string{"https://app.example.com/callback"}
+	update.BackchannelLogoutURI = "https://private.example.com/logout"
+	_, err = service.UpdateRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, update, requestMeta{})
+	requireRegistrationError(t, err, errorInvalidClientMetadata)
+
+	update = clientUpdateDto{ClientID: info.ClientID}
+	update.GrantTypes = []string{grantTypeCIBA}
+	update.BackchannelTokenDeliveryMode = "ping"
+	update.BackchannelClientNotificationEndpoint = "https://private.example.com/ciba"
+	_, err = service.UpdateRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, update, requestMeta{})
+	requireRegistrationError(t, err, errorInvalidClientMetadata)
+}
+
+func TestManageRegisteredClient(t *testing.T) {
+	service, auditLog, admin := newTestService(t)
+	ctx := t.Context()
+
+	_, initialAccessToken, err := service.CreateInitialAccessToken(ctx, admin.ID, initialAccessTokenCreateDto{
+		Name:       "Preview environments",
+		TTL:        utils.JSONDuration{Duration: time.Hour},
+		UsageLimit: 5,
+	})
+	require.NoError(t, err)
+
+	info, err := service.RegisterClient(ctx, initialAccessToken, clientMetadataDto{
+		RedirectURIs:            []string{"https://preview.example.com/callback"},
+		TokenEndpointAuthMethod: authMethodNone,
+		DPoPBoundAccessTokens:   true,
+	}, requestMeta{})
+	require.NoError(t, err)
+	assert.Empty(t, info.ClientSecret)
+	assert.Equal(t, defaultClientName, info.ClientName)
+	assert.True(t, info.DPoPBoundAccessTokens)
+
+	// Admin-only settings that must survive updates through the registration endpoint
+	require.NoError(t, service.db.Model(&model.OidcClient{}).Where("id = ?", info.ClientID).Updates(map[string]any{
+		"skip_consent": true,
+		"credentials":  model.OidcClientCredentials{JWKSURI: "https://preview.example.com/jwks.json"},
+		"token_exchange": model.OidcClientTokenExchangePolicy{
+			SubjectTokenTypes:  []string{"urn:ietf:params:oauth:token-type:access_token"},
+			AllowImpersonation: true,
+		},
+	}).Error)
+
+	t.Run("rejects a wrong registration access token", func(t *testing.T) {
+		_, err := service.GetRegisteredClient(ctx, info.ClientID, initialAccessToken)
+		requireRegistrationError(t, err, errorInvalidToken)
+	})
+
+	t.Run("reads the client", func(t *testing.T) {
+		read, err := service.GetRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, authMethodNone, read.TokenEndpointAuthMethod)
+		assert.Equal(t, []string{"https://preview.example.com/callback"}, read.RedirectURIs)
+		assert.Empty(t, read.RegistrationAccessToken)
+	})
+
+	t.Run("updates the client", func(t *testing.T) {
+		updated, err := service.UpdateRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, clientUpdateDto{
+			ClientID: info.ClientID,
+			clientMetadataDto: clientMetadataDto{
+				RedirectURIs:            []string{"https://preview-2.example.com/callback"},
+				TokenEndpointAuthMethod: authMethodClientSecretPost,
+				ClientName:              "Renamed",
+			},
+		}, requestMeta{})
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", updated.ClientName)
+		assert.Equal(t, authMethodClientSecretPost, updated.TokenEndpointAuthMethod)
+		// The client became confidential, so it gets a secret
+		assert.Equal(t, "generated-secret", updated.ClientSecret)
+		assert.False(t, updated.DPoPBoundAccessTokens)
+
+		client, err := service.clients.GetClient(ctx, info.ClientID)
+		require.NoError(t, err)
+		assert.True(t, client.SkipConsent)
+		assert.Equal(t, "https://preview.example.com/jwks.json", client.Credentials.JWKSURI)
+		assert.True(t, client.TokenExchange.Enabled())
+	})
+
+	t.Run("rejects an update for a different client ID", func(t *testing.T) {
+		_, err := service.UpdateRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, clientUpdateDto{
+			ClientID:          "other",
+			clientMetadataDto: clientMetadataDto{RedirectURIs: []string{"https://preview.example.com/callback"}},
+		}, requestMeta{})
+		requireRegistrationError(t, err, errorInvalidClientMetadata)
+	})
+
+	t.Run("deletes the client", func(t *testing.T) {
+		require.NoError(t, service.DeleteRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken, requestMeta{}))
+
+		_, err := service.GetRegisteredClient(ctx, info.ClientID, info.RegistrationAccessToken)
+		requireRegistrationError(t, err, errorInvalidToken)
+	})
+
+	assert.Equal(t, []model.AuditLogEvent{
+		model.AuditLogEventClientRegistration,
+		model.AuditLogEventClientRegistrationUpdate,
+		model.AuditLogEventClientRegistrationDelete,
+	}, auditLog.events)
+}
+
+func TestCreateDtoFromMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata clientMetadataDto
+		wantErr  string
+	}{
+		{
+			name:     "missing redirect URIs",
+			metadata: clientMetadataDto{},
+			wantErr:  errorInvalidRedirectURI,
+		},
+		{
+			name:     "javascript redirect URI",
+			metadata: clientMetadataDto{RedirectURIs: []string{"javascript:alert(1)"}},
+			wantErr:  errorInvalidRedirectURI,
+		},
+		{
+			name:     "unsupported auth method",
+			metadata: clientMetadataDto{RedirectURIs: []string{"https://a.example.com"}, TokenEndpointAuthMethod: "private_key_jwt"},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "public client with client credentials",
+			metadata: clientMetadataDto{TokenEndpointAuthMethod: authMethodNone, GrantTypes: []string{grantTypeClientCredentials}},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "unsupported response type",
+			metadata: clientMetadataDto{RedirectURIs: []string{"https://a.example.com"}, ResponseTypes: []string{"token"}},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "client credentials without redirect URIs",
+			metadata: clientMetadataDto{GrantTypes: []string{grantTypeClientCredentials}},
+		},
+		{
+			name:     "CIBA without a delivery mode",
+			metadata: clientMetadataDto{GrantTypes: []string{grantTypeCIBA}},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "delivery mode without the CIBA grant",
+			metadata: clientMetadataDto{GrantTypes: []string{grantTypeClientCredentials}, BackchannelTokenDeliveryMode: "poll"},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "public client with CIBA",
+			metadata: clientMetadataDto{TokenEndpointAuthMethod: authMethodNone, GrantTypes: []string{grantTypeCIBA}, BackchannelTokenDeliveryMode: "poll"},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "unsupported delivery mode",
+			metadata: clientMetadataDto{GrantTypes: []string{grantTypeCIBA}, BackchannelTokenDeliveryMode: "push"},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name:     "http backchannel logout URI",
+			metadata: clientMetadataDto{RedirectURIs: []string{"https://a.example.com"}, BackchannelLogoutURI: "http://a.example.com/logout"},
+			wantErr:  errorInvalidClientMetadata,
+		},
+		{
+			name: "http notification endpoint",
+			metadata: clientMetadataDto{
+				GrantTypes:                            []string{grantTypeCIBA},
+				BackchannelTokenDeliveryMode:          "ping",
+				BackchannelClientNotificationEndpoint: "http://client.example.com/ciba",
+			},
+			wantErr: errorInvalidClientMetadata,
+		},
+		{
+			name: "CIBA in ping mode",
+			metadata: clientMetadataDto{
+				GrantTypes:                            []string{grantTypeCIBA},
+				BackchannelTokenDeliveryMode:          "ping",
+				BackchannelClientNotificationEndpoint: "https://client.example.com/ciba",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := createDtoFromMetadata(tt.metadata)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			requireRegistrationError(t, err, tt.wantErr)
+		})
+	}
+}
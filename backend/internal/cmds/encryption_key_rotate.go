@@ -126,11 +126,11 @@ func rotateSigningKeyEncryption(ctx context.Context, db *gorm.DB, oldKek []byte,
 		return fmt.Errorf("failed to init key provider with old encryption key: %w", err)
 	}
 
-	key, err := oldProvider.LoadKey(ctx)
+	keySet, err := oldProvider.LoadKeySet(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load signing key using old encryption key: %w", err)
+		return fmt.Errorf("failed to load signing keys using old encryption key: %w", err)
 	}
-	if key == nil {
+	if keySet == nil {
 		return nil
 	}
 
@@ -143,8 +143,8 @@ func rotateSigningKeyEncryption(ctx context.Context, db *gorm.DB, oldKek []byte,
 		return fmt.Errorf("failed to init key provider with new encryption key: %w", err)
 	}
 
-	if err := newProvider.SaveKey(ctx, key); err != nil {
-		return fmt.Errorf("failed to store signing key with new encryption key: %w", err)
+	if err := newProvider.SaveKeySet(ctx, keySet); err != nil {
+		return fmt.Errorf("failed to store signing keys with new encryption key: %w", err)
 	}
 
 	return nil
@@ -40,7 +40,7 @@ func TestEncryptionKeyRotate(t *testing.T) {
 
 	signingKey, err := jwkutils.GenerateKey("RS256", "")
 	require.NoError(t, err)
-	require.NoError(t, oldProvider.SaveKey(t.Context(), signingKey))
+	require.NoError(t, oldProvider.SaveKeySet(t.Context(), jwkutils.NewKeySet(signingKey, time.Now())))
 
 	oldEncKey, err := datatype.DeriveEncryptedStringKey(oldKey)
 	require.NoError(t, err)
@@ -72,9 +72,10 @@ func TestEncryptionKeyRotate(t *testing.T) {
 		Kek: newKek,
 	}))
 
-	rotatedKey, err := newProvider.LoadKey(t.Context())
+	rotatedKeySet, err := newProvider.LoadKeySet(t.Context())
 	require.NoError(t, err)
-	require.NotNil(t, rotatedKey)
+	require.NotNil(t, rotatedKeySet)
+	assert.Len(t, rotatedKeySet.Keys, 1)
 
 	var storedToken string
 	err = db.Model(&model.ScimServiceProvider{}).Where("id = ?", "scim-1").Pluck("token", &storedToken).Error
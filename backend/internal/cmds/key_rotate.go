@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/spf13/cobra"
@@ -21,6 +22,7 @@ import (
 type keyRotateFlags struct {
 	Alg string
 	Crv string
+	Now bool
 	Yes bool
 }
 
@@ -29,7 +31,12 @@ func init() {
 
 	keyRotateCmd := &cobra.Command{
 		Use:   "key-rotate",
-		Short: "Generates a new token signing key and replaces the current one",
+		Short: "Generates a new token signing key that replaces the current one",
+		Long: `Generates a new token signing key that replaces the current one.
+
+By default, the new key is published in the JWKS right away, and Pocket ID starts signing tokens with it once client applications had the time to fetch it.
+With --now, the new key is used to sign tokens right away.
+In both cases, the current key remains published until the tokens signed with it have expired.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			db, err := bootstrap.NewDatabase()
 			if err != nil {
@@ -40,8 +47,9 @@ func init() {
 		},
 	}
 
-	keyRotateCmd.Flags().StringVarP(&flags.Alg, "alg", "a", "RS256", "Key algorithm. Supported values: RS256, RS384, RS512, ES256, ES384, ES512, EdDSA")
+	keyRotateCmd.Flags().StringVarP(&flags.Alg, "alg", "a", "RS256", "Key algorithm. Supported values: RS256, RS384, RS512, ES256, ES384, ES512, EdDSA (SAML can't sign with EdDSA keys)")
 	keyRotateCmd.Flags().StringVarP(&flags.Crv, "crv", "c", "", "Curve name when using EdDSA keys. Supported values: Ed25519")
+	keyRotateCmd.Flags().BoolVar(&flags.Now, "now", false, "Start signing tokens with the new key right away")
 	keyRotateCmd.Flags().BoolVarP(&flags.Yes, "yes", "y", false, "Do not prompt for confirmation")
 
 	rootCmd.AddCommand(keyRotateCmd)
@@ -71,8 +79,8 @@ func keyRotate(ctx context.Context, flags keyRotateFlags, db *gorm.DB, envConfig
 		return errors.New("unsupported key algorithm; supported values: RS256, RS384, RS512, ES256, ES384, ES512, EdDSA")
 	}
 
-	if !flags.Yes {
-		fmt.Println("WARNING: Rotating the private key will invalidate all existing tokens. Both pocket-id and all client applications will likely need to be restarted.")
+	if !flags.Yes && flags.Now {
+		fmt.Println("WARNING: Client applications that cached the current JWKS will reject the tokens signed with the new key until they fetch the JWKS again.")
 		ok, err := utils.PromptForConfirmation("Confirm")
 		if err != nil {
 			return err
@@ -101,14 +109,38 @@ func keyRotate(ctx context.Context, flags keyRotateFlags, db *gorm.DB, envConfig
 		return fmt.Errorf("failed to generate key: %w", err)
 	}
 
-	// Save the key
-	err = keyProvider.SaveKey(ctx, key)
+	keySet, err := keyProvider.LoadKeySet(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load key set: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case keySet == nil:
+		// There's no key to replace, so the new key is the active one
+		keySet = jwkutils.NewKeySet(key, now)
+	case flags.Now:
+		keySet.Stage(key, now)
+		err = keySet.Promote(now, service.SigningKeyRetention(appConfigService))
+		if err != nil {
+			return fmt.Errorf("failed to activate new key: %w", err)
+		}
+	default:
+		keySet.Stage(key, now)
+	}
+
+	// Save the key set
+	err = keyProvider.SaveKeySet(ctx, keySet)
 	if err != nil {
 		return fmt.Errorf("failed to store new key: %w", err)
 	}
 
 	fmt.Println("Key rotated successfully")
-	fmt.Println("Note: if pocket-id is running, you will need to restart it for the new key to be loaded")
+	if flags.Now {
+		fmt.Println("Note: if pocket-id is running, it loads the new key within an hour; restart it to use the new key right away")
+	} else {
+		fmt.Println("Note: pocket-id publishes the new key within an hour, and it starts signing tokens with it once client applications had the time to fetch it")
+	}
 
 	return nil
 }
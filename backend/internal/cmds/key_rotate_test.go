@@ -2,9 +2,11 @@ package cmds
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
 	"github.com/pocket-id/pocket-id/backend/internal/service"
@@ -104,9 +106,10 @@ func testKeyRotateWithDatabaseStorage(t *testing.T, flags keyRotateFlags, wantEr
 	require.NoError(t, err)
 
 	// Verify key was created
-	key, err := keyProvider.LoadKey(t.Context())
+	keySet, err := keyProvider.LoadKeySet(t.Context())
 	require.NoError(t, err)
-	require.NotNil(t, key)
+	require.NotNil(t, keySet)
+	key := keySet.Active().Key
 
 	// Verify the algorithm matches what we requested
 	alg, _ := key.Algorithm()
@@ -122,6 +125,65 @@ func testKeyRotateWithDatabaseStorage(t *testing.T, flags keyRotateFlags, wantEr
 	}
 }
 
+func TestKeyRotateExistingKey(t *testing.T) {
+	envConfig := &common.EnvConfigSchema{
+		EncryptionKey: []byte("test-encryption-key-characters-long"),
+	}
+
+	setup := func(t *testing.T) (*gorm.DB, jwkutils.KeyProvider, string) {
+		t.Helper()
+
+		db := testingutils.NewDatabaseForTest(t)
+		appConfigService, err := service.NewAppConfigService(t.Context(), db)
+		require.NoError(t, err)
+
+		keyProvider, err := jwkutils.GetKeyProvider(db, envConfig, appConfigService.GetDbConfig().InstanceID.Value)
+		require.NoError(t, err)
+
+		key, err := jwkutils.GenerateKey("RS256", "")
+		require.NoError(t, err)
+		require.NoError(t, keyProvider.SaveKeySet(t.Context(), jwkutils.NewKeySet(key, time.Now())))
+
+		kid, _ := key.KeyID()
+		return db, keyProvider, kid
+	}
+
+	t.Run("stages the new key", func(t *testing.T) {
+		db, keyProvider, oldKeyID := setup(t)
+
+		err := keyRotate(t.Context(), keyRotateFlags{Alg: "ES256", Yes: true}, db, envConfig)
+		require.NoError(t, err)
+
+		keySet, err := keyProvider.LoadKeySet(t.Context())
+		require.NoError(t, err)
+		require.Len(t, keySet.Keys, 2)
+		assert.Equal(t, oldKeyID, keySet.Active().KeyID(), "Current key should still be active")
+
+		next := keySet.Next()
+		require.NotNil(t, next)
+		alg, _ := next.Key.Algorithm()
+		assert.Equal(t, "ES256", alg.String())
+	})
+
+	t.Run("activates the new key with --now", func(t *testing.T) {
+		db, keyProvider, oldKeyID := setup(t)
+
+		err := keyRotate(t.Context(), keyRotateFlags{Alg: "ES256", Now: true, Yes: true}, db, envConfig)
+		require.NoError(t, err)
+
+		keySet, err := keyProvider.LoadKeySet(t.Context())
+		require.NoError(t, err)
+		require.Len(t, keySet.Keys, 2)
+		assert.NotEqual(t, oldKeyID, keySet.Active().KeyID(), "New key should be active")
+		assert.Nil(t, keySet.Next())
+
+		retired := keySet.Keys[0]
+		assert.Equal(t, oldKeyID, retired.KeyID())
+		assert.Equal(t, jwkutils.KeyStateRetired, retired.State)
+		assert.NotNil(t, retired.ExpiresAt, "Retired key should expire")
+	})
+}
+
 func TestKeyRotateMultipleAlgorithms(t *testing.T) {
 	algorithms := []struct {
 		alg string
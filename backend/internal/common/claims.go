@@ -6,3 +6,7 @@ const AuthenticationMethodsClaim = "amr"
 
 // TokenTypeClaim is the JWT claim ("type") used to identify the type of token.
 const TokenTypeClaim = "type"
+
+// StandardScopes are the scopes every OIDC client can request.
+// Admin-defined scopes can't use these names.
+var StandardScopes = []string{"openid", "profile", "email", "groups", "offline_access"}
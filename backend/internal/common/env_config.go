@@ -12,6 +12,7 @@ import (
 
 	"github.com/caarlos0/env/v11"
 	sloggin "github.com/gin-contrib/slog"
+	"github.com/go-ldap/ldap/v3"
 	_ "github.com/joho/godotenv/autoload"
 )
 
@@ -46,6 +47,7 @@ type EnvConfigSchema struct {
 	TrustProxy            bool   `env:"TRUST_PROXY"`
 	TrustedPlatform       string `env:"TRUSTED_PLATFORM"`
 	AuditLogRetentionDays int    `env:"AUDIT_LOG_RETENTION_DAYS"`
+	KeyRotationDays       int    `env:"KEY_ROTATION_DAYS"`
 	AnalyticsDisabled     bool   `env:"ANALYTICS_DISABLED"`
 	AllowDowngrade        bool   `env:"ALLOW_DOWNGRADE"`
 	InternalAppURL        string `env:"INTERNAL_APP_URL"`
@@ -73,6 +75,18 @@ type EnvConfigSchema struct {
 
 	TLSCertFile string `env:"TLS_CERT" options:"file"`
 	TLSKeyFile  string `env:"TLS_KEY" options:"file"`
+	// TLSClientCAFile contains the CAs that issue the certificates of clients that authenticate with mutual TLS
+	TLSClientCAFile string `env:"TLS_CLIENT_CA" options:"file"`
+	// TLSClientCertHeader is the header a trusted proxy forwards the client certificate in
+	TLSClientCertHeader string `env:"TLS_CLIENT_CERT_HEADER"`
+
+	// LdapServerAddr and LdapsServerAddr are the addresses the read-only LDAP server listens on, which is disabled if both are empty
+	LdapServerAddr  string `env:"LDAP_SERVER_ADDR"`
+	LdapsServerAddr string `env:"LDAPS_SERVER_ADDR"`
+	// LdapServerBaseDN defaults to the domain components of the host of APP_URL
+	LdapServerBaseDN string `env:"LDAP_SERVER_BASE_DN"`
+	// LdapServerAllowInsecureBinds accepts simple binds without TLS, which send passwords and API keys in the clear
+	LdapServerAllowInsecureBinds bool `env:"LDAP_SERVER_ALLOW_INSECURE_BINDS"`
 
 	MaxMindLicenseKey string `env:"MAXMIND_LICENSE_KEY" options:"file"`
 	GeoLiteDBPath     string `env:"GEOLITE_DB_PATH"`
@@ -165,12 +179,19 @@ func ValidateEnvConfig(config *EnvConfigSchema) error {
 		return errors.New("AUDIT_LOG_RETENTION_DAYS must be greater than 0")
 	}
 
+	if config.KeyRotationDays < 0 {
+		return errors.New("KEY_ROTATION_DAYS must not be negative")
+	}
+
 	if config.StaticApiKey != "" && len(config.StaticApiKey) < 16 {
 		return errors.New("STATIC_API_KEY must be at least 16 characters long")
 	}
 
-	return validateTLSConfig(config)
+	if err := validateTLSConfig(config); err != nil {
+		return err
+	}
 
+	return validateLdapServerConfig(config)
 }
 
 func prepareDbConfig(config *EnvConfigSchema) {
@@ -274,8 +295,59 @@ func validateTLSConfig(config *EnvConfigSchema) error {
 		}
 	}
 
+	if config.TLSClientCAFile != "" {
+		if config.TLSCertFile == "" && config.TLSClientCertHeader == "" {
+			return errors.New("TLS_CLIENT_CA requires TLS_CERT or TLS_CLIENT_CERT_HEADER to be set")
+		}
+		if _, err := os.Stat(config.TLSClientCAFile); err != nil {
+			return fmt.Errorf("TLS_CLIENT_CA not found: %w", err)
+		}
+	}
+
+	if config.TLSClientCertHeader != "" && !config.TrustProxy {
+		return errors.New("TLS_CLIENT_CERT_HEADER requires TRUST_PROXY to be enabled")
+	}
+
+	return nil
+
+}
+
+func validateLdapServerConfig(config *EnvConfigSchema) error {
+	if config.LdapsServerAddr != "" && config.TLSCertFile == "" {
+		return errors.New("LDAPS_SERVER_ADDR requires TLS_CERT and TLS_KEY to be set")
+	}
+
+	if config.LdapServerBaseDN == "" {
+		config.LdapServerBaseDN = defaultLdapServerBaseDN(config.AppURL)
+	}
+	baseDN, err := ldap.ParseDN(config.LdapServerBaseDN)
+	if err != nil || len(baseDN.RDNs) == 0 {
+		return errors.New("LDAP_SERVER_BASE_DN is not a valid DN")
+	}
+
 	return nil
+}
+
+// defaultLdapServerBaseDN derives the base DN from the host of the app URL, e.g. dc=id,dc=example,dc=com for https://id.example.com
+// Hosts that are IP addresses fall back to dc=pocket-id
+func defaultLdapServerBaseDN(appURL string) string {
+	parsedURL, err := url.Parse(appURL)
+	if err != nil || parsedURL.Hostname() == "" || net.ParseIP(parsedURL.Hostname()) != nil {
+		return "dc=pocket-id"
+	}
+
+	labels := strings.Split(parsedURL.Hostname(), ".")
+	components := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label != "" {
+			components = append(components, "dc="+ldap.EscapeDN(label))
+		}
+	}
+	if len(components) == 0 {
+		return "dc=pocket-id"
+	}
 
+	return strings.Join(components, ",")
 }
 
 func shouldSkipEnvValidation(args []string) bool {
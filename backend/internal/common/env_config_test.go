@@ -164,6 +164,30 @@ func TestParseEnvConfig(t *testing.T) {
 		assert.ErrorContains(t, err, "AUDIT_LOG_RETENTION_DAYS must be greater than 0")
 	})
 
+	t.Run("should parse key rotation days", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_PROVIDER", "sqlite")
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("KEY_ROTATION_DAYS", "30")
+
+		err := parseAndValidateEnvConfig(t)
+		require.NoError(t, err)
+		assert.Equal(t, 30, EnvConfig.KeyRotationDays)
+	})
+
+	t.Run("should fail when KEY_ROTATION_DAYS is negative", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_PROVIDER", "sqlite")
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("KEY_ROTATION_DAYS", "-1")
+
+		err := parseAndValidateEnvConfig(t)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "KEY_ROTATION_DAYS must not be negative")
+	})
+
 	t.Run("should parse string environment variables correctly", func(t *testing.T) {
 		EnvConfig = defaultConfig()
 		t.Setenv("DB_CONNECTION_STRING", "postgres://test")
@@ -259,6 +283,80 @@ func TestParseEnvConfig(t *testing.T) {
 		require.Error(t, err)
 		assert.ErrorContains(t, err, "TLS_KEY_FILE not found")
 	})
+
+	t.Run("should fail when TLS client CA is set without a way to receive client certificates", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+
+		caFile := t.TempDir() + "/ca.pem"
+		require.NoError(t, os.WriteFile(caFile, []byte("ca"), 0600))
+		t.Setenv("TLS_CLIENT_CA", caFile)
+
+		err := parseAndValidateEnvConfig(t)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "TLS_CLIENT_CA requires TLS_CERT or TLS_CLIENT_CERT_HEADER to be set")
+	})
+
+	t.Run("should fail when TLS client certificate header is set without trusting the proxy", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("TLS_CLIENT_CERT_HEADER", "X-Client-Cert")
+
+		err := parseAndValidateEnvConfig(t)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "TLS_CLIENT_CERT_HEADER requires TRUST_PROXY to be enabled")
+	})
+
+	t.Run("should accept TLS client certificates from a trusted proxy", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("TRUST_PROXY", "true")
+		t.Setenv("TLS_CLIENT_CERT_HEADER", "X-Client-Cert")
+
+		caFile := t.TempDir() + "/ca.pem"
+		require.NoError(t, os.WriteFile(caFile, []byte("ca"), 0600))
+		t.Setenv("TLS_CLIENT_CA", caFile)
+
+		err := parseAndValidateEnvConfig(t)
+		require.NoError(t, err)
+	})
+
+	t.Run("should derive the LDAP server base DN from APP_URL", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "https://id.example.com")
+		t.Setenv("LDAP_SERVER_ADDR", ":3389")
+
+		err := parseAndValidateEnvConfig(t)
+		require.NoError(t, err)
+		assert.Equal(t, "dc=id,dc=example,dc=com", EnvConfig.LdapServerBaseDN)
+	})
+
+	t.Run("should fail with invalid LDAP_SERVER_BASE_DN", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("LDAP_SERVER_ADDR", ":3389")
+		t.Setenv("LDAP_SERVER_BASE_DN", "not a dn")
+
+		err := parseAndValidateEnvConfig(t)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "LDAP_SERVER_BASE_DN is not a valid DN")
+	})
+
+	t.Run("should fail when LDAPS is enabled without a TLS certificate", func(t *testing.T) {
+		EnvConfig = defaultConfig()
+		t.Setenv("DB_CONNECTION_STRING", "file:test.db")
+		t.Setenv("APP_URL", "http://localhost:3000")
+		t.Setenv("LDAPS_SERVER_ADDR", ":6636")
+
+		err := parseAndValidateEnvConfig(t)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "LDAPS_SERVER_ADDR requires TLS_CERT and TLS_KEY to be set")
+	})
 }
 
 func TestPrepareEnvConfig_FileBasedAndToLower(t *testing.T) {
@@ -215,6 +215,13 @@ func (e APIKeyAuthNotAllowedError) Error() string {
 }
 func (e APIKeyAuthNotAllowedError) HttpStatusCode() int { return http.StatusForbidden }
 
+type APIKeyScopeError struct{}
+
+func (e APIKeyScopeError) Error() string {
+	return "The API key is not allowed to be used for this endpoint"
+}
+func (e APIKeyScopeError) HttpStatusCode() int { return http.StatusForbidden }
+
 type UserDisabledError struct{}
 
 func (e UserDisabledError) Error() string       { return "User account is disabled" }
@@ -236,6 +243,15 @@ type OidcInvalidDeviceCodeError struct{}
 func (e OidcInvalidDeviceCodeError) Error() string       { return "invalid device code" }
 func (e OidcInvalidDeviceCodeError) HttpStatusCode() int { return http.StatusBadRequest }
 
+type OidcBackchannelAuthenticationRequestNotFoundError struct{}
+
+func (e OidcBackchannelAuthenticationRequestNotFoundError) Error() string {
+	return "backchannel authentication request not found or expired"
+}
+func (e OidcBackchannelAuthenticationRequestNotFoundError) HttpStatusCode() int {
+	return http.StatusNotFound
+}
+
 type ReauthenticationRequiredError struct{}
 
 func (e ReauthenticationRequiredError) Error() string       { return "reauthentication required" }
@@ -277,3 +293,10 @@ type InvalidEmailVerificationTokenError struct{}
 func (e InvalidEmailVerificationTokenError) Error() string { return "Invalid email verification token" }
 
 func (e InvalidEmailVerificationTokenError) HttpStatusCode() int { return http.StatusBadRequest }
+
+type OidcInvalidSectorIdentifierError struct{ Reason string }
+
+func (e OidcInvalidSectorIdentifierError) Error() string {
+	return "invalid sector identifier: " + e.Reason
+}
+func (e OidcInvalidSectorIdentifierError) HttpStatusCode() int { return http.StatusBadRequest }
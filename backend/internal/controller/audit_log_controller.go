@@ -24,6 +24,7 @@ func NewAuditLogController(group *gin.RouterGroup, auditLogService *service.Audi
 	group.GET("/audit-logs", authMiddleware.WithAdminNotRequired().Add(), alc.listAuditLogsForUserHandler)
 	group.GET("/audit-logs/filters/client-names", authMiddleware.Add(), alc.listClientNamesHandler)
 	group.GET("/audit-logs/filters/users", authMiddleware.Add(), alc.listUserNamesWithIdsHandler)
+	group.GET("/audit-logs/filters/actors", authMiddleware.Add(), alc.listActorsWithIdsHandler)
 }
 
 type AuditLogController struct {
@@ -77,6 +78,7 @@ func (alc *AuditLogController) listAuditLogsForUserHandler(c *gin.Context) {
 // @Summary List all audit logs
 // @Description Get a paginated list of all audit logs (admin only)
 // @Tags Audit Logs
+// @Param filters[actorUserID] query string false "Filter by the ID of the user that performed the event"
 // @Param pagination[page] query int false "Page number for pagination" default(1)
 // @Param pagination[limit] query int false "Number of items per page" default(20)
 // @Param sort[column] query string false "Column to sort by"
@@ -143,3 +145,19 @@ func (alc *AuditLogController) listUserNamesWithIdsHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, users)
 }
+
+// listActorsWithIdsHandler godoc
+// @Summary List actors with IDs
+// @Description Get a list of the usernames with their IDs of all users that performed an event, for audit log filtering
+// @Tags Audit Logs
+// @Success 200 {object} map[string]string "Map of user IDs to usernames"
+// @Router /api/audit-logs/filters/actors [get]
+func (alc *AuditLogController) listActorsWithIdsHandler(c *gin.Context) {
+	users, err := alc.auditLogService.ListActorsWithIds(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
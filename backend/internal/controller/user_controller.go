@@ -22,11 +22,12 @@ const defaultOneTimeAccessTokenDuration = 15 * time.Minute
 // @Summary User management controller
 // @Description Initializes all user-related API endpoints
 // @Tags Users
-func NewUserController(group *gin.RouterGroup, authMiddleware *middleware.AuthMiddleware, rateLimitMiddleware *middleware.RateLimitMiddleware, userService *service.UserService, oneTimeAccessService *service.OneTimeAccessService, webAuthnService *webauthn.Module, appConfigService *service.AppConfigService) {
+func NewUserController(group *gin.RouterGroup, authMiddleware *middleware.AuthMiddleware, rateLimitMiddleware *middleware.RateLimitMiddleware, userService *service.UserService, oneTimeAccessService *service.OneTimeAccessService, webAuthnService *webauthn.Module, userSessionService *service.UserSessionService, appConfigService *service.AppConfigService) {
 	uc := UserController{
 		userService:          userService,
 		oneTimeAccessService: oneTimeAccessService,
 		webAuthnService:      webAuthnService,
+		userSessionService:   userSessionService,
 		appConfigService:     appConfigService,
 	}
 
@@ -41,6 +42,13 @@ func NewUserController(group *gin.RouterGroup, authMiddleware *middleware.AuthMi
 	group.DELETE("/users/:id", authMiddleware.Add(), uc.deleteUserHandler)
 	group.DELETE("/users/:id/webauthn-credentials/:credentialId", authMiddleware.Add(), uc.deleteUserWebauthnCredentialHandler)
 
+	group.GET("/users/me/sessions", authMiddleware.WithAdminNotRequired().Add(), uc.listCurrentUserSessionsHandler)
+	group.DELETE("/users/me/sessions", authMiddleware.WithAdminNotRequired().Add(), uc.revokeOtherCurrentUserSessionsHandler)
+	group.DELETE("/users/me/sessions/:sessionId", authMiddleware.WithAdminNotRequired().Add(), uc.revokeCurrentUserSessionHandler)
+	group.GET("/users/:id/sessions", authMiddleware.Add(), uc.listUserSessionsHandler)
+	group.DELETE("/users/:id/sessions", authMiddleware.Add(), uc.revokeAllUserSessionsHandler)
+	group.DELETE("/users/:id/sessions/:sessionId", authMiddleware.Add(), uc.revokeUserSessionHandler)
+
 	group.PUT("/users/:id/user-groups", authMiddleware.Add(), uc.updateUserGroups)
 
 	group.GET("/users/:id/profile-picture.png", uc.getUserProfilePictureHandler)
@@ -65,6 +73,7 @@ type UserController struct {
 	userService          *service.UserService
 	oneTimeAccessService *service.OneTimeAccessService
 	webAuthnService      *webauthn.Module
+	userSessionService   *service.UserSessionService
 	appConfigService     *service.AppConfigService
 }
 
@@ -241,6 +250,132 @@ func (uc *UserController) deleteUserWebauthnCredentialHandler(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// listCurrentUserSessionsHandler godoc
+// @Summary List current user's sessions
+// @Description Retrieve the browser sessions of the currently authenticated user
+// @Tags Users
+// @Success 200 {array} dto.UserSessionDto
+// @Router /api/users/me/sessions [get]
+func (uc *UserController) listCurrentUserSessionsHandler(c *gin.Context) {
+	uc.listSessions(c, c.GetString("userID"))
+}
+
+// revokeCurrentUserSessionHandler godoc
+// @Summary Revoke current user's session
+// @Description Sign out a browser session of the currently authenticated user
+// @Tags Users
+// @Param sessionId path string true "Session ID"
+// @Success 204 "No Content"
+// @Router /api/users/me/sessions/{sessionId} [delete]
+func (uc *UserController) revokeCurrentUserSessionHandler(c *gin.Context) {
+	err := uc.userSessionService.RevokeSession(c.Request.Context(), c.GetString("userID"), c.Param("sessionId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeOtherCurrentUserSessionsHandler godoc
+// @Summary Sign out everywhere else
+// @Description Sign out every other browser session of the currently authenticated user and revoke their OAuth2 grants
+// @Tags Users
+// @Success 204 "No Content"
+// @Router /api/users/me/sessions [delete]
+func (uc *UserController) revokeOtherCurrentUserSessionsHandler(c *gin.Context) {
+	err := uc.userSessionService.RevokeAllSessions(c.Request.Context(), c.GetString("userID"), c.GetString("sessionID"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listUserSessionsHandler godoc
+// @Summary List user sessions
+// @Description Retrieve the browser sessions of a specific user
+// @Tags Users
+// @Param id path string true "User ID"
+// @Success 200 {array} dto.UserSessionDto
+// @Router /api/users/{id}/sessions [get]
+func (uc *UserController) listUserSessionsHandler(c *gin.Context) {
+	userID := c.Param("id")
+
+	if _, err := uc.userService.GetUser(c.Request.Context(), userID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	uc.listSessions(c, userID)
+}
+
+// revokeUserSessionHandler godoc
+// @Summary Revoke user session
+// @Description Sign out a browser session of a specific user
+// @Tags Users
+// @Param id path string true "User ID"
+// @Param sessionId path string true "Session ID"
+// @Success 204 "No Content"
+// @Router /api/users/{id}/sessions/{sessionId} [delete]
+func (uc *UserController) revokeUserSessionHandler(c *gin.Context) {
+	err := uc.userSessionService.RevokeSession(c.Request.Context(), c.Param("id"), c.Param("sessionId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeAllUserSessionsHandler godoc
+// @Summary Sign user out everywhere
+// @Description Sign out every browser session of a specific user and revoke their OAuth2 grants
+// @Tags Users
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Router /api/users/{id}/sessions [delete]
+func (uc *UserController) revokeAllUserSessionsHandler(c *gin.Context) {
+	userID := c.Param("id")
+
+	// Don't sign the admin out of the session they are using if they revoke their own sessions
+	var exceptSessionID string
+	if userID == c.GetString("userID") {
+		exceptSessionID = c.GetString("sessionID")
+	}
+
+	err := uc.userSessionService.RevokeAllSessions(c.Request.Context(), userID, exceptSessionID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (uc *UserController) listSessions(c *gin.Context, userID string) {
+	sessions, err := uc.userSessionService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var sessionDtos []dto.UserSessionDto
+	if err := dto.MapStructList(sessions, &sessionDtos); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	currentSessionID := c.GetString("sessionID")
+	for i := range sessionDtos {
+		sessionDtos[i].Device = uc.userSessionService.DeviceStringFromUserAgent(sessions[i].UserAgent)
+		sessionDtos[i].Current = sessionDtos[i].ID == currentSessionID
+	}
+
+	c.JSON(http.StatusOK, sessionDtos)
+}
+
 // createUserHandler godoc
 // @Summary Create user
 // @Description Create a new user
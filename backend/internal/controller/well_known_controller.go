@@ -1,15 +1,20 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v3/jwk"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/oidc"
 	"github.com/pocket-id/pocket-id/backend/internal/service"
 )
 
@@ -17,10 +22,10 @@ import (
 // @Summary OIDC Discovery controller
 // @Description Initializes OIDC discovery and JWKS endpoints
 // @Tags Well Known
-func NewWellKnownController(group *gin.RouterGroup, jwtService *service.JwtService) {
-	wkc := &WellKnownController{jwtService: jwtService}
+func NewWellKnownController(group *gin.RouterGroup, jwtService *service.JwtService, scopeNames ScopeNameLister, requestObjectEncryptionKey jwk.Key) {
+	wkc := &WellKnownController{jwtService: jwtService, scopeNames: scopeNames, requestObjectEncryptionKey: requestObjectEncryptionKey}
 
-	// Pre-compute the OIDC configuration document, which is static
+	// Pre-compute the static part of the OIDC configuration document
 	var err error
 	wkc.oidcConfig, err = wkc.computeOIDCConfiguration()
 	if err != nil {
@@ -33,14 +38,22 @@ func NewWellKnownController(group *gin.RouterGroup, jwtService *service.JwtServi
 	group.GET("/.well-known/openid-configuration", wkc.openIDConfigurationHandler)
 }
 
+// ScopeNameLister lists the admin-defined scopes, which are advertised in the discovery document
+type ScopeNameLister interface {
+	ListScopeNames(ctx context.Context) ([]string, error)
+}
+
 type WellKnownController struct {
 	jwtService *service.JwtService
-	oidcConfig []byte
+	scopeNames ScopeNameLister
+	oidcConfig map[string]any
+	// requestObjectEncryptionKey is published next to the signing keys, so clients can encrypt request objects
+	requestObjectEncryptionKey jwk.Key
 }
 
 // jwksHandler godoc
 // @Summary Get JSON Web Key Set (JWKS)
-// @Description Returns the JSON Web Key Set used for token verification
+// @Description Returns the JSON Web Key Set used for token verification and request object encryption
 // @Tags Well Known
 // @Produce json
 // @Success 200 {object} object "{ \"keys\": []interface{} }"
@@ -52,9 +65,29 @@ func (wkc *WellKnownController) jwksHandler(c *gin.Context) {
 		return
 	}
 
+	if wkc.requestObjectEncryptionKey != nil {
+		jwks, err = appendJWK(jwks, wkc.requestObjectEncryptionKey)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
 	c.Data(http.StatusOK, "application/json; charset=utf-8", jwks)
 }
 
+// appendJWK adds a key to the encoded JWKS
+func appendJWK(encodedJWKS []byte, key jwk.Key) ([]byte, error) {
+	jwks, err := jwk.Parse(encodedJWKS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	if err := jwks.AddKey(key); err != nil {
+		return nil, fmt.Errorf("failed to add key to JWKS: %w", err)
+	}
+	return json.Marshal(jwks)
+}
+
 // openIDConfigurationHandler godoc
 // @Summary Get OpenID Connect discovery configuration
 // @Description Returns the OpenID Connect discovery document with endpoints and capabilities
@@ -62,39 +95,94 @@ func (wkc *WellKnownController) jwksHandler(c *gin.Context) {
 // @Success 200 {object} object "OpenID Connect configuration"
 // @Router /.well-known/openid-configuration [get]
 func (wkc *WellKnownController) openIDConfigurationHandler(c *gin.Context) {
-	c.Data(http.StatusOK, "application/json; charset=utf-8", wkc.oidcConfig)
+	registeredScopes, err := wkc.scopeNames.ListScopeNames(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	config := maps.Clone(wkc.oidcConfig)
+	scopesSupported := make([]string, 0, len(common.StandardScopes)+len(registeredScopes))
+	scopesSupported = append(scopesSupported, common.StandardScopes...)
+	config["scopes_supported"] = append(scopesSupported, registeredScopes...)
+
+	// The algorithms change when a key with another algorithm is published before it's used, so clients that cache
+	// the document accept tokens signed with it once it becomes active
+	signingAlgs := wkc.jwtService.GetPublishedKeyAlgs()
+	config["id_token_signing_alg_values_supported"] = signingAlgs
+	config["userinfo_signing_alg_values_supported"] = signingAlgs
+	config["authorization_signing_alg_values_supported"] = signingAlgs
+
+	body, err := json.Marshal(config)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
-func (wkc *WellKnownController) computeOIDCConfiguration() ([]byte, error) {
+func (wkc *WellKnownController) computeOIDCConfiguration() (map[string]any, error) {
 	appUrl := common.EnvConfig.AppURL
 
 	internalAppUrl := common.EnvConfig.InternalAppURL
 
-	alg, err := wkc.jwtService.GetKeyAlg()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get key algorithm: %w", err)
+	// Clients can only authenticate with client certificates if Pocket ID receives them, and the certificates of
+	// tls_client_auth clients are verified against the configured CAs
+	authMethods := []string{"client_secret_basic", "client_secret_post", "private_key_jwt"}
+	mtlsEnabled := common.EnvConfig.TLSClientCAFile != "" || common.EnvConfig.TLSClientCertHeader != ""
+	if common.EnvConfig.TLSClientCAFile != "" {
+		authMethods = append(authMethods, oidc.AuthMethodTLSClientAuth)
+	}
+	if mtlsEnabled {
+		authMethods = append(authMethods, oidc.AuthMethodSelfSignedTLSClientAuth)
 	}
+	authMethods = append(authMethods, "none")
+
 	config := map[string]any{
-		"issuer":                                         appUrl,
-		"authorization_endpoint":                         appUrl + "/authorize",
-		"token_endpoint":                                 internalAppUrl + "/api/oidc/token",
-		"userinfo_endpoint":                              internalAppUrl + "/api/oidc/userinfo",
-		"end_session_endpoint":                           appUrl + "/api/oidc/end-session",
-		"introspection_endpoint":                         internalAppUrl + "/api/oidc/introspect",
-		"device_authorization_endpoint":                  appUrl + "/api/oidc/device/authorize",
-		"jwks_uri":                                       internalAppUrl + "/.well-known/jwks.json",
-		"grant_types_supported":                          []string{service.GrantTypeAuthorizationCode, service.GrantTypeRefreshToken, service.GrantTypeDeviceCode, service.GrantTypeClientCredentials},
-		"scopes_supported":                               []string{"openid", "profile", "email", "groups", "offline_access"},
-		"claims_supported":                               []string{"sub", "given_name", "family_name", "name", "display_name", "email", "email_verified", "preferred_username", "picture", "groups", "auth_time", "amr"},
-		"response_types_supported":                       []string{"code", "id_token"},
-		"subject_types_supported":                        []string{"public"},
-		"id_token_signing_alg_values_supported":          []string{alg.String()},
-		"authorization_response_iss_parameter_supported": true,
-		"code_challenge_methods_supported":               []string{"plain", "S256"},
-		"prompt_values_supported":                        []string{"none", "login", "consent", "select_account"},
-		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
-		"pushed_authorization_request_endpoint":          internalAppUrl + "/api/oidc/par",
-		"require_pushed_authorization_requests":          false,
+		"issuer":                                                appUrl,
+		"authorization_endpoint":                                appUrl + "/authorize",
+		"token_endpoint":                                        internalAppUrl + "/api/oidc/token",
+		"userinfo_endpoint":                                     internalAppUrl + "/api/oidc/userinfo",
+		"end_session_endpoint":                                  appUrl + "/api/oidc/end-session",
+		"introspection_endpoint":                                internalAppUrl + "/api/oidc/introspect",
+		"revocation_endpoint":                                   internalAppUrl + "/api/oidc/revoke",
+		"device_authorization_endpoint":                         appUrl + "/api/oidc/device/authorize",
+		"jwks_uri":                                              internalAppUrl + "/.well-known/jwks.json",
+		"grant_types_supported":                                 []string{service.GrantTypeAuthorizationCode, service.GrantTypeRefreshToken, service.GrantTypeDeviceCode, service.GrantTypeClientCredentials, oidc.GrantTypeTokenExchange, oidc.GrantTypeCIBA},
+		"claims_supported":                                      []string{"sub", "sid", "given_name", "family_name", "name", "display_name", "email", "email_verified", "preferred_username", "picture", "groups", "auth_time", "amr"},
+		"response_types_supported":                              []string{"code", "id_token"},
+		"response_modes_supported":                              oidc.ResponseModes,
+		"subject_types_supported":                               []string{string(model.OidcSubjectTypePublic), string(model.OidcSubjectTypePairwise)},
+		"id_token_encryption_alg_values_supported":              oidc.ResponseEncryptionAlgorithms,
+		"id_token_encryption_enc_values_supported":              oidc.ResponseEncryptionEncodings,
+		"userinfo_encryption_alg_values_supported":              oidc.ResponseEncryptionAlgorithms,
+		"userinfo_encryption_enc_values_supported":              oidc.ResponseEncryptionEncodings,
+		"authorization_response_iss_parameter_supported":        true,
+		"code_challenge_methods_supported":                      []string{"plain", "S256"},
+		"prompt_values_supported":                               []string{"none", "login", "consent", "select_account"},
+		"token_endpoint_auth_methods_supported":                 authMethods,
+		"token_endpoint_auth_signing_alg_values_supported":      oidc.ClientAssertionSigningAlgorithms,
+		"revocation_endpoint_auth_methods_supported":            authMethods,
+		"revocation_endpoint_auth_signing_alg_values_supported": oidc.ClientAssertionSigningAlgorithms,
+		"registration_endpoint":                                 internalAppUrl + "/api/oidc/register",
+		"pushed_authorization_request_endpoint":                 internalAppUrl + "/api/oidc/par",
+		"require_pushed_authorization_requests":                 false,
+		"dpop_signing_alg_values_supported":                     oidc.DPoPSigningAlgorithms,
+		"backchannel_logout_supported":                          true,
+		"backchannel_logout_session_supported":                  true,
+		"frontchannel_logout_supported":                         true,
+		"frontchannel_logout_session_supported":                 true,
+		"request_parameter_supported":                           true,
+		"request_uri_parameter_supported":                       true,
+		"require_request_uri_registration":                      false,
+		"request_object_signing_alg_values_supported":           oidc.RequestObjectSigningAlgorithms,
+		"request_object_encryption_alg_values_supported":        oidc.RequestObjectEncryptionAlgorithms,
+		"request_object_encryption_enc_values_supported":        oidc.RequestObjectEncryptionEncodings,
+		"tls_client_certificate_bound_access_tokens":            mtlsEnabled,
+		"backchannel_authentication_endpoint":                   internalAppUrl + "/api/oidc/backchannel-authentication",
+		"backchannel_token_delivery_modes_supported":            oidc.BackchannelTokenDeliveryModes,
+		"backchannel_user_code_parameter_supported":             false,
 	}
-	return json.Marshal(config)
+	return config, nil
 }
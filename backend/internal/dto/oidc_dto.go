@@ -13,15 +13,32 @@ type OidcClientMetaDataDto struct {
 
 type OidcClientDto struct {
 	OidcClientMetaDataDto
-	CallbackURLs                        []string                 `json:"callbackURLs"`
-	LogoutCallbackURLs                  []string                 `json:"logoutCallbackURLs"`
-	IsPublic                            bool                     `json:"isPublic"`
-	PkceEnabled                         bool                     `json:"pkceEnabled"`
-	RequiresPushedAuthorizationRequests bool                     `json:"requiresPushedAuthorizationRequests"`
-	SkipConsent                         bool                     `json:"skipConsent"`
-	Credentials                         OidcClientCredentialsDto `json:"credentials"`
-	IsGroupRestricted                   bool                     `json:"isGroupRestricted"`
-	PkceSupported                       bool                     `json:"pkceSupported,omitempty"`
+	CallbackURLs                        []string                    `json:"callbackURLs"`
+	LogoutCallbackURLs                  []string                    `json:"logoutCallbackURLs"`
+	IsPublic                            bool                        `json:"isPublic"`
+	PkceEnabled                         bool                        `json:"pkceEnabled"`
+	RequiresPushedAuthorizationRequests bool                        `json:"requiresPushedAuthorizationRequests"`
+	RequiresSignedRequestObject         bool                        `json:"requiresSignedRequestObject"`
+	RequiresDPoP                        bool                        `json:"requiresDPoP"`
+	SkipConsent                         bool                        `json:"skipConsent"`
+	Credentials                         OidcClientCredentialsDto    `json:"credentials"`
+	TokenExchange                       OidcClientTokenExchangeDto  `json:"tokenExchange"`
+	TokenLifetimes                      OidcClientTokenLifetimesDto `json:"tokenLifetimes"`
+	SubjectType                         string                      `json:"subjectType"`
+	DefaultResponseMode                 string                      `json:"defaultResponseMode"`
+	IDTokenEncryptedResponseAlg         string                      `json:"idTokenEncryptedResponseAlg"`
+	IDTokenEncryptedResponseEnc         string                      `json:"idTokenEncryptedResponseEnc"`
+	UserinfoSignedResponseAlg           string                      `json:"userinfoSignedResponseAlg"`
+	UserinfoEncryptedResponseAlg        string                      `json:"userinfoEncryptedResponseAlg"`
+	UserinfoEncryptedResponseEnc        string                      `json:"userinfoEncryptedResponseEnc"`
+	SectorIdentifierURI                 *string                     `json:"sectorIdentifierUri"`
+	BackchannelLogoutURI                *string                     `json:"backchannelLogoutUri"`
+	BackchannelLogoutSessionRequired    bool                        `json:"backchannelLogoutSessionRequired"`
+	FrontchannelLogoutURI               *string                     `json:"frontchannelLogoutUri"`
+	BackchannelTokenDeliveryMode        string                      `json:"backchannelTokenDeliveryMode"`
+	BackchannelClientNotificationURI    *string                     `json:"backchannelClientNotificationUri"`
+	IsGroupRestricted                   bool                        `json:"isGroupRestricted"`
+	PkceSupported                       bool                        `json:"pkceSupported,omitempty"`
 }
 
 type OidcClientWithAllowedUserGroupsDto struct {
@@ -35,21 +52,38 @@ type OidcClientWithAllowedGroupsCountDto struct {
 }
 
 type OidcClientUpdateDto struct {
-	Name                                string                   `json:"name" binding:"required,max=50" unorm:"nfc"`
-	CallbackURLs                        []string                 `json:"callbackURLs" binding:"omitempty,dive,callback_url_pattern"`
-	LogoutCallbackURLs                  []string                 `json:"logoutCallbackURLs" binding:"omitempty,dive,callback_url_pattern"`
-	IsPublic                            bool                     `json:"isPublic"`
-	PkceEnabled                         bool                     `json:"pkceEnabled"`
-	RequiresReauthentication            bool                     `json:"requiresReauthentication"`
-	RequiresPushedAuthorizationRequests bool                     `json:"requiresPushedAuthorizationRequests"`
-	SkipConsent                         bool                     `json:"skipConsent"`
-	Credentials                         OidcClientCredentialsDto `json:"credentials"`
-	LaunchURL                           *string                  `json:"launchURL" binding:"omitempty,url"`
-	HasLogo                             bool                     `json:"hasLogo"`
-	HasDarkLogo                         bool                     `json:"hasDarkLogo"`
-	LogoURL                             *string                  `json:"logoUrl"`
-	DarkLogoURL                         *string                  `json:"darkLogoUrl"`
-	IsGroupRestricted                   bool                     `json:"isGroupRestricted"`
+	Name                                string                      `json:"name" binding:"required,max=50" unorm:"nfc"`
+	CallbackURLs                        []string                    `json:"callbackURLs" binding:"omitempty,dive,callback_url_pattern"`
+	LogoutCallbackURLs                  []string                    `json:"logoutCallbackURLs" binding:"omitempty,dive,callback_url_pattern"`
+	IsPublic                            bool                        `json:"isPublic"`
+	PkceEnabled                         bool                        `json:"pkceEnabled"`
+	RequiresReauthentication            bool                        `json:"requiresReauthentication"`
+	RequiresPushedAuthorizationRequests bool                        `json:"requiresPushedAuthorizationRequests"`
+	RequiresSignedRequestObject         bool                        `json:"requiresSignedRequestObject"`
+	RequiresDPoP                        bool                        `json:"requiresDPoP"`
+	SkipConsent                         bool                        `json:"skipConsent"`
+	Credentials                         OidcClientCredentialsDto    `json:"credentials"`
+	TokenExchange                       OidcClientTokenExchangeDto  `json:"tokenExchange"`
+	TokenLifetimes                      OidcClientTokenLifetimesDto `json:"tokenLifetimes"`
+	SubjectType                         string                      `json:"subjectType" binding:"omitempty,oneof=public pairwise"`
+	DefaultResponseMode                 string                      `json:"defaultResponseMode" binding:"omitempty,oneof=query fragment form_post query.jwt fragment.jwt form_post.jwt jwt"`
+	IDTokenEncryptedResponseAlg         string                      `json:"idTokenEncryptedResponseAlg" binding:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 ECDH-ES ECDH-ES+A128KW ECDH-ES+A192KW ECDH-ES+A256KW"`
+	IDTokenEncryptedResponseEnc         string                      `json:"idTokenEncryptedResponseEnc" binding:"omitempty,excluded_without=IDTokenEncryptedResponseAlg,oneof=A128CBC-HS256 A192CBC-HS384 A256CBC-HS512 A128GCM A192GCM A256GCM"`
+	UserinfoSignedResponseAlg           string                      `json:"userinfoSignedResponseAlg" binding:"omitempty,oneof=RS256 RS384 RS512 PS256 PS384 PS512 ES256 ES384 ES512 EdDSA"`
+	UserinfoEncryptedResponseAlg        string                      `json:"userinfoEncryptedResponseAlg" binding:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 ECDH-ES ECDH-ES+A128KW ECDH-ES+A192KW ECDH-ES+A256KW"`
+	UserinfoEncryptedResponseEnc        string                      `json:"userinfoEncryptedResponseEnc" binding:"omitempty,excluded_without=UserinfoEncryptedResponseAlg,oneof=A128CBC-HS256 A192CBC-HS384 A256CBC-HS512 A128GCM A192GCM A256GCM"`
+	SectorIdentifierURI                 *string                     `json:"sectorIdentifierUri" binding:"omitempty,url,startswith=https://"`
+	BackchannelLogoutURI                *string                     `json:"backchannelLogoutUri" binding:"omitempty,url"`
+	BackchannelLogoutSessionRequired    bool                        `json:"backchannelLogoutSessionRequired"`
+	FrontchannelLogoutURI               *string                     `json:"frontchannelLogoutUri" binding:"omitempty,url"`
+	BackchannelTokenDeliveryMode        string                      `json:"backchannelTokenDeliveryMode" binding:"omitempty,oneof=poll ping"`
+	BackchannelClientNotificationURI    *string                     `json:"backchannelClientNotificationUri" binding:"omitempty,url"`
+	LaunchURL                           *string                     `json:"launchURL" binding:"omitempty,url"`
+	HasLogo                             bool                        `json:"hasLogo"`
+	HasDarkLogo                         bool                        `json:"hasDarkLogo"`
+	LogoURL                             *string                     `json:"logoUrl"`
+	DarkLogoURL                         *string                     `json:"darkLogoUrl"`
+	IsGroupRestricted                   bool                        `json:"isGroupRestricted"`
 }
 
 type OidcClientCreateDto struct {
@@ -58,7 +92,15 @@ type OidcClientCreateDto struct {
 }
 
 type OidcClientCredentialsDto struct {
-	FederatedIdentities []OidcClientFederatedIdentityDto `json:"federatedIdentities,omitempty"`
+	FederatedIdentities    []OidcClientFederatedIdentityDto `json:"federatedIdentities,omitempty"`
+	JWKS                   string                           `json:"jwks,omitempty" binding:"omitempty,jwks"`
+	JWKSURI                string                           `json:"jwksUri,omitempty" binding:"omitempty,url,excluded_with=JWKS"`
+	TLSClientAuthMethod    string                           `json:"tlsClientAuthMethod,omitempty" binding:"omitempty,oneof=tls_client_auth self_signed_tls_client_auth"`
+	TLSClientAuthSubjectDN string                           `json:"tlsClientAuthSubjectDn,omitempty" binding:"omitempty,max=1024"`
+	TLSClientAuthSANDNS    string                           `json:"tlsClientAuthSanDns,omitempty" binding:"omitempty,fqdn"`
+	TLSClientAuthSANURI    string                           `json:"tlsClientAuthSanUri,omitempty" binding:"omitempty,uri"`
+	TLSClientAuthSANIP     string                           `json:"tlsClientAuthSanIp,omitempty" binding:"omitempty,ip"`
+	TLSClientAuthSANEmail  string                           `json:"tlsClientAuthSanEmail,omitempty" binding:"omitempty,email"`
 }
 
 type OidcClientFederatedIdentityDto struct {
@@ -69,6 +111,33 @@ type OidcClientFederatedIdentityDto struct {
 	ReplayProtection bool   `json:"replayProtection"`
 }
 
+type OidcClientTokenExchangeDto struct {
+	SubjectTokenTypes  []string                           `json:"subjectTokenTypes,omitempty" binding:"omitempty,dive,oneof=urn:ietf:params:oauth:token-type:access_token urn:ietf:params:oauth:token-type:id_token urn:ietf:params:oauth:token-type:jwt"`
+	SubjectClientIDs   []string                           `json:"subjectClientIds,omitempty" binding:"omitempty,dive,client_id"`
+	TrustedIssuers     []OidcClientTokenExchangeIssuerDto `json:"trustedIssuers,omitempty" binding:"omitempty,dive"`
+	AllowedAudiences   []string                           `json:"allowedAudiences,omitempty" binding:"omitempty,dive,required"`
+	AllowedScopes      []string                           `json:"allowedScopes,omitempty" binding:"omitempty,dive,required,excludesall= "`
+	AllowDelegation    bool                               `json:"allowDelegation"`
+	AllowImpersonation bool                               `json:"allowImpersonation"`
+}
+
+type OidcClientTokenExchangeIssuerDto struct {
+	Issuer    string `json:"issuer" binding:"required"`
+	JWKS      string `json:"jwks,omitempty" binding:"omitempty,url"`
+	Audience  string `json:"audience,omitempty"`
+	UserClaim string `json:"userClaim,omitempty" binding:"omitempty,oneof=email preferred_username"`
+}
+
+// OidcClientTokenLifetimesDto contains the token lifetimes of a client in seconds, zero uses the default lifetime
+type OidcClientTokenLifetimesDto struct {
+	AccessToken             int    `json:"accessToken" binding:"omitempty,min=60,max=86400"`
+	IDToken                 int    `json:"idToken" binding:"omitempty,min=60,max=86400"`
+	AuthorizationCode       int    `json:"authorizationCode" binding:"omitempty,min=10,max=600"`
+	RefreshToken            int    `json:"refreshToken" binding:"omitempty,min=300,max=31536000"`
+	RefreshTokenExpiry      string `json:"refreshTokenExpiry" binding:"omitempty,oneof=sliding absolute"`
+	RefreshTokenIdleTimeout int    `json:"refreshTokenIdleTimeout" binding:"omitempty,min=300,max=31536000"`
+}
+
 type OidcUpdateAllowedUserGroupsDto struct {
 	UserGroupIDs []string `json:"userGroupIds" binding:"required"`
 }
@@ -96,6 +165,22 @@ type DeviceCodeInfoDto struct {
 	Client                   OidcClientMetaDataDto `json:"client"`
 }
 
+type OidcBackchannelAuthenticationResponseDto struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int    `json:"expires_in"`
+	Interval  int    `json:"interval"`
+}
+
+type BackchannelAuthenticationRequestDto struct {
+	ID                       string                `json:"id"`
+	Scope                    []string              `json:"scope"`
+	BindingMessage           string                `json:"bindingMessage,omitempty"`
+	ExpiresAt                datatype.DateTime     `json:"expiresAt"`
+	AuthorizationRequired    bool                  `json:"authorizationRequired"`
+	ReauthenticationRequired bool                  `json:"reauthenticationRequired"`
+	Client                   OidcClientMetaDataDto `json:"client"`
+}
+
 type AuthorizedOidcClientDto struct {
 	Scope      string                `json:"scope"`
 	Client     OidcClientMetaDataDto `json:"client"`
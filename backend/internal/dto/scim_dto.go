@@ -7,12 +7,14 @@ import (
 )
 
 type ScimServiceProviderDTO struct {
-	ID           string                `json:"id"`
-	Endpoint     string                `json:"endpoint"`
-	Token        string                `json:"token"`
-	LastSyncedAt *datatype.DateTime    `json:"lastSyncedAt"`
-	OidcClient   OidcClientMetaDataDto `json:"oidcClient"`
-	CreatedAt    datatype.DateTime     `json:"createdAt"`
+	ID            string                `json:"id"`
+	Endpoint      string                `json:"endpoint"`
+	Token         string                `json:"token"`
+	LastSyncedAt  *datatype.DateTime    `json:"lastSyncedAt"`
+	LastPushedAt  *datatype.DateTime    `json:"lastPushedAt"`
+	LastPushError string                `json:"lastPushError"`
+	OidcClient    OidcClientMetaDataDto `json:"oidcClient"`
+	CreatedAt     datatype.DateTime     `json:"createdAt"`
 }
 
 type ScimServiceProviderCreateDTO struct {
@@ -28,6 +30,17 @@ type ScimUser struct {
 	Display  string      `json:"displayName,omitempty"`
 	Active   bool        `json:"active"`
 	Emails   []ScimEmail `json:"emails,omitempty"`
+
+	Enterprise *ScimEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+}
+
+// ScimEnterpriseUser is the enterprise user extension as defined in RFC 7643 section 4.3
+type ScimEnterpriseUser struct {
+	EmployeeNumber string `json:"employeeNumber,omitempty"`
+	CostCenter     string `json:"costCenter,omitempty"`
+	Organization   string `json:"organization,omitempty"`
+	Division       string `json:"division,omitempty"`
+	Department     string `json:"department,omitempty"`
 }
 
 type ScimName struct {
@@ -50,6 +63,17 @@ type ScimGroupMember struct {
 	Value string `json:"value"`
 }
 
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
 type ScimListResponse[T any] struct {
 	Resources    []T `json:"Resources"`
 	TotalResults int `json:"totalResults"`
@@ -0,0 +1,16 @@
+package dto
+
+import datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+
+type UserSessionDto struct {
+	ID                   string            `json:"id"`
+	AuthenticationMethod string            `json:"authenticationMethod"`
+	IpAddress            *string           `json:"ipAddress"`
+	Device               string            `json:"device"`
+	Country              string            `json:"country"`
+	City                 string            `json:"city"`
+	Current              bool              `json:"current"`
+	CreatedAt            datatype.DateTime `json:"createdAt"`
+	LastSeenAt           datatype.DateTime `json:"lastSeenAt"`
+	ExpiresAt            datatype.DateTime `json:"expiresAt"`
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
 // [a-zA-Z0-9]      : The username must start with an alphanumeric character
@@ -47,6 +49,9 @@ func init() {
 		"callback_url_pattern": func(fl validator.FieldLevel) bool {
 			return ValidateCallbackURLPattern(fl.Field().String())
 		},
+		"jwks": func(fl validator.FieldLevel) bool {
+			return ValidatePublicJWKS(fl.Field().String())
+		},
 	}
 	for k, v := range validators {
 		err := engine.RegisterValidation(k, v)
@@ -86,3 +91,24 @@ func ValidateCallbackURL(str string) bool {
 func ValidateCallbackURLPattern(raw string) bool {
 	return utils.ValidateCallbackURLPattern(raw) == nil
 }
+
+// ValidatePublicJWKS validates a JSON-encoded JWKS, which must contain at least one key and only asymmetric public keys
+func ValidatePublicJWKS(str string) bool {
+	set, err := jwk.ParseString(str)
+	if err != nil || set.Len() == 0 {
+		return false
+	}
+
+	for i := range set.Len() {
+		key, _ := set.Key(i)
+		if key.KeyType() == jwa.OctetSeq() {
+			return false
+		}
+		isPrivate, err := jwk.IsPrivateKey(key)
+		if err != nil || isPrivate {
+			return false
+		}
+	}
+
+	return true
+}
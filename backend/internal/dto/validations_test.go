@@ -1,9 +1,15 @@
 package dto
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
 )
 
 func TestValidateUsername(t *testing.T) {
@@ -105,3 +111,41 @@ func TestValidateCallbackURLPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatePublicJWKS(t *testing.T) {
+	privateKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	publicKey, err := privateKey.PublicKey()
+	require.NoError(t, err)
+
+	encodeSet := func(keys ...jwk.Key) string {
+		set := jwk.NewSet()
+		for _, key := range keys {
+			require.NoError(t, set.AddKey(key))
+		}
+		raw, err := json.Marshal(set)
+		require.NoError(t, err)
+		return string(raw)
+	}
+
+	symmetricKey, err := jwk.Import([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"valid public key", encodeSet(publicKey), true},
+		{"rejects private key", encodeSet(privateKey), false},
+		{"rejects symmetric key", encodeSet(symmetricKey), false},
+		{"rejects empty set", `{"keys":[]}`, false},
+		{"rejects invalid JSON", "not-a-jwks", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ValidatePublicJWKS(tt.input))
+		})
+	}
+}
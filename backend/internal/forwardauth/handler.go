@@ -0,0 +1,272 @@
+package forwardauth
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// cookieName is the name of the cookie on the host of a protected application
+// The cookie of Pocket ID can't be used, because it is only sent to the host of Pocket ID
+const cookieName = "_pocket_id_forward_auth"
+
+// stateCookieName is the name of the cookie on the host of a protected application that holds the state of a sign in
+// The callback only accepts a code together with the state of the browser that started the sign in, so nobody can sign
+// the user in to their own account with a link to the callback
+const stateCookieName = "_pocket_id_forward_auth_state"
+
+// Headers that identify the user to the protected application
+const (
+	headerUser        = "Remote-User"
+	headerEmail       = "Remote-Email"
+	headerName        = "Remote-Name"
+	headerGroups      = "Remote-Groups"
+	headerClaimPrefix = "Remote-Claim-"
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// authorize godoc
+// @Summary Authorize a request to an application behind a reverse proxy
+// @Description Forward-auth endpoint for Traefik ForwardAuth, Caddy forward_auth and nginx auth_request. The reverse proxy passes the original URL in the X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Uri headers, or in the X-Original-URL header with nginx.
+// @Description Users that may access the application get a 200 response with the Remote-User, Remote-Email, Remote-Name, Remote-Groups and Remote-Claim-* headers, which the reverse proxy forwards to the application.
+// @Description Other users are redirected to sign in and back to the original URL. Because nginx can't pass on redirects, it gets a 401 response with the Location header instead.
+// @Tags Forward Auth
+// @Param clientId path string true "Client ID of the application"
+// @Param claims query string false "Comma-separated keys of the custom claims to forward as Remote-Claim-<key> headers"
+// @Success 200 "The user may access the application"
+// @Failure 302 "The user has to sign in"
+// @Failure 401 "The user has to sign in (nginx)"
+// @Failure 403 "The user isn't allowed to access the application"
+// @Router /api/forward-auth/{clientId} [get]
+func (h *handler) authorize(c *gin.Context) {
+	originalURL, isNginx, err := originalRequestURL(c.Request)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	clientID := c.Param("clientId")
+	if originalURL.Path == CallbackPath {
+		h.callback(c, clientID, originalURL, isNginx)
+		return
+	}
+
+	token, _ := c.Cookie(cookieName)
+	identity, err := h.service.authorize(c.Request.Context(), clientID, token, splitList(c.Query("claims")))
+	if errors.Is(err, errNotSignedIn) {
+		h.startSignIn(c, clientID, originalURL, isNginx)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user := identity.User
+	groups := make([]string, len(user.UserGroups))
+	for i, group := range user.UserGroups {
+		groups[i] = group.Name
+	}
+
+	c.Header(headerUser, user.Username)
+	if user.Email != nil {
+		c.Header(headerEmail, *user.Email)
+	}
+	c.Header(headerName, cmp.Or(user.DisplayName, user.FullName()))
+	c.Header(headerGroups, strings.Join(groups, ","))
+	for key, value := range identity.Claims {
+		c.Header(headerClaimPrefix+key, value)
+	}
+	c.Status(http.StatusOK)
+}
+
+// callback exchanges the code of a sign in for the cookie on the host of the application and returns to the original URL
+func (h *handler) callback(c *gin.Context, clientID string, callbackURL *url.URL, isNginx bool) {
+	query := callbackURL.Query()
+	returnURL := sameOriginURL(callbackURL, query.Get("rd"))
+
+	state, _ := c.Cookie(stateCookieName)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		// The sign in didn't start in this browser, so it starts over instead of using a code that may be someone else's
+		h.startSignIn(c, clientID, returnURL, isNginx)
+		return
+	}
+
+	token, expiresAt, err := h.service.exchangeCode(c.Request.Context(), clientID, query.Get("code"))
+	if errors.Is(err, errInvalidCode) {
+		// The sign in starts over if the code was already used, e.g. because the user reloaded the callback
+		h.startSignIn(c, clientID, returnURL, isNginx)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     stateCookieName,
+		Path:     CallbackPath,
+		MaxAge:   -1,
+		Secure:   callbackURL.Scheme == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   callbackURL.Scheme == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	h.redirect(c, returnURL.String(), isNginx)
+}
+
+// startSignIn redirects to the sign in with a new state, which is stored in a cookie for the callback on the host of the
+// application
+func (h *handler) startSignIn(c *gin.Context, clientID string, returnURL *url.URL, isNginx bool) {
+	state, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state,
+		Path:     CallbackPath,
+		MaxAge:   int(stateLifetime.Seconds()),
+		Secure:   returnURL.Scheme == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	h.redirect(c, h.service.loginURL(clientID, returnURL, state), isNginx)
+}
+
+// login godoc
+// @Summary Sign in to an application behind a reverse proxy
+// @Description Sign the user in to the application and redirect to the callback on the host of the original URL, which sets the cookie of the application. The callback URL on that host must be registered as callback URL of the client.
+// @Tags Forward Auth
+// @Param clientId path string true "Client ID of the application"
+// @Param rd query string true "Original URL to return to"
+// @Param state query string true "State of the sign in, which is passed on to the callback"
+// @Success 302 "Redirect to the callback of the application"
+// @Router /api/forward-auth/{clientId}/login [get]
+func (h *handler) login(c *gin.Context) {
+	client, err := h.service.getClient(c.Request.Context(), c.Param("clientId"))
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	returnURL := c.Query("rd")
+	callbackURL, err := h.service.callbackURL(client, returnURL)
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	if c.GetString("userID") == "" {
+		c.Redirect(http.StatusFound, "/login?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+
+	code, err := h.service.createCode(c.Request.Context(), client, signIn{
+		UserID:    c.GetString("userID"),
+		SessionID: c.GetString("sessionID"),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, callbackURL+"?"+url.Values{"code": {code}, "rd": {returnURL}, "state": {c.Query("state")}}.Encode())
+}
+
+func (h *handler) redirect(c *gin.Context, location string, isNginx bool) {
+	if isNginx {
+		c.Header("Location", location)
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	c.Redirect(http.StatusFound, location)
+}
+
+// redirectToErrorPage shows errors the user can understand on the error page and handles all other errors as usual
+func (h *handler) redirectToErrorPage(c *gin.Context, err error) {
+	var message string
+	if validationErr, ok := errors.AsType[*common.ValidationError](err); ok {
+		message = validationErr.Message
+	} else if _, ok := errors.AsType[*common.OidcInvalidCallbackURLError](err); ok {
+		message = err.Error()
+	} else if _, ok := errors.AsType[*common.OidcAccessDeniedError](err); ok {
+		message = err.Error()
+	} else {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/interaction/error?error="+url.QueryEscape(message))
+}
+
+// originalRequestURL returns the URL of the request the reverse proxy authorizes, and whether it came from nginx
+func originalRequestURL(r *http.Request) (*url.URL, bool, error) {
+	if rawURL := r.Header.Get("X-Original-URL"); rawURL != "" {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Host == "" {
+			return nil, false, &common.ValidationError{Message: "X-Original-URL must be an absolute URL"}
+		}
+		return parsed, true, nil
+	}
+
+	// The headers may contain a list if several proxies forwarded the request, with the original value first
+	host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return nil, false, &common.ValidationError{Message: "the reverse proxy must pass the original URL in the X-Forwarded-Host and X-Forwarded-Uri headers or in the X-Original-URL header"}
+	}
+
+	parsed, err := url.Parse(cmp.Or(strings.TrimSpace(proto), "https") + "://" + host + cmp.Or(r.Header.Get("X-Forwarded-Uri"), "/"))
+	if err != nil {
+		return nil, false, &common.ValidationError{Message: "the original URL is invalid"}
+	}
+	return parsed, false, nil
+}
+
+// sameOriginURL returns the URL to return to after the sign in, which must have the same origin as the callback
+func sameOriginURL(callbackURL *url.URL, returnURL string) *url.URL {
+	parsed, err := url.Parse(returnURL)
+	if err == nil && parsed.Scheme == callbackURL.Scheme && parsed.Host == callbackURL.Host {
+		return parsed
+	}
+	return &url.URL{Scheme: callbackURL.Scheme, Host: callbackURL.Host, Path: "/"}
+}
+
+func splitList(list string) []string {
+	var values []string
+	for value := range strings.SplitSeq(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
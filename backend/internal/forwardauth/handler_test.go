@@ -0,0 +1,273 @@
+package forwardauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+type testSessions struct {
+	signedOut map[string]bool
+}
+
+func (s *testSessions) ValidateSession(_ context.Context, sessionID, _ string) error {
+	if s.signedOut[sessionID] {
+		return errors.New("signed out")
+	}
+	return nil
+}
+
+type testCustomClaims struct{}
+
+func (testCustomClaims) GetCustomClaimsForUserWithUserGroups(_ context.Context, _ string, _ *gorm.DB) ([]model.CustomClaim, error) {
+	return []model.CustomClaim{{Key: "department", Value: "Engineering"}, {Key: "team", Value: "Identity"}}, nil
+}
+
+type testAuditLog struct {
+	events []model.AuditLogEvent
+}
+
+func (a *testAuditLog) Create(_ context.Context, event model.AuditLogEvent, _, _, userID string, data model.AuditLogData, _ *gorm.DB) (model.AuditLog, bool) {
+	a.events = append(a.events, event)
+	return model.AuditLog{Event: event, UserID: userID, Data: data}, true
+}
+
+// newTestRouter returns a router with the forward-auth routes, which is signed in as the user of the signedInAs header
+func newTestRouter(t *testing.T, db *gorm.DB, sessions SessionValidator, auditLog AuditLogger) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) > 0 {
+			c.Status(http.StatusInternalServerError)
+			if errors.Is(c.Errors.Last().Err, errAccessDenied) {
+				c.Status(http.StatusForbidden)
+			}
+		}
+	})
+
+	module := New(Dependencies{
+		DB:           db,
+		AppURL:       "https://id.example.com",
+		Sessions:     sessions,
+		CustomClaims: testCustomClaims{},
+		AuditLog:     auditLog,
+	})
+	optionalBrowserAuth := func(c *gin.Context) {
+		if userID := c.GetHeader("signedInAs"); userID != "" {
+			c.Set("userID", userID)
+			c.Set("sessionID", "session-"+userID)
+		}
+	}
+	module.RegisterRoutes(r.Group("/api"), optionalBrowserAuth)
+	return r
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// forwardAuthRequest returns the request Traefik and Caddy send to authorize a request to the original URL
+func forwardAuthRequest(originalURL string, cookies ...*http.Cookie) *http.Request {
+	parsed, _ := url.Parse(originalURL)
+	req := httptest.NewRequest(http.MethodGet, "/api/forward-auth/app?claims=department,unknown", nil)
+	req.Header.Set("X-Forwarded-Proto", parsed.Scheme)
+	req.Header.Set("X-Forwarded-Host", parsed.Host)
+	req.Header.Set("X-Forwarded-Uri", parsed.RequestURI())
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestForwardAuth(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	sessions := &testSessions{signedOut: map[string]bool{}}
+	auditLog := &testAuditLog{}
+	r := newTestRouter(t, db, sessions, auditLog)
+
+	aliceEmail := "alice@example.com"
+	users := []model.User{
+		{Base: model.Base{ID: "alice"}, Username: "alice", Email: &aliceEmail, FirstName: "Alice", LastName: "Liddell"},
+		{Base: model.Base{ID: "bob"}, Username: "bob", FirstName: "Bob"},
+	}
+	require.NoError(t, db.Create(&users).Error)
+	group := model.UserGroup{Base: model.Base{ID: "staff"}, Name: "staff", FriendlyName: "Staff", Users: []model.User{users[0]}}
+	require.NoError(t, db.Create(&group).Error)
+	for _, user := range users {
+		require.NoError(t, db.Create(&model.UserSession{
+			Base:       model.Base{ID: "session-" + user.ID},
+			UserID:     user.ID,
+			LastSeenAt: datatype.DateTime(time.Now()),
+			ExpiresAt:  datatype.DateTime(time.Now().Add(time.Hour)),
+		}).Error)
+	}
+	client := model.OidcClient{
+		Base:              model.Base{ID: "app"},
+		Name:              "App",
+		CallbackURLs:      model.UrlList{"https://app.example.com/_pocket-id/callback"},
+		IsGroupRestricted: true,
+		AllowedUserGroups: []model.UserGroup{group},
+	}
+	require.NoError(t, db.Create(&client).Error)
+
+	// signIn follows the redirects of the sign in from the original URL back to it and returns the cookie
+	signIn := func(t *testing.T, userID, originalURL string) *http.Cookie {
+		t.Helper()
+
+		rec := serve(r, forwardAuthRequest(originalURL))
+		require.Equal(t, http.StatusFound, rec.Code)
+		loginURL, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "id.example.com", loginURL.Host)
+		require.Equal(t, originalURL, loginURL.Query().Get("rd"))
+		stateCookie := findCookie(t, rec, stateCookieName)
+		require.Equal(t, stateCookie.Value, loginURL.Query().Get("state"))
+		require.Equal(t, "/_pocket-id/callback", stateCookie.Path)
+
+		req := httptest.NewRequest(http.MethodGet, loginURL.RequestURI(), nil)
+		req.Header.Set("signedInAs", userID)
+		rec = serve(r, req)
+		require.Equal(t, http.StatusFound, rec.Code)
+		callbackURL := rec.Header().Get("Location")
+		require.Regexp(t, `^https://app\.example\.com/_pocket-id/callback\?code=`, callbackURL)
+
+		rec = serve(r, forwardAuthRequest(callbackURL, stateCookie))
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Equal(t, originalURL, rec.Header().Get("Location"))
+		cookie := findCookie(t, rec, cookieName)
+		require.True(t, cookie.Secure)
+		require.True(t, cookie.HttpOnly)
+		require.Negative(t, findCookie(t, rec, stateCookieName).MaxAge, "the state must be removed after the sign in")
+
+		// The code can only be redeemed once
+		rec = serve(r, forwardAuthRequest(callbackURL, stateCookie))
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Contains(t, rec.Header().Get("Location"), "https://id.example.com/api/forward-auth/app/login")
+
+		return cookie
+	}
+
+	t.Run("signed in user gets the identity headers", func(t *testing.T) {
+		cookie := signIn(t, "alice", "https://app.example.com/wiki?page=1")
+
+		rec := serve(r, forwardAuthRequest("https://app.example.com/other", cookie))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "alice", rec.Header().Get("Remote-User"))
+		require.Equal(t, "alice@example.com", rec.Header().Get("Remote-Email"))
+		require.Equal(t, "Alice Liddell", rec.Header().Get("Remote-Name"))
+		require.Equal(t, "staff", rec.Header().Get("Remote-Groups"))
+		require.Equal(t, "Engineering", rec.Header().Get("Remote-Claim-Department"))
+		require.Empty(t, rec.Header().Get("Remote-Claim-Team"))
+		require.Equal(t, []model.AuditLogEvent{model.AuditLogEventForwardAuthAuthorization}, auditLog.events)
+
+		// The cookie only grants access to the application it was issued for
+		other := model.OidcClient{Base: model.Base{ID: "other"}, Name: "Other"}
+		require.NoError(t, db.Create(&other).Error)
+		req := forwardAuthRequest("https://app.example.com/", cookie)
+		req.URL.Path = "/api/forward-auth/other"
+		rec = serve(r, req)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		// Signing out of Pocket ID signs the user out of the application
+		sessions.signedOut["session-alice"] = true
+		t.Cleanup(func() { delete(sessions.signedOut, "session-alice") })
+		rec = serve(r, forwardAuthRequest("https://app.example.com/", cookie))
+		require.Equal(t, http.StatusFound, rec.Code)
+	})
+
+	t.Run("group restriction is enforced", func(t *testing.T) {
+		rec := serve(r, forwardAuthRequest("https://app.example.com/"))
+		loginURL, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, loginURL.RequestURI(), nil)
+		req.Header.Set("signedInAs", "bob")
+		rec = serve(r, req)
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Regexp(t, `^/interaction/error\?error=`, rec.Header().Get("Location"))
+
+		// Users that were removed from the allowed groups lose access immediately
+		cookie := signIn(t, "alice", "https://app.example.com/")
+		require.NoError(t, db.Model(&group).Association("Users").Clear())
+		rec = serve(r, forwardAuthRequest("https://app.example.com/", cookie))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("sign in only returns to registered hosts", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/forward-auth/app/login?rd="+url.QueryEscape("https://evil.example.com/"), nil)
+		req.Header.Set("signedInAs", "alice")
+		rec := serve(r, req)
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Regexp(t, `^/interaction/error\?error=`, rec.Header().Get("Location"))
+	})
+
+	t.Run("callback only accepts the code in the browser that started the sign in", func(t *testing.T) {
+		require.NoError(t, db.Model(&group).Association("Users").Append(&users[0]))
+
+		// Someone else starts a sign in and sends the user the link to the callback with their code
+		rec := serve(r, forwardAuthRequest("https://app.example.com/"))
+		loginURL, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, loginURL.RequestURI(), nil)
+		req.Header.Set("signedInAs", "alice")
+		callbackURL := serve(r, req).Header().Get("Location")
+		require.Regexp(t, `^https://app\.example\.com/_pocket-id/callback\?code=`, callbackURL)
+
+		for _, cookies := range [][]*http.Cookie{nil, {{Name: stateCookieName, Value: "other"}}} {
+			rec = serve(r, forwardAuthRequest(callbackURL, cookies...))
+			require.Equal(t, http.StatusFound, rec.Code)
+			require.Contains(t, rec.Header().Get("Location"), "https://id.example.com/api/forward-auth/app/login")
+			for _, cookie := range rec.Result().Cookies() {
+				require.NotEqual(t, cookieName, cookie.Name, "the user must not be signed in")
+			}
+		}
+	})
+
+	t.Run("nginx gets a 401 response with the location", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/forward-auth/app", nil)
+		req.Header.Set("X-Original-URL", "https://app.example.com/wiki")
+		rec := serve(r, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		state := findCookie(t, rec, stateCookieName).Value
+		require.Equal(t, "https://id.example.com/api/forward-auth/app/login?rd="+url.QueryEscape("https://app.example.com/wiki")+"&state="+state, rec.Header().Get("Location"))
+	})
+}
+
+func findCookie(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	require.Failf(t, "cookie not found", "the response doesn't set the cookie %s", name)
+	return nil
+}
+
+func TestSameOriginURL(t *testing.T) {
+	callbackURL, err := url.Parse("https://app.example.com/_pocket-id/callback")
+	require.NoError(t, err)
+
+	require.Equal(t, "https://app.example.com/wiki?page=1", sameOriginURL(callbackURL, "https://app.example.com/wiki?page=1").String())
+	require.Equal(t, "https://app.example.com/", sameOriginURL(callbackURL, "https://evil.example.com/").String())
+	require.Equal(t, "https://app.example.com/", sameOriginURL(callbackURL, "//evil.example.com").String())
+	require.Equal(t, "https://app.example.com/", sameOriginURL(callbackURL, "").String())
+}
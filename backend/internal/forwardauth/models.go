@@ -0,0 +1,25 @@
+package forwardauth
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+// Session signs a user in to an application behind a reverse proxy for as long as the user's browser session lasts
+// It starts with a short-lived code, which the callback on the application's host exchanges for the token of the cookie
+type Session struct {
+	model.Base
+
+	CodeHash      *string
+	TokenHash     *string
+	CodeExpiresAt *datatype.DateTime
+	ExpiresAt     datatype.DateTime
+
+	ClientID      string
+	UserID        string
+	UserSessionID string
+}
+
+func (Session) TableName() string {
+	return "forward_auth_sessions"
+}
@@ -0,0 +1,49 @@
+package forwardauth
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// SessionValidator checks that the browser session a user signed in to an application with hasn't been signed out
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, sessionID, userID string) error
+}
+
+type CustomClaimSource interface {
+	GetCustomClaimsForUserWithUserGroups(ctx context.Context, userID string, tx *gorm.DB) ([]model.CustomClaim, error)
+}
+
+type AuditLogger interface {
+	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
+}
+
+type Dependencies struct {
+	DB     *gorm.DB
+	AppURL string
+
+	Sessions     SessionValidator
+	CustomClaims CustomClaimSource
+	AuditLog     AuditLogger
+}
+
+type Module struct {
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	return &Module{
+		handler: newHandler(newService(deps)),
+	}
+}
+
+// RegisterRoutes mounts the endpoint reverse proxies authorize requests with and the endpoint that signs users in to
+// the applications behind them
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, optionalBrowserAuth gin.HandlerFunc) {
+	apiGroup.Any("/forward-auth/:clientId", m.handler.authorize)
+	apiGroup.GET("/forward-auth/:clientId/login", optionalBrowserAuth, m.handler.login)
+}
@@ -0,0 +1,306 @@
+package forwardauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+const (
+	// CallbackPath is the path on the host of a protected application that completes the sign in
+	// Admins register the URL with this path on the application's host as callback URL of the client
+	CallbackPath = "/_pocket-id/callback"
+
+	codeLifetime = time.Minute
+	// stateLifetime limits how long the user may take to sign in
+	stateLifetime = 10 * time.Minute
+)
+
+// claimHeaderRegex matches the custom claim keys that can be forwarded as header
+var claimHeaderRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var (
+	errNotSignedIn  = errors.New("not signed in to the application")
+	errInvalidCode  = errors.New("invalid or expired code")
+	errAccessDenied = &common.OidcAccessDeniedError{}
+)
+
+// identity is the user a request to a protected application is made by
+type identity struct {
+	User   model.User
+	Claims map[string]string
+}
+
+type signIn struct {
+	UserID    string
+	SessionID string
+	IPAddress string
+	UserAgent string
+}
+
+type Service struct {
+	db     *gorm.DB
+	appURL string
+
+	sessions     SessionValidator
+	customClaims CustomClaimSource
+	auditLog     AuditLogger
+}
+
+func newService(deps Dependencies) *Service {
+	return &Service{
+		db:           deps.DB,
+		appURL:       deps.AppURL,
+		sessions:     deps.Sessions,
+		customClaims: deps.CustomClaims,
+		auditLog:     deps.AuditLog,
+	}
+}
+
+func (s *Service) getClient(ctx context.Context, clientID string) (model.OidcClient, error) {
+	var client model.OidcClient
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		First(&client, "id = ?", clientID).
+		Error
+	return client, err
+}
+
+// loginURL returns the URL that signs the user in to the application and then returns to the original URL
+func (s *Service) loginURL(clientID string, originalURL *url.URL, state string) string {
+	return s.appURL + "/api/forward-auth/" + url.PathEscape(clientID) + "/login?" + url.Values{"rd": {originalURL.String()}, "state": {state}}.Encode()
+}
+
+// callbackURL returns the callback URL on the host of the URL the user returns to after signing in, which must be
+// registered as callback URL of the client so that users can't be sent to arbitrary hosts
+func (s *Service) callbackURL(client model.OidcClient, returnURL string) (string, error) {
+	parsed, err := url.Parse(returnURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", &common.OidcInvalidCallbackURLError{}
+	}
+
+	callbackURL := parsed.Scheme + "://" + parsed.Host + CallbackPath
+	matched, err := utils.GetCallbackURLFromList(client.CallbackURLs, callbackURL)
+	if err != nil {
+		return "", err
+	}
+	if matched == "" {
+		return "", &common.OidcInvalidCallbackURLError{}
+	}
+
+	return callbackURL, nil
+}
+
+// createCode signs the user in to the application and returns the code that the callback exchanges for the token
+func (s *Service) createCode(ctx context.Context, client model.OidcClient, signIn signIn) (string, error) {
+	var user model.User
+	err := s.db.
+		WithContext(ctx).
+		Preload("UserGroups").
+		First(&user, "id = ?", signIn.UserID).
+		Error
+	if err != nil {
+		return "", err
+	}
+	if !isUserGroupAllowed(user, client) {
+		return "", errAccessDenied
+	}
+
+	var userSession model.UserSession
+	err = s.db.
+		WithContext(ctx).
+		First(&userSession, "id = ? AND user_id = ?", signIn.SessionID, user.ID).
+		Error
+	if err != nil {
+		return "", err
+	}
+
+	code, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&Session{
+			CodeHash:      new(utils.CreateSha256Hash(code)),
+			CodeExpiresAt: new(datatype.DateTime(time.Now().Add(codeLifetime))),
+			ExpiresAt:     userSession.ExpiresAt,
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			UserSessionID: userSession.ID,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to create forward auth session: %w", err)
+		}
+
+		s.auditLog.Create(ctx, model.AuditLogEventForwardAuthAuthorization, signIn.IPAddress, signIn.UserAgent, user.ID, model.AuditLogData{"clientName": client.Name}, tx)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// exchangeCode redeems the code of a sign in and returns the token of the cookie and when it expires
+func (s *Service) exchangeCode(ctx context.Context, clientID, code string) (string, time.Time, error) {
+	token, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var session Session
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			First(&session, "code_hash = ? AND client_id = ? AND code_expires_at > ?", utils.CreateSha256Hash(code), clientID, datatype.DateTime(time.Now())).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidCode
+		}
+		if err != nil {
+			return err
+		}
+
+		// The code can only be redeemed once
+		result := tx.
+			Model(&Session{}).
+			Where("id = ? AND code_hash IS NOT NULL", session.ID).
+			Updates(map[string]any{
+				"code_hash":       nil,
+				"code_expires_at": nil,
+				"token_hash":      utils.CreateSha256Hash(token),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidCode
+		}
+		return nil
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, session.ExpiresAt.ToTime(), nil
+}
+
+// authorize resolves the identity of a request with the token of the cookie
+// It returns errNotSignedIn if the user has to sign in again, and errAccessDenied if the user may not use the application
+func (s *Service) authorize(ctx context.Context, clientID, token string, claimKeys []string) (identity, error) {
+	if token == "" {
+		return identity{}, errNotSignedIn
+	}
+
+	var session Session
+	err := s.db.
+		WithContext(ctx).
+		First(&session, "token_hash = ? AND client_id = ? AND expires_at > ?", utils.CreateSha256Hash(token), clientID, datatype.DateTime(time.Now())).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return identity{}, errNotSignedIn
+	}
+	if err != nil {
+		return identity{}, err
+	}
+
+	// Signing out of Pocket ID also signs the user out of the application
+	if err := s.sessions.ValidateSession(ctx, session.UserSessionID, session.UserID); err != nil {
+		return identity{}, errNotSignedIn
+	}
+
+	var user model.User
+	err = s.db.
+		WithContext(ctx).
+		Preload("UserGroups").
+		First(&user, "id = ?", session.UserID).
+		Error
+	if err != nil {
+		return identity{}, err
+	}
+	if user.Disabled {
+		return identity{}, errNotSignedIn
+	}
+
+	// The groups are checked on every request, so removing a user from a group revokes access immediately
+	client, err := s.getClient(ctx, clientID)
+	if err != nil {
+		return identity{}, err
+	}
+	if !isUserGroupAllowed(user, client) {
+		return identity{}, errAccessDenied
+	}
+
+	claims, err := s.claims(ctx, user.ID, claimKeys)
+	if err != nil {
+		return identity{}, err
+	}
+
+	return identity{User: user, Claims: claims}, nil
+}
+
+// claims returns the requested custom claims of the user, including the claims of the user's groups
+func (s *Service) claims(ctx context.Context, userID string, claimKeys []string) (map[string]string, error) {
+	if len(claimKeys) == 0 {
+		return nil, nil
+	}
+
+	customClaims, err := s.customClaims.GetCustomClaimsForUserWithUserGroups(ctx, userID, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]string, len(claimKeys))
+	for _, key := range claimKeys {
+		if !claimHeaderRegex.MatchString(key) {
+			continue
+		}
+		for _, claim := range customClaims {
+			if strings.EqualFold(claim.Key, key) {
+				claims[key] = claim.Value
+				break
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+func isUserGroupAllowed(user model.User, client model.OidcClient) bool {
+	if !client.IsGroupRestricted {
+		return true
+	}
+
+	for _, allowedGroup := range client.AllowedUserGroups {
+		for _, userGroup := range user.UserGroups {
+			if allowedGroup.ID == userGroup.ID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CleanupExpired deletes the sessions that expired and the codes that weren't redeemed in time
+func CleanupExpired(ctx context.Context, db *gorm.DB) (int64, error) {
+	now := datatype.DateTime(time.Now())
+	result := db.
+		WithContext(ctx).
+		Where("expires_at < ? OR (token_hash IS NULL AND code_expires_at < ?)", now, now).
+		Delete(&Session{})
+	return result.RowsAffected, result.Error
+}
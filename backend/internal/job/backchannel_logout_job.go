@@ -0,0 +1,26 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+
+	"github.com/pocket-id/pocket-id/backend/internal/oidc"
+	"github.com/pocket-id/pocket-id/backend/internal/service"
+)
+
+type BackchannelLogoutJobs struct {
+	backchannelLogout *oidc.BackchannelLogoutService
+}
+
+func (s *Scheduler) RegisterBackchannelLogoutJobs(ctx context.Context, backchannelLogout *oidc.BackchannelLogoutService) error {
+	jobs := &BackchannelLogoutJobs{backchannelLogout: backchannelLogout}
+
+	// Logout tokens are delivered right away, this job retries the deliveries that failed
+	return s.RegisterJob(ctx, "DeliverBackchannelLogouts", gocron.DurationJob(time.Minute), jobs.deliverBackchannelLogouts, service.RegisterJobOpts{RunImmediately: true})
+}
+
+func (j *BackchannelLogoutJobs) deliverBackchannelLogouts(ctx context.Context) error {
+	return j.backchannelLogout.DeliverPending(ctx)
+}
@@ -10,13 +10,17 @@ import (
 	backoff "github.com/cenkalti/backoff/v5"
 	"gorm.io/gorm"
 
+	"github.com/pocket-id/pocket-id/backend/internal/clientregistration"
 	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/forwardauth"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
 	"github.com/pocket-id/pocket-id/backend/internal/oidc"
+	"github.com/pocket-id/pocket-id/backend/internal/saml"
 	"github.com/pocket-id/pocket-id/backend/internal/service"
 	"github.com/pocket-id/pocket-id/backend/internal/usersignup"
 	"github.com/pocket-id/pocket-id/backend/internal/webauthn"
+	"github.com/pocket-id/pocket-id/backend/internal/webhook"
 )
 
 func (s *Scheduler) RegisterDbCleanupJobs(ctx context.Context, db *gorm.DB) error {
@@ -34,12 +38,19 @@ func (s *Scheduler) RegisterDbCleanupJobs(ctx context.Context, db *gorm.DB) erro
 	// Use exponential backoff for each DB cleanup job so transient query failures are retried automatically rather than causing an immediate job failure
 	return errors.Join(
 		s.RegisterJob(ctx, "ClearWebauthnSessions", jobDefWithJitter(24*time.Hour), jobs.clearWebauthnSessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearUserSessions", jobDefWithJitter(24*time.Hour), jobs.clearUserSessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearOneTimeAccessTokens", jobDefWithJitter(24*time.Hour), jobs.clearOneTimeAccessTokens, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearSignupTokens", jobDefWithJitter(24*time.Hour), jobs.clearSignupTokens, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearInitialAccessTokens", jobDefWithJitter(24*time.Hour), jobs.clearInitialAccessTokens, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearEmailVerificationTokens", jobDefWithJitter(24*time.Hour), jobs.clearEmailVerificationTokens, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearOAuth2Sessions", jobDefWithJitter(24*time.Hour), jobs.clearOAuth2Sessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearOAuth2JTIs", jobDefWithJitter(24*time.Hour), jobs.clearOAuth2JTIs, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearBackchannelLogouts", jobDefWithJitter(24*time.Hour), jobs.clearBackchannelLogouts, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearScimChanges", jobDefWithJitter(24*time.Hour), jobs.clearScimChanges, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearWebhookDeliveries", jobDefWithJitter(24*time.Hour), jobs.clearWebhookDeliveries, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearInteractionSessions", jobDefWithJitter(24*time.Hour), jobs.clearInteractionSessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearSamlSessions", jobDefWithJitter(24*time.Hour), jobs.clearSamlSessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
+		s.RegisterJob(ctx, "ClearForwardAuthSessions", jobDefWithJitter(24*time.Hour), jobs.clearForwardAuthSessions, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearReauthenticationTokens", jobDefWithJitter(24*time.Hour), jobs.clearReauthenticationTokens, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 		s.RegisterJob(ctx, "ClearAuditLogs", jobDefWithJitter(24*time.Hour), jobs.clearAuditLogs, service.RegisterJobOpts{RunImmediately: true, BackOff: newBackOff()}),
 	)
@@ -61,6 +72,18 @@ func (j *DbCleanupJobs) clearWebauthnSessions(ctx context.Context) error {
 	return nil
 }
 
+// clearUserSessions deletes browser sessions that have expired
+func (j *DbCleanupJobs) clearUserSessions(ctx context.Context) error {
+	count, err := service.CleanupExpiredUserSessions(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean expired user sessions: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned expired user sessions", slog.Int64("count", count))
+
+	return nil
+}
+
 // ClearOneTimeAccessTokens deletes one-time access tokens that have expired
 func (j *DbCleanupJobs) clearOneTimeAccessTokens(ctx context.Context) error {
 	st := j.db.
@@ -87,6 +110,18 @@ func (j *DbCleanupJobs) clearSignupTokens(ctx context.Context) error {
 	return nil
 }
 
+// clearInitialAccessTokens deletes initial access tokens for dynamic client registration that have expired
+func (j *DbCleanupJobs) clearInitialAccessTokens(ctx context.Context) error {
+	count, err := clientregistration.CleanupExpiredInitialAccessTokens(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean expired initial access tokens: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned expired initial access tokens", slog.Int64("count", count))
+
+	return nil
+}
+
 // clearOAuth2Sessions deletes expired and invalidated OAuth2 sessions.
 func (j *DbCleanupJobs) clearOAuth2Sessions(ctx context.Context) error {
 	count, err := oidc.CleanupExpiredOAuth2Sessions(ctx, j.db)
@@ -111,6 +146,42 @@ func (j *DbCleanupJobs) clearOAuth2JTIs(ctx context.Context) error {
 	return nil
 }
 
+// clearBackchannelLogouts deletes back-channel logouts that were delivered or failed a while ago.
+func (j *DbCleanupJobs) clearBackchannelLogouts(ctx context.Context) error {
+	count, err := oidc.CleanupBackchannelLogouts(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean back-channel logouts: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned back-channel logouts", slog.Int64("count", count))
+
+	return nil
+}
+
+// clearScimChanges deletes SCIM changes that couldn't be pushed a while ago.
+func (j *DbCleanupJobs) clearScimChanges(ctx context.Context) error {
+	count, err := service.CleanupFailedScimChanges(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean SCIM changes: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned SCIM changes", slog.Int64("count", count))
+
+	return nil
+}
+
+// clearWebhookDeliveries deletes webhook deliveries that were delivered or given up on a while ago.
+func (j *DbCleanupJobs) clearWebhookDeliveries(ctx context.Context) error {
+	count, err := webhook.CleanupDeliveries(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean webhook deliveries: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned webhook deliveries", slog.Int64("count", count))
+
+	return nil
+}
+
 // clearInteractionSessions deletes abandoned OIDC interaction sessions.
 func (j *DbCleanupJobs) clearInteractionSessions(ctx context.Context) error {
 	count, err := oidc.CleanupAbandonedInteractionSessions(ctx, j.db)
@@ -123,6 +194,30 @@ func (j *DbCleanupJobs) clearInteractionSessions(ctx context.Context) error {
 	return nil
 }
 
+// clearSamlSessions deletes expired SAML sessions and authentication requests that were never resumed.
+func (j *DbCleanupJobs) clearSamlSessions(ctx context.Context) error {
+	count, err := saml.CleanupExpired(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean SAML sessions: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned SAML sessions", slog.Int64("count", count))
+
+	return nil
+}
+
+// clearForwardAuthSessions deletes expired forward-auth sessions and sign-in codes that were never redeemed.
+func (j *DbCleanupJobs) clearForwardAuthSessions(ctx context.Context) error {
+	count, err := forwardauth.CleanupExpired(ctx, j.db)
+	if err != nil {
+		return fmt.Errorf("failed to clean forward auth sessions: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Cleaned forward auth sessions", slog.Int64("count", count))
+
+	return nil
+}
+
 // clearReauthenticationTokens deletes expired reauthentication tokens. What counts as
 // expired is owned by the webauthn module.
 func (j *DbCleanupJobs) clearReauthenticationTokens(ctx context.Context) error {
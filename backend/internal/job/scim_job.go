@@ -2,6 +2,7 @@ package job
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -16,8 +17,16 @@ type ScimJobs struct {
 func (s *Scheduler) RegisterScimJobs(ctx context.Context, scimService *service.ScimService) error {
 	jobs := &ScimJobs{scimService: scimService}
 
-	// Register the job to run every hour (with some jitter)
-	return s.RegisterJob(ctx, "SyncScim", gocron.DurationJob(time.Hour), jobs.SyncScim, service.RegisterJobOpts{RunImmediately: true})
+	return errors.Join(
+		// Changes are pushed right away, this job retries the changes that failed
+		s.RegisterJob(ctx, "DeliverScimChanges", gocron.DurationJob(time.Minute), jobs.DeliverScimChanges, service.RegisterJobOpts{RunImmediately: true}),
+		// The full sync runs every hour to reconcile changes that couldn't be pushed
+		s.RegisterJob(ctx, "SyncScim", gocron.DurationJob(time.Hour), jobs.SyncScim, service.RegisterJobOpts{RunImmediately: true}),
+	)
+}
+
+func (j *ScimJobs) DeliverScimChanges(ctx context.Context) error {
+	return j.scimService.DeliverPending(ctx)
 }
 
 func (j *ScimJobs) SyncScim(ctx context.Context) error {
@@ -0,0 +1,24 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/pocket-id/pocket-id/backend/internal/service"
+)
+
+type SigningKeyRotationJobs struct {
+	jwtService *service.JwtService
+}
+
+func (s *Scheduler) RegisterSigningKeyRotationJobs(ctx context.Context, jwtService *service.JwtService) error {
+	jobs := &SigningKeyRotationJobs{jwtService: jwtService}
+
+	// Register the job to run every hour (with some jitter)
+	// The job also runs when automatic rotation is disabled, to publish keys rotated with the key-rotate command and remove expired ones
+	return s.RegisterJob(ctx, "RotateSigningKeys", jobDefWithJitter(time.Hour), jobs.rotateSigningKeys, service.RegisterJobOpts{RunImmediately: true})
+}
+
+func (j *SigningKeyRotationJobs) rotateSigningKeys(ctx context.Context) error {
+	return j.jwtService.RotateKeys(ctx)
+}
@@ -0,0 +1,26 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+
+	"github.com/pocket-id/pocket-id/backend/internal/service"
+	"github.com/pocket-id/pocket-id/backend/internal/webhook"
+)
+
+type WebhookJobs struct {
+	webhooks *webhook.Module
+}
+
+func (s *Scheduler) RegisterWebhookJobs(ctx context.Context, webhooks *webhook.Module) error {
+	jobs := &WebhookJobs{webhooks: webhooks}
+
+	// Events are delivered right away, this job retries the deliveries that failed
+	return s.RegisterJob(ctx, "DeliverWebhooks", gocron.DurationJob(time.Minute), jobs.deliverWebhooks, service.RegisterJobOpts{RunImmediately: true})
+}
+
+func (j *WebhookJobs) deliverWebhooks(ctx context.Context) error {
+	return j.webhooks.DeliverPending(ctx)
+}
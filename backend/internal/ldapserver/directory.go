@@ -0,0 +1,267 @@
+package ldapserver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+const (
+	scopeBaseObject   = 0
+	scopeSingleLevel  = 1
+	scopeWholeSubtree = 2
+)
+
+const (
+	extensionStartTLS = "1.3.6.1.4.1.1466.20037"
+	extensionWhoAmI   = "1.3.6.1.4.1.4203.1.11.3"
+)
+
+// customClaimAttributeRegex matches the custom claim keys that are valid attribute descriptions (RFC 4512 section 1.4)
+var customClaimAttributeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*$`)
+
+// entry is an entry of the directory tree
+type entry struct {
+	dn         *ldap.DN
+	attributes []attribute
+}
+
+type attribute struct {
+	name   string
+	values []string
+}
+
+func newEntry(dn *ldap.DN) *entry {
+	return &entry{dn: dn}
+}
+
+// add adds the non-empty values to the attribute, which is created if the entry doesn't have it yet
+func (e *entry) add(name string, values ...string) {
+	values = slices.DeleteFunc(values, func(v string) bool { return v == "" })
+	if len(values) == 0 {
+		return
+	}
+
+	if a := e.attribute(name); a != nil {
+		a.values = append(a.values, values...)
+		return
+	}
+	e.attributes = append(e.attributes, attribute{name: name, values: values})
+}
+
+// attribute returns the attribute with the given name, which is compared case-insensitively
+func (e *entry) attribute(name string) *attribute {
+	for i := range e.attributes {
+		if strings.EqualFold(e.attributes[i].name, name) {
+			return &e.attributes[i]
+		}
+	}
+	return nil
+}
+
+// selectAttributes returns the attributes a search requested (RFC 4511 section 4.5.1.8)
+func (e *entry) selectAttributes(requested []string) []attribute {
+	if len(requested) == 0 || slices.Contains(requested, "*") {
+		return e.attributes
+	}
+
+	selected := make([]attribute, 0, len(requested))
+	for _, a := range e.attributes {
+		if slices.ContainsFunc(requested, func(name string) bool { return strings.EqualFold(name, a.name) }) {
+			selected = append(selected, a)
+		}
+	}
+	return selected
+}
+
+// rootDSE returns the root DSE, which describes the server to clients (RFC 4512 section 5.1)
+func (s *Service) rootDSE(startTLS bool) *entry {
+	e := newEntry(&ldap.DN{})
+	e.add("objectClass", "top")
+	e.add("namingContexts", s.baseDN.String())
+	e.add("supportedLDAPVersion", "3")
+	e.add("supportedExtension", extensionWhoAmI)
+	if startTLS {
+		e.add("supportedExtension", extensionStartTLS)
+	}
+	e.add("supportedControl", ldap.ControlTypePaging)
+	e.add("vendorName", "Pocket ID")
+	return e
+}
+
+// search returns the entries visible to the principal that are in the scope of the base DN and match the filter
+func (s *Service) search(ctx context.Context, p *principal, baseDN string, scope int64, filter *ber.Packet) ([]*entry, error) {
+	base, err := ldap.ParseDN(baseDN)
+	if err != nil {
+		return nil, ldap.NewError(ldap.LDAPResultInvalidDNSyntax, err)
+	}
+	if scope != scopeBaseObject && scope != scopeSingleLevel && scope != scopeWholeSubtree {
+		return nil, ldap.NewError(ldap.LDAPResultProtocolError, errors.New("invalid scope"))
+	}
+
+	entries, err := s.directory(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(entries, func(e *entry) bool { return e.dn.EqualFold(base) }) {
+		return nil, &ldap.Error{
+			ResultCode: ldap.LDAPResultNoSuchObject,
+			Err:        errors.New("the base object doesn't exist"),
+			MatchedDN:  s.matchedDN(entries, base),
+		}
+	}
+
+	var results []*entry
+	for _, e := range entries {
+		inScope := false
+		switch scope {
+		case scopeBaseObject:
+			inScope = e.dn.EqualFold(base)
+		case scopeSingleLevel:
+			inScope = len(e.dn.RDNs) == len(base.RDNs)+1 && base.AncestorOfFold(e.dn)
+		case scopeWholeSubtree:
+			inScope = e.dn.EqualFold(base) || base.AncestorOfFold(e.dn)
+		}
+		if !inScope {
+			continue
+		}
+
+		matches, err := matchFilter(filter, e)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			results = append(results, e)
+		}
+	}
+
+	return results, nil
+}
+
+// matchedDN returns the DN of the closest existing ancestor of a base object that doesn't exist
+func (s *Service) matchedDN(entries []*entry, base *ldap.DN) string {
+	for i := 1; i < len(base.RDNs); i++ {
+		ancestor := &ldap.DN{RDNs: base.RDNs[i:]}
+		if slices.ContainsFunc(entries, func(e *entry) bool { return e.dn.EqualFold(ancestor) }) {
+			return ancestor.String()
+		}
+	}
+	return ""
+}
+
+// directory builds the directory tree visible to the principal
+// Disabled users are left out, and a principal restricted to user groups only sees these groups and their members
+func (s *Service) directory(ctx context.Context, p *principal) ([]*entry, error) {
+	groupsQuery := s.db.
+		WithContext(ctx).
+		Preload("CustomClaims").
+		Order("name")
+	usersQuery := s.db.
+		WithContext(ctx).
+		Preload("CustomClaims").
+		Preload("UserGroups.CustomClaims").
+		Where("disabled = ?", false).
+		Order("username")
+	if p.allowedUserGroupIDs != nil {
+		groupsQuery = groupsQuery.Where("id IN ?", p.allowedUserGroupIDs)
+		usersQuery = usersQuery.Where("id IN (?)", s.db.
+			Table("user_groups_users").
+			Select("user_id").
+			Where("user_group_id IN ?", p.allowedUserGroupIDs))
+	}
+
+	var groups []model.UserGroup
+	if err := groupsQuery.Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	var users []model.User
+	if err := usersQuery.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	entries := []*entry{s.baseEntry(), organizationalUnit(s.usersDN), organizationalUnit(s.groupsDN)}
+
+	groupEntries := make(map[string]*entry, len(groups))
+	for _, group := range groups {
+		e := newEntry(s.groupDN(group.Name))
+		e.add("objectClass", "top", "groupOfNames")
+		e.add("cn", group.Name)
+		e.add("description", group.FriendlyName)
+		e.add("entryUUID", group.ID)
+		addCustomClaims(e, group.CustomClaims)
+		groupEntries[group.ID] = e
+	}
+
+	for _, user := range users {
+		e := newEntry(s.userDN(user.Username))
+		e.add("objectClass", "top", "person", "organizationalPerson", "inetOrgPerson")
+		e.add("uid", user.Username)
+		e.add("cn", cmp.Or(user.DisplayName, user.FullName(), user.Username))
+		e.add("sn", cmp.Or(user.LastName, user.Username))
+		e.add("givenName", user.FirstName)
+		e.add("displayName", user.DisplayName)
+		if user.Email != nil {
+			e.add("mail", *user.Email)
+		}
+		e.add("entryUUID", user.ID)
+
+		// Claims of the user take precedence over claims of the groups the user is a member of
+		claims := slices.Clone(user.CustomClaims)
+		for _, group := range user.UserGroups {
+			claims = append(claims, group.CustomClaims...)
+
+			if groupEntry, ok := groupEntries[group.ID]; ok {
+				e.add("memberOf", groupEntry.dn.String())
+				groupEntry.add("member", e.dn.String())
+			}
+		}
+		addCustomClaims(e, claims)
+
+		entries = append(entries, e)
+	}
+
+	for _, group := range groups {
+		entries = append(entries, groupEntries[group.ID])
+	}
+
+	return entries, nil
+}
+
+func (s *Service) baseEntry() *entry {
+	e := newEntry(s.baseDN)
+	rdn := s.baseDN.RDNs[0].Attributes[0]
+	if strings.EqualFold(rdn.Type, "dc") {
+		e.add("objectClass", "top", "domain")
+	} else {
+		e.add("objectClass", "top", "organization")
+	}
+	e.add(rdn.Type, rdn.Value)
+	return e
+}
+
+func organizationalUnit(dn *ldap.DN) *entry {
+	e := newEntry(dn)
+	e.add("objectClass", "top", "organizationalUnit")
+	e.add("ou", dn.RDNs[0].Attributes[0].Value)
+	return e
+}
+
+// addCustomClaims adds the custom claims as attributes, skipping claims whose key isn't a valid attribute name or
+// which would override a built-in attribute or an earlier claim
+func addCustomClaims(e *entry, claims []model.CustomClaim) {
+	for _, claim := range claims {
+		if !customClaimAttributeRegex.MatchString(claim.Key) || e.attribute(claim.Key) != nil {
+			continue
+		}
+		e.add(claim.Key, claim.Value)
+	}
+}
@@ -0,0 +1,39 @@
+package ldapserver
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+type serviceAccountInputDto struct {
+	Name                string   `json:"name" binding:"required,max=64"`
+	Description         *string  `json:"description" binding:"omitempty,max=512"`
+	IsGroupRestricted   bool     `json:"isGroupRestricted"`
+	AllowedUserGroupIDs []string `json:"allowedUserGroupIds" binding:"dive,min=1"`
+}
+
+type serviceAccountDto struct {
+	ID                string                    `json:"id"`
+	Name              string                    `json:"name"`
+	Description       *string                   `json:"description"`
+	BindDN            string                    `json:"bindDn"`
+	LastUsedAt        *datatype.DateTime        `json:"lastUsedAt"`
+	IsGroupRestricted bool                      `json:"isGroupRestricted"`
+	AllowedUserGroups []dto.UserGroupMinimalDto `json:"allowedUserGroups"`
+	CreatedAt         datatype.DateTime         `json:"createdAt"`
+}
+
+// serviceAccountWithPasswordDto is returned when a password is generated, which is the only time it can be read
+type serviceAccountWithPasswordDto struct {
+	ServiceAccount serviceAccountDto `json:"serviceAccount"`
+	Password       string            `json:"password"`
+}
+
+type serverInfoDto struct {
+	Enabled   bool   `json:"enabled"`
+	BaseDN    string `json:"baseDn"`
+	UsersDN   string `json:"usersDn"`
+	GroupsDN  string `json:"groupsDn"`
+	LdapAddr  string `json:"ldapAddr,omitempty"`
+	LdapsAddr string `json:"ldapsAddr,omitempty"`
+}
@@ -0,0 +1,147 @@
+package ldapserver
+
+import (
+	"errors"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// maxFilterDepth limits the nesting of filters, which are evaluated recursively
+const maxFilterDepth = 32
+
+var errInvalidFilter = ldap.NewError(ldap.LDAPResultProtocolError, errors.New("invalid filter"))
+
+// matchFilter reports whether the entry matches the search filter (RFC 4511 section 4.5.1.7)
+// All values are compared case-insensitively, which is the matching rule of almost all attributes the directory serves
+func matchFilter(filter *ber.Packet, e *entry) (bool, error) {
+	return matchFilterAtDepth(filter, e, 0)
+}
+
+func matchFilterAtDepth(filter *ber.Packet, e *entry, depth int) (bool, error) {
+	if filter == nil || filter.ClassType != ber.ClassContext || depth > maxFilterDepth {
+		return false, errInvalidFilter
+	}
+
+	switch filter.Tag {
+	case ldap.FilterAnd, ldap.FilterOr:
+		// An empty AND filter is true and an empty OR filter is false (RFC 4526)
+		result := filter.Tag == ldap.FilterAnd
+		for _, child := range filter.Children {
+			matches, err := matchFilterAtDepth(child, e, depth+1)
+			if err != nil {
+				return false, err
+			}
+			if filter.Tag == ldap.FilterAnd {
+				result = result && matches
+			} else {
+				result = result || matches
+			}
+		}
+		return result, nil
+
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errInvalidFilter
+		}
+		matches, err := matchFilterAtDepth(filter.Children[0], e, depth+1)
+		return !matches, err
+
+	case ldap.FilterPresent:
+		return e.attribute(ber.DecodeString(filter.Data.Bytes())) != nil, nil
+
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(filter.Children) != 2 {
+			return false, errInvalidFilter
+		}
+		a := e.attribute(ber.DecodeString(filter.Children[0].Data.Bytes()))
+		if a == nil {
+			return false, nil
+		}
+		assertion := strings.ToLower(ber.DecodeString(filter.Children[1].Data.Bytes()))
+		for _, value := range a.values {
+			value = strings.ToLower(value)
+			switch {
+			case filter.Tag == ldap.FilterGreaterOrEqual && value >= assertion,
+				filter.Tag == ldap.FilterLessOrEqual && value <= assertion,
+				(filter.Tag == ldap.FilterEqualityMatch || filter.Tag == ldap.FilterApproxMatch) && value == assertion:
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errInvalidFilter
+		}
+		a := e.attribute(ber.DecodeString(filter.Children[0].Data.Bytes()))
+		if a == nil {
+			return false, nil
+		}
+		for _, value := range a.values {
+			matches, err := matchSubstrings(filter.Children[1].Children, strings.ToLower(value))
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case ldap.FilterExtensibleMatch:
+		// Matching rules aren't supported, but an extensible match without one is an equality match
+		var attributeType, value string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				return false, nil
+			case ldap.MatchingRuleAssertionType:
+				attributeType = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = ber.DecodeString(child.Data.Bytes())
+			}
+		}
+		a := e.attribute(attributeType)
+		if a == nil {
+			return false, nil
+		}
+		for _, v := range a.values {
+			if strings.EqualFold(v, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	default:
+		return false, errInvalidFilter
+	}
+}
+
+// matchSubstrings reports whether the lowercased value matches the initial, any and final substrings in order
+func matchSubstrings(substrings []*ber.Packet, value string) (bool, error) {
+	for i, substring := range substrings {
+		s := strings.ToLower(ber.DecodeString(substring.Data.Bytes()))
+		switch substring.Tag {
+		case ldap.FilterSubstringsInitial:
+			if i != 0 || !strings.HasPrefix(value, s) {
+				return false, nil
+			}
+			value = value[len(s):]
+		case ldap.FilterSubstringsAny:
+			index := strings.Index(value, s)
+			if index < 0 {
+				return false, nil
+			}
+			value = value[index+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if i != len(substrings)-1 || !strings.HasSuffix(value, s) {
+				return false, nil
+			}
+		default:
+			return false, errInvalidFilter
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,200 @@
+package ldapserver
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+type handler struct {
+	service *Service
+	addr    string
+	tlsAddr string
+}
+
+func newHandler(service *Service, addr, tlsAddr string) *handler {
+	return &handler{service: service, addr: addr, tlsAddr: tlsAddr}
+}
+
+// serverInfo godoc
+// @Summary Get LDAP server information
+// @Description Get the addresses and the directory tree layout of the read-only LDAP server
+// @Tags LDAP Server
+// @Success 200 {object} serverInfoDto
+// @Router /api/ldap-server [get]
+func (h *handler) serverInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, serverInfoDto{
+		Enabled:   h.addr != "" || h.tlsAddr != "",
+		BaseDN:    h.service.baseDN.String(),
+		UsersDN:   h.service.usersDN.String(),
+		GroupsDN:  h.service.groupsDN.String(),
+		LdapAddr:  h.addr,
+		LdapsAddr: h.tlsAddr,
+	})
+}
+
+// list godoc
+// @Summary List LDAP service accounts
+// @Description Get a paginated list of the service accounts LDAP clients bind with
+// @Tags LDAP Server
+// @Param search query string false "Search term to filter service accounts by name or description"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[serviceAccountDto]
+// @Router /api/ldap-server/service-accounts [get]
+func (h *handler) list(c *gin.Context) {
+	searchTerm := c.Query("search")
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	serviceAccounts, pagination, err := h.service.ListServiceAccounts(c.Request.Context(), searchTerm, listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	serviceAccountsDto := make([]serviceAccountDto, len(serviceAccounts))
+	for i, serviceAccount := range serviceAccounts {
+		serviceAccountsDto[i], err = h.toDto(serviceAccount)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[serviceAccountDto]{
+		Data:       serviceAccountsDto,
+		Pagination: pagination,
+	})
+}
+
+// get godoc
+// @Summary Get LDAP service account
+// @Description Get a service account by ID
+// @Tags LDAP Server
+// @Param id path string true "Service account ID"
+// @Success 200 {object} serviceAccountDto
+// @Router /api/ldap-server/service-accounts/{id} [get]
+func (h *handler) get(c *gin.Context) {
+	serviceAccount, err := h.service.GetServiceAccount(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, serviceAccount)
+}
+
+// create godoc
+// @Summary Create LDAP service account
+// @Description Create a service account with a generated password, which is only returned in this response
+// @Tags LDAP Server
+// @Param serviceAccount body serviceAccountInputDto true "Service account information"
+// @Success 201 {object} serviceAccountWithPasswordDto
+// @Router /api/ldap-server/service-accounts [post]
+func (h *handler) create(c *gin.Context) {
+	var input serviceAccountInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	serviceAccount, password, err := h.service.CreateServiceAccount(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.respondWithPassword(c, http.StatusCreated, serviceAccount, password)
+}
+
+// update godoc
+// @Summary Update LDAP service account
+// @Description Update a service account and replace its allowed user groups
+// @Tags LDAP Server
+// @Param id path string true "Service account ID"
+// @Param serviceAccount body serviceAccountInputDto true "Service account information"
+// @Success 200 {object} serviceAccountDto
+// @Router /api/ldap-server/service-accounts/{id} [put]
+func (h *handler) update(c *gin.Context) {
+	var input serviceAccountInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	serviceAccount, err := h.service.UpdateServiceAccount(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, serviceAccount)
+}
+
+// regeneratePassword godoc
+// @Summary Regenerate LDAP service account password
+// @Description Replace the password of a service account, which is only returned in this response
+// @Tags LDAP Server
+// @Param id path string true "Service account ID"
+// @Success 200 {object} serviceAccountWithPasswordDto
+// @Router /api/ldap-server/service-accounts/{id}/password [post]
+func (h *handler) regeneratePassword(c *gin.Context) {
+	serviceAccount, password, err := h.service.RegeneratePassword(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.respondWithPassword(c, http.StatusOK, serviceAccount, password)
+}
+
+// delete godoc
+// @Summary Delete LDAP service account
+// @Description Delete a service account, which can't bind anymore
+// @Tags LDAP Server
+// @Param id path string true "Service account ID"
+// @Success 204 "No Content"
+// @Router /api/ldap-server/service-accounts/{id} [delete]
+func (h *handler) delete(c *gin.Context) {
+	if err := h.service.DeleteServiceAccount(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) respond(c *gin.Context, status int, serviceAccount ServiceAccount) {
+	responseDto, err := h.toDto(serviceAccount)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(status, responseDto)
+}
+
+func (h *handler) respondWithPassword(c *gin.Context, status int, serviceAccount ServiceAccount, password string) {
+	responseDto, err := h.toDto(serviceAccount)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(status, serviceAccountWithPasswordDto{ServiceAccount: responseDto, Password: password})
+}
+
+// toDto maps the service account and adds the DN it binds with
+func (h *handler) toDto(serviceAccount ServiceAccount) (serviceAccountDto, error) {
+	var responseDto serviceAccountDto
+	if err := dto.MapStruct(serviceAccount, &responseDto); err != nil {
+		return serviceAccountDto{}, err
+	}
+	responseDto.BindDN = h.service.ServiceAccountDN(serviceAccount.Name)
+	return responseDto, nil
+}
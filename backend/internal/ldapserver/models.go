@@ -0,0 +1,24 @@
+package ldapserver
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+// ServiceAccount is a credential LDAP clients bind with to look up users and groups
+type ServiceAccount struct {
+	model.Base
+
+	Name         string `sortable:"true"`
+	Description  *string
+	PasswordHash string
+	LastUsedAt   *datatype.DateTime `sortable:"true"`
+
+	// IsGroupRestricted limits the directory the service account sees to the members of the allowed user groups
+	IsGroupRestricted bool
+	AllowedUserGroups []model.UserGroup `gorm:"many2many:ldap_service_accounts_allowed_user_groups;joinForeignKey:LdapServiceAccountID;joinReferences:UserGroupID"`
+}
+
+func (ServiceAccount) TableName() string {
+	return "ldap_service_accounts"
+}
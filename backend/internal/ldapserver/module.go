@@ -0,0 +1,75 @@
+package ldapserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// ApiKeyValidator resolves the owner of an API key, which admins can bind with instead of a service account
+type ApiKeyValidator interface {
+	ValidateApiKey(ctx context.Context, apiKey string) (model.User, error)
+}
+
+type Dependencies struct {
+	DB      *gorm.DB
+	ApiKeys ApiKeyValidator
+
+	// BaseDN is the DN of the root entry of the directory tree
+	BaseDN string
+	// Addr and TLSAddr are the addresses the server listens on without and with implicit TLS, which are shown to admins
+	Addr    string
+	TLSAddr string
+	// AllowInsecureBinds accepts simple binds on connections without TLS, which is only safe on trusted networks
+	AllowInsecureBinds bool
+}
+
+type Module struct {
+	service            *Service
+	handler            *handler
+	bindLimiter        *bindLimiter
+	allowInsecureBinds bool
+}
+
+func New(deps Dependencies) (*Module, error) {
+	service, err := newService(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	module := &Module{
+		service:            service,
+		handler:            newHandler(service, deps.Addr, deps.TLSAddr),
+		allowInsecureBinds: deps.AllowInsecureBinds,
+	}
+	if !common.EnvConfig.DisableRateLimiting {
+		module.bindLimiter = newBindLimiter(failedBindLimit, failedBindBurst)
+	}
+	return module, nil
+}
+
+// RegisterRoutes mounts the admin endpoints to manage the service accounts LDAP clients bind with
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, adminAuth gin.HandlerFunc) {
+	group := apiGroup.Group("/ldap-server", adminAuth)
+	group.GET("", m.handler.serverInfo)
+	group.GET("/service-accounts", m.handler.list)
+	group.POST("/service-accounts", m.handler.create)
+	group.GET("/service-accounts/:id", m.handler.get)
+	group.PUT("/service-accounts/:id", m.handler.update)
+	group.POST("/service-accounts/:id/password", m.handler.regeneratePassword)
+	group.DELETE("/service-accounts/:id", m.handler.delete)
+}
+
+// Serve answers LDAP requests on the listener until the context is canceled
+// If tlsConfig is set, clients can upgrade connections with StartTLS, or all connections use TLS if implicitTLS is true
+// Simple binds are only accepted over TLS, unless insecure binds are allowed
+func (m *Module) Serve(ctx context.Context, listener net.Listener, tlsConfig *tls.Config, implicitTLS bool) error {
+	s := &server{service: m.service, tlsConfig: tlsConfig, bindLimiter: m.bindLimiter, allowInsecureBinds: m.allowInsecureBinds}
+	return s.serve(ctx, listener, implicitTLS)
+}
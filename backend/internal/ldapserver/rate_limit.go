@@ -0,0 +1,118 @@
+package ldapserver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// failedBindLimit and failedBindBurst allow a few typos, but make guessing passwords and API keys impractical
+	failedBindLimit = rate.Limit(1.0 / 10)
+	failedBindBurst = 5
+	// staleLimiterAge is how long the limiter of a client is kept after its last bind
+	staleLimiterAge = 3 * time.Minute
+)
+
+// bindLimiter limits the failed binds per client IP address, like the rate limit middleware does for HTTP requests
+// A nil bindLimiter doesn't limit anything
+type bindLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu          sync.Mutex
+	clients     map[string]*bindLimiterClient
+	lastCleanup time.Time
+}
+
+type bindLimiterClient struct {
+	limiter *rate.Limiter
+	// pending is the number of binds of the client that are being checked, which count toward the limit until they end
+	pending  int
+	lastSeen time.Time
+}
+
+func newBindLimiter(limit rate.Limit, burst int) *bindLimiter {
+	return &bindLimiter{
+		limit:   limit,
+		burst:   burst,
+		clients: make(map[string]*bindLimiterClient),
+	}
+}
+
+// reserve reports whether the client may attempt another bind, and reserves the attempt if it may
+// The attempt counts toward the limit until it's released, so concurrent binds can't all pass this check before the
+// first of them fails
+func (l *bindLimiter) reserve(addr net.Addr) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+
+	ip := clientIP(addr)
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &bindLimiterClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+
+	if client.limiter.TokensAt(now)-float64(client.pending) < 1 {
+		return false
+	}
+	client.pending++
+	return true
+}
+
+// release ends an attempt reserved with reserve
+// Only failed binds use up the allowance of the client, a successful bind gives the attempt back
+func (l *bindLimiter) release(addr net.Addr, failed bool) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[clientIP(addr)]
+	if !ok {
+		return
+	}
+	client.pending--
+	if failed {
+		client.limiter.AllowN(time.Now(), 1)
+	}
+}
+
+// cleanup removes the limiters of clients that haven't tried to bind for a while
+// It runs when a client binds instead of in a background routine, so the limiter doesn't outlive the server
+func (l *bindLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	l.lastCleanup = now
+
+	for ip, client := range l.clients {
+		if client.pending == 0 && now.Sub(client.lastSeen) > staleLimiterAge {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+func clientIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
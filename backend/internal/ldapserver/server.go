@@ -0,0 +1,483 @@
+package ldapserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// maxMessageSize limits the size of a request, which is small apart from unusually large filters
+	maxMessageSize = 1 << 20
+	// idleTimeout closes connections that didn't send a request for a while
+	idleTimeout = 5 * time.Minute
+	// handshakeTimeout limits how long a TLS handshake may take
+	handshakeTimeout = 10 * time.Second
+)
+
+// server speaks the LDAPv3 protocol (RFC 4511) and answers the read-only subset of it
+type server struct {
+	service   *Service
+	tlsConfig *tls.Config
+	// bindLimiter limits failed binds across all listeners
+	bindLimiter *bindLimiter
+	// allowInsecureBinds accepts simple binds on connections without TLS, which send the password in the clear
+	allowInsecureBinds bool
+}
+
+// connection is the state of a client connection
+type connection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	isTLS  bool
+	// principal is the identity the connection is bound as, or nil if the connection is anonymous
+	principal *principal
+}
+
+// serve accepts connections on the listener until the context is canceled
+func (s *server) serve(ctx context.Context, listener net.Listener, implicitTLS bool) error {
+	stop := context.AfterFunc(ctx, func() { _ = listener.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept LDAP connection: %w", err)
+		}
+
+		wg.Go(func() {
+			s.handleConnection(ctx, conn, implicitTLS)
+		})
+	}
+}
+
+func (s *server) handleConnection(ctx context.Context, conn net.Conn, implicitTLS bool) {
+	// Closing the underlying connection also closes a TLS connection on top of it
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	c := &connection{conn: conn, reader: bufio.NewReader(conn)}
+	if implicitTLS {
+		if err := c.startTLS(s.tlsConfig); err != nil {
+			slog.DebugContext(ctx, "LDAP TLS handshake failed", slog.String("remoteAddr", conn.RemoteAddr().String()), slog.Any("error", err))
+			return
+		}
+	}
+
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		packet, err := readMessage(c.reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.DebugContext(ctx, "Closing LDAP connection", slog.String("remoteAddr", conn.RemoteAddr().String()), slog.Any("error", err))
+			}
+			return
+		}
+
+		if err := s.handleMessage(ctx, c, packet); err != nil {
+			if !errors.Is(err, errUnbind) {
+				slog.DebugContext(ctx, "Closing LDAP connection", slog.String("remoteAddr", conn.RemoteAddr().String()), slog.Any("error", err))
+			}
+			return
+		}
+	}
+}
+
+// errUnbind is returned when the client ends the session
+var errUnbind = errors.New("unbind")
+
+// handleMessage answers an LDAPMessage and returns an error if the connection must be closed
+func (s *server) handleMessage(ctx context.Context, c *connection, packet *ber.Packet) error {
+	if len(packet.Children) < 2 {
+		return errors.New("malformed message")
+	}
+	messageID, ok := packet.Children[0].Value.(int64)
+	if !ok {
+		return errors.New("malformed message ID")
+	}
+	op := packet.Children[1]
+	if op.ClassType != ber.ClassApplication {
+		return errors.New("malformed protocol operation")
+	}
+
+	var controls []*ber.Packet
+	if len(packet.Children) > 2 && packet.Children[2].ClassType == ber.ClassContext && packet.Children[2].Tag == 0 {
+		controls = packet.Children[2].Children
+	}
+
+	switch op.Tag {
+	case ldap.ApplicationBindRequest:
+		return s.bind(ctx, c, messageID, op)
+	case ldap.ApplicationUnbindRequest:
+		return errUnbind
+	case ldap.ApplicationSearchRequest:
+		return s.search(ctx, c, messageID, op, controls)
+	case ldap.ApplicationExtendedRequest:
+		return s.extended(c, messageID, op)
+	case ldap.ApplicationAbandonRequest:
+		// Requests are answered one at a time, so there is never anything to abandon
+		return nil
+	case ldap.ApplicationModifyRequest, ldap.ApplicationAddRequest, ldap.ApplicationDelRequest,
+		ldap.ApplicationModifyDNRequest, ldap.ApplicationCompareRequest:
+		// The response of these operations has the tag that follows the tag of the request
+		return c.write(messageID, result(op.Tag+1, ldap.LDAPResultUnwillingToPerform, "", "the directory is read-only"))
+	default:
+		return fmt.Errorf("unsupported protocol operation %d", op.Tag)
+	}
+}
+
+func (s *server) bind(ctx context.Context, c *connection, messageID int64, op *ber.Packet) error {
+	// A failed bind leaves the connection anonymous (RFC 4511 section 4.2.1)
+	c.principal = nil
+
+	if len(op.Children) != 3 {
+		return errors.New("malformed bind request")
+	}
+	if version, _ := op.Children[0].Value.(int64); version != 3 {
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultProtocolError, "", "only LDAPv3 is supported"))
+	}
+	name := ber.DecodeString(op.Children[1].Data.Bytes())
+	authentication := op.Children[2]
+	if authentication.ClassType != ber.ClassContext || authentication.Tag != 0 {
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "", "only simple binds are supported"))
+	}
+	password := ber.DecodeString(authentication.Data.Bytes())
+
+	switch {
+	case name == "" && password == "":
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", ""))
+	case password == "":
+		// Unauthenticated binds would look successful to clients that check credentials with a bind (RFC 4513 section 5.1.2)
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultUnwillingToPerform, "", "unauthenticated binds are not allowed"))
+	case !c.isTLS && !s.allowInsecureBinds:
+		// Passwords and API keys must not be sent in the clear (RFC 4513 section 5.1.2)
+		message := "simple binds require TLS, use LDAPS"
+		if s.tlsConfig != nil {
+			message = "simple binds require TLS, use StartTLS or LDAPS"
+		}
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultConfidentialityRequired, "", message))
+	case !s.bindLimiter.reserve(c.conn.RemoteAddr()):
+		slog.InfoContext(ctx, "LDAP bind rate limited", slog.String("dn", name), slog.String("remoteAddr", c.conn.RemoteAddr().String()))
+		return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultBusy, "", "too many failed binds, try again later"))
+	}
+
+	p, err := s.service.authenticate(ctx, name, password)
+	s.bindLimiter.release(c.conn.RemoteAddr(), errors.Is(err, errInvalidCredentials))
+	if err != nil {
+		slog.InfoContext(ctx, "LDAP bind failed", slog.String("dn", name), slog.String("remoteAddr", c.conn.RemoteAddr().String()))
+		return c.write(messageID, errorResult(ctx, ldap.ApplicationBindResponse, err))
+	}
+
+	c.principal = p
+	return c.write(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", ""))
+}
+
+func (s *server) search(ctx context.Context, c *connection, messageID int64, op *ber.Packet, controls []*ber.Packet) error {
+	if len(op.Children) != 8 {
+		return errors.New("malformed search request")
+	}
+	baseDN := ber.DecodeString(op.Children[0].Data.Bytes())
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	typesOnly, _ := op.Children[5].Value.(bool)
+	filter := op.Children[6]
+	requestedAttributes := make([]string, 0, len(op.Children[7].Children))
+	for _, a := range op.Children[7].Children {
+		requestedAttributes = append(requestedAttributes, ber.DecodeString(a.Data.Bytes()))
+	}
+
+	paging, err := parseControls(controls)
+	if err != nil {
+		return c.write(messageID, errorResult(ctx, ldap.ApplicationSearchResultDone, err))
+	}
+
+	var entries []*entry
+	switch {
+	case baseDN == "" && scope == scopeBaseObject:
+		// The root DSE can be read without binding, so clients can discover the naming context
+		rootDSE := s.service.rootDSE(s.tlsConfig != nil && !c.isTLS)
+		matches, err := matchFilter(filter, rootDSE)
+		if err != nil {
+			return c.write(messageID, errorResult(ctx, ldap.ApplicationSearchResultDone, err))
+		}
+		if matches {
+			entries = []*entry{rootDSE}
+		}
+	case c.principal == nil:
+		return c.write(messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights, "", "bind to search the directory"))
+	default:
+		entries, err = s.service.search(ctx, c.principal, baseDN, scope, filter)
+		if err != nil {
+			return c.write(messageID, errorResult(ctx, ldap.ApplicationSearchResultDone, err))
+		}
+	}
+
+	var responseControls []*ber.Packet
+	if paging != nil {
+		var nextCookie string
+		entries, nextCookie, err = paging.page(entries)
+		if err != nil {
+			return c.write(messageID, errorResult(ctx, ldap.ApplicationSearchResultDone, err))
+		}
+		responseControls = append(responseControls, pagingControl(nextCookie))
+	}
+
+	resultCode := uint16(ldap.LDAPResultSuccess)
+	if sizeLimit > 0 && int64(len(entries)) > sizeLimit {
+		entries = entries[:sizeLimit]
+		resultCode = ldap.LDAPResultSizeLimitExceeded
+	}
+
+	for _, e := range entries {
+		if err := c.write(messageID, searchResultEntry(e, requestedAttributes, typesOnly)); err != nil {
+			return err
+		}
+	}
+
+	return c.write(messageID, result(ldap.ApplicationSearchResultDone, resultCode, "", ""), responseControls...)
+}
+
+func (s *server) extended(c *connection, messageID int64, op *ber.Packet) error {
+	if len(op.Children) == 0 || op.Children[0].ClassType != ber.ClassContext || op.Children[0].Tag != 0 {
+		return errors.New("malformed extended request")
+	}
+
+	switch name := ber.DecodeString(op.Children[0].Data.Bytes()); name {
+	case extensionStartTLS:
+		if s.tlsConfig == nil || c.isTLS {
+			return c.write(messageID, extendedResult(ldap.LDAPResultOperationsError, "TLS is not available", name, nil))
+		}
+		// The response is sent in the clear, then the client starts the TLS handshake (RFC 4511 section 4.14)
+		if err := c.write(messageID, extendedResult(ldap.LDAPResultSuccess, "", name, nil)); err != nil {
+			return err
+		}
+		return c.startTLS(s.tlsConfig)
+
+	case extensionWhoAmI:
+		// The authorization identity is empty for anonymous connections (RFC 4532)
+		identity := ""
+		if c.principal != nil {
+			identity = "dn:" + c.principal.dn
+		}
+		return c.write(messageID, extendedResult(ldap.LDAPResultSuccess, "", "", &identity))
+
+	default:
+		return c.write(messageID, extendedResult(ldap.LDAPResultProtocolError, "unsupported extended operation", "", nil))
+	}
+}
+
+// startTLS performs the TLS handshake on the connection
+func (c *connection) startTLS(tlsConfig *tls.Config) error {
+	tlsConn := tls.Server(c.conn, tlsConfig)
+	_ = tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	c.isTLS = true
+	return nil
+}
+
+// write sends an LDAPMessage with the protocol operation to the client
+func (c *connection) write(messageID int64, op *ber.Packet, controls ...*ber.Packet) error {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	if len(controls) > 0 {
+		controlsPacket := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, control := range controls {
+			controlsPacket.AppendChild(control)
+		}
+		packet.AppendChild(controlsPacket)
+	}
+
+	_, err := c.conn.Write(packet.Bytes())
+	return err
+}
+
+// readMessage reads an LDAPMessage, rejecting messages that are larger than maxMessageSize before reading them
+func readMessage(r *bufio.Reader) (*ber.Packet, error) {
+	header, err := r.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != 0x30 {
+		return nil, errors.New("message is not a sequence")
+	}
+
+	headerSize, length := 2, int(header[1])
+	if length&0x80 != 0 {
+		lengthSize := length & 0x7f
+		if lengthSize == 0 || lengthSize > 4 {
+			return nil, errors.New("unsupported message length")
+		}
+		header, err = r.Peek(2 + lengthSize)
+		if err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range header[2:] {
+			length = length<<8 | int(b)
+		}
+		headerSize += lengthSize
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+
+	data := make([]byte, headerSize+length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return ber.DecodePacketErr(data)
+}
+
+// result builds an LDAPResult with the given tag (RFC 4511 section 4.1.9)
+func result(tag ber.Tag, resultCode uint16, matchedDN, diagnosticMessage string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, matchedDN, "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, diagnosticMessage, "Diagnostic Message"))
+	return packet
+}
+
+// errorResult builds the LDAPResult for an error, hiding the details of errors that aren't LDAP errors
+func errorResult(ctx context.Context, tag ber.Tag, err error) *ber.Packet {
+	if ldapErr, ok := errors.AsType[*ldap.Error](err); ok {
+		return result(tag, ldapErr.ResultCode, ldapErr.MatchedDN, ldapErr.Err.Error())
+	}
+
+	slog.ErrorContext(ctx, "LDAP request failed", slog.Any("error", err))
+	return result(tag, ldap.LDAPResultOther, "", "internal error")
+}
+
+func extendedResult(resultCode uint16, diagnosticMessage, responseName string, responseValue *string) *ber.Packet {
+	packet := result(ldap.ApplicationExtendedResponse, resultCode, "", diagnosticMessage)
+	if responseName != "" {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 10, responseName, "Response Name"))
+	}
+	if responseValue != nil {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, *responseValue, "Response Value"))
+	}
+	return packet
+}
+
+func searchResultEntry(e *entry, requestedAttributes []string, typesOnly bool) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn.String(), "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, a := range e.selectAttributes(requestedAttributes) {
+		attributePacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attributePacket.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a.name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		if !typesOnly {
+			for _, value := range a.values {
+				values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+		}
+		attributePacket.AppendChild(values)
+		attributes.AppendChild(attributePacket)
+	}
+	packet.AppendChild(attributes)
+
+	return packet
+}
+
+// pagingRequest is the simple paged results control of a search request (RFC 2696)
+type pagingRequest struct {
+	size   int64
+	cookie string
+}
+
+// page returns the page of the entries the cookie points to and the cookie of the next page, which is empty on the
+// last page
+// The cookie is the offset of the page, which works because searches return entries in a stable order
+func (p *pagingRequest) page(entries []*entry) ([]*entry, string, error) {
+	offset := 0
+	if p.cookie != "" {
+		var err error
+		offset, err = strconv.Atoi(p.cookie)
+		if err != nil || offset < 0 {
+			return nil, "", ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("invalid paging cookie"))
+		}
+	}
+	offset = min(offset, len(entries))
+
+	if p.size <= 0 || offset+int(p.size) >= len(entries) {
+		return entries[offset:], "", nil
+	}
+	end := offset + int(p.size)
+	return entries[offset:end], strconv.Itoa(end), nil
+}
+
+// parseControls parses the controls of a request and rejects critical controls the server doesn't support
+func parseControls(controls []*ber.Packet) (*pagingRequest, error) {
+	var paging *pagingRequest
+	for _, control := range controls {
+		if len(control.Children) == 0 {
+			return nil, ldap.NewError(ldap.LDAPResultProtocolError, errors.New("malformed control"))
+		}
+		controlType := ber.DecodeString(control.Children[0].Data.Bytes())
+		critical := false
+		var value *ber.Packet
+		for _, child := range control.Children[1:] {
+			switch child.Tag {
+			case ber.TagBoolean:
+				critical, _ = child.Value.(bool)
+			case ber.TagOctetString:
+				value = child
+			}
+		}
+
+		if controlType == ldap.ControlTypePaging && value != nil {
+			pagingValue, err := ber.DecodePacketErr(value.Data.Bytes())
+			if err != nil || len(pagingValue.Children) != 2 {
+				return nil, ldap.NewError(ldap.LDAPResultProtocolError, errors.New("malformed paging control"))
+			}
+			size, _ := pagingValue.Children[0].Value.(int64)
+			paging = &pagingRequest{size: size, cookie: ber.DecodeString(pagingValue.Children[1].Data.Bytes())}
+			continue
+		}
+
+		if critical {
+			return nil, ldap.NewError(ldap.LDAPResultUnavailableCriticalExtension, fmt.Errorf("unsupported critical control %s", controlType))
+		}
+	}
+	return paging, nil
+}
+
+// pagingControl builds the simple paged results control of a search response, whose size is left unknown
+func pagingControl(cookie string) *ber.Packet {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Search Control Value")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(0), "Size"))
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie, "Cookie"))
+
+	control := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	control.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ldap.ControlTypePaging, "Control Type"))
+	controlValue := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value")
+	controlValue.AppendChild(value)
+	control.AppendChild(controlValue)
+	return control
+}
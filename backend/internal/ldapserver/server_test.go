@@ -0,0 +1,298 @@
+package ldapserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestServer(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newTestService(t, db)
+
+	aliceEmail := "alice@example.com"
+	bobEmail := "bob@example.org"
+	users := []model.User{
+		{Base: model.Base{ID: "admin"}, Username: "admin", IsAdmin: true},
+		{Base: model.Base{ID: "alice"}, Username: "alice", Email: &aliceEmail, FirstName: "Alice", LastName: "Liddell"},
+		{Base: model.Base{ID: "bob"}, Username: "bob", Email: &bobEmail, FirstName: "Bob"},
+		{Base: model.Base{ID: "carol"}, Username: "carol", Disabled: true},
+	}
+	require.NoError(t, db.Create(&users).Error)
+	groups := []model.UserGroup{
+		{Base: model.Base{ID: "staff"}, Name: "staff", FriendlyName: "Staff", Users: []model.User{users[1], users[3]}},
+		{Base: model.Base{ID: "media"}, Name: "media", FriendlyName: "Media", Users: []model.User{users[1], users[2]}},
+	}
+	require.NoError(t, db.Create(&groups).Error)
+	claims := []model.CustomClaim{
+		{Key: "department", Value: "Engineering", UserID: new("alice")},
+		{Key: "department", Value: "Media", UserGroupID: new("media")},
+		{Key: "quota", Value: "100", UserGroupID: new("media")},
+		{Key: "not an attribute", Value: "skipped", UserID: new("alice")},
+	}
+	require.NoError(t, db.Create(&claims).Error)
+
+	_, restrictedPassword, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{
+		Name:                "wiki",
+		IsGroupRestricted:   true,
+		AllowedUserGroupIDs: []string{"staff"},
+	})
+	require.NoError(t, err)
+	_, password, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{Name: "jellyfin"})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &server{service: service, allowInsecureBinds: true}
+	go func() { _ = s.serve(t.Context(), listener, false) }()
+
+	dial := func(t *testing.T) *ldap.Conn {
+		conn, err := ldap.DialURL("ldap://" + listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	search := func(t *testing.T, conn *ldap.Conn, baseDN, filter string, attributes ...string) []*ldap.Entry {
+		result, err := conn.Search(ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil))
+		require.NoError(t, err)
+		return result.Entries
+	}
+	dns := func(entries []*ldap.Entry) []string {
+		dns := make([]string, len(entries))
+		for i, entry := range entries {
+			dns[i] = entry.DN
+		}
+		return dns
+	}
+
+	t.Run("anonymous clients can only read the root DSE", func(t *testing.T) {
+		conn := dial(t)
+
+		result, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		require.NoError(t, err)
+		require.Len(t, result.Entries, 1)
+		require.Equal(t, []string{testBaseDN}, result.Entries[0].GetAttributeValues("namingContexts"))
+
+		_, err = conn.Search(ldap.NewSearchRequest(testBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights))
+	})
+
+	t.Run("invalid credentials are rejected", func(t *testing.T) {
+		conn := dial(t)
+		err := conn.Bind("cn=jellyfin,ou=service-accounts,dc=example,dc=com", "wrong")
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials))
+
+		err = conn.UnauthenticatedBind("cn=jellyfin,ou=service-accounts,dc=example,dc=com")
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform))
+	})
+
+	t.Run("service account sees enabled users and all groups", func(t *testing.T) {
+		conn := dial(t)
+		require.NoError(t, conn.Bind("cn=jellyfin,ou=service-accounts,dc=example,dc=com", password))
+
+		identity, err := conn.WhoAmI(nil)
+		require.NoError(t, err)
+		require.Equal(t, "dn:cn=jellyfin,ou=service-accounts,dc=example,dc=com", identity.AuthzID)
+
+		entries := search(t, conn, "ou=users,"+testBaseDN, "(objectClass=inetOrgPerson)")
+		require.Equal(t, []string{
+			"uid=admin,ou=users,dc=example,dc=com",
+			"uid=alice,ou=users,dc=example,dc=com",
+			"uid=bob,ou=users,dc=example,dc=com",
+		}, dns(entries))
+
+		alice := entries[1]
+		require.Equal(t, "Alice Liddell", alice.GetAttributeValue("cn"))
+		require.Equal(t, "Liddell", alice.GetAttributeValue("sn"))
+		require.Equal(t, "alice@example.com", alice.GetAttributeValue("mail"))
+		require.Equal(t, "alice", alice.GetAttributeValue("entryUUID"))
+		require.ElementsMatch(t, []string{"cn=staff,ou=groups,dc=example,dc=com", "cn=media,ou=groups,dc=example,dc=com"}, alice.GetAttributeValues("memberOf"))
+		// The claim of the user takes precedence over the claim of the group
+		require.Equal(t, "Engineering", alice.GetAttributeValue("department"))
+		require.Equal(t, "100", alice.GetAttributeValue("quota"))
+		require.Empty(t, alice.GetAttributeValue("not an attribute"))
+
+		media := search(t, conn, testBaseDN, "(&(objectClass=groupOfNames)(cn=media))")
+		require.Len(t, media, 1)
+		require.ElementsMatch(t, []string{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com"}, media[0].GetAttributeValues("member"))
+		require.Equal(t, "Media", media[0].GetAttributeValue("department"))
+
+		// The disabled user isn't a member of the group
+		staff := search(t, conn, testBaseDN, "(cn=staff)")
+		require.Equal(t, []string{"uid=alice,ou=users,dc=example,dc=com"}, staff[0].GetAttributeValues("member"))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		conn := dial(t)
+		require.NoError(t, conn.Bind("cn=jellyfin,ou=service-accounts,dc=example,dc=com", password))
+
+		filters := map[string][]string{
+			"(uid=ALICE)":                                     {"uid=alice,ou=users,dc=example,dc=com"},
+			"(mail=*@example.org)":                            {"uid=bob,ou=users,dc=example,dc=com"},
+			"(&(objectClass=person)(!(mail=*)))":              {"uid=admin,ou=users,dc=example,dc=com"},
+			"(|(uid=bob)(cn=staff))":                          {"uid=bob,ou=users,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			"(memberOf=cn=staff,ou=groups,dc=example,dc=com)": {"uid=alice,ou=users,dc=example,dc=com"},
+			"(givenName=A*ce)":                                {"uid=alice,ou=users,dc=example,dc=com"},
+			"(uid:=bob)":                                      {"uid=bob,ou=users,dc=example,dc=com"},
+			"(uid=carol)":                                     {},
+		}
+		for filter, expected := range filters {
+			require.Equal(t, expected, dns(search(t, conn, testBaseDN, filter)), filter)
+		}
+
+		entries := search(t, conn, "uid=bob,ou=users,"+testBaseDN, "(objectClass=*)", "mail", "UID")
+		require.Len(t, entries, 1)
+		require.Len(t, entries[0].Attributes, 2)
+	})
+
+	t.Run("group restricted service account only sees the allowed groups", func(t *testing.T) {
+		conn := dial(t)
+		require.NoError(t, conn.Bind("cn=wiki,ou=service-accounts,dc=example,dc=com", restrictedPassword))
+
+		entries := search(t, conn, testBaseDN, "(|(objectClass=inetOrgPerson)(objectClass=groupOfNames))")
+		require.Equal(t, []string{"uid=alice,ou=users,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"}, dns(entries))
+		require.Equal(t, []string{"cn=staff,ou=groups,dc=example,dc=com"}, entries[0].GetAttributeValues("memberOf"))
+
+		_, err := conn.Search(ldap.NewSearchRequest("cn=media,ou=groups,"+testBaseDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject))
+	})
+
+	t.Run("admin binds with an API key and pages through the results", func(t *testing.T) {
+		conn := dial(t)
+		require.NoError(t, conn.Bind("uid=admin,ou=users,dc=example,dc=com", "admin-key"))
+
+		result, err := conn.SearchWithPaging(ldap.NewSearchRequest(testBaseDN, ldap.ScopeSingleLevel, ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil), 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ou=users,dc=example,dc=com", "ou=groups,dc=example,dc=com"}, dns(result.Entries))
+	})
+
+	t.Run("the directory is read-only", func(t *testing.T) {
+		conn := dial(t)
+		require.NoError(t, conn.Bind("uid=admin,ou=users,dc=example,dc=com", "admin-key"))
+
+		err := conn.Del(ldap.NewDelRequest("uid=bob,ou=users,"+testBaseDN, nil))
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform))
+	})
+}
+
+func TestServerBindSecurity(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newTestService(t, db)
+
+	_, password, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{Name: "jellyfin"})
+	require.NoError(t, err)
+	const bindDN = "cn=jellyfin,ou=service-accounts,dc=example,dc=com"
+
+	tlsConfig := newTestTLSConfig(t)
+	start := func(t *testing.T, s *server) string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() { _ = s.serve(t.Context(), listener, false) }()
+		return listener.Addr().String()
+	}
+	dial := func(t *testing.T, addr string) *ldap.Conn {
+		conn, err := ldap.DialURL("ldap://" + addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	t.Run("simple binds require TLS if it is configured", func(t *testing.T) {
+		addr := start(t, &server{service: service, tlsConfig: tlsConfig})
+		conn := dial(t, addr)
+
+		err := conn.Bind(bindDN, password)
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultConfidentialityRequired))
+		err = conn.Bind(bindDN, "wrong")
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultConfidentialityRequired))
+
+		// Anonymous binds don't send credentials
+		require.NoError(t, conn.UnauthenticatedBind(""))
+
+		require.NoError(t, conn.StartTLS(&tls.Config{InsecureSkipVerify: true})) //nolint:gosec
+		require.NoError(t, conn.Bind(bindDN, password))
+	})
+
+	t.Run("simple binds require TLS unless insecure binds are allowed", func(t *testing.T) {
+		addr := start(t, &server{service: service})
+		conn := dial(t, addr)
+
+		err := conn.Bind(bindDN, password)
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultConfidentialityRequired))
+		require.NoError(t, conn.UnauthenticatedBind(""))
+
+		addr = start(t, &server{service: service, allowInsecureBinds: true})
+		require.NoError(t, dial(t, addr).Bind(bindDN, password))
+	})
+
+	t.Run("failed binds are rate limited", func(t *testing.T) {
+		addr := start(t, &server{service: service, bindLimiter: newBindLimiter(rate.Every(time.Hour), 2), allowInsecureBinds: true})
+		conn := dial(t, addr)
+
+		// Successful binds don't count toward the limit
+		for range 3 {
+			require.NoError(t, conn.Bind(bindDN, password))
+		}
+
+		for range 2 {
+			err := conn.Bind(bindDN, "wrong")
+			require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials))
+		}
+
+		// The limit applies to the client on every connection, even with the right password
+		err := conn.Bind(bindDN, password)
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultBusy))
+		err = dial(t, addr).Bind(bindDN, password)
+		require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultBusy))
+	})
+
+	t.Run("binds in progress count toward the limit", func(t *testing.T) {
+		limiter := newBindLimiter(rate.Every(time.Hour), 2)
+		addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1)}
+
+		require.True(t, limiter.reserve(addr))
+		require.True(t, limiter.reserve(addr))
+		require.False(t, limiter.reserve(addr), "concurrent binds must not exceed the limit before they fail")
+
+		// A successful bind gives its attempt back
+		limiter.release(addr, false)
+		require.True(t, limiter.reserve(addr))
+
+		limiter.release(addr, true)
+		limiter.release(addr, true)
+		require.False(t, limiter.reserve(addr))
+	})
+}
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
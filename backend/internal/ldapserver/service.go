@@ -0,0 +1,292 @@
+package ldapserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// serviceAccountNameRegex keeps service account names usable in a bind DN without escaping
+var serviceAccountNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// errInvalidCredentials is returned for every failed bind, so clients can't tell which part of the credentials is wrong
+var errInvalidCredentials = ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+
+// principal is the identity an LDAP connection is bound as
+type principal struct {
+	dn string
+	// allowedUserGroupIDs limits the directory to the members of these user groups, unless it is nil
+	allowedUserGroupIDs []string
+}
+
+// Service holds the business logic of the LDAP server and the management of its service accounts
+type Service struct {
+	db      *gorm.DB
+	apiKeys ApiKeyValidator
+
+	baseDN            *ldap.DN
+	usersDN           *ldap.DN
+	groupsDN          *ldap.DN
+	serviceAccountsDN *ldap.DN
+}
+
+func newService(deps Dependencies) (*Service, error) {
+	baseDN, err := ldap.ParseDN(deps.BaseDN)
+	if err != nil {
+		return nil, err
+	}
+	if len(baseDN.RDNs) == 0 {
+		return nil, errors.New("base DN must not be empty")
+	}
+
+	return &Service{
+		db:                deps.DB,
+		apiKeys:           deps.ApiKeys,
+		baseDN:            baseDN,
+		usersDN:           childDN(baseDN, "ou", "users"),
+		groupsDN:          childDN(baseDN, "ou", "groups"),
+		serviceAccountsDN: childDN(baseDN, "ou", "service-accounts"),
+	}, nil
+}
+
+func (s *Service) ListServiceAccounts(ctx context.Context, search string, listRequestOptions utils.ListRequestOptions) ([]ServiceAccount, utils.PaginationResponse, error) {
+	query := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		Model(&ServiceAccount{})
+
+	if search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("name LIKE ? OR description LIKE ?", searchPattern, searchPattern)
+	}
+
+	var serviceAccounts []ServiceAccount
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &serviceAccounts)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return serviceAccounts, pagination, nil
+}
+
+func (s *Service) GetServiceAccount(ctx context.Context, id string) (ServiceAccount, error) {
+	var serviceAccount ServiceAccount
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		First(&serviceAccount, "id = ?", id).
+		Error
+	return serviceAccount, err
+}
+
+// CreateServiceAccount creates a service account with a random password, which is returned only once
+func (s *Service) CreateServiceAccount(ctx context.Context, input serviceAccountInputDto) (ServiceAccount, string, error) {
+	password, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+
+	serviceAccount := ServiceAccount{PasswordHash: utils.CreateSha256Hash(password)}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.saveServiceAccount(tx, &serviceAccount, input)
+	})
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+
+	return serviceAccount, password, nil
+}
+
+func (s *Service) UpdateServiceAccount(ctx context.Context, id string, input serviceAccountInputDto) (ServiceAccount, error) {
+	var serviceAccount ServiceAccount
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&serviceAccount, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		return s.saveServiceAccount(tx, &serviceAccount, input)
+	})
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+
+	return serviceAccount, nil
+}
+
+// RegeneratePassword replaces the password of a service account, which is returned only once
+func (s *Service) RegeneratePassword(ctx context.Context, id string) (ServiceAccount, string, error) {
+	password, err := utils.GenerateRandomAlphanumericString(32)
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+
+	result := s.db.
+		WithContext(ctx).
+		Model(&ServiceAccount{}).
+		Where("id = ?", id).
+		Update("password_hash", utils.CreateSha256Hash(password))
+	if result.Error != nil {
+		return ServiceAccount{}, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ServiceAccount{}, "", gorm.ErrRecordNotFound
+	}
+
+	serviceAccount, err := s.GetServiceAccount(ctx, id)
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+
+	return serviceAccount, password, nil
+}
+
+func (s *Service) DeleteServiceAccount(ctx context.Context, id string) error {
+	result := s.db.
+		WithContext(ctx).
+		Delete(&ServiceAccount{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// saveServiceAccount validates the input, then creates or updates the service account and replaces its allowed user groups
+func (s *Service) saveServiceAccount(tx *gorm.DB, serviceAccount *ServiceAccount, input serviceAccountInputDto) error {
+	if !serviceAccountNameRegex.MatchString(input.Name) {
+		return &common.ValidationError{Message: "name may only contain letters, digits, dots, underscores and hyphens"}
+	}
+
+	userGroups := []model.UserGroup{}
+	if len(input.AllowedUserGroupIDs) > 0 {
+		err := tx.Where("id IN ?", input.AllowedUserGroupIDs).Find(&userGroups).Error
+		if err != nil {
+			return err
+		}
+		if len(userGroups) != len(slices.Compact(slices.Sorted(slices.Values(input.AllowedUserGroupIDs)))) {
+			return &common.ValidationError{Message: "one or more allowed user groups do not exist"}
+		}
+	}
+
+	serviceAccount.Name = input.Name
+	serviceAccount.Description = input.Description
+	serviceAccount.IsGroupRestricted = input.IsGroupRestricted
+
+	err := tx.Omit("AllowedUserGroups").Save(serviceAccount).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &common.AlreadyInUseError{Property: "Name"}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(serviceAccount).Association("AllowedUserGroups").Replace(userGroups)
+	if err != nil {
+		return err
+	}
+	serviceAccount.AllowedUserGroups = userGroups
+
+	return nil
+}
+
+// ServiceAccountDN returns the DN a service account binds with
+func (s *Service) ServiceAccountDN(name string) string {
+	return childDN(s.serviceAccountsDN, "cn", name).String()
+}
+
+// authenticate resolves the principal of a simple bind
+// Service accounts bind with their DN and password, and admins bind with their user DN and one of their API keys
+func (s *Service) authenticate(ctx context.Context, name, password string) (*principal, error) {
+	bindDN, err := ldap.ParseDN(name)
+	if err != nil || len(bindDN.RDNs) != len(s.baseDN.RDNs)+2 || len(bindDN.RDNs[0].Attributes) != 1 {
+		return nil, errInvalidCredentials
+	}
+
+	rdn := bindDN.RDNs[0].Attributes[0]
+	parentDN := &ldap.DN{RDNs: bindDN.RDNs[1:]}
+	switch {
+	case strings.EqualFold(rdn.Type, "cn") && parentDN.EqualFold(s.serviceAccountsDN):
+		return s.authenticateServiceAccount(ctx, rdn.Value, password)
+	case strings.EqualFold(rdn.Type, "uid") && parentDN.EqualFold(s.usersDN):
+		return s.authenticateAdmin(ctx, rdn.Value, password)
+	default:
+		return nil, errInvalidCredentials
+	}
+}
+
+func (s *Service) authenticateServiceAccount(ctx context.Context, name, password string) (*principal, error) {
+	var serviceAccount ServiceAccount
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		First(&serviceAccount, "name = ?", name).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(serviceAccount.PasswordHash), []byte(utils.CreateSha256Hash(password))) != 1 {
+		return nil, errInvalidCredentials
+	}
+
+	err = s.db.
+		WithContext(ctx).
+		Model(&serviceAccount).
+		Update("last_used_at", datatype.DateTime(time.Now())).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	p := &principal{dn: s.ServiceAccountDN(serviceAccount.Name)}
+	if serviceAccount.IsGroupRestricted {
+		p.allowedUserGroupIDs = make([]string, 0, len(serviceAccount.AllowedUserGroups))
+		for _, group := range serviceAccount.AllowedUserGroups {
+			p.allowedUserGroupIDs = append(p.allowedUserGroupIDs, group.ID)
+		}
+	}
+
+	return p, nil
+}
+
+func (s *Service) authenticateAdmin(ctx context.Context, username, apiKey string) (*principal, error) {
+	user, err := s.apiKeys.ValidateApiKey(ctx, apiKey)
+	if err != nil || !strings.EqualFold(user.Username, username) || !user.IsAdmin || user.Disabled {
+		return nil, errInvalidCredentials
+	}
+
+	return &principal{dn: s.userDN(user.Username).String()}, nil
+}
+
+func (s *Service) userDN(username string) *ldap.DN {
+	return childDN(s.usersDN, "uid", username)
+}
+
+func (s *Service) groupDN(name string) *ldap.DN {
+	return childDN(s.groupsDN, "cn", name)
+}
+
+// childDN returns the DN of the entry with the given RDN below the parent
+func childDN(parent *ldap.DN, attributeType, value string) *ldap.DN {
+	rdn := &ldap.RelativeDN{Attributes: []*ldap.AttributeTypeAndValue{{Type: attributeType, Value: value}}}
+	return &ldap.DN{RDNs: append([]*ldap.RelativeDN{rdn}, parent.RDNs...)}
+}
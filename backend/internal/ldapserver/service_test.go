@@ -0,0 +1,150 @@
+package ldapserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+const testBaseDN = "dc=example,dc=com"
+
+// testApiKeys accepts the API key "admin-key" of the user "admin"
+type testApiKeys struct {
+	db *gorm.DB
+}
+
+func (k testApiKeys) ValidateApiKey(ctx context.Context, apiKey string) (model.User, error) {
+	if apiKey != "admin-key" {
+		return model.User{}, &common.InvalidAPIKeyError{}
+	}
+
+	var user model.User
+	err := k.db.WithContext(ctx).First(&user, "username = ?", "admin").Error
+	return user, err
+}
+
+func newTestService(t *testing.T, db *gorm.DB) *Service {
+	t.Helper()
+
+	service, err := newService(Dependencies{DB: db, ApiKeys: testApiKeys{db: db}, BaseDN: testBaseDN})
+	require.NoError(t, err)
+	return service
+}
+
+func TestServiceSaveServiceAccount(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newTestService(t, db)
+
+	for _, id := range []string{"staff", "printers"} {
+		require.NoError(t, db.Create(&model.UserGroup{Base: model.Base{ID: id}, Name: id, FriendlyName: id}).Error)
+	}
+
+	serviceAccount, password, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{
+		Name:                "jellyfin",
+		IsGroupRestricted:   true,
+		AllowedUserGroupIDs: []string{"staff", "printers"},
+	})
+	require.NoError(t, err)
+	require.Len(t, password, 32)
+	require.NotEqual(t, password, serviceAccount.PasswordHash)
+	require.Len(t, serviceAccount.AllowedUserGroups, 2)
+	require.Equal(t, "cn=jellyfin,ou=service-accounts,dc=example,dc=com", service.ServiceAccountDN(serviceAccount.Name))
+
+	t.Run("update replaces the allowed user groups", func(t *testing.T) {
+		updated, err := service.UpdateServiceAccount(t.Context(), serviceAccount.ID, serviceAccountInputDto{
+			Name:                "jellyfin",
+			IsGroupRestricted:   true,
+			AllowedUserGroupIDs: []string{"staff"},
+		})
+		require.NoError(t, err)
+
+		loaded, err := service.GetServiceAccount(t.Context(), updated.ID)
+		require.NoError(t, err)
+		require.Len(t, loaded.AllowedUserGroups, 1)
+		require.Equal(t, serviceAccount.PasswordHash, loaded.PasswordHash)
+	})
+
+	t.Run("regenerating the password replaces it", func(t *testing.T) {
+		_, newPassword, err := service.RegeneratePassword(t.Context(), serviceAccount.ID)
+		require.NoError(t, err)
+		require.NotEqual(t, password, newPassword)
+
+		_, err = service.authenticate(t.Context(), service.ServiceAccountDN("jellyfin"), password)
+		require.ErrorIs(t, err, errInvalidCredentials)
+		_, err = service.authenticate(t.Context(), service.ServiceAccountDN("jellyfin"), newPassword)
+		require.NoError(t, err)
+	})
+
+	t.Run("duplicate name is rejected", func(t *testing.T) {
+		_, _, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{Name: "jellyfin"})
+		require.ErrorIs(t, err, &common.AlreadyInUseError{})
+	})
+
+	t.Run("invalid input is rejected", func(t *testing.T) {
+		inputs := map[string]serviceAccountInputDto{
+			"name with a comma":  {Name: "jelly,fin"},
+			"name with a space":  {Name: "jelly fin"},
+			"unknown user group": {Name: "proxmox", AllowedUserGroupIDs: []string{"missing"}},
+		}
+		for name, input := range inputs {
+			_, _, err := service.CreateServiceAccount(t.Context(), input)
+			var validationErr *common.ValidationError
+			require.ErrorAs(t, err, &validationErr, name)
+		}
+	})
+}
+
+func TestServiceAuthenticate(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newTestService(t, db)
+
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: "admin"}, Username: "admin", IsAdmin: true}).Error)
+	require.NoError(t, db.Create(&model.UserGroup{Base: model.Base{ID: "staff"}, Name: "staff", FriendlyName: "Staff"}).Error)
+
+	restricted, password, err := service.CreateServiceAccount(t.Context(), serviceAccountInputDto{
+		Name:                "printer",
+		IsGroupRestricted:   true,
+		AllowedUserGroupIDs: []string{"staff"},
+	})
+	require.NoError(t, err)
+
+	t.Run("service account", func(t *testing.T) {
+		p, err := service.authenticate(t.Context(), "CN=printer, OU=Service-Accounts, DC=example, DC=com", password)
+		require.NoError(t, err)
+		require.Equal(t, "cn=printer,ou=service-accounts,dc=example,dc=com", p.dn)
+		require.Equal(t, []string{"staff"}, p.allowedUserGroupIDs)
+
+		loaded, err := service.GetServiceAccount(t.Context(), restricted.ID)
+		require.NoError(t, err)
+		require.NotNil(t, loaded.LastUsedAt)
+	})
+
+	t.Run("admin with an API key", func(t *testing.T) {
+		p, err := service.authenticate(t.Context(), "uid=admin,ou=users,dc=example,dc=com", "admin-key")
+		require.NoError(t, err)
+		require.Nil(t, p.allowedUserGroupIDs)
+	})
+
+	t.Run("invalid credentials are rejected", func(t *testing.T) {
+		credentials := map[string]string{
+			"cn=printer,ou=service-accounts,dc=example,dc=com": "wrong",
+			"cn=scanner,ou=service-accounts,dc=example,dc=com": password,
+			"uid=other,ou=users,dc=example,dc=com":             "admin-key",
+			"uid=admin,ou=users,dc=example,dc=com":             password,
+			"cn=printer,ou=service-accounts,dc=other,dc=com":   password,
+			"cn=printer,dc=example,dc=com":                     password,
+			"not a dn":                                         password,
+		}
+		for dn, password := range credentials {
+			_, err := service.authenticate(t.Context(), dn, password)
+			require.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials), dn)
+		}
+	})
+}
@@ -2,18 +2,21 @@ package middleware
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pocket-id/pocket-id/backend/internal/apikey"
 	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
 	"github.com/pocket-id/pocket-id/backend/internal/service"
 )
 
 // AuthMiddleware is a wrapper middleware that delegates to either API key or JWT authentication
 type AuthMiddleware struct {
-	apiKeyMiddleware *ApiKeyAuthMiddleware
-	jwtMiddleware    *JwtAuthMiddleware
-	options          AuthOptions
+	apiKeyMiddleware  *ApiKeyAuthMiddleware
+	jwtMiddleware     *JwtAuthMiddleware
+	options           AuthOptions
+	adminMutationHook gin.HandlerFunc
 }
 
 type AuthOptions struct {
@@ -26,10 +29,11 @@ func NewAuthMiddleware(
 	apiKeyModule *apikey.Module,
 	userService *service.UserService,
 	jwtService *service.JwtService,
+	sessionService *service.UserSessionService,
 ) *AuthMiddleware {
 	return &AuthMiddleware{
 		apiKeyMiddleware: NewApiKeyAuthMiddleware(apiKeyModule, jwtService),
-		jwtMiddleware:    NewJwtAuthMiddleware(jwtService, userService),
+		jwtMiddleware:    NewJwtAuthMiddleware(jwtService, userService, sessionService),
 		options: AuthOptions{
 			AdminRequired:   true,
 			SuccessOptional: false,
@@ -42,9 +46,10 @@ func NewAuthMiddleware(
 func (m *AuthMiddleware) WithAdminNotRequired() *AuthMiddleware {
 	// Create a new instance to avoid modifying the original
 	clone := &AuthMiddleware{
-		apiKeyMiddleware: m.apiKeyMiddleware,
-		jwtMiddleware:    m.jwtMiddleware,
-		options:          m.options,
+		apiKeyMiddleware:  m.apiKeyMiddleware,
+		jwtMiddleware:     m.jwtMiddleware,
+		options:           m.options,
+		adminMutationHook: m.adminMutationHook,
 	}
 	clone.options.AdminRequired = false
 	return clone
@@ -54,9 +59,10 @@ func (m *AuthMiddleware) WithAdminNotRequired() *AuthMiddleware {
 func (m *AuthMiddleware) WithSuccessOptional() *AuthMiddleware {
 	// Create a new instance to avoid modifying the original
 	clone := &AuthMiddleware{
-		apiKeyMiddleware: m.apiKeyMiddleware,
-		jwtMiddleware:    m.jwtMiddleware,
-		options:          m.options,
+		apiKeyMiddleware:  m.apiKeyMiddleware,
+		jwtMiddleware:     m.jwtMiddleware,
+		options:           m.options,
+		adminMutationHook: m.adminMutationHook,
 	}
 	clone.options.SuccessOptional = true
 	return clone
@@ -65,26 +71,40 @@ func (m *AuthMiddleware) WithSuccessOptional() *AuthMiddleware {
 // WithApiKeyAuthDisabled disables API key authentication fallback and requires JWT auth.
 func (m *AuthMiddleware) WithApiKeyAuthDisabled() *AuthMiddleware {
 	clone := &AuthMiddleware{
-		apiKeyMiddleware: m.apiKeyMiddleware,
-		jwtMiddleware:    m.jwtMiddleware,
-		options:          m.options,
+		apiKeyMiddleware:  m.apiKeyMiddleware,
+		jwtMiddleware:     m.jwtMiddleware,
+		options:           m.options,
+		adminMutationHook: m.adminMutationHook,
 	}
 	clone.options.AllowApiKeyAuth = false
 	return clone
 }
 
+// WithAdminMutationHook calls the hook after every successful request that changes something on a route that
+// requires an admin
+func (m *AuthMiddleware) WithAdminMutationHook(hook gin.HandlerFunc) *AuthMiddleware {
+	clone := &AuthMiddleware{
+		apiKeyMiddleware:  m.apiKeyMiddleware,
+		jwtMiddleware:     m.jwtMiddleware,
+		options:           m.options,
+		adminMutationHook: hook,
+	}
+	return clone
+}
+
 func (m *AuthMiddleware) Add() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, isAdmin, authenticationMethod, authenticationTime, err := m.jwtMiddleware.Verify(c, m.options.AdminRequired)
+		userID, isAdmin, authenticationMethod, authenticationTime, sessionID, err := m.jwtMiddleware.Verify(c, m.options.AdminRequired)
 		if err == nil {
 			c.Set("userID", userID)
 			c.Set("userIsAdmin", isAdmin)
 			c.Set("authenticationMethod", authenticationMethod)
 			c.Set("authenticationTime", authenticationTime)
+			c.Set("sessionID", sessionID)
 			if c.IsAborted() {
 				return
 			}
-			c.Next()
+			m.next(c)
 			return
 		}
 
@@ -118,7 +138,7 @@ func (m *AuthMiddleware) Add() gin.HandlerFunc {
 			if c.IsAborted() {
 				return
 			}
-			c.Next()
+			m.next(c)
 			return
 		}
 
@@ -132,3 +152,25 @@ func (m *AuthMiddleware) Add() gin.HandlerFunc {
 		_ = c.Error(err)
 	}
 }
+
+// next handles the authenticated request and calls the admin mutation hook if the request changed something successfully.
+// The authenticated user is added to the request context, so the changes it makes are attributed to it in the audit log.
+func (m *AuthMiddleware) next(c *gin.Context) {
+	c.Request = c.Request.WithContext(model.ContextWithAuditLogActor(c.Request.Context(), model.AuditLogActor{
+		UserID:    c.GetString("userID"),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}))
+	c.Next()
+
+	if m.adminMutationHook == nil || !m.options.AdminRequired || len(c.Errors) > 0 || c.Writer.Status() >= 400 {
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+
+	m.adminMutationHook(c)
+}
@@ -38,14 +38,15 @@ func TestWithApiKeyAuthDisabled(t *testing.T) {
 	jwtService, err := service.NewJwtService(t.Context(), db, appConfigService)
 	require.NoError(t, err)
 
-	userService := service.NewUserService(db, jwtService, nil, nil, appConfigService, nil, nil, nil, nil)
+	userService := service.NewUserService(db, jwtService, nil, nil, appConfigService, nil, nil, nil, nil, nil)
 	apiKeyModule, err := apikey.New(t.Context(), apikey.Dependencies{DB: db})
 	require.NoError(t, err)
 
-	authMiddleware := NewAuthMiddleware(apiKeyModule, userService, jwtService)
+	userSessionService := service.NewUserSessionService(db, jwtService, appConfigService, nil)
+	authMiddleware := NewAuthMiddleware(apiKeyModule, userService, jwtService, userSessionService)
 
 	user := createUserForAuthMiddlewareTest(t, db)
-	jwtToken, err := jwtService.GenerateAccessToken(user, "")
+	jwtToken, err := userSessionService.CreateSession(t.Context(), db, user, "", "", "")
 	require.NoError(t, err)
 
 	apiKeyToken := "middleware-test-api-key-raw-token"
@@ -89,6 +90,142 @@ func TestWithApiKeyAuthDisabled(t *testing.T) {
 	})
 }
 
+func TestJwtAuthRequiresActiveSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	originalEnvConfig := common.EnvConfig
+	defer func() {
+		common.EnvConfig = originalEnvConfig
+	}()
+	common.EnvConfig.AppURL = "https://test.example.com"
+	common.EnvConfig.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+	db := testutils.NewDatabaseForTest(t)
+
+	appConfigService, err := service.NewAppConfigService(t.Context(), db)
+	require.NoError(t, err)
+
+	jwtService, err := service.NewJwtService(t.Context(), db, appConfigService)
+	require.NoError(t, err)
+
+	userService := service.NewUserService(db, jwtService, nil, nil, appConfigService, nil, nil, nil, nil, nil)
+	userSessionService := service.NewUserSessionService(db, jwtService, appConfigService, nil)
+	jwtMiddleware := NewJwtAuthMiddleware(jwtService, userService, userSessionService)
+
+	router := gin.New()
+	router.Use(NewErrorHandlerMiddleware().Add())
+	router.GET("/api/protected", jwtMiddleware.Add(false), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("sessionID"))
+	})
+
+	user := createUserForAuthMiddlewareTest(t, db)
+
+	request := func(t *testing.T, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("accepts a token of an active session", func(t *testing.T) {
+		token, err := userSessionService.CreateSession(t.Context(), db, user, "", "192.0.2.1", "test-agent")
+		require.NoError(t, err)
+
+		recorder := request(t, token)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		sessions, err := userSessionService.ListSessions(t.Context(), user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		require.Equal(t, sessions[0].ID, recorder.Body.String())
+		require.Equal(t, "test-agent", sessions[0].UserAgent)
+	})
+
+	t.Run("rejects a token of a revoked session", func(t *testing.T) {
+		token, err := userSessionService.CreateSession(t.Context(), db, user, "", "", "")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, request(t, token).Code)
+
+		require.NoError(t, userSessionService.RevokeAllSessions(t.Context(), user.ID, ""))
+
+		require.Equal(t, http.StatusUnauthorized, request(t, token).Code)
+	})
+
+	t.Run("rejects a token without a session", func(t *testing.T) {
+		token, err := jwtService.GenerateAccessToken(user, "", "")
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusUnauthorized, request(t, token).Code)
+	})
+}
+
+func TestAdminMutationHook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	originalEnvConfig := common.EnvConfig
+	defer func() {
+		common.EnvConfig = originalEnvConfig
+	}()
+	common.EnvConfig.AppURL = "https://test.example.com"
+	common.EnvConfig.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+	db := testutils.NewDatabaseForTest(t)
+
+	appConfigService, err := service.NewAppConfigService(t.Context(), db)
+	require.NoError(t, err)
+
+	jwtService, err := service.NewJwtService(t.Context(), db, appConfigService)
+	require.NoError(t, err)
+
+	userService := service.NewUserService(db, jwtService, nil, nil, appConfigService, nil, nil, nil, nil, nil)
+	apiKeyModule, err := apikey.New(t.Context(), apikey.Dependencies{DB: db})
+	require.NoError(t, err)
+
+	userSessionService := service.NewUserSessionService(db, jwtService, appConfigService, nil)
+
+	var mutations []string
+	authMiddleware := NewAuthMiddleware(apiKeyModule, userService, jwtService, userSessionService).
+		WithAdminMutationHook(func(c *gin.Context) {
+			mutations = append(mutations, c.Request.Method+" "+c.FullPath())
+		})
+
+	user := createUserForAuthMiddlewareTest(t, db)
+	require.NoError(t, db.Model(&user).Update("is_admin", true).Error)
+	jwtToken, err := userSessionService.CreateSession(t.Context(), db, user, "", "", "")
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(NewErrorHandlerMiddleware().Add())
+	router.GET("/api/admin", authMiddleware.Add(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/api/admin", authMiddleware.Add(), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	router.PUT("/api/admin", authMiddleware.Add(), func(c *gin.Context) {
+		_ = c.Error(&common.ValidationError{Message: "invalid"})
+	})
+	router.POST("/api/me", authMiddleware.WithAdminNotRequired().Add(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/admin"},
+		{http.MethodPost, "/api/admin"},
+		{http.MethodPut, "/api/admin"},
+		{http.MethodPost, "/api/me"},
+	} {
+		req := httptest.NewRequestWithContext(t.Context(), route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Only successful changes on routes that require an admin are reported
+	require.Equal(t, []string{"POST /api/admin"}, mutations)
+}
+
 func createUserForAuthMiddlewareTest(t *testing.T, db *gorm.DB) model.User {
 	t.Helper()
 
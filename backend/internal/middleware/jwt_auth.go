@@ -11,17 +11,18 @@ import (
 )
 
 type JwtAuthMiddleware struct {
-	userService *service.UserService
-	jwtService  *service.JwtService
+	userService    *service.UserService
+	jwtService     *service.JwtService
+	sessionService *service.UserSessionService
 }
 
-func NewJwtAuthMiddleware(jwtService *service.JwtService, userService *service.UserService) *JwtAuthMiddleware {
-	return &JwtAuthMiddleware{jwtService: jwtService, userService: userService}
+func NewJwtAuthMiddleware(jwtService *service.JwtService, userService *service.UserService, sessionService *service.UserSessionService) *JwtAuthMiddleware {
+	return &JwtAuthMiddleware{jwtService: jwtService, userService: userService, sessionService: sessionService}
 }
 
 func (m *JwtAuthMiddleware) Add(adminRequired bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, isAdmin, authenticationMethod, authenticationTime, err := m.Verify(c, adminRequired)
+		userID, isAdmin, authenticationMethod, authenticationTime, sessionID, err := m.Verify(c, adminRequired)
 		if err != nil {
 			c.Abort()
 			_ = c.Error(err)
@@ -32,11 +33,12 @@ func (m *JwtAuthMiddleware) Add(adminRequired bool) gin.HandlerFunc {
 		c.Set("userIsAdmin", isAdmin)
 		c.Set("authenticationMethod", authenticationMethod)
 		c.Set("authenticationTime", authenticationTime)
+		c.Set("sessionID", sessionID)
 		c.Next()
 	}
 }
 
-func (m *JwtAuthMiddleware) Verify(c *gin.Context, adminRequired bool) (subject string, isAdmin bool, authenticationMethod string, authenticationTime time.Time, err error) {
+func (m *JwtAuthMiddleware) Verify(c *gin.Context, adminRequired bool) (subject string, isAdmin bool, authenticationMethod string, authenticationTime time.Time, sessionID string, err error) {
 	// Extract the token from the cookie
 	accessToken, err := c.Cookie(cookie.AccessTokenCookieName)
 	if err != nil {
@@ -44,38 +46,51 @@ func (m *JwtAuthMiddleware) Verify(c *gin.Context, adminRequired bool) (subject
 		var ok bool
 		_, accessToken, ok = strings.Cut(c.GetHeader("Authorization"), " ")
 		if !ok || accessToken == "" {
-			return "", false, "", time.Time{}, &common.NotSignedInError{}
+			return "", false, "", time.Time{}, "", &common.NotSignedInError{}
 		}
 	}
 
 	token, err := m.jwtService.VerifyAccessToken(accessToken)
 	if err != nil {
-		return "", false, "", time.Time{}, &common.NotSignedInError{}
+		return "", false, "", time.Time{}, "", &common.NotSignedInError{}
 	}
 	authenticationMethod, err = m.jwtService.GetAuthenticationMethod(token)
 	if err != nil {
-		return "", false, "", time.Time{}, &common.NotSignedInError{}
+		return "", false, "", time.Time{}, "", &common.NotSignedInError{}
 	}
 	authenticationTime, _ = token.IssuedAt()
 
 	subject, ok := token.Subject()
 	if !ok {
 		_ = c.Error(&common.TokenInvalidError{})
-		return "", false, "", time.Time{}, &common.TokenInvalidError{}
+		return "", false, "", time.Time{}, "", &common.TokenInvalidError{}
+	}
+
+	// The token must belong to a browser session that hasn't been signed out
+	// Tokens issued before browser sessions were recorded don't have a session ID; they're accepted until they expire
+	sessionID, err = m.jwtService.GetSessionID(token)
+	if err != nil {
+		return "", false, "", time.Time{}, "", &common.NotSignedInError{}
+	}
+	if sessionID != "" {
+		err = m.sessionService.ValidateSession(c.Request.Context(), sessionID, subject)
+		if err != nil {
+			return "", false, "", time.Time{}, "", &common.NotSignedInError{}
+		}
 	}
 
 	user, err := m.userService.GetUser(c, subject)
 	if err != nil {
-		return "", false, "", time.Time{}, &common.NotSignedInError{}
+		return "", false, "", time.Time{}, "", &common.NotSignedInError{}
 	}
 
 	if user.Disabled {
-		return "", false, "", time.Time{}, &common.UserDisabledError{}
+		return "", false, "", time.Time{}, "", &common.UserDisabledError{}
 	}
 
 	if adminRequired && !user.IsAdmin {
-		return "", false, "", time.Time{}, &common.MissingPermissionError{}
+		return "", false, "", time.Time{}, "", &common.MissingPermissionError{}
 	}
 
-	return subject, user.IsAdmin, authenticationMethod, authenticationTime, nil
+	return subject, user.IsAdmin, authenticationMethod, authenticationTime, sessionID, nil
 }
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 
@@ -27,17 +28,128 @@ type AuditLogData map[string]string //nolint:recvcheck
 type AuditLogEvent string //nolint:recvcheck
 
 const (
-	AuditLogEventSignIn                     AuditLogEvent = "SIGN_IN"
-	AuditLogEventOneTimeAccessTokenSignIn   AuditLogEvent = "TOKEN_SIGN_IN"
-	AuditLogEventAccountCreated             AuditLogEvent = "ACCOUNT_CREATED"
-	AuditLogEventClientAuthorization        AuditLogEvent = "CLIENT_AUTHORIZATION"
-	AuditLogEventNewClientAuthorization     AuditLogEvent = "NEW_CLIENT_AUTHORIZATION"
-	AuditLogEventDeviceCodeAuthorization    AuditLogEvent = "DEVICE_CODE_AUTHORIZATION"
-	AuditLogEventNewDeviceCodeAuthorization AuditLogEvent = "NEW_DEVICE_CODE_AUTHORIZATION"
-	AuditLogEventPasskeyAdded               AuditLogEvent = "PASSKEY_ADDED"
-	AuditLogEventPasskeyRemoved             AuditLogEvent = "PASSKEY_REMOVED"
+	AuditLogEventSignIn                      AuditLogEvent = "SIGN_IN"
+	AuditLogEventOneTimeAccessTokenSignIn    AuditLogEvent = "TOKEN_SIGN_IN"
+	AuditLogEventAccountCreated              AuditLogEvent = "ACCOUNT_CREATED"
+	AuditLogEventClientAuthorization         AuditLogEvent = "CLIENT_AUTHORIZATION"
+	AuditLogEventNewClientAuthorization      AuditLogEvent = "NEW_CLIENT_AUTHORIZATION"
+	AuditLogEventDeviceCodeAuthorization     AuditLogEvent = "DEVICE_CODE_AUTHORIZATION"
+	AuditLogEventNewDeviceCodeAuthorization  AuditLogEvent = "NEW_DEVICE_CODE_AUTHORIZATION"
+	AuditLogEventBackchannelAuthorization    AuditLogEvent = "BACKCHANNEL_AUTHORIZATION"
+	AuditLogEventNewBackchannelAuthorization AuditLogEvent = "NEW_BACKCHANNEL_AUTHORIZATION"
+	AuditLogEventPasskeyAdded                AuditLogEvent = "PASSKEY_ADDED"
+	AuditLogEventPasskeyRemoved              AuditLogEvent = "PASSKEY_REMOVED"
+	AuditLogEventTokenRevocation             AuditLogEvent = "TOKEN_REVOCATION"
+	AuditLogEventClientRegistration          AuditLogEvent = "CLIENT_REGISTRATION"
+	AuditLogEventClientRegistrationUpdate    AuditLogEvent = "CLIENT_REGISTRATION_UPDATE"
+	AuditLogEventClientRegistrationDelete    AuditLogEvent = "CLIENT_REGISTRATION_DELETE"
+	AuditLogEventTokenExchangeDelegation     AuditLogEvent = "TOKEN_EXCHANGE_DELEGATION"
+	AuditLogEventTokenExchangeImpersonation  AuditLogEvent = "TOKEN_EXCHANGE_IMPERSONATION"
+	AuditLogEventSamlAuthorization           AuditLogEvent = "SAML_AUTHORIZATION"
+	AuditLogEventForwardAuthAuthorization    AuditLogEvent = "FORWARD_AUTH_AUTHORIZATION"
+	AuditLogEventScimProvisioning            AuditLogEvent = "SCIM_PROVISIONING"
+
+	// Changes made through the API, their data contains the user that made the change and the differences
+	AuditLogEventUserCreated                AuditLogEvent = "USER_CREATED"
+	AuditLogEventUserUpdated                AuditLogEvent = "USER_UPDATED"
+	AuditLogEventUserDeleted                AuditLogEvent = "USER_DELETED"
+	AuditLogEventUserGroupCreated           AuditLogEvent = "USER_GROUP_CREATED"
+	AuditLogEventUserGroupUpdated           AuditLogEvent = "USER_GROUP_UPDATED"
+	AuditLogEventUserGroupDeleted           AuditLogEvent = "USER_GROUP_DELETED"
+	AuditLogEventOidcClientCreated          AuditLogEvent = "OIDC_CLIENT_CREATED"
+	AuditLogEventOidcClientUpdated          AuditLogEvent = "OIDC_CLIENT_UPDATED"
+	AuditLogEventOidcClientDeleted          AuditLogEvent = "OIDC_CLIENT_DELETED"
+	AuditLogEventOidcClientSecretCreated    AuditLogEvent = "OIDC_CLIENT_SECRET_CREATED"
+	AuditLogEventCustomClaimsUpdated        AuditLogEvent = "CUSTOM_CLAIMS_UPDATED"
+	AuditLogEventAppConfigUpdated           AuditLogEvent = "APP_CONFIG_UPDATED"
+	AuditLogEventScimServiceProviderCreated AuditLogEvent = "SCIM_SERVICE_PROVIDER_CREATED"
+	AuditLogEventScimServiceProviderUpdated AuditLogEvent = "SCIM_SERVICE_PROVIDER_UPDATED"
+	AuditLogEventScimServiceProviderDeleted AuditLogEvent = "SCIM_SERVICE_PROVIDER_DELETED"
+	AuditLogEventApiKeyCreated              AuditLogEvent = "API_KEY_CREATED"
+	AuditLogEventApiKeyRenewed              AuditLogEvent = "API_KEY_RENEWED"
+	AuditLogEventApiKeyRevoked              AuditLogEvent = "API_KEY_REVOKED"
+	AuditLogEventSignupTokenCreated         AuditLogEvent = "SIGNUP_TOKEN_CREATED"
+	AuditLogEventSignupTokenDeleted         AuditLogEvent = "SIGNUP_TOKEN_DELETED"
 )
 
+// AuditLogEvents are all the events that are recorded in the audit log
+var AuditLogEvents = []AuditLogEvent{
+	AuditLogEventSignIn,
+	AuditLogEventOneTimeAccessTokenSignIn,
+	AuditLogEventAccountCreated,
+	AuditLogEventClientAuthorization,
+	AuditLogEventNewClientAuthorization,
+	AuditLogEventDeviceCodeAuthorization,
+	AuditLogEventNewDeviceCodeAuthorization,
+	AuditLogEventBackchannelAuthorization,
+	AuditLogEventNewBackchannelAuthorization,
+	AuditLogEventPasskeyAdded,
+	AuditLogEventPasskeyRemoved,
+	AuditLogEventTokenRevocation,
+	AuditLogEventClientRegistration,
+	AuditLogEventClientRegistrationUpdate,
+	AuditLogEventClientRegistrationDelete,
+	AuditLogEventTokenExchangeDelegation,
+	AuditLogEventTokenExchangeImpersonation,
+	AuditLogEventSamlAuthorization,
+	AuditLogEventForwardAuthAuthorization,
+	AuditLogEventScimProvisioning,
+	AuditLogEventUserCreated,
+	AuditLogEventUserUpdated,
+	AuditLogEventUserDeleted,
+	AuditLogEventUserGroupCreated,
+	AuditLogEventUserGroupUpdated,
+	AuditLogEventUserGroupDeleted,
+	AuditLogEventOidcClientCreated,
+	AuditLogEventOidcClientUpdated,
+	AuditLogEventOidcClientDeleted,
+	AuditLogEventOidcClientSecretCreated,
+	AuditLogEventCustomClaimsUpdated,
+	AuditLogEventAppConfigUpdated,
+	AuditLogEventScimServiceProviderCreated,
+	AuditLogEventScimServiceProviderUpdated,
+	AuditLogEventScimServiceProviderDeleted,
+	AuditLogEventApiKeyCreated,
+	AuditLogEventApiKeyRenewed,
+	AuditLogEventApiKeyRevoked,
+	AuditLogEventSignupTokenCreated,
+	AuditLogEventSignupTokenDeleted,
+}
+
+// AuditLogActor is the authenticated user that makes a request, it's carried in the request context so changes
+// can be attributed to the user that made them
+type AuditLogActor struct {
+	UserID    string
+	IPAddress string
+	UserAgent string
+}
+
+type auditLogActorContextKey struct{}
+
+func ContextWithAuditLogActor(ctx context.Context, actor AuditLogActor) context.Context {
+	return context.WithValue(ctx, auditLogActorContextKey{}, actor)
+}
+
+func AuditLogActorFromContext(ctx context.Context) (AuditLogActor, bool) {
+	actor, ok := ctx.Value(auditLogActorContextKey{}).(AuditLogActor)
+	return actor, ok
+}
+
+// AuditLogChange is a change of a resource that is recorded in the audit log together with the actor that made it
+type AuditLogChange struct {
+	Event AuditLogEvent
+	// TargetID and TargetName identify the changed resource
+	TargetID   string
+	TargetName string
+	// TargetUserID is the user the changed resource belongs to. The change is recorded for the actor if it's empty,
+	// for example because the resource doesn't belong to a user or the user has been deleted.
+	TargetUserID string
+	// Before and After are the states of the resource before and after the change.
+	// Before is nil for created resources and After is nil for deleted ones.
+	Before any
+	After  any
+}
+
 // Scan and Value methods for GORM to handle the custom type
 
 func (e *AuditLogEvent) Scan(value any) error {
@@ -9,7 +9,9 @@ import (
 )
 
 type UserAuthorizedOidcClient struct {
-	Scope      datatype.StringList
+	Scope datatype.StringList
+	// Resources are the identifiers of the API resources the user authorized the client to access
+	Resources  datatype.StringList
 	LastUsedAt datatype.DateTime `sortable:"true"`
 
 	UserID string `gorm:"primary_key;"`
@@ -32,8 +34,25 @@ type OidcClient struct {
 	PkceEnabled                         bool `sortable:"true" filterable:"true"`
 	RequiresReauthentication            bool `sortable:"true" filterable:"true"`
 	RequiresPushedAuthorizationRequests bool `sortable:"true" filterable:"true"`
+	RequiresSignedRequestObject         bool `sortable:"true" filterable:"true"`
 	SkipConsent                         bool `sortable:"true" filterable:"true"`
+	RequiresDPoP                        bool `gorm:"column:requires_dpop"`
 	Credentials                         OidcClientCredentials
+	TokenExchange                       OidcClientTokenExchangePolicy
+	TokenLifetimes                      OidcClientTokenLifetimes
+	SubjectType                         OidcSubjectType
+	DefaultResponseMode                 string
+	IDTokenEncryptedResponseAlg         string
+	IDTokenEncryptedResponseEnc         string
+	UserinfoSignedResponseAlg           string
+	UserinfoEncryptedResponseAlg        string
+	UserinfoEncryptedResponseEnc        string
+	SectorIdentifierURI                 *string
+	BackchannelLogoutURI                *string
+	BackchannelLogoutSessionRequired    bool
+	FrontchannelLogoutURI               *string
+	BackchannelTokenDeliveryMode        string
+	BackchannelClientNotificationURI    *string `gorm:"column:backchannel_client_notification_endpoint"`
 	LaunchURL                           *string
 	IsGroupRestricted                   bool `sortable:"true" filterable:"true"`
 	PkceSupported                       bool `sortable:"true" filterable:"true"`
@@ -44,6 +63,21 @@ type OidcClient struct {
 	UserAuthorizedOidcClients []UserAuthorizedOidcClient `gorm:"foreignKey:ClientID;references:ID"`
 }
 
+// OidcSubjectType is the type of the subject identifiers a client receives, as defined in OpenID Connect Core section 8
+type OidcSubjectType string
+
+const (
+	// OidcSubjectTypePublic releases the user ID as subject to every client
+	OidcSubjectTypePublic OidcSubjectType = "public"
+	// OidcSubjectTypePairwise releases a different subject for the same user to each sector
+	OidcSubjectTypePairwise OidcSubjectType = "pairwise"
+)
+
+// UsesPairwiseSubjects returns whether the client receives pairwise instead of public subject identifiers
+func (c OidcClient) UsesPairwiseSubjects() bool {
+	return c.SubjectType == OidcSubjectTypePairwise
+}
+
 func (c OidcClient) HasLogo() bool {
 	return c.ImageType != nil && *c.ImageType != ""
 }
@@ -54,6 +88,20 @@ func (c OidcClient) HasDarkLogo() bool {
 
 type OidcClientCredentials struct { //nolint:recvcheck
 	FederatedIdentities []OidcClientFederatedIdentity `json:"federatedIdentities,omitempty"`
+	// JWKS and JWKSURI contain the public keys the client uses to sign its own client assertions (private_key_jwt)
+	// At most one of them is set
+	JWKS    string `json:"jwks,omitempty"` // JSON-encoded JWKS
+	JWKSURI string `json:"jwksUri,omitempty"`
+	// TLSClientAuthMethod is the method the client authenticates with a client certificate, if any:
+	// tls_client_auth for certificates issued by a trusted CA, or self_signed_tls_client_auth for certificates with one
+	// of the keys in JWKS or JWKSURI (RFC 8705 section 2)
+	TLSClientAuthMethod string `json:"tlsClientAuthMethod,omitempty"`
+	// The certificate of a tls_client_auth client must match the subject DN or subject alternative name that is set
+	TLSClientAuthSubjectDN string `json:"tlsClientAuthSubjectDn,omitempty"`
+	TLSClientAuthSANDNS    string `json:"tlsClientAuthSanDns,omitempty"`
+	TLSClientAuthSANURI    string `json:"tlsClientAuthSanUri,omitempty"`
+	TLSClientAuthSANIP     string `json:"tlsClientAuthSanIp,omitempty"`
+	TLSClientAuthSANEmail  string `json:"tlsClientAuthSanEmail,omitempty"`
 }
 
 type OidcClientFederatedIdentity struct {
@@ -78,6 +126,11 @@ func (occ OidcClientCredentials) FederatedIdentityForIssuer(issuer string) (Oidc
 	return OidcClientFederatedIdentity{}, false
 }
 
+// HasKeys returns true if the client has registered keys to sign its own client assertions
+func (occ OidcClientCredentials) HasKeys() bool {
+	return occ.JWKS != "" || occ.JWKSURI != ""
+}
+
 func (occ *OidcClientCredentials) Scan(value any) error {
 	return utils.UnmarshalJSONFromDatabase(occ, value)
 }
@@ -86,6 +139,114 @@ func (occ OidcClientCredentials) Value() (driver.Value, error) {
 	return json.Marshal(occ)
 }
 
+// OidcClientTokenExchangePolicy controls which tokens the client can exchange with the token exchange grant (RFC 8693)
+type OidcClientTokenExchangePolicy struct { //nolint:recvcheck
+	// SubjectTokenTypes are the token type URNs accepted as subject token; the grant is disabled if it's empty
+	SubjectTokenTypes []string `json:"subjectTokenTypes,omitempty"`
+	// SubjectClientIDs are the other clients whose access tokens can be exchanged
+	// Access tokens issued to the client itself are always accepted
+	SubjectClientIDs []string `json:"subjectClientIds,omitempty"`
+	// TrustedIssuers are the external issuers whose ID tokens and JWTs can be exchanged
+	TrustedIssuers     []OidcClientTokenExchangeIssuer `json:"trustedIssuers,omitempty"`
+	AllowedAudiences   []string                        `json:"allowedAudiences,omitempty"`
+	AllowedScopes      []string                        `json:"allowedScopes,omitempty"`
+	AllowDelegation    bool                            `json:"allowDelegation,omitempty"`
+	AllowImpersonation bool                            `json:"allowImpersonation,omitempty"`
+}
+
+type OidcClientTokenExchangeIssuer struct {
+	Issuer   string `json:"issuer"`
+	JWKS     string `json:"jwks,omitempty"`     // URL of the JWKS
+	Audience string `json:"audience,omitempty"` // Defaults to the client ID
+	// UserClaim is the claim that identifies the user: "email" (default) or "preferred_username"
+	UserClaim string `json:"userClaim,omitempty"`
+}
+
+// Enabled returns true if the client is allowed to use the token exchange grant
+func (p OidcClientTokenExchangePolicy) Enabled() bool {
+	return len(p.SubjectTokenTypes) > 0 && (p.AllowDelegation || p.AllowImpersonation)
+}
+
+func (p OidcClientTokenExchangePolicy) TrustedIssuer(issuer string) (OidcClientTokenExchangeIssuer, bool) {
+	if issuer == "" {
+		return OidcClientTokenExchangeIssuer{}, false
+	}
+
+	for _, ti := range p.TrustedIssuers {
+		if ti.Issuer == issuer {
+			return ti, true
+		}
+	}
+
+	return OidcClientTokenExchangeIssuer{}, false
+}
+
+func (p *OidcClientTokenExchangePolicy) Scan(value any) error {
+	return utils.UnmarshalJSONFromDatabase(p, value)
+}
+
+func (p OidcClientTokenExchangePolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// OidcClientTokenLifetimes overrides the default lifetimes of the tokens issued to the client
+// All lifetimes are in seconds, zero uses the default lifetime
+type OidcClientTokenLifetimes struct { //nolint:recvcheck
+	AccessToken       int `json:"accessToken,omitempty"`
+	IDToken           int `json:"idToken,omitempty"`
+	AuthorizationCode int `json:"authorizationCode,omitempty"`
+	RefreshToken      int `json:"refreshToken,omitempty"`
+	// RefreshTokenExpiry controls whether using a refresh token extends the lifetime of the grant
+	RefreshTokenExpiry OidcRefreshTokenExpiry `json:"refreshTokenExpiry,omitempty"`
+	// RefreshTokenIdleTimeout expires refresh tokens that aren't used within the timeout, even if their lifetime hasn't ended
+	RefreshTokenIdleTimeout int `json:"refreshTokenIdleTimeout,omitempty"`
+}
+
+// OidcRefreshTokenExpiry is how the expiry of the refresh tokens issued to a client is calculated
+type OidcRefreshTokenExpiry string
+
+const (
+	// OidcRefreshTokenExpirySliding issues every refresh token with the full lifetime, so the grant lasts as long as it's used
+	OidcRefreshTokenExpirySliding OidcRefreshTokenExpiry = "sliding"
+	// OidcRefreshTokenExpiryAbsolute counts the lifetime from the authorization, refreshing doesn't extend it
+	OidcRefreshTokenExpiryAbsolute OidcRefreshTokenExpiry = "absolute"
+)
+
+func (l *OidcClientTokenLifetimes) Scan(value any) error {
+	return utils.UnmarshalJSONFromDatabase(l, value)
+}
+
+func (l OidcClientTokenLifetimes) Value() (driver.Value, error) {
+	return json.Marshal(l)
+}
+
+// OidcScope is an admin-defined scope that releases custom claims to the clients that are allowed to request it
+type OidcScope struct {
+	Base
+
+	Name        string `sortable:"true"`
+	Description string
+	// ClaimKeys are the keys of the custom claims released with the scope
+	ClaimKeys datatype.StringList
+
+	AllowedClients []OidcClient `gorm:"many2many:oidc_scopes_allowed_clients;"`
+}
+
+// OidcAPIResource is an API that clients can request audience-restricted access tokens for with resource indicators
+type OidcAPIResource struct {
+	Base
+
+	Name string `sortable:"true"`
+	// Identifier is the absolute URI clients pass as resource parameter, and the audience of the issued access tokens
+	Identifier string `sortable:"true"`
+	// Scopes are the scopes the API accepts; the allowed clients may request them
+	Scopes datatype.StringList
+	// AccessTokenLifetime is the lifetime of access tokens for the API in seconds; 0 keeps the lifetime of the client
+	AccessTokenLifetime int
+
+	AllowedClients []OidcClient `gorm:"many2many:oidc_api_resources_allowed_clients;"`
+}
+
 type UrlList []string //nolint:recvcheck
 
 func (cu *UrlList) Scan(value any) error {
@@ -8,7 +8,43 @@ type ScimServiceProvider struct {
 	Endpoint     string `sortable:"true"`
 	Token        datatype.EncryptedString
 	LastSyncedAt *datatype.DateTime `sortable:"true"`
+	// LastPushedAt is the time the last changes were pushed to the service provider successfully
+	LastPushedAt *datatype.DateTime
+	// LastPushError is the error of the last change that couldn't be pushed, it's cleared once a push succeeds
+	LastPushError string
 
 	OidcClientID string
 	OidcClient   OidcClient `gorm:"foreignKey:OidcClientID;references:ID;"`
 }
+
+type ScimResourceType string
+
+const (
+	ScimResourceTypeUser  ScimResourceType = "User"
+	ScimResourceTypeGroup ScimResourceType = "Group"
+)
+
+type ScimChangeStatus string
+
+const (
+	ScimChangeStatusPending ScimChangeStatus = "pending"
+	ScimChangeStatusFailed  ScimChangeStatus = "failed"
+)
+
+// ScimChange is a change of a user, a group or a group membership that has to be pushed to a SCIM service provider.
+// It only references the changed resource, the current state of the resource is pushed when the change is delivered.
+type ScimChange struct {
+	Base
+
+	ServiceProviderID string
+	ResourceType      ScimResourceType
+	// ResourceID is kept after the resource has been deleted, so the deletion can be pushed as well
+	ResourceID string
+	// MemberID is the ID of the user whose membership in the group changed, it's empty for other changes
+	MemberID string
+
+	Status        ScimChangeStatus
+	Attempts      int
+	LastError     string
+	NextAttemptAt datatype.DateTime
+}
@@ -0,0 +1,20 @@
+package model
+
+import datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+
+// UserSession is a browser session of a user with Pocket ID itself
+// The access token of the session references it in its "sid" claim, so deleting the session signs the browser out
+type UserSession struct {
+	Base
+
+	AuthenticationMethod string
+	IpAddress            *string
+	UserAgent            string
+	Country              string
+	City                 string
+	LastSeenAt           datatype.DateTime `sortable:"true"`
+	ExpiresAt            datatype.DateTime
+
+	UserID string
+	User   User
+}
@@ -20,17 +20,20 @@ const parRequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
 type authorizationHandler struct {
 	provider             fosite.OAuth2Provider
 	authorizationService *authorizationService
+	requestObjects       *requestObjectResolver
 	baseURL              string
 }
 
 func newAuthorizationHandler(
 	provider fosite.OAuth2Provider,
 	authorizationService *authorizationService,
+	requestObjects *requestObjectResolver,
 	baseURL string,
 ) *authorizationHandler {
 	return &authorizationHandler{
 		provider:             provider,
 		authorizationService: authorizationService,
+		requestObjects:       requestObjects,
 		baseURL:              baseURL,
 	}
 }
@@ -55,6 +58,22 @@ func (h *authorizationHandler) authorize(c *gin.Context) {
 			return
 		}
 		c.Request.URL.RawQuery = query.Encode()
+	} else {
+		// The parameters of a request object replace the plain ones. A resumed interaction already carries the
+		// parameters of the verified request object.
+		err := c.Request.ParseForm()
+		if err != nil {
+			h.writeAuthorizeError(ctx, c, fosite.NewAuthorizeRequest(), fosite.ErrInvalidRequest.WithWrap(err))
+			return
+		}
+		form, err := h.requestObjects.resolve(ctx, c.Request.Form, c.Request.Form.Get("client_id"), false)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to resolve authorize request object", "error", err.Error())
+			// The redirect URI can't be trusted before the request object is verified, so the error isn't sent to the client
+			h.writeAuthorizeError(ctx, c, fosite.NewAuthorizeRequest(), err)
+			return
+		}
+		replaceRequestForm(c.Request, form)
 	}
 
 	// Treat the request as a pushed authorization request only when the request_uri carries the
@@ -63,6 +82,8 @@ func (h *authorizationHandler) authorize(c *gin.Context) {
 	hasPushedAuthorizationRequest := strings.HasPrefix(c.Query("request_uri"), parRequestURIPrefix)
 
 	ar, err := h.provider.NewAuthorizeRequest(ctx, c.Request)
+	// Errors are delivered with the default response mode of the client as well
+	applyDefaultResponseMode(ar)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to create authorize request", "error", err.Error())
 		h.writeAuthorizeError(ctx, c, ar, err)
@@ -71,6 +92,7 @@ func (h *authorizationHandler) authorize(c *gin.Context) {
 
 	authorization, err := h.authorizationService.authorize(ctx, authorizeInput{
 		userID:                        userID,
+		userSessionID:                 c.GetString("sessionID"),
 		authenticationMethod:          authenticationMethod,
 		authenticationTime:            typedAuthenticationTime,
 		requester:                     ar,
@@ -172,7 +194,8 @@ func requestMetaFromGin(c *gin.Context) requestMeta {
 func authorizeRequestParams(requester fosite.AuthorizeRequester) map[string]string {
 	params := make(map[string]string)
 	for key, values := range requester.GetRequestForm() {
-		if len(values) == 0 || key == "request_uri" || key == "interaction" {
+		// The resource parameter may be repeated, so the interaction session keeps the resources separately
+		if len(values) == 0 || key == "request_uri" || key == "interaction" || key == "resource" {
 			continue
 		}
 		params[key] = values[0]
@@ -181,9 +204,10 @@ func authorizeRequestParams(requester fosite.AuthorizeRequester) map[string]stri
 	return params
 }
 
-// relaxCSPForFormPost loosens the per-request Content-Security-Policy when the response is delivered via response_mode=form_post
+// relaxCSPForFormPost loosens the per-request Content-Security-Policy when the response is delivered via response_mode=form_post or form_post.jwt
 func (h *authorizationHandler) relaxCSPForFormPost(c *gin.Context, ar fosite.AuthorizeRequester) {
-	if ar.GetResponseMode() != fosite.ResponseModeFormPost || ar.GetRedirectURI() == nil {
+	responseMode := ar.GetResponseMode()
+	if (responseMode != fosite.ResponseModeFormPost && responseMode != ResponseModeFormPostJWT) || ar.GetRedirectURI() == nil {
 		return
 	}
 	c.Header("Content-Security-Policy", utils.BuildFormPostCSP(utils.GetCSPNonce(c), ar.GetRedirectURI().String(), formPostScriptCSPHash))
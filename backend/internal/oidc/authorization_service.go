@@ -69,6 +69,7 @@ func consentRequired(hasAlreadyAuthorizedClient, clientSkipsConsent bool, prompt
 // authorizeInput is the authorization request as provided by the handler.
 type authorizeInput struct {
 	userID                        string
+	userSessionID                 string
 	authenticationMethod          string
 	authenticationTime            time.Time
 	requester                     fosite.AuthorizeRequester
@@ -86,7 +87,9 @@ type authorizeRequest struct {
 	client             Client
 	prompt             promptValues
 	interactionSession *InteractionSession
-	now                time.Time
+	// resources are the API resources requested with resource indicators
+	resources []model.OidcAPIResource
+	now       time.Time
 }
 
 func (s *authorizationService) authorize(ctx context.Context, input authorizeInput) (authorizationResult, error) {
@@ -97,6 +100,11 @@ func (s *authorizationService) authorize(ctx context.Context, input authorizeInp
 		return authorizationResult{}, err
 	}
 
+	resources, err := client.requestedAPIResources(input.requester.GetRequestForm()["resource"])
+	if err != nil {
+		return authorizationResult{}, err
+	}
+
 	interactionSession, err := s.boundInteractionSession(ctx, input.interactionID, input.userID, client, input.requester)
 	if err != nil {
 		return authorizationResult{}, err
@@ -112,7 +120,7 @@ func (s *authorizationService) authorize(ctx context.Context, input authorizeInp
 			return authorizationResult{}, fosite.ErrLoginRequired
 		}
 
-		interactionSession, err := s.createInteractionSession(ctx, input.requester, input.requestParams, "", interactionRequirements{
+		interactionSession, err := s.createInteractionSession(ctx, input.requester, input.requestParams, resources, "", interactionRequirements{
 			AuthenticationRequired:   true,
 			ReauthenticationRequired: prompt.has("login") || client.RequiresReauthentication,
 			AccountSelectionRequired: prompt.has("select_account"),
@@ -130,6 +138,7 @@ func (s *authorizationService) authorize(ctx context.Context, input authorizeInp
 		client:             client,
 		prompt:             prompt,
 		interactionSession: interactionSession,
+		resources:          resources,
 		now:                time.Now().UTC(),
 	}
 
@@ -163,7 +172,7 @@ func (s *authorizationService) authorize(ctx context.Context, input authorizeInp
 		return result, nil
 	}
 
-	if err := s.claimsService.applyIDTokenClaims(ctx, result.Session, input.requester.GetGrantedScopes()); err != nil {
+	if err := s.claimsService.applyIDTokenClaims(ctx, result.Session, oidcClientOf(input.requester.GetClient()), input.requester.GetGrantedScopes()); err != nil {
 		return authorizationResult{}, err
 	}
 
@@ -205,7 +214,7 @@ func (s *authorizationService) authorizeAuthenticated(ctx context.Context, req a
 			return authorizationResult{RequiresInteraction: true, InteractionID: interactionSession.ID}, nil
 		}
 
-		created, err := s.createInteractionSession(ctx, req.requester, req.requestParams, req.userID, requirements)
+		created, err := s.createInteractionSession(ctx, req.requester, req.requestParams, req.resources, req.userID, requirements)
 		if err != nil {
 			return authorizationResult{}, err
 		}
@@ -223,12 +232,14 @@ func (s *authorizationService) authorizeAuthenticated(ctx context.Context, req a
 		}
 	}
 
-	hasAlreadyAuthorizedClient, err := s.consent(ctx, req.userID, req.client.GetID(), req.requester.GetRequestedScopes())
+	resourceIdentifiers := apiResourceIdentifiers(req.resources)
+	hasAlreadyAuthorizedClient, err := s.consent(ctx, req.userID, req.client.GetID(), req.requester.GetRequestedScopes(), resourceIdentifiers)
 	if err != nil {
 		return authorizationResult{}, err
 	}
 
 	session := s.buildAuthorizedSession(req, interactionSession, authenticationTime)
+	session.Resources = resourceIdentifiers
 
 	for _, scope := range req.requester.GetRequestedScopes() {
 		req.requester.GrantScope(scope)
@@ -264,7 +275,7 @@ func flagPkceSupportedClient(ctx context.Context, clientID string, tx *gorm.DB)
 func (s *authorizationService) resolveRequirements(ctx context.Context, req authorizeRequest, interactionSession *InteractionSession) (interactionRequirements, time.Time, error) {
 	authenticationTime := req.authenticationTime
 
-	hasAlreadyAuthorizedClient, err := s.hasAuthorizedClient(ctx, req.client.GetID(), req.userID, req.requester.GetRequestedScopes())
+	hasAlreadyAuthorizedClient, err := s.hasAuthorizedClient(ctx, req.client.GetID(), req.userID, req.requester.GetRequestedScopes(), apiResourceIdentifiers(req.resources))
 	if err != nil {
 		return interactionRequirements{}, authenticationTime, err
 	}
@@ -323,7 +334,9 @@ func (s *authorizationService) buildAuthorizedSession(req authorizeRequest, inte
 		requestedAt = req.now
 	}
 
-	return NewAuthenticatedSession(req.userID, req.authenticationMethod, authenticationTime, requestedAt)
+	session := NewAuthenticatedSession(req.userID, req.authenticationMethod, authenticationTime, requestedAt)
+	session.UserSessionID = req.userSessionID
+	return session
 }
 
 // interactionRequestQuery returns the authorize parameters stored for the interaction
@@ -343,6 +356,9 @@ func (s *authorizationService) interactionRequestQuery(ctx context.Context, inte
 			query.Set(key, value)
 		}
 	}
+	for _, resource := range interactionSession.Resources {
+		query.Add("resource", resource)
+	}
 	query.Set("interaction", interactionSession.ID)
 
 	return query, nil
@@ -389,6 +405,12 @@ func validateInteractionSessionBinding(interactionSession InteractionSession, us
 		}
 	}
 
+	for _, resource := range fosite.RemoveEmpty(requester.GetRequestForm()["resource"]) {
+		if !slices.Contains(interactionSession.Resources, resource) {
+			return fosite.ErrInvalidRequest.WithHint("The requested resources exceed the resources of the interaction session.")
+		}
+	}
+
 	return nil
 }
 
@@ -403,7 +425,7 @@ func (r interactionRequirements) any() bool {
 	return r.ConsentRequired || r.ReauthenticationRequired || r.AuthenticationRequired || r.AccountSelectionRequired
 }
 
-func (s *authorizationService) createInteractionSession(ctx context.Context, requester fosite.AuthorizeRequester, requestParams map[string]string, userID string, requirements interactionRequirements) (InteractionSession, error) {
+func (s *authorizationService) createInteractionSession(ctx context.Context, requester fosite.AuthorizeRequester, requestParams map[string]string, resources []model.OidcAPIResource, userID string, requirements interactionRequirements) (InteractionSession, error) {
 	parameters := make(map[string]string, len(requestParams))
 	for key, value := range requestParams {
 		parameters[key] = value
@@ -414,6 +436,7 @@ func (s *authorizationService) createInteractionSession(ctx context.Context, req
 			ID: requester.GetID(),
 		},
 		Scopes:                   datatype.StringList(requester.GetRequestedScopes()),
+		Resources:                apiResourceIdentifiers(resources),
 		ClientID:                 requester.GetClient().GetID(),
 		UserID:                   utils.PtrOrNil(userID),
 		ConsentRequired:          requirements.ConsentRequired,
@@ -464,7 +487,23 @@ func (s *authorizationService) getInteractionSession(ctx context.Context, intera
 		return interactionSessionForUser{}, err
 	}
 
-	return newInteractionSessionForUser(interactionSession)
+	return s.newInteractionSessionForUser(ctx, interactionSession)
+}
+
+// newInteractionSessionForUser returns the interaction session as shown to the user, including the
+// descriptions of the requested admin-defined scopes and the names of the requested API resources
+func (s *authorizationService) newInteractionSessionForUser(ctx context.Context, interactionSession InteractionSession) (interactionSessionForUser, error) {
+	registeredScopes, err := registeredScopesByName(dbFromContext(ctx, s.db), interactionSession.Scopes)
+	if err != nil {
+		return interactionSessionForUser{}, err
+	}
+
+	apiResources, err := apiResourcesByIdentifier(dbFromContext(ctx, s.db), interactionSession.Resources)
+	if err != nil {
+		return interactionSessionForUser{}, err
+	}
+
+	return newInteractionSessionForUser(interactionSession, registeredScopes, apiResources)
 }
 
 func (s *authorizationService) completeInteractionStep(ctx context.Context, interactionSessionID, userID string, step interactionStep, reauthenticationToken string, authenticationTime time.Time, meta requestMeta) (completeInteractionResponse, error) {
@@ -514,7 +553,7 @@ func (s *authorizationService) completeInteractionStep(ctx context.Context, inte
 		return completeInteractionResponse{RedirectURL: authorizeRedirectURL(interactionSession.ID)}, nil
 	}
 
-	interaction, err := newInteractionSessionForUser(interactionSession)
+	interaction, err := s.newInteractionSessionForUser(ctx, interactionSession)
 	if err != nil {
 		return completeInteractionResponse{}, err
 	}
@@ -566,7 +605,7 @@ func (s *authorizationService) completeConsentStep(ctx context.Context, interact
 	if err := bindInteractionSessionUser(interactionSession, userID); err != nil {
 		return err
 	}
-	hasAlreadyAuthorizedClient, err := s.consent(ctx, userID, interactionSession.ClientID, interactionSession.Scopes)
+	hasAlreadyAuthorizedClient, err := s.consent(ctx, userID, interactionSession.ClientID, interactionSession.Scopes, interactionSession.Resources)
 	if err != nil {
 		return err
 	}
@@ -596,7 +635,7 @@ func (s *authorizationService) populatePostAuthenticationRequirements(ctx contex
 
 func (s *authorizationService) interactionRequirementsForUser(ctx context.Context, userID string, interactionSession *InteractionSession, authenticationTime time.Time) (interactionRequirements, error) {
 	prompt := newPromptValues(interactionSession.Parameters["prompt"])
-	hasAlreadyAuthorizedClient, err := s.hasAuthorizedClient(ctx, interactionSession.ClientID, userID, interactionSession.Scopes)
+	hasAlreadyAuthorizedClient, err := s.hasAuthorizedClient(ctx, interactionSession.ClientID, userID, interactionSession.Scopes, interactionSession.Resources)
 	if err != nil {
 		return interactionRequirements{}, err
 	}
@@ -649,10 +688,10 @@ func requiresReauthenticationForMaxAge(maxAgeRaw string, authenticationTime time
 	return !now.Before(authenticationTime.UTC().Add(time.Duration(maxAge) * time.Second)), nil
 }
 
-func (s *authorizationService) consent(ctx context.Context, userID string, clientID string, scope []string) (hasAlreadyAuthorizedClient bool, err error) {
+func (s *authorizationService) consent(ctx context.Context, userID string, clientID string, scope []string, resources []string) (hasAlreadyAuthorizedClient bool, err error) {
 	db := dbFromContext(ctx, s.db)
 
-	hasAlreadyAuthorizedClient, err = s.hasAuthorizedClient(ctx, clientID, userID, scope)
+	hasAlreadyAuthorizedClient, err = s.hasAuthorizedClient(ctx, clientID, userID, scope, resources)
 	if err != nil {
 		return false, err
 	}
@@ -675,13 +714,14 @@ func (s *authorizationService) consent(ctx context.Context, userID string, clien
 		UserID:     userID,
 		ClientID:   clientID,
 		Scope:      scope,
+		Resources:  resources,
 		LastUsedAt: datatype.DateTime(time.Now()),
 	}
 
 	err = db.
 		Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"scope"}),
+			DoUpdates: clause.AssignmentColumns([]string{"scope", "resources"}),
 		}).
 		Create(&userAuthorizedClient).
 		Error
@@ -689,7 +729,7 @@ func (s *authorizationService) consent(ctx context.Context, userID string, clien
 	return hasAlreadyAuthorizedClient, err
 }
 
-func (s *authorizationService) hasAuthorizedClient(ctx context.Context, clientID, userID string, scope []string) (bool, error) {
+func (s *authorizationService) hasAuthorizedClient(ctx context.Context, clientID, userID string, scope []string, resources []string) (bool, error) {
 	var userAuthorizedOidcClient model.UserAuthorizedOidcClient
 	err := dbFromContext(ctx, s.db).
 		First(&userAuthorizedOidcClient, "client_id = ? AND user_id = ?", clientID, userID).
@@ -708,6 +748,13 @@ func (s *authorizationService) hasAuthorizedClient(ctx context.Context, clientID
 		}
 	}
 
+	authorizedResources := userAuthorizedOidcClient.Resources
+	for _, requestedResource := range resources {
+		if !slices.Contains(authorizedResources, requestedResource) {
+			return false, nil
+		}
+	}
+
 	return true, nil
 }
 
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/fosite"
+	"github.com/pocket-id/pocket-id/backend/internal/utils/cookie"
+)
+
+type backchannelAuthenticationHandler struct {
+	provider                         fosite.OAuth2Provider
+	backchannelAuthenticationService *backchannelAuthenticationService
+}
+
+func newBackchannelAuthenticationHandler(provider fosite.OAuth2Provider, backchannelAuthenticationService *backchannelAuthenticationService) *backchannelAuthenticationHandler {
+	return &backchannelAuthenticationHandler{
+		provider:                         provider,
+		backchannelAuthenticationService: backchannelAuthenticationService,
+	}
+}
+
+func (h *backchannelAuthenticationHandler) authenticate(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	response, err := h.backchannelAuthenticationService.createRequest(ctx, c.Request)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create backchannel authentication request", "error", err)
+		h.provider.WriteAccessError(ctx, c.Writer, nil, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *backchannelAuthenticationHandler) listRequests(c *gin.Context) {
+	requests, err := h.backchannelAuthenticationService.listRequests(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+func (h *backchannelAuthenticationHandler) approveRequest(c *gin.Context) {
+	authenticationTime, _ := c.Get("authenticationTime")
+	typedAuthenticationTime, _ := authenticationTime.(time.Time)
+	reauthenticationToken, _ := c.Cookie(cookie.ReauthenticationTokenCookieName)
+
+	err := h.backchannelAuthenticationService.approveRequest(
+		c.Request.Context(),
+		c.Param("id"),
+		c.GetString("userID"),
+		c.GetString("authenticationMethod"),
+		typedAuthenticationTime,
+		reauthenticationToken,
+		requestMetaFromGin(c),
+	)
+	if err != nil {
+		if errors.Is(err, fosite.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You're not allowed to access this service."})
+			return
+		}
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *backchannelAuthenticationHandler) denyRequest(c *gin.Context) {
+	err := h.backchannelAuthenticationService.denyRequest(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
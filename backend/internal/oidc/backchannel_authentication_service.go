@@ -0,0 +1,480 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ory/fosite"
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// GrantTypeCIBA is the grant type clients redeem approved backchannel authentication requests with
+	GrantTypeCIBA = "urn:openid:params:grant-type:ciba"
+
+	BackchannelTokenDeliveryModePoll = "poll"
+	BackchannelTokenDeliveryModePing = "ping"
+
+	// backchannelAuthenticationRequest is the key the expiry of a backchannel authentication request is stored under in the session
+	backchannelAuthenticationRequest fosite.TokenType = "backchannel_authentication_request"
+
+	defaultBackchannelAuthenticationLifespan = 5 * time.Minute
+	maxBackchannelAuthenticationLifespan     = 30 * time.Minute
+	backchannelAuthenticationInterval        = 5 * time.Second
+	backchannelNotificationTimeout           = 10 * time.Second
+	// The binding message is shown to the user on the consumption device and in the email, so it has to be short
+	maxBindingMessageLength = 64
+)
+
+// BackchannelTokenDeliveryModes are the token delivery modes clients can use for backchannel authentication
+var BackchannelTokenDeliveryModes = []string{BackchannelTokenDeliveryModePoll, BackchannelTokenDeliveryModePing}
+
+// Errors of the backchannel authentication endpoint and the CIBA grant, as defined in OpenID Connect CIBA sections 11 and 13
+var (
+	errUnknownUserID = &fosite.RFC6749Error{
+		ErrorField:       "unknown_user_id",
+		DescriptionField: "The OpenID Provider is not able to identify which end-user the client wishes to be authenticated by means of the hint provided in the request.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errInvalidBindingMessage = &fosite.RFC6749Error{
+		ErrorField:       "invalid_binding_message",
+		DescriptionField: "The binding message is invalid or unacceptable for use in the context of the given request.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errAuthorizationPending = &fosite.RFC6749Error{
+		ErrorField:       "authorization_pending",
+		DescriptionField: "The authorization request is still pending as the end-user hasn't yet been authenticated.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errExpiredToken = &fosite.RFC6749Error{
+		ErrorField:       "expired_token",
+		DescriptionField: "The auth_req_id has expired.",
+		CodeField:        http.StatusBadRequest,
+	}
+)
+
+// backchannelAuthenticationService implements OpenID Connect Client-Initiated Backchannel Authentication (CIBA).
+// A client starts the authentication of a user it identified with a hint, the user approves the request in Pocket ID,
+// and the client redeems the request at the token endpoint with the CIBA grant. Clients in ping mode are notified
+// when the user decided.
+type backchannelAuthenticationService struct {
+	authenticateClient   fosite.ClientAuthenticationStrategy
+	store                *Store
+	authorizationService *authorizationService
+	claimsService        *ClaimsService
+	signer               TokenSigner
+	subjects             SubjectResolver
+	notifier             BackchannelAuthenticationNotifier
+	auditLog             AuditLogger
+	httpClient           *http.Client
+	db                   *gorm.DB
+	baseURL              string
+}
+
+func newBackchannelAuthenticationService(
+	authenticateClient fosite.ClientAuthenticationStrategy,
+	store *Store,
+	authorizationService *authorizationService,
+	claimsService *ClaimsService,
+	signer TokenSigner,
+	subjects SubjectResolver,
+	notifier BackchannelAuthenticationNotifier,
+	auditLog AuditLogger,
+	httpClient *http.Client,
+	db *gorm.DB,
+	baseURL string,
+) *backchannelAuthenticationService {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &backchannelAuthenticationService{
+		authenticateClient:   authenticateClient,
+		store:                store,
+		authorizationService: authorizationService,
+		claimsService:        claimsService,
+		signer:               signer,
+		subjects:             subjects,
+		notifier:             notifier,
+		auditLog:             auditLog,
+		httpClient:           httpClient,
+		db:                   db,
+		baseURL:              baseURL,
+	}
+}
+
+// createRequest handles a backchannel authentication request as defined in OpenID Connect CIBA section 7
+func (s *backchannelAuthenticationService) createRequest(ctx context.Context, req *http.Request) (*dto.OidcBackchannelAuthenticationResponseDto, error) {
+	if req.Method != http.MethodPost {
+		return nil, fosite.ErrInvalidRequest.WithHint("Backchannel authentication requests must use the POST method.")
+	}
+	if err := req.ParseForm(); err != nil {
+		return nil, fosite.ErrInvalidRequest.WithHint("Unable to parse the request body.").WithWrap(err)
+	}
+	form := req.PostForm
+
+	authenticatedClient, err := s.authenticateClient(ctx, req, form)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := authenticatedClient.(Client)
+	if !ok || !client.GetGrantTypes().Has(GrantTypeCIBA) {
+		return nil, fosite.ErrUnauthorizedClient.WithHint("The client is not allowed to use backchannel authentication.")
+	}
+
+	scopes := fosite.RemoveEmpty(strings.Split(form.Get("scope"), " "))
+	if !slices.Contains(scopes, "openid") {
+		return nil, fosite.ErrInvalidScope.WithHint("The 'openid' scope is required.")
+	}
+	for _, scope := range scopes {
+		if !fosite.ExactScopeStrategy(client.GetScopes(), scope) {
+			return nil, fosite.ErrInvalidScope.WithHintf("The client is not allowed to request the scope '%s'.", scope)
+		}
+	}
+
+	bindingMessage := form.Get("binding_message")
+	if utf8.RuneCountInString(bindingMessage) > maxBindingMessageLength {
+		return nil, errInvalidBindingMessage.WithHintf("The binding message must not be longer than %d characters.", maxBindingMessageLength)
+	}
+
+	notificationToken := form.Get("client_notification_token")
+	if client.BackchannelTokenDeliveryMode == BackchannelTokenDeliveryModePing && notificationToken == "" {
+		return nil, fosite.ErrInvalidRequest.WithHint("The 'client_notification_token' parameter is required for clients that use the ping mode.")
+	}
+	if len(notificationToken) > 1024 {
+		return nil, fosite.ErrInvalidRequest.WithHint("The 'client_notification_token' parameter must not be longer than 1024 characters.")
+	}
+
+	lifespan := defaultBackchannelAuthenticationLifespan
+	if requestedExpiry := form.Get("requested_expiry"); requestedExpiry != "" {
+		seconds, err := strconv.Atoi(requestedExpiry)
+		if err != nil || seconds <= 0 {
+			return nil, fosite.ErrInvalidRequest.WithHint("The 'requested_expiry' parameter must be a positive integer.")
+		}
+		lifespan = time.Duration(min(seconds, int(maxBackchannelAuthenticationLifespan.Seconds()))) * time.Second
+	}
+
+	user, err := s.userFromHint(ctx, client, form)
+	if err != nil {
+		return nil, err
+	}
+	if !IsUserGroupAllowedToAuthorize(user, client.OidcClient) {
+		return nil, fosite.ErrAccessDenied.WithHint("The user is not allowed to access this client.")
+	}
+
+	authReqID, err := utils.GenerateRandomAlphanumericString(48)
+	if err != nil {
+		return nil, fosite.ErrServerError.WithWrap(err)
+	}
+
+	expiresAt := time.Now().UTC().Add(lifespan).Round(time.Second)
+	session := NewEmptySession()
+	session.Subject = user.ID
+	session.SetExpiresAt(backchannelAuthenticationRequest, expiresAt)
+
+	// Only the parameters that are needed once the user decided are stored; the hints are not
+	storedForm := url.Values{}
+	if bindingMessage != "" {
+		storedForm.Set("binding_message", bindingMessage)
+	}
+	if client.BackchannelTokenDeliveryMode == BackchannelTokenDeliveryModePing {
+		storedForm.Set("client_notification_token", notificationToken)
+		storedForm.Set("auth_req_id", authReqID)
+	}
+
+	request := fosite.NewDeviceRequest()
+	request.Client = client
+	request.RequestedScope = scopes
+	request.Form = storedForm
+	request.SetSession(session)
+	request.SetUserCodeState(fosite.UserCodeUnused)
+
+	if err := s.store.CreateBackchannelAuthenticationSession(ctx, backchannelAuthenticationSignature(authReqID), request); err != nil {
+		return nil, fosite.ErrServerError.WithWrap(err)
+	}
+
+	if s.notifier != nil {
+		s.notifier.NotifyBackchannelAuthenticationRequest(ctx, user, client.OidcClient, bindingMessage, s.baseURL+"/backchannel-authentication", expiresAt)
+	}
+
+	return &dto.OidcBackchannelAuthenticationResponseDto{
+		AuthReqID: authReqID,
+		ExpiresIn: int(lifespan.Seconds()),
+		Interval:  int(backchannelAuthenticationInterval.Seconds()),
+	}, nil
+}
+
+// userFromHint resolves the user a backchannel authentication request is for from the login_hint or id_token_hint
+func (s *backchannelAuthenticationService) userFromHint(ctx context.Context, client Client, form url.Values) (model.User, error) {
+	loginHint, idTokenHint, loginHintToken := form.Get("login_hint"), form.Get("id_token_hint"), form.Get("login_hint_token")
+
+	hints := 0
+	for _, hint := range []string{loginHint, idTokenHint, loginHintToken} {
+		if hint != "" {
+			hints++
+		}
+	}
+	if hints != 1 {
+		return model.User{}, fosite.ErrInvalidRequest.WithHint("Exactly one of the 'login_hint', 'id_token_hint' and 'login_hint_token' parameters is required.")
+	}
+	if loginHintToken != "" {
+		return model.User{}, fosite.ErrInvalidRequest.WithHint("The 'login_hint_token' parameter is not supported.")
+	}
+
+	query := s.db.WithContext(ctx).Preload("UserGroups")
+
+	var user model.User
+	var err error
+	if loginHint != "" {
+		// The login hint is the email address or the username of the user
+		err = query.First(&user, "email = ? OR username = ?", loginHint, loginHint).Error
+	} else {
+		userID, hintErr := s.userIDFromIDTokenHint(ctx, client, idTokenHint)
+		if hintErr != nil {
+			return model.User{}, hintErr
+		}
+		err = query.First(&user, "id = ?", userID).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Disabled) {
+		return model.User{}, errUnknownUserID
+	}
+	if err != nil {
+		return model.User{}, fosite.ErrServerError.WithWrap(err)
+	}
+	return user, nil
+}
+
+func (s *backchannelAuthenticationService) userIDFromIDTokenHint(ctx context.Context, client Client, idTokenHint string) (string, error) {
+	token, err := verifyIDTokenHint(s.signer, s.baseURL, idTokenHint)
+	if err != nil {
+		return "", errUnknownUserID.WithHint("The ID token hint is invalid.").WithWrap(err)
+	}
+
+	// The ID token must have been issued to the client, as the subject identifier may be specific to the client
+	audience, _ := token.Audience()
+	if !slices.Contains(audience, client.ID) {
+		return "", errUnknownUserID.WithHint("The ID token hint wasn't issued to the client.")
+	}
+	subject, ok := token.Subject()
+	if !ok || subject == "" {
+		return "", errUnknownUserID.WithHint("The ID token hint has no subject.")
+	}
+
+	userID, err := s.subjects.userIDForSubject(ctx, s.db, client.OidcClient, subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", errUnknownUserID
+	}
+	if err != nil {
+		return "", fosite.ErrServerError.WithWrap(err)
+	}
+	return userID, nil
+}
+
+// listRequests returns the pending backchannel authentication requests of the user
+func (s *backchannelAuthenticationService) listRequests(ctx context.Context, userID string) ([]dto.BackchannelAuthenticationRequestDto, error) {
+	requests, err := s.store.ListBackchannelAuthenticationSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.BackchannelAuthenticationRequestDto, 0)
+	for _, request := range requests {
+		if request.GetSession().GetSubject() != userID || request.GetUserCodeState() != fosite.UserCodeUnused {
+			continue
+		}
+
+		client := request.GetClient().(Client)
+		hasAuthorizedClient, err := s.authorizationService.hasAuthorizedClient(ctx, client.ID, userID, request.GetRequestedScopes(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, dto.BackchannelAuthenticationRequestDto{
+			ID:             request.GetID(),
+			Scope:          request.GetRequestedScopes(),
+			BindingMessage: request.GetRequestForm().Get("binding_message"),
+			ExpiresAt:      datatype.DateTime(request.GetSession().GetExpiresAt(backchannelAuthenticationRequest)),
+			// Like the device flow, backchannel authentication has no prompt parameter
+			AuthorizationRequired:    consentRequired(hasAuthorizedClient, client.SkipConsent, nil),
+			ReauthenticationRequired: client.RequiresReauthentication,
+			Client: dto.OidcClientMetaDataDto{
+				ID:                       client.ID,
+				Name:                     client.Name,
+				HasLogo:                  client.HasLogo(),
+				HasDarkLogo:              client.HasDarkLogo(),
+				LaunchURL:                client.LaunchURL,
+				RequiresReauthentication: client.RequiresReauthentication,
+			},
+		})
+	}
+	return result, nil
+}
+
+// approveRequest authenticates the user for a pending backchannel authentication request, after which the client can redeem it
+func (s *backchannelAuthenticationService) approveRequest(ctx context.Context, requestID, userID, authenticationMethod string, authenticationTime time.Time, reauthenticationToken string, meta requestMeta) error {
+	request, err := s.pendingRequest(ctx, requestID, userID)
+	if err != nil {
+		return err
+	}
+
+	client := request.GetClient().(Client)
+	var user model.User
+	if err = s.db.WithContext(ctx).Preload("UserGroups").First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	if !IsUserGroupAllowedToAuthorize(user, client.OidcClient) {
+		return fosite.ErrAccessDenied.WithHint("You are not allowed to access this service.")
+	}
+
+	for _, scope := range request.GetRequestedScopes() {
+		request.GrantScope(scope)
+	}
+	expiresAt := request.GetSession().GetExpiresAt(backchannelAuthenticationRequest)
+
+	err = withTx(ctx, s.db, func(ctx context.Context) error {
+		if client.RequiresReauthentication {
+			if reauthenticationToken == "" || s.authorizationService.reauth == nil {
+				return &common.ReauthenticationRequiredError{}
+			}
+
+			reauthenticatedAt, err := s.authorizationService.reauth.ConsumeReauthenticationToken(ctx, dbFromContext(ctx, s.db), reauthenticationToken, userID)
+			if err != nil {
+				return err
+			}
+			authenticationTime = reauthenticatedAt
+		}
+
+		session := NewAuthenticatedSession(userID, authenticationMethod, authenticationTime, request.GetRequestedAt())
+		session.SetExpiresAt(backchannelAuthenticationRequest, expiresAt)
+		if err = s.claimsService.applyIDTokenClaims(ctx, session, client.OidcClient, request.GetGrantedScopes()); err != nil {
+			return err
+		}
+		request.SetSession(session)
+		request.SetUserCodeState(fosite.UserCodeAccepted)
+
+		hasAlreadyAuthorizedClient, err := s.authorizationService.consent(ctx, userID, client.GetID(), request.GetRequestedScopes(), nil)
+		if err != nil {
+			return err
+		}
+
+		event := model.AuditLogEventBackchannelAuthorization
+		if !hasAlreadyAuthorizedClient {
+			event = model.AuditLogEventNewBackchannelAuthorization
+		}
+		s.auditLog.Create(ctx, event, meta.IPAddress, meta.UserAgent, userID, model.AuditLogData{"clientName": client.Name}, dbFromContext(ctx, s.db))
+
+		return s.store.UpdateBackchannelAuthenticationSession(ctx, request)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notifyClient(ctx, client, request)
+	return nil
+}
+
+// denyRequest rejects a pending backchannel authentication request, so the client receives an access_denied error
+func (s *backchannelAuthenticationService) denyRequest(ctx context.Context, requestID, userID string) error {
+	request, err := s.pendingRequest(ctx, requestID, userID)
+	if err != nil {
+		return err
+	}
+
+	request.SetUserCodeState(fosite.UserCodeRejected)
+	if err := s.store.UpdateBackchannelAuthenticationSession(ctx, request); err != nil {
+		return err
+	}
+
+	s.notifyClient(ctx, request.GetClient().(Client), request)
+	return nil
+}
+
+// pendingRequest returns a backchannel authentication request of the user that is still waiting for a decision
+func (s *backchannelAuthenticationService) pendingRequest(ctx context.Context, requestID, userID string) (fosite.DeviceRequester, error) {
+	request, err := s.store.GetBackchannelAuthenticationSessionByRequestID(ctx, requestID)
+	if errors.Is(err, fosite.ErrNotFound) {
+		return nil, &common.OidcBackchannelAuthenticationRequestNotFoundError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests of other users are reported as missing, so their IDs can't be probed
+	if request.GetSession().GetSubject() != userID ||
+		request.GetUserCodeState() != fosite.UserCodeUnused ||
+		time.Now().After(request.GetSession().GetExpiresAt(backchannelAuthenticationRequest)) {
+		return nil, &common.OidcBackchannelAuthenticationRequestNotFoundError{}
+	}
+	return request, nil
+}
+
+// notifyClient sends the ping callback of OpenID Connect CIBA section 10.2 to clients that use the ping mode
+func (s *backchannelAuthenticationService) notifyClient(ctx context.Context, client Client, request fosite.DeviceRequester) {
+	if client.BackchannelTokenDeliveryMode != BackchannelTokenDeliveryModePing || client.BackchannelClientNotificationURI == nil {
+		return
+	}
+
+	form := request.GetRequestForm()
+	notificationToken, authReqID := form.Get("client_notification_token"), form.Get("auth_req_id")
+	notificationURI := *client.BackchannelClientNotificationURI
+
+	// The notification must not delay the response to the user, and must be sent even if the user's request is cancelled
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.sendNotification(ctx, notificationURI, notificationToken, authReqID); err != nil {
+			slog.WarnContext(ctx, "Failed to notify client of backchannel authentication", "client_id", client.ID, "error", err)
+		}
+	}()
+}
+
+func (s *backchannelAuthenticationService) sendNotification(ctx context.Context, notificationURI, notificationToken, authReqID string) error {
+	ctx, cancel := context.WithTimeout(ctx, backchannelNotificationTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"auth_req_id": authReqID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notificationURI, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+notificationToken)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("the client notification endpoint responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// backchannelAuthenticationSignature returns the key a backchannel authentication request is stored under, so the
+// auth_req_id itself isn't stored
+func backchannelAuthenticationSignature(authReqID string) string {
+	return utils.CreateSha256Hash(authReqID)
+}
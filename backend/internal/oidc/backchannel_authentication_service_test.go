@@ -0,0 +1,276 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+type cibaNotification struct {
+	authorization string
+	authReqID     string
+}
+
+// TestBackchannelAuthentication drives backchannel authentication requests (CIBA) from the backchannel authentication
+// endpoint through the decision of the user to the token endpoint
+func TestBackchannelAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		baseURL      = "https://issuer.example.com"
+		userID       = "user-1"
+		pollClientID = "poll-client"
+		pingClientID = "ping-client"
+		otherID      = "other"
+		secret       = "client-secret"
+	)
+
+	notifications := make(chan cibaNotification, 1)
+	notificationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		notifications <- cibaNotification{authorization: r.Header.Get("Authorization"), authReqID: body["auth_req_id"]}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(notificationServer.Close)
+
+	db := testutils.NewDatabaseForTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: "tim", Email: new("tim@example.com")}).Error)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:                         model.Base{ID: pollClientID},
+		Name:                         "Poll Client",
+		Secret:                       string(hashed),
+		BackchannelTokenDeliveryMode: BackchannelTokenDeliveryModePoll,
+	}).Error)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:                             model.Base{ID: pingClientID},
+		Name:                             "Ping Client",
+		Secret:                           string(hashed),
+		BackchannelTokenDeliveryMode:     BackchannelTokenDeliveryModePing,
+		BackchannelClientNotificationURI: new(notificationServer.URL),
+	}).Error)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:   model.Base{ID: otherID},
+		Name:   "Other",
+		Secret: string(hashed),
+	}).Error)
+
+	store := NewStore(db)
+	signer := testTokenSigner{key: key}
+	provider, err := newProvider(store, nil, signer, Config{
+		BaseURL:      baseURL,
+		TokenBaseURL: baseURL,
+		Secret:       "test-secret",
+	})
+	require.NoError(t, err)
+
+	auditLogger := &fakeAuditLogger{}
+	claimsService := newClaimsService(db, nil, baseURL, nil, SubjectResolver{})
+	authorizationService := newAuthorizationService(db, newInteractionSessionService(db), claimsService, nil, auditLogger)
+	service := newBackchannelAuthenticationService(provider.config.ClientAuthenticationStrategy, store, authorizationService, claimsService, signer, SubjectResolver{}, nil, auditLogger, notificationServer.Client(), db, baseURL)
+	handler := newBackchannelAuthenticationHandler(provider, service)
+	tokenHandler := newTokenHandler(provider, claimsService, newDPoPValidator(store, []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), auditLogger, db)
+
+	post := func(t *testing.T, handle gin.HandlerFunc, path, clientID string, form url.Values) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, secret)
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+		handle(c)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+	authenticate := func(t *testing.T, clientID string, form url.Values) (int, map[string]any) {
+		t.Helper()
+		return post(t, handler.authenticate, "/api/oidc/backchannel-authentication", clientID, form)
+	}
+	redeem := func(t *testing.T, clientID, authReqID string) (int, map[string]any) {
+		t.Helper()
+		return post(t, tokenHandler.token, "/api/oidc/token", clientID, url.Values{
+			"grant_type":  {GrantTypeCIBA},
+			"auth_req_id": {authReqID},
+		})
+	}
+	requestID := func(t *testing.T) string {
+		t.Helper()
+		requests, err := service.listRequests(t.Context(), userID)
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		return requests[0].ID
+	}
+
+	t.Run("approved requests are redeemed once", func(t *testing.T) {
+		auditLogger.events = nil
+		code, body := authenticate(t, pollClientID, url.Values{
+			"scope":           {"openid email"},
+			"login_hint":      {"tim@example.com"},
+			"binding_message": {"4T7X"},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		require.InDelta(t, defaultBackchannelAuthenticationLifespan.Seconds(), body["expires_in"], 1)
+		require.InDelta(t, backchannelAuthenticationInterval.Seconds(), body["interval"], 0)
+		authReqID := body["auth_req_id"].(string)
+
+		code, body = redeem(t, pollClientID, authReqID)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "authorization_pending", body["error"])
+
+		requests, err := service.listRequests(t.Context(), userID)
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		require.Equal(t, "4T7X", requests[0].BindingMessage)
+		require.Equal(t, pollClientID, requests[0].Client.ID)
+		require.True(t, requests[0].AuthorizationRequired)
+
+		// Other users can't see or approve the request
+		otherRequests, err := service.listRequests(t.Context(), "user-2")
+		require.NoError(t, err)
+		require.Empty(t, otherRequests)
+		err = service.approveRequest(t.Context(), requests[0].ID, "user-2", "phr", time.Now(), "", requestMeta{})
+		require.ErrorAs(t, err, new(*common.OidcBackchannelAuthenticationRequestNotFoundError))
+
+		// Only the client the request was issued to can redeem it
+		code, body = redeem(t, pingClientID, authReqID)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_grant", body["error"])
+
+		require.NoError(t, service.approveRequest(t.Context(), requests[0].ID, userID, "phr", time.Now(), "", requestMeta{}))
+		require.Equal(t, []model.AuditLogEvent{model.AuditLogEventNewBackchannelAuthorization}, auditLogger.events)
+
+		code, body = redeem(t, pollClientID, authReqID)
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		require.NotEmpty(t, body["access_token"])
+		require.NotEmpty(t, body["refresh_token"])
+		require.NotEmpty(t, body["id_token"])
+		require.Equal(t, "openid email", body["scope"])
+
+		code, body = redeem(t, pollClientID, authReqID)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("denied requests return access_denied", func(t *testing.T) {
+		code, body := authenticate(t, pollClientID, url.Values{
+			"scope":      {"openid"},
+			"login_hint": {"tim"},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		authReqID := body["auth_req_id"].(string)
+
+		require.NoError(t, service.denyRequest(t.Context(), requestID(t), userID))
+
+		code, body = redeem(t, pollClientID, authReqID)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "access_denied", body["error"])
+	})
+
+	t.Run("ping clients are notified when the user decided", func(t *testing.T) {
+		code, body := authenticate(t, pingClientID, url.Values{
+			"scope":                     {"openid"},
+			"login_hint":                {"tim"},
+			"client_notification_token": {"notification-token"},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		authReqID := body["auth_req_id"].(string)
+
+		require.NoError(t, service.approveRequest(t.Context(), requestID(t), userID, "phr", time.Now(), "", requestMeta{}))
+
+		select {
+		case notification := <-notifications:
+			require.Equal(t, "Bearer notification-token", notification.authorization)
+			require.Equal(t, authReqID, notification.authReqID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the client wasn't notified")
+		}
+
+		code, body = redeem(t, pingClientID, authReqID)
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+	})
+
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			clientID string
+			form     url.Values
+			error    string
+		}{
+			{
+				name:     "client without backchannel authentication",
+				clientID: otherID,
+				form:     url.Values{"scope": {"openid"}, "login_hint": {"tim"}},
+				error:    fosite.ErrUnauthorizedClient.ErrorField,
+			},
+			{
+				name:     "missing openid scope",
+				clientID: pollClientID,
+				form:     url.Values{"scope": {"email"}, "login_hint": {"tim"}},
+				error:    fosite.ErrInvalidScope.ErrorField,
+			},
+			{
+				name:     "unknown user",
+				clientID: pollClientID,
+				form:     url.Values{"scope": {"openid"}, "login_hint": {"nobody@example.com"}},
+				error:    errUnknownUserID.ErrorField,
+			},
+			{
+				name:     "multiple hints",
+				clientID: pollClientID,
+				form:     url.Values{"scope": {"openid"}, "login_hint": {"tim"}, "id_token_hint": {"token"}},
+				error:    fosite.ErrInvalidRequest.ErrorField,
+			},
+			{
+				name:     "invalid ID token hint",
+				clientID: pollClientID,
+				form:     url.Values{"scope": {"openid"}, "id_token_hint": {"not-a-token"}},
+				error:    errUnknownUserID.ErrorField,
+			},
+			{
+				name:     "binding message too long",
+				clientID: pollClientID,
+				form:     url.Values{"scope": {"openid"}, "login_hint": {"tim"}, "binding_message": {strings.Repeat("x", maxBindingMessageLength+1)}},
+				error:    errInvalidBindingMessage.ErrorField,
+			},
+			{
+				name:     "ping mode without notification token",
+				clientID: pingClientID,
+				form:     url.Values{"scope": {"openid"}, "login_hint": {"tim"}},
+				error:    fosite.ErrInvalidRequest.ErrorField,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, body := authenticate(t, tt.clientID, tt.form)
+				require.NotEqual(t, http.StatusOK, code)
+				require.Equal(t, tt.error, body["error"])
+			})
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+const (
+	backchannelLogoutEvent     = "http://schemas.openid.net/event/backchannel-logout"
+	logoutTokenType            = "logout+jwt"
+	logoutTokenLifetime        = 2 * time.Minute
+	backchannelLogoutTimeout   = 10 * time.Second
+	backchannelLogoutBatchSize = 100
+	// A delivery is given up after this many attempts, which spans about 3 hours with the retry delays below
+	backchannelLogoutMaxAttempts = 10
+	backchannelLogoutRetryDelay  = 30 * time.Second
+	backchannelLogoutMaxDelay    = time.Hour
+	// Delivered and failed logouts are kept for this long, so the delivery status can be looked up
+	backchannelLogoutRetention = 7 * 24 * time.Hour
+)
+
+// BackchannelLogoutService notifies clients with OpenID Connect Back-Channel Logout 1.0 when sessions of a user end.
+// Logout tokens are recorded in the database first and delivered afterwards, failed deliveries are retried by a job.
+type BackchannelLogoutService struct {
+	db         *gorm.DB
+	store      *Store
+	signer     TokenSigner
+	subjects   SubjectResolver
+	httpClient *http.Client
+	baseURL    string
+
+	// delivering prevents concurrent deliveries of the same logout tokens
+	delivering sync.Mutex
+}
+
+func newBackchannelLogoutService(db *gorm.DB, store *Store, signer TokenSigner, subjects SubjectResolver, httpClient *http.Client, baseURL string) *BackchannelLogoutService {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &BackchannelLogoutService{
+		db:         db,
+		store:      store,
+		signer:     signer,
+		subjects:   subjects,
+		httpClient: httpClient,
+		baseURL:    baseURL,
+	}
+}
+
+// logoutTarget is a session of a user with a client that has to be logged out.
+// The session ID is empty for sessions that were created before session IDs were introduced.
+type logoutTarget struct {
+	clientID  string
+	userID    string
+	sessionID string
+}
+
+// LogoutUser records logout tokens for every client the user has a session with or has authorized.
+// It has to be called before the sessions of the user are revoked.
+func (s *BackchannelLogoutService) LogoutUser(ctx context.Context, tx *gorm.DB, userID string) error {
+	return s.LogoutUserClient(ctx, tx, userID, "")
+}
+
+// LogoutUserClient records logout tokens for the sessions of the user with the client, or with every client if
+// clientID is empty. It has to be called before the sessions are revoked.
+func (s *BackchannelLogoutService) LogoutUserClient(ctx context.Context, tx *gorm.DB, userID, clientID string) error {
+	ctx = contextWithTx(ctx, tx)
+
+	targets, err := s.store.findLogoutTargets(ctx, userID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to find sessions to log out: %w", err)
+	}
+
+	// Clients may keep their own session after the tokens have expired, so clients the user has authorized are
+	// logged out by subject as well
+	var authorizedClientIDs []string
+	query := dbFromContext(ctx, s.db).
+		Model(&model.UserAuthorizedOidcClient{}).
+		Where("user_id = ?", userID)
+	if clientID != "" {
+		query = query.Where("client_id = ?", clientID)
+	}
+	if err := query.Pluck("client_id", &authorizedClientIDs).Error; err != nil {
+		return fmt.Errorf("failed to load authorized clients: %w", err)
+	}
+
+	for _, authorizedClientID := range authorizedClientIDs {
+		hasSession := false
+		for _, target := range targets {
+			if target.clientID == authorizedClientID {
+				hasSession = true
+				break
+			}
+		}
+		if !hasSession {
+			targets = append(targets, logoutTarget{clientID: authorizedClientID, userID: userID})
+		}
+	}
+
+	return s.enqueue(ctx, targets)
+}
+
+// LogoutUserSession records logout tokens for the sessions of the user with clients that were authorized in the
+// browser session with the given ID. It has to be called before the sessions are revoked.
+func (s *BackchannelLogoutService) LogoutUserSession(ctx context.Context, tx *gorm.DB, userID, userSessionID string) error {
+	ctx = contextWithTx(ctx, tx)
+
+	_, targets, err := s.store.findUserSessionGrants(ctx, userID, userSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to find sessions to log out: %w", err)
+	}
+	return s.enqueue(ctx, targets)
+}
+
+// enqueue records a pending logout token for each target whose client has a back-channel logout URI
+func (s *BackchannelLogoutService) enqueue(ctx context.Context, targets []logoutTarget) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	clientIDs := make([]string, 0, len(targets))
+	for _, target := range targets {
+		clientIDs = append(clientIDs, target.clientID)
+	}
+
+	var clients []model.OidcClient
+	err := dbFromContext(ctx, s.db).
+		Where("id IN ? AND backchannel_logout_uri IS NOT NULL AND backchannel_logout_uri != ''", clientIDs).
+		Find(&clients).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load clients: %w", err)
+	}
+
+	sessionRequired := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		sessionRequired[client.ID] = client.BackchannelLogoutSessionRequired
+	}
+
+	now := datatype.DateTime(time.Now())
+	logouts := make([]backchannelLogout, 0, len(targets))
+	for _, target := range targets {
+		required, ok := sessionRequired[target.clientID]
+		if !ok {
+			continue
+		}
+		// A client that requires the "sid" claim can't match a logout token without it to a session
+		if required && target.sessionID == "" {
+			continue
+		}
+
+		logouts = append(logouts, backchannelLogout{
+			ClientID:      target.clientID,
+			UserID:        target.userID,
+			SessionID:     target.sessionID,
+			Status:        backchannelLogoutStatusPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(logouts) == 0 {
+		return nil
+	}
+
+	return dbFromContext(ctx, s.db).Create(&logouts).Error
+}
+
+// ScheduleDelivery delivers the pending logout tokens in the background.
+// Deliveries that fail are retried by the job that calls DeliverPending.
+//
+//nolint:contextcheck
+func (s *BackchannelLogoutService) ScheduleDelivery() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if err := s.DeliverPending(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to deliver back-channel logout tokens", slog.Any("error", err))
+		}
+	}()
+}
+
+// DeliverPending delivers the logout tokens whose next delivery attempt is due
+func (s *BackchannelLogoutService) DeliverPending(ctx context.Context) error {
+	// Another delivery is in progress, the logout tokens are picked up by the next run
+	if !s.delivering.TryLock() {
+		return nil
+	}
+	defer s.delivering.Unlock()
+
+	var logouts []backchannelLogout
+	err := s.db.
+		WithContext(ctx).
+		Preload("Client").
+		Where("status = ? AND next_attempt_at <= ?", backchannelLogoutStatusPending, datatype.DateTime(time.Now())).
+		Order("next_attempt_at").
+		Limit(backchannelLogoutBatchSize).
+		Find(&logouts).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load pending back-channel logouts: %w", err)
+	}
+
+	var errs []error
+	for i := range logouts {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		if err := s.deliverAndRecord(ctx, &logouts[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliverAndRecord delivers a logout token and records the outcome of the attempt
+func (s *BackchannelLogoutService) deliverAndRecord(ctx context.Context, logout *backchannelLogout) error {
+	now := time.Now()
+	logout.Attempts++
+
+	deliveryErr := s.deliver(ctx, logout)
+	switch {
+	case deliveryErr == nil:
+		logout.Status = backchannelLogoutStatusDelivered
+		logout.LastError = ""
+		logout.DeliveredAt = new(datatype.DateTime(now))
+	case logout.Attempts >= backchannelLogoutMaxAttempts:
+		logout.Status = backchannelLogoutStatusFailed
+		logout.LastError = deliveryErr.Error()
+	default:
+		logout.LastError = deliveryErr.Error()
+		logout.NextAttemptAt = datatype.DateTime(now.Add(backchannelLogoutBackoff(logout.Attempts)))
+	}
+
+	if deliveryErr != nil {
+		slog.WarnContext(ctx, "Failed to deliver back-channel logout token",
+			slog.String("client", logout.ClientID),
+			slog.Int("attempt", logout.Attempts),
+			slog.Any("error", deliveryErr),
+		)
+	}
+
+	err := s.db.
+		WithContext(ctx).
+		Model(logout).
+		Select("Status", "Attempts", "LastError", "NextAttemptAt", "DeliveredAt").
+		Updates(logout).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to record back-channel logout delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *BackchannelLogoutService) deliver(ctx context.Context, logout *backchannelLogout) error {
+	client := logout.Client
+	if client.BackchannelLogoutURI == nil || *client.BackchannelLogoutURI == "" {
+		return errors.New("the client no longer has a back-channel logout URI")
+	}
+
+	logoutToken, err := s.newLogoutToken(client, logout.UserID, logout.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to create logout token: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backchannelLogoutTimeout)
+	defer cancel()
+
+	form := url.Values{"logout_token": {logoutToken}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *client.BackchannelLogoutURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("the back-channel logout URI responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// newLogoutToken creates a logout token as defined in OpenID Connect Back-Channel Logout 1.0 section 2.4
+func (s *BackchannelLogoutService) newLogoutToken(client model.OidcClient, userID, sessionID string) (string, error) {
+	now := time.Now()
+	builder := jwt.NewBuilder().
+		Issuer(s.baseURL).
+		Audience([]string{client.ID}).
+		IssuedAt(now).
+		Expiration(now.Add(logoutTokenLifetime)).
+		JwtID(uuid.NewString()).
+		Subject(s.subjects.Subject(client, userID)).
+		Claim("events", map[string]any{backchannelLogoutEvent: map[string]any{}})
+	if sessionID != "" {
+		builder = builder.Claim("sid", sessionID)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+
+	return signJWT(s.signer, token, logoutTokenType)
+}
+
+// backchannelLogoutBackoff returns the delay before the next delivery attempt, which doubles with every attempt
+func backchannelLogoutBackoff(attempts int) time.Duration {
+	delay := backchannelLogoutRetryDelay
+	for i := 1; i < attempts && delay < backchannelLogoutMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, backchannelLogoutMaxDelay)
+}
@@ -0,0 +1,282 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestBackchannelLogoutServiceLogoutUser(t *testing.T) {
+	const userID = "user-1"
+
+	newService := func(t *testing.T) (*BackchannelLogoutService, *gorm.DB) {
+		t.Helper()
+		db := testutils.NewDatabaseForTest(t)
+		require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: "tim"}).Error)
+		require.NoError(t, db.Create(&model.User{Base: model.Base{ID: "user-2"}, Username: "craig"}).Error)
+
+		clients := []model.OidcClient{
+			{Base: model.Base{ID: "with-uri"}, Name: "With URI", BackchannelLogoutURI: stringPointer("https://a.example.com/logout")},
+			{Base: model.Base{ID: "session-required"}, Name: "Session required", BackchannelLogoutURI: stringPointer("https://b.example.com/logout"), BackchannelLogoutSessionRequired: true},
+			{Base: model.Base{ID: "without-uri"}, Name: "Without URI"},
+			{Base: model.Base{ID: "without-session"}, Name: "Without session", BackchannelLogoutURI: stringPointer("https://c.example.com/logout")},
+		}
+		require.NoError(t, db.Create(&clients).Error)
+		for _, client := range clients {
+			require.NoError(t, db.Create(&model.UserAuthorizedOidcClient{UserID: userID, ClientID: client.ID}).Error)
+		}
+
+		store := NewStore(db)
+		createSession := func(kind, key, clientID, subject, sessionID string) {
+			requester := newTestRequester(key, clientID, subject, "")
+			requester.GetSession().(*Session).SessionID = sessionID
+			if kind == sessionKindRefreshToken {
+				require.NoError(t, store.CreateRefreshTokenSession(t.Context(), key, "", requester))
+			} else {
+				require.NoError(t, store.CreateAccessTokenSession(t.Context(), key, requester))
+			}
+		}
+		createSession(sessionKindRefreshToken, "rt-1", "with-uri", userID, "sid-1")
+		createSession(sessionKindAccessToken, "at-1", "with-uri", userID, "sid-1")
+		createSession(sessionKindAccessToken, "at-2", "session-required", userID, "sid-2")
+		createSession(sessionKindAccessToken, "at-3", "without-uri", userID, "sid-3")
+		createSession(sessionKindAccessToken, "at-4", "with-uri", "user-2", "sid-4")
+
+		return newBackchannelLogoutService(db, store, nil, SubjectResolver{}, nil, "https://issuer.example.com"), db
+	}
+
+	recordedLogouts := func(t *testing.T, db *gorm.DB) map[string]string {
+		t.Helper()
+		var logouts []backchannelLogout
+		require.NoError(t, db.Find(&logouts).Error)
+
+		sessionIDs := make(map[string]string, len(logouts))
+		for _, logout := range logouts {
+			require.Equal(t, userID, logout.UserID)
+			require.Equal(t, backchannelLogoutStatusPending, logout.Status)
+			sessionIDs[logout.ClientID] = logout.SessionID
+		}
+		return sessionIDs
+	}
+
+	t.Run("logouts are recorded for every client with a back-channel logout URI", func(t *testing.T) {
+		service, db := newService(t)
+		require.NoError(t, service.LogoutUser(t.Context(), db, userID))
+
+		require.Equal(t, map[string]string{
+			"with-uri":         "sid-1",
+			"session-required": "sid-2",
+			// Authorized clients without a session are logged out by subject
+			"without-session": "",
+		}, recordedLogouts(t, db))
+	})
+
+	t.Run("logouts are only recorded for the given client", func(t *testing.T) {
+		service, db := newService(t)
+		require.NoError(t, service.LogoutUserClient(t.Context(), db, userID, "session-required"))
+
+		require.Equal(t, map[string]string{"session-required": "sid-2"}, recordedLogouts(t, db))
+	})
+
+	t.Run("client that requires a session ID isn't logged out without one", func(t *testing.T) {
+		service, db := newService(t)
+		require.NoError(t, db.Where("request_id = ?", "at-2").Delete(&OAuth2Session{}).Error)
+		require.NoError(t, service.LogoutUserClient(t.Context(), db, userID, "session-required"))
+
+		require.Empty(t, recordedLogouts(t, db))
+	})
+}
+
+func TestBackchannelLogoutServiceDeliverPending(t *testing.T) {
+	const (
+		baseURL = "https://issuer.example.com"
+		userID  = "user-1"
+	)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := testTokenSigner{key: key}
+	subjects := newSubjectResolver([]byte("pairwise-key"))
+
+	var (
+		status       int
+		logoutTokens []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logoutTokens = append(logoutTokens, r.PostFormValue("logout_token"))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	newService := func(t *testing.T, attempts int) (*BackchannelLogoutService, *gorm.DB, backchannelLogout) {
+		t.Helper()
+		logoutTokens = nil
+
+		db := testutils.NewDatabaseForTest(t)
+		require.NoError(t, db.Create(&model.OidcClient{
+			Base:                 model.Base{ID: "client"},
+			Name:                 "Client",
+			CallbackURLs:         model.UrlList{"https://app.example.com/callback"},
+			SubjectType:          model.OidcSubjectTypePairwise,
+			BackchannelLogoutURI: stringPointer(server.URL),
+		}).Error)
+
+		logout := backchannelLogout{
+			ClientID:      "client",
+			UserID:        userID,
+			SessionID:     "sid-1",
+			Status:        backchannelLogoutStatusPending,
+			Attempts:      attempts,
+			NextAttemptAt: datatype.DateTime(time.Now().Add(-time.Second)),
+		}
+		require.NoError(t, db.Create(&logout).Error)
+
+		return newBackchannelLogoutService(db, NewStore(db), signer, subjects, server.Client(), baseURL), db, logout
+	}
+
+	t.Run("logout token is delivered to the client", func(t *testing.T) {
+		status = http.StatusOK
+		service, db, logout := newService(t, 0)
+		require.NoError(t, service.DeliverPending(t.Context()))
+
+		require.Len(t, logoutTokens, 1)
+		publicKeys, err := signer.GetPublicKeySet()
+		require.NoError(t, err)
+		token, err := jwt.ParseString(logoutTokens[0], jwt.WithKeySet(publicKeys), jwt.WithIssuer(baseURL), jwt.WithAudience("client"))
+		require.NoError(t, err)
+
+		client := model.OidcClient{Base: model.Base{ID: "client"}, CallbackURLs: model.UrlList{"https://app.example.com/callback"}, SubjectType: model.OidcSubjectTypePairwise}
+		subject, _ := token.Subject()
+		require.Equal(t, subjects.Subject(client, userID), subject, "the subject must be the subject the client knows the user by")
+
+		var sessionID string
+		require.NoError(t, token.Get("sid", &sessionID))
+		require.Equal(t, "sid-1", sessionID)
+
+		var events map[string]any
+		require.NoError(t, token.Get("events", &events))
+		require.Contains(t, events, backchannelLogoutEvent)
+		require.False(t, token.Has("nonce"))
+
+		message, err := jws.Parse([]byte(logoutTokens[0]))
+		require.NoError(t, err)
+		typ, ok := message.Signatures()[0].ProtectedHeaders().Type()
+		require.True(t, ok)
+		require.Equal(t, logoutTokenType, typ)
+
+		var stored backchannelLogout
+		require.NoError(t, db.First(&stored, "id = ?", logout.ID).Error)
+		require.Equal(t, backchannelLogoutStatusDelivered, stored.Status)
+		require.Equal(t, 1, stored.Attempts)
+		require.NotNil(t, stored.DeliveredAt)
+
+		// Delivered logouts aren't delivered again
+		require.NoError(t, service.DeliverPending(t.Context()))
+		require.Len(t, logoutTokens, 1)
+	})
+
+	t.Run("failed delivery is retried later", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		service, db, logout := newService(t, 0)
+		require.NoError(t, service.DeliverPending(t.Context()))
+		require.Len(t, logoutTokens, 1)
+
+		var stored backchannelLogout
+		require.NoError(t, db.First(&stored, "id = ?", logout.ID).Error)
+		require.Equal(t, backchannelLogoutStatusPending, stored.Status)
+		require.Equal(t, 1, stored.Attempts)
+		require.Contains(t, stored.LastError, "500")
+		require.True(t, stored.NextAttemptAt.ToTime().After(time.Now()))
+
+		// The next attempt isn't due yet
+		require.NoError(t, service.DeliverPending(t.Context()))
+		require.Len(t, logoutTokens, 1)
+	})
+
+	t.Run("delivery is given up after the last attempt", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		service, db, logout := newService(t, backchannelLogoutMaxAttempts-1)
+		require.NoError(t, service.DeliverPending(t.Context()))
+
+		var stored backchannelLogout
+		require.NoError(t, db.First(&stored, "id = ?", logout.ID).Error)
+		require.Equal(t, backchannelLogoutStatusFailed, stored.Status)
+		require.Equal(t, backchannelLogoutMaxAttempts, stored.Attempts)
+	})
+}
+
+func TestBackchannelLogoutBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, backchannelLogoutBackoff(1))
+	require.Equal(t, time.Minute, backchannelLogoutBackoff(2))
+	require.Equal(t, 4*time.Minute, backchannelLogoutBackoff(4))
+	require.Equal(t, time.Hour, backchannelLogoutBackoff(9))
+	require.Equal(t, time.Hour, backchannelLogoutBackoff(20))
+}
+
+// TestEndSessionServiceRecordsBackchannelLogout verifies that RP-initiated logout logs out the session of the
+// ID token hint at the client with back-channel logout
+func TestEndSessionServiceRecordsBackchannelLogout(t *testing.T) {
+	const (
+		baseURL  = "https://issuer.example.com"
+		userID   = "user-1"
+		clientID = "client-1"
+	)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := testTokenSigner{key: key}
+
+	db := testutils.NewDatabaseForTest(t)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:                 model.Base{ID: clientID},
+		Name:                 "Test Client",
+		BackchannelLogoutURI: stringPointer("https://app.example.com/logout"),
+	}).Error)
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: "tim"}).Error)
+	require.NoError(t, db.Create(&model.UserAuthorizedOidcClient{UserID: userID, ClientID: clientID}).Error)
+
+	store := NewStore(db)
+	logoutService := newBackchannelLogoutService(db, store, signer, SubjectResolver{}, nil, baseURL)
+	// Prevent the background delivery from running during the test
+	logoutService.delivering.Lock()
+	t.Cleanup(logoutService.delivering.Unlock)
+	service := newEndSessionService(db, store, signer, SubjectResolver{}, logoutService, baseURL)
+
+	token, err := jwt.NewBuilder().
+		Issuer(baseURL).
+		Subject(userID).
+		Audience([]string{clientID}).
+		JwtID("id-token-jti").
+		IssuedAt(time.Now()).
+		Claim(common.TokenTypeClaim, idTokenType).
+		Claim("sid", "sid-1").
+		Build()
+	require.NoError(t, err)
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256(), key))
+	require.NoError(t, err)
+
+	_, _, err = service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: string(signed)}, userID)
+	require.NoError(t, err)
+
+	var logouts []backchannelLogout
+	require.NoError(t, db.Find(&logouts).Error)
+	require.Len(t, logouts, 1)
+	require.Equal(t, clientID, logouts[0].ClientID)
+	require.Equal(t, userID, logouts[0].UserID)
+	require.Equal(t, "sid-1", logouts[0].SessionID)
+}
@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ory/fosite"
+	fositeoauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+)
+
+var _ fosite.TokenEndpointHandler = (*cibaGrantHandler)(nil)
+
+// cibaGrantHandler implements the CIBA grant (OpenID Connect CIBA section 10.1).
+// A client polls the token endpoint with the auth_req_id of a backchannel authentication request, and receives the
+// tokens once the user approved the request. A request can be redeemed only once.
+type cibaGrantHandler struct {
+	store                *Store
+	accessTokenStrategy  fositeoauth2.AccessTokenStrategy
+	refreshTokenStrategy fositeoauth2.RefreshTokenStrategy
+	idTokenStrategy      openid.OpenIDConnectTokenStrategy
+	config               *fosite.Config
+}
+
+func (h *cibaGrantHandler) CanSkipClientAuth(context.Context, fosite.AccessRequester) bool {
+	return false
+}
+
+func (h *cibaGrantHandler) CanHandleTokenEndpointRequest(_ context.Context, requester fosite.AccessRequester) bool {
+	return requester.GetGrantTypes().ExactOne(GrantTypeCIBA)
+}
+
+func (h *cibaGrantHandler) HandleTokenEndpointRequest(ctx context.Context, requester fosite.AccessRequester) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return fosite.ErrUnknownRequest
+	}
+
+	client, ok := requester.GetClient().(Client)
+	if !ok || !client.GetGrantTypes().Has(GrantTypeCIBA) {
+		return fosite.ErrUnauthorizedClient.WithHint("The client is not allowed to use the CIBA grant.")
+	}
+
+	authReqID := requester.GetRequestForm().Get("auth_req_id")
+	if authReqID == "" {
+		return fosite.ErrInvalidRequest.WithHint("The 'auth_req_id' parameter is required.")
+	}
+
+	signature := backchannelAuthenticationSignature(authReqID)
+	request, err := h.store.GetBackchannelAuthenticationSession(ctx, signature)
+	if errors.Is(err, fosite.ErrNotFound) {
+		return fosite.ErrInvalidGrant.WithHint("The auth_req_id is invalid or was already used.")
+	}
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	if request.GetClient().GetID() != client.ID {
+		return fosite.ErrInvalidGrant.WithHint("The auth_req_id was issued to another client.")
+	}
+	if time.Now().After(request.GetSession().GetExpiresAt(backchannelAuthenticationRequest)) {
+		return errExpiredToken
+	}
+
+	switch request.GetUserCodeState() {
+	case fosite.UserCodeAccepted:
+	case fosite.UserCodeRejected:
+		if err := h.store.InvalidateBackchannelAuthenticationSession(ctx, signature); err != nil && !errors.Is(err, fosite.ErrNotFound) {
+			return fosite.ErrServerError.WithWrap(err)
+		}
+		return fosite.ErrAccessDenied.WithHint("The user denied the authentication request.")
+	default:
+		return errAuthorizationPending
+	}
+
+	// Only the request that flips the row to inactive may issue tokens, so concurrent polls can't redeem it twice
+	err = h.store.InvalidateBackchannelAuthenticationSession(ctx, signature)
+	if errors.Is(err, fosite.ErrNotFound) {
+		return fosite.ErrInvalidGrant.WithHint("The auth_req_id is invalid or was already used.")
+	}
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+
+	session, ok := request.GetSession().(*Session)
+	if !ok {
+		return fosite.ErrServerError.WithDebug("The session must be *oidc.Session.")
+	}
+	now := time.Now().UTC()
+	session.SetExpiresAt(fosite.AccessToken, now.Add(fosite.GetEffectiveLifespan(client, GrantTypeCIBA, fosite.AccessToken, h.config.GetAccessTokenLifespan(ctx))))
+	session.SetExpiresAt(fosite.RefreshToken, now.Add(fosite.GetEffectiveLifespan(client, GrantTypeCIBA, fosite.RefreshToken, h.config.GetRefreshTokenLifespan(ctx))))
+	requester.SetSession(session)
+
+	requester.SetRequestedScopes(request.GetRequestedScopes())
+	for _, scope := range request.GetGrantedScopes() {
+		requester.GrantScope(scope)
+	}
+	for _, audience := range request.GetGrantedAudience() {
+		requester.GrantAudience(audience)
+	}
+
+	return nil
+}
+
+func (h *cibaGrantHandler) PopulateTokenEndpointResponse(ctx context.Context, requester fosite.AccessRequester, responder fosite.AccessResponder) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return fosite.ErrUnknownRequest
+	}
+
+	accessToken, accessTokenSignature, err := h.accessTokenStrategy.GenerateAccessToken(ctx, requester)
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	refreshToken, refreshTokenSignature, err := h.refreshTokenStrategy.GenerateRefreshToken(ctx, requester)
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+
+	if err := h.store.CreateAccessTokenSession(ctx, accessTokenSignature, requester.Sanitize([]string{})); err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	if err := h.store.CreateRefreshTokenSession(ctx, refreshTokenSignature, accessTokenSignature, requester.Sanitize([]string{})); err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+
+	idTokenLifespan := fosite.GetEffectiveLifespan(requester.GetClient(), GrantTypeCIBA, fosite.IDToken, h.config.GetIDTokenLifespan(ctx))
+	idToken, err := h.idTokenStrategy.GenerateIDToken(ctx, idTokenLifespan, requester)
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+
+	responder.SetAccessToken(accessToken)
+	responder.SetTokenType("bearer")
+	responder.SetExpiresIn(time.Until(requester.GetSession().GetExpiresAt(fosite.AccessToken)))
+	responder.SetScopes(requester.GetGrantedScopes())
+	responder.SetExtra("refresh_token", refreshToken)
+	responder.SetExtra("id_token", idToken)
+	return nil
+}
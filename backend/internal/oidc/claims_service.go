@@ -21,14 +21,16 @@ type ClaimsService struct {
 	customClaims CustomClaimSource
 	baseURL      string
 	signer       TokenSigner
+	subjects     SubjectResolver
 }
 
-func newClaimsService(db *gorm.DB, customClaims CustomClaimSource, baseURL string, signer TokenSigner) *ClaimsService {
+func newClaimsService(db *gorm.DB, customClaims CustomClaimSource, baseURL string, signer TokenSigner, subjects SubjectResolver) *ClaimsService {
 	return &ClaimsService{
 		db:           db,
 		customClaims: customClaims,
 		baseURL:      baseURL,
 		signer:       signer,
+		subjects:     subjects,
 	}
 }
 
@@ -65,13 +67,13 @@ func (s *ClaimsService) ValidateUserAccess(ctx context.Context, userID string, c
 }
 
 // applyIDTokenClaims applies the claims of a user to the ID token claims in the session based on the requested scopes.
-func (s *ClaimsService) applyIDTokenClaims(ctx context.Context, session *Session, scopes fosite.Arguments) error {
+func (s *ClaimsService) applyIDTokenClaims(ctx context.Context, session *Session, client model.OidcClient, scopes fosite.Arguments) error {
 	userID := session.Subject
 	if userID == "" {
 		return nil
 	}
 
-	claims, err := s.GetUserClaims(ctx, userID, scopes)
+	claims, err := s.GetUserClaims(ctx, userID, client, scopes)
 	if err != nil {
 		return err
 	}
@@ -83,22 +85,25 @@ func (s *ClaimsService) applyIDTokenClaims(ctx context.Context, session *Session
 	// never overrides the real JWS header. The signer is always wired in production; it is
 	// only nil in unit tests that do not assert hash correctness.
 	if s.signer != nil {
-		alg, err := s.signer.GetKeyAlg()
+		_, _, alg, err := s.signer.GetSigningKey()
 		if err != nil {
 			return err
 		}
 		session.IDTokenHeaders().Add("alg", alg.String())
 	}
 
-	applyUserClaimsToIDToken(session, userID, claims)
+	applyUserClaimsToIDToken(session, claims)
 	return nil
 }
 
-func applyUserClaimsToIDToken(session *Session, userID string, claims map[string]any) {
+func applyUserClaimsToIDToken(session *Session, claims map[string]any) {
 	idTokenClaims := session.IDTokenClaims()
-	idTokenClaims.Subject = userID
+	idTokenClaims.Subject, _ = claims["sub"].(string)
 	idTokenClaims.Extra = claims
 	idTokenClaims.Extra[common.TokenTypeClaim] = idTokenType
+	if session.SessionID != "" {
+		idTokenClaims.Extra["sid"] = session.SessionID
+	}
 	if session.AuthenticationMethod != "" {
 		idTokenClaims.AuthenticationMethodsReferences = []string{session.AuthenticationMethod}
 	}
@@ -106,7 +111,8 @@ func applyUserClaimsToIDToken(session *Session, userID string, claims map[string
 
 // GetUserClaims retrieves the claims for a user based on the requested scopes. It includes standard claims
 // like "sub" and "email" as well as any custom claims defined for the user or their groups.
-func (s *ClaimsService) GetUserClaims(ctx context.Context, userID string, scopes []string) (map[string]any, error) {
+// The "sub" claim is the subject identifier of the user for the client.
+func (s *ClaimsService) GetUserClaims(ctx context.Context, userID string, client model.OidcClient, scopes []string) (map[string]any, error) {
 	db := dbFromContext(ctx, s.db)
 
 	var user model.User
@@ -120,22 +126,11 @@ func (s *ClaimsService) GetUserClaims(ctx context.Context, userID string, scopes
 
 	claims := make(map[string]any, 10)
 
-	if slices.Contains(scopes, "profile") {
-		customClaims, err := s.customClaims.GetCustomClaimsForUserWithUserGroups(ctx, user.ID, db)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, customClaim := range customClaims {
-			// A custom claim value can be a JSON document or a plain string
-			var jsonValue any
-			if err := json.Unmarshal([]byte(customClaim.Value), &jsonValue); err == nil {
-				claims[customClaim.Key] = jsonValue
-			} else {
-				claims[customClaim.Key] = customClaim.Value
-			}
-		}
+	if err := s.applyCustomClaims(ctx, db, user.ID, scopes, claims); err != nil {
+		return nil, err
+	}
 
+	if slices.Contains(scopes, "profile") {
 		claims["given_name"] = user.FirstName
 		claims["family_name"] = user.LastName
 		claims["name"] = user.FullName()
@@ -144,7 +139,7 @@ func (s *ClaimsService) GetUserClaims(ctx context.Context, userID string, scopes
 		claims["picture"] = s.baseURL + "/api/users/" + user.ID + "/profile-picture.png"
 	}
 
-	claims["sub"] = user.ID
+	claims["sub"] = s.subjects.Subject(client, user.ID)
 
 	// Only release the email claims when the user actually has an email. Emitting
 	// email_verified alongside a null/absent email (OIDC Core §5.1) is malformed and can
@@ -164,3 +159,59 @@ func (s *ClaimsService) GetUserClaims(ctx context.Context, userID string, scopes
 
 	return claims, nil
 }
+
+// applyCustomClaims adds the custom claims of a user that are released by the requested scopes.
+// A custom claim mapped to an admin-defined scope is only released with that scope, all other
+// custom claims are released with the "profile" scope.
+func (s *ClaimsService) applyCustomClaims(ctx context.Context, db *gorm.DB, userID string, scopes []string, claims map[string]any) error {
+	if s.customClaims == nil {
+		return nil
+	}
+
+	var registeredScopes []model.OidcScope
+	err := db.Select("name", "claim_keys").Find(&registeredScopes).Error
+	if err != nil {
+		return err
+	}
+
+	// Maps each scope-mapped claim key to whether one of its scopes was requested
+	scopedClaimKeys := make(map[string]bool)
+	for _, scope := range registeredScopes {
+		requested := slices.Contains(scopes, scope.Name)
+		for _, key := range scope.ClaimKeys {
+			scopedClaimKeys[key] = scopedClaimKeys[key] || requested
+		}
+	}
+
+	includeProfile := slices.Contains(scopes, "profile")
+	if !includeProfile && !slices.ContainsFunc(registeredScopes, func(scope model.OidcScope) bool {
+		return slices.Contains(scopes, scope.Name)
+	}) {
+		return nil
+	}
+
+	customClaims, err := s.customClaims.GetCustomClaimsForUserWithUserGroups(ctx, userID, db)
+	if err != nil {
+		return err
+	}
+
+	for _, customClaim := range customClaims {
+		released, scoped := scopedClaimKeys[customClaim.Key]
+		if !scoped {
+			released = includeProfile
+		}
+		if !released {
+			continue
+		}
+
+		// A custom claim value can be a JSON document or a plain string
+		var jsonValue any
+		if err := json.Unmarshal([]byte(customClaim.Value), &jsonValue); err == nil {
+			claims[customClaim.Key] = jsonValue
+		} else {
+			claims[customClaim.Key] = customClaim.Value
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package oidc
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/ory/fosite"
@@ -20,7 +21,7 @@ import (
 // refresh token.
 func TestClaimsServiceValidateUserAccess(t *testing.T) {
 	db := testutils.NewDatabaseForTest(t)
-	claimsService := newClaimsService(db, nil, "", nil)
+	claimsService := newClaimsService(db, nil, "", nil, SubjectResolver{})
 
 	group := model.UserGroup{Base: model.Base{ID: "group-allowed"}, Name: "allowed", FriendlyName: "Allowed"}
 	require.NoError(t, db.Create(&group).Error)
@@ -94,7 +95,7 @@ func TestClaimsServiceGetUserClaims(t *testing.T) {
 		{Key: "department", Value: "engineering"}, // plain string
 		{Key: "roles", Value: `["admin","dev"]`},  // JSON document
 	}}
-	service := newClaimsService(db, customClaims, baseURL, nil)
+	service := newClaimsService(db, customClaims, baseURL, nil, SubjectResolver{})
 
 	group := model.UserGroup{Base: model.Base{ID: "group-1"}, Name: "developers", FriendlyName: "Developers"}
 	require.NoError(t, db.Create(&group).Error)
@@ -112,13 +113,13 @@ func TestClaimsServiceGetUserClaims(t *testing.T) {
 	require.NoError(t, db.Model(&user).Association("UserGroups").Append(&group))
 
 	t.Run("openid only releases sub", func(t *testing.T) {
-		claims, err := service.GetUserClaims(t.Context(), userID, []string{"openid"})
+		claims, err := service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"openid"})
 		require.NoError(t, err)
 		require.Equal(t, map[string]any{"sub": userID}, claims)
 	})
 
 	t.Run("email scope releases email claims", func(t *testing.T) {
-		claims, err := service.GetUserClaims(t.Context(), userID, []string{"openid", "email"})
+		claims, err := service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"openid", "email"})
 		require.NoError(t, err)
 		require.Equal(t, userID, claims["sub"])
 		require.Equal(t, "tim@example.com", claims["email"])
@@ -128,13 +129,13 @@ func TestClaimsServiceGetUserClaims(t *testing.T) {
 	})
 
 	t.Run("groups scope releases group names", func(t *testing.T) {
-		claims, err := service.GetUserClaims(t.Context(), userID, []string{"groups"})
+		claims, err := service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"groups"})
 		require.NoError(t, err)
 		require.Equal(t, []string{"developers"}, claims["groups"])
 	})
 
 	t.Run("profile scope releases profile and custom claims", func(t *testing.T) {
-		claims, err := service.GetUserClaims(t.Context(), userID, []string{"profile"})
+		claims, err := service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"profile"})
 		require.NoError(t, err)
 		require.Equal(t, "Tim", claims["given_name"])
 		require.Equal(t, "Cook", claims["family_name"])
@@ -150,6 +151,23 @@ func TestClaimsServiceGetUserClaims(t *testing.T) {
 		// Profile must not leak email when the email scope was not requested.
 		require.NotContains(t, claims, "email")
 	})
+
+	t.Run("custom claims mapped to a scope are only released with that scope", func(t *testing.T) {
+		scope := model.OidcScope{Name: "billing:read", ClaimKeys: []string{"roles"}}
+		require.NoError(t, db.Create(&scope).Error)
+		t.Cleanup(func() { db.Delete(&scope) })
+
+		claims, err := service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"profile"})
+		require.NoError(t, err)
+		require.Equal(t, "engineering", claims["department"])
+		require.NotContains(t, claims, "roles")
+
+		claims, err = service.GetUserClaims(t.Context(), userID, model.OidcClient{}, []string{"openid", "billing:read"})
+		require.NoError(t, err)
+		require.Equal(t, []any{"admin", "dev"}, claims["roles"])
+		require.NotContains(t, claims, "department")
+		require.NotContains(t, claims, "given_name")
+	})
 }
 
 // TestClaimsServiceAppliesSigningAlgToIDTokenHeader verifies the ID token header carries the
@@ -161,13 +179,25 @@ func TestClaimsServiceAppliesSigningAlgToIDTokenHeader(t *testing.T) {
 
 	for _, alg := range []jwa.SignatureAlgorithm{jwa.RS256(), jwa.RS384(), jwa.ES512()} {
 		t.Run(alg.String(), func(t *testing.T) {
-			service := newClaimsService(db, nil, "", algTestSigner{alg: alg})
+			service := newClaimsService(db, nil, "", algTestSigner{alg: alg}, SubjectResolver{})
 
 			session := NewEmptySession()
 			session.Subject = "alg-user"
 
-			require.NoError(t, service.applyIDTokenClaims(t.Context(), session, fosite.Arguments{"openid"}))
+			require.NoError(t, service.applyIDTokenClaims(t.Context(), session, model.OidcClient{}, fosite.Arguments{"openid"}))
 			require.Equal(t, alg.String(), session.IDTokenHeaders().Get("alg"))
 		})
 	}
 }
+
+func TestClaimsServiceAppliesSessionIDToIDToken(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: "sid-user"}, Username: "sid"}).Error)
+	service := newClaimsService(db, nil, "", nil, SubjectResolver{})
+
+	session := NewAuthenticatedSession("sid-user", "passkey", time.Time{}, time.Time{})
+	require.NotEmpty(t, session.SessionID)
+
+	require.NoError(t, service.applyIDTokenClaims(t.Context(), session, model.OidcClient{}, fosite.Arguments{"openid"}))
+	require.Equal(t, session.SessionID, session.IDTokenClaims().Extra["sid"])
+}
@@ -35,3 +35,11 @@ func CleanupAbandonedInteractionSessions(ctx context.Context, db *gorm.DB) (int6
 		Delete(&InteractionSession{}, "created_at < ?", datatype.DateTime(time.Now().Add(-interactionSessionLifetime)))
 	return st.RowsAffected, st.Error
 }
+
+// CleanupBackchannelLogouts deletes back-channel logouts that were delivered or given up on before the retention period.
+func CleanupBackchannelLogouts(ctx context.Context, db *gorm.DB) (int64, error) {
+	st := db.
+		WithContext(ctx).
+		Delete(&backchannelLogout{}, "status != ? AND created_at < ?", backchannelLogoutStatusPending, datatype.DateTime(time.Now().Add(-backchannelLogoutRetention)))
+	return st.RowsAffected, st.Error
+}
@@ -1,15 +1,24 @@
 package oidc
 
 import (
+	"time"
+
 	"github.com/ory/fosite"
+	"github.com/pocket-id/pocket-id/backend/internal/common"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
 var _ fosite.Client = (*Client)(nil)
 var _ fosite.ResponseModeClient = (*Client)(nil)
+var _ fosite.ClientWithCustomTokenLifespans = (*Client)(nil)
 
 type Client struct {
 	model.OidcClient
+
+	// RegisteredScopes are the names of the admin-defined scopes the client is allowed to request
+	RegisteredScopes []string
+	// APIResources are the API resources the client is allowed to request access tokens for
+	APIResources []model.OidcAPIResource
 }
 
 func (c Client) GetID() string {
@@ -33,6 +42,12 @@ func (c Client) GetGrantTypes() fosite.Arguments {
 	if !c.IsPublic() {
 		grantTypes = append(grantTypes, string(fosite.GrantTypeClientCredentials))
 	}
+	if !c.IsPublic() && c.TokenExchange.Enabled() {
+		grantTypes = append(grantTypes, GrantTypeTokenExchange)
+	}
+	if !c.IsPublic() && c.BackchannelTokenDeliveryMode != "" {
+		grantTypes = append(grantTypes, GrantTypeCIBA)
+	}
 	return grantTypes
 }
 
@@ -41,15 +56,27 @@ func (c Client) GetResponseTypes() fosite.Arguments {
 }
 
 func (c Client) GetScopes() fosite.Arguments {
-	return fosite.Arguments{"openid", "profile", "email", "groups", "offline_access"}
+	scopes := make(fosite.Arguments, 0, len(common.StandardScopes)+len(c.RegisteredScopes))
+	scopes = append(scopes, common.StandardScopes...)
+	scopes = append(scopes, c.RegisteredScopes...)
+	// The scopes of the API resources the client may access are requestable as well
+	for _, resource := range c.APIResources {
+		for _, scope := range resource.Scopes {
+			if !scopes.Has(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
 }
 
 func (c Client) IsPublic() bool {
 	return c.OidcClient.IsPublic
 }
 
+// GetAudience returns the audiences the client may request tokens for: itself and the API resources it's allowed to access
 func (c Client) GetAudience() fosite.Arguments {
-	return fosite.Arguments{c.ID}
+	return append(fosite.Arguments{c.ID}, apiResourceIdentifiers(c.APIResources)...)
 }
 
 func (c Client) GetResponseModes() []fosite.ResponseModeType {
@@ -57,5 +84,53 @@ func (c Client) GetResponseModes() []fosite.ResponseModeType {
 		fosite.ResponseModeQuery,
 		fosite.ResponseModeFragment,
 		fosite.ResponseModeFormPost,
+		ResponseModeQueryJWT,
+		ResponseModeFragmentJWT,
+		ResponseModeFormPostJWT,
+		ResponseModeJWT,
+	}
+}
+
+// GetEffectiveLifespan returns the lifetime of the tokens of the given type the client configured, or the fallback
+// The lifetimes apply to every grant type. The refresh token lifetime is limited by the idle timeout, as every use of a
+// refresh token issues a new one.
+func (c Client) GetEffectiveLifespan(_ fosite.GrantType, tokenType fosite.TokenType, fallback time.Duration) time.Duration {
+	lifetimes := c.TokenLifetimes
+
+	var seconds int
+	switch tokenType {
+	case fosite.AccessToken:
+		seconds = lifetimes.AccessToken
+	case fosite.IDToken:
+		seconds = lifetimes.IDToken
+	case fosite.AuthorizeCode:
+		seconds = lifetimes.AuthorizationCode
+	case fosite.RefreshToken:
+		lifespan := refreshTokenLifespan(lifetimes, fallback)
+		if lifetimes.RefreshTokenIdleTimeout > 0 {
+			lifespan = min(lifespan, time.Duration(lifetimes.RefreshTokenIdleTimeout)*time.Second)
+		}
+		return lifespan
+	}
+
+	if seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// refreshTokenLifespan returns the lifetime of the grant a refresh token belongs to, ignoring the idle timeout
+func refreshTokenLifespan(lifetimes model.OidcClientTokenLifetimes, fallback time.Duration) time.Duration {
+	if lifetimes.RefreshToken <= 0 {
+		return fallback
+	}
+	return time.Duration(lifetimes.RefreshToken) * time.Second
+}
+
+// oidcClientOf returns the OIDC client behind a fosite client, or an empty client if the client isn't a Client
+func oidcClientOf(client fosite.Client) model.OidcClient {
+	if c, ok := client.(Client); ok {
+		return c.OidcClient
 	}
+	return model.OidcClient{}
 }
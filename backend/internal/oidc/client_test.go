@@ -0,0 +1,49 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+func TestClientGetEffectiveLifespan(t *testing.T) {
+	const fallback = time.Hour
+
+	t.Run("clients without lifetimes use the fallback", func(t *testing.T) {
+		client := Client{}
+		for _, tokenType := range []fosite.TokenType{fosite.AccessToken, fosite.IDToken, fosite.AuthorizeCode, fosite.RefreshToken} {
+			require.Equal(t, fallback, fosite.GetEffectiveLifespan(client, fosite.GrantTypeAuthorizationCode, tokenType, fallback))
+		}
+	})
+
+	t.Run("configured lifetimes apply to every grant type", func(t *testing.T) {
+		client := Client{OidcClient: model.OidcClient{TokenLifetimes: model.OidcClientTokenLifetimes{
+			AccessToken:       300,
+			IDToken:           600,
+			AuthorizationCode: 30,
+			RefreshToken:      90 * 24 * 60 * 60,
+		}}}
+
+		for _, grantType := range []fosite.GrantType{fosite.GrantTypeAuthorizationCode, fosite.GrantTypeRefreshToken, fosite.GrantTypeDeviceCode} {
+			require.Equal(t, 5*time.Minute, fosite.GetEffectiveLifespan(client, grantType, fosite.AccessToken, fallback))
+			require.Equal(t, 10*time.Minute, fosite.GetEffectiveLifespan(client, grantType, fosite.IDToken, fallback))
+			require.Equal(t, 90*24*time.Hour, fosite.GetEffectiveLifespan(client, grantType, fosite.RefreshToken, fallback))
+		}
+		require.Equal(t, 30*time.Second, fosite.GetEffectiveLifespan(client, fosite.GrantTypeAuthorizationCode, fosite.AuthorizeCode, fallback))
+	})
+
+	t.Run("the idle timeout limits the refresh token lifetime", func(t *testing.T) {
+		client := Client{OidcClient: model.OidcClient{TokenLifetimes: model.OidcClientTokenLifetimes{
+			RefreshToken:            90 * 24 * 60 * 60,
+			RefreshTokenIdleTimeout: 7 * 24 * 60 * 60,
+		}}}
+		require.Equal(t, 7*24*time.Hour, fosite.GetEffectiveLifespan(client, fosite.GrantTypeRefreshToken, fosite.RefreshToken, fallback))
+
+		client.TokenLifetimes.RefreshToken = 0
+		require.Equal(t, fallback, fosite.GetEffectiveLifespan(client, fosite.GrantTypeRefreshToken, fosite.RefreshToken, fallback), "an idle timeout longer than the default lifetime must not extend it")
+	})
+}
@@ -113,12 +113,12 @@ func (s *deviceService) acceptDeviceCode(ctx context.Context, userCode, userID,
 
 		session := NewAuthenticatedSession(userID, authenticationMethod, authenticationTime, request.GetRequestedAt())
 
-		if err = s.claimsService.applyIDTokenClaims(ctx, session, request.GetGrantedScopes()); err != nil {
+		if err = s.claimsService.applyIDTokenClaims(ctx, session, oidcClientOf(request.GetClient()), request.GetGrantedScopes()); err != nil {
 			return err
 		}
 		request.SetSession(session)
 
-		hasAlreadyAuthorizedClient, err := s.authorizationService.consent(ctx, userID, client.GetID(), request.GetRequestedScopes())
+		hasAlreadyAuthorizedClient, err := s.authorizationService.consent(ctx, userID, client.GetID(), request.GetRequestedScopes(), nil)
 		if err != nil {
 			return err
 		}
@@ -153,7 +153,7 @@ func (s *deviceService) getDeviceCodeInfo(ctx context.Context, userCode, userID
 	client := request.GetClient().(Client)
 	authorizationRequired := true
 	if userID != "" {
-		hasAuthorizedClient, err := s.authorizationService.hasAuthorizedClient(ctx, client.GetID(), userID, request.GetRequestedScopes())
+		hasAuthorizedClient, err := s.authorizationService.hasAuthorizedClient(ctx, client.GetID(), userID, request.GetRequestedScopes(), nil)
 		if err != nil {
 			return nil, err
 		}
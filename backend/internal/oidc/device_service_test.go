@@ -105,7 +105,7 @@ func newTestDeviceServiceWithCode(t *testing.T, clientID, userID string, require
 	})
 	require.NoError(t, err)
 
-	claimsService := newClaimsService(db, nil, "", nil)
+	claimsService := newClaimsService(db, nil, "", nil, SubjectResolver{})
 	authorizationService := newAuthorizationService(db, newInteractionSessionService(db), claimsService, reauth, &fakeAuditLogger{})
 	service := newDeviceService(provider, store, provider.deviceStrategy, authorizationService, claimsService, &fakeAuditLogger{}, db)
 
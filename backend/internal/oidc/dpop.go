@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+)
+
+const (
+	dpopHeader      = "DPoP"
+	dpopNonceHeader = "DPoP-Nonce"
+	dpopProofType   = "dpop+jwt"
+
+	// accessTokenTypeDPoP is the token type of DPoP-bound access tokens, which is also the authorization scheme used to present them
+	accessTokenTypeDPoP = "DPoP"
+
+	// dpopProofLifetime is how long a proof is accepted after it was issued, which is also how long its jti is remembered
+	dpopProofLifetime = 5 * time.Minute
+	// dpopNonceLifetime is how long a nonce issued by the server is accepted
+	dpopNonceLifetime = 5 * time.Minute
+)
+
+// DPoPSigningAlgorithms are the algorithms accepted for DPoP proofs
+var DPoPSigningAlgorithms = asymmetricSigningAlgorithms()
+
+var (
+	errInvalidDPoPProof = &fosite.RFC6749Error{
+		ErrorField:       "invalid_dpop_proof",
+		DescriptionField: "The DPoP proof is invalid.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errUseDPoPNonce = &fosite.RFC6749Error{
+		ErrorField:       "use_dpop_nonce",
+		DescriptionField: "The DPoP proof must contain the nonce provided by the server.",
+		CodeField:        http.StatusBadRequest,
+	}
+)
+
+// dpopJTIStore remembers the jti of the proofs that were already used
+type dpopJTIStore interface {
+	ClientAssertionJWTValid(ctx context.Context, jti string) error
+	SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error
+}
+
+// dpopValidator validates DPoP proofs as defined in RFC 9449.
+// Nonces are stateless: they contain their issuance time and are authenticated with a key derived from the server secret,
+// so they are accepted by every instance.
+type dpopValidator struct {
+	jtis     dpopJTIStore
+	nonceKey []byte
+	// baseURLs are the URLs the endpoints can be reached at, which are accepted in the "htu" claim
+	baseURLs []string
+	now      func() time.Time
+}
+
+func newDPoPValidator(jtis dpopJTIStore, nonceKey []byte, baseURLs ...string) *dpopValidator {
+	urls := make([]string, 0, len(baseURLs))
+	for _, u := range baseURLs {
+		u = strings.TrimRight(u, "/")
+		if u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+
+	return &dpopValidator{
+		jtis:     jtis,
+		nonceKey: nonceKey,
+		baseURLs: urls,
+		now:      time.Now,
+	}
+}
+
+// validateProof validates the DPoP proof of the request, if any, and returns the JWK thumbprint of its key.
+// The returned thumbprint is empty if the request doesn't contain a proof.
+// If accessToken isn't empty, the proof must be bound to it through the "ath" claim.
+func (v *dpopValidator) validateProof(ctx context.Context, r *http.Request, path string, accessToken string) (string, error) {
+	proofs := r.Header.Values(dpopHeader)
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", errInvalidDPoPProof.WithHint("The request must contain a single DPoP proof.")
+	}
+	rawProof := []byte(proofs[0])
+
+	msg, err := jws.Parse(rawProof)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof is not a valid JWS.").WithWrap(err)
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+
+	typ, _ := headers.Type()
+	if !strings.EqualFold(typ, dpopProofType) {
+		return "", errInvalidDPoPProof.WithHintf("The DPoP proof must have the type '%s'.", dpopProofType)
+	}
+
+	alg, ok := headers.Algorithm()
+	if !ok || !slices.Contains(DPoPSigningAlgorithms, alg.String()) {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof is signed with an unsupported algorithm.")
+	}
+
+	key, ok := headers.JWK()
+	if !ok {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof must contain the public key in the 'jwk' header.")
+	}
+	isPrivate, err := jwk.IsPrivateKey(key)
+	if err != nil || isPrivate {
+		return "", errInvalidDPoPProof.WithHint("The 'jwk' header of the DPoP proof must contain a public key.")
+	}
+
+	// The time-based claims are validated below, because proofs don't have an expiration
+	proof, err := jwt.Parse(rawProof, jwt.WithKey(alg, key), jwt.WithValidate(false))
+	if err != nil {
+		return "", errInvalidDPoPProof.WithHint("The signature of the DPoP proof is invalid.").WithWrap(err)
+	}
+
+	jti, _ := proof.JwtID()
+	if jti == "" {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof is missing the 'jti' claim.")
+	}
+
+	var htm, htu string
+	_ = proof.Get("htm", &htm)
+	_ = proof.Get("htu", &htu)
+	if htm != r.Method {
+		return "", errInvalidDPoPProof.WithHint("The 'htm' claim of the DPoP proof doesn't match the method of the request.")
+	}
+	if !v.matchesURL(htu, path) {
+		return "", errInvalidDPoPProof.WithHint("The 'htu' claim of the DPoP proof doesn't match the URL of the request.")
+	}
+
+	now := v.now()
+	iat, ok := proof.IssuedAt()
+	if !ok || iat.After(now.Add(30*time.Second)) || iat.Before(now.Add(-dpopProofLifetime)) {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof is expired or was issued in the future.")
+	}
+
+	if accessToken != "" {
+		var ath string
+		_ = proof.Get("ath", &ath)
+		hash := sha256.Sum256([]byte(accessToken))
+		if !hmac.Equal([]byte(ath), []byte(base64.RawURLEncoding.EncodeToString(hash[:]))) {
+			return "", errInvalidDPoPProof.WithHint("The 'ath' claim of the DPoP proof doesn't match the access token.")
+		}
+	}
+
+	var nonce string
+	_ = proof.Get("nonce", &nonce)
+	if !v.validNonce(nonce) {
+		return "", errUseDPoPNonce
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", errInvalidDPoPProof.WithHint("Unable to compute the thumbprint of the DPoP key.").WithWrap(err)
+	}
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	// Scope the jti to the key, so that different clients can't make each other's proofs fail
+	replayKey := "dpop:" + jkt + ":" + jti
+	if err := v.jtis.ClientAssertionJWTValid(ctx, replayKey); err != nil {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof has already been used.").WithWrap(err)
+	}
+	if err := v.jtis.SetClientAssertionJWT(ctx, replayKey, iat.Add(dpopProofLifetime)); err != nil {
+		return "", errInvalidDPoPProof.WithHint("The DPoP proof has already been used.").WithWrap(err)
+	}
+
+	return jkt, nil
+}
+
+// validateTokenBinding checks that a request presenting an access token satisfies the DPoP binding of the token
+func (v *dpopValidator) validateTokenBinding(ctx context.Context, r *http.Request, path string, accessToken string, scheme string, session *Session) error {
+	if session.DPoPJKT == "" {
+		if strings.EqualFold(scheme, accessTokenTypeDPoP) {
+			return fosite.ErrRequestUnauthorized.WithDescription("The access token is not bound to a DPoP key.")
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(scheme, accessTokenTypeDPoP) {
+		return fosite.ErrRequestUnauthorized.WithDescription("The access token is bound to a DPoP key and must be sent with the DPoP authorization scheme.")
+	}
+
+	jkt, err := v.validateProof(ctx, r, path, accessToken)
+	if err != nil {
+		return err
+	}
+	if jkt == "" {
+		return errInvalidDPoPProof.WithHint("The request is missing the DPoP proof.")
+	}
+	if jkt != session.DPoPJKT {
+		return errInvalidDPoPProof.WithHint("The DPoP proof isn't signed with the key the access token is bound to.")
+	}
+
+	return nil
+}
+
+// setNonceHeader sends a fresh nonce to the client, to use in its next DPoP proof
+func (v *dpopValidator) setNonceHeader(w http.ResponseWriter) {
+	w.Header().Set(dpopNonceHeader, v.newNonce())
+}
+
+func (v *dpopValidator) matchesURL(htu string, path string) bool {
+	u, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	// The query and fragment are ignored, as defined in RFC 9449 section 4.3
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	htu = u.String()
+
+	for _, baseURL := range v.baseURLs {
+		if htu == baseURL+path {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *dpopValidator) newNonce() string {
+	issuedAt := strconv.FormatInt(v.now().Unix(), 10)
+	return issuedAt + "." + v.signNonce(issuedAt)
+}
+
+func (v *dpopValidator) validNonce(nonce string) bool {
+	issuedAt, signature, ok := strings.Cut(nonce, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(v.signNonce(issuedAt))) {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := v.now().Sub(time.Unix(unix, 0))
+	return age > -30*time.Second && age <= dpopNonceLifetime
+}
+
+func (v *dpopValidator) signNonce(issuedAt string) string {
+	mac := hmac.New(sha256.New, v.nonceKey)
+	mac.Write([]byte(issuedAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isDPoPError returns true if the error is about the DPoP proof of the request
+func isDPoPError(err *fosite.RFC6749Error) bool {
+	return err.ErrorField == errInvalidDPoPProof.ErrorField || err.ErrorField == errUseDPoPNonce.ErrorField
+}
+
+// accessTokenFromRequest returns the access token of the request together with the authorization scheme it was sent with.
+// Unlike fosite.AccessTokenFromRequest, it supports the DPoP scheme.
+func accessTokenFromRequest(r *http.Request) (token string, scheme string) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, accessTokenTypeDPoP) {
+		return strings.TrimSpace(token), accessTokenTypeDPoP
+	}
+	return fosite.AccessTokenFromRequest(r), fosite.BearerAccessToken
+}
@@ -0,0 +1,315 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
+)
+
+const (
+	dpopTestBaseURL = "https://pocket-id.example.com"
+	dpopTestPath    = "/api/oidc/token"
+)
+
+type dpopTestProof struct {
+	typ        string
+	headerKey  jwk.Key
+	method     string
+	url        string
+	issuedAt   time.Time
+	jti        string
+	nonce      string
+	ath        string
+	signingKey jwk.Key
+}
+
+func newDPoPTestKey(t *testing.T) (jwk.Key, jwk.Key) {
+	t.Helper()
+
+	privateKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	publicKey, err := privateKey.PublicKey()
+	require.NoError(t, err)
+	return privateKey, publicKey
+}
+
+func signDPoPTestProof(t *testing.T, p dpopTestProof) string {
+	t.Helper()
+
+	builder := jwt.NewBuilder().
+		JwtID(p.jti).
+		IssuedAt(p.issuedAt).
+		Claim("htm", p.method).
+		Claim("htu", p.url)
+	if p.nonce != "" {
+		builder = builder.Claim("nonce", p.nonce)
+	}
+	if p.ath != "" {
+		builder = builder.Claim("ath", p.ath)
+	}
+	token, err := builder.Build()
+	require.NoError(t, err)
+
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.TypeKey, p.typ))
+	require.NoError(t, headers.Set(jws.JWKKey, p.headerKey))
+
+	alg, ok := p.signingKey.Algorithm()
+	require.True(t, ok)
+	signed, err := jwt.Sign(token, jwt.WithKey(alg, p.signingKey, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(signed)
+}
+
+func newDPoPTestRequest(t *testing.T, proof string) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, dpopTestPath, nil)
+	if proof != "" {
+		req.Header.Set(dpopHeader, proof)
+	}
+	return req
+}
+
+func TestDPoPValidatorValidateProof(t *testing.T) {
+	privateKey, publicKey := newDPoPTestKey(t)
+	thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	expectedJKT := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	newValidator := func() *dpopValidator {
+		store := &fakeFederatedStore{jtis: map[string]time.Time{}}
+		return newDPoPValidator(store, []byte("nonce-key"), dpopTestBaseURL)
+	}
+
+	validProof := func(v *dpopValidator, jti string) dpopTestProof {
+		return dpopTestProof{
+			typ:        dpopProofType,
+			headerKey:  publicKey,
+			method:     http.MethodPost,
+			url:        dpopTestBaseURL + dpopTestPath,
+			issuedAt:   time.Now(),
+			jti:        jti,
+			nonce:      v.newNonce(),
+			signingKey: privateKey,
+		}
+	}
+
+	t.Run("request without proof", func(t *testing.T) {
+		v := newValidator()
+		jkt, err := v.validateProof(t.Context(), newDPoPTestRequest(t, ""), dpopTestPath, "")
+		require.NoError(t, err)
+		assert.Empty(t, jkt)
+	})
+
+	t.Run("valid proof returns the key thumbprint", func(t *testing.T) {
+		v := newValidator()
+		proof := validProof(v, "jti-valid")
+		proof.url += "?ignored=true"
+
+		jkt, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signDPoPTestProof(t, proof)), dpopTestPath, "")
+		require.NoError(t, err)
+		assert.Equal(t, expectedJKT, jkt)
+	})
+
+	t.Run("proof can't be replayed", func(t *testing.T) {
+		v := newValidator()
+		signed := signDPoPTestProof(t, validProof(v, "jti-replay"))
+
+		_, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signed), dpopTestPath, "")
+		require.NoError(t, err)
+
+		_, err = v.validateProof(t.Context(), newDPoPTestRequest(t, signed), dpopTestPath, "")
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+	})
+
+	t.Run("proof bound to the access token", func(t *testing.T) {
+		v := newValidator()
+		hash := sha256.Sum256([]byte("access-token"))
+		proof := validProof(v, "jti-ath")
+		proof.ath = base64.RawURLEncoding.EncodeToString(hash[:])
+		signed := signDPoPTestProof(t, proof)
+
+		_, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signed), dpopTestPath, "other-access-token")
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+
+		jkt, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signed), dpopTestPath, "access-token")
+		require.NoError(t, err)
+		assert.Equal(t, expectedJKT, jkt)
+	})
+
+	t.Run("missing or expired nonce", func(t *testing.T) {
+		v := newValidator()
+		proof := validProof(v, "jti-no-nonce")
+		proof.nonce = ""
+		_, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signDPoPTestProof(t, proof)), dpopTestPath, "")
+		requireRFC6749Error(t, err, errUseDPoPNonce.ErrorField)
+
+		v.now = func() time.Time { return time.Now().Add(-dpopNonceLifetime - time.Minute) }
+		proof = validProof(v, "jti-expired-nonce")
+		v.now = time.Now
+		_, err = v.validateProof(t.Context(), newDPoPTestRequest(t, signDPoPTestProof(t, proof)), dpopTestPath, "")
+		requireRFC6749Error(t, err, errUseDPoPNonce.ErrorField)
+	})
+
+	t.Run("nonce signed with another key", func(t *testing.T) {
+		v := newValidator()
+		other := newDPoPValidator(&fakeFederatedStore{jtis: map[string]time.Time{}}, []byte("other-nonce-key"), dpopTestBaseURL)
+		proof := validProof(other, "jti-foreign-nonce")
+		_, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signDPoPTestProof(t, proof)), dpopTestPath, "")
+		requireRFC6749Error(t, err, errUseDPoPNonce.ErrorField)
+	})
+
+	invalidProofs := map[string]func(p *dpopTestProof){
+		"wrong type":         func(p *dpopTestProof) { p.typ = "JWT" },
+		"wrong method":       func(p *dpopTestProof) { p.method = http.MethodGet },
+		"wrong url":          func(p *dpopTestProof) { p.url = "https://other.example.com" + dpopTestPath },
+		"missing jti":        func(p *dpopTestProof) { p.jti = "" },
+		"issued too early":   func(p *dpopTestProof) { p.issuedAt = time.Now().Add(-dpopProofLifetime - time.Minute) },
+		"issued in future":   func(p *dpopTestProof) { p.issuedAt = time.Now().Add(5 * time.Minute) },
+		"private key in jwk": func(p *dpopTestProof) { p.headerKey = p.signingKey },
+		"signed with another key": func(p *dpopTestProof) {
+			otherKey, _ := newDPoPTestKey(t)
+			p.signingKey = otherKey
+		},
+	}
+	for name, mutate := range invalidProofs {
+		t.Run(name, func(t *testing.T) {
+			v := newValidator()
+			proof := validProof(v, "jti-"+name)
+			mutate(&proof)
+
+			_, err := v.validateProof(t.Context(), newDPoPTestRequest(t, signDPoPTestProof(t, proof)), dpopTestPath, "")
+			requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+		})
+	}
+
+	t.Run("multiple proofs", func(t *testing.T) {
+		v := newValidator()
+		req := newDPoPTestRequest(t, signDPoPTestProof(t, validProof(v, "jti-multiple-1")))
+		req.Header.Add(dpopHeader, signDPoPTestProof(t, validProof(v, "jti-multiple-2")))
+
+		_, err := v.validateProof(t.Context(), req, dpopTestPath, "")
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+	})
+}
+
+func TestBindDPoPKey(t *testing.T) {
+	client := Client{OidcClient: model.OidcClient{Base: model.Base{ID: "client"}}}
+	dpopClient := Client{OidcClient: model.OidcClient{Base: model.Base{ID: "dpop-client"}, RequiresDPoP: true}}
+
+	t.Run("binds the tokens to the proof key", func(t *testing.T) {
+		session := NewEmptySession()
+		require.NoError(t, bindDPoPKey(session, client, "jkt"))
+		assert.Equal(t, "jkt", session.DPoPJKT)
+		assert.Equal(t, map[string]any{"jkt": "jkt"}, session.JWTClaims.Extra["cnf"])
+		assert.Equal(t, map[string]any{"jkt": "jkt"}, session.GetExtraClaims()["cnf"])
+	})
+
+	t.Run("tokens stay unbound without proof", func(t *testing.T) {
+		session := NewEmptySession()
+		require.NoError(t, bindDPoPKey(session, client, ""))
+		assert.Empty(t, session.DPoPJKT)
+		assert.NotContains(t, session.GetJWTClaims().ToMapClaims(), "cnf")
+	})
+
+	t.Run("client that requires DPoP", func(t *testing.T) {
+		err := bindDPoPKey(NewEmptySession(), dpopClient, "")
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+
+		require.NoError(t, bindDPoPKey(NewEmptySession(), dpopClient, "jkt"))
+	})
+
+	t.Run("refreshed tokens stay bound to the original key", func(t *testing.T) {
+		session := NewEmptySession()
+		session.BindDPoPKey("original-jkt")
+
+		requireRFC6749Error(t, bindDPoPKey(session, client, ""), errInvalidDPoPProof.ErrorField)
+		requireRFC6749Error(t, bindDPoPKey(session, client, "other-jkt"), errInvalidDPoPProof.ErrorField)
+		require.NoError(t, bindDPoPKey(session, client, "original-jkt"))
+	})
+}
+
+func TestDPoPValidatorValidateTokenBinding(t *testing.T) {
+	privateKey, publicKey := newDPoPTestKey(t)
+	thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+
+	v := newDPoPValidator(&fakeFederatedStore{jtis: map[string]time.Time{}}, []byte("nonce-key"), dpopTestBaseURL)
+	boundSession := NewEmptySession()
+	boundSession.BindDPoPKey(base64.RawURLEncoding.EncodeToString(thumbprint))
+
+	const accessToken = "access-token"
+	hash := sha256.Sum256([]byte(accessToken))
+	newProof := func(jti string, signingKey jwk.Key, headerKey jwk.Key) string {
+		return signDPoPTestProof(t, dpopTestProof{
+			typ:        dpopProofType,
+			headerKey:  headerKey,
+			method:     http.MethodPost,
+			url:        dpopTestBaseURL + dpopTestPath,
+			issuedAt:   time.Now(),
+			jti:        jti,
+			nonce:      v.newNonce(),
+			ath:        base64.RawURLEncoding.EncodeToString(hash[:]),
+			signingKey: signingKey,
+		})
+	}
+
+	t.Run("unbound token with bearer scheme", func(t *testing.T) {
+		err := v.validateTokenBinding(t.Context(), newDPoPTestRequest(t, ""), dpopTestPath, accessToken, fosite.BearerAccessToken, NewEmptySession())
+		require.NoError(t, err)
+	})
+
+	t.Run("unbound token with DPoP scheme", func(t *testing.T) {
+		err := v.validateTokenBinding(t.Context(), newDPoPTestRequest(t, ""), dpopTestPath, accessToken, accessTokenTypeDPoP, NewEmptySession())
+		require.ErrorIs(t, err, fosite.ErrRequestUnauthorized)
+	})
+
+	t.Run("bound token with bearer scheme", func(t *testing.T) {
+		req := newDPoPTestRequest(t, newProof("jti-bearer", privateKey, publicKey))
+		err := v.validateTokenBinding(t.Context(), req, dpopTestPath, accessToken, fosite.BearerAccessToken, boundSession)
+		require.ErrorIs(t, err, fosite.ErrRequestUnauthorized)
+	})
+
+	t.Run("bound token without proof", func(t *testing.T) {
+		err := v.validateTokenBinding(t.Context(), newDPoPTestRequest(t, ""), dpopTestPath, accessToken, accessTokenTypeDPoP, boundSession)
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+	})
+
+	t.Run("bound token with proof of another key", func(t *testing.T) {
+		otherPrivateKey, otherPublicKey := newDPoPTestKey(t)
+		req := newDPoPTestRequest(t, newProof("jti-other-key", otherPrivateKey, otherPublicKey))
+		err := v.validateTokenBinding(t.Context(), req, dpopTestPath, accessToken, accessTokenTypeDPoP, boundSession)
+		requireRFC6749Error(t, err, errInvalidDPoPProof.ErrorField)
+	})
+
+	t.Run("bound token with valid proof", func(t *testing.T) {
+		req := newDPoPTestRequest(t, newProof("jti-valid", privateKey, publicKey))
+		err := v.validateTokenBinding(t.Context(), req, dpopTestPath, accessToken, accessTokenTypeDPoP, boundSession)
+		require.NoError(t, err)
+	})
+}
+
+func requireRFC6749Error(t *testing.T, err error, errorField string) {
+	t.Helper()
+
+	rfcErr, ok := errors.AsType[*fosite.RFC6749Error](err)
+	require.True(t, ok, "expected an RFC 6749 error, got %v", err)
+	require.Equal(t, errorField, rfcErr.ErrorField)
+}
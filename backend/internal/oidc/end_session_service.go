@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/lestrrat-go/jwx/v3/jws"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 	"github.com/pocket-id/pocket-id/backend/internal/common"
 	"github.com/pocket-id/pocket-id/backend/internal/dto"
@@ -15,57 +16,68 @@ import (
 )
 
 type endSessionService struct {
-	db      *gorm.DB
-	store   *Store
-	signer  TokenSigner
-	baseURL string
+	db                *gorm.DB
+	store             *Store
+	signer            TokenSigner
+	subjects          SubjectResolver
+	backchannelLogout *BackchannelLogoutService
+	baseURL           string
 }
 
-func newEndSessionService(db *gorm.DB, store *Store, signer TokenSigner, baseURL string) *endSessionService {
+func newEndSessionService(db *gorm.DB, store *Store, signer TokenSigner, subjects SubjectResolver, backchannelLogout *BackchannelLogoutService, baseURL string) *endSessionService {
 	return &endSessionService{
-		db:      db,
-		store:   store,
-		signer:  signer,
-		baseURL: baseURL,
+		db:                db,
+		store:             store,
+		signer:            signer,
+		subjects:          subjects,
+		backchannelLogout: backchannelLogout,
+		baseURL:           baseURL,
 	}
 }
 
 // endSession revokes the sessions belonging to the ID token hint and returns the
-// client's post-logout callback URL (empty if none is configured).
-func (s *endSessionService) endSession(ctx context.Context, input dto.OidcLogoutDto, userID string) (string, error) {
+// client's post-logout callback URL (empty if none is configured) and the front-channel
+// logout URLs the browser has to load to log the user out of the clients.
+func (s *endSessionService) endSession(ctx context.Context, input dto.OidcLogoutDto, userID string) (callbackURL string, frontchannelLogoutURLs []string, err error) {
 	if input.IdTokenHint == "" {
-		return "", &common.TokenInvalidError{}
+		return "", nil, &common.TokenInvalidError{}
 	}
 
-	token, err := s.verifyIDTokenHint(input.IdTokenHint)
+	token, err := verifyIDTokenHint(s.signer, s.baseURL, input.IdTokenHint)
 	if err != nil {
-		return "", &common.TokenInvalidError{}
+		return "", nil, &common.TokenInvalidError{}
 	}
 
 	clientIDs, ok := token.Audience()
 	if !ok || len(clientIDs) == 0 {
-		return "", &common.TokenInvalidError{}
+		return "", nil, &common.TokenInvalidError{}
 	}
 	clientID := clientIDs[0]
 	if input.ClientId != "" && clientID != input.ClientId {
-		return "", &common.OidcClientIdNotMatchingError{}
+		return "", nil, &common.OidcClientIdNotMatchingError{}
 	}
 
 	subject, ok := token.Subject()
 	if !ok || subject == "" {
-		return "", &common.TokenInvalidError{}
+		return "", nil, &common.TokenInvalidError{}
 	}
-	if userID != "" && subject != userID {
-		return "", &common.TokenInvalidError{}
+	subjectUserID, err := s.userIDForSubject(ctx, clientID, subject)
+	if err != nil {
+		return "", nil, err
+	}
+	if userID != "" && subjectUserID != userID {
+		return "", nil, &common.TokenInvalidError{}
 	}
-	userID = subject
+	userID = subjectUserID
 
 	idTokenJTI, ok := token.JwtID()
 	if !ok {
-		return "", &common.TokenInvalidError{}
+		return "", nil, &common.TokenInvalidError{}
 	}
 
-	var callbackURL string
+	// The session ID of the ID token identifies the session of the client that ends
+	sessionID, _ := idTokenSessionID(token)
+
 	err = withTx(ctx, s.db, func(ctx context.Context) error {
 		var authorizedClient model.UserAuthorizedOidcClient
 		err := dbFromContext(ctx, s.db).
@@ -84,17 +96,51 @@ func (s *endSessionService) endSession(ctx context.Context, input dto.OidcLogout
 			return err
 		}
 
+		if logoutURL, ok := frontchannelLogoutURL(&authorizedClient.Client, s.baseURL, sessionID); ok {
+			frontchannelLogoutURLs = append(frontchannelLogoutURLs, logoutURL)
+		}
+
+		if s.backchannelLogout != nil {
+			err = s.backchannelLogout.enqueue(ctx, []logoutTarget{{clientID: clientID, userID: userID, sessionID: sessionID}})
+			if err != nil {
+				return err
+			}
+		}
+
 		return s.store.RevokeSessionsByIDTokenHint(ctx, userID, clientID, idTokenJTI)
 	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+
+	return callbackURL, frontchannelLogoutURLs, nil
+}
+
+// userIDForSubject resolves the user the subject identifier of an ID token was issued for
+func (s *endSessionService) userIDForSubject(ctx context.Context, clientID, subject string) (string, error) {
+	var client model.OidcClient
+	err := dbFromContext(ctx, s.db).First(&client, "id = ?", clientID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", &common.OidcMissingAuthorizationError{}
+	}
 	if err != nil {
 		return "", err
 	}
 
-	return callbackURL, nil
+	userID, err := s.subjects.userIDForSubject(ctx, s.db, client, subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", &common.OidcMissingAuthorizationError{}
+	}
+	return userID, err
 }
 
-func (s *endSessionService) verifyIDTokenHint(tokenString string) (jwt.Token, error) {
-	alg, err := s.signer.GetKeyAlg()
+// verifyIDTokenHint verifies an ID token the provider issued that a client passes as hint of the user
+func verifyIDTokenHint(signer TokenSigner, issuer string, tokenString string) (jwt.Token, error) {
+	publicKeys, err := signer.GetPublicKeySet()
 	if err != nil {
 		return nil, err
 	}
@@ -102,10 +148,11 @@ func (s *endSessionService) verifyIDTokenHint(tokenString string) (jwt.Token, er
 	token, err := jwt.ParseString(
 		tokenString,
 		jwt.WithValidate(true),
-		jwt.WithKey(alg, s.signer.GetPrivateKey()),
+		// Tokens without a "kid" header are verified against every published key
+		jwt.WithKeySet(publicKeys, jws.WithRequireKid(false)),
 		jwt.WithAcceptableSkew(time.Minute),
 		jwt.WithResetValidators(true),
-		jwt.WithIssuer(s.baseURL),
+		jwt.WithIssuer(issuer),
 		jwt.WithValidator(jwt.IsIssuedAtValid()),
 		jwt.WithValidator(jwt.IsNbfValid()),
 	)
@@ -114,7 +161,7 @@ func (s *endSessionService) verifyIDTokenHint(tokenString string) (jwt.Token, er
 	}
 
 	// id_token_hint must be an ID token, never an access token (both are signed with the same
-	// key). An expired ID token is still accepted here, as required by OIDC RP-Initiated Logout.
+	// key). An expired ID token is still accepted, as required by OIDC RP-Initiated Logout and CIBA.
 	var tokenType string
 	if err := token.Get(common.TokenTypeClaim, &tokenType); err != nil || tokenType != idTokenType {
 		return nil, &common.TokenInvalidError{}
@@ -123,6 +170,15 @@ func (s *endSessionService) verifyIDTokenHint(tokenString string) (jwt.Token, er
 	return token, nil
 }
 
+// idTokenSessionID returns the "sid" claim of an ID token, which is missing in ID tokens issued before session IDs were introduced
+func idTokenSessionID(token jwt.Token) (string, bool) {
+	var sessionID string
+	if err := token.Get("sid", &sessionID); err != nil || sessionID == "" {
+		return "", false
+	}
+	return sessionID, true
+}
+
 func logoutCallbackURL(client *model.OidcClient, inputLogoutCallbackURL string) (string, error) {
 	if len(client.LogoutCallbackURLs) == 0 {
 		return "", nil
@@ -92,6 +92,7 @@ func TestEndSessionService(t *testing.T) {
 		subject     string
 		audience    string
 		jti         string
+		sessionID   string
 		omitSubject bool
 		omitJTI     bool
 		omitAud     bool
@@ -115,6 +116,9 @@ func TestEndSessionService(t *testing.T) {
 		if !opts.omitType {
 			builder = builder.Claim(common.TokenTypeClaim, idTokenType)
 		}
+		if opts.sessionID != "" {
+			builder = builder.Claim("sid", opts.sessionID)
+		}
 		token, err := builder.Build()
 		require.NoError(t, err)
 		signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256(), key))
@@ -133,21 +137,21 @@ func TestEndSessionService(t *testing.T) {
 		require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: "tim"}).Error)
 		require.NoError(t, db.Create(&model.UserAuthorizedOidcClient{UserID: userID, ClientID: clientID}).Error)
 		store := NewStore(db)
-		return newEndSessionService(db, store, signer, baseURL), store
+		return newEndSessionService(db, store, signer, SubjectResolver{}, nil, baseURL), store
 	}
 
 	validToken := tokenOptions{issuer: baseURL, subject: userID, audience: clientID, jti: jti}
 
 	t.Run("missing id_token_hint is rejected", func(t *testing.T) {
 		service, _ := newService(t)
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{}, userID)
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{}, userID)
 		var target *common.TokenInvalidError
 		require.ErrorAs(t, err, &target)
 	})
 
 	t.Run("malformed id_token_hint is rejected", func(t *testing.T) {
 		service, _ := newService(t)
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: "not-a-jwt"}, userID)
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: "not-a-jwt"}, userID)
 		var target *common.TokenInvalidError
 		require.ErrorAs(t, err, &target)
 	})
@@ -162,7 +166,7 @@ func TestEndSessionService(t *testing.T) {
 		signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256(), otherKey))
 		require.NoError(t, err)
 
-		_, err = service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: string(signed)}, userID)
+		_, _, err = service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: string(signed)}, userID)
 		var target *common.TokenInvalidError
 		require.ErrorAs(t, err, &target)
 	})
@@ -172,7 +176,7 @@ func TestEndSessionService(t *testing.T) {
 		// not be accepted as an id_token_hint; only genuine ID tokens carry the type claim.
 		service, _ := newService(t)
 		token := signToken(t, tokenOptions{issuer: baseURL, subject: userID, audience: clientID, jti: jti, omitType: true})
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
 		var target *common.TokenInvalidError
 		require.ErrorAs(t, err, &target)
 	})
@@ -180,7 +184,7 @@ func TestEndSessionService(t *testing.T) {
 	t.Run("subject not matching the logged-in user is rejected", func(t *testing.T) {
 		service, _ := newService(t)
 		token := signToken(t, tokenOptions{issuer: baseURL, subject: "someone-else", audience: clientID, jti: jti})
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
 		var target *common.TokenInvalidError
 		require.ErrorAs(t, err, &target)
 	})
@@ -188,7 +192,7 @@ func TestEndSessionService(t *testing.T) {
 	t.Run("client_id parameter not matching the token audience is rejected", func(t *testing.T) {
 		service, _ := newService(t)
 		token := signToken(t, validToken)
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token, ClientId: "different-client"}, userID)
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token, ClientId: "different-client"}, userID)
 		var target *common.OidcClientIdNotMatchingError
 		require.ErrorAs(t, err, &target)
 	})
@@ -197,7 +201,7 @@ func TestEndSessionService(t *testing.T) {
 		service, _ := newService(t)
 		// A valid token for a user that has no authorization record for the client.
 		token := signToken(t, tokenOptions{issuer: baseURL, subject: "ghost-user", audience: clientID, jti: jti})
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, "ghost-user")
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, "ghost-user")
 		var target *common.OidcMissingAuthorizationError
 		require.ErrorAs(t, err, &target)
 	})
@@ -205,7 +209,7 @@ func TestEndSessionService(t *testing.T) {
 	t.Run("unregistered post_logout_redirect_uri is rejected", func(t *testing.T) {
 		service, _ := newService(t)
 		token := signToken(t, validToken)
-		_, err := service.endSession(t.Context(), dto.OidcLogoutDto{
+		_, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{
 			IdTokenHint:           token,
 			PostLogoutRedirectUri: "https://evil.example/steal",
 		}, userID)
@@ -221,7 +225,7 @@ func TestEndSessionService(t *testing.T) {
 		require.NoError(t, store.CreateAccessTokenSession(t.Context(), "at-sig", newTestRequester("logout-req", clientID, userID, jti)))
 
 		token := signToken(t, validToken)
-		callback, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
+		callback, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
 		require.NoError(t, err)
 		require.Equal(t, "https://app.example/logout", callback)
 
@@ -245,7 +249,7 @@ func TestEndSessionService(t *testing.T) {
 		require.NoError(t, store.CreateAccessTokenSession(t.Context(), "at-other", newTestRequester("other-req", clientID, userID, "other-id-token-jti")))
 
 		token := signToken(t, validToken)
-		callback, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
+		callback, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
 		require.NoError(t, err)
 		require.Equal(t, "https://app.example/logout", callback)
 
@@ -279,7 +283,7 @@ func TestEndSessionService(t *testing.T) {
 		require.NoError(t, store.CreateAccessTokenSession(t.Context(), "at-no-session", newTestRequester("logout-req", clientID, userID, jti)))
 
 		token := signToken(t, validToken)
-		callback, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, "")
+		callback, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, "")
 		require.NoError(t, err)
 		require.Equal(t, "https://app.example/logout", callback)
 
@@ -297,11 +301,29 @@ func TestEndSessionService(t *testing.T) {
 	t.Run("valid logout honors a registered post_logout_redirect_uri", func(t *testing.T) {
 		service, _ := newService(t)
 		token := signToken(t, validToken)
-		callback, err := service.endSession(t.Context(), dto.OidcLogoutDto{
+		callback, _, err := service.endSession(t.Context(), dto.OidcLogoutDto{
 			IdTokenHint:           token,
 			PostLogoutRedirectUri: "https://app.example/logout",
 		}, userID)
 		require.NoError(t, err)
 		require.Equal(t, "https://app.example/logout", callback)
 	})
+
+	t.Run("valid logout returns the front-channel logout URL of the client", func(t *testing.T) {
+		service, _ := newService(t)
+		_, frontchannelLogoutURLs, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: signToken(t, validToken)}, userID)
+		require.NoError(t, err)
+		require.Empty(t, frontchannelLogoutURLs, "clients without a front-channel logout URI must not be loaded")
+
+		require.NoError(t, service.db.Model(&model.OidcClient{}).
+			Where("id = ?", clientID).
+			Update("frontchannel_logout_uri", "https://app.example/frontchannel-logout").
+			Error)
+
+		token := signToken(t, tokenOptions{issuer: baseURL, subject: userID, audience: clientID, jti: jti, sessionID: "session-1"})
+		callback, frontchannelLogoutURLs, err := service.endSession(t.Context(), dto.OidcLogoutDto{IdTokenHint: token}, userID)
+		require.NoError(t, err)
+		require.Equal(t, "https://app.example/logout", callback)
+		require.Equal(t, []string{"https://app.example/frontchannel-logout?iss=https%3A%2F%2Fissuer.example.com&sid=session-1"}, frontchannelLogoutURLs)
+	})
 }
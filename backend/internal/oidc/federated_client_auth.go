@@ -8,7 +8,9 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/httprc/v3"
@@ -17,12 +19,17 @@ import (
 	"github.com/lestrrat-go/jwx/v3/jws"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 	"github.com/ory/fosite"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
 const clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" //nolint:gosec
 
 var errNoFederatedClientAssertion = errors.New("no federated client assertion")
 
+// ClientAssertionSigningAlgorithms are the algorithms accepted for client assertions signed with the client's own keys (private_key_jwt)
+var ClientAssertionSigningAlgorithms = asymmetricSigningAlgorithms()
+
 // federatedClientStore is the subset of the store the federated authenticator needs.
 type federatedClientStore interface {
 	GetClient(ctx context.Context, id string) (fosite.Client, error)
@@ -31,19 +38,30 @@ type federatedClientStore interface {
 }
 
 // federatedClientAuthenticator authenticates clients via JWT bearer assertions issued
-// by a federated identity provider configured per client.
+// by a federated identity provider configured per client, or self-signed with the
+// client's own keys (private_key_jwt).
 type federatedClientAuthenticator struct {
 	clients         federatedClientStore
 	httpClient      *http.Client
 	jwksCache       *jwk.Cache
 	defaultAudience string
+	tokenEndpoint   string
+
+	// issuerMetadata caches the metadata of issuers, by issuer
+	issuerMetadataMu sync.Mutex
+	issuerMetadata   map[string]cachedIssuerMetadata
 }
 
-func newFederatedClientAuthenticator(ctx context.Context, clients federatedClientStore, httpClient *http.Client, defaultAudience string) (*federatedClientAuthenticator, error) {
+func newFederatedClientAuthenticator(ctx context.Context, clients federatedClientStore, httpClient *http.Client, defaultAudience string, tokenEndpoint string) (*federatedClientAuthenticator, error) {
 	authenticator := &federatedClientAuthenticator{
 		clients:         clients,
 		httpClient:      httpClient,
 		defaultAudience: defaultAudience,
+		tokenEndpoint:   tokenEndpoint,
+		issuerMetadata:  make(map[string]cachedIssuerMetadata),
+	}
+	if authenticator.httpClient == nil {
+		authenticator.httpClient = newDefaultHTTPClient()
 	}
 
 	jwksCache, err := authenticator.getJWKCache(ctx)
@@ -56,34 +74,35 @@ func newFederatedClientAuthenticator(ctx context.Context, clients federatedClien
 }
 
 func (a *federatedClientAuthenticator) getJWKCache(ctx context.Context) (*jwk.Cache, error) {
-	// We need to create a custom HTTP client to set a timeout.
-	client := a.httpClient
-	if client == nil {
-		client = &http.Client{
-			Timeout: 10 * time.Second,
-		}
-
-		defaultTransport, ok := http.DefaultTransport.(*http.Transport)
-		if !ok {
-			// Indicates a development-time error
-			panic("Default transport is not of type *http.Transport")
-		}
-		transport := defaultTransport.Clone()
-		transport.TLSClientConfig.MinVersion = tls.VersionTLS12
-		client.Transport = transport
-	}
-
 	return jwk.NewCache(ctx,
 		httprc.NewClient(
 			httprc.WithErrorSink(errsink.NewSlog(slog.Default())),
-			httprc.WithHTTPClient(client),
+			httprc.WithHTTPClient(a.httpClient),
 		),
 	)
 }
 
-// newClientAuthenticationStrategy accepts federated client assertions before falling
-// back to fosite's default client authentication.
-func newClientAuthenticationStrategy(authenticator *federatedClientAuthenticator, provider *fosite.Fosite) fosite.ClientAuthenticationStrategy {
+// newDefaultHTTPClient returns the HTTP client used to fetch keys and metadata if none is configured
+func newDefaultHTTPClient() *http.Client {
+	// We need to create a custom HTTP client to set a timeout.
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		// Indicates a development-time error
+		panic("Default transport is not of type *http.Transport")
+	}
+	transport := defaultTransport.Clone()
+	transport.TLSClientConfig.MinVersion = tls.VersionTLS12
+	client.Transport = transport
+	return client
+}
+
+// newClientAuthenticationStrategy accepts federated client assertions and client certificates
+// before falling back to fosite's default client authentication.
+func newClientAuthenticationStrategy(authenticator *federatedClientAuthenticator, mtls *mtlsAuthenticator, provider *fosite.Fosite) fosite.ClientAuthenticationStrategy {
 	return func(ctx context.Context, r *http.Request, form url.Values) (fosite.Client, error) {
 		client, err := authenticator.authenticateForm(ctx, form)
 		if err == nil {
@@ -93,6 +112,14 @@ func newClientAuthenticationStrategy(authenticator *federatedClientAuthenticator
 			return nil, err
 		}
 
+		client, err = mtls.authenticate(ctx, r, form)
+		if err == nil {
+			return client, nil
+		}
+		if !errors.Is(err, errNoClientCertificateAuthentication) {
+			return nil, err
+		}
+
 		return provider.DefaultClientAuthenticationStrategy(ctx, r, form)
 	}
 }
@@ -108,7 +135,8 @@ func (a *federatedClientAuthenticator) authenticateForm(ctx context.Context, for
 }
 
 // authenticateAssertion validates the assertion JWT against the client's configured
-// federated identity. An empty clientID falls back to the assertion's subject.
+// federated identity, or against the client's own keys if the assertion is self-issued.
+// An empty clientID falls back to the assertion's subject.
 func (a *federatedClientAuthenticator) authenticateAssertion(ctx context.Context, assertion string, clientID string) (fosite.Client, error) {
 	rawAssertion := []byte(assertion)
 	insecureToken, err := jwt.ParseInsecure(rawAssertion)
@@ -140,15 +168,13 @@ func (a *federatedClientAuthenticator) authenticateAssertion(ctx context.Context
 
 	federatedIdentity, ok := oidcClient.Credentials.FederatedIdentityForIssuer(issuer)
 	if !ok {
+		if issuer == oidcClient.ID && oidcClient.Credentials.HasKeys() {
+			return a.authenticatePrivateKeyJWT(ctx, rawAssertion, oidcClient)
+		}
 		return nil, errNoFederatedClientAssertion
 	}
 
-	jwksURL := federatedIdentity.JWKS
-	if jwksURL == "" {
-		jwksURL = strings.TrimRight(issuer, "/") + "/.well-known/jwks.json"
-	}
-
-	jwks, err := a.fetchJWKSet(ctx, jwksURL)
+	jwks, err := a.federatedIdentityJWKSet(ctx, federatedIdentity)
 	if err != nil {
 		return nil, fosite.ErrInvalidClient.WithHint("Unable to fetch client assertion JWKS.").WithWrap(err)
 	}
@@ -176,26 +202,111 @@ func (a *federatedClientAuthenticator) authenticateAssertion(ctx context.Context
 	}
 
 	if federatedIdentity.ReplayProtection {
-		jti, ok := parsed.JwtID()
-		if !ok || jti == "" {
-			return nil, fosite.ErrInvalidClient.WithHint("Client assertion is missing jti claim, which is required for replay protection.")
+		if err := a.consumeAssertionJTI(ctx, parsed); err != nil {
+			return nil, err
 		}
+	}
 
-		// Check if the jti has been used before
-		if err := a.clients.ClientAssertionJWTValid(ctx, jti); err != nil {
-			return nil, fosite.ErrInvalidClient.WithHint("Client assertion has already been used.").WithWrap(err)
-		}
-		// Store the jti to prevent future reuse
-		exp, _ := parsed.Expiration()
-		if err := a.clients.SetClientAssertionJWT(ctx, jti, exp); err != nil {
-			return nil, fosite.ErrInvalidClient.WithWrap(err)
-		}
+	return client, nil
+}
 
+// authenticatePrivateKeyJWT validates a client assertion signed with the keys registered on the client, as defined in RFC 7523 section 3.
+// The issuer and subject must be the client ID, and the assertion can only be used once.
+func (a *federatedClientAuthenticator) authenticatePrivateKeyJWT(ctx context.Context, rawAssertion []byte, client Client) (fosite.Client, error) {
+	if client.IsPublic() {
+		return nil, fosite.ErrInvalidClient.WithHint("Public clients can't authenticate with a client assertion.")
+	}
+
+	msg, err := jws.Parse(rawAssertion)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return nil, fosite.ErrInvalidClient.WithHint("Invalid client assertion.").WithWrap(err)
+	}
+	alg, ok := msg.Signatures()[0].ProtectedHeaders().Algorithm()
+	if !ok || !slices.Contains(ClientAssertionSigningAlgorithms, alg.String()) {
+		return nil, fosite.ErrInvalidClient.WithHint("Client assertion is signed with an unsupported algorithm.")
+	}
+
+	jwks, err := a.clientJWKSet(ctx, client.Credentials)
+	if err != nil {
+		return nil, fosite.ErrInvalidClient.WithHint("Unable to load the client's JWKS.").WithWrap(err)
+	}
+
+	parsed, err := jwt.Parse(rawAssertion,
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(30*time.Second),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		// The audience can be the issuer or the token endpoint
+		jwt.WithValidator(audienceOneOf(a.defaultAudience, a.tokenEndpoint)),
+		jwt.WithKeySet(jwks, jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)),
+	)
+	if err != nil {
+		return nil, fosite.ErrInvalidClient.WithHint("Invalid client assertion.").WithWrap(err)
+	}
+
+	if err := a.consumeAssertionJTI(ctx, parsed); err != nil {
+		return nil, err
 	}
 
 	return client, nil
 }
 
+// consumeAssertionJTI records the jti of the assertion until it expires, and fails if it was already used
+func (a *federatedClientAuthenticator) consumeAssertionJTI(ctx context.Context, assertion jwt.Token) error {
+	jti, ok := assertion.JwtID()
+	if !ok || jti == "" {
+		return fosite.ErrInvalidClient.WithHint("Client assertion is missing jti claim, which is required for replay protection.")
+	}
+
+	// Check if the jti has been used before
+	if err := a.clients.ClientAssertionJWTValid(ctx, jti); err != nil {
+		return fosite.ErrInvalidClient.WithHint("Client assertion has already been used.").WithWrap(err)
+	}
+	// Store the jti to prevent future reuse
+	exp, _ := assertion.Expiration()
+	if err := a.clients.SetClientAssertionJWT(ctx, jti, exp); err != nil {
+		return fosite.ErrInvalidClient.WithWrap(err)
+	}
+
+	return nil
+}
+
+// clientJWKSet returns the keys registered on the client, either inline or through the JWKS URI
+func (a *federatedClientAuthenticator) clientJWKSet(ctx context.Context, credentials model.OidcClientCredentials) (jwk.Set, error) {
+	if credentials.JWKSURI != "" {
+		return a.fetchJWKSet(ctx, credentials.JWKSURI)
+	}
+
+	jwks, err := jwk.ParseString(credentials.JWKS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	return jwks, nil
+}
+
+// federatedIdentityJWKSet returns the keys of a federated identity, which default to the JWKS published by its issuer
+func (a *federatedClientAuthenticator) federatedIdentityJWKSet(ctx context.Context, identity model.OidcClientFederatedIdentity) (jwk.Set, error) {
+	jwksURL := identity.JWKS
+	if jwksURL == "" {
+		jwksURL = strings.TrimRight(identity.Issuer, "/") + "/.well-known/jwks.json"
+	}
+	return a.fetchJWKSet(ctx, jwksURL)
+}
+
+// audienceOneOf validates that the "aud" claim contains at least one of the allowed values
+func audienceOneOf(allowed ...string) jwt.ValidatorFunc {
+	return func(_ context.Context, t jwt.Token) error {
+		audience, _ := t.Audience()
+		for _, aud := range audience {
+			if aud != "" && slices.Contains(allowed, aud) {
+				return nil
+			}
+		}
+		return jwt.InvalidAudienceError()
+	}
+}
+
 func (a *federatedClientAuthenticator) fetchJWKSet(ctx context.Context, jwksURL string) (jwk.Set, error) {
 	if !a.jwksCache.IsRegistered(ctx, jwksURL) {
 		// We set a timeout because otherwise Register will keep trying in case of errors
@@ -115,7 +115,7 @@ func TestFederatedClientAuthenticatorAssertionValidation(t *testing.T) {
 			}},
 			jtis: map[string]time.Time{},
 		}
-		authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), audience)
+		authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), audience, audience+"/api/oidc/token")
 		require.NoError(t, err)
 		return authenticator, store
 	}
@@ -228,7 +228,7 @@ func TestFederatedClientAuthenticatorAllowsConfiguredSubjectDifferentFromClientI
 		}},
 		jtis: map[string]time.Time{},
 	}
-	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), "unused-default-audience")
+	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), "unused-default-audience", "unused-token-endpoint")
 	require.NoError(t, err)
 
 	token, err := jwt.NewBuilder().
@@ -280,7 +280,7 @@ func TestFederatedClientAuthenticatorCachesJWKS(t *testing.T) {
 		}},
 		jtis: map[string]time.Time{},
 	}
-	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, httpClient, audience)
+	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, httpClient, audience, audience+"/api/oidc/token")
 	require.NoError(t, err)
 
 	signAssertion := func(t *testing.T, jti string) string {
@@ -308,3 +308,119 @@ func TestFederatedClientAuthenticatorCachesJWKS(t *testing.T) {
 	require.Equal(t, clientID, client.GetID())
 	require.EqualValues(t, 1, requests.Load())
 }
+
+func TestFederatedClientAuthenticatorPrivateKeyJWT(t *testing.T) {
+	signingKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	signingAlg, ok := signingKey.Algorithm()
+	require.True(t, ok)
+
+	publicKey, err := signingKey.PublicKey()
+	require.NoError(t, err)
+	jwks := jwk.NewSet()
+	require.NoError(t, jwks.AddKey(publicKey))
+	rawJWKS, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	const (
+		clientID      = "private-key-jwt-client"
+		issuerURL     = "https://pocket-id.example.com"
+		tokenEndpoint = "https://pocket-id.example.com/api/oidc/token"
+		jwksURL       = "https://client.example.com/jwks.json"
+	)
+
+	newAuthenticator := func(t *testing.T, credentials model.OidcClientCredentials, isPublic bool) *federatedClientAuthenticator {
+		t.Helper()
+		store := &fakeFederatedStore{
+			client: Client{OidcClient: model.OidcClient{
+				Base:        model.Base{ID: clientID},
+				Name:        "Private Key JWT Client",
+				IsPublic:    isPublic,
+				Credentials: credentials,
+			}},
+			jtis: map[string]time.Time{},
+		}
+		authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), issuerURL, tokenEndpoint)
+		require.NoError(t, err)
+		return authenticator
+	}
+
+	signAssertion := func(t *testing.T, audience string, jti string) string {
+		t.Helper()
+		builder := jwt.NewBuilder().
+			Issuer(clientID).
+			Subject(clientID).
+			Audience([]string{audience}).
+			IssuedAt(time.Now()).
+			Expiration(time.Now().Add(5 * time.Minute))
+		if jti != "" {
+			builder = builder.JwtID(jti)
+		}
+		token, err := builder.Build()
+		require.NoError(t, err)
+		signed, err := jwt.Sign(token, jwt.WithKey(signingAlg, signingKey))
+		require.NoError(t, err)
+		return string(signed)
+	}
+
+	inlineCredentials := model.OidcClientCredentials{JWKS: string(rawJWKS)}
+
+	t.Run("assertion signed with an inline key authenticates once", func(t *testing.T) {
+		authenticator := newAuthenticator(t, inlineCredentials, false)
+		assertion := signAssertion(t, tokenEndpoint, "jti-inline")
+
+		client, err := authenticator.authenticateAssertion(t.Context(), assertion, clientID)
+		require.NoError(t, err)
+		require.Equal(t, clientID, client.GetID())
+
+		_, err = authenticator.authenticateAssertion(t.Context(), assertion, clientID)
+		require.ErrorIs(t, err, fosite.ErrInvalidClient)
+	})
+
+	t.Run("assertion signed with a key from the JWKS URI authenticates", func(t *testing.T) {
+		authenticator := newAuthenticator(t, model.OidcClientCredentials{JWKSURI: jwksURL}, false)
+
+		client, err := authenticator.authenticateAssertion(t.Context(), signAssertion(t, issuerURL, "jti-uri"), "")
+		require.NoError(t, err)
+		require.Equal(t, clientID, client.GetID())
+	})
+
+	t.Run("assertion without jti is rejected", func(t *testing.T) {
+		authenticator := newAuthenticator(t, inlineCredentials, false)
+		_, err := authenticator.authenticateAssertion(t.Context(), signAssertion(t, tokenEndpoint, ""), clientID)
+		require.ErrorIs(t, err, fosite.ErrInvalidClient)
+	})
+
+	t.Run("assertion with another audience is rejected", func(t *testing.T) {
+		authenticator := newAuthenticator(t, inlineCredentials, false)
+		_, err := authenticator.authenticateAssertion(t.Context(), signAssertion(t, "https://other.example.com", "jti-aud"), clientID)
+		require.ErrorIs(t, err, fosite.ErrInvalidClient)
+	})
+
+	t.Run("assertion signed with another key is rejected", func(t *testing.T) {
+		otherKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+		require.NoError(t, err)
+		otherPublicKey, err := otherKey.PublicKey()
+		require.NoError(t, err)
+		otherJWKS := jwk.NewSet()
+		require.NoError(t, otherJWKS.AddKey(otherPublicKey))
+		rawOtherJWKS, err := json.Marshal(otherJWKS)
+		require.NoError(t, err)
+
+		authenticator := newAuthenticator(t, model.OidcClientCredentials{JWKS: string(rawOtherJWKS)}, false)
+		_, err = authenticator.authenticateAssertion(t.Context(), signAssertion(t, tokenEndpoint, "jti-other-key"), clientID)
+		require.ErrorIs(t, err, fosite.ErrInvalidClient)
+	})
+
+	t.Run("public clients can't use private_key_jwt", func(t *testing.T) {
+		authenticator := newAuthenticator(t, inlineCredentials, true)
+		_, err := authenticator.authenticateAssertion(t.Context(), signAssertion(t, tokenEndpoint, "jti-public"), clientID)
+		require.ErrorIs(t, err, fosite.ErrInvalidClient)
+	})
+
+	t.Run("client without keys falls through", func(t *testing.T) {
+		authenticator := newAuthenticator(t, model.OidcClientCredentials{}, false)
+		_, err := authenticator.authenticateAssertion(t.Context(), signAssertion(t, tokenEndpoint, "jti-no-keys"), clientID)
+		require.ErrorIs(t, err, errNoFederatedClientAssertion)
+	})
+}
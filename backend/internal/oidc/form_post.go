@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"html/template"
+	"net/url"
 )
 
 // formPostAutoSubmitScript submits the response_mode=form_post page back to the client as soon as it loads
@@ -33,6 +34,12 @@ var formPostTemplate = template.Must(template.New("form_post").Parse(
 </body>
 </html>`))
 
+// formPostPage is the data formPostTemplate is rendered with, the same that fosite passes to it
+type formPostPage struct {
+	RedirURL   string
+	Parameters url.Values
+}
+
 // cspHashOf returns the CSP hash-source expression ("'sha256-...'") for an inline script body
 func cspHashOf(script string) string {
 	sum := sha256.Sum256([]byte(script))
@@ -0,0 +1,79 @@
+package oidc
+
+import (
+	"html/template"
+	"net/url"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// frontchannelLogoutScript continues to the post-logout redirect URI once every iframe has loaded, or after 3 seconds if
+// a client doesn't respond
+// The redirect URI is read from a data attribute so the script body stays constant and can be allow-listed via its
+// SHA-256 hash (frontchannelLogoutScriptCSPHash), the same way as formPostAutoSubmitScript
+const frontchannelLogoutScript = `const frames = document.querySelectorAll('iframe'); let pending = frames.length; const done = () => location.replace(document.body.dataset.redirectUrl); frames.forEach((frame) => frame.addEventListener('load', () => { if (--pending <= 0) done(); })); setTimeout(done, 3000);`
+
+// frontchannelLogoutScriptCSPHash is the CSP script-src source that allow-lists frontchannelLogoutScript
+var frontchannelLogoutScriptCSPHash = cspHashOf(frontchannelLogoutScript)
+
+// frontchannelLogoutTemplate renders the page that loads the front-channel logout URIs of the clients in hidden iframes
+// and then redirects to the post-logout redirect URI, as defined in OpenID Connect Front-Channel Logout 1.0 section 3
+var frontchannelLogoutTemplate = template.Must(template.New("frontchannel_logout").Parse(
+	`<!DOCTYPE html>
+<html>
+<head><title>Signing Out</title></head>
+<body data-redirect-url="{{ .RedirectURL }}">
+{{- range .LogoutURLs }}
+<iframe src="{{ . }}" width="0" height="0" hidden></iframe>
+{{- end }}
+<noscript><a href="{{ .RedirectURL }}">Continue</a></noscript>
+<script>` + frontchannelLogoutScript + `</script>
+</body>
+</html>`))
+
+type frontchannelLogoutPage struct {
+	RedirectURL string
+	LogoutURLs  []string
+}
+
+// frontchannelLogoutURL returns the front-channel logout URI of the client with the "iss" and "sid" query parameters,
+// or false if the client doesn't have one
+func frontchannelLogoutURL(client *model.OidcClient, issuer, sessionID string) (string, bool) {
+	if client.FrontchannelLogoutURI == nil || *client.FrontchannelLogoutURI == "" {
+		return "", false
+	}
+
+	parsed, err := url.Parse(*client.FrontchannelLogoutURI)
+	if err != nil {
+		return "", false
+	}
+
+	// The "iss" and "sid" parameters let the client check that the logout is meant for its session
+	if sessionID != "" {
+		query := parsed.Query()
+		query.Set("iss", issuer)
+		query.Set("sid", sessionID)
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.String(), true
+}
+
+// frameOrigins returns the distinct origins of the URLs, which the logout page has to be allowed to frame
+func frameOrigins(urls []string) []string {
+	origins := make([]string, 0, len(urls))
+	seen := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			continue
+		}
+
+		origin := parsed.Scheme + "://" + parsed.Host
+		if _, ok := seen[origin]; ok {
+			continue
+		}
+		seen[origin] = struct{}{}
+		origins = append(origins, origin)
+	}
+	return origins
+}
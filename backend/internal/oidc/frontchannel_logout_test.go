@@ -0,0 +1,93 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+func renderFrontchannelLogout(t *testing.T, page frontchannelLogoutPage) string {
+	t.Helper()
+
+	var buf strings.Builder
+	require.NoError(t, frontchannelLogoutTemplate.Execute(&buf, page))
+	return buf.String()
+}
+
+func TestFrontchannelLogoutTemplate(t *testing.T) {
+	html := renderFrontchannelLogout(t, frontchannelLogoutPage{
+		RedirectURL: "https://app.example.com/logged-out?state=xyz",
+		LogoutURLs: []string{
+			"https://app.example.com/logout?iss=https%3A%2F%2Fissuer.example.com&sid=session-1",
+			"https://other.example.com/logout",
+		},
+	})
+
+	assert.NotContains(t, html, "onload", "the logout page must not rely on inline event handlers")
+	assert.Contains(t, html, `data-redirect-url="https://app.example.com/logged-out?state=xyz"`)
+	assert.Contains(t, html, `<iframe src="https://app.example.com/logout?iss=https%3A%2F%2Fissuer.example.com&amp;sid=session-1"`)
+	assert.Contains(t, html, `<iframe src="https://other.example.com/logout"`)
+	assert.Contains(t, html, `<noscript><a href="https://app.example.com/logged-out?state=xyz">`)
+}
+
+// frontchannelLogoutScriptCSPHash must match the inline script the template actually renders, otherwise the browser
+// refuses the script and the user is never redirected
+func TestFrontchannelLogoutScriptCSPHashMatchesRenderedScript(t *testing.T) {
+	html := renderFrontchannelLogout(t, frontchannelLogoutPage{RedirectURL: "https://app.example.com"})
+
+	matches := regexp.MustCompile(`(?s)<script>(.*?)</script>`).FindStringSubmatch(html)
+	require.Len(t, matches, 2, "rendered logout page must contain exactly one inline <script> block")
+
+	sum := sha256.Sum256([]byte(matches[1]))
+	want := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+	assert.Equal(t, want, frontchannelLogoutScriptCSPHash)
+}
+
+func TestFrontchannelLogoutURL(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+
+	t.Run("client without a front-channel logout URI", func(t *testing.T) {
+		_, ok := frontchannelLogoutURL(&model.OidcClient{}, issuer, "session-1")
+		require.False(t, ok)
+	})
+
+	t.Run("iss and sid are added to the existing query", func(t *testing.T) {
+		client := &model.OidcClient{FrontchannelLogoutURI: stringPointer("https://app.example.com/logout?tenant=a")}
+		logoutURL, ok := frontchannelLogoutURL(client, issuer, "session-1")
+		require.True(t, ok)
+
+		parsed, err := url.Parse(logoutURL)
+		require.NoError(t, err)
+		require.Equal(t, "app.example.com", parsed.Host)
+		require.Equal(t, "/logout", parsed.Path)
+		require.Equal(t, "a", parsed.Query().Get("tenant"))
+		require.Equal(t, issuer, parsed.Query().Get("iss"))
+		require.Equal(t, "session-1", parsed.Query().Get("sid"))
+	})
+
+	t.Run("iss and sid are omitted without a session ID", func(t *testing.T) {
+		client := &model.OidcClient{FrontchannelLogoutURI: stringPointer("https://app.example.com/logout")}
+		logoutURL, ok := frontchannelLogoutURL(client, issuer, "")
+		require.True(t, ok)
+		require.Equal(t, "https://app.example.com/logout", logoutURL)
+	})
+}
+
+func TestFrameOrigins(t *testing.T) {
+	origins := frameOrigins([]string{
+		"https://app.example.com/logout?sid=1",
+		"https://app.example.com/other-logout",
+		"http://legacy.example.com:8080/logout",
+		"javascript:alert(1)",
+		"/relative",
+	})
+	require.Equal(t, []string{"https://app.example.com", "http://legacy.example.com:8080"}, origins)
+}
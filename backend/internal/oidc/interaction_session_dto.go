@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
 type interactionStep string
@@ -16,11 +17,25 @@ const (
 type interactionSessionForUser struct {
 	ID            string                    `json:"id"`
 	Scopes        []string                  `json:"scopes"`
+	CustomScopes  []interactionScope        `json:"customScopes"`
+	Resources     []interactionResource     `json:"resources"`
 	Client        dto.OidcClientMetaDataDto `json:"client"`
 	CurrentStep   interactionStep           `json:"currentStep,omitempty"`
 	RequiredSteps []interactionStep         `json:"requiredSteps"`
 }
 
+// interactionScope describes a requested admin-defined scope on the consent screen
+type interactionScope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// interactionResource describes a requested API resource on the consent screen
+type interactionResource struct {
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+}
+
 type completeInteractionRequest struct {
 	Step interactionStep `json:"step"`
 }
@@ -30,7 +45,7 @@ type completeInteractionResponse struct {
 	RedirectURL string                     `json:"redirectUrl,omitempty"`
 }
 
-func newInteractionSessionForUser(interactionSession InteractionSession) (interactionSessionForUser, error) {
+func newInteractionSessionForUser(interactionSession InteractionSession, registeredScopes []model.OidcScope, apiResources []model.OidcAPIResource) (interactionSessionForUser, error) {
 	var client dto.OidcClientMetaDataDto
 	if err := dto.MapStruct(interactionSession.Client, &client); err != nil {
 		return interactionSessionForUser{}, err
@@ -42,9 +57,21 @@ func newInteractionSessionForUser(interactionSession InteractionSession) (intera
 		currentStep = requiredSteps[0]
 	}
 
+	customScopes := make([]interactionScope, len(registeredScopes))
+	for i, scope := range registeredScopes {
+		customScopes[i] = interactionScope{Name: scope.Name, Description: scope.Description}
+	}
+
+	resources := make([]interactionResource, len(apiResources))
+	for i, resource := range apiResources {
+		resources[i] = interactionResource{Name: resource.Name, Identifier: resource.Identifier}
+	}
+
 	return interactionSessionForUser{
 		ID:            interactionSession.ID,
 		Scopes:        interactionSession.Scopes,
+		CustomScopes:  customScopes,
+		Resources:     resources,
 		Client:        client,
 		CurrentStep:   currentStep,
 		RequiredSteps: requiredSteps,
@@ -13,13 +13,15 @@ import (
 type introspectionHandler struct {
 	provider      fosite.OAuth2Provider
 	authenticator *federatedClientAuthenticator
+	mtls          *mtlsAuthenticator
 	baseURL       string
 }
 
-func newIntrospectionHandler(provider fosite.OAuth2Provider, authenticator *federatedClientAuthenticator, baseURL string) *introspectionHandler {
+func newIntrospectionHandler(provider fosite.OAuth2Provider, authenticator *federatedClientAuthenticator, mtls *mtlsAuthenticator, baseURL string) *introspectionHandler {
 	return &introspectionHandler{
 		provider:      provider,
 		authenticator: authenticator,
+		mtls:          mtls,
 		baseURL:       baseURL,
 	}
 }
@@ -54,6 +56,11 @@ func (h *introspectionHandler) introspectToken(c *gin.Context) {
 		return
 	}
 
+	if r, ok := response.(*fosite.IntrospectionResponse); ok {
+		setDPoPTokenType(r)
+		setClientSubject(r)
+	}
+
 	h.provider.WriteIntrospectionResponse(ctx, c.Writer, response)
 }
 
@@ -86,7 +93,9 @@ func (h *introspectionHandler) tryFederatedClientAssertionIntrospection(c *gin.C
 	}
 	if tokenUse == fosite.AccessToken {
 		response.AccessTokenType = fosite.BearerAccessToken
+		setDPoPTokenType(response)
 	}
+	setClientSubject(response)
 
 	if accessRequester.GetClient().GetID() != client.GetID() {
 		h.provider.WriteIntrospectionResponse(ctx, c.Writer, &fosite.IntrospectionResponse{Active: false})
@@ -104,6 +113,16 @@ func (h *introspectionHandler) callerClientID(ctx context.Context, c *gin.Contex
 		if err != nil {
 			return "", err
 		}
+		// DPoP-bound access tokens can't be used as bearer credentials
+		if session, ok := accessRequester.GetSession().(*Session); ok && session.DPoPJKT != "" {
+			return "", fosite.ErrRequestUnauthorized.WithHint("DPoP-bound access tokens can't be used to authenticate introspection requests.")
+		}
+		// Certificate-bound access tokens can only be used with the certificate they are bound to
+		if session, ok := accessRequester.GetSession().(*Session); ok {
+			if err := h.mtls.validateTokenBinding(c.Request, session); err != nil {
+				return "", err
+			}
+		}
 		return accessRequester.GetClient().GetID(), nil
 	}
 
@@ -113,3 +132,25 @@ func (h *introspectionHandler) callerClientID(ctx context.Context, c *gin.Contex
 
 	return "", nil
 }
+
+// setDPoPTokenType reports DPoP-bound access tokens with the DPoP token type, so resource servers know they must enforce the binding.
+// The "cnf" claim with the key thumbprint is added by the session.
+func setDPoPTokenType(response *fosite.IntrospectionResponse) {
+	if response.TokenUse != fosite.AccessToken || response.AccessRequester == nil {
+		return
+	}
+	if session, ok := response.AccessRequester.GetSession().(*Session); ok && session.DPoPJKT != "" {
+		response.AccessTokenType = accessTokenTypeDPoP
+	}
+}
+
+// setClientSubject reports the subject identifier that was released to the client instead of the user ID,
+// so the introspection response matches the "sub" claim of the tokens for clients with pairwise subjects.
+func setClientSubject(response *fosite.IntrospectionResponse) {
+	if response.AccessRequester == nil {
+		return
+	}
+	if session, ok := response.AccessRequester.GetSession().(*Session); ok {
+		session.Subject = session.ClientSubject()
+	}
+}
@@ -68,7 +68,7 @@ func TestIntrospectionHandlerBindsTokenToCallerClient(t *testing.T) {
 	clientBToken := issueAccessToken(t, "req-b", "client-b", "user-b")
 	clientBOtherToken := issueAccessToken(t, "req-b-2", "client-b", "user-b")
 
-	handler := newIntrospectionHandler(provider, nil, "https://issuer.example.com")
+	handler := newIntrospectionHandler(provider, nil, provider.mtls, "https://issuer.example.com")
 
 	introspect := func(t *testing.T, bearer, token string) map[string]any {
 		t.Helper()
@@ -136,7 +136,7 @@ func TestIntrospectionHandlerAllowsReusedFederatedClientAssertion(t *testing.T)
 	}).Error)
 
 	store := NewStore(db)
-	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), baseURL)
+	authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, jwks), baseURL, baseURL+"/api/oidc/token")
 	require.NoError(t, err)
 
 	signerKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -176,7 +176,7 @@ func TestIntrospectionHandlerAllowsReusedFederatedClientAssertion(t *testing.T)
 	signedAssertion, err := jwt.Sign(assertionToken, jwt.WithKey(signingAlg, signingKey))
 	require.NoError(t, err)
 
-	handler := newIntrospectionHandler(provider, authenticator, baseURL)
+	handler := newIntrospectionHandler(provider, authenticator, provider.mtls, baseURL)
 	introspect := func(t *testing.T) (int, map[string]any) {
 		t.Helper()
 		body := url.Values{
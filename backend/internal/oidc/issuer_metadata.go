@@ -0,0 +1,117 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// issuerMetadataCacheDuration is how long the metadata of an issuer is used before it's fetched again
+	issuerMetadataCacheDuration = time.Hour
+	// maxIssuerMetadataSize limits the size of the metadata documents of issuers
+	maxIssuerMetadataSize = 1 << 20
+)
+
+// issuerMetadata is the part of the metadata of an issuer (OpenID Connect Discovery 1.0 and RFC 8414) that is used
+type issuerMetadata struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type cachedIssuerMetadata struct {
+	metadata  issuerMetadata
+	expiresAt time.Time
+}
+
+// discoverJWKSURL returns the jwks_uri the issuer publishes in its OpenID Connect Discovery metadata,
+// or in its OAuth 2.0 Authorization Server Metadata (RFC 8414) if it isn't an OpenID provider
+func (a *federatedClientAuthenticator) discoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	a.issuerMetadataMu.Lock()
+	cached, ok := a.issuerMetadata[issuer]
+	a.issuerMetadataMu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.metadata.JWKSURI, nil
+	}
+
+	metadataURLs, err := issuerMetadataURLs(issuer)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []error
+	for _, metadataURL := range metadataURLs {
+		metadata, err := a.fetchIssuerMetadata(ctx, issuer, metadataURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		a.issuerMetadataMu.Lock()
+		a.issuerMetadata[issuer] = cachedIssuerMetadata{metadata: metadata, expiresAt: time.Now().Add(issuerMetadataCacheDuration)}
+		a.issuerMetadataMu.Unlock()
+		return metadata.JWKSURI, nil
+	}
+
+	return "", fmt.Errorf("failed to discover the JWKS URL of issuer %s: %w", issuer, errors.Join(errs...))
+}
+
+func (a *federatedClientAuthenticator) fetchIssuerMetadata(parentCtx context.Context, issuer, metadataURL string) (issuerMetadata, error) {
+	ctx, cancel := context.WithTimeout(parentCtx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return issuerMetadata{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return issuerMetadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return issuerMetadata{}, fmt.Errorf("%s responded with %s", metadataURL, resp.Status)
+	}
+
+	var metadata issuerMetadata
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxIssuerMetadataSize)).Decode(&metadata)
+	if err != nil {
+		return issuerMetadata{}, fmt.Errorf("invalid metadata at %s: %w", metadataURL, err)
+	}
+
+	// The issuer in the metadata must be identical to the issuer it was looked up for (RFC 8414 section 3.3)
+	if metadata.Issuer != issuer {
+		return issuerMetadata{}, fmt.Errorf("metadata at %s is for issuer %q", metadataURL, metadata.Issuer)
+	}
+	jwksURL, err := url.Parse(metadata.JWKSURI)
+	if err != nil || (jwksURL.Scheme != "https" && jwksURL.Scheme != "http") || jwksURL.Host == "" {
+		return issuerMetadata{}, fmt.Errorf("metadata at %s has no valid jwks_uri", metadataURL)
+	}
+
+	return metadata, nil
+}
+
+// issuerMetadataURLs returns the URLs the metadata of the issuer can be found at, in the order they're tried
+// OpenID Connect Discovery appends the well-known path to the issuer, while RFC 8414 inserts it before the issuer's path
+func issuerMetadataURLs(issuer string) ([]string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("issuer %q is not a valid URL", issuer)
+	}
+
+	origin := u.Scheme + "://" + u.Host
+	path := strings.TrimRight(u.EscapedPath(), "/")
+	return []string{
+		origin + path + "/.well-known/openid-configuration",
+		origin + "/.well-known/oauth-authorization-server" + path,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package oidc
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerMetadataURLs(t *testing.T) {
+	urls, err := issuerMetadataURLs("https://idp.example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://idp.example.com/.well-known/openid-configuration",
+		"https://idp.example.com/.well-known/oauth-authorization-server",
+	}, urls)
+
+	urls, err = issuerMetadataURLs("https://idp.example.com/realms/main/")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://idp.example.com/realms/main/.well-known/openid-configuration",
+		"https://idp.example.com/.well-known/oauth-authorization-server/realms/main",
+	}, urls)
+
+	_, err = issuerMetadataURLs("idp.example.com")
+	require.Error(t, err)
+}
+
+func TestFederatedClientAuthenticatorDiscoverJWKSURL(t *testing.T) {
+	// documents are the metadata documents served by URL
+	documents := map[string]string{
+		"https://oidc.example.com/.well-known/openid-configuration":            `{"issuer":"https://oidc.example.com","jwks_uri":"https://oidc.example.com/keys"}`,
+		"https://as.example.com/.well-known/oauth-authorization-server/tenant": `{"issuer":"https://as.example.com/tenant","jwks_uri":"https://as.example.com/tenant/jwks"}`,
+		"https://evil.example.com/.well-known/openid-configuration":            `{"issuer":"https://oidc.example.com","jwks_uri":"https://evil.example.com/keys"}`,
+		"https://nokeys.example.com/.well-known/openid-configuration":          `{"issuer":"https://nokeys.example.com"}`,
+	}
+	var requests []string
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.String())
+		document, ok := documents[req.URL.String()]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody, Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(document)), Request: req}, nil
+	})}
+
+	authenticator, err := newFederatedClientAuthenticator(t.Context(), &fakeFederatedStore{}, httpClient, "unused-default-audience", "unused-token-endpoint")
+	require.NoError(t, err)
+
+	t.Run("uses the OpenID Connect Discovery metadata and caches it", func(t *testing.T) {
+		requests = nil
+		for range 2 {
+			jwksURL, err := authenticator.discoverJWKSURL(t.Context(), "https://oidc.example.com")
+			require.NoError(t, err)
+			require.Equal(t, "https://oidc.example.com/keys", jwksURL)
+		}
+		require.Equal(t, []string{"https://oidc.example.com/.well-known/openid-configuration"}, requests)
+	})
+
+	t.Run("falls back to the authorization server metadata", func(t *testing.T) {
+		jwksURL, err := authenticator.discoverJWKSURL(t.Context(), "https://as.example.com/tenant")
+		require.NoError(t, err)
+		require.Equal(t, "https://as.example.com/tenant/jwks", jwksURL)
+	})
+
+	t.Run("rejects metadata of a different issuer", func(t *testing.T) {
+		_, err := authenticator.discoverJWKSURL(t.Context(), "https://evil.example.com")
+		require.Error(t, err)
+	})
+
+	t.Run("rejects metadata without a JWKS URL", func(t *testing.T) {
+		_, err := authenticator.discoverJWKSURL(t.Context(), "https://nokeys.example.com")
+		require.Error(t, err)
+	})
+
+	t.Run("doesn't guess a JWKS URL if the issuer publishes no metadata", func(t *testing.T) {
+		_, err := authenticator.discoverJWKSURL(t.Context(), "https://unknown.example.com")
+		require.Error(t, err)
+	})
+}
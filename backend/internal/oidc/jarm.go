@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+)
+
+// Response modes of JWT Secured Authorization Response Mode for OAuth 2.0 (JARM), which deliver the authorization
+// response in a JWT signed by Pocket ID, so it can't be tampered with
+const (
+	ResponseModeQueryJWT    fosite.ResponseModeType = "query.jwt"
+	ResponseModeFragmentJWT fosite.ResponseModeType = "fragment.jwt"
+	ResponseModeFormPostJWT fosite.ResponseModeType = "form_post.jwt"
+	// ResponseModeJWT uses the default JWT response mode of the response type, which is query.jwt for "code"
+	ResponseModeJWT fosite.ResponseModeType = "jwt"
+)
+
+// jarmResponseLifetime is how long a signed authorization response is valid
+const jarmResponseLifetime = 10 * time.Minute
+
+// ResponseModes are the response modes every client can use
+var ResponseModes = []string{
+	string(fosite.ResponseModeQuery), string(fosite.ResponseModeFragment), string(fosite.ResponseModeFormPost),
+	string(ResponseModeQueryJWT), string(ResponseModeFragmentJWT), string(ResponseModeFormPostJWT), string(ResponseModeJWT),
+}
+
+var _ fosite.ResponseModeHandler = (*jarmResponseModeHandler)(nil)
+
+// jarmResponseModeHandler writes the authorization responses and errors of the JARM response modes
+type jarmResponseModeHandler struct {
+	signer TokenSigner
+	issuer string
+}
+
+func newJARMResponseModeHandler(signer TokenSigner, issuer string) *jarmResponseModeHandler {
+	return &jarmResponseModeHandler{
+		signer: signer,
+		issuer: issuer,
+	}
+}
+
+func (h *jarmResponseModeHandler) ResponseModes() fosite.ResponseModeTypes {
+	return fosite.ResponseModeTypes{ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT, ResponseModeJWT}
+}
+
+func (h *jarmResponseModeHandler) WriteAuthorizeResponse(ctx context.Context, rw http.ResponseWriter, ar fosite.AuthorizeRequester, resp fosite.AuthorizeResponder) {
+	for key := range resp.GetHeader() {
+		rw.Header().Set(key, resp.GetHeader().Get(key))
+	}
+	h.writeResponse(ctx, rw, ar, resp.GetParameters())
+}
+
+func (h *jarmResponseModeHandler) WriteAuthorizeError(ctx context.Context, rw http.ResponseWriter, ar fosite.AuthorizeRequester, err error) {
+	rfcErr := fosite.ErrorToRFC6749Error(err)
+	if !ar.IsRedirectURIValid() {
+		// Without a valid redirect URI the error can't be delivered to the client, which fosite handles the same way
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Set("Pragma", "no-cache")
+		rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		rw.WriteHeader(rfcErr.CodeField)
+		_ = json.NewEncoder(rw).Encode(rfcErr)
+		return
+	}
+
+	params := rfcErr.ToValues()
+	params.Set("state", ar.GetState())
+	h.writeResponse(ctx, rw, ar, params)
+}
+
+// writeResponse delivers the response parameters in a signed JWT, as defined in JARM section 2.3
+func (h *jarmResponseModeHandler) writeResponse(ctx context.Context, rw http.ResponseWriter, ar fosite.AuthorizeRequester, params url.Values) {
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	response, err := h.newResponseToken(ar.GetClient().GetID(), params)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to sign authorization response", "error", err)
+		http.Error(rw, "Failed to sign the authorization response", http.StatusInternalServerError)
+		return
+	}
+
+	redirectURI := *ar.GetRedirectURI()
+	switch ar.GetResponseMode() {
+	case ResponseModeFormPostJWT:
+		rw.Header().Set("Content-Type", "text/html;charset=UTF-8")
+		err := formPostTemplate.Execute(rw, formPostPage{
+			RedirURL:   redirectURI.String(),
+			Parameters: url.Values{"response": {response}},
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to write form_post.jwt authorization response", "error", err)
+		}
+		return
+	case ResponseModeFragmentJWT:
+		redirectURI.Fragment = url.Values{"response": {response}}.Encode()
+	default:
+		// query.jwt, and jwt which is query.jwt for the "code" response type
+		query := redirectURI.Query()
+		query.Set("response", response)
+		redirectURI.RawQuery = query.Encode()
+	}
+
+	rw.Header().Set("Location", redirectURI.String())
+	rw.WriteHeader(http.StatusSeeOther)
+}
+
+// newResponseToken creates the JWT that carries the authorization response parameters
+func (h *jarmResponseModeHandler) newResponseToken(clientID string, params url.Values) (string, error) {
+	now := time.Now()
+	builder := jwt.NewBuilder().
+		Issuer(h.issuer).
+		Audience([]string{clientID}).
+		IssuedAt(now).
+		Expiration(now.Add(jarmResponseLifetime))
+	for key := range params {
+		// The "iss" response parameter is the issuer, which is already in the token
+		if key == "iss" || params.Get(key) == "" {
+			continue
+		}
+		builder = builder.Claim(key, params.Get(key))
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+	return signJWT(h.signer, token, "")
+}
+
+// applyDefaultResponseMode sets the response mode the client configured on authorization requests that don't
+// specify one
+func applyDefaultResponseMode(ar fosite.AuthorizeRequester) {
+	request, ok := ar.(*fosite.AuthorizeRequest)
+	if !ok || request.ResponseMode != fosite.ResponseModeDefault {
+		return
+	}
+
+	if responseMode := oidcClientOf(ar.GetClient()).DefaultResponseMode; responseMode != "" {
+		request.ResponseMode = fosite.ResponseModeType(responseMode)
+	}
+}
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+func TestJARMResponseModeHandler(t *testing.T) {
+	const (
+		issuer      = "https://pocket-id.example.com"
+		clientID    = "jarm-client"
+		redirectURL = "https://app.example.com/callback"
+	)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := testTokenSigner{key: key}
+	handler := newJARMResponseModeHandler(signer, issuer)
+
+	newRequest := func(t *testing.T, responseMode fosite.ResponseModeType) *fosite.AuthorizeRequest {
+		t.Helper()
+		redirectURI, err := url.Parse(redirectURL)
+		require.NoError(t, err)
+		return &fosite.AuthorizeRequest{
+			Request: fosite.Request{
+				Client: Client{OidcClient: model.OidcClient{
+					Base:         model.Base{ID: clientID},
+					CallbackURLs: model.UrlList{redirectURL},
+				}},
+				Form: url.Values{},
+			},
+			RedirectURI:   redirectURI,
+			ResponseTypes: fosite.Arguments{"code"},
+			ResponseMode:  responseMode,
+			State:         "state-value",
+		}
+	}
+
+	// responseToken extracts the "response" parameter from where the response mode delivers it
+	responseToken := func(t *testing.T, rec *httptest.ResponseRecorder, responseMode fosite.ResponseModeType) string {
+		t.Helper()
+		if responseMode == ResponseModeFormPostJWT {
+			require.Equal(t, http.StatusOK, rec.Code)
+			matches := regexp.MustCompile(`name="response" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+			require.Len(t, matches, 2)
+			return html.UnescapeString(matches[1])
+		}
+
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "app.example.com", location.Host)
+		if responseMode == ResponseModeFragmentJWT {
+			fragment, err := url.ParseQuery(location.Fragment)
+			require.NoError(t, err)
+			assert.Empty(t, location.Query().Get("response"))
+			return fragment.Get("response")
+		}
+		assert.Empty(t, location.Fragment)
+		return location.Query().Get("response")
+	}
+
+	parseResponse := func(t *testing.T, response string) jwt.Token {
+		t.Helper()
+		publicKeys, err := signer.GetPublicKeySet()
+		require.NoError(t, err)
+		token, err := jwt.Parse([]byte(response), jwt.WithKeySet(publicKeys), jwt.WithValidate(true), jwt.WithIssuer(issuer), jwt.WithAudience(clientID))
+		require.NoError(t, err)
+		return token
+	}
+
+	for _, responseMode := range []fosite.ResponseModeType{ResponseModeQueryJWT, ResponseModeJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT} {
+		t.Run("response is delivered in a signed JWT with "+string(responseMode), func(t *testing.T) {
+			response := fosite.NewAuthorizeResponse()
+			response.AddParameter("code", "authorization-code")
+			response.AddParameter("state", "state-value")
+			response.AddParameter("iss", issuer)
+
+			rec := httptest.NewRecorder()
+			handler.WriteAuthorizeResponse(t.Context(), rec, newRequest(t, responseMode), response)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+			token := parseResponse(t, responseToken(t, rec, responseMode))
+			var code, state string
+			require.NoError(t, token.Get("code", &code))
+			require.NoError(t, token.Get("state", &state))
+			assert.Equal(t, "authorization-code", code)
+			assert.Equal(t, "state-value", state)
+			_, hasExpiration := token.Expiration()
+			assert.True(t, hasExpiration)
+		})
+	}
+
+	t.Run("errors are delivered in a signed JWT", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.WriteAuthorizeError(t.Context(), rec, newRequest(t, ResponseModeQueryJWT), fosite.ErrAccessDenied)
+
+		token := parseResponse(t, responseToken(t, rec, ResponseModeQueryJWT))
+		var errorCode, state string
+		require.NoError(t, token.Get("error", &errorCode))
+		require.NoError(t, token.Get("state", &state))
+		assert.Equal(t, fosite.ErrAccessDenied.ErrorField, errorCode)
+		assert.Equal(t, "state-value", state)
+	})
+
+	t.Run("errors aren't redirected without a valid redirect URI", func(t *testing.T) {
+		request := newRequest(t, ResponseModeQueryJWT)
+		request.RedirectURI, err = url.Parse("https://attacker.example.com/callback")
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		handler.WriteAuthorizeError(t.Context(), rec, request, fosite.ErrInvalidRequest)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+}
+
+func TestApplyDefaultResponseMode(t *testing.T) {
+	newRequest := func(responseMode fosite.ResponseModeType, defaultResponseMode string) *fosite.AuthorizeRequest {
+		return &fosite.AuthorizeRequest{
+			Request: fosite.Request{
+				Client: Client{OidcClient: model.OidcClient{DefaultResponseMode: defaultResponseMode}},
+			},
+			ResponseMode: responseMode,
+		}
+	}
+
+	t.Run("default response mode of the client is applied", func(t *testing.T) {
+		request := newRequest(fosite.ResponseModeDefault, string(ResponseModeFormPostJWT))
+		applyDefaultResponseMode(request)
+		assert.Equal(t, ResponseModeFormPostJWT, request.GetResponseMode())
+	})
+
+	t.Run("requested response mode takes precedence", func(t *testing.T) {
+		request := newRequest(fosite.ResponseModeQuery, string(ResponseModeFormPostJWT))
+		applyDefaultResponseMode(request)
+		assert.Equal(t, fosite.ResponseModeQuery, request.GetResponseMode())
+	})
+
+	t.Run("client without a default response mode", func(t *testing.T) {
+		request := newRequest(fosite.ResponseModeDefault, "")
+		applyDefaultResponseMode(request)
+		assert.Equal(t, fosite.ResponseModeDefault, request.GetResponseMode())
+	})
+}
@@ -18,6 +18,7 @@ type OAuth2Session struct {
 	Key                  string
 	RequestID            string
 	AccessTokenSignature string
+	DPoPJKT              string `gorm:"column:dpop_jkt"`
 	Active               bool
 	RequestData          string
 	ExpiresAt            *datatype.DateTime
@@ -46,6 +47,8 @@ type InteractionSession struct {
 	model.Base
 
 	Scopes datatype.StringList
+	// Resources are the identifiers of the API resources requested with resource indicators
+	Resources datatype.StringList
 
 	ClientID string
 	Client   model.OidcClient
@@ -73,3 +76,33 @@ func (p *InteractionSessionParameters) Scan(value any) error {
 func (p InteractionSessionParameters) Value() (driver.Value, error) {
 	return json.Marshal(p)
 }
+
+type backchannelLogoutStatus string
+
+const (
+	backchannelLogoutStatusPending   backchannelLogoutStatus = "pending"
+	backchannelLogoutStatusDelivered backchannelLogoutStatus = "delivered"
+	backchannelLogoutStatusFailed    backchannelLogoutStatus = "failed"
+)
+
+// backchannelLogout is a logout token that has to be delivered to the back-channel logout URI of a client.
+// The token itself is signed on every delivery attempt, as logout tokens are short-lived.
+type backchannelLogout struct {
+	model.Base
+
+	ClientID string
+	Client   model.OidcClient
+	// UserID is kept after the user has been deleted, the subject of the logout token is derived from it
+	UserID    string
+	SessionID string
+
+	Status        backchannelLogoutStatus
+	Attempts      int
+	LastError     string
+	NextAttemptAt datatype.DateTime
+	DeliveredAt   *datatype.DateTime
+}
+
+func (backchannelLogout) TableName() string {
+	return "oidc_backchannel_logouts"
+}
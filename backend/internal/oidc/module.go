@@ -2,13 +2,16 @@ package oidc
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
 	"gorm.io/gorm"
 )
 
@@ -16,12 +19,20 @@ type Config struct {
 	BaseURL      string
 	TokenBaseURL string
 	Secret       string
+	// ClientCAs are the CAs that issue the client certificates of clients with mutual-TLS client authentication,
+	// nil if client certificates aren't verified against a CA
+	ClientCAs *x509.CertPool
+	// ClientCertificateHeader is the header a trusted proxy forwards the client certificate in, empty if the
+	// certificate is only taken from the TLS connection
+	ClientCertificateHeader string
 }
 
 type TokenSigner interface {
-	GetPrivateKey() any
-	GetKeyAlg() (jwa.KeyAlgorithm, error)
-	GetKeyID() (string, bool)
+	// GetSigningKey returns the active private key with its key ID and algorithm, which are read together so they
+	// can't belong to different keys while the keys are rotated
+	GetSigningKey() (privateKey any, keyID string, alg jwa.KeyAlgorithm, err error)
+	// GetPublicKeySet returns the public keys that are accepted to verify tokens, which include retired and next keys
+	GetPublicKeySet() (jwk.Set, error)
 }
 
 type CustomClaimSource interface {
@@ -36,6 +47,11 @@ type AuditLogger interface {
 	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
 }
 
+// BackchannelAuthenticationNotifier tells users about backchannel authentication requests they have to approve, e.g. by email
+type BackchannelAuthenticationNotifier interface {
+	NotifyBackchannelAuthenticationRequest(ctx context.Context, user model.User, client model.OidcClient, bindingMessage, approvalURL string, expiresAt time.Time)
+}
+
 type Dependencies struct {
 	DB         *gorm.DB
 	Config     Config
@@ -45,10 +61,18 @@ type Dependencies struct {
 	CustomClaims CustomClaimSource
 	Reauth       ReauthenticationTokenConsumer
 	AuditLog     AuditLogger
+	// BackchannelAuthentication is optional; without it users only see backchannel authentication requests in the UI
+	BackchannelAuthentication BackchannelAuthenticationNotifier
 }
 
 type Module struct {
 	Preview *ClientPreviewBuilder
+	// Subjects derives the subject identifiers of users for clients
+	Subjects SubjectResolver
+	// BackchannelLogout notifies clients when sessions of users end
+	BackchannelLogout *BackchannelLogoutService
+	// RequestObjectEncryptionKey is the public key clients can encrypt request objects with, which is published in the JWKS
+	RequestObjectEncryptionKey jwk.Key
 
 	config Config
 	store  *Store
@@ -58,13 +82,16 @@ type Module struct {
 	userInfoHandler      *userInfoHandler
 	parHandler           *parHandler
 	introspectionHandler *introspectionHandler
+	revocationHandler    *revocationHandler
 	endSessionHandler    *endSessionHandler
 	deviceHandler        *deviceHandler
+
+	backchannelAuthenticationHandler *backchannelAuthenticationHandler
 }
 
 func New(ctx context.Context, deps Dependencies) (*Module, error) {
 	store := NewStore(deps.DB)
-	authenticator, err := newFederatedClientAuthenticator(ctx, store, deps.HTTPClient, deps.Config.BaseURL)
+	authenticator, err := newFederatedClientAuthenticator(ctx, store, deps.HTTPClient, deps.Config.BaseURL, deps.Config.TokenBaseURL+"/api/oidc/token")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create federated client authenticator: %w", err)
 	}
@@ -73,26 +100,71 @@ func New(ctx context.Context, deps Dependencies) (*Module, error) {
 		return nil, fmt.Errorf("failed to create OAuth2 provider: %w", err)
 	}
 
-	claimsService := newClaimsService(deps.DB, deps.CustomClaims, deps.Config.BaseURL, deps.Signer)
+	dpopNonceKey, err := deriveSecret(deps.Config.Secret, "pocketid/dpop_nonce")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive DPoP nonce key: %w", err)
+	}
+	dpop := newDPoPValidator(store, dpopNonceKey, deps.Config.BaseURL, deps.Config.TokenBaseURL)
+
+	pairwiseSubjectKey, err := deriveSecret(deps.Config.Secret, "pocketid/pairwise_subject")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive pairwise subject key: %w", err)
+	}
+	subjects := newSubjectResolver(pairwiseSubjectKey)
+
+	requestObjectDecryptionKey, err := newRequestObjectDecryptionKey(deps.Config.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive request object encryption key: %w", err)
+	}
+	requestObjectEncryptionKey, err := requestObjectDecryptionKey.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request object encryption key: %w", err)
+	}
+	requestObjects := newRequestObjectResolver(store, authenticator, deps.HTTPClient, deps.Config.BaseURL, requestObjectDecryptionKey)
+	responseEncrypter := newResponseEncrypter(authenticator, deps.Signer, deps.Config.BaseURL)
+
+	claimsService := newClaimsService(deps.DB, deps.CustomClaims, deps.Config.BaseURL, deps.Signer, subjects)
 	previewBuilder := newClientPreviewBuilder(claimsService, provider.tokenStrategies)
 	interactionSessionService := newInteractionSessionService(deps.DB)
 	authorizationService := newAuthorizationService(deps.DB, interactionSessionService, claimsService, deps.Reauth, deps.AuditLog)
 	deviceService := newDeviceService(provider, store, provider.deviceStrategy, authorizationService, claimsService, deps.AuditLog, deps.DB)
-	endSessionService := newEndSessionService(deps.DB, store, deps.Signer, deps.Config.BaseURL)
+	// Clients choose the endpoints logout tokens and CIBA notifications are sent to, so requests to them can only connect to public addresses
+	publicHTTPClient := utils.PublicOnlyHTTPClient(deps.HTTPClient)
+	backchannelLogout := newBackchannelLogoutService(deps.DB, store, deps.Signer, subjects, publicHTTPClient, deps.Config.BaseURL)
+	backchannelAuthenticationService := newBackchannelAuthenticationService(
+		provider.config.ClientAuthenticationStrategy,
+		store,
+		authorizationService,
+		claimsService,
+		deps.Signer,
+		subjects,
+		deps.BackchannelAuthentication,
+		deps.AuditLog,
+		publicHTTPClient,
+		deps.DB,
+		deps.Config.BaseURL,
+	)
+	endSessionService := newEndSessionService(deps.DB, store, deps.Signer, subjects, backchannelLogout, deps.Config.BaseURL)
 
 	return &Module{
-		Preview: previewBuilder,
+		Preview:                    previewBuilder,
+		Subjects:                   subjects,
+		BackchannelLogout:          backchannelLogout,
+		RequestObjectEncryptionKey: requestObjectEncryptionKey,
 
 		config: deps.Config,
 		store:  store,
 
-		authorizationHandler: newAuthorizationHandler(provider, authorizationService, deps.Config.BaseURL),
-		tokenHandler:         newTokenHandler(provider, claimsService),
-		userInfoHandler:      newUserInfoHandler(provider, claimsService),
-		parHandler:           newPARHandler(provider),
-		introspectionHandler: newIntrospectionHandler(provider, authenticator, deps.Config.BaseURL),
+		authorizationHandler: newAuthorizationHandler(provider, authorizationService, requestObjects, deps.Config.BaseURL),
+		tokenHandler:         newTokenHandler(provider, claimsService, dpop, provider.mtls, responseEncrypter, deps.AuditLog, deps.DB),
+		userInfoHandler:      newUserInfoHandler(provider, claimsService, dpop, provider.mtls, responseEncrypter),
+		parHandler:           newPARHandler(provider, requestObjects),
+		introspectionHandler: newIntrospectionHandler(provider, authenticator, provider.mtls, deps.Config.BaseURL),
+		revocationHandler:    newRevocationHandler(provider, authenticator, deps.AuditLog, deps.DB),
 		endSessionHandler:    newEndSessionHandler(endSessionService, deps.Config.BaseURL),
 		deviceHandler:        newDeviceHandler(provider, deviceService),
+
+		backchannelAuthenticationHandler: newBackchannelAuthenticationHandler(provider, backchannelAuthenticationService),
 	}, nil
 }
 
@@ -112,10 +184,17 @@ func (m *Module) RegisterRoutes(rootGroup *gin.RouterGroup, apiGroup *gin.Router
 
 	apiGroup.POST("/oidc/introspect", m.introspectionHandler.introspectToken)
 
+	apiGroup.POST("/oidc/revoke", m.revocationHandler.revokeToken)
+
 	apiGroup.GET("/oidc/end-session", optionalBrowserAuth, m.endSessionHandler.endSession)
 	apiGroup.POST("/oidc/end-session", optionalBrowserAuth, m.endSessionHandler.endSession)
 
 	apiGroup.POST("/oidc/device/authorize", m.deviceHandler.authorizeDevice)
 	apiGroup.POST("/oidc/device/verify", browserAuth, m.deviceHandler.verifyDeviceCode)
 	apiGroup.GET("/oidc/device/info", browserAuth, m.deviceHandler.deviceCodeInfo)
+
+	apiGroup.POST("/oidc/backchannel-authentication", m.backchannelAuthenticationHandler.authenticate)
+	apiGroup.GET("/oidc/backchannel-authentication/requests", browserAuth, m.backchannelAuthenticationHandler.listRequests)
+	apiGroup.POST("/oidc/backchannel-authentication/requests/:id/approve", browserAuth, m.backchannelAuthenticationHandler.approveRequest)
+	apiGroup.POST("/oidc/backchannel-authentication/requests/:id/deny", browserAuth, m.backchannelAuthenticationHandler.denyRequest)
 }
@@ -0,0 +1,278 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/ory/fosite"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// Client authentication methods that use a client certificate, as defined in RFC 8705 section 2
+const (
+	AuthMethodTLSClientAuth           = "tls_client_auth"
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+var errNoClientCertificateAuthentication = errors.New("no client certificate authentication")
+
+// mtlsClientStore is the subset of the store the mutual-TLS authenticator needs.
+type mtlsClientStore interface {
+	GetClient(ctx context.Context, id string) (fosite.Client, error)
+}
+
+// mtlsKeySource loads the keys self-signed client certificates are matched against
+type mtlsKeySource interface {
+	clientJWKSet(ctx context.Context, credentials model.OidcClientCredentials) (jwk.Set, error)
+}
+
+// mtlsAuthenticator authenticates clients with client certificates and binds the tokens issued to them to the
+// certificate, as defined in RFC 8705.
+// The certificate is taken from the TLS connection, or from a header set by a trusted proxy that terminates TLS.
+type mtlsAuthenticator struct {
+	clients mtlsClientStore
+	keys    mtlsKeySource
+	// clientCAs are the CAs the certificates of tls_client_auth clients must be issued by
+	clientCAs *x509.CertPool
+	// certificateHeader is the header a trusted proxy forwards the client certificate in, empty if there's no such proxy
+	certificateHeader string
+	now               func() time.Time
+}
+
+func newMTLSAuthenticator(clients mtlsClientStore, keys mtlsKeySource, clientCAs *x509.CertPool, certificateHeader string) *mtlsAuthenticator {
+	return &mtlsAuthenticator{
+		clients:           clients,
+		keys:              keys,
+		clientCAs:         clientCAs,
+		certificateHeader: certificateHeader,
+		now:               time.Now,
+	}
+}
+
+// enabled reports whether client certificates are available to the server
+func (m *mtlsAuthenticator) enabled() bool {
+	return m != nil && (m.clientCAs != nil || m.certificateHeader != "")
+}
+
+// clientCertificate returns the client certificate of the request and the intermediate certificates sent with it,
+// or nil if the request doesn't carry a certificate
+func (m *mtlsAuthenticator) clientCertificate(r *http.Request) (*x509.Certificate, []*x509.Certificate) {
+	if !m.enabled() {
+		return nil, nil
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], r.TLS.PeerCertificates[1:]
+	}
+
+	if m.certificateHeader == "" {
+		return nil, nil
+	}
+	value := r.Header.Get(m.certificateHeader)
+	if value == "" {
+		return nil, nil
+	}
+	certificate, err := parseForwardedCertificate(value)
+	if err != nil {
+		return nil, nil
+	}
+	return certificate, nil
+}
+
+// certificateThumbprint returns the thumbprint of the client certificate of the request, or an empty string if the
+// request doesn't carry a certificate
+func (m *mtlsAuthenticator) certificateThumbprint(r *http.Request) string {
+	certificate, _ := m.clientCertificate(r)
+	if certificate == nil {
+		return ""
+	}
+	return certificateThumbprint(certificate)
+}
+
+// authenticate authenticates the client with its client certificate
+// It returns errNoClientCertificateAuthentication if the client doesn't authenticate with a certificate or the
+// request carries other client credentials, so the caller can fall back to other authentication methods.
+func (m *mtlsAuthenticator) authenticate(ctx context.Context, r *http.Request, form url.Values) (fosite.Client, error) {
+	if !m.enabled() || form.Get("client_id") == "" || form.Get("client_secret") != "" || form.Get("client_assertion") != "" {
+		return nil, errNoClientCertificateAuthentication
+	}
+	if _, _, ok := r.BasicAuth(); ok {
+		return nil, errNoClientCertificateAuthentication
+	}
+
+	fositeClient, err := m.clients.GetClient(ctx, form.Get("client_id"))
+	if err != nil {
+		// Unknown clients are rejected by the default client authentication
+		return nil, errNoClientCertificateAuthentication
+	}
+	client, ok := fositeClient.(Client)
+	if !ok || client.Credentials.TLSClientAuthMethod == "" {
+		return nil, errNoClientCertificateAuthentication
+	}
+
+	certificate, intermediates := m.clientCertificate(r)
+	if certificate == nil {
+		return nil, fosite.ErrInvalidClient.WithHint("The client authenticates with a client certificate, but the request doesn't carry one.")
+	}
+
+	switch client.Credentials.TLSClientAuthMethod {
+	case AuthMethodTLSClientAuth:
+		err = m.verifyPKICertificate(client.Credentials, certificate, intermediates)
+	case AuthMethodSelfSignedTLSClientAuth:
+		err = m.verifySelfSignedCertificate(ctx, client.Credentials, certificate)
+	default:
+		err = fmt.Errorf("unknown client authentication method '%s'", client.Credentials.TLSClientAuthMethod)
+	}
+	if err != nil {
+		return nil, fosite.ErrInvalidClient.WithHint("The client certificate is invalid.").WithWrap(err)
+	}
+
+	return client, nil
+}
+
+// verifyPKICertificate verifies that the certificate of a tls_client_auth client is issued by one of the trusted CAs
+// and matches the subject registered for the client, as defined in RFC 8705 section 2.1
+func (m *mtlsAuthenticator) verifyPKICertificate(credentials model.OidcClientCredentials, certificate *x509.Certificate, intermediates []*x509.Certificate) error {
+	if m.clientCAs == nil {
+		return errors.New("no CAs are configured to verify client certificates")
+	}
+
+	intermediatePool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		intermediatePool.AddCert(intermediate)
+	}
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         m.clientCAs,
+		Intermediates: intermediatePool,
+		CurrentTime:   m.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !certificateMatchesSubject(certificate, credentials) {
+		return errors.New("the certificate doesn't match the subject registered for the client")
+	}
+	return nil
+}
+
+// verifySelfSignedCertificate verifies that the public key of the certificate of a self_signed_tls_client_auth client
+// is one of the keys registered for the client, as defined in RFC 8705 section 2.2
+func (m *mtlsAuthenticator) verifySelfSignedCertificate(ctx context.Context, credentials model.OidcClientCredentials, certificate *x509.Certificate) error {
+	now := m.now()
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return errors.New("the certificate is expired or not yet valid")
+	}
+
+	certificateKey, err := jwk.Import(certificate.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to import the public key of the certificate: %w", err)
+	}
+	certificateKeyThumbprint, err := certificateKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("failed to compute the thumbprint of the certificate key: %w", err)
+	}
+
+	keys, err := m.keys.clientJWKSet(ctx, credentials)
+	if err != nil {
+		return fmt.Errorf("failed to load the keys of the client: %w", err)
+	}
+	for i := range keys.Len() {
+		key, ok := keys.Key(i)
+		if !ok {
+			continue
+		}
+		thumbprint, err := key.Thumbprint(crypto.SHA256)
+		if err == nil && bytes.Equal(thumbprint, certificateKeyThumbprint) {
+			return nil
+		}
+	}
+
+	return errors.New("the certificate doesn't match any of the keys of the client")
+}
+
+// certificateMatchesSubject reports whether the certificate matches the subject DN or the subject alternative name
+// registered for a tls_client_auth client
+// The subject DN is compared in its RFC 2253 string representation, e.g. "CN=client,O=Example".
+func certificateMatchesSubject(certificate *x509.Certificate, credentials model.OidcClientCredentials) bool {
+	switch {
+	case credentials.TLSClientAuthSubjectDN != "":
+		return certificate.Subject.String() == credentials.TLSClientAuthSubjectDN
+	case credentials.TLSClientAuthSANDNS != "":
+		return slices.Contains(certificate.DNSNames, credentials.TLSClientAuthSANDNS)
+	case credentials.TLSClientAuthSANURI != "":
+		return slices.ContainsFunc(certificate.URIs, func(u *url.URL) bool {
+			return u.String() == credentials.TLSClientAuthSANURI
+		})
+	case credentials.TLSClientAuthSANIP != "":
+		ip := net.ParseIP(credentials.TLSClientAuthSANIP)
+		return ip != nil && slices.ContainsFunc(certificate.IPAddresses, ip.Equal)
+	case credentials.TLSClientAuthSANEmail != "":
+		return slices.Contains(certificate.EmailAddresses, credentials.TLSClientAuthSANEmail)
+	default:
+		return false
+	}
+}
+
+// validateTokenBinding validates that a request made with a certificate-bound access token carries the certificate
+// the token is bound to, as defined in RFC 8705 section 3
+func (m *mtlsAuthenticator) validateTokenBinding(r *http.Request, session *Session) error {
+	if session.CertificateThumbprint == "" {
+		return nil
+	}
+
+	thumbprint := m.certificateThumbprint(r)
+	if thumbprint == "" {
+		return fosite.ErrRequestUnauthorized.WithDescription("The access token is bound to a client certificate, but the request doesn't carry one.")
+	}
+	if thumbprint != session.CertificateThumbprint {
+		return fosite.ErrRequestUnauthorized.WithDescription("The access token is bound to another client certificate.")
+	}
+	return nil
+}
+
+// certificateThumbprint returns the base64url-encoded SHA-256 hash of the DER encoding of the certificate, which is
+// the "x5t#S256" confirmation method of certificate-bound tokens
+func certificateThumbprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// parseForwardedCertificate parses a client certificate a proxy forwarded in a header, either as URL-encoded PEM
+// (e.g. $ssl_client_escaped_cert of NGINX) or as base64-encoded DER (e.g. Traefik)
+func parseForwardedCertificate(value string) (*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "%") {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+		value = unescaped
+	}
+
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// testClientStore returns the clients it holds
+type testClientStore map[string]Client
+
+func (s testClientStore) GetClient(_ context.Context, id string) (fosite.Client, error) {
+	client, ok := s[id]
+	if !ok {
+		return nil, fosite.ErrNotFound
+	}
+	return client, nil
+}
+
+// testCertificate is a certificate with its private key
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// newTestCertificate creates a client certificate for the subject, which is self-signed if issuer is nil
+func newTestCertificate(t *testing.T, subject string, issuer *testCertificate, isCA bool) testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: subject, Organization: []string{"Example"}},
+		DNSNames:     []string{subject},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	parent, signingKey := template, key
+	if issuer != nil {
+		parent, signingKey = issuer.certificate, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signingKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCertificate{certificate: certificate, key: key}
+}
+
+// newCertificateRequest returns a token request that is sent over a TLS connection with the client certificate
+func newCertificateRequest(form url.Values, certificates ...*x509.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/oidc/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(certificates) > 0 {
+		r.TLS = &tls.ConnectionState{PeerCertificates: certificates}
+	}
+	return r
+}
+
+func TestMTLSAuthenticatorAuthenticate(t *testing.T) {
+	ca := newTestCertificate(t, "Example CA", nil, true)
+	otherCA := newTestCertificate(t, "Other CA", nil, true)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.certificate)
+
+	pkiCertificate := newTestCertificate(t, "pki-client.example.com", &ca, false)
+	untrustedCertificate := newTestCertificate(t, "pki-client.example.com", &otherCA, false)
+	selfSignedCertificate := newTestCertificate(t, "self-signed-client", nil, false)
+
+	selfSignedKey, err := jwk.Import(&selfSignedCertificate.key.PublicKey)
+	require.NoError(t, err)
+	selfSignedJWKS := jwk.NewSet()
+	require.NoError(t, selfSignedJWKS.AddKey(selfSignedKey))
+	rawSelfSignedJWKS, err := json.Marshal(selfSignedJWKS)
+	require.NoError(t, err)
+
+	clients := testClientStore{
+		"pki-client": Client{OidcClient: model.OidcClient{
+			Base: model.Base{ID: "pki-client"},
+			Credentials: model.OidcClientCredentials{
+				TLSClientAuthMethod: AuthMethodTLSClientAuth,
+				TLSClientAuthSANDNS: "pki-client.example.com",
+			},
+		}},
+		"dn-client": Client{OidcClient: model.OidcClient{
+			Base: model.Base{ID: "dn-client"},
+			Credentials: model.OidcClientCredentials{
+				TLSClientAuthMethod:    AuthMethodTLSClientAuth,
+				TLSClientAuthSubjectDN: "CN=other.example.com,O=Example",
+			},
+		}},
+		"self-signed-client": Client{OidcClient: model.OidcClient{
+			Base: model.Base{ID: "self-signed-client"},
+			Credentials: model.OidcClientCredentials{
+				TLSClientAuthMethod: AuthMethodSelfSignedTLSClientAuth,
+				JWKS:                string(rawSelfSignedJWKS),
+			},
+		}},
+		"secret-client": Client{OidcClient: model.OidcClient{Base: model.Base{ID: "secret-client"}}},
+	}
+	authenticator := newMTLSAuthenticator(clients, staticClientKeys{}, clientCAs, "")
+
+	authenticate := func(t *testing.T, clientID string, certificates ...*x509.Certificate) (fosite.Client, error) {
+		t.Helper()
+		form := url.Values{"client_id": {clientID}}
+		return authenticator.authenticate(t.Context(), newCertificateRequest(form, certificates...), form)
+	}
+
+	t.Run("certificate issued by a trusted CA for the registered subject", func(t *testing.T) {
+		client, err := authenticate(t, "pki-client", pkiCertificate.certificate)
+		require.NoError(t, err)
+		assert.Equal(t, "pki-client", client.GetID())
+	})
+
+	t.Run("self-signed certificate with a registered key", func(t *testing.T) {
+		client, err := authenticate(t, "self-signed-client", selfSignedCertificate.certificate)
+		require.NoError(t, err)
+		assert.Equal(t, "self-signed-client", client.GetID())
+	})
+
+	t.Run("clients without certificate authentication fall back to other methods", func(t *testing.T) {
+		_, err := authenticate(t, "secret-client", pkiCertificate.certificate)
+		require.ErrorIs(t, err, errNoClientCertificateAuthentication)
+	})
+
+	t.Run("requests with a client secret fall back to other methods", func(t *testing.T) {
+		form := url.Values{"client_id": {"pki-client"}, "client_secret": {"secret"}}
+		_, err := authenticator.authenticate(t.Context(), newCertificateRequest(form, pkiCertificate.certificate), form)
+		require.ErrorIs(t, err, errNoClientCertificateAuthentication)
+	})
+
+	rejected := []struct {
+		name         string
+		clientID     string
+		certificates []*x509.Certificate
+	}{
+		{name: "request without a certificate", clientID: "pki-client"},
+		{name: "certificate issued by an untrusted CA", clientID: "pki-client", certificates: []*x509.Certificate{untrustedCertificate.certificate}},
+		{name: "certificate for another subject", clientID: "dn-client", certificates: []*x509.Certificate{pkiCertificate.certificate}},
+		{name: "self-signed certificate for a tls_client_auth client", clientID: "pki-client", certificates: []*x509.Certificate{selfSignedCertificate.certificate}},
+		{name: "self-signed certificate with a key that isn't registered", clientID: "self-signed-client", certificates: []*x509.Certificate{pkiCertificate.certificate}},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name+" is rejected", func(t *testing.T) {
+			_, err := authenticate(t, tt.clientID, tt.certificates...)
+			requireRFC6749Error(t, err, fosite.ErrInvalidClient.ErrorField)
+		})
+	}
+}
+
+func TestMTLSAuthenticatorClientCertificate(t *testing.T) {
+	certificate := newTestCertificate(t, "client.example.com", nil, false).certificate
+	pemCertificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+
+	t.Run("certificate of the TLS connection", func(t *testing.T) {
+		authenticator := newMTLSAuthenticator(testClientStore{}, nil, x509.NewCertPool(), "")
+		assert.Equal(t, certificateThumbprint(certificate), authenticator.certificateThumbprint(newCertificateRequest(nil, certificate)))
+	})
+
+	forwarded := map[string]string{
+		"URL-encoded PEM":    url.PathEscape(pemCertificate),
+		"base64-encoded DER": base64.StdEncoding.EncodeToString(certificate.Raw),
+	}
+	for name, value := range forwarded {
+		t.Run("certificate forwarded by a trusted proxy as "+name, func(t *testing.T) {
+			authenticator := newMTLSAuthenticator(testClientStore{}, nil, nil, "X-Client-Cert")
+			r := newCertificateRequest(nil)
+			r.Header.Set("X-Client-Cert", value)
+			assert.Equal(t, certificateThumbprint(certificate), authenticator.certificateThumbprint(r))
+		})
+	}
+
+	t.Run("forwarded certificate is ignored without a configured header", func(t *testing.T) {
+		authenticator := newMTLSAuthenticator(testClientStore{}, nil, x509.NewCertPool(), "")
+		r := newCertificateRequest(nil)
+		r.Header.Set("X-Client-Cert", url.PathEscape(pemCertificate))
+		assert.Empty(t, authenticator.certificateThumbprint(r))
+	})
+
+	t.Run("certificates are ignored if mutual TLS isn't enabled", func(t *testing.T) {
+		authenticator := newMTLSAuthenticator(testClientStore{}, nil, nil, "")
+		assert.Empty(t, authenticator.certificateThumbprint(newCertificateRequest(nil, certificate)))
+	})
+}
+
+func TestMTLSAuthenticatorValidateTokenBinding(t *testing.T) {
+	certificate := newTestCertificate(t, "client.example.com", nil, false).certificate
+	otherCertificate := newTestCertificate(t, "other.example.com", nil, false).certificate
+	authenticator := newMTLSAuthenticator(testClientStore{}, nil, x509.NewCertPool(), "")
+
+	session := NewEmptySession()
+	session.BindCertificate(certificateThumbprint(certificate))
+
+	require.NoError(t, authenticator.validateTokenBinding(newCertificateRequest(nil, certificate), session))
+	requireRFC6749Error(t, authenticator.validateTokenBinding(newCertificateRequest(nil), session), fosite.ErrRequestUnauthorized.ErrorField)
+	requireRFC6749Error(t, authenticator.validateTokenBinding(newCertificateRequest(nil, otherCertificate), session), fosite.ErrRequestUnauthorized.ErrorField)
+	require.NoError(t, authenticator.validateTokenBinding(newCertificateRequest(nil), NewEmptySession()), "tokens that aren't bound can be used without a certificate")
+}
+
+func TestBindCertificate(t *testing.T) {
+	publicClient := Client{OidcClient: model.OidcClient{IsPublic: true}}
+	confidentialClient := Client{OidcClient: model.OidcClient{}}
+
+	t.Run("tokens are bound to the certificate", func(t *testing.T) {
+		session := NewEmptySession()
+		require.NoError(t, bindCertificate(session, confidentialClient, "thumbprint"))
+		assert.Equal(t, "thumbprint", session.CertificateThumbprint)
+		assert.Equal(t, map[string]interface{}{"x5t#S256": "thumbprint"}, session.GetExtraClaims()["cnf"])
+	})
+
+	t.Run("refresh tokens of public clients stay bound to the certificate", func(t *testing.T) {
+		session := NewEmptySession()
+		session.BindCertificate("thumbprint")
+		requireRFC6749Error(t, bindCertificate(session, publicClient, ""), fosite.ErrInvalidGrant.ErrorField)
+		requireRFC6749Error(t, bindCertificate(session, publicClient, "other-thumbprint"), fosite.ErrInvalidGrant.ErrorField)
+		require.NoError(t, bindCertificate(session, publicClient, "thumbprint"))
+	})
+
+	t.Run("confidential clients can renew their certificate", func(t *testing.T) {
+		session := NewEmptySession()
+		session.BindCertificate("thumbprint")
+		require.NoError(t, bindCertificate(session, confidentialClient, "renewed-thumbprint"))
+		assert.Equal(t, "renewed-thumbprint", session.CertificateThumbprint)
+	})
+
+	t.Run("DPoP and certificate bindings are combined", func(t *testing.T) {
+		session := NewEmptySession()
+		session.BindDPoPKey("jkt")
+		require.NoError(t, bindCertificate(session, confidentialClient, "thumbprint"))
+		assert.Equal(t, map[string]interface{}{"jkt": "jkt", "x5t#S256": "thumbprint"}, session.GetExtraClaims()["cnf"])
+	})
+}
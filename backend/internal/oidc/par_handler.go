@@ -2,24 +2,41 @@ package oidc
 
 import (
 	"log/slog"
+	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ory/fosite"
 )
 
 type parHandler struct {
-	provider fosite.OAuth2Provider
+	provider       fosite.OAuth2Provider
+	requestObjects *requestObjectResolver
 }
 
-func newPARHandler(provider fosite.OAuth2Provider) *parHandler {
+func newPARHandler(provider fosite.OAuth2Provider, requestObjects *requestObjectResolver) *parHandler {
 	return &parHandler{
-		provider: provider,
+		provider:       provider,
+		requestObjects: requestObjects,
 	}
 }
 
 func (h *parHandler) pushedAuthorizationRequest(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	err := c.Request.ParseForm()
+	if err != nil {
+		h.provider.WritePushedAuthorizeError(ctx, c.Writer, fosite.NewAuthorizeRequest(), fosite.ErrInvalidRequest.WithWrap(err))
+		return
+	}
+	form, err := h.requestObjects.resolve(ctx, c.Request.PostForm, pushedRequestClientID(c.Request), true)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to resolve pushed authorize request object", "error", err)
+		h.provider.WritePushedAuthorizeError(ctx, c.Writer, fosite.NewAuthorizeRequest(), err)
+		return
+	}
+	replaceRequestForm(c.Request, form)
+
 	ar, err := h.provider.NewPushedAuthorizeRequest(ctx, c.Request)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to create pushed authorize request", "error", err)
@@ -27,6 +44,14 @@ func (h *parHandler) pushedAuthorizationRequest(c *gin.Context) {
 		return
 	}
 
+	// Reject unknown resources right away instead of when the user returns from the authorization endpoint
+	if client, ok := ar.GetClient().(Client); ok {
+		if _, err := client.requestedAPIResources(ar.GetRequestForm()["resource"]); err != nil {
+			h.provider.WritePushedAuthorizeError(ctx, c.Writer, ar, err)
+			return
+		}
+	}
+
 	response, err := h.provider.NewPushedAuthorizeResponse(ctx, ar, NewEmptySession())
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to create pushed authorize response", "error", err)
@@ -36,3 +61,22 @@ func (h *parHandler) pushedAuthorizationRequest(c *gin.Context) {
 
 	h.provider.WritePushedAuthorizeResponse(ctx, c.Writer, ar, response)
 }
+
+// pushedRequestClientID returns the ID of the client that pushed the authorization request, which confidential clients
+// can also send in the Authorization header
+func pushedRequestClientID(r *http.Request) string {
+	if clientID := r.PostForm.Get("client_id"); clientID != "" {
+		return clientID
+	}
+
+	username, _, ok := r.BasicAuth()
+	if !ok {
+		return ""
+	}
+	// The credentials in the Authorization header are form-encoded, as defined in RFC 6749 section 2.3.1
+	clientID, err := url.QueryUnescape(username)
+	if err != nil {
+		return ""
+	}
+	return clientID
+}
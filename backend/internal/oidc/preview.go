@@ -37,16 +37,18 @@ func (b *ClientPreviewBuilder) BuildClientPreview(ctx context.Context, client mo
 		return nil, err
 	}
 
-	userInfo, err := b.claimsService.GetUserClaims(ctx, userID, scopeArgs)
+	userInfo, err := b.claimsService.GetUserClaims(ctx, userID, client, scopeArgs)
 	if err != nil {
 		return nil, err
 	}
 
 	request := b.newPreviewRequest(ctx, client, userID, scopeArgs, authenticationMethod)
 	session := request.GetSession().(*Session)
-	applyUserClaimsToIDToken(session, userID, userInfo)
+	applyUserClaimsToIDToken(session, userInfo)
+	session.SetClientSubject(b.claimsService.subjects.Subject(client, userID))
 
-	idToken, err := b.strategies.idToken.GenerateIDToken(ctx, b.strategies.config.GetIDTokenLifespan(ctx), request)
+	idTokenLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypeAuthorizationCode, fosite.IDToken, b.strategies.config.GetIDTokenLifespan(ctx))
+	idToken, err := b.strategies.idToken.GenerateIDToken(ctx, idTokenLifespan, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate preview ID token: %w", err)
 	}
@@ -75,7 +77,15 @@ func (b *ClientPreviewBuilder) BuildClientPreview(ctx context.Context, client mo
 
 func (b *ClientPreviewBuilder) validatedScopes(ctx context.Context, client model.OidcClient, scopes []string) (fosite.Arguments, error) {
 	scopeStrategy := b.strategies.config.GetScopeStrategy(ctx)
-	clientScopes := Client{OidcClient: client}.GetScopes()
+	registeredScopes, err := clientRegisteredScopes(dbFromContext(ctx, b.claimsService.db), client.ID)
+	if err != nil {
+		return nil, err
+	}
+	apiResources, err := clientAPIResources(dbFromContext(ctx, b.claimsService.db), client.ID)
+	if err != nil {
+		return nil, err
+	}
+	clientScopes := Client{OidcClient: client, RegisteredScopes: registeredScopes, APIResources: apiResources}.GetScopes()
 
 	scopeArgs := make(fosite.Arguments, 0, len(scopes))
 	for _, scope := range fosite.RemoveEmpty(scopes) {
@@ -92,12 +102,14 @@ func (b *ClientPreviewBuilder) validatedScopes(ctx context.Context, client model
 
 func (b *ClientPreviewBuilder) newPreviewRequest(ctx context.Context, client model.OidcClient, userID string, scopes fosite.Arguments, authenticationMethod string) *fosite.Request {
 	now := time.Now().UTC()
+	fositeClient := Client{OidcClient: client}
 	session := NewAuthenticatedSession(userID, authenticationMethod, now, now)
-	session.SetExpiresAt(fosite.AccessToken, now.Add(b.strategies.config.GetAccessTokenLifespan(ctx)))
+	accessTokenLifespan := fosite.GetEffectiveLifespan(fositeClient, fosite.GrantTypeAuthorizationCode, fosite.AccessToken, b.strategies.config.GetAccessTokenLifespan(ctx))
+	session.SetExpiresAt(fosite.AccessToken, now.Add(accessTokenLifespan))
 
 	request := fosite.NewRequest()
 	request.RequestedAt = now
-	request.Client = Client{OidcClient: client}
+	request.Client = fositeClient
 	request.RequestedScope = scopes
 	request.GrantedScope = scopes
 	request.RequestedAudience = fosite.Arguments{client.ID}
@@ -23,7 +23,7 @@ func TestClientPreviewBuilderUsesFositeTokenStrategies(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	builder := newClientPreviewBuilder(newClaimsService(db, nil, "https://issuer.example.com", nil), provider.tokenStrategies)
+	builder := newClientPreviewBuilder(newClaimsService(db, nil, "https://issuer.example.com", nil, SubjectResolver{}), provider.tokenStrategies)
 
 	const (
 		userID   = "test-user"
@@ -70,7 +70,7 @@ func TestClientPreviewBuilderRejectsInvalidScope(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	builder := newClientPreviewBuilder(newClaimsService(db, nil, "https://issuer.example.com", nil), provider.tokenStrategies)
+	builder := newClientPreviewBuilder(newClaimsService(db, nil, "https://issuer.example.com", nil, SubjectResolver{}), provider.tokenStrategies)
 	_, err = builder.BuildClientPreview(t.Context(), model.OidcClient{
 		Base: model.Base{ID: "test-client"},
 		Name: "Test Client",
@@ -17,9 +17,13 @@ import (
 	"golang.org/x/crypto/hkdf"
 )
 
+// defaultRefreshTokenLifespan is the lifetime of refresh tokens of clients that don't configure their own
+const defaultRefreshTokenLifespan = 30 * 24 * time.Hour
+
 type oidcProvider struct {
 	fosite.OAuth2Provider
 	deviceStrategy *rfc8628.DefaultDeviceStrategy
+	mtls           *mtlsAuthenticator
 	tokenStrategies
 }
 
@@ -36,7 +40,7 @@ func newProvider(store *Store, authenticator *federatedClientAuthenticator, sign
 	}
 
 	var fositeConfig = &fosite.Config{
-		RefreshTokenLifespan:           30 * 24 * time.Hour,
+		RefreshTokenLifespan:           defaultRefreshTokenLifespan,
 		DeviceAndUserCodeLifespan:      15 * time.Minute,
 		DeviceAuthTokenPollingInterval: 5 * time.Second,
 		DeviceVerificationURL:          config.BaseURL + "/device",
@@ -50,6 +54,7 @@ func newProvider(store *Store, authenticator *federatedClientAuthenticator, sign
 		EnforcePKCEForPublicClients:    true,
 		EnablePKCEPlainChallengeMethod: true,
 		FormPostHTMLTemplate:           formPostTemplate,
+		ResponseModeHandlerExtension:   newJARMResponseModeHandler(signer, config.BaseURL),
 		RefreshTokenScopes:             []string{},
 		GlobalSecret:                   secret,
 	}
@@ -57,7 +62,7 @@ func newProvider(store *Store, authenticator *federatedClientAuthenticator, sign
 	keyGetter := func(context.Context) (interface{}, error) {
 		return SigningKeyFromSigner(signer)
 	}
-	sig := newJWTSigner(keyGetter)
+	sig := newJWTSigner(keyGetter, signer.GetPublicKeySet)
 	coreStrategy := compose.NewOAuth2HMACStrategy(fositeConfig)
 	deviceStrategy := compose.NewDeviceStrategy(fositeConfig)
 	accessTokenStrategy := &fositeoauth2.DefaultJWTStrategy{
@@ -69,6 +74,22 @@ func newProvider(store *Store, authenticator *federatedClientAuthenticator, sign
 		Signer: sig,
 		Config: fositeConfig,
 	}
+	tokenExchange := &tokenExchangeHandler{
+		accessTokenStrategy: accessTokenStrategy,
+		store:               store,
+		config:              fositeConfig,
+	}
+	cibaGrant := &cibaGrantHandler{
+		store:                store,
+		accessTokenStrategy:  accessTokenStrategy,
+		refreshTokenStrategy: accessTokenStrategy,
+		idTokenStrategy:      idTokenStrategy,
+		config:               fositeConfig,
+	}
+	if authenticator != nil {
+		tokenExchange.fetchJWKSet = authenticator.fetchJWKSet
+		tokenExchange.discoverJWKSURL = authenticator.discoverJWKSURL
+	}
 	provider := compose.Compose(
 		fositeConfig,
 		store,
@@ -87,14 +108,20 @@ func newProvider(store *Store, authenticator *federatedClientAuthenticator, sign
 		compose.OpenIDConnectRefreshFactory,
 		compose.OpenIDConnectDeviceFactory,
 		compose.OAuth2TokenIntrospectionFactory,
+		compose.OAuth2TokenRevocationFactory,
 		compose.OAuth2PKCEFactory,
 		compose.PushedAuthorizeHandlerFactory,
+		func(fosite.Configurator, interface{}, interface{}) interface{} { return tokenExchange },
+		func(fosite.Configurator, interface{}, interface{}) interface{} { return cibaGrant },
 	).(*fosite.Fosite)
+	tokenExchange.introspector = provider
 
-	fositeConfig.ClientAuthenticationStrategy = newClientAuthenticationStrategy(authenticator, provider)
+	mtls := newMTLSAuthenticator(store, authenticator, config.ClientCAs, config.ClientCertificateHeader)
+	fositeConfig.ClientAuthenticationStrategy = newClientAuthenticationStrategy(authenticator, mtls, provider)
 	return &oidcProvider{
 		OAuth2Provider: provider,
 		deviceStrategy: deviceStrategy,
+		mtls:           mtls,
 		tokenStrategies: tokenStrategies{
 			accessToken: accessTokenStrategy,
 			idToken:     idTokenStrategy,
@@ -127,7 +154,11 @@ func matchRedirectURI(rawurl string, client fosite.Client) (*url.URL, error) {
 
 // DeriveGlobalSecret derives a 32-byte secret from the provided secret.
 func DeriveGlobalSecret(secret string) ([]byte, error) {
-	const info = "pocketid/fosite_global_secret"
+	return deriveSecret(secret, "pocketid/fosite_global_secret")
+}
+
+// deriveSecret derives a 32-byte secret for the given purpose from the provided secret.
+func deriveSecret(secret string, info string) ([]byte, error) {
 	r := hkdf.New(sha256.New, []byte(secret), nil, []byte(info))
 
 	key := make([]byte, 32)
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/ory/fosite"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
@@ -25,16 +26,33 @@ type testTokenSigner struct {
 	key *rsa.PrivateKey
 }
 
-func (s testTokenSigner) GetPrivateKey() any {
-	return s.key
+func (s testTokenSigner) GetSigningKey() (any, string, jwa.KeyAlgorithm, error) {
+	return s.key, "test-key-id", jwa.RS256(), nil
 }
 
-func (s testTokenSigner) GetKeyAlg() (jwa.KeyAlgorithm, error) {
-	return jwa.RS256(), nil
+func (s testTokenSigner) GetPublicKeySet() (jwk.Set, error) {
+	return publicKeySetForTest(s.key, jwa.RS256())
 }
 
-func (s testTokenSigner) GetKeyID() (string, bool) {
-	return "test-key-id", true
+// publicKeySetForTest returns a JWKS with the public key of the given private key, with the key ID used by the test signers
+func publicKeySetForTest(key any, alg jwa.KeyAlgorithm) (jwk.Set, error) {
+	privateKey, err := jwk.Import(key)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := privateKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	_ = publicKey.Set(jwk.KeyIDKey, "test-key-id")
+	_ = publicKey.Set(jwk.AlgorithmKey, alg)
+
+	set := jwk.NewSet()
+	err = set.AddKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
 }
 
 func TestProviderIssuesJWTAccessTokens(t *testing.T) {
@@ -184,9 +202,10 @@ type algTestSigner struct {
 	alg jwa.KeyAlgorithm
 }
 
-func (s algTestSigner) GetPrivateKey() any                   { return s.key }
-func (s algTestSigner) GetKeyAlg() (jwa.KeyAlgorithm, error) { return s.alg, nil }
-func (s algTestSigner) GetKeyID() (string, bool)             { return "test-key-id", true }
+func (s algTestSigner) GetSigningKey() (any, string, jwa.KeyAlgorithm, error) {
+	return s.key, "test-key-id", s.alg, nil
+}
+func (s algTestSigner) GetPublicKeySet() (jwk.Set, error) { return publicKeySetForTest(s.key, s.alg) }
 
 // TestProviderIssuesAndValidatesTokensForSupportedAlgorithms guards against the
 // regression where fosite's DefaultSigner derived the JWT algorithm from the Go key type
@@ -0,0 +1,409 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
+)
+
+const (
+	// maxRequestObjectSize limits the size of the request objects fetched from a request_uri
+	maxRequestObjectSize = 64 << 10
+	// requestObjectFetchTimeout limits how long fetching a request object from a request_uri can take
+	requestObjectFetchTimeout = 10 * time.Second
+)
+
+// RequestObjectSigningAlgorithms are the algorithms accepted for signed request objects (RFC 9101)
+var RequestObjectSigningAlgorithms = asymmetricSigningAlgorithms()
+
+// RequestObjectEncryptionAlgorithms are the key management algorithms accepted for encrypted request objects
+var RequestObjectEncryptionAlgorithms = []string{
+	jwa.ECDH_ES().String(), jwa.ECDH_ES_A128KW().String(), jwa.ECDH_ES_A192KW().String(), jwa.ECDH_ES_A256KW().String(),
+}
+
+// RequestObjectEncryptionEncodings are the content encryption algorithms accepted for encrypted request objects
+var RequestObjectEncryptionEncodings = []string{
+	jwa.A128CBC_HS256().String(), jwa.A192CBC_HS384().String(), jwa.A256CBC_HS512().String(),
+	jwa.A128GCM().String(), jwa.A192GCM().String(), jwa.A256GCM().String(),
+}
+
+// requestObjectJWTClaims are the claims of a request object that describe the JWT itself rather than the authorization request
+var requestObjectJWTClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "request", "request_uri"}
+
+// requestObjectOuterParameters are the parameters kept from outside of a request object, because they identify and
+// authenticate the client rather than describe the authorization request
+var requestObjectOuterParameters = []string{"client_id", "client_secret", "client_assertion", "client_assertion_type"}
+
+// requestObjectClientStore is the subset of the store the request object resolver needs.
+type requestObjectClientStore interface {
+	GetClient(ctx context.Context, id string) (fosite.Client, error)
+}
+
+// requestObjectKeySource loads the keys request objects are verified with
+type requestObjectKeySource interface {
+	clientJWKSet(ctx context.Context, credentials model.OidcClientCredentials) (jwk.Set, error)
+	federatedIdentityJWKSet(ctx context.Context, identity model.OidcClientFederatedIdentity) (jwk.Set, error)
+}
+
+// requestObjectResolver turns JWT-secured authorization requests (RFC 9101) into plain authorization request
+// parameters before they are handed to fosite, which only supports request objects of OpenID Connect clients
+type requestObjectResolver struct {
+	clients       requestObjectClientStore
+	keys          requestObjectKeySource
+	httpClient    *http.Client
+	issuer        string
+	decryptionKey jwk.Key
+	// isURLPrivate checks that a request_uri doesn't point to a private address; tests replace it, as it resolves the host
+	isURLPrivate func(ctx context.Context, u *url.URL) (bool, error)
+}
+
+func newRequestObjectResolver(clients requestObjectClientStore, keys requestObjectKeySource, httpClient *http.Client, issuer string, decryptionKey jwk.Key) *requestObjectResolver {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestObjectFetchTimeout}
+	}
+
+	// Request URIs are restricted to the hosts of the client, so redirects to other hosts must not be followed, and
+	// the client can only connect to public addresses
+	noRedirectClient := utils.PublicOnlyHTTPClient(httpClient)
+	noRedirectClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &requestObjectResolver{
+		clients:       clients,
+		keys:          keys,
+		httpClient:    noRedirectClient,
+		issuer:        issuer,
+		decryptionKey: decryptionKey,
+		isURLPrivate:  utils.IsURLPrivate,
+	}
+}
+
+// newRequestObjectDecryptionKey derives the P-256 key clients encrypt request objects with from the instance secret,
+// so it doesn't have to be stored and is the same on every instance
+func newRequestObjectDecryptionKey(secret string) (jwk.Key, error) {
+	seed, err := deriveSecret(secret, "pocketid/request_object_encryption_key")
+	if err != nil {
+		return nil, err
+	}
+
+	// The seed is a valid P-256 scalar unless it's zero or larger than the order of the curve, which is negligibly likely
+	rawKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create private key: %w", err)
+	}
+
+	key, err := jwk.Import(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import private key: %w", err)
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, fmt.Errorf("failed to assign key ID: %w", err)
+	}
+	_ = key.Set(jwk.KeyUsageKey, jwkutils.KeyUsageEncryption)
+
+	return key, nil
+}
+
+// resolve returns the authorization request parameters of the request object passed by value in "request", or by
+// reference in "request_uri", instead of the plain parameters of the form
+// Requests without a request object are returned as they are, unless the client requires signed request objects.
+// clientID is the client that sent the request, which for pushed authorization requests can also come from the
+// Authorization header. Pushed authorization requests can't reference a request object with "request_uri".
+func (r *requestObjectResolver) resolve(ctx context.Context, form url.Values, clientID string, pushed bool) (url.Values, error) {
+	requestObject := form.Get("request")
+	requestURI := form.Get("request_uri")
+	if strings.HasPrefix(requestURI, parRequestURIPrefix) {
+		// The request object of a pushed authorization request was already verified when it was pushed
+		return form, nil
+	}
+	if pushed && requestURI != "" {
+		return nil, fosite.ErrInvalidRequest.WithHint("Pushed authorization requests can't contain the 'request_uri' parameter.")
+	}
+	if requestObject != "" && requestURI != "" {
+		return nil, fosite.ErrInvalidRequest.WithHint("The 'request' and 'request_uri' parameters can't be used together.")
+	}
+
+	if clientID == "" {
+		if requestObject == "" && requestURI == "" {
+			// fosite reports the missing client ID
+			return form, nil
+		}
+		return nil, fosite.ErrInvalidRequest.WithHint("The 'client_id' parameter is required with a request object.")
+	}
+
+	client, err := r.clients.GetClient(ctx, clientID)
+	if err != nil {
+		if requestObject == "" && requestURI == "" {
+			return form, nil
+		}
+		return nil, fosite.ErrInvalidClient.WithWrap(err)
+	}
+	oidcClient := oidcClientOf(client)
+
+	switch {
+	case requestURI != "":
+		requestObject, err = r.fetch(ctx, requestURI, oidcClient)
+		if err != nil {
+			return nil, err
+		}
+	case requestObject == "":
+		if oidcClient.RequiresSignedRequestObject {
+			return nil, fosite.ErrInvalidRequest.WithHint("The client must send the authorization request as a signed request object.")
+		}
+		return form, nil
+	}
+
+	claims, err := r.verify(ctx, []byte(requestObject), oidcClient)
+	if err != nil {
+		return nil, err
+	}
+	return requestObjectForm(form, clientID, claims)
+}
+
+// fetch downloads the request object a request_uri references
+// The request_uri must be an https URL on the host of one of the callback URLs of the client. Clients can choose their
+// callback URLs with dynamic client registration, so that alone doesn't keep Pocket ID from sending requests to internal
+// hosts, which is why the request_uri must also point to a public address, when it's checked and when connecting.
+func (r *requestObjectResolver) fetch(ctx context.Context, requestURI string, client model.OidcClient) (string, error) {
+	parsed, err := url.Parse(requestURI)
+	if err != nil || parsed.Scheme != "https" || !slices.Contains(callbackURLHosts(client.CallbackURLs), parsed.Host) {
+		return "", fosite.ErrInvalidRequestURI.WithHint("The 'request_uri' must be an https URL on the host of one of the client's callback URLs.")
+	}
+
+	private, err := r.isURLPrivate(ctx, parsed)
+	if err != nil {
+		return "", fosite.ErrInvalidRequestURI.WithHint("Unable to resolve the host of the 'request_uri'.").WithWrap(err)
+	}
+	if private {
+		return "", fosite.ErrInvalidRequestURI.WithHint("The 'request_uri' must not point to a private IP address.")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestObjectFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return "", fosite.ErrInvalidRequestURI.WithWrap(err)
+	}
+	req.Header.Set("Accept", "application/oauth-authz-req+jwt")
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fosite.ErrInvalidRequestURI.WithHint("Unable to fetch the request object from the 'request_uri'.").WithWrap(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fosite.ErrInvalidRequestURI.WithHintf("Fetching the request object from the 'request_uri' failed with status %d.", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxRequestObjectSize+1))
+	if err != nil {
+		return "", fosite.ErrInvalidRequestURI.WithHint("Unable to fetch the request object from the 'request_uri'.").WithWrap(err)
+	}
+	if len(body) > maxRequestObjectSize {
+		return "", fosite.ErrInvalidRequestURI.WithHint("The request object is too large.")
+	}
+
+	return string(bytes.TrimSpace(body)), nil
+}
+
+// verify decrypts the request object if it's encrypted, checks its signature and returns its claims
+func (r *requestObjectResolver) verify(ctx context.Context, requestObject []byte, client model.OidcClient) (map[string]any, error) {
+	// A compact JWE has five parts, a compact JWS three
+	if bytes.Count(requestObject, []byte(".")) == 4 {
+		var err error
+		requestObject, err = r.decrypt(requestObject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msg, err := jws.Parse(requestObject)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object must be a signed JWT.").WithWrap(err)
+	}
+	// This also rejects unsigned request objects, which use the "none" algorithm
+	alg, ok := msg.Signatures()[0].ProtectedHeaders().Algorithm()
+	if !ok || !slices.Contains(RequestObjectSigningAlgorithms, alg.String()) {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object is signed with an unsupported algorithm.")
+	}
+
+	insecureToken, err := jwt.ParseInsecure(requestObject)
+	if err != nil {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object must be a signed JWT.").WithWrap(err)
+	}
+	issuer, _ := insecureToken.Issuer()
+
+	keys, subject, err := r.requestObjectKeys(ctx, client, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	parseOptions := []jwt.ParseOption{
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(30 * time.Second),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(r.issuer),
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)),
+	}
+	if subject != "" {
+		parseOptions = append(parseOptions, jwt.WithSubject(subject))
+	}
+	if _, err := jwt.Parse(requestObject, parseOptions...); err != nil {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object is invalid.").WithWrap(err)
+	}
+
+	// Decode the claims from the payload, so numbers are passed on as they were sent
+	decoder := json.NewDecoder(bytes.NewReader(msg.Payload()))
+	decoder.UseNumber()
+	var claims map[string]any
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object is invalid.").WithWrap(err)
+	}
+	return claims, nil
+}
+
+// decrypt returns the signed request object inside an encrypted request object
+func (r *requestObjectResolver) decrypt(requestObject []byte) ([]byte, error) {
+	msg, err := jwe.Parse(requestObject)
+	if err != nil {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The encrypted request object is malformed.").WithWrap(err)
+	}
+
+	alg, ok := msg.ProtectedHeaders().Algorithm()
+	if !ok || !slices.Contains(RequestObjectEncryptionAlgorithms, alg.String()) {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object is encrypted with an unsupported algorithm.")
+	}
+	enc, ok := msg.ProtectedHeaders().ContentEncryption()
+	if !ok || !slices.Contains(RequestObjectEncryptionEncodings, enc.String()) {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The request object is encrypted with an unsupported content encryption algorithm.")
+	}
+
+	plaintext, err := jwe.Decrypt(requestObject, jwe.WithKey(alg, r.decryptionKey))
+	if err != nil {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("Unable to decrypt the request object.").WithWrap(err)
+	}
+	return plaintext, nil
+}
+
+// requestObjectKeys returns the keys the request object must be signed with, and the subject it must have if any
+// Request objects issued by one of the federated identities of the client are verified with the keys of the federated
+// identity, and the ones issued by the client itself with its registered keys.
+func (r *requestObjectResolver) requestObjectKeys(ctx context.Context, client model.OidcClient, issuer string) (jwk.Set, string, error) {
+	if identity, ok := client.Credentials.FederatedIdentityForIssuer(issuer); ok {
+		keys, err := r.keys.federatedIdentityJWKSet(ctx, identity)
+		if err != nil {
+			return nil, "", fosite.ErrInvalidRequestObject.WithHint("Unable to fetch the keys of the federated identity.").WithWrap(err)
+		}
+
+		subject := identity.Subject
+		if subject == "" {
+			subject = client.ID
+		}
+		return keys, subject, nil
+	}
+
+	if issuer == client.ID && client.Credentials.HasKeys() {
+		keys, err := r.keys.clientJWKSet(ctx, client.Credentials)
+		if err != nil {
+			return nil, "", fosite.ErrInvalidRequestObject.WithHint("Unable to load the client's JWKS.").WithWrap(err)
+		}
+		return keys, "", nil
+	}
+
+	return nil, "", fosite.ErrInvalidRequestObject.WithHint("The request object must be issued by the client or one of its federated identities and signed with their keys.")
+}
+
+// requestObjectForm builds the authorization request parameters from the claims of a request object
+// Only the parameters in the request object are used, as required by RFC 9101 section 6.3, apart from the ones that
+// identify and authenticate the client.
+func requestObjectForm(outer url.Values, clientID string, claims map[string]any) (url.Values, error) {
+	if claimedClientID, ok := claims["client_id"]; ok && claimedClientID != clientID {
+		return nil, fosite.ErrInvalidRequestObject.WithHint("The 'client_id' of the request object doesn't match the client.")
+	}
+
+	form := make(url.Values, len(claims)+len(requestObjectOuterParameters))
+	for _, key := range requestObjectOuterParameters {
+		if values, ok := outer[key]; ok {
+			form[key] = values
+		}
+	}
+
+	for key, value := range claims {
+		if slices.Contains(requestObjectJWTClaims, key) {
+			continue
+		}
+
+		// Multiple resource indicators are passed as an array, as defined in RFC 8707 section 2
+		if resources, ok := value.([]any); ok && key == "resource" {
+			for _, resource := range resources {
+				resource, ok := resource.(string)
+				if !ok {
+					return nil, fosite.ErrInvalidRequestObject.WithHint("The 'resource' claim of the request object must contain strings.")
+				}
+				form.Add(key, resource)
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			form.Set(key, v)
+		case json.Number:
+			form.Set(key, v.String())
+		default:
+			// Structured parameters, such as "claims", are passed as JSON like in a plain request
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fosite.ErrInvalidRequestObject.WithWrap(err)
+			}
+			form.Set(key, string(encoded))
+		}
+	}
+	form.Set("client_id", clientID)
+
+	return form, nil
+}
+
+// callbackURLHosts returns the hosts of the callback URLs
+func callbackURLHosts(callbackURLs []string) []string {
+	hosts := make([]string, 0, len(callbackURLs))
+	for _, callbackURL := range callbackURLs {
+		parsed, err := url.Parse(callbackURL)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		hosts = append(hosts, parsed.Host)
+	}
+	return hosts
+}
+
+// replaceRequestForm replaces the parsed form of the request, which is what fosite reads the parameters from
+func replaceRequestForm(r *http.Request, form url.Values) {
+	r.Form = form
+	if r.Method == http.MethodPost {
+		r.PostForm = form
+	}
+}
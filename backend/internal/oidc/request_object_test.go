@@ -0,0 +1,305 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
+)
+
+func TestRequestObjectResolverResolve(t *testing.T) {
+	const (
+		issuer            = "https://pocket-id.example.com"
+		clientID          = "jar-client"
+		federatedIssuer   = "https://idp.example.com"
+		registeredRequest = "https://app.example.com/requests/1"
+	)
+
+	clientKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	clientPublicKey, err := clientKey.PublicKey()
+	require.NoError(t, err)
+	clientJWKS := jwk.NewSet()
+	require.NoError(t, clientJWKS.AddKey(clientPublicKey))
+	rawClientJWKS, err := json.Marshal(clientJWKS)
+	require.NoError(t, err)
+
+	federatedKey, err := jwkutils.GenerateKey(jwa.RS256().String(), "")
+	require.NoError(t, err)
+	federatedPublicKey, err := federatedKey.PublicKey()
+	require.NoError(t, err)
+	federatedJWKS := jwk.NewSet()
+	require.NoError(t, federatedJWKS.AddKey(federatedPublicKey))
+
+	decryptionKey, err := newRequestObjectDecryptionKey("test-secret")
+	require.NoError(t, err)
+	encryptionKey, err := decryptionKey.PublicKey()
+	require.NoError(t, err)
+
+	baseClient := model.OidcClient{
+		Base:         model.Base{ID: clientID},
+		CallbackURLs: model.UrlList{"https://app.example.com/callback"},
+		Credentials: model.OidcClientCredentials{
+			JWKS:                string(rawClientJWKS),
+			FederatedIdentities: []model.OidcClientFederatedIdentity{{Issuer: federatedIssuer}},
+		},
+	}
+
+	// requestURIBody is served to every request the resolver sends to fetch a request_uri
+	var requestURIBody string
+	newResolver := func(t *testing.T, client model.OidcClient) *requestObjectResolver {
+		t.Helper()
+		store := &fakeFederatedStore{client: Client{OidcClient: client}, jtis: map[string]time.Time{}}
+		authenticator, err := newFederatedClientAuthenticator(t.Context(), store, newJWKSetHTTPClient(t, federatedJWKS), issuer, issuer+"/api/oidc/token")
+		require.NoError(t, err)
+
+		httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(requestURIBody)),
+				Request:    req,
+			}, nil
+		})}
+		resolver := newRequestObjectResolver(store, authenticator, httpClient, issuer, decryptionKey)
+		resolver.isURLPrivate = func(_ context.Context, u *url.URL) (bool, error) {
+			return u.Hostname() == "private.example.com", nil
+		}
+		return resolver
+	}
+
+	signRequestObject := func(t *testing.T, key jwk.Key, mutate func(b *jwt.Builder) *jwt.Builder) string {
+		t.Helper()
+		builder := jwt.NewBuilder().
+			Issuer(clientID).
+			Audience([]string{issuer}).
+			IssuedAt(time.Now()).
+			Expiration(time.Now().Add(5*time.Minute)).
+			Claim("client_id", clientID).
+			Claim("response_type", "code").
+			Claim("scope", "openid profile").
+			Claim("redirect_uri", "https://app.example.com/callback").
+			Claim("state", "signed-state").
+			Claim("max_age", 300).
+			Claim("claims", map[string]any{"id_token": map[string]any{"email": nil}})
+		if mutate != nil {
+			builder = mutate(builder)
+		}
+		token, err := builder.Build()
+		require.NoError(t, err)
+
+		alg, ok := key.Algorithm()
+		require.True(t, ok)
+		signed, err := jwt.Sign(token, jwt.WithKey(alg, key))
+		require.NoError(t, err)
+		return string(signed)
+	}
+
+	outerForm := func(extra url.Values) url.Values {
+		form := url.Values{
+			"client_id":    {clientID},
+			"redirect_uri": {"https://attacker.example.com/callback"},
+			"state":        {"tampered-state"},
+		}
+		for key, values := range extra {
+			form[key] = values
+		}
+		return form
+	}
+
+	t.Run("plain request is returned unchanged", func(t *testing.T) {
+		form := outerForm(nil)
+		resolved, err := newResolver(t, baseClient).resolve(t.Context(), form, clientID, false)
+		require.NoError(t, err)
+		require.Equal(t, form, resolved)
+	})
+
+	t.Run("plain request is rejected when the client requires signed request objects", func(t *testing.T) {
+		client := baseClient
+		client.RequiresSignedRequestObject = true
+		_, err := newResolver(t, client).resolve(t.Context(), outerForm(nil), clientID, false)
+		requireRFC6749Error(t, err, fosite.ErrInvalidRequest.ErrorField)
+	})
+
+	t.Run("pushed authorization request URI is left to fosite", func(t *testing.T) {
+		client := baseClient
+		client.RequiresSignedRequestObject = true
+		form := url.Values{"client_id": {clientID}, "request_uri": {parRequestURIPrefix + "abc"}}
+		resolved, err := newResolver(t, client).resolve(t.Context(), form, clientID, false)
+		require.NoError(t, err)
+		require.Equal(t, form, resolved)
+	})
+
+	t.Run("parameters of a signed request object replace the plain parameters", func(t *testing.T) {
+		form := outerForm(url.Values{"request": {signRequestObject(t, clientKey, nil)}})
+		resolved, err := newResolver(t, baseClient).resolve(t.Context(), form, clientID, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, clientID, resolved.Get("client_id"))
+		assert.Equal(t, "https://app.example.com/callback", resolved.Get("redirect_uri"))
+		assert.Equal(t, "signed-state", resolved.Get("state"))
+		assert.Equal(t, "openid profile", resolved.Get("scope"))
+		assert.Equal(t, "300", resolved.Get("max_age"))
+		assert.JSONEq(t, `{"id_token":{"email":null}}`, resolved.Get("claims"))
+		for _, key := range []string{"request", "iss", "aud", "exp", "iat"} {
+			assert.NotContains(t, resolved, key)
+		}
+	})
+
+	t.Run("encrypted request object is decrypted", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(
+			[]byte(signRequestObject(t, clientKey, nil)),
+			jwe.WithKey(jwa.ECDH_ES_A256KW(), encryptionKey),
+			jwe.WithContentEncryption(jwa.A256GCM()),
+		)
+		require.NoError(t, err)
+
+		resolved, err := newResolver(t, baseClient).resolve(t.Context(), outerForm(url.Values{"request": {string(encrypted)}}), clientID, false)
+		require.NoError(t, err)
+		assert.Equal(t, "signed-state", resolved.Get("state"))
+	})
+
+	t.Run("request object issued by a federated identity is verified with its keys", func(t *testing.T) {
+		requestObject := signRequestObject(t, federatedKey, func(b *jwt.Builder) *jwt.Builder {
+			return b.Issuer(federatedIssuer).Subject(clientID)
+		})
+		resolved, err := newResolver(t, baseClient).resolve(t.Context(), outerForm(url.Values{"request": {requestObject}}), clientID, false)
+		require.NoError(t, err)
+		assert.Equal(t, "signed-state", resolved.Get("state"))
+	})
+
+	t.Run("request object fetched from a request_uri", func(t *testing.T) {
+		requestURIBody = signRequestObject(t, clientKey, nil)
+		resolved, err := newResolver(t, baseClient).resolve(t.Context(), outerForm(url.Values{"request_uri": {registeredRequest}}), clientID, false)
+		require.NoError(t, err)
+		assert.Equal(t, "signed-state", resolved.Get("state"))
+		assert.NotContains(t, resolved, "request_uri")
+	})
+
+	invalidRequests := []struct {
+		name    string
+		form    func(t *testing.T) url.Values
+		pushed  bool
+		wantErr *fosite.RFC6749Error
+	}{
+		{
+			name: "unsigned request object",
+			form: func(t *testing.T) url.Values {
+				token, err := jwt.NewBuilder().Issuer(clientID).Audience([]string{issuer}).Claim("state", "x").Build()
+				require.NoError(t, err)
+				unsigned, err := jwt.Sign(token, jwt.WithInsecureNoSignature())
+				require.NoError(t, err)
+				return outerForm(url.Values{"request": {string(unsigned)}})
+			},
+			wantErr: fosite.ErrInvalidRequestObject,
+		},
+		{
+			name: "request object for another audience",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request": {signRequestObject(t, clientKey, func(b *jwt.Builder) *jwt.Builder {
+					return b.Audience([]string{"https://other.example.com"})
+				})}})
+			},
+			wantErr: fosite.ErrInvalidRequestObject,
+		},
+		{
+			name: "request object signed with a key that isn't registered",
+			form: func(t *testing.T) url.Values {
+				otherKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+				require.NoError(t, err)
+				return outerForm(url.Values{"request": {signRequestObject(t, otherKey, nil)}})
+			},
+			wantErr: fosite.ErrInvalidRequestObject,
+		},
+		{
+			name: "request object for another client",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request": {signRequestObject(t, clientKey, func(b *jwt.Builder) *jwt.Builder {
+					return b.Claim("client_id", "other-client")
+				})}})
+			},
+			wantErr: fosite.ErrInvalidRequestObject,
+		},
+		{
+			name: "request and request_uri together",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request": {signRequestObject(t, clientKey, nil)}, "request_uri": {registeredRequest}})
+			},
+			wantErr: fosite.ErrInvalidRequest,
+		},
+		{
+			name: "request_uri on a host that isn't a callback host",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request_uri": {"https://internal.example.com/requests/1"}})
+			},
+			wantErr: fosite.ErrInvalidRequestURI,
+		},
+		{
+			name: "request_uri over plain http",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request_uri": {"http://app.example.com/requests/1"}})
+			},
+			wantErr: fosite.ErrInvalidRequestURI,
+		},
+		{
+			name: "request_uri in a pushed authorization request",
+			form: func(t *testing.T) url.Values {
+				return outerForm(url.Values{"request_uri": {registeredRequest}})
+			},
+			pushed:  true,
+			wantErr: fosite.ErrInvalidRequest,
+		},
+	}
+	for _, tt := range invalidRequests {
+		t.Run(tt.name+" is rejected", func(t *testing.T) {
+			requestURIBody = signRequestObject(t, clientKey, nil)
+			_, err := newResolver(t, baseClient).resolve(t.Context(), tt.form(t), clientID, tt.pushed)
+			requireRFC6749Error(t, err, tt.wantErr.ErrorField)
+		})
+	}
+
+	t.Run("request_uri on a callback host with a private address is rejected", func(t *testing.T) {
+		requestURIBody = signRequestObject(t, clientKey, nil)
+		client := baseClient
+		client.CallbackURLs = model.UrlList{"https://private.example.com/callback"}
+
+		form := outerForm(url.Values{"request_uri": {"https://private.example.com/requests/1"}})
+		_, err := newResolver(t, client).resolve(t.Context(), form, clientID, false)
+		requireRFC6749Error(t, err, fosite.ErrInvalidRequestURI.ErrorField)
+	})
+}
+
+func TestNewRequestObjectDecryptionKey(t *testing.T) {
+	key, err := newRequestObjectDecryptionKey("test-secret")
+	require.NoError(t, err)
+	sameKey, err := newRequestObjectDecryptionKey("test-secret")
+	require.NoError(t, err)
+	otherKey, err := newRequestObjectDecryptionKey("other-secret")
+	require.NoError(t, err)
+
+	kid, ok := key.KeyID()
+	require.True(t, ok)
+	sameKid, _ := sameKey.KeyID()
+	otherKid, _ := otherKey.KeyID()
+	require.Equal(t, kid, sameKid, "the key must be derived deterministically from the secret")
+	require.NotEqual(t, kid, otherKid)
+
+	usage, ok := key.KeyUsage()
+	require.True(t, ok)
+	require.Equal(t, jwkutils.KeyUsageEncryption, usage)
+}
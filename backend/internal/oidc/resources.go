@@ -0,0 +1,129 @@
+package oidc
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ory/fosite"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// clientAPIResources returns the API resources the client is allowed to request access tokens for
+func clientAPIResources(db *gorm.DB, clientID string) ([]model.OidcAPIResource, error) {
+	resources := []model.OidcAPIResource{}
+	err := db.
+		Joins("JOIN oidc_api_resources_allowed_clients ON oidc_api_resources_allowed_clients.oidc_api_resource_id = oidc_api_resources.id").
+		Where("oidc_api_resources_allowed_clients.oidc_client_id = ?", clientID).
+		Order("oidc_api_resources.identifier").
+		Find(&resources).
+		Error
+	return resources, err
+}
+
+// apiResourcesByIdentifier returns the API resources with the given identifiers
+func apiResourcesByIdentifier(db *gorm.DB, identifiers []string) ([]model.OidcAPIResource, error) {
+	resources := []model.OidcAPIResource{}
+	if len(identifiers) == 0 {
+		return resources, nil
+	}
+
+	err := db.
+		Where("identifier IN ?", identifiers).
+		Order("name").
+		Find(&resources).
+		Error
+	return resources, err
+}
+
+// requestedAPIResources resolves the resource indicators of a request (RFC 8707) to the API resources the client is
+// allowed to access. A resource that is malformed, unknown or not allowed for the client is rejected with invalid_target.
+func (c Client) requestedAPIResources(identifiers []string) ([]model.OidcAPIResource, error) {
+	resources := make([]model.OidcAPIResource, 0, len(identifiers))
+	for _, identifier := range fosite.RemoveEmpty(identifiers) {
+		// The identifier of the registered resources is an absolute URI without fragment, so malformed
+		// identifiers never match
+		index := slices.IndexFunc(c.APIResources, func(resource model.OidcAPIResource) bool {
+			return resource.Identifier == identifier
+		})
+		if index < 0 {
+			return nil, errInvalidTarget.WithHintf("The client is not allowed to request the resource '%s'.", identifier)
+		}
+		if !slices.ContainsFunc(resources, func(resource model.OidcAPIResource) bool { return resource.Identifier == identifier }) {
+			resources = append(resources, c.APIResources[index])
+		}
+	}
+
+	return resources, nil
+}
+
+// apiResourceIdentifiers returns the identifiers of the API resources
+func apiResourceIdentifiers(resources []model.OidcAPIResource) []string {
+	identifiers := make([]string, len(resources))
+	for i, resource := range resources {
+		identifiers[i] = resource.Identifier
+	}
+	return identifiers
+}
+
+// applyResourceIndicators restricts the audience of the issued access token to the API resources requested with
+// resource indicators (RFC 8707), or to the resources the user authorized if the request doesn't carry any.
+// Grants of a user can only target resources the user authorized, while grants without a user can target every resource
+// the client is allowed to access. Access tokens for API resources expire with the shortest lifetime configured for them.
+func applyResourceIndicators(accessRequest fosite.AccessRequester, session *Session, client Client) error {
+	request, ok := accessRequest.(*fosite.AccessRequest)
+	if !ok {
+		return fosite.ErrServerError.WithDebug("The access request must be *fosite.AccessRequest.")
+	}
+	grantTypes := request.GetGrantTypes()
+	clientGrant := grantTypes.ExactOne(string(fosite.GrantTypeClientCredentials)) || grantTypes.ExactOne(GrantTypeTokenExchange)
+
+	identifiers := fosite.RemoveEmpty(request.GetRequestForm()["resource"])
+	if len(identifiers) == 0 {
+		// Resources the client may no longer access are dropped, so the grant can still be refreshed
+		for _, identifier := range session.Resources {
+			if client.GetAudience().Has(identifier) {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+	}
+
+	resources, err := client.requestedAPIResources(identifiers)
+	if err != nil {
+		return err
+	}
+
+	// The audience of grants without a user was requested for this token and is kept, while the audience stored with
+	// the grant of a user is the one of the previously issued token
+	audience := fosite.Arguments{}
+	if clientGrant {
+		audience = append(audience, request.GrantedAudience...)
+	}
+	for _, resource := range resources {
+		if !clientGrant && !slices.Contains(session.Resources, resource.Identifier) {
+			return errInvalidTarget.WithHintf("The user didn't authorize the client to access the resource '%s'.", resource.Identifier)
+		}
+		if !audience.Has(resource.Identifier) {
+			audience = append(audience, resource.Identifier)
+		}
+	}
+	request.GrantedAudience = audience
+
+	// The audience may also target API resources through the audience parameter
+	granted := accessRequest.GetGrantedAudience()
+	lifespan := time.Duration(0)
+	for _, resource := range client.APIResources {
+		if resource.AccessTokenLifetime > 0 && granted.Has(resource.Identifier) {
+			resourceLifespan := time.Duration(resource.AccessTokenLifetime) * time.Second
+			if lifespan == 0 || resourceLifespan < lifespan {
+				lifespan = resourceLifespan
+			}
+		}
+	}
+	if expiresAt := time.Now().UTC().Add(lifespan); lifespan > 0 && expiresAt.Before(session.GetExpiresAt(fosite.AccessToken)) {
+		session.SetExpiresAt(fosite.AccessToken, expiresAt)
+	}
+
+	return nil
+}
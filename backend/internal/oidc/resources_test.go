@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestClientRequestedAPIResources(t *testing.T) {
+	client := Client{
+		OidcClient: model.OidcClient{Base: model.Base{ID: "client"}},
+		APIResources: []model.OidcAPIResource{
+			{Identifier: "https://api.example.com/orders", Scopes: datatype.StringList{"orders:read"}},
+			{Identifier: "urn:example:billing"},
+		},
+	}
+
+	resources, err := client.requestedAPIResources([]string{"urn:example:billing", "", "urn:example:billing"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"urn:example:billing"}, apiResourceIdentifiers(resources))
+
+	for _, identifier := range []string{"https://api.example.com/other", "https://api.example.com/orders#v1", "orders"} {
+		_, err := client.requestedAPIResources([]string{identifier})
+		require.ErrorIs(t, err, errInvalidTarget, identifier)
+	}
+
+	require.Equal(t, fosite.Arguments{"client", "https://api.example.com/orders", "urn:example:billing"}, client.GetAudience())
+	require.True(t, client.GetScopes().Has("orders:read"))
+}
+
+// TestTokenHandlerResourceIndicators checks that access tokens requested for an API resource are audience-restricted
+// to it and expire with its access token lifetime
+func TestTokenHandlerResourceIndicators(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		baseURL     = "https://issuer.example.com"
+		clientID    = "resource-client"
+		clientPlain = "resource-secret-value"
+		ordersAPI   = "https://api.example.com/orders"
+		billingAPI  = "urn:example:billing"
+	)
+
+	db := testutils.NewDatabaseForTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(clientPlain), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	client := model.OidcClient{Base: model.Base{ID: clientID}, Name: "Resource Client", Secret: string(hashed)}
+	require.NoError(t, db.Create(&client).Error)
+	require.NoError(t, db.Create(&model.OidcAPIResource{
+		Name:                "Orders API",
+		Identifier:          ordersAPI,
+		Scopes:              datatype.StringList{"orders:read"},
+		AccessTokenLifetime: 300,
+		AllowedClients:      []model.OidcClient{client},
+	}).Error)
+	require.NoError(t, db.Create(&model.OidcAPIResource{
+		Name:       "Billing API",
+		Identifier: billingAPI,
+		Scopes:     datatype.StringList{},
+	}).Error)
+
+	provider, err := newProvider(NewStore(db), nil, testTokenSigner{key: key}, Config{
+		BaseURL:      baseURL,
+		TokenBaseURL: baseURL,
+		Secret:       "test-secret",
+	})
+	require.NoError(t, err)
+	handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), nil, db)
+
+	token := func(t *testing.T, form url.Values) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/oidc/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientPlain)
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+		handler.token(c)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	t.Run("access token is restricted to the resource", func(t *testing.T) {
+		code, body := token(t, url.Values{
+			"grant_type": {"client_credentials"},
+			"scope":      {"orders:read"},
+			"resource":   {ordersAPI},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		require.Equal(t, "orders:read", body["scope"])
+		require.InDelta(t, (5 * time.Minute).Seconds(), body["expires_in"], 2)
+
+		claims := decodeJWTPart(t, body["access_token"].(string), 1)
+		require.Equal(t, []string{ordersAPI}, jwtAudience(claims))
+	})
+
+	t.Run("resource the client isn't allowed to access is rejected", func(t *testing.T) {
+		code, body := token(t, url.Values{
+			"grant_type": {"client_credentials"},
+			"resource":   {billingAPI},
+		})
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, errInvalidTarget.ErrorField, body["error"])
+	})
+
+	t.Run("tokens without resource keep the client audience", func(t *testing.T) {
+		code, body := token(t, url.Values{"grant_type": {"client_credentials"}})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+
+		claims := decodeJWTPart(t, body["access_token"].(string), 1)
+		require.Equal(t, []string{clientID}, jwtAudience(claims))
+	})
+}
+
+func TestAuthorizationServiceAuthorizeResourceIndicators(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newAuthorizationService(db, newInteractionSessionService(db), newClaimsService(db, nil, "", nil, SubjectResolver{}), nil, nil)
+
+	const (
+		userID    = "test-user"
+		clientID  = "test-client"
+		ordersAPI = "https://api.example.com/orders"
+	)
+
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}}).Error)
+	client := model.OidcClient{Base: model.Base{ID: clientID}, Name: "Test Client"}
+	require.NoError(t, db.Create(&client).Error)
+	ordersResource := model.OidcAPIResource{
+		Name:           "Orders API",
+		Identifier:     ordersAPI,
+		Scopes:         datatype.StringList{},
+		AllowedClients: []model.OidcClient{client},
+	}
+	require.NoError(t, db.Create(&ordersResource).Error)
+
+	// The user already authorized the client, but not the access to the API
+	require.NoError(t, db.Create(&model.UserAuthorizedOidcClient{
+		UserID:     userID,
+		ClientID:   clientID,
+		Scope:      datatype.StringList{"openid"},
+		Resources:  datatype.StringList{},
+		LastUsedAt: datatype.DateTime(time.Now()),
+	}).Error)
+
+	authorize := func(requestID string, interactionID string, resources ...string) (authorizationResult, error) {
+		requester := newTestAuthorizeRequesterWithForm(requestID, clientID, url.Values{"resource": resources})
+		requester.(*fosite.AuthorizeRequest).Client = Client{OidcClient: client, APIResources: []model.OidcAPIResource{ordersResource}}
+		return service.authorize(t.Context(), authorizeInput{
+			userID:             userID,
+			authenticationTime: time.Now().UTC(),
+			requester:          requester,
+			interactionID:      interactionID,
+		})
+	}
+
+	_, err := authorize("unknown-resource-request", "", "https://api.example.com/other")
+	require.ErrorIs(t, err, errInvalidTarget)
+
+	authorization, err := authorize("resource-request", "", ordersAPI)
+	require.NoError(t, err)
+	require.True(t, authorization.RequiresInteraction, "access to a new API resource requires consent")
+
+	interaction, err := service.getInteractionSession(t.Context(), authorization.InteractionID)
+	require.NoError(t, err)
+	require.Equal(t, []interactionStep{interactionStepConsent}, interaction.RequiredSteps)
+	require.Equal(t, []interactionResource{{Name: "Orders API", Identifier: ordersAPI}}, interaction.Resources)
+
+	query, err := service.interactionRequestQuery(t.Context(), authorization.InteractionID)
+	require.NoError(t, err)
+	require.Equal(t, []string{ordersAPI}, query["resource"])
+
+	_, err = service.completeInteractionStep(t.Context(), authorization.InteractionID, userID, interactionStepConsent, "", time.Now().UTC(), requestMeta{})
+	require.NoError(t, err)
+
+	authorization, err = authorize("resource-request", authorization.InteractionID, ordersAPI)
+	require.NoError(t, err)
+	require.False(t, authorization.RequiresInteraction)
+	require.Equal(t, []string{ordersAPI}, authorization.Session.Resources)
+
+	var authorizedClient model.UserAuthorizedOidcClient
+	require.NoError(t, db.First(&authorizedClient, "user_id = ? AND client_id = ?", userID, clientID).Error)
+	require.Equal(t, datatype.StringList{ordersAPI}, authorizedClient.Resources)
+}
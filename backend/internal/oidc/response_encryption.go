@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
+)
+
+// ResponseEncryptionAlgorithms are the key management algorithms ID tokens and userinfo responses can be encrypted with
+var ResponseEncryptionAlgorithms = []string{
+	jwa.RSA_OAEP().String(), jwa.RSA_OAEP_256().String(),
+	jwa.ECDH_ES().String(), jwa.ECDH_ES_A128KW().String(), jwa.ECDH_ES_A192KW().String(), jwa.ECDH_ES_A256KW().String(),
+}
+
+// ResponseEncryptionEncodings are the content encryption algorithms ID tokens and userinfo responses can be encrypted with
+var ResponseEncryptionEncodings = RequestObjectEncryptionEncodings
+
+// defaultResponseEncryptionEncoding is the content encryption algorithm used if a client only configured the key
+// management algorithm, as defined in OpenID Connect Dynamic Client Registration section 2
+var defaultResponseEncryptionEncoding = jwa.A128CBC_HS256()
+
+// contentTypeJWT is the content type of signed or encrypted userinfo responses
+const contentTypeJWT = "application/jwt"
+
+// responseKeySource loads the keys responses are encrypted with
+type responseKeySource interface {
+	clientJWKSet(ctx context.Context, credentials model.OidcClientCredentials) (jwk.Set, error)
+}
+
+// responseEncrypter signs and encrypts the ID tokens and userinfo responses of the clients that registered algorithms
+// for them, as defined in OpenID Connect Core sections 5.3.2 and 10.2
+type responseEncrypter struct {
+	keys   responseKeySource
+	signer TokenSigner
+	issuer string
+}
+
+func newResponseEncrypter(keys responseKeySource, signer TokenSigner, issuer string) *responseEncrypter {
+	return &responseEncrypter{
+		keys:   keys,
+		signer: signer,
+		issuer: issuer,
+	}
+}
+
+// encryptIDToken encrypts the signed ID token if the client configured an encryption algorithm for ID tokens,
+// otherwise it's returned unchanged
+func (e *responseEncrypter) encryptIDToken(ctx context.Context, client model.OidcClient, idToken string) (string, error) {
+	if client.IDTokenEncryptedResponseAlg == "" {
+		return idToken, nil
+	}
+
+	encrypted, err := e.encrypt(ctx, client, []byte(idToken), client.IDTokenEncryptedResponseAlg, client.IDTokenEncryptedResponseEnc, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt ID token: %w", err)
+	}
+	return encrypted, nil
+}
+
+// userInfoResponse returns the body and content type of the userinfo response, which is plain JSON unless the client
+// configured a signing or encryption algorithm for it
+func (e *responseEncrypter) userInfoResponse(ctx context.Context, client model.OidcClient, claims map[string]any) ([]byte, string, error) {
+	if client.UserinfoSignedResponseAlg == "" && client.UserinfoEncryptedResponseAlg == "" {
+		body, err := json.Marshal(claims)
+		if err != nil {
+			return nil, "", err
+		}
+		return body, "application/json; charset=utf-8", nil
+	}
+
+	var payload []byte
+	signed := client.UserinfoSignedResponseAlg != ""
+	if signed {
+		token, err := e.signUserInfo(client.ID, claims)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to sign userinfo response: %w", err)
+		}
+		payload = []byte(token)
+	} else {
+		var err error
+		payload, err = json.Marshal(claims)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if client.UserinfoEncryptedResponseAlg == "" {
+		return payload, contentTypeJWT, nil
+	}
+
+	encrypted, err := e.encrypt(ctx, client, payload, client.UserinfoEncryptedResponseAlg, client.UserinfoEncryptedResponseEnc, signed)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt userinfo response: %w", err)
+	}
+	return []byte(encrypted), contentTypeJWT, nil
+}
+
+// signUserInfo signs the userinfo claims with the active key, adding the "iss" and "aud" claims that signed userinfo
+// responses should contain
+func (e *responseEncrypter) signUserInfo(clientID string, claims map[string]any) (string, error) {
+	builder := jwt.NewBuilder().
+		Issuer(e.issuer).
+		Audience([]string{clientID}).
+		IssuedAt(time.Now())
+	for key, value := range claims {
+		builder = builder.Claim(key, value)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+	return signJWT(e.signer, token, "")
+}
+
+// encrypt encrypts the payload with a key of the client that supports the key management algorithm
+// If the payload is a signed JWT, the "cty" header marks the JWE as a nested JWT.
+func (e *responseEncrypter) encrypt(ctx context.Context, client model.OidcClient, payload []byte, algName string, encName string, nested bool) (string, error) {
+	alg, ok := jwa.LookupKeyEncryptionAlgorithm(algName)
+	if !ok {
+		return "", fmt.Errorf("unsupported key management algorithm '%s'", algName)
+	}
+
+	enc := defaultResponseEncryptionEncoding
+	if encName != "" {
+		enc, ok = jwa.LookupContentEncryptionAlgorithm(encName)
+		if !ok {
+			return "", fmt.Errorf("unsupported content encryption algorithm '%s'", encName)
+		}
+	}
+
+	keys, err := e.keys.clientJWKSet(ctx, client.Credentials)
+	if err != nil {
+		return "", fmt.Errorf("failed to load the keys of the client: %w", err)
+	}
+	key, err := responseEncryptionKey(keys, alg)
+	if err != nil {
+		return "", err
+	}
+
+	headers := jwe.NewHeaders()
+	if nested {
+		if err := headers.Set(jwe.ContentTypeKey, "JWT"); err != nil {
+			return "", err
+		}
+	}
+
+	encrypted, err := jwe.Encrypt(payload, jwe.WithKey(alg, key), jwe.WithContentEncryption(enc), jwe.WithProtectedHeaders(headers))
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+// responseEncryptionKey selects the first key of the client that can be used with the key management algorithm
+// Keys that are restricted to signatures or to another algorithm are skipped.
+func responseEncryptionKey(keys jwk.Set, alg jwa.KeyEncryptionAlgorithm) (jwk.Key, error) {
+	for i := range keys.Len() {
+		key, ok := keys.Key(i)
+		if !ok {
+			continue
+		}
+		if usage, ok := key.KeyUsage(); ok && usage != jwkutils.KeyUsageEncryption {
+			continue
+		}
+		if keyAlg, ok := key.Algorithm(); ok && keyAlg.String() != alg.String() {
+			continue
+		}
+		if !keyTypeSupportsAlgorithm(key.KeyType(), alg) {
+			continue
+		}
+		return key, nil
+	}
+
+	return nil, errors.New("the client has no key that can be used with " + alg.String())
+}
+
+// keyTypeSupportsAlgorithm reports whether keys of the type can be used with the key management algorithm
+func keyTypeSupportsAlgorithm(keyType jwa.KeyType, alg jwa.KeyEncryptionAlgorithm) bool {
+	switch alg.String() {
+	case jwa.RSA_OAEP().String(), jwa.RSA_OAEP_256().String():
+		return keyType == jwa.RSA()
+	default:
+		// ECDH-ES works with both EC and X25519 (OKP) keys
+		return keyType == jwa.EC() || keyType == jwa.OKP()
+	}
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	jwkutils "github.com/pocket-id/pocket-id/backend/internal/utils/jwk"
+)
+
+// staticClientKeys returns the inline JWKS of the client
+type staticClientKeys struct{}
+
+func (staticClientKeys) clientJWKSet(_ context.Context, credentials model.OidcClientCredentials) (jwk.Set, error) {
+	return jwk.ParseString(credentials.JWKS)
+}
+
+func TestResponseEncrypter(t *testing.T) {
+	const (
+		issuer   = "https://pocket-id.example.com"
+		clientID = "encrypted-client"
+	)
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := testTokenSigner{key: signingKey}
+	encrypter := newResponseEncrypter(staticClientKeys{}, signer, issuer)
+
+	// The client publishes a signing key, which must never be used for encryption, and an encryption key
+	clientSigningKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	clientEncryptionKey, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+	require.NoError(t, err)
+	require.NoError(t, clientEncryptionKey.Set(jwk.KeyUsageKey, jwkutils.KeyUsageEncryption))
+	require.NoError(t, clientEncryptionKey.Remove(jwk.AlgorithmKey))
+
+	clientJWKS := jwk.NewSet()
+	for _, key := range []jwk.Key{clientSigningKey, clientEncryptionKey} {
+		publicKey, err := key.PublicKey()
+		require.NoError(t, err)
+		require.NoError(t, clientJWKS.AddKey(publicKey))
+	}
+	rawClientJWKS, err := json.Marshal(clientJWKS)
+	require.NoError(t, err)
+
+	baseClient := model.OidcClient{
+		Base:        model.Base{ID: clientID},
+		Credentials: model.OidcClientCredentials{JWKS: string(rawClientJWKS)},
+	}
+
+	decrypt := func(t *testing.T, payload []byte) ([]byte, jwe.Headers) {
+		t.Helper()
+		message, err := jwe.Parse(payload)
+		require.NoError(t, err)
+		decrypted, err := jwe.Decrypt(payload, jwe.WithKey(jwa.ECDH_ES_A256KW(), clientEncryptionKey))
+		require.NoError(t, err)
+		return decrypted, message.ProtectedHeaders()
+	}
+
+	t.Run("ID token is unchanged without an encryption algorithm", func(t *testing.T) {
+		idToken, err := encrypter.encryptIDToken(t.Context(), baseClient, "signed.id.token")
+		require.NoError(t, err)
+		assert.Equal(t, "signed.id.token", idToken)
+	})
+
+	t.Run("ID token is encrypted with the encryption key of the client", func(t *testing.T) {
+		client := baseClient
+		client.IDTokenEncryptedResponseAlg = jwa.ECDH_ES_A256KW().String()
+
+		idToken, err := encrypter.encryptIDToken(t.Context(), client, "signed.id.token")
+		require.NoError(t, err)
+
+		decrypted, headers := decrypt(t, []byte(idToken))
+		assert.Equal(t, "signed.id.token", string(decrypted))
+
+		var contentType string
+		require.NoError(t, headers.Get(jwe.ContentTypeKey, &contentType))
+		assert.Equal(t, "JWT", contentType)
+		enc, ok := headers.ContentEncryption()
+		require.True(t, ok)
+		assert.Equal(t, jwa.A128CBC_HS256(), enc, "the content encryption must default to A128CBC-HS256")
+		kid, _ := headers.KeyID()
+		expectedKid, _ := clientEncryptionKey.KeyID()
+		assert.Equal(t, expectedKid, kid)
+	})
+
+	t.Run("encryption fails without a suitable key", func(t *testing.T) {
+		client := baseClient
+		client.IDTokenEncryptedResponseAlg = jwa.RSA_OAEP_256().String()
+
+		_, err := encrypter.encryptIDToken(t.Context(), client, "signed.id.token")
+		require.Error(t, err)
+	})
+
+	claims := map[string]any{"sub": "user-1", "email": "tim@example.com"}
+
+	t.Run("userinfo is plain JSON by default", func(t *testing.T) {
+		body, contentType, err := encrypter.userInfoResponse(t.Context(), baseClient, claims)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json; charset=utf-8", contentType)
+		assert.JSONEq(t, `{"sub":"user-1","email":"tim@example.com"}`, string(body))
+	})
+
+	parseSigned := func(t *testing.T, body []byte) jwt.Token {
+		t.Helper()
+		publicKeys, err := signer.GetPublicKeySet()
+		require.NoError(t, err)
+		token, err := jwt.Parse(body, jwt.WithKeySet(publicKeys), jwt.WithValidate(true), jwt.WithIssuer(issuer), jwt.WithAudience(clientID))
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("userinfo is signed", func(t *testing.T) {
+		client := baseClient
+		client.UserinfoSignedResponseAlg = jwa.RS256().String()
+
+		body, contentType, err := encrypter.userInfoResponse(t.Context(), client, claims)
+		require.NoError(t, err)
+		assert.Equal(t, contentTypeJWT, contentType)
+
+		token := parseSigned(t, body)
+		subject, _ := token.Subject()
+		assert.Equal(t, "user-1", subject)
+	})
+
+	t.Run("userinfo is encrypted without being signed", func(t *testing.T) {
+		client := baseClient
+		client.UserinfoEncryptedResponseAlg = jwa.ECDH_ES_A256KW().String()
+		client.UserinfoEncryptedResponseEnc = jwa.A256GCM().String()
+
+		body, contentType, err := encrypter.userInfoResponse(t.Context(), client, claims)
+		require.NoError(t, err)
+		assert.Equal(t, contentTypeJWT, contentType)
+
+		decrypted, headers := decrypt(t, body)
+		assert.JSONEq(t, `{"sub":"user-1","email":"tim@example.com"}`, string(decrypted))
+		assert.False(t, headers.Has(jwe.ContentTypeKey))
+		enc, _ := headers.ContentEncryption()
+		assert.Equal(t, jwa.A256GCM(), enc)
+	})
+
+	t.Run("userinfo is signed and then encrypted", func(t *testing.T) {
+		client := baseClient
+		client.UserinfoSignedResponseAlg = jwa.RS256().String()
+		client.UserinfoEncryptedResponseAlg = jwa.ECDH_ES_A256KW().String()
+
+		body, contentType, err := encrypter.userInfoResponse(t.Context(), client, claims)
+		require.NoError(t, err)
+		assert.Equal(t, contentTypeJWT, contentType)
+
+		decrypted, _ := decrypt(t, body)
+		token := parseSigned(t, decrypted)
+		var email string
+		require.NoError(t, token.Get("email", &email))
+		assert.Equal(t, "tim@example.com", email)
+	})
+}
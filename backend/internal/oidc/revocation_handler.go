@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/fosite"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+type revocationHandler struct {
+	provider      *oidcProvider
+	authenticator *federatedClientAuthenticator
+	auditLog      AuditLogger
+	db            *gorm.DB
+}
+
+func newRevocationHandler(provider *oidcProvider, authenticator *federatedClientAuthenticator, auditLog AuditLogger, db *gorm.DB) *revocationHandler {
+	return &revocationHandler{
+		provider:      provider,
+		authenticator: authenticator,
+		auditLog:      auditLog,
+		db:            db,
+	}
+}
+
+// revokeToken godoc
+// @Summary Revoke OAuth2 tokens
+// @Description Revoke an access or refresh token as defined in RFC 7009. Revoking a refresh token also revokes the access tokens issued with it.
+// @Tags OIDC
+// @Produce json
+// @Param token formData string true "The token to be revoked."
+// @Param token_type_hint formData string false "A hint about the type of the token (access_token or refresh_token)."
+// @Success 200 "Token revoked or unknown"
+// @Router /api/oidc/revoke [post]
+func (h *revocationHandler) revokeToken(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if h.tryFederatedClientAssertionRevocation(c) {
+		return
+	}
+
+	// Resolve the token before revoking it, as it can't be looked up anymore afterwards
+	owner := h.lookupTokenOwner(ctx, c.PostForm("token"), c.PostForm("token_type_hint"))
+
+	err := h.provider.NewRevocationRequest(ctx, c.Request)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to revoke token", "error", err)
+		h.provider.WriteRevocationResponse(ctx, c.Writer, err)
+		return
+	}
+
+	h.createAuditLog(c, owner)
+	h.provider.WriteRevocationResponse(ctx, c.Writer, nil)
+}
+
+// tryFederatedClientAssertionRevocation handles revocation requests authenticated
+// with a federated client assertion passed as bearer token instead of client credentials.
+func (h *revocationHandler) tryFederatedClientAssertionRevocation(c *gin.Context) bool {
+	ctx := c.Request.Context()
+	assertion := fosite.AccessTokenFromRequest(c.Request)
+	clientID := c.PostForm("client_id")
+	if assertion == "" || clientID == "" || h.authenticator == nil {
+		return false
+	}
+
+	client, err := h.authenticator.authenticateAssertion(ctx, assertion, clientID)
+	if err != nil {
+		h.provider.WriteRevocationResponse(ctx, c.Writer, fosite.ErrInvalidClient.WithWrap(err))
+		return true
+	}
+
+	token := c.PostForm("token")
+	tokenTypeHint := c.PostForm("token_type_hint")
+	if token == "" {
+		h.provider.WriteRevocationResponse(ctx, c.Writer, fosite.ErrInvalidRequest.WithHint("The 'token' parameter is missing."))
+		return true
+	}
+
+	owner := h.lookupTokenOwner(ctx, token, tokenTypeHint)
+
+	// Run the same revocation handlers fosite uses for requests authenticated with client credentials
+	found := false
+	for _, handler := range h.provider.config.GetRevocationHandlers(ctx) {
+		err := handler.RevokeToken(ctx, token, fosite.TokenType(tokenTypeHint), client)
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, fosite.ErrUnknownRequest):
+			// This handler doesn't know the token, try the next one
+		default:
+			slog.WarnContext(ctx, "Failed to revoke token", "error", err)
+			h.provider.WriteRevocationResponse(ctx, c.Writer, err)
+			return true
+		}
+	}
+	if !found {
+		h.provider.WriteRevocationResponse(ctx, c.Writer, fosite.ErrInvalidRequest)
+		return true
+	}
+
+	h.createAuditLog(c, owner)
+	h.provider.WriteRevocationResponse(ctx, c.Writer, nil)
+	return true
+}
+
+// lookupTokenOwner returns the requester the token was issued for, or nil if the token is unknown or no longer active
+func (h *revocationHandler) lookupTokenOwner(ctx context.Context, token, tokenTypeHint string) fosite.Requester {
+	if token == "" {
+		return nil
+	}
+
+	_, requester, err := h.provider.IntrospectToken(ctx, token, fosite.TokenUse(tokenTypeHint), NewEmptySession())
+	if err != nil {
+		return nil
+	}
+	return requester
+}
+
+func (h *revocationHandler) createAuditLog(c *gin.Context, owner fosite.Requester) {
+	if h.auditLog == nil || owner == nil || owner.GetSession() == nil {
+		return
+	}
+
+	client, ok := owner.GetClient().(Client)
+	if !ok {
+		return
+	}
+
+	// Tokens issued with the client credentials grant don't belong to a user
+	subject := owner.GetSession().GetSubject()
+	if subject == "" || subject == clientCredentialsSubject(client.ID) {
+		return
+	}
+
+	meta := requestMetaFromGin(c)
+	h.auditLog.Create(c.Request.Context(), model.AuditLogEventTokenRevocation, meta.IPAddress, meta.UserAgent, subject, model.AuditLogData{"clientName": client.Name}, h.db)
+}
@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestRevocationHandlerRevokesOwnTokensOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := testutils.NewDatabaseForTest(t)
+	require.NoError(t, db.Create(&model.OidcClient{Base: model.Base{ID: "client-a"}, Name: "Client A", IsPublic: true}).Error)
+	require.NoError(t, db.Create(&model.OidcClient{Base: model.Base{ID: "client-b"}, Name: "Client B", IsPublic: true}).Error)
+
+	signerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	provider, err := newProvider(NewStore(db), nil, testTokenSigner{key: signerKey}, Config{ //nolint:gosec // static test-only provider secret
+		BaseURL:      "https://issuer.example.com",
+		TokenBaseURL: "https://issuer.example.com",
+		Secret:       "test-secret",
+	})
+	require.NoError(t, err)
+
+	issueAccessToken := func(t *testing.T, requestID, clientID, subject string) string {
+		t.Helper()
+		session := NewEmptySession()
+		session.Subject = subject
+		session.SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(time.Hour))
+
+		request := fosite.NewAccessRequest(session)
+		request.ID = requestID
+		request.Client = Client{OidcClient: model.OidcClient{Base: model.Base{ID: clientID}}}
+		request.GrantTypes = fosite.Arguments{string(fosite.GrantTypeAuthorizationCode)}
+		request.RequestedScope = fosite.Arguments{"openid"}
+		request.GrantedScope = fosite.Arguments{"openid"}
+		request.RequestedAudience = fosite.Arguments{clientID}
+		request.GrantedAudience = fosite.Arguments{clientID}
+
+		response, err := provider.NewAccessResponse(t.Context(), request)
+		require.NoError(t, err)
+		return response.GetAccessToken()
+	}
+
+	isActive := func(t *testing.T, token string) bool {
+		t.Helper()
+		_, _, err := provider.IntrospectToken(t.Context(), token, fosite.AccessToken, NewEmptySession())
+		return err == nil
+	}
+
+	auditLogger := &fakeAuditLogger{}
+	handler := newRevocationHandler(provider, nil, auditLogger, db)
+
+	revoke := func(t *testing.T, clientID, token string) int {
+		t.Helper()
+		body := url.Values{"token": {token}, "client_id": {clientID}}.Encode()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/oidc/revoke", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+
+		handler.revokeToken(c)
+		return rec.Code
+	}
+
+	clientAToken := issueAccessToken(t, "req-a", "client-a", "user-a")
+
+	// Another client must not be able to revoke the token
+	require.NotEqual(t, http.StatusOK, revoke(t, "client-b", clientAToken))
+	require.True(t, isActive(t, clientAToken))
+	require.Empty(t, auditLogger.events)
+
+	// The owning client can revoke its token
+	require.Equal(t, http.StatusOK, revoke(t, "client-a", clientAToken))
+	require.False(t, isActive(t, clientAToken))
+	require.Equal(t, []model.AuditLogEvent{model.AuditLogEventTokenRevocation}, auditLogger.events)
+	require.Equal(t, model.AuditLogData{"clientName": "Client A"}, auditLogger.data[0])
+
+	// Revoking an already revoked token succeeds as required by RFC 7009, without another audit log entry
+	require.Equal(t, http.StatusOK, revoke(t, "client-a", clientAToken))
+	require.Len(t, auditLogger.events, 1)
+}
@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// clientRegisteredScopes returns the names of the admin-defined scopes the client is allowed to request
+func clientRegisteredScopes(db *gorm.DB, clientID string) ([]string, error) {
+	var names []string
+	err := db.
+		Model(&model.OidcScope{}).
+		Joins("JOIN oidc_scopes_allowed_clients ON oidc_scopes_allowed_clients.oidc_scope_id = oidc_scopes.id").
+		Where("oidc_scopes_allowed_clients.oidc_client_id = ?", clientID).
+		Order("oidc_scopes.name").
+		Pluck("oidc_scopes.name", &names).
+		Error
+	return names, err
+}
+
+// registeredScopesByName returns the admin-defined scopes among the given scopes
+func registeredScopesByName(db *gorm.DB, names []string) ([]model.OidcScope, error) {
+	scopes := []model.OidcScope{}
+	if len(names) == 0 {
+		return scopes, nil
+	}
+
+	err := db.
+		Where("name IN ?", names).
+		Order("name").
+		Find(&scopes).
+		Error
+	return scopes, err
+}
@@ -22,6 +22,23 @@ type Session struct {
 	ExpiresAt            map[fosite.TokenType]time.Time `json:"expires_at,omitempty"`
 	Subject              string                         `json:"subject"`
 	AuthenticationMethod string                         `json:"authentication_method,omitempty"`
+	// SessionID is released as "sid" claim in ID tokens and logout tokens, so clients can match a back-channel logout to their session
+	SessionID string `json:"sid,omitempty"`
+	// UserSessionID is the ID of the browser session with Pocket ID the user authorized the client in, so signing out of
+	// it revokes the grant. It's empty for grants approved for another device and grants issued before it was recorded.
+	UserSessionID string `json:"user_session_id,omitempty"`
+	// GrantExpiresAt is the time the refresh tokens issued for the session expire at the latest, for clients with
+	// absolute refresh token expiry
+	GrantExpiresAt time.Time `json:"grant_expires_at,omitzero"`
+	// DPoPJKT is the JWK thumbprint of the key the tokens are bound to with DPoP
+	DPoPJKT string `json:"dpop_jkt,omitempty"`
+	// CertificateThumbprint is the SHA-256 thumbprint of the client certificate the tokens are bound to with mutual TLS
+	CertificateThumbprint string `json:"x5t_s256,omitempty"`
+	// Resources are the identifiers of the API resources the user authorized the client to access with resource
+	// indicators (RFC 8707); access tokens of the grant can target any of them
+	Resources []string `json:"resources,omitempty"`
+	// Actor is the "act" claim of tokens issued with the token exchange grant on behalf of the subject
+	Actor map[string]any `json:"act,omitempty"`
 }
 
 func NewEmptySession() *Session {
@@ -45,6 +62,7 @@ func NewAuthenticatedSession(subject, authenticationMethod string, authenticatio
 	session := NewEmptySession()
 	session.Subject = subject
 	session.AuthenticationMethod = authenticationMethod
+	session.SessionID = uuid.NewString()
 	session.Claims.Subject = subject
 	session.Claims.AuthTime = authenticationTime.UTC()
 	session.Claims.RequestedAt = requestedAt.UTC()
@@ -72,13 +90,89 @@ func (s *Session) GetUsername() string {
 }
 
 func (s *Session) GetExtraClaims() map[string]interface{} {
-	if s == nil || s.Claims == nil || s.Claims.Issuer == "" {
-		return map[string]interface{}{}
+	claims := map[string]interface{}{}
+	if s == nil {
+		return claims
+	}
+
+	if s.Claims != nil && s.Claims.Issuer != "" {
+		claims["iss"] = s.Claims.Issuer
+	}
+	if cnf := s.confirmation(); cnf != nil {
+		claims["cnf"] = cnf
+	}
+	if s.Actor != nil {
+		claims["act"] = s.Actor
+	}
+	return claims
+}
+
+// BindDPoPKey binds the tokens issued for the session to the key with the given JWK thumbprint, or removes the binding if jkt is empty
+func (s *Session) BindDPoPKey(jkt string) {
+	s.DPoPJKT = jkt
+	s.setConfirmationClaim()
+}
+
+// BindCertificate binds the tokens issued for the session to the client certificate with the given thumbprint, or
+// removes the binding if thumbprint is empty
+func (s *Session) BindCertificate(thumbprint string) {
+	s.CertificateThumbprint = thumbprint
+	s.setConfirmationClaim()
+}
+
+// confirmation returns the "cnf" claim with the proof-of-possession keys the tokens are bound to, or nil if they
+// aren't bound
+func (s *Session) confirmation() map[string]interface{} {
+	cnf := map[string]interface{}{}
+	if s.DPoPJKT != "" {
+		cnf["jkt"] = s.DPoPJKT
+	}
+	if s.CertificateThumbprint != "" {
+		cnf["x5t#S256"] = s.CertificateThumbprint
 	}
+	if len(cnf) == 0 {
+		return nil
+	}
+	return cnf
+}
+
+// setConfirmationClaim updates the "cnf" claim of the access token to the keys the tokens are bound to
+func (s *Session) setConfirmationClaim() {
+	// GetJWTClaims initializes the claims of the access token
+	s.GetJWTClaims()
+	cnf := s.confirmation()
+	if cnf == nil {
+		delete(s.JWTClaims.Extra, "cnf")
+		return
+	}
+	s.JWTClaims.Extra["cnf"] = cnf
+}
+
+// SetActor sets the actor that acts on behalf of the subject of the tokens issued for the session, or removes it if actor is nil
+func (s *Session) SetActor(actor map[string]any) {
+	s.Actor = actor
 
-	return map[string]interface{}{
-		"iss": s.Claims.Issuer,
+	s.GetJWTClaims()
+	if actor == nil {
+		delete(s.JWTClaims.Extra, "act")
+		return
 	}
+	s.JWTClaims.Extra["act"] = actor
+}
+
+// SetClientSubject sets the subject identifier of the access tokens issued for the session, which differs from the
+// user ID for clients with pairwise subjects. The user ID stays the subject of the session.
+func (s *Session) SetClientSubject(subject string) {
+	s.GetJWTClaims()
+	s.JWTClaims.Subject = subject
+}
+
+// ClientSubject returns the subject identifier that was released to the client in the access tokens issued for the session
+func (s *Session) ClientSubject() string {
+	if s.JWTClaims != nil && s.JWTClaims.Subject != "" {
+		return s.JWTClaims.Subject
+	}
+	return s.GetSubject()
 }
 
 func (s *Session) GetSubject() string {
@@ -3,8 +3,13 @@ package oidc
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	jose "github.com/go-jose/go-jose/v4"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
 	fositejwt "github.com/ory/fosite/token/jwt"
 )
 
@@ -15,35 +20,58 @@ import (
 // *rsa.PrivateKey is signed with RS256 and every *ecdsa.PrivateKey with ES256, while an
 // ed25519.PrivateKey is not supported at all.
 func SigningKeyFromSigner(signer TokenSigner) (*jose.JSONWebKey, error) {
-	rawKey := signer.GetPrivateKey()
-	if rawKey == nil {
-		return nil, errors.New("signing key is not available")
-	}
-
-	alg, err := signer.GetKeyAlg()
+	rawKey, keyID, alg, err := signer.GetSigningKey()
 	if err != nil {
 		return nil, err
 	}
+	if rawKey == nil {
+		return nil, errors.New("signing key is not available")
+	}
 
-	signingKey := &jose.JSONWebKey{
+	return &jose.JSONWebKey{
 		Key:       rawKey,
+		KeyID:     keyID,
 		Algorithm: alg.String(),
+	}, nil
+}
+
+// signJWT signs the token with the active key of the signer, setting the "typ" header if tokenType isn't empty
+func signJWT(signer TokenSigner, token jwt.Token, tokenType string) (string, error) {
+	rawKey, keyID, alg, err := signer.GetSigningKey()
+	if err != nil {
+		return "", err
 	}
 
-	if keyID, ok := signer.GetKeyID(); ok {
-		signingKey.KeyID = keyID
+	headers := jws.NewHeaders()
+	if tokenType != "" {
+		if err := headers.Set(jws.TypeKey, tokenType); err != nil {
+			return "", err
+		}
+	}
+	if keyID != "" {
+		if err := headers.Set(jws.KeyIDKey, keyID); err != nil {
+			return "", err
+		}
 	}
 
-	return signingKey, nil
+	signed, err := jwt.Sign(token, jwt.WithKey(alg, rawKey, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
 }
 
 type jwtSigner struct {
 	*fositejwt.DefaultSigner
+
+	// getPublicKeys returns the published keys, so tokens signed with a next or retired key can be verified too
+	getPublicKeys func() (jwk.Set, error)
 }
 
-func newJWTSigner(keyGetter fositejwt.GetPrivateKeyFunc) *jwtSigner {
+func newJWTSigner(keyGetter fositejwt.GetPrivateKeyFunc, publicKeysGetter func() (jwk.Set, error)) *jwtSigner {
 	return &jwtSigner{
 		DefaultSigner: &fositejwt.DefaultSigner{GetPrivateKey: keyGetter},
+		getPublicKeys: publicKeysGetter,
 	}
 }
 
@@ -65,7 +93,38 @@ func (s *jwtSigner) Decode(ctx context.Context, token string) (*fositejwt.Token,
 		verificationKey = new(jsonWebKey.Public())
 	}
 
-	return fositejwt.Parse(token, func(*fositejwt.Token) (any, error) {
-		return verificationKey, nil
+	return fositejwt.Parse(token, func(t *fositejwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" || s.getPublicKeys == nil {
+			return verificationKey, nil
+		}
+
+		publicKeys, err := s.getPublicKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, ok := publicKeys.LookupKeyID(kid)
+		if !ok {
+			// The key is unknown: verifying with the current key fails like any other invalid signature
+			return verificationKey, nil
+		}
+
+		var rawKey any
+		err = jwk.Export(publicKey, &rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export public key '%s': %w", kid, err)
+		}
+		return rawKey, nil
 	})
 }
+
+// asymmetricSigningAlgorithms returns the asymmetric JWS algorithms that are accepted for JWTs signed by clients
+func asymmetricSigningAlgorithms() []string {
+	return []string{
+		jwa.RS256().String(), jwa.RS384().String(), jwa.RS512().String(),
+		jwa.PS256().String(), jwa.PS384().String(), jwa.PS512().String(),
+		jwa.ES256().String(), jwa.ES384().String(), jwa.ES512().String(),
+		jwa.EdDSA().String(),
+	}
+}
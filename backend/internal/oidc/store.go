@@ -28,6 +28,8 @@ const (
 	sessionKindPAR           = "par"
 	sessionKindDeviceCode    = "device_code"
 	sessionKindUserCode      = "user_code"
+
+	sessionKindBackchannelAuthentication = "backchannel_authentication"
 )
 
 var (
@@ -89,7 +91,17 @@ func (s *Store) GetClient(ctx context.Context, id string) (fosite.Client, error)
 		return nil, err
 	}
 
-	return Client{OidcClient: client}, nil
+	registeredScopes, err := clientRegisteredScopes(s.dbFor(ctx), client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	apiResources, err := clientAPIResources(s.dbFor(ctx), client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return Client{OidcClient: client, RegisteredScopes: registeredScopes, APIResources: apiResources}, nil
 }
 
 func (s *Store) ClientAssertionJWTValid(ctx context.Context, jti string) error {
@@ -122,6 +134,11 @@ func (s *Store) SetClientAssertionJWT(ctx context.Context, jti string, exp time.
 // Satisfies fositeoauth2.CoreStorage
 
 func (s *Store) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) error {
+	// fosite always applies the global authorization code lifetime, so the lifetime of the client is applied here
+	if lifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypeAuthorizationCode, fosite.AuthorizeCode, 0); lifespan > 0 {
+		request.GetSession().SetExpiresAt(fosite.AuthorizeCode, time.Now().UTC().Add(lifespan).Round(time.Second))
+	}
+
 	return s.upsertSession(ctx, sessionKindAuthorizeCode, code, request, "", true, fosite.AuthorizeCode)
 }
 
@@ -154,9 +171,34 @@ func (s *Store) DeleteAccessTokenSession(ctx context.Context, signature string)
 }
 
 func (s *Store) CreateRefreshTokenSession(ctx context.Context, signature string, accessSignature string, request fosite.Requester) error {
+	applyAbsoluteRefreshTokenExpiry(request)
 	return s.upsertSession(ctx, sessionKindRefreshToken, signature, request, accessSignature, true, fosite.RefreshToken)
 }
 
+// applyAbsoluteRefreshTokenExpiry limits the expiry of a refresh token to the expiry of the grant, if the client uses
+// absolute refresh token expiry. fosite issues every refresh token with the full lifetime, which makes the expiry sliding.
+func applyAbsoluteRefreshTokenExpiry(request fosite.Requester) {
+	session, ok := request.GetSession().(*Session)
+	if !ok || session == nil {
+		return
+	}
+
+	lifetimes := oidcClientOf(request.GetClient()).TokenLifetimes
+	if lifetimes.RefreshTokenExpiry != model.OidcRefreshTokenExpiryAbsolute {
+		return
+	}
+
+	// The session is carried over to the refresh tokens issued on refresh, so the expiry of the grant is only set once
+	if session.GrantExpiresAt.IsZero() {
+		lifespan := refreshTokenLifespan(lifetimes, defaultRefreshTokenLifespan)
+		session.GrantExpiresAt = time.Now().UTC().Add(lifespan).Round(time.Second)
+	}
+
+	if exp := session.GetExpiresAt(fosite.RefreshToken); exp.IsZero() || exp.After(session.GrantExpiresAt) {
+		session.SetExpiresAt(fosite.RefreshToken, session.GrantExpiresAt)
+	}
+}
+
 func (s *Store) GetRefreshTokenSession(ctx context.Context, signature string, _ fosite.Session) (fosite.Requester, error) {
 	request, active, err := s.getRequesterSession(ctx, sessionKindRefreshToken, signature)
 	if err != nil {
@@ -214,6 +256,62 @@ func RevokeUserClientSessions(ctx context.Context, db *gorm.DB, userID, clientID
 	return s.revokeRequestIDs(ctx, requestIDs)
 }
 
+// RevokeUserSessions revokes the sessions of the user with every client
+func RevokeUserSessions(ctx context.Context, db *gorm.DB, userID string) error {
+	return RevokeUserClientSessions(ctx, db, userID, "")
+}
+
+// RevokeUserSessionGrants revokes the sessions of the user with clients that were authorized in the browser session
+// with the given ID
+func RevokeUserSessionGrants(ctx context.Context, db *gorm.DB, userID, userSessionID string) error {
+	s := NewStore(db)
+	requestIDs, _, err := s.findUserSessionGrants(ctx, userID, userSessionID)
+	if err != nil {
+		return err
+	}
+	return s.revokeRequestIDs(ctx, requestIDs)
+}
+
+// findUserSessionGrants returns the request IDs and the logout targets of the sessions of the user with clients that
+// were authorized in the browser session with the given ID
+func (s *Store) findUserSessionGrants(ctx context.Context, userID, userSessionID string) (requestIDs []string, targets []logoutTarget, err error) {
+	if userSessionID == "" {
+		return nil, nil, nil
+	}
+
+	var sessions []OAuth2Session
+	err = s.dbFor(ctx).
+		Where("(kind = ? AND active = ?) OR kind = ?", sessionKindRefreshToken, true, sessionKindAccessToken).
+		Find(&sessions).
+		Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matchingRequestIDs := map[string]struct{}{}
+	seen := map[logoutTarget]struct{}{}
+	for _, session := range sessions {
+		requester, err := s.decodeRequester(ctx, session.RequestData)
+		if err != nil {
+			return nil, nil, err
+		}
+		requestSession, ok := requester.GetSession().(*Session)
+		if !ok || requestSession.GetSubject() != userID || requestSession.UserSessionID != userSessionID {
+			continue
+		}
+
+		matchingRequestIDs[session.RequestID] = struct{}{}
+		target := logoutTarget{clientID: requester.GetClient().GetID(), userID: userID, sessionID: requestSession.SessionID}
+		if _, ok := seen[target]; !ok {
+			seen[target] = struct{}{}
+			targets = append(targets, target)
+		}
+	}
+
+	return mapKeys(matchingRequestIDs), targets, nil
+}
+
+// findUserClientRequestIDs returns the request IDs of the sessions of the user with the client, or with every client if clientID is empty
 func (s *Store) findUserClientRequestIDs(ctx context.Context, userID, clientID, idTokenJTI string) (candidates []string, jtiMatches []string, err error) {
 	var sessions []OAuth2Session
 	err = s.dbFor(ctx).
@@ -232,7 +330,7 @@ func (s *Store) findUserClientRequestIDs(ctx context.Context, userID, clientID,
 			return nil, nil, err
 		}
 		requestSession := requester.GetSession()
-		if requestSession == nil || requester.GetClient().GetID() != clientID || requestSession.GetSubject() != userID {
+		if requestSession == nil || (clientID != "" && requester.GetClient().GetID() != clientID) || requestSession.GetSubject() != userID {
 			continue
 		}
 
@@ -247,6 +345,45 @@ func (s *Store) findUserClientRequestIDs(ctx context.Context, userID, clientID,
 	return mapKeys(candidateRequestIDs), mapKeys(matchingRequestIDs), nil
 }
 
+// findLogoutTargets returns the sessions of the user with the client, or with every client if clientID is empty,
+// that haven't been revoked yet
+func (s *Store) findLogoutTargets(ctx context.Context, userID, clientID string) ([]logoutTarget, error) {
+	var sessions []OAuth2Session
+	err := s.dbFor(ctx).
+		Where("(kind = ? AND active = ?) OR kind = ?", sessionKindRefreshToken, true, sessionKindAccessToken).
+		Find(&sessions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[logoutTarget]struct{}{}
+	targets := make([]logoutTarget, 0)
+	for _, session := range sessions {
+		requester, err := s.decodeRequester(ctx, session.RequestData)
+		if err != nil {
+			return nil, err
+		}
+		requestSession, ok := requester.GetSession().(*Session)
+		if !ok || requestSession.GetSubject() != userID {
+			continue
+		}
+		targetClientID := requester.GetClient().GetID()
+		if clientID != "" && targetClientID != clientID {
+			continue
+		}
+
+		target := logoutTarget{clientID: targetClientID, userID: userID, sessionID: requestSession.SessionID}
+		if _, ok := seen[target]; ok {
+			continue
+		}
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
 func (s *Store) revokeRequestIDs(ctx context.Context, requestIDs []string) error {
 	if len(requestIDs) == 0 {
 		return nil
@@ -357,10 +494,10 @@ func (s *Store) CreateDeviceAuthSession(ctx context.Context, deviceCodeSignature
 
 	expDeviceCode := expiresAt(request.GetSession(), fosite.DeviceCode)
 	expUserCode := expiresAt(request.GetSession(), fosite.UserCode)
-	if err := s.storeSession(ctx, sessionKindDeviceCode, deviceCodeSignature, request.GetID(), "", true, requestData, expDeviceCode); err != nil {
+	if err := s.storeSession(ctx, sessionKindDeviceCode, deviceCodeSignature, request.GetID(), "", "", true, requestData, expDeviceCode); err != nil {
 		return err
 	}
-	return s.storeSession(ctx, sessionKindUserCode, userCodeSignature, request.GetID(), "", true, requestData, expUserCode)
+	return s.storeSession(ctx, sessionKindUserCode, userCodeSignature, request.GetID(), "", "", true, requestData, expUserCode)
 }
 
 func (s *Store) GetDeviceCodeSession(ctx context.Context, signature string, _ fosite.Session) (fosite.DeviceRequester, error) {
@@ -437,6 +574,90 @@ func (s *Store) AcceptDeviceCodeSessionByUserCodeSignature(ctx context.Context,
 	return deviceCodeSession.Key, nil
 }
 
+// Backchannel authentication requests (CIBA) are stored like device codes, keyed by the signature of the
+// auth_req_id. The decision of the user is kept in the user code state of the request.
+
+func (s *Store) CreateBackchannelAuthenticationSession(ctx context.Context, signature string, request fosite.DeviceRequester) error {
+	requestData, err := s.encodeDeviceRequester(request)
+	if err != nil {
+		return err
+	}
+	return s.storeSession(ctx, sessionKindBackchannelAuthentication, signature, request.GetID(), "", "", true, requestData, expiresAt(request.GetSession(), backchannelAuthenticationRequest))
+}
+
+func (s *Store) GetBackchannelAuthenticationSession(ctx context.Context, signature string) (fosite.DeviceRequester, error) {
+	request, active, err := s.getDeviceRequesterSession(ctx, sessionKindBackchannelAuthentication, signature)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, fosite.ErrNotFound
+	}
+	return request, nil
+}
+
+func (s *Store) GetBackchannelAuthenticationSessionByRequestID(ctx context.Context, requestID string) (fosite.DeviceRequester, error) {
+	session, err := s.getSessionByRequestID(ctx, sessionKindBackchannelAuthentication, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if !session.Active {
+		return nil, fosite.ErrNotFound
+	}
+	return s.decodeDeviceRequester(ctx, session.RequestData)
+}
+
+// ListBackchannelAuthenticationSessions returns the backchannel authentication requests that are neither expired nor redeemed
+func (s *Store) ListBackchannelAuthenticationSessions(ctx context.Context) ([]fosite.DeviceRequester, error) {
+	var sessions []OAuth2Session
+	err := s.dbFor(ctx).
+		Where("kind = ? AND active = ? AND expires_at > ?", sessionKindBackchannelAuthentication, true, datatype.DateTime(time.Now())).
+		Order("created_at").
+		Find(&sessions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]fosite.DeviceRequester, 0, len(sessions))
+	for _, session := range sessions {
+		request, err := s.decodeDeviceRequester(ctx, session.RequestData)
+		if errors.Is(err, fosite.ErrNotFound) {
+			// The client was deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// UpdateBackchannelAuthenticationSession stores the decision of the user on a pending backchannel authentication request
+func (s *Store) UpdateBackchannelAuthenticationSession(ctx context.Context, request fosite.DeviceRequester) error {
+	requestData, err := s.encodeDeviceRequester(request)
+	if err != nil {
+		return err
+	}
+
+	result := s.dbFor(ctx).
+		Model(&OAuth2Session{}).
+		Where("kind = ? AND request_id = ? AND active = ?", sessionKindBackchannelAuthentication, request.GetID(), true).
+		Update("request_data", requestData)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fosite.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) InvalidateBackchannelAuthenticationSession(ctx context.Context, signature string) error {
+	return s.deactivateSession(ctx, sessionKindBackchannelAuthentication, signature)
+}
+
 // Satisfies fositestorage.Transactional
 
 func (s *Store) BeginTX(ctx context.Context) (context.Context, error) {
@@ -469,7 +690,12 @@ func (s *Store) upsertSession(ctx context.Context, kind string, key string, requ
 		return err
 	}
 
-	return s.storeSession(ctx, kind, key, requester.GetID(), accessTokenSignature, active, requestData, expiresAt(requester.GetSession(), expiresAtKey))
+	var dpopJKT string
+	if session, ok := requester.GetSession().(*Session); ok && session != nil {
+		dpopJKT = session.DPoPJKT
+	}
+
+	return s.storeSession(ctx, kind, key, requester.GetID(), accessTokenSignature, dpopJKT, active, requestData, expiresAt(requester.GetSession(), expiresAtKey))
 }
 
 func (s *Store) upsertAuthorizeSession(ctx context.Context, kind string, key string, requester fosite.AuthorizeRequester, active bool, expiresAtKey fosite.TokenType) error {
@@ -478,15 +704,16 @@ func (s *Store) upsertAuthorizeSession(ctx context.Context, kind string, key str
 		return err
 	}
 
-	return s.storeSession(ctx, kind, key, requester.GetID(), "", active, requestData, expiresAt(requester.GetSession(), expiresAtKey))
+	return s.storeSession(ctx, kind, key, requester.GetID(), "", "", active, requestData, expiresAt(requester.GetSession(), expiresAtKey))
 }
 
-func (s *Store) storeSession(ctx context.Context, kind string, key string, requestID string, accessTokenSignature string, active bool, requestData string, exp *datatype.DateTime) error {
+func (s *Store) storeSession(ctx context.Context, kind string, key string, requestID string, accessTokenSignature string, dpopJKT string, active bool, requestData string, exp *datatype.DateTime) error {
 	session := OAuth2Session{
 		Kind:                 kind,
 		Key:                  key,
 		RequestID:            requestID,
 		AccessTokenSignature: accessTokenSignature,
+		DPoPJKT:              dpopJKT,
 		Active:               active,
 		RequestData:          requestData,
 		ExpiresAt:            exp,
@@ -498,6 +725,7 @@ func (s *Store) storeSession(ctx context.Context, kind string, key string, reque
 			DoUpdates: clause.AssignmentColumns([]string{
 				"request_id",
 				"access_token_signature",
+				"dpop_jkt",
 				"active",
 				"request_data",
 				"expires_at",
@@ -195,6 +195,60 @@ func TestStoreRevokeSessionsByIDTokenHintSkipsSessionsWithoutMatchingJTI(t *test
 	assert.True(t, accessKeys["other-client-access"])
 }
 
+func TestRevokeUserSessionGrantsOnlyRevokesGrantsOfThatSession(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	store := NewStore(db)
+
+	const (
+		userID   = "test-user-123"
+		clientID = "test-client-456"
+	)
+
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base: model.Base{ID: clientID},
+		Name: "Test Client",
+	}).Error)
+
+	withUserSession := func(requester fosite.Requester, userSessionID string) fosite.Requester {
+		requester.GetSession().(*Session).UserSessionID = userSessionID
+		return requester
+	}
+
+	require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "signed-out-refresh", "signed-out-access", withUserSession(newTestRequester("signed-out-request", clientID, userID, ""), "signed-out")))
+	require.NoError(t, store.CreateAccessTokenSession(t.Context(), "signed-out-access", withUserSession(newTestRequester("signed-out-request", clientID, userID, ""), "signed-out")))
+	require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "other-session-refresh", "other-session-access", withUserSession(newTestRequester("other-session-request", clientID, userID, ""), "other")))
+	require.NoError(t, store.CreateAccessTokenSession(t.Context(), "other-session-access", withUserSession(newTestRequester("other-session-request", clientID, userID, ""), "other")))
+	require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "no-session-refresh", "no-session-access", newTestRequester("no-session-request", clientID, userID, "")))
+	require.NoError(t, store.CreateAccessTokenSession(t.Context(), "no-session-access", newTestRequester("no-session-request", clientID, userID, "")))
+	require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "other-user-refresh", "other-user-access", withUserSession(newTestRequester("other-user-request", clientID, "other-user", ""), "signed-out")))
+	require.NoError(t, store.CreateAccessTokenSession(t.Context(), "other-user-access", withUserSession(newTestRequester("other-user-request", clientID, "other-user", ""), "signed-out")))
+
+	require.NoError(t, RevokeUserSessionGrants(t.Context(), db, userID, "signed-out"))
+
+	var sessions []OAuth2Session
+	require.NoError(t, db.Order("key").Find(&sessions).Error)
+
+	activeRefreshByKey := map[string]bool{}
+	accessKeys := map[string]bool{}
+	for _, session := range sessions {
+		switch session.Kind {
+		case sessionKindRefreshToken:
+			activeRefreshByKey[session.Key] = session.Active
+		case sessionKindAccessToken:
+			accessKeys[session.Key] = true
+		}
+	}
+
+	assert.False(t, activeRefreshByKey["signed-out-refresh"])
+	assert.True(t, activeRefreshByKey["other-session-refresh"])
+	assert.True(t, activeRefreshByKey["no-session-refresh"])
+	assert.True(t, activeRefreshByKey["other-user-refresh"])
+	assert.False(t, accessKeys["signed-out-access"])
+	assert.True(t, accessKeys["other-session-access"])
+	assert.True(t, accessKeys["no-session-access"])
+	assert.True(t, accessKeys["other-user-access"])
+}
+
 func newTestRequester(requestID, clientID, subject, idTokenJTI string) fosite.Requester {
 	session := NewEmptySession()
 	session.Subject = subject
@@ -217,3 +271,73 @@ func newTestRequester(requestID, clientID, subject, idTokenJTI string) fosite.Re
 		Session:      session,
 	}
 }
+
+func TestStoreAppliesClientTokenLifetimes(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	store := NewStore(db)
+
+	newRequester := func(requestID string, lifetimes model.OidcClientTokenLifetimes, session *Session) *fosite.Request {
+		return &fosite.Request{
+			ID:          requestID,
+			RequestedAt: time.Now().UTC(),
+			Client:      Client{OidcClient: model.OidcClient{Base: model.Base{ID: "lifetime-client"}, TokenLifetimes: lifetimes}},
+			Form:        url.Values{},
+			Session:     session,
+		}
+	}
+	storedExpiry := func(t *testing.T, kind, key string) time.Time {
+		t.Helper()
+		var session OAuth2Session
+		require.NoError(t, db.First(&session, "kind = ? AND key = ?", kind, key).Error)
+		require.NotNil(t, session.ExpiresAt)
+		return session.ExpiresAt.ToTime()
+	}
+
+	t.Run("authorization codes expire after the lifetime of the client", func(t *testing.T) {
+		session := NewEmptySession()
+		session.SetExpiresAt(fosite.AuthorizeCode, time.Now().UTC().Add(10*time.Minute))
+		request := newRequester("code-lifetime", model.OidcClientTokenLifetimes{AuthorizationCode: 30}, session)
+
+		require.NoError(t, store.CreateAuthorizeCodeSession(t.Context(), "code-lifetime", request))
+		require.WithinDuration(t, time.Now().Add(30*time.Second), session.GetExpiresAt(fosite.AuthorizeCode), 2*time.Second)
+		require.WithinDuration(t, time.Now().Add(30*time.Second), storedExpiry(t, sessionKindAuthorizeCode, "code-lifetime"), 2*time.Second)
+	})
+
+	t.Run("sliding refresh tokens keep the expiry fosite set", func(t *testing.T) {
+		exp := time.Now().UTC().Add(24 * time.Hour).Round(time.Second)
+		session := NewEmptySession()
+		session.SetExpiresAt(fosite.RefreshToken, exp)
+		request := newRequester("sliding", model.OidcClientTokenLifetimes{RefreshToken: 24 * 60 * 60}, session)
+
+		require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "rt-sliding", "at-sliding", request))
+		require.True(t, session.GrantExpiresAt.IsZero())
+		require.WithinDuration(t, exp, storedExpiry(t, sessionKindRefreshToken, "rt-sliding"), time.Second)
+	})
+
+	t.Run("absolute refresh tokens don't outlive the grant", func(t *testing.T) {
+		lifetimes := model.OidcClientTokenLifetimes{
+			RefreshToken:       24 * 60 * 60,
+			RefreshTokenExpiry: model.OidcRefreshTokenExpiryAbsolute,
+		}
+
+		session := NewEmptySession()
+		session.SetExpiresAt(fosite.RefreshToken, time.Now().UTC().Add(24*time.Hour))
+		require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "rt-absolute-1", "at-absolute-1", newRequester("absolute", lifetimes, session)))
+		grantExpiresAt := session.GrantExpiresAt
+		require.WithinDuration(t, time.Now().Add(24*time.Hour), grantExpiresAt, 2*time.Second)
+
+		// A refresh carries the session over and fosite issues the new refresh token with the full lifetime again
+		refreshed := cloneSession(session)
+		refreshed.SetExpiresAt(fosite.RefreshToken, time.Now().UTC().Add(48*time.Hour))
+		require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "rt-absolute-2", "at-absolute-2", newRequester("absolute", lifetimes, refreshed)))
+		require.Equal(t, grantExpiresAt, refreshed.GrantExpiresAt)
+		require.WithinDuration(t, grantExpiresAt, storedExpiry(t, sessionKindRefreshToken, "rt-absolute-2"), time.Second)
+
+		// An earlier expiry, e.g. from the idle timeout, is kept
+		idle := cloneSession(session)
+		idleExp := time.Now().UTC().Add(time.Hour).Round(time.Second)
+		idle.SetExpiresAt(fosite.RefreshToken, idleExp)
+		require.NoError(t, store.CreateRefreshTokenSession(t.Context(), "rt-absolute-3", "at-absolute-3", newRequester("absolute", lifetimes, idle)))
+		require.WithinDuration(t, idleExp, storedExpiry(t, sessionKindRefreshToken, "rt-absolute-3"), time.Second)
+	})
+}
@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// SubjectResolver derives the subject identifiers released to clients, as described in OpenID Connect Core section 8.
+// Clients with the public subject type receive the user ID, clients with the pairwise subject type receive
+// an identifier that is derived from the user ID and the sector of the client with a secret key.
+type SubjectResolver struct {
+	key []byte
+}
+
+func newSubjectResolver(key []byte) SubjectResolver {
+	return SubjectResolver{key: key}
+}
+
+// Subject returns the subject identifier of the user that is released to the client
+func (r SubjectResolver) Subject(client model.OidcClient, userID string) string {
+	if userID == "" || !client.UsesPairwiseSubjects() {
+		return userID
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(PairwiseSector(client)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// userIDForSubject returns the ID of the user that has authorized the client and is identified by the subject
+// Pairwise subjects can't be reversed, so they are compared with the subjects of every user that authorized the client
+func (r SubjectResolver) userIDForSubject(ctx context.Context, db *gorm.DB, client model.OidcClient, subject string) (string, error) {
+	if !client.UsesPairwiseSubjects() {
+		return subject, nil
+	}
+
+	var userIDs []string
+	err := dbFromContext(ctx, db).
+		Model(&model.UserAuthorizedOidcClient{}).
+		Where("client_id = ?", client.ID).
+		Pluck("user_id", &userIDs).
+		Error
+	if err != nil {
+		return "", err
+	}
+
+	for _, userID := range userIDs {
+		if hmac.Equal([]byte(r.Subject(client, userID)), []byte(subject)) {
+			return userID, nil
+		}
+	}
+
+	return "", gorm.ErrRecordNotFound
+}
+
+// PairwiseSector returns the sector identifier of a client with pairwise subjects: the host of its sector
+// identifier URI, otherwise the host of its callback URLs. Clients without either use their own ID as sector.
+func PairwiseSector(client model.OidcClient) string {
+	if client.SectorIdentifierURI != nil && *client.SectorIdentifierURI != "" {
+		if u, err := url.Parse(*client.SectorIdentifierURI); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+
+	for _, callbackURL := range client.CallbackURLs {
+		if u, err := url.Parse(callbackURL); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+
+	return client.ID
+}
@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestSubjectResolver(t *testing.T) {
+	resolver := newSubjectResolver([]byte("pairwise-key"))
+
+	publicClient := model.OidcClient{Base: model.Base{ID: "public"}}
+	pairwiseClient := func(id string, callbackURLs ...string) model.OidcClient {
+		return model.OidcClient{
+			Base:         model.Base{ID: id},
+			SubjectType:  model.OidcSubjectTypePairwise,
+			CallbackURLs: callbackURLs,
+		}
+	}
+
+	t.Run("public clients receive the user ID", func(t *testing.T) {
+		require.Equal(t, "user-1", resolver.Subject(publicClient, "user-1"))
+	})
+
+	t.Run("pairwise subjects are deterministic per sector", func(t *testing.T) {
+		a := pairwiseClient("a", "https://app.example.com/callback")
+		b := pairwiseClient("b", "https://app.example.com/other-callback")
+
+		subject := resolver.Subject(a, "user-1")
+		require.NotEqual(t, "user-1", subject)
+		require.Equal(t, subject, resolver.Subject(a, "user-1"))
+		require.Equal(t, subject, resolver.Subject(b, "user-1"), "clients of the same sector must receive the same subject")
+		require.NotEqual(t, subject, resolver.Subject(a, "user-2"))
+	})
+
+	t.Run("pairwise subjects differ across sectors", func(t *testing.T) {
+		a := pairwiseClient("a", "https://app.example.com/callback")
+		b := pairwiseClient("b", "https://other.example.com/callback")
+		require.NotEqual(t, resolver.Subject(a, "user-1"), resolver.Subject(b, "user-1"))
+	})
+
+	t.Run("sector identifier URI takes precedence over the callback URLs", func(t *testing.T) {
+		a := pairwiseClient("a", "https://app.example.com/callback")
+		b := pairwiseClient("b", "https://other.example.com/callback")
+		b.SectorIdentifierURI = stringPointer("https://app.example.com/sector.json")
+		require.Equal(t, resolver.Subject(a, "user-1"), resolver.Subject(b, "user-1"))
+	})
+
+	t.Run("pairwise subjects depend on the key", func(t *testing.T) {
+		client := pairwiseClient("a", "https://app.example.com/callback")
+		other := newSubjectResolver([]byte("other-key"))
+		require.NotEqual(t, resolver.Subject(client, "user-1"), other.Subject(client, "user-1"))
+	})
+}
+
+func TestSubjectResolverUserIDForSubject(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	resolver := newSubjectResolver([]byte("pairwise-key"))
+
+	client := model.OidcClient{
+		Base:         model.Base{ID: "client"},
+		Name:         "Client",
+		SubjectType:  model.OidcSubjectTypePairwise,
+		CallbackURLs: model.UrlList{"https://app.example.com/callback"},
+	}
+	require.NoError(t, db.Create(&client).Error)
+	for _, userID := range []string{"user-1", "user-2", "user-3"} {
+		require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: userID}).Error)
+	}
+	for _, userID := range []string{"user-1", "user-2"} {
+		require.NoError(t, db.Create(&model.UserAuthorizedOidcClient{UserID: userID, ClientID: client.ID}).Error)
+	}
+
+	t.Run("subject is resolved to the user", func(t *testing.T) {
+		userID, err := resolver.userIDForSubject(t.Context(), db, client, resolver.Subject(client, "user-2"))
+		require.NoError(t, err)
+		require.Equal(t, "user-2", userID)
+	})
+
+	t.Run("subject of a user that didn't authorize the client is not found", func(t *testing.T) {
+		_, err := resolver.userIDForSubject(t.Context(), db, client, resolver.Subject(client, "user-3"))
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("public subjects are returned as is", func(t *testing.T) {
+		userID, err := resolver.userIDForSubject(t.Context(), db, model.OidcClient{}, "user-3")
+		require.NoError(t, err)
+		require.Equal(t, "user-3", userID)
+	})
+}
@@ -0,0 +1,364 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+	fositeoauth2 "github.com/ory/fosite/handler/oauth2"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+const (
+	// GrantTypeTokenExchange is the grant type of the token exchange grant (RFC 8693)
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var errInvalidTarget = &fosite.RFC6749Error{
+	ErrorField:       "invalid_target",
+	DescriptionField: "The requested audience or resource is invalid, unknown, or malformed.",
+	CodeField:        http.StatusBadRequest,
+}
+
+// userClaimColumns maps the claims that can identify the user of an external token to the user column they're matched against
+var userClaimColumns = map[string]string{
+	"email":              "email",
+	"preferred_username": "username",
+}
+
+var _ fosite.TokenEndpointHandler = (*tokenExchangeHandler)(nil)
+
+type tokenIntrospector interface {
+	IntrospectToken(ctx context.Context, token string, tokenUse fosite.TokenUse, session fosite.Session, scope ...string) (fosite.TokenUse, fosite.AccessRequester, error)
+}
+
+// tokenExchangeHandler implements the token exchange grant (RFC 8693).
+// A client exchanges the access token of a user, or an ID token issued by a trusted issuer, for an access token
+// with a different audience and fewer scopes, as allowed by its token exchange policy.
+// If the client presents an actor token, the issued token is delegated and carries an "act" claim;
+// otherwise the client impersonates the user.
+type tokenExchangeHandler struct {
+	// introspector is set after the provider was composed, because it's needed to validate the subject and actor tokens
+	introspector        tokenIntrospector
+	accessTokenStrategy fositeoauth2.AccessTokenStrategy
+	store               *Store
+	config              *fosite.Config
+	fetchJWKSet         func(ctx context.Context, jwksURL string) (jwk.Set, error)
+	// discoverJWKSURL looks up the JWKS URL of trusted issuers that don't configure one
+	discoverJWKSURL func(ctx context.Context, issuer string) (string, error)
+}
+
+// exchangedToken is a subject or actor token presented in a token exchange request
+type exchangedToken struct {
+	subject string
+	// clientSubject is the subject identifier that was released to the client the token was issued to
+	clientSubject string
+	// clientID is the client the token was issued to; it's empty for tokens of external issuers
+	clientID string
+	scopes   fosite.Arguments
+	actor    map[string]any
+}
+
+func (h *tokenExchangeHandler) CanSkipClientAuth(context.Context, fosite.AccessRequester) bool {
+	return false
+}
+
+func (h *tokenExchangeHandler) CanHandleTokenEndpointRequest(_ context.Context, requester fosite.AccessRequester) bool {
+	return requester.GetGrantTypes().ExactOne(GrantTypeTokenExchange)
+}
+
+func (h *tokenExchangeHandler) HandleTokenEndpointRequest(ctx context.Context, requester fosite.AccessRequester) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return fosite.ErrUnknownRequest
+	}
+
+	client, ok := requester.GetClient().(Client)
+	if !ok || !client.GetGrantTypes().Has(GrantTypeTokenExchange) {
+		return fosite.ErrUnauthorizedClient.WithHint("The client is not allowed to use the token exchange grant.")
+	}
+	policy := client.TokenExchange
+	form := requester.GetRequestForm()
+
+	if tokenType := form.Get("requested_token_type"); tokenType != "" && tokenType != TokenTypeAccessToken {
+		return fosite.ErrInvalidRequest.WithHint("Only access tokens can be requested with the token exchange grant.")
+	}
+
+	subjectToken, subjectTokenType := form.Get("subject_token"), form.Get("subject_token_type")
+	if subjectToken == "" || subjectTokenType == "" {
+		return fosite.ErrInvalidRequest.WithHint("The 'subject_token' and 'subject_token_type' parameters are required.")
+	}
+	if !slices.Contains(policy.SubjectTokenTypes, subjectTokenType) {
+		return fosite.ErrInvalidRequest.WithHintf("The client is not allowed to exchange tokens of type '%s'.", subjectTokenType)
+	}
+
+	subject, err := h.resolveSubjectToken(ctx, client, subjectToken, subjectTokenType)
+	if err != nil {
+		return err
+	}
+
+	actor, err := h.resolveActor(ctx, client, form, subject)
+	if err != nil {
+		return err
+	}
+
+	if err := grantExchangedScopes(requester, policy, subject); err != nil {
+		return err
+	}
+
+	for _, audience := range requester.GetRequestedAudience() {
+		if audience != client.ID && !slices.Contains(policy.AllowedAudiences, audience) {
+			return errInvalidTarget.WithHintf("The client is not allowed to request the audience '%s'.", audience)
+		}
+		requester.GrantAudience(audience)
+	}
+
+	session, ok := requester.GetSession().(*Session)
+	if !ok {
+		return fosite.ErrServerError.WithDebug("The session must be *oidc.Session.")
+	}
+	session.Subject = subject.subject
+	session.IDTokenClaims().Subject = subject.subject
+	session.SetActor(actor)
+	session.SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(fosite.GetEffectiveLifespan(client, GrantTypeTokenExchange, fosite.AccessToken, h.config.GetAccessTokenLifespan(ctx))))
+
+	return nil
+}
+
+func (h *tokenExchangeHandler) PopulateTokenEndpointResponse(ctx context.Context, requester fosite.AccessRequester, responder fosite.AccessResponder) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return fosite.ErrUnknownRequest
+	}
+
+	token, signature, err := h.accessTokenStrategy.GenerateAccessToken(ctx, requester)
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	// The subject and actor tokens must not be stored with the issued token
+	if err := h.store.CreateAccessTokenSession(ctx, signature, requester.Sanitize([]string{})); err != nil {
+		return fosite.ErrServerError.WithWrap(err)
+	}
+
+	responder.SetAccessToken(token)
+	responder.SetTokenType("bearer")
+	responder.SetExpiresIn(time.Until(requester.GetSession().GetExpiresAt(fosite.AccessToken)))
+	responder.SetScopes(requester.GetGrantedScopes())
+	responder.SetExtra("issued_token_type", TokenTypeAccessToken)
+	return nil
+}
+
+// resolveSubjectToken validates the subject token and returns the user it represents
+func (h *tokenExchangeHandler) resolveSubjectToken(ctx context.Context, client Client, token string, tokenType string) (exchangedToken, error) {
+	switch tokenType {
+	case TokenTypeAccessToken:
+		subject, err := h.introspectAccessToken(ctx, token)
+		if err != nil {
+			return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The subject token is invalid.").WithWrap(err)
+		}
+		if subject.clientID != client.ID && !slices.Contains(client.TokenExchange.SubjectClientIDs, subject.clientID) {
+			return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The client is not allowed to exchange access tokens issued to other clients.")
+		}
+		// Tokens issued with the client credentials grant don't represent a user
+		if subject.subject == "" || subject.subject == clientCredentialsSubject(subject.clientID) {
+			return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The subject token must belong to a user.")
+		}
+		return subject, nil
+	case TokenTypeIDToken, TokenTypeJWT:
+		return h.resolveExternalToken(ctx, client, token)
+	default:
+		return exchangedToken{}, fosite.ErrInvalidRequest.WithHintf("Tokens of type '%s' can't be exchanged.", tokenType)
+	}
+}
+
+// resolveActor returns the "act" claim of the issued token.
+// With an actor token, the actor is delegated by the subject; without one, the client impersonates the subject.
+func (h *tokenExchangeHandler) resolveActor(ctx context.Context, client Client, form url.Values, subject exchangedToken) (map[string]any, error) {
+	actorToken := form.Get("actor_token")
+	if actorToken == "" {
+		if !client.TokenExchange.AllowImpersonation {
+			return nil, fosite.ErrInvalidRequest.WithHint("The client is not allowed to impersonate users, an actor token is required.")
+		}
+		// The delegation chain of the subject token is kept
+		return subject.actor, nil
+	}
+
+	if !client.TokenExchange.AllowDelegation {
+		return nil, fosite.ErrInvalidRequest.WithHint("The client is not allowed to act on behalf of users.")
+	}
+	if form.Get("actor_token_type") != TokenTypeAccessToken {
+		return nil, fosite.ErrInvalidRequest.WithHintf("The actor token must be of type '%s'.", TokenTypeAccessToken)
+	}
+
+	actor, err := h.introspectAccessToken(ctx, actorToken)
+	if err != nil {
+		return nil, fosite.ErrInvalidRequest.WithHint("The actor token is invalid.").WithWrap(err)
+	}
+	if actor.clientID != client.ID {
+		return nil, fosite.ErrInvalidRequest.WithHint("The actor token must be issued to the client.")
+	}
+
+	act := map[string]any{"sub": actor.clientSubject}
+	// Previous actors are nested, as defined in RFC 8693 section 4.1
+	if subject.actor != nil {
+		act["act"] = subject.actor
+	}
+	return act, nil
+}
+
+func (h *tokenExchangeHandler) introspectAccessToken(ctx context.Context, token string) (exchangedToken, error) {
+	tokenUse, requester, err := h.introspector.IntrospectToken(ctx, token, fosite.AccessToken, NewEmptySession())
+	if err != nil {
+		return exchangedToken{}, err
+	}
+	if tokenUse != fosite.AccessToken {
+		return exchangedToken{}, errors.New("token is not an access token")
+	}
+
+	session, ok := requester.GetSession().(*Session)
+	if !ok {
+		return exchangedToken{}, errors.New("session must be *oidc.Session")
+	}
+	// The request doesn't prove possession of the key DPoP-bound tokens are bound to
+	if session.DPoPJKT != "" {
+		return exchangedToken{}, errors.New("DPoP-bound tokens can't be exchanged")
+	}
+
+	return exchangedToken{
+		subject:       session.Subject,
+		clientSubject: session.ClientSubject(),
+		clientID:      requester.GetClient().GetID(),
+		scopes:        requester.GetGrantedScopes(),
+		actor:         session.Actor,
+	}, nil
+}
+
+// resolveExternalToken validates an ID token or JWT of one of the client's trusted issuers, and returns the user it belongs to
+func (h *tokenExchangeHandler) resolveExternalToken(ctx context.Context, client Client, token string) (exchangedToken, error) {
+	rawToken := []byte(token)
+	insecureToken, err := jwt.ParseInsecure(rawToken)
+	if err != nil {
+		return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The subject token is not a valid JWT.").WithWrap(err)
+	}
+
+	issuer, _ := insecureToken.Issuer()
+	trustedIssuer, ok := client.TokenExchange.TrustedIssuer(issuer)
+	if !ok {
+		return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The issuer of the subject token is not trusted.")
+	}
+	if h.fetchJWKSet == nil || h.discoverJWKSURL == nil {
+		return exchangedToken{}, fosite.ErrServerError.WithHint("Tokens of external issuers can't be validated.")
+	}
+
+	jwksURL := trustedIssuer.JWKS
+	if jwksURL == "" {
+		jwksURL, err = h.discoverJWKSURL(ctx, issuer)
+		if err != nil {
+			return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("Unable to discover the JWKS of the subject token issuer.").WithWrap(err)
+		}
+	}
+	jwks, err := h.fetchJWKSet(ctx, jwksURL)
+	if err != nil {
+		return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("Unable to fetch the JWKS of the subject token issuer.").WithWrap(err)
+	}
+
+	audience := trustedIssuer.Audience
+	if audience == "" {
+		audience = client.ID
+	}
+
+	parsed, err := jwt.Parse(rawToken,
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(30*time.Second),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithKeySet(jwks, jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)),
+	)
+	if err != nil {
+		return exchangedToken{}, fosite.ErrInvalidRequest.WithHint("The subject token is invalid.").WithWrap(err)
+	}
+
+	userID, err := h.userIDForExternalToken(ctx, parsed, trustedIssuer.UserClaim)
+	if err != nil {
+		return exchangedToken{}, err
+	}
+	return exchangedToken{subject: userID}, nil
+}
+
+func (h *tokenExchangeHandler) userIDForExternalToken(ctx context.Context, token jwt.Token, userClaim string) (string, error) {
+	if userClaim == "" {
+		userClaim = "email"
+	}
+	column, ok := userClaimColumns[userClaim]
+	if !ok {
+		return "", fosite.ErrServerError.WithHintf("The user claim '%s' is not supported.", userClaim)
+	}
+
+	var value string
+	if err := token.Get(userClaim, &value); err != nil || value == "" {
+		return "", fosite.ErrInvalidRequest.WithHintf("The subject token is missing the '%s' claim.", userClaim)
+	}
+
+	// An unverified email address could belong to anyone
+	if userClaim == "email" {
+		var emailVerified bool
+		if err := token.Get("email_verified", &emailVerified); err != nil || !emailVerified {
+			return "", fosite.ErrInvalidRequest.WithHint("The email address of the subject token is not verified.")
+		}
+	}
+
+	var user model.User
+	err := dbFromContext(ctx, h.store.db).
+		Select("id").
+		Where(column+" = ?", value).
+		First(&user).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fosite.ErrInvalidGrant.WithHint("No user matches the subject token.")
+	}
+	if err != nil {
+		return "", fosite.ErrServerError.WithWrap(err)
+	}
+
+	return user.ID, nil
+}
+
+// grantExchangedScopes grants the requested scopes that are allowed by the policy and were granted to the subject token.
+// If no scope is requested, all of the subject token's scopes that are allowed are granted.
+func grantExchangedScopes(requester fosite.AccessRequester, policy model.OidcClientTokenExchangePolicy, subject exchangedToken) error {
+	// The scopes of tokens of external issuers are not related to ours
+	restrictToSubject := subject.clientID != ""
+
+	requested := requester.GetRequestedScopes()
+	if len(requested) == 0 {
+		for _, scope := range subject.scopes {
+			if slices.Contains(policy.AllowedScopes, scope) {
+				requester.GrantScope(scope)
+			}
+		}
+		return nil
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(policy.AllowedScopes, scope) {
+			return fosite.ErrInvalidScope.WithHintf("The client is not allowed to request the scope '%s' with the token exchange grant.", scope)
+		}
+		if restrictToSubject && !subject.scopes.Has(scope) {
+			return fosite.ErrInvalidScope.WithHintf("The scope '%s' was not granted to the subject token.", scope)
+		}
+		requester.GrantScope(scope)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+// TestTokenHandlerTokenExchange drives the token exchange grant (RFC 8693) through the token endpoint:
+// the exchanged token must be downscoped to the policy of the client, carry the requested audience,
+// and record whether the client acted as delegate or impersonated the user.
+func TestTokenHandlerTokenExchange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		baseURL     = "https://issuer.example.com"
+		userID      = "user-1"
+		clientID    = "backend"
+		clientPlain = "backend-secret"
+		otherID     = "other"
+		otherPlain  = "other-secret"
+	)
+
+	db := testutils.NewDatabaseForTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&model.User{Base: model.Base{ID: userID}, Username: "tim"}).Error)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(clientPlain), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:   model.Base{ID: clientID},
+		Name:   "Backend",
+		Secret: string(hashed),
+		TokenExchange: model.OidcClientTokenExchangePolicy{
+			SubjectTokenTypes:  []string{TokenTypeAccessToken},
+			AllowedAudiences:   []string{"orders-api"},
+			AllowedScopes:      []string{"openid", "email"},
+			AllowDelegation:    true,
+			AllowImpersonation: true,
+		},
+	}).Error)
+
+	hashed, err = bcrypt.GenerateFromPassword([]byte(otherPlain), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:   model.Base{ID: otherID},
+		Name:   "Other",
+		Secret: string(hashed),
+	}).Error)
+
+	provider, err := newProvider(NewStore(db), nil, testTokenSigner{key: key}, Config{
+		BaseURL:      baseURL,
+		TokenBaseURL: baseURL,
+		Secret:       "test-secret",
+	})
+	require.NoError(t, err)
+	auditLogger := &fakeAuditLogger{}
+	handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), auditLogger, db)
+
+	issueAccessToken := func(t *testing.T, requestID, client, subject string, scopes ...string) string {
+		t.Helper()
+		session := NewEmptySession()
+		session.Subject = subject
+		session.SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(time.Hour))
+
+		request := fosite.NewAccessRequest(session)
+		request.ID = requestID
+		request.Client = Client{OidcClient: model.OidcClient{Base: model.Base{ID: client}}}
+		request.GrantTypes = fosite.Arguments{string(fosite.GrantTypeAuthorizationCode)}
+		request.RequestedScope = fosite.Arguments(scopes)
+		request.GrantedScope = fosite.Arguments(scopes)
+		request.RequestedAudience = fosite.Arguments{client}
+		request.GrantedAudience = fosite.Arguments{client}
+
+		response, err := provider.NewAccessResponse(t.Context(), request)
+		require.NoError(t, err)
+		return response.GetAccessToken()
+	}
+
+	exchange := func(t *testing.T, id, secret string, form url.Values) (int, map[string]any) {
+		t.Helper()
+		form.Set("grant_type", GrantTypeTokenExchange)
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/oidc/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(id, secret)
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+		handler.token(c)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	subjectToken := issueAccessToken(t, "req-subject", clientID, userID, "openid", "email", "profile")
+
+	t.Run("impersonation issues a downscoped token for the requested audience", func(t *testing.T) {
+		auditLogger.events = nil
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+			"audience":           {"orders-api"},
+			"scope":              {"email"},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		require.Equal(t, TokenTypeAccessToken, body["issued_token_type"])
+		require.Equal(t, "email", body["scope"])
+		require.NotContains(t, body, "refresh_token")
+
+		claims := decodeJWTPart(t, body["access_token"].(string), 1)
+		require.Equal(t, userID, claims["sub"])
+		require.Equal(t, []string{"orders-api"}, jwtAudience(claims))
+		require.NotContains(t, claims, "act")
+
+		require.Equal(t, []model.AuditLogEvent{model.AuditLogEventTokenExchangeImpersonation}, auditLogger.events)
+	})
+
+	t.Run("delegation adds the actor to the token", func(t *testing.T) {
+		auditLogger.events = nil
+		actorToken := issueAccessToken(t, "req-actor", clientID, clientCredentialsSubject(clientID))
+
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+			"actor_token":        {actorToken},
+			"actor_token_type":   {TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusOK, code, "unexpected error: %v", body["error_description"])
+		// Without requested scopes, the allowed scopes of the subject token are granted
+		require.Equal(t, "openid email", body["scope"])
+
+		claims := decodeJWTPart(t, body["access_token"].(string), 1)
+		require.Equal(t, userID, claims["sub"])
+		require.Equal(t, []string{clientID}, jwtAudience(claims))
+		require.Equal(t, map[string]any{"sub": clientCredentialsSubject(clientID)}, claims["act"])
+
+		require.Equal(t, []model.AuditLogEvent{model.AuditLogEventTokenExchangeDelegation}, auditLogger.events)
+		require.Equal(t, clientCredentialsSubject(clientID), auditLogger.data[0]["actor"])
+	})
+
+	t.Run("scope that isn't allowed is rejected", func(t *testing.T) {
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+			"scope":              {"profile"},
+		})
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_scope", body["error"])
+	})
+
+	t.Run("audience that isn't allowed is rejected", func(t *testing.T) {
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+			"audience":           {"billing-api"},
+		})
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_target", body["error"])
+	})
+
+	t.Run("token without a user is rejected", func(t *testing.T) {
+		machineToken := issueAccessToken(t, "req-machine", clientID, clientCredentialsSubject(clientID), "openid")
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {machineToken},
+			"subject_token_type": {TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_request", body["error"])
+	})
+
+	t.Run("token of another client is rejected", func(t *testing.T) {
+		otherToken := issueAccessToken(t, "req-other", otherID, userID, "openid")
+		code, body := exchange(t, clientID, clientPlain, url.Values{
+			"subject_token":      {otherToken},
+			"subject_token_type": {TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_request", body["error"])
+	})
+
+	t.Run("client without a token exchange policy is rejected", func(t *testing.T) {
+		_, body := exchange(t, otherID, otherPlain, url.Values{
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+		})
+		require.Equal(t, "unauthorized_client", body["error"])
+	})
+}
+
+func TestTokenExchangeHandlerExternalToken(t *testing.T) {
+	const issuer = "https://idp.example.com"
+
+	db := testutils.NewDatabaseForTest(t)
+	require.NoError(t, db.Create(&model.User{
+		Base:     model.Base{ID: "user-1"},
+		Username: "tim",
+		Email:    stringPointer("tim@example.com"),
+	}).Error)
+
+	signingKey, publicKey := newDPoPTestKey(t)
+	jwks := jwk.NewSet()
+	require.NoError(t, jwks.AddKey(publicKey))
+
+	handler := &tokenExchangeHandler{
+		store: NewStore(db),
+		fetchJWKSet: func(_ context.Context, jwksURL string) (jwk.Set, error) {
+			require.Equal(t, issuer+"/protocol/openid-connect/certs", jwksURL)
+			return jwks, nil
+		},
+		discoverJWKSURL: func(_ context.Context, iss string) (string, error) {
+			require.Equal(t, issuer, iss)
+			return issuer + "/protocol/openid-connect/certs", nil
+		},
+	}
+	client := Client{OidcClient: model.OidcClient{
+		Base: model.Base{ID: "backend"},
+		TokenExchange: model.OidcClientTokenExchangePolicy{
+			SubjectTokenTypes:  []string{TokenTypeIDToken},
+			TrustedIssuers:     []model.OidcClientTokenExchangeIssuer{{Issuer: issuer}},
+			AllowImpersonation: true,
+		},
+	}}
+
+	signToken := func(t *testing.T, iss string, claims map[string]any) string {
+		t.Helper()
+		builder := jwt.NewBuilder().
+			Issuer(iss).
+			Audience([]string{"backend"}).
+			IssuedAt(time.Now()).
+			Expiration(time.Now().Add(time.Minute))
+		for name, value := range claims {
+			builder = builder.Claim(name, value)
+		}
+		token, err := builder.Build()
+		require.NoError(t, err)
+		signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256(), signingKey))
+		require.NoError(t, err)
+		return string(signed)
+	}
+
+	t.Run("token with a verified email is mapped to the user", func(t *testing.T) {
+		token := signToken(t, issuer, map[string]any{"email": "tim@example.com", "email_verified": true})
+		subject, err := handler.resolveSubjectToken(t.Context(), client, token, TokenTypeIDToken)
+		require.NoError(t, err)
+		require.Equal(t, "user-1", subject.subject)
+		require.Empty(t, subject.clientID)
+	})
+
+	t.Run("token with an unverified email is rejected", func(t *testing.T) {
+		token := signToken(t, issuer, map[string]any{"email": "tim@example.com"})
+		_, err := handler.resolveSubjectToken(t.Context(), client, token, TokenTypeIDToken)
+		requireRFC6749Error(t, err, fosite.ErrInvalidRequest.ErrorField)
+	})
+
+	t.Run("token of an unknown user is rejected", func(t *testing.T) {
+		token := signToken(t, issuer, map[string]any{"email": "craig@example.com", "email_verified": true})
+		_, err := handler.resolveSubjectToken(t.Context(), client, token, TokenTypeIDToken)
+		requireRFC6749Error(t, err, fosite.ErrInvalidGrant.ErrorField)
+	})
+
+	t.Run("token of an untrusted issuer is rejected", func(t *testing.T) {
+		token := signToken(t, "https://evil.example.com", map[string]any{"email": "tim@example.com", "email_verified": true})
+		_, err := handler.resolveSubjectToken(t.Context(), client, token, TokenTypeIDToken)
+		requireRFC6749Error(t, err, fosite.ErrInvalidRequest.ErrorField)
+	})
+}
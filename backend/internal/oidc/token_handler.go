@@ -2,26 +2,47 @@ package oidc
 
 import (
 	"log/slog"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ory/fosite"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
 type tokenHandler struct {
 	provider      fosite.OAuth2Provider
 	claimsService *ClaimsService
+	dpop          *dpopValidator
+	mtls          *mtlsAuthenticator
+	encrypter     *responseEncrypter
+	auditLog      AuditLogger
+	db            *gorm.DB
 }
 
-func newTokenHandler(provider fosite.OAuth2Provider, claimsService *ClaimsService) *tokenHandler {
+func newTokenHandler(provider fosite.OAuth2Provider, claimsService *ClaimsService, dpop *dpopValidator, mtls *mtlsAuthenticator, encrypter *responseEncrypter, auditLog AuditLogger, db *gorm.DB) *tokenHandler {
 	return &tokenHandler{
 		provider:      provider,
 		claimsService: claimsService,
+		dpop:          dpop,
+		mtls:          mtls,
+		encrypter:     encrypter,
+		auditLog:      auditLog,
+		db:            db,
 	}
 }
 
 func (h *tokenHandler) token(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	dpopJKT, err := h.dpop.validateProof(ctx, c.Request, "/api/oidc/token", "")
+	if err != nil {
+		h.dpop.setNonceHeader(c.Writer)
+		h.provider.WriteAccessError(ctx, c.Writer, nil, err)
+		return
+	}
+
 	// For grants that continue an existing session (authorization code, refresh token),
 	// fosite restores the stored session over this empty one.
 	session := NewEmptySession()
@@ -48,11 +69,33 @@ func (h *tokenHandler) token(c *gin.Context) {
 			return
 		}
 
-		// Bind every issued JWT access token to the requesting client so it always carries an aud claim.
-		accessRequest.GrantAudience(client.GetID())
+		if err := applyResourceIndicators(accessRequest, requestSession, client); err != nil {
+			slog.WarnContext(ctx, "Rejected token request: invalid resource indicator", "error", err.Error())
+			h.provider.WriteAccessError(ctx, c.Writer, accessRequest, err)
+			return
+		}
+
+		// Bind every issued JWT access token to the requesting client so it always carries an aud claim,
+		// unless the grant already granted a different audience (e.g. token exchange).
+		if len(accessRequest.GetGrantedAudience()) == 0 {
+			accessRequest.GrantAudience(client.GetID())
+		}
+
+		if err := bindDPoPKey(requestSession, client, dpopJKT); err != nil {
+			slog.WarnContext(ctx, "Rejected token request: invalid DPoP binding", "error", err.Error())
+			h.dpop.setNonceHeader(c.Writer)
+			h.provider.WriteAccessError(ctx, c.Writer, accessRequest, err)
+			return
+		}
+
+		if err := bindCertificate(requestSession, client, h.mtls.certificateThumbprint(c.Request)); err != nil {
+			slog.WarnContext(ctx, "Rejected token request: invalid certificate binding", "error", err.Error())
+			h.provider.WriteAccessError(ctx, c.Writer, accessRequest, err)
+			return
+		}
 	}
 
-	if err := h.claimsService.applyIDTokenClaims(ctx, requestSession, accessRequest.GetGrantedScopes()); err != nil {
+	if err := h.claimsService.applyIDTokenClaims(ctx, requestSession, oidcClientOf(accessRequest.GetClient()), accessRequest.GetGrantedScopes()); err != nil {
 		slog.ErrorContext(ctx, "Failed to apply ID token claims", "error", err)
 		h.provider.WriteAccessError(ctx, c.Writer, accessRequest, err)
 		return
@@ -62,8 +105,11 @@ func (h *tokenHandler) token(c *gin.Context) {
 	// stable synthetic subject so the issued JWT access token still carries a subclaim.
 	if requestSession.Subject == "" {
 		if client, ok := accessRequest.GetClient().(Client); ok && accessRequest.GetGrantTypes().Has(string(fosite.GrantTypeClientCredentials)) {
-			requestSession.Subject = "client-" + client.GetID()
+			requestSession.Subject = clientCredentialsSubject(client.GetID())
 		}
+	} else if client, ok := accessRequest.GetClient().(Client); ok && requestSession.Subject != clientCredentialsSubject(client.GetID()) {
+		// Access tokens carry the same subject identifier as the ID token and userinfo
+		requestSession.SetClientSubject(h.claimsService.subjects.Subject(client.OidcClient, requestSession.Subject))
 	}
 
 	response, err := h.provider.NewAccessResponse(ctx, accessRequest)
@@ -73,5 +119,89 @@ func (h *tokenHandler) token(c *gin.Context) {
 		return
 	}
 
+	// Clients that registered an encryption algorithm for ID tokens receive them as nested JWTs
+	if idToken, ok := response.GetExtra("id_token").(string); ok && idToken != "" {
+		encrypted, err := h.encrypter.encryptIDToken(ctx, oidcClientOf(accessRequest.GetClient()), idToken)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to encrypt ID token", "error", err)
+			h.provider.WriteAccessError(ctx, c.Writer, accessRequest, fosite.ErrServerError.WithWrap(err))
+			return
+		}
+		response.SetExtra("id_token", encrypted)
+	}
+
+	if requestSession.DPoPJKT != "" {
+		response.SetTokenType(accessTokenTypeDPoP)
+		h.dpop.setNonceHeader(c.Writer)
+	}
+
+	if accessRequest.GetGrantTypes().ExactOne(GrantTypeTokenExchange) {
+		h.createTokenExchangeAuditLog(c, accessRequest, requestSession)
+	}
+
 	h.provider.WriteAccessResponse(ctx, c.Writer, accessRequest, response)
 }
+
+// createTokenExchangeAuditLog records that a client obtained a token on behalf of the user, either as delegate or by impersonating them
+func (h *tokenHandler) createTokenExchangeAuditLog(c *gin.Context, accessRequest fosite.AccessRequester, session *Session) {
+	client, ok := accessRequest.GetClient().(Client)
+	if h.auditLog == nil || !ok || session.Subject == "" {
+		return
+	}
+
+	form := accessRequest.GetRequestForm()
+	event := model.AuditLogEventTokenExchangeImpersonation
+	data := model.AuditLogData{
+		"clientName":       client.Name,
+		"subjectTokenType": form.Get("subject_token_type"),
+		"audience":         strings.Join(accessRequest.GetGrantedAudience(), " "),
+		"scope":            strings.Join(accessRequest.GetGrantedScopes(), " "),
+	}
+	if form.Get("actor_token") != "" {
+		event = model.AuditLogEventTokenExchangeDelegation
+		if actor, ok := session.Actor["sub"].(string); ok {
+			data["actor"] = actor
+		}
+	}
+
+	meta := requestMetaFromGin(c)
+	h.auditLog.Create(c.Request.Context(), event, meta.IPAddress, meta.UserAgent, session.Subject, data, h.db)
+}
+
+// bindDPoPKey binds the tokens that are issued for the session to the key of the DPoP proof.
+// Tokens that are refreshed stay bound to the key of the original proof.
+func bindDPoPKey(session *Session, client Client, jkt string) error {
+	switch {
+	case session.DPoPJKT != "" && jkt == "":
+		return errInvalidDPoPProof.WithHint("The refresh token is bound to a DPoP key, but the request is missing the DPoP proof.")
+	case session.DPoPJKT != "" && session.DPoPJKT != jkt:
+		return errInvalidDPoPProof.WithHint("The DPoP proof isn't signed with the key the refresh token is bound to.")
+	case jkt == "" && client.RequiresDPoP:
+		return errInvalidDPoPProof.WithHint("The client requires DPoP-bound tokens, but the request is missing the DPoP proof.")
+	}
+
+	session.BindDPoPKey(jkt)
+	return nil
+}
+
+// bindCertificate binds the tokens that are issued for the session to the client certificate of the request, as
+// defined in RFC 8705 section 3. Refresh tokens of public clients stay bound to the certificate of the original
+// request, while confidential clients authenticate themselves and may renew their certificate.
+func bindCertificate(session *Session, client Client, thumbprint string) error {
+	if session.CertificateThumbprint != "" && client.IsPublic() {
+		switch {
+		case thumbprint == "":
+			return fosite.ErrInvalidGrant.WithHint("The refresh token is bound to a client certificate, but the request doesn't carry one.")
+		case thumbprint != session.CertificateThumbprint:
+			return fosite.ErrInvalidGrant.WithHint("The refresh token is bound to another client certificate.")
+		}
+	}
+
+	session.BindCertificate(thumbprint)
+	return nil
+}
+
+// clientCredentialsSubject returns the synthetic subject used for tokens issued with the client credentials grant
+func clientCredentialsSubject(clientID string) string {
+	return "client-" + clientID
+}
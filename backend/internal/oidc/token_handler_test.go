@@ -1,8 +1,10 @@
 package oidc
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -60,7 +62,7 @@ func TestTokenHandlerClientCredentialsGrant(t *testing.T) {
 		Secret:       secret,
 	})
 	require.NoError(t, err)
-	handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil))
+	handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), nil, db)
 
 	form := url.Values{"grant_type": {"client_credentials"}}
 	req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/oidc/token", strings.NewReader(form.Encode()))
@@ -80,6 +82,98 @@ func TestTokenHandlerClientCredentialsGrant(t *testing.T) {
 	require.Contains(t, jwtAudience(claims), clientID, "access token must be audience-bound to the client")
 }
 
+// TestTokenHandlerDPoP drives the nonce challenge of RFC 9449 section 8 and checks that the issued
+// access token is bound to the key of the proof.
+func TestTokenHandlerDPoP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		baseURL     = "https://issuer.example.com"
+		clientID    = "dpop-client"
+		clientPlain = "dpop-secret-value"
+	)
+
+	db := testutils.NewDatabaseForTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(clientPlain), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.OidcClient{
+		Base:         model.Base{ID: clientID},
+		Name:         "DPoP Client",
+		Secret:       string(hashed),
+		RequiresDPoP: true,
+	}).Error)
+
+	provider, err := newProvider(NewStore(db), nil, testTokenSigner{key: key}, Config{
+		BaseURL:      baseURL,
+		TokenBaseURL: baseURL,
+		Secret:       "test-secret",
+	})
+	require.NoError(t, err)
+	handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), nil, db)
+
+	privateKey, publicKey := newDPoPTestKey(t)
+	thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+
+	requestToken := func(t *testing.T, proof string) (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		form := url.Values{"grant_type": {"client_credentials"}}
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/oidc/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientPlain)
+		if proof != "" {
+			req.Header.Set(dpopHeader, proof)
+		}
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+		handler.token(c)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec, body
+	}
+	newProof := func(jti, nonce string) string {
+		return signDPoPTestProof(t, dpopTestProof{
+			typ:        dpopProofType,
+			headerKey:  publicKey,
+			method:     http.MethodPost,
+			url:        baseURL + "/api/oidc/token",
+			issuedAt:   time.Now(),
+			jti:        jti,
+			nonce:      nonce,
+			signingKey: privateKey,
+		})
+	}
+
+	t.Run("client that requires DPoP can't get a bearer token", func(t *testing.T) {
+		rec, body := requestToken(t, "")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, "invalid_dpop_proof", body["error"])
+		require.NotEmpty(t, rec.Header().Get(dpopNonceHeader))
+	})
+
+	t.Run("proof without nonce is challenged, then a bound token is issued", func(t *testing.T) {
+		rec, body := requestToken(t, newProof("jti-without-nonce", ""))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, "use_dpop_nonce", body["error"])
+		nonce := rec.Header().Get(dpopNonceHeader)
+		require.NotEmpty(t, nonce)
+
+		rec, body = requestToken(t, newProof("jti-with-nonce", nonce))
+		require.NotEmpty(t, body["access_token"], "expected an access token, got error: %v", body["error"])
+		require.Equal(t, accessTokenTypeDPoP, body["token_type"])
+		require.NotEmpty(t, rec.Header().Get(dpopNonceHeader))
+
+		claims := decodeJWTPart(t, body["access_token"].(string), 1)
+		require.Equal(t, map[string]any{"jkt": base64.RawURLEncoding.EncodeToString(thumbprint)}, claims["cnf"])
+	})
+}
+
 // jwtAudience normalizes the `aud` claim (string or []string) into a slice.
 func jwtAudience(claims map[string]any) []string {
 	switch aud := claims["aud"].(type) {
@@ -167,7 +261,7 @@ func TestTokenHandlerRefreshGrantRevalidatesUser(t *testing.T) {
 			Secret:       secret,
 		})
 		require.NoError(t, err)
-		handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil))
+		handler := newTokenHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL), nil, db)
 
 		form := url.Values{
 			"grant_type":    {"refresh_token"},
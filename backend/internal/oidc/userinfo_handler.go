@@ -3,6 +3,7 @@ package oidc
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ory/fosite"
@@ -11,12 +12,18 @@ import (
 type userInfoHandler struct {
 	provider      fosite.OAuth2Provider
 	claimsService *ClaimsService
+	dpop          *dpopValidator
+	mtls          *mtlsAuthenticator
+	encrypter     *responseEncrypter
 }
 
-func newUserInfoHandler(provider fosite.OAuth2Provider, claimsService *ClaimsService) *userInfoHandler {
+func newUserInfoHandler(provider fosite.OAuth2Provider, claimsService *ClaimsService, dpop *dpopValidator, mtls *mtlsAuthenticator, encrypter *responseEncrypter) *userInfoHandler {
 	return &userInfoHandler{
 		provider:      provider,
 		claimsService: claimsService,
+		dpop:          dpop,
+		mtls:          mtls,
+		encrypter:     encrypter,
 	}
 }
 
@@ -26,12 +33,14 @@ func newUserInfoHandler(provider fosite.OAuth2Provider, claimsService *ClaimsSer
 // @Tags OIDC
 // @Accept json
 // @Produce json
-// @Success 200 {object} object "User claims based on requested scopes"
+// @Produce jwt
+// @Success 200 {object} object "User claims based on requested scopes, signed and/or encrypted if the client requires it"
 // @Security OAuth2AccessToken
 // @Router /api/oidc/userinfo [get]
 func (h *userInfoHandler) userInfo(c *gin.Context) {
 	ctx := c.Request.Context()
-	tokenType, accessRequest, err := h.provider.IntrospectToken(ctx, fosite.AccessTokenFromRequest(c.Request), fosite.AccessToken, NewEmptySession())
+	accessToken, scheme := accessTokenFromRequest(c.Request)
+	tokenType, accessRequest, err := h.provider.IntrospectToken(ctx, accessToken, fosite.AccessToken, NewEmptySession())
 	if err != nil {
 		writeUserInfoError(c, err)
 		return
@@ -47,17 +56,45 @@ func (h *userInfoHandler) userInfo(c *gin.Context) {
 		return
 	}
 
-	claims, err := h.claimsService.GetUserClaims(ctx, session.GetSubject(), accessRequest.GetGrantedScopes())
+	err = h.dpop.validateTokenBinding(ctx, c.Request, "/api/oidc/userinfo", accessToken, scheme, session)
+	if session.DPoPJKT != "" {
+		h.dpop.setNonceHeader(c.Writer)
+	}
+	if err != nil {
+		writeUserInfoError(c, err)
+		return
+	}
+
+	if err := h.mtls.validateTokenBinding(c.Request, session); err != nil {
+		writeUserInfoError(c, err)
+		return
+	}
+
+	client := oidcClientOf(accessRequest.GetClient())
+	claims, err := h.claimsService.GetUserClaims(ctx, session.GetSubject(), client, accessRequest.GetGrantedScopes())
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, claims)
+	body, contentType, err := h.encrypter.userInfoResponse(ctx, client, claims)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, body)
 }
 
 func writeUserInfoError(c *gin.Context, err error) {
 	rfcErr := fosite.ErrorToRFC6749Error(err)
+	if isDPoPError(rfcErr) {
+		// Resource servers report invalid DPoP proofs with a DPoP challenge, as defined in RFC 9449 section 7.1
+		c.Header("WWW-Authenticate", fmt.Sprintf(`DPoP error="%s", error_description="%s", algs="%s"`, rfcErr.ErrorField, rfcErr.GetDescription(), strings.Join(DPoPSigningAlgorithms, " ")))
+		c.JSON(http.StatusUnauthorized, rfcErr)
+		return
+	}
+
 	if rfcErr.StatusCode() == http.StatusUnauthorized {
 		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s"`, rfcErr.ErrorField, rfcErr.GetDescription()))
 	}
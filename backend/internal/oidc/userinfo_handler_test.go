@@ -53,7 +53,7 @@ func TestUserInfoHandler(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	handler := newUserInfoHandler(provider, newClaimsService(db, nil, baseURL, nil))
+	handler := newUserInfoHandler(provider, newClaimsService(db, nil, baseURL, nil, SubjectResolver{}), newDPoPValidator(NewStore(db), []byte("dpop-nonce-key"), baseURL), provider.mtls, newResponseEncrypter(nil, nil, baseURL))
 
 	issueAccessToken := func(t *testing.T, requestID, subject string, scopes ...string) string {
 		t.Helper()
@@ -0,0 +1,22 @@
+package oidcscope
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+type scopeInputDto struct {
+	Name             string   `json:"name" binding:"required,max=128" unorm:"nfc"`
+	Description      string   `json:"description" binding:"max=255" unorm:"nfc"`
+	ClaimKeys        []string `json:"claimKeys" binding:"dive,min=1"`
+	AllowedClientIDs []string `json:"allowedClientIds" binding:"dive,min=1"`
+}
+
+type scopeDto struct {
+	ID             string                      `json:"id"`
+	Name           string                      `json:"name"`
+	Description    string                      `json:"description"`
+	ClaimKeys      []string                    `json:"claimKeys"`
+	AllowedClients []dto.OidcClientMetaDataDto `json:"allowedClients"`
+	CreatedAt      datatype.DateTime           `json:"createdAt"`
+}
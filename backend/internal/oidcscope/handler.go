@@ -0,0 +1,149 @@
+package oidcscope
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// list godoc
+// @Summary List OAuth scopes
+// @Description Get a paginated list of the admin-defined OAuth scopes
+// @Tags OIDC Scopes
+// @Param search query string false "Search term to filter scopes by name"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[scopeDto]
+// @Router /api/oidc/scopes [get]
+func (h *handler) list(c *gin.Context) {
+	searchTerm := c.Query("search")
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	scopes, pagination, err := h.service.ListScopes(c.Request.Context(), searchTerm, listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var scopesDto []scopeDto
+	if err := dto.MapStructList(scopes, &scopesDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[scopeDto]{
+		Data:       scopesDto,
+		Pagination: pagination,
+	})
+}
+
+// get godoc
+// @Summary Get OAuth scope
+// @Description Get an admin-defined OAuth scope by ID
+// @Tags OIDC Scopes
+// @Param id path string true "Scope ID"
+// @Success 200 {object} scopeDto
+// @Router /api/oidc/scopes/{id} [get]
+func (h *handler) get(c *gin.Context) {
+	scope, err := h.service.GetScope(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto scopeDto
+	if err := dto.MapStruct(scope, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// create godoc
+// @Summary Create OAuth scope
+// @Description Create a scope that releases custom claims to the clients that are allowed to request it
+// @Tags OIDC Scopes
+// @Param scope body scopeInputDto true "Scope information"
+// @Success 201 {object} scopeDto "Created scope"
+// @Router /api/oidc/scopes [post]
+func (h *handler) create(c *gin.Context) {
+	var input scopeInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scope, err := h.service.CreateScope(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto scopeDto
+	if err := dto.MapStruct(scope, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, responseDto)
+}
+
+// update godoc
+// @Summary Update OAuth scope
+// @Description Update an admin-defined OAuth scope by ID
+// @Tags OIDC Scopes
+// @Param id path string true "Scope ID"
+// @Param scope body scopeInputDto true "Scope information"
+// @Success 200 {object} scopeDto "Updated scope"
+// @Router /api/oidc/scopes/{id} [put]
+func (h *handler) update(c *gin.Context) {
+	var input scopeInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scope, err := h.service.UpdateScope(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto scopeDto
+	if err := dto.MapStruct(scope, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// delete godoc
+// @Summary Delete OAuth scope
+// @Description Delete an admin-defined OAuth scope by ID
+// @Tags OIDC Scopes
+// @Param id path string true "Scope ID"
+// @Success 204 "No Content"
+// @Router /api/oidc/scopes/{id} [delete]
+func (h *handler) delete(c *gin.Context) {
+	if err := h.service.DeleteScope(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
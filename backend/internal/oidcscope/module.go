@@ -0,0 +1,41 @@
+package oidcscope
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Dependencies struct {
+	DB *gorm.DB
+}
+
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(deps.DB)
+	return &Module{
+		service: service,
+		handler: newHandler(service),
+	}
+}
+
+// RegisterRoutes mounts the admin endpoints to manage the OAuth scopes that release custom claims
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, adminAuth gin.HandlerFunc) {
+	group := apiGroup.Group("/oidc/scopes", adminAuth)
+	group.GET("", m.handler.list)
+	group.POST("", m.handler.create)
+	group.GET("/:id", m.handler.get)
+	group.PUT("/:id", m.handler.update)
+	group.DELETE("/:id", m.handler.delete)
+}
+
+// ListScopeNames returns the names of all admin-defined scopes
+// It is used to advertise the scopes in the discovery document
+func (m *Module) ListScopeNames(ctx context.Context) ([]string, error) {
+	return m.service.ListScopeNames(ctx)
+}
@@ -0,0 +1,153 @@
+package oidcscope
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// scopeNameRegex matches a scope-token as defined in RFC 6749 section 3.3
+var scopeNameRegex = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// Service holds the business logic for managing admin-defined OAuth scopes
+type Service struct {
+	db *gorm.DB
+}
+
+func newService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) ListScopes(ctx context.Context, name string, listRequestOptions utils.ListRequestOptions) ([]model.OidcScope, utils.PaginationResponse, error) {
+	query := s.db.
+		WithContext(ctx).
+		Preload("AllowedClients").
+		Model(&model.OidcScope{})
+
+	if name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+
+	var scopes []model.OidcScope
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &scopes)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return scopes, pagination, nil
+}
+
+func (s *Service) GetScope(ctx context.Context, id string) (model.OidcScope, error) {
+	var scope model.OidcScope
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedClients").
+		First(&scope, "id = ?", id).
+		Error
+	return scope, err
+}
+
+func (s *Service) CreateScope(ctx context.Context, input scopeInputDto) (model.OidcScope, error) {
+	var scope model.OidcScope
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.saveScope(tx, &scope, input)
+	})
+	if err != nil {
+		return model.OidcScope{}, err
+	}
+
+	return scope, nil
+}
+
+func (s *Service) UpdateScope(ctx context.Context, id string, input scopeInputDto) (model.OidcScope, error) {
+	var scope model.OidcScope
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&scope, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		return s.saveScope(tx, &scope, input)
+	})
+	if err != nil {
+		return model.OidcScope{}, err
+	}
+
+	return scope, nil
+}
+
+func (s *Service) DeleteScope(ctx context.Context, id string) error {
+	result := s.db.
+		WithContext(ctx).
+		Delete(&model.OidcScope{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) ListScopeNames(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.db.
+		WithContext(ctx).
+		Model(&model.OidcScope{}).
+		Order("name").
+		Pluck("name", &names).
+		Error
+	return names, err
+}
+
+// saveScope validates the input, then creates or updates the scope and replaces its allowed clients
+func (s *Service) saveScope(tx *gorm.DB, scope *model.OidcScope, input scopeInputDto) error {
+	if !scopeNameRegex.MatchString(input.Name) {
+		return &common.ValidationError{Message: "scope name must not contain spaces, quotes or backslashes"}
+	}
+	if slices.Contains(common.StandardScopes, input.Name) {
+		return &common.ValidationError{Message: "scope name " + input.Name + " is reserved for a standard scope"}
+	}
+
+	clients := []model.OidcClient{}
+	if len(input.AllowedClientIDs) > 0 {
+		err := tx.Where("id IN ?", input.AllowedClientIDs).Find(&clients).Error
+		if err != nil {
+			return err
+		}
+		if len(clients) != len(slices.Compact(slices.Sorted(slices.Values(input.AllowedClientIDs)))) {
+			return &common.ValidationError{Message: "one or more allowed clients do not exist"}
+		}
+	}
+
+	scope.Name = input.Name
+	scope.Description = input.Description
+	scope.ClaimKeys = input.ClaimKeys
+	if scope.ClaimKeys == nil {
+		scope.ClaimKeys = []string{}
+	}
+
+	err := tx.Omit("AllowedClients").Save(scope).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &common.AlreadyInUseError{Property: "Scope name"}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(scope).Association("AllowedClients").Replace(clients)
+	if err != nil {
+		return err
+	}
+	scope.AllowedClients = clients
+
+	return nil
+}
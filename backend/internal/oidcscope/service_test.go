@@ -0,0 +1,78 @@
+package oidcscope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestServiceSaveScope(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newService(db)
+
+	for _, id := range []string{"nextcloud", "grafana"} {
+		require.NoError(t, db.Create(&model.OidcClient{Base: model.Base{ID: id}, Name: id}).Error)
+	}
+
+	scope, err := service.CreateScope(t.Context(), scopeInputDto{
+		Name:             "billing:read",
+		Description:      "Read your billing information",
+		ClaimKeys:        []string{"billing_plan"},
+		AllowedClientIDs: []string{"nextcloud", "grafana"},
+	})
+	require.NoError(t, err)
+	require.Len(t, scope.AllowedClients, 2)
+
+	t.Run("update replaces the allowed clients", func(t *testing.T) {
+		updated, err := service.UpdateScope(t.Context(), scope.ID, scopeInputDto{
+			Name:             "billing:read",
+			ClaimKeys:        []string{"billing_plan", "billing_id"},
+			AllowedClientIDs: []string{"grafana"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"billing_plan", "billing_id"}, []string(updated.ClaimKeys))
+
+		loaded, err := service.GetScope(t.Context(), scope.ID)
+		require.NoError(t, err)
+		require.Len(t, loaded.AllowedClients, 1)
+		require.Equal(t, "grafana", loaded.AllowedClients[0].ID)
+	})
+
+	t.Run("duplicate name is rejected", func(t *testing.T) {
+		_, err := service.CreateScope(t.Context(), scopeInputDto{Name: "billing:read"})
+		require.ErrorIs(t, err, &common.AlreadyInUseError{})
+	})
+
+	t.Run("standard scope name is rejected", func(t *testing.T) {
+		_, err := service.CreateScope(t.Context(), scopeInputDto{Name: "profile"})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("name with a space is rejected", func(t *testing.T) {
+		_, err := service.CreateScope(t.Context(), scopeInputDto{Name: "billing read"})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("unknown client is rejected", func(t *testing.T) {
+		_, err := service.CreateScope(t.Context(), scopeInputDto{Name: "wiki", AllowedClientIDs: []string{"unknown"}})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("delete removes the scope", func(t *testing.T) {
+		require.NoError(t, service.DeleteScope(t.Context(), scope.ID))
+
+		names, err := service.ListScopeNames(t.Context())
+		require.NoError(t, err)
+		require.Empty(t, names)
+
+		require.ErrorIs(t, service.DeleteScope(t.Context(), scope.ID), gorm.ErrRecordNotFound)
+	})
+}
@@ -0,0 +1,44 @@
+package saml
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+type attributeMappingDto struct {
+	Name   string `json:"name" binding:"required,max=256"`
+	Source string `json:"source" binding:"required,max=256"`
+}
+
+type serviceProviderInputDto struct {
+	Name                string                `json:"name" binding:"required,max=128" unorm:"nfc"`
+	Metadata            string                `json:"metadata" binding:"required,max=1048576"`
+	NameIDFormat        string                `json:"nameIdFormat"`
+	SignResponse        bool                  `json:"signResponse"`
+	AttributeMapping    []attributeMappingDto `json:"attributeMapping" binding:"dive"`
+	IsGroupRestricted   bool                  `json:"isGroupRestricted"`
+	AllowedUserGroupIDs []string              `json:"allowedUserGroupIds" binding:"dive,min=1"`
+}
+
+type serviceProviderDto struct {
+	ID                        string                    `json:"id"`
+	Name                      string                    `json:"name"`
+	EntityID                  string                    `json:"entityId"`
+	Metadata                  string                    `json:"metadata"`
+	AssertionConsumerServices Endpoints                 `json:"assertionConsumerServices"`
+	SingleLogoutServices      Endpoints                 `json:"singleLogoutServices"`
+	NameIDFormat              string                    `json:"nameIdFormat"`
+	AuthnRequestsSigned       bool                      `json:"authnRequestsSigned"`
+	SignResponse              bool                      `json:"signResponse"`
+	AttributeMapping          AttributeMapping          `json:"attributeMapping"`
+	IsGroupRestricted         bool                      `json:"isGroupRestricted"`
+	AllowedUserGroups         []dto.UserGroupMinimalDto `json:"allowedUserGroups"`
+	CreatedAt                 datatype.DateTime         `json:"createdAt"`
+}
+
+type identityProviderDto struct {
+	EntityID    string `json:"entityId"`
+	MetadataURL string `json:"metadataUrl"`
+	SSOURL      string `json:"ssoUrl"`
+	SLOURL      string `json:"sloUrl"`
+}
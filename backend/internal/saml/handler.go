@@ -0,0 +1,398 @@
+package saml
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+	"github.com/pocket-id/pocket-id/backend/internal/utils/cookie"
+)
+
+// resubmittedParameter marks a logout request that the identity provider posted back to itself
+const resubmittedParameter = "pocket_id_resubmitted"
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// metadata godoc
+// @Summary Get identity provider metadata
+// @Description Get the SAML metadata of Pocket ID as identity provider, which service providers are configured with
+// @Tags SAML
+// @Produce xml
+// @Success 200 {string} string "SAML metadata"
+// @Router /api/saml/metadata [get]
+func (h *handler) metadata(c *gin.Context) {
+	metadata, err := h.service.Metadata(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// singleSignOn handles an AuthnRequest that a service provider sent with the HTTP-Redirect or HTTP-POST binding
+func (h *handler) singleSignOn(c *gin.Context) {
+	message, err := bindInboundMessage(c, "SAMLRequest")
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	request, err := h.service.parseAuthnRequest(c.Request.Context(), message)
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	if c.GetString("userID") == "" {
+		// The browser doesn't send the session cookie with cross-site POST requests, so the request is stored and resumed
+		// with a GET request, which signs the user in first if necessary
+		pendingID, err := h.service.storePendingRequest(c.Request.Context(), request)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/api/saml/sso/resume/"+url.PathEscape(pendingID))
+		return
+	}
+
+	h.respond(c, request)
+}
+
+// resumeSingleSignOn continues the sign in to a service provider after the user signed in
+func (h *handler) resumeSingleSignOn(c *gin.Context) {
+	if c.GetString("userID") == "" {
+		request, err := h.service.peekPendingRequest(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			h.redirectToErrorPage(c, err)
+			return
+		}
+		if request.IsPassive {
+			h.consumeAndRespondNoPassive(c)
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/login?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+
+	request, err := h.service.consumePendingRequest(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	h.respond(c, request)
+}
+
+// consumeAndRespondNoPassive tells the service provider that the user isn't signed in for a passive request
+func (h *handler) consumeAndRespondNoPassive(c *gin.Context) {
+	request, err := h.service.consumePendingRequest(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	response, err := h.service.noPassiveResponse(c.Request.Context(), request)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	h.deliver(c, response)
+}
+
+// idpInitiatedSingleSignOn godoc
+// @Summary Sign in to a service provider
+// @Description Sign the user in to a SAML service provider without a request from it (IdP-initiated SSO)
+// @Tags SAML
+// @Param id path string true "Service provider ID"
+// @Param RelayState query string false "Relay state to pass to the service provider, e.g. the page to open"
+// @Success 200 "Auto-submitting form that posts the response to the service provider"
+// @Router /api/saml/service-providers/{id}/sso [get]
+func (h *handler) idpInitiatedSingleSignOn(c *gin.Context) {
+	if c.GetString("userID") == "" {
+		c.Redirect(http.StatusFound, "/login?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+
+	request, err := h.service.idpInitiatedRequest(c.Request.Context(), c.Param("id"), c.Query("RelayState"))
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	h.respond(c, request)
+}
+
+// singleLogout handles a LogoutRequest that a service provider sent with the HTTP-Redirect or HTTP-POST binding
+func (h *handler) singleLogout(c *gin.Context) {
+	message, err := bindInboundMessage(c, "SAMLRequest")
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	if c.Request.Method == http.MethodPost && c.GetString("userID") == "" && c.PostForm(resubmittedParameter) == "" {
+		// The browser doesn't send the session cookie with cross-site POST requests, so the request is posted again
+		// from the identity provider's own origin to find out which user to sign out
+		h.renderPostForm(c, h.service.sloURL(), map[string]string{
+			"SAMLRequest":        message.Message,
+			"RelayState":         message.RelayState,
+			resubmittedParameter: "true",
+		})
+		return
+	}
+
+	response, signedOut, err := h.service.logout(c.Request.Context(), message, c.GetString("userID"), c.GetString("sessionID"))
+	if err != nil {
+		h.redirectToErrorPage(c, err)
+		return
+	}
+
+	if signedOut {
+		cookie.AddAccessTokenCookie(c, 0, "")
+	}
+	h.deliver(c, response)
+}
+
+// identityProvider godoc
+// @Summary Get identity provider details
+// @Description Get the entity ID and endpoints of Pocket ID as SAML identity provider
+// @Tags SAML
+// @Success 200 {object} identityProviderDto
+// @Router /api/saml/identity-provider [get]
+func (h *handler) identityProvider(c *gin.Context) {
+	c.JSON(http.StatusOK, identityProviderDto{
+		EntityID:    h.service.EntityID(),
+		MetadataURL: h.service.EntityID(),
+		SSOURL:      h.service.ssoURL(),
+		SLOURL:      h.service.sloURL(),
+	})
+}
+
+// list godoc
+// @Summary List SAML service providers
+// @Description Get a paginated list of the SAML service providers users can sign in to
+// @Tags SAML
+// @Param search query string false "Search term to filter service providers by name or entity ID"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[serviceProviderDto]
+// @Router /api/saml/service-providers [get]
+func (h *handler) list(c *gin.Context) {
+	searchTerm := c.Query("search")
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	serviceProviders, pagination, err := h.service.ListServiceProviders(c.Request.Context(), searchTerm, listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var serviceProvidersDto []serviceProviderDto
+	if err := dto.MapStructList(serviceProviders, &serviceProvidersDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[serviceProviderDto]{
+		Data:       serviceProvidersDto,
+		Pagination: pagination,
+	})
+}
+
+// get godoc
+// @Summary Get SAML service provider
+// @Description Get a SAML service provider by ID
+// @Tags SAML
+// @Param id path string true "Service provider ID"
+// @Success 200 {object} serviceProviderDto
+// @Router /api/saml/service-providers/{id} [get]
+func (h *handler) get(c *gin.Context) {
+	serviceProvider, err := h.service.GetServiceProvider(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto serviceProviderDto
+	if err := dto.MapStruct(serviceProvider, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// create godoc
+// @Summary Create SAML service provider
+// @Description Register a SAML service provider from its metadata
+// @Tags SAML
+// @Param serviceProvider body serviceProviderInputDto true "Service provider information"
+// @Success 201 {object} serviceProviderDto "Created service provider"
+// @Router /api/saml/service-providers [post]
+func (h *handler) create(c *gin.Context) {
+	var input serviceProviderInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	serviceProvider, err := h.service.CreateServiceProvider(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto serviceProviderDto
+	if err := dto.MapStruct(serviceProvider, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, responseDto)
+}
+
+// update godoc
+// @Summary Update SAML service provider
+// @Description Update a SAML service provider by ID, re-importing its metadata
+// @Tags SAML
+// @Param id path string true "Service provider ID"
+// @Param serviceProvider body serviceProviderInputDto true "Service provider information"
+// @Success 200 {object} serviceProviderDto "Updated service provider"
+// @Router /api/saml/service-providers/{id} [put]
+func (h *handler) update(c *gin.Context) {
+	var input serviceProviderInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	serviceProvider, err := h.service.UpdateServiceProvider(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto serviceProviderDto
+	if err := dto.MapStruct(serviceProvider, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// delete godoc
+// @Summary Delete SAML service provider
+// @Description Delete a SAML service provider by ID
+// @Tags SAML
+// @Param id path string true "Service provider ID"
+// @Success 204 "No Content"
+// @Router /api/saml/service-providers/{id} [delete]
+func (h *handler) delete(c *gin.Context) {
+	if err := h.service.DeleteServiceProvider(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respond signs the user in to the service provider of the request and delivers the response
+func (h *handler) respond(c *gin.Context, request ssoRequest) {
+	response, err := h.service.issueResponse(c.Request.Context(), request, signIn{
+		UserID:             c.GetString("userID"),
+		AuthenticationTime: c.GetTime("authenticationTime"),
+		IPAddress:          c.ClientIP(),
+		UserAgent:          c.Request.UserAgent(),
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.deliver(c, response)
+}
+
+// deliver sends a message to an endpoint of a service provider through the browser
+func (h *handler) deliver(c *gin.Context, message outboundMessage) {
+	if message.Binding == bindingHTTPRedirect {
+		c.Redirect(http.StatusFound, message.URL)
+		return
+	}
+
+	parameters := map[string]string{message.Parameter: message.Message}
+	if message.RelayState != "" {
+		parameters["RelayState"] = message.RelayState
+	}
+	h.renderPostForm(c, message.URL, parameters)
+}
+
+// renderPostForm renders the page that posts the parameters to the URL
+// Only this page may post a form to the URL, as the Content-Security-Policy otherwise restricts form targets to Pocket ID
+func (h *handler) renderPostForm(c *gin.Context, target string, parameters map[string]string) {
+	c.Header("Content-Security-Policy", utils.BuildFormPostCSP(utils.GetCSPNonce(c), target, postFormScriptCSPHash))
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	err := postFormTemplate.Execute(c.Writer, postFormPage{URL: target, Parameters: parameters})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to render SAML POST form", slog.Any("error", err))
+	}
+}
+
+// redirectToErrorPage shows the error to the user, which is necessary when it can't be sent to the service provider
+func (h *handler) redirectToErrorPage(c *gin.Context, err error) {
+	validationErr, ok := errors.AsType[*common.ValidationError](err)
+	if !ok {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/interaction/error?error="+url.QueryEscape(validationErr.Message))
+}
+
+// bindInboundMessage reads a message sent with the HTTP-Redirect (GET) or HTTP-POST (POST) binding
+func bindInboundMessage(c *gin.Context, parameter string) (inboundMessage, error) {
+	var message inboundMessage
+	switch c.Request.Method {
+	case http.MethodGet:
+		var err error
+		message, err = parseRedirectMessage(c.Request.URL.RawQuery, parameter)
+		if err != nil {
+			return inboundMessage{}, &common.ValidationError{Message: err.Error()}
+		}
+	case http.MethodPost:
+		for _, name := range []string{parameter, "RelayState"} {
+			if len(c.PostFormArray(name)) > 1 {
+				return inboundMessage{}, &common.ValidationError{Message: "the " + name + " parameter must not appear more than once"}
+			}
+		}
+		message = inboundMessage{
+			Binding:    bindingHTTPPost,
+			Message:    c.PostForm(parameter),
+			RelayState: c.PostForm("RelayState"),
+		}
+	}
+
+	if message.Message == "" {
+		return inboundMessage{}, &common.ValidationError{Message: "the request has no " + parameter}
+	}
+	return message, nil
+}
@@ -0,0 +1,171 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+)
+
+// serviceProviderMetadata is what the identity provider uses from the metadata of a service provider
+type serviceProviderMetadata struct {
+	EntityID                  string
+	AssertionConsumerServices Endpoints
+	SingleLogoutServices      Endpoints
+	SigningCertificates       []string
+	NameIDFormats             []string
+	AuthnRequestsSigned       bool
+}
+
+// parseServiceProviderMetadata parses the metadata of a service provider (SAML metadata section 2.4.4)
+// The metadata may be an EntityDescriptor or an EntitiesDescriptor with exactly one service provider
+func parseServiceProviderMetadata(data []byte) (serviceProviderMetadata, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata is not a valid XML document"}
+	}
+
+	var descriptors []*xmlElement
+	switch {
+	case root.is(metadataNamespace, "EntityDescriptor"):
+		descriptors = []*xmlElement{root}
+	case root.is(metadataNamespace, "EntitiesDescriptor"):
+		descriptors = root.childElements(metadataNamespace, "EntityDescriptor")
+	default:
+		return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata must be an EntityDescriptor"}
+	}
+	descriptors = slices.DeleteFunc(descriptors, func(e *xmlElement) bool {
+		return e.childElement(metadataNamespace, "SPSSODescriptor") == nil
+	})
+	if len(descriptors) != 1 {
+		return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata must describe exactly one service provider"}
+	}
+
+	entity := descriptors[0]
+	descriptor := entity.childElement(metadataNamespace, "SPSSODescriptor")
+	metadata := serviceProviderMetadata{
+		EntityID:            entity.attr("entityID"),
+		AuthnRequestsSigned: descriptor.attr("AuthnRequestsSigned") == "true" || descriptor.attr("AuthnRequestsSigned") == "1",
+	}
+	if metadata.EntityID == "" {
+		return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata has no entityID"}
+	}
+
+	for _, acs := range descriptor.childElements(metadataNamespace, "AssertionConsumerService") {
+		// Responses are always delivered with the HTTP-POST binding
+		if acs.attr("Binding") != bindingHTTPPost || acs.attr("Location") == "" {
+			continue
+		}
+		index, _ := strconv.Atoi(acs.attr("index"))
+		metadata.AssertionConsumerServices = append(metadata.AssertionConsumerServices, Endpoint{
+			Binding:   bindingHTTPPost,
+			Location:  acs.attr("Location"),
+			Index:     index,
+			IsDefault: acs.attr("isDefault") == "true" || acs.attr("isDefault") == "1",
+		})
+	}
+	if len(metadata.AssertionConsumerServices) == 0 {
+		return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata has no assertion consumer service with the HTTP-POST binding"}
+	}
+
+	metadata.SingleLogoutServices = Endpoints{}
+	for _, slo := range descriptor.childElements(metadataNamespace, "SingleLogoutService") {
+		binding := slo.attr("Binding")
+		if (binding != bindingHTTPPost && binding != bindingHTTPRedirect) || slo.attr("Location") == "" {
+			continue
+		}
+		metadata.SingleLogoutServices = append(metadata.SingleLogoutServices, Endpoint{
+			Binding:          binding,
+			Location:         slo.attr("Location"),
+			ResponseLocation: slo.attr("ResponseLocation"),
+		})
+	}
+
+	metadata.SigningCertificates = []string{}
+	for _, keyDescriptor := range descriptor.childElements(metadataNamespace, "KeyDescriptor") {
+		if use := keyDescriptor.attr("use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := keyDescriptor.childElement(dsNamespace, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, x509Data := range keyInfo.childElements(dsNamespace, "X509Data") {
+			for _, certificate := range x509Data.childElements(dsNamespace, "X509Certificate") {
+				der, err := decodeBase64(certificate.text())
+				if err != nil {
+					return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata contains an invalid signing certificate"}
+				}
+				if _, err := x509.ParseCertificate(der); err != nil {
+					return serviceProviderMetadata{}, &common.ValidationError{Message: "metadata contains an invalid signing certificate"}
+				}
+				metadata.SigningCertificates = append(metadata.SigningCertificates, base64.StdEncoding.EncodeToString(der))
+			}
+		}
+	}
+
+	for _, format := range descriptor.childElements(metadataNamespace, "NameIDFormat") {
+		metadata.NameIDFormats = append(metadata.NameIDFormats, format.text())
+	}
+
+	return metadata, nil
+}
+
+// parseCertificates parses the base64-encoded DER signing certificates of a service provider
+func parseCertificates(encoded []string) ([]*x509.Certificate, error) {
+	certificates := make([]*x509.Certificate, 0, len(encoded))
+	for _, c := range encoded {
+		der, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("service provider has no signing certificate")
+	}
+	return certificates, nil
+}
+
+// identityProviderMetadata builds the metadata of the identity provider (SAML metadata section 2.4.3)
+// Every certificate gets its own signing KeyDescriptor, so service providers accept signatures of each of the keys
+func identityProviderMetadata(entityID, ssoURL, sloURL string, certificates [][]byte) *xmlElement {
+	entity := newElement("md", "EntityDescriptor").
+		declareNamespace("md", metadataNamespace).
+		setAttr("entityID", entityID)
+
+	descriptor := entity.appendChild(newElement("md", "IDPSSODescriptor")).
+		setAttr("protocolSupportEnumeration", protocolNamespace).
+		setAttr("WantAuthnRequestsSigned", "false")
+
+	for _, certificate := range certificates {
+		keyDescriptor := descriptor.appendChild(newElement("md", "KeyDescriptor")).setAttr("use", "signing")
+		keyDescriptor.appendChild(newElement("ds", "KeyInfo").declareNamespace("ds", dsNamespace)).
+			appendChild(newElement("ds", "X509Data")).
+			appendChild(newElement("ds", "X509Certificate")).
+			appendText(base64.StdEncoding.EncodeToString(certificate))
+	}
+
+	for _, binding := range []string{bindingHTTPRedirect, bindingHTTPPost} {
+		descriptor.appendChild(newElement("md", "SingleLogoutService")).
+			setAttr("Binding", binding).
+			setAttr("Location", sloURL)
+	}
+	for _, format := range supportedNameIDFormats {
+		descriptor.appendChild(newElement("md", "NameIDFormat")).appendText(format)
+	}
+	for _, binding := range []string{bindingHTTPRedirect, bindingHTTPPost} {
+		descriptor.appendChild(newElement("md", "SingleSignOnService")).
+			setAttr("Binding", binding).
+			setAttr("Location", ssoURL)
+	}
+
+	return entity
+}
@@ -0,0 +1,110 @@
+package saml
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+// ServiceProvider is a SAML service provider users can sign in to, registered from its metadata
+type ServiceProvider struct {
+	model.Base
+
+	Name     string `sortable:"true"`
+	EntityID string `sortable:"true"`
+	// Metadata is the metadata document the service provider was registered from
+	Metadata                  string
+	AssertionConsumerServices Endpoints
+	SingleLogoutServices      Endpoints
+	// SigningCertificates are the base64-encoded DER certificates the service provider signs its messages with
+	SigningCertificates datatype.StringList
+	NameIDFormat        string
+	AuthnRequestsSigned bool
+	// SignResponse signs the whole response in addition to the assertion
+	SignResponse      bool
+	AttributeMapping  AttributeMapping
+	IsGroupRestricted bool `sortable:"true" filterable:"true"`
+
+	AllowedUserGroups []model.UserGroup `gorm:"many2many:saml_service_providers_allowed_user_groups;joinForeignKey:SamlServiceProviderID;joinReferences:UserGroupID"`
+}
+
+func (ServiceProvider) TableName() string {
+	return "saml_service_providers"
+}
+
+// Endpoint is an endpoint of a service provider from its metadata
+type Endpoint struct {
+	Binding  string `json:"binding"`
+	Location string `json:"location"`
+	// ResponseLocation is where responses to requests sent to Location are delivered, if it differs from Location
+	ResponseLocation string `json:"responseLocation,omitempty"`
+	Index            int    `json:"index,omitempty"`
+	IsDefault        bool   `json:"isDefault,omitempty"`
+}
+
+type Endpoints []Endpoint //nolint:recvcheck
+
+func (e *Endpoints) Scan(value any) error {
+	return utils.UnmarshalJSONFromDatabase(e, value)
+}
+
+func (e Endpoints) Value() (driver.Value, error) {
+	return json.Marshal(e)
+}
+
+// AttributeMappingEntry releases the value of a user field, the user's groups or a custom claim as an attribute
+type AttributeMappingEntry struct {
+	// Name is the name of the attribute in the assertion
+	Name string `json:"name"`
+	// Source is one of the attributeSources, or "custom:" followed by the key of a custom claim
+	Source string `json:"source"`
+}
+
+type AttributeMapping []AttributeMappingEntry //nolint:recvcheck
+
+func (m *AttributeMapping) Scan(value any) error {
+	return utils.UnmarshalJSONFromDatabase(m, value)
+}
+
+func (m AttributeMapping) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// PendingAuthnRequest is an authentication request of a service provider that waits for the user to sign in
+type PendingAuthnRequest struct {
+	model.Base
+
+	RequestID                   string
+	AssertionConsumerServiceURL string
+	RelayState                  string
+	NameIDFormat                string
+	IsPassive                   bool
+	ExpiresAt                   datatype.DateTime
+
+	ServiceProviderID string
+	ServiceProvider   ServiceProvider
+}
+
+func (PendingAuthnRequest) TableName() string {
+	return "saml_authn_requests"
+}
+
+// Session is a session of a user with a service provider, which is ended by single logout
+// Its ID is the SessionIndex of the assertion that started it
+type Session struct {
+	model.Base
+
+	NameID       string
+	NameIDFormat string
+	ExpiresAt    datatype.DateTime
+
+	ServiceProviderID string
+	UserID            string
+}
+
+func (Session) TableName() string {
+	return "saml_sessions"
+}
@@ -0,0 +1,83 @@
+package saml
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// Signer provides the key the identity provider signs assertions and messages with, which is the same key that signs tokens
+// The certificates of the next and retained keys are published in the metadata too, so service providers can trust a
+// new key before it's used and still verify messages signed with the previous one after a rotation
+type Signer interface {
+	// GetSigningKey returns the active private key with its key ID, which are read together so they can't belong to
+	// different keys while the keys are rotated
+	GetSigningKey() (privateKey any, keyID string, alg jwa.KeyAlgorithm, err error)
+	GetPublishedPrivateKeys() map[string]any
+}
+
+type CustomClaimSource interface {
+	GetCustomClaimsForUserWithUserGroups(ctx context.Context, userID string, tx *gorm.DB) ([]model.CustomClaim, error)
+}
+
+// SessionManager ends the browser session of a user that signs out of a service provider with single logout
+type SessionManager interface {
+	Logout(ctx context.Context, userID, sessionID string) error
+}
+
+type AuditLogger interface {
+	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
+}
+
+type AppConfigProvider interface {
+	GetDbConfig() *model.AppConfig
+}
+
+type Dependencies struct {
+	DB     *gorm.DB
+	AppURL string
+
+	Signer       Signer
+	CustomClaims CustomClaimSource
+	Sessions     SessionManager
+	AuditLog     AuditLogger
+	AppConfig    AppConfigProvider
+}
+
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(deps)
+	return &Module{
+		service: service,
+		handler: newHandler(service),
+	}
+}
+
+// RegisterRoutes mounts the SAML identity provider endpoints and the admin endpoints to manage the service providers
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, optionalBrowserAuth, adminAuth gin.HandlerFunc) {
+	apiGroup.GET("/saml/metadata", m.handler.metadata)
+
+	apiGroup.GET("/saml/sso", optionalBrowserAuth, m.handler.singleSignOn)
+	apiGroup.POST("/saml/sso", optionalBrowserAuth, m.handler.singleSignOn)
+	apiGroup.GET("/saml/sso/resume/:id", optionalBrowserAuth, m.handler.resumeSingleSignOn)
+
+	apiGroup.GET("/saml/slo", optionalBrowserAuth, m.handler.singleLogout)
+	apiGroup.POST("/saml/slo", optionalBrowserAuth, m.handler.singleLogout)
+
+	apiGroup.GET("/saml/identity-provider", adminAuth, m.handler.identityProvider)
+
+	apiGroup.GET("/saml/service-providers", adminAuth, m.handler.list)
+	apiGroup.POST("/saml/service-providers", adminAuth, m.handler.create)
+	apiGroup.GET("/saml/service-providers/:id", adminAuth, m.handler.get)
+	apiGroup.PUT("/saml/service-providers/:id", adminAuth, m.handler.update)
+	apiGroup.DELETE("/saml/service-providers/:id", adminAuth, m.handler.delete)
+	apiGroup.GET("/saml/service-providers/:id/sso", optionalBrowserAuth, m.handler.idpInitiatedSingleSignOn)
+}
@@ -0,0 +1,277 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	xmlNamespace       = "http://www.w3.org/XML/1998/namespace"
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	nameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	nameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	nameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+	nameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	statusSuccess             = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	statusRequester           = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	statusResponder           = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	statusRequestDenied       = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+	statusInvalidNameIDPolicy = "urn:oasis:names:tc:SAML:2.0:status:InvalidNameIDPolicy"
+	statusNoPassive           = "urn:oasis:names:tc:SAML:2.0:status:NoPassive"
+
+	attributeNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	confirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	authnContextUnspecified  = "urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified"
+)
+
+// supportedNameIDFormats are the NameID formats the identity provider can issue
+var supportedNameIDFormats = []string{
+	nameIDFormatPersistent,
+	nameIDFormatTransient,
+	nameIDFormatEmailAddress,
+	nameIDFormatUnspecified,
+}
+
+// maxMessageSize limits the size of inflated messages received with the HTTP-Redirect binding
+const maxMessageSize = 256 * 1024
+
+// inboundMessage is a SAML protocol message as it was received from the browser
+type inboundMessage struct {
+	Binding    string
+	Message    string
+	RelayState string
+	// Parameters are the parameters of an HTTP-Redirect binding request as they were encoded by the sender, which its
+	// signature is computed over
+	Parameters redirectParameters
+}
+
+// redirectBindingParameters are the parameters of the HTTP-Redirect binding (SAML bindings section 3.4.4)
+var redirectBindingParameters = []string{"SAMLRequest", "SAMLResponse", "RelayState", "SigAlg", "Signature"}
+
+// redirectParameters are the raw values of the HTTP-Redirect binding parameters of a query string, by parameter name
+type redirectParameters map[string]string
+
+// parseRedirectMessage reads a message sent with the HTTP-Redirect binding from the raw query string
+// The message is decoded from the same raw values its signature is verified against, and parameters that appear more
+// than once are rejected, so a signed query can't be combined with a different message
+func parseRedirectMessage(rawQuery, parameter string) (inboundMessage, error) {
+	parameters := redirectParameters{}
+	for part := range strings.SplitSeq(rawQuery, "&") {
+		rawKey, value, _ := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return inboundMessage{}, fmt.Errorf("invalid query parameter: %w", err)
+		}
+		if !slices.Contains(redirectBindingParameters, key) {
+			continue
+		}
+		if _, ok := parameters[key]; ok {
+			return inboundMessage{}, fmt.Errorf("the %s parameter must not appear more than once", key)
+		}
+		parameters[key] = value
+	}
+
+	message, err := url.QueryUnescape(parameters[parameter])
+	if err != nil {
+		return inboundMessage{}, fmt.Errorf("invalid %s: %w", parameter, err)
+	}
+	relayState, err := url.QueryUnescape(parameters["RelayState"])
+	if err != nil {
+		return inboundMessage{}, fmt.Errorf("invalid RelayState: %w", err)
+	}
+
+	return inboundMessage{
+		Binding:    bindingHTTPRedirect,
+		Message:    message,
+		RelayState: relayState,
+		Parameters: parameters,
+	}, nil
+}
+
+// decode returns the XML of the message, which is deflated for the HTTP-Redirect binding
+func (m inboundMessage) decode() ([]byte, error) {
+	data, err := decodeBase64(m.Message)
+	if err != nil {
+		return nil, fmt.Errorf("message isn't valid base64: %w", err)
+	}
+	if m.Binding != bindingHTTPRedirect {
+		return data, nil
+	}
+
+	inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("message isn't valid DEFLATE: %w", err)
+	}
+	if len(inflated) > maxMessageSize {
+		return nil, errors.New("message is too large")
+	}
+	return inflated, nil
+}
+
+// authnRequest is the part of an AuthnRequest (SAML core section 3.4.1) the identity provider uses
+type authnRequest struct {
+	ID                            string
+	Issuer                        string
+	Destination                   string
+	AssertionConsumerServiceURL   string
+	AssertionConsumerServiceIndex *int
+	ProtocolBinding               string
+	NameIDFormat                  string
+	IsPassive                     bool
+}
+
+func parseAuthnRequest(root *xmlElement) (authnRequest, error) {
+	if !root.is(protocolNamespace, "AuthnRequest") {
+		return authnRequest{}, errors.New("message is not an AuthnRequest")
+	}
+	if err := checkRequestAbstractType(root); err != nil {
+		return authnRequest{}, err
+	}
+
+	request := authnRequest{
+		ID:                          root.attr("ID"),
+		Issuer:                      issuerOf(root),
+		Destination:                 root.attr("Destination"),
+		AssertionConsumerServiceURL: root.attr("AssertionConsumerServiceURL"),
+		ProtocolBinding:             root.attr("ProtocolBinding"),
+		IsPassive:                   root.attr("IsPassive") == "true" || root.attr("IsPassive") == "1",
+	}
+	if index := root.attr("AssertionConsumerServiceIndex"); index != "" {
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			return authnRequest{}, errors.New("invalid AssertionConsumerServiceIndex")
+		}
+		request.AssertionConsumerServiceIndex = &i
+	}
+	if policy := root.childElement(protocolNamespace, "NameIDPolicy"); policy != nil {
+		request.NameIDFormat = policy.attr("Format")
+	}
+
+	return request, nil
+}
+
+// logoutRequest is the part of a LogoutRequest (SAML core section 3.7.1) the identity provider uses
+type logoutRequest struct {
+	ID             string
+	Issuer         string
+	Destination    string
+	NameID         string
+	SessionIndexes []string
+}
+
+func parseLogoutRequest(root *xmlElement) (logoutRequest, error) {
+	if !root.is(protocolNamespace, "LogoutRequest") {
+		return logoutRequest{}, errors.New("message is not a LogoutRequest")
+	}
+	if err := checkRequestAbstractType(root); err != nil {
+		return logoutRequest{}, err
+	}
+
+	nameID := root.childElement(assertionNamespace, "NameID")
+	if nameID == nil {
+		return logoutRequest{}, errors.New("LogoutRequest has no NameID")
+	}
+
+	if notOnOrAfter := root.attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return logoutRequest{}, errors.New("invalid NotOnOrAfter")
+		}
+		if !time.Now().Before(t) {
+			return logoutRequest{}, errors.New("LogoutRequest has expired")
+		}
+	}
+
+	request := logoutRequest{
+		ID:          root.attr("ID"),
+		Issuer:      issuerOf(root),
+		Destination: root.attr("Destination"),
+		NameID:      nameID.text(),
+	}
+	for _, sessionIndex := range root.childElements(protocolNamespace, "SessionIndex") {
+		request.SessionIndexes = append(request.SessionIndexes, sessionIndex.text())
+	}
+
+	return request, nil
+}
+
+// checkRequestAbstractType checks the attributes all SAML 2.0 requests have (SAML core section 3.2.1)
+func checkRequestAbstractType(root *xmlElement) error {
+	if root.attr("Version") != "2.0" {
+		return errors.New("unsupported SAML version")
+	}
+	if root.attr("ID") == "" {
+		return errors.New("request has no ID")
+	}
+	if issuerOf(root) == "" {
+		return errors.New("request has no Issuer")
+	}
+	return nil
+}
+
+func issuerOf(root *xmlElement) string {
+	issuer := root.childElement(assertionNamespace, "Issuer")
+	if issuer == nil {
+		return ""
+	}
+	return issuer.text()
+}
+
+// isSupportedNameIDFormat reports whether the identity provider can issue NameIDs in the format
+func isSupportedNameIDFormat(format string) bool {
+	return slices.Contains(supportedNameIDFormats, format)
+}
+
+// newID generates an identifier for a protocol message or assertion
+// IDs must be valid xsd:IDs, which can't start with a digit, so they're prefixed with an underscore
+func newID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return "_" + hex.EncodeToString(b)
+}
+
+// formatTime formats a time as xsd:dateTime in UTC, as SAML requires
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// encodePostMessage encodes a message for the HTTP-POST binding
+func encodePostMessage(message []byte) string {
+	return base64.StdEncoding.EncodeToString(message)
+}
+
+// encodeRedirectMessage encodes a message for the HTTP-Redirect binding
+func encodeRedirectMessage(message []byte) (string, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,166 @@
+package saml
+
+import (
+	"crypto"
+	"time"
+)
+
+const (
+	// assertionLifetime is how long service providers accept an assertion after it was issued
+	assertionLifetime = 5 * time.Minute
+	// clockSkew is subtracted from NotBefore to allow for service providers with clocks that are slightly behind
+	clockSkew = time.Minute
+)
+
+// messageSigner signs the messages of the identity provider with the active signing key
+type messageSigner struct {
+	key         crypto.Signer
+	keyID       string
+	certificate []byte
+}
+
+type attribute struct {
+	Name   string
+	Values []string
+}
+
+// assertion is the content of an assertion issued to a service provider
+type assertion struct {
+	Issuer               string
+	Audience             string
+	Recipient            string
+	InResponseTo         string
+	NameID               string
+	NameIDFormat         string
+	SessionIndex         string
+	SessionNotOnOrAfter  time.Time
+	AuthnInstant         time.Time
+	AuthnContextClassRef string
+	Attributes           []attribute
+}
+
+// buildResponse builds a successful Response with a signed assertion for the HTTP-POST binding (SAML core section 3.3.3)
+func buildResponse(a assertion, signer messageSigner, signResponse bool) ([]byte, error) {
+	now := time.Now()
+	response := newResponse("Response", a.Issuer, a.Recipient, a.InResponseTo, now)
+	response.appendChild(statusElement(statusSuccess, "", ""))
+
+	assertionElement := response.appendChild(newElement("saml", "Assertion").declareNamespace("saml", assertionNamespace)).
+		setAttr("ID", newID()).
+		setAttr("Version", "2.0").
+		setAttr("IssueInstant", formatTime(now))
+	assertionElement.appendChild(newElement("saml", "Issuer")).appendText(a.Issuer)
+
+	subject := assertionElement.appendChild(newElement("saml", "Subject"))
+	subject.appendChild(newElement("saml", "NameID")).
+		setAttr("Format", a.NameIDFormat).
+		setAttr("SPNameQualifier", a.Audience).
+		appendText(a.NameID)
+	confirmationData := subject.appendChild(newElement("saml", "SubjectConfirmation")).
+		setAttr("Method", confirmationMethodBearer).
+		appendChild(newElement("saml", "SubjectConfirmationData")).
+		setAttr("NotOnOrAfter", formatTime(now.Add(assertionLifetime))).
+		setAttr("Recipient", a.Recipient)
+	if a.InResponseTo != "" {
+		confirmationData.setAttr("InResponseTo", a.InResponseTo)
+	}
+
+	conditions := assertionElement.appendChild(newElement("saml", "Conditions")).
+		setAttr("NotBefore", formatTime(now.Add(-clockSkew))).
+		setAttr("NotOnOrAfter", formatTime(now.Add(assertionLifetime)))
+	conditions.appendChild(newElement("saml", "AudienceRestriction")).
+		appendChild(newElement("saml", "Audience")).
+		appendText(a.Audience)
+
+	authnStatement := assertionElement.appendChild(newElement("saml", "AuthnStatement")).
+		setAttr("AuthnInstant", formatTime(a.AuthnInstant)).
+		setAttr("SessionIndex", a.SessionIndex).
+		setAttr("SessionNotOnOrAfter", formatTime(a.SessionNotOnOrAfter))
+	authnStatement.appendChild(newElement("saml", "AuthnContext")).
+		appendChild(newElement("saml", "AuthnContextClassRef")).
+		appendText(a.AuthnContextClassRef)
+
+	if len(a.Attributes) > 0 {
+		attributeStatement := assertionElement.appendChild(newElement("saml", "AttributeStatement"))
+		for _, attr := range a.Attributes {
+			attributeElement := attributeStatement.appendChild(newElement("saml", "Attribute")).
+				setAttr("Name", attr.Name).
+				setAttr("NameFormat", attributeNameFormatBasic)
+			for _, value := range attr.Values {
+				attributeElement.appendChild(newElement("saml", "AttributeValue")).appendText(value)
+			}
+		}
+	}
+
+	// The signature follows the Issuer in both the assertion and the response
+	err := signEnveloped(assertionElement, 1, signer.key, signer.certificate)
+	if err != nil {
+		return nil, err
+	}
+	if signResponse {
+		err = signEnveloped(response, 1, signer.key, signer.certificate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return marshalXML(response), nil
+}
+
+// buildErrorResponse builds a signed Response without assertion that tells the service provider why the user can't
+// sign in
+func buildErrorResponse(issuer, destination, inResponseTo, statusCode, subStatusCode, message string, signer messageSigner) ([]byte, error) {
+	response := newResponse("Response", issuer, destination, inResponseTo, time.Now())
+	response.appendChild(statusElement(statusCode, subStatusCode, message))
+
+	err := signEnveloped(response, 1, signer.key, signer.certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalXML(response), nil
+}
+
+// buildLogoutResponse builds a LogoutResponse (SAML core section 3.7.2), which carries an enveloped signature unless it's
+// delivered with the HTTP-Redirect binding, which signs the query string instead
+func buildLogoutResponse(issuer, destination, inResponseTo string, signer messageSigner, sign bool) ([]byte, error) {
+	response := newResponse("LogoutResponse", issuer, destination, inResponseTo, time.Now())
+	response.appendChild(statusElement(statusSuccess, "", ""))
+
+	if sign {
+		err := signEnveloped(response, 1, signer.key, signer.certificate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return marshalXML(response), nil
+}
+
+// newResponse creates a response of the StatusResponseType (SAML core section 3.2.2) with its Issuer
+func newResponse(name, issuer, destination, inResponseTo string, issueInstant time.Time) *xmlElement {
+	response := newElement("samlp", name).
+		declareNamespace("samlp", protocolNamespace).
+		declareNamespace("saml", assertionNamespace).
+		setAttr("ID", newID()).
+		setAttr("Version", "2.0").
+		setAttr("IssueInstant", formatTime(issueInstant)).
+		setAttr("Destination", destination)
+	if inResponseTo != "" {
+		response.setAttr("InResponseTo", inResponseTo)
+	}
+	response.appendChild(newElement("saml", "Issuer")).appendText(issuer)
+	return response
+}
+
+func statusElement(code, subCode, message string) *xmlElement {
+	status := newElement("samlp", "Status")
+	statusCode := status.appendChild(newElement("samlp", "StatusCode")).setAttr("Value", code)
+	if subCode != "" {
+		statusCode.appendChild(newElement("samlp", "StatusCode")).setAttr("Value", subCode)
+	}
+	if message != "" {
+		status.appendChild(newElement("samlp", "StatusMessage")).appendText(message)
+	}
+	return status
+}
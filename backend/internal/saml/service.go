@@ -0,0 +1,976 @@
+package saml
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+const (
+	// pendingAuthnRequestLifetime is how long a service provider's request waits for the user to sign in
+	pendingAuthnRequestLifetime = 15 * time.Minute
+	// certificateKVPrefix is the prefix of the KV keys the signing certificates are stored with, followed by the key ID
+	certificateKVPrefix = "saml_signing_certificate_"
+	// customClaimSourcePrefix is the prefix of attribute sources that release a custom claim
+	customClaimSourcePrefix = "custom:"
+)
+
+// attributeSources are the user fields that can be released as attributes, besides custom claims
+var attributeSources = []string{"id", "username", "email", "first_name", "last_name", "display_name", "groups"}
+
+// defaultAttributeMapping is released to service providers without attribute mapping
+var defaultAttributeMapping = AttributeMapping{
+	{Name: "email", Source: "email"},
+	{Name: "username", Source: "username"},
+	{Name: "firstName", Source: "first_name"},
+	{Name: "lastName", Source: "last_name"},
+	{Name: "displayName", Source: "display_name"},
+	{Name: "groups", Source: "groups"},
+}
+
+// Service holds the business logic of the SAML identity provider and the management of its service providers
+type Service struct {
+	db           *gorm.DB
+	appURL       string
+	signer       Signer
+	customClaims CustomClaimSource
+	sessions     SessionManager
+	auditLog     AuditLogger
+	appConfig    AppConfigProvider
+
+	certificateLock sync.Mutex
+	// certificates caches the DER certificates of the signing keys by key ID
+	certificates map[string][]byte
+}
+
+func newService(deps Dependencies) *Service {
+	return &Service{
+		db:           deps.DB,
+		appURL:       deps.AppURL,
+		signer:       deps.Signer,
+		customClaims: deps.CustomClaims,
+		sessions:     deps.Sessions,
+		auditLog:     deps.AuditLog,
+		appConfig:    deps.AppConfig,
+		certificates: map[string][]byte{},
+	}
+}
+
+// EntityID is the entity ID of the identity provider, which is also where its metadata is published
+func (s *Service) EntityID() string {
+	return s.appURL + "/api/saml/metadata"
+}
+
+func (s *Service) ssoURL() string {
+	return s.appURL + "/api/saml/sso"
+}
+
+func (s *Service) sloURL() string {
+	return s.appURL + "/api/saml/slo"
+}
+
+func (s *Service) ListServiceProviders(ctx context.Context, search string, listRequestOptions utils.ListRequestOptions) ([]ServiceProvider, utils.PaginationResponse, error) {
+	query := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		Model(&ServiceProvider{})
+
+	if search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("name LIKE ? OR entity_id LIKE ?", searchPattern, searchPattern)
+	}
+
+	var serviceProviders []ServiceProvider
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &serviceProviders)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return serviceProviders, pagination, nil
+}
+
+func (s *Service) GetServiceProvider(ctx context.Context, id string) (ServiceProvider, error) {
+	var serviceProvider ServiceProvider
+	err := s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		First(&serviceProvider, "id = ?", id).
+		Error
+	return serviceProvider, err
+}
+
+func (s *Service) CreateServiceProvider(ctx context.Context, input serviceProviderInputDto) (ServiceProvider, error) {
+	var serviceProvider ServiceProvider
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.saveServiceProvider(tx, &serviceProvider, input)
+	})
+	if err != nil {
+		return ServiceProvider{}, err
+	}
+
+	return serviceProvider, nil
+}
+
+func (s *Service) UpdateServiceProvider(ctx context.Context, id string, input serviceProviderInputDto) (ServiceProvider, error) {
+	var serviceProvider ServiceProvider
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&serviceProvider, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		return s.saveServiceProvider(tx, &serviceProvider, input)
+	})
+	if err != nil {
+		return ServiceProvider{}, err
+	}
+
+	return serviceProvider, nil
+}
+
+func (s *Service) DeleteServiceProvider(ctx context.Context, id string) error {
+	result := s.db.
+		WithContext(ctx).
+		Delete(&ServiceProvider{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// saveServiceProvider imports the metadata, validates the input, then creates or updates the service provider and
+// replaces its allowed user groups
+func (s *Service) saveServiceProvider(tx *gorm.DB, serviceProvider *ServiceProvider, input serviceProviderInputDto) error {
+	metadata, err := parseServiceProviderMetadata([]byte(input.Metadata))
+	if err != nil {
+		return err
+	}
+
+	nameIDFormat := input.NameIDFormat
+	if nameIDFormat == "" {
+		// Use the first format the service provider supports, or persistent NameIDs if it doesn't say
+		nameIDFormat = nameIDFormatPersistent
+		for _, format := range metadata.NameIDFormats {
+			if isSupportedNameIDFormat(format) {
+				nameIDFormat = format
+				break
+			}
+		}
+	}
+	if !isSupportedNameIDFormat(nameIDFormat) {
+		return &common.ValidationError{Message: "unsupported NameID format"}
+	}
+
+	attributeMapping := make(AttributeMapping, 0, len(input.AttributeMapping))
+	for _, entry := range input.AttributeMapping {
+		if !slices.Contains(attributeSources, entry.Source) &&
+			(!strings.HasPrefix(entry.Source, customClaimSourcePrefix) || len(entry.Source) == len(customClaimSourcePrefix)) {
+			return &common.ValidationError{Message: fmt.Sprintf("invalid source '%s' for attribute '%s'", entry.Source, entry.Name)}
+		}
+		if slices.ContainsFunc(attributeMapping, func(e AttributeMappingEntry) bool { return e.Name == entry.Name }) {
+			return &common.ValidationError{Message: fmt.Sprintf("attribute '%s' is mapped more than once", entry.Name)}
+		}
+		attributeMapping = append(attributeMapping, AttributeMappingEntry(entry))
+	}
+
+	userGroups := []model.UserGroup{}
+	if len(input.AllowedUserGroupIDs) > 0 {
+		err := tx.Where("id IN ?", input.AllowedUserGroupIDs).Find(&userGroups).Error
+		if err != nil {
+			return err
+		}
+		if len(userGroups) != len(slices.Compact(slices.Sorted(slices.Values(input.AllowedUserGroupIDs)))) {
+			return &common.ValidationError{Message: "one or more allowed user groups do not exist"}
+		}
+	}
+
+	serviceProvider.Name = input.Name
+	serviceProvider.EntityID = metadata.EntityID
+	serviceProvider.Metadata = input.Metadata
+	serviceProvider.AssertionConsumerServices = metadata.AssertionConsumerServices
+	serviceProvider.SingleLogoutServices = metadata.SingleLogoutServices
+	serviceProvider.SigningCertificates = metadata.SigningCertificates
+	serviceProvider.NameIDFormat = nameIDFormat
+	serviceProvider.AuthnRequestsSigned = metadata.AuthnRequestsSigned
+	serviceProvider.SignResponse = input.SignResponse
+	serviceProvider.AttributeMapping = attributeMapping
+	serviceProvider.IsGroupRestricted = input.IsGroupRestricted
+
+	err = tx.Omit("AllowedUserGroups").Save(serviceProvider).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &common.AlreadyInUseError{Property: "Entity ID"}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(serviceProvider).Association("AllowedUserGroups").Replace(userGroups)
+	if err != nil {
+		return err
+	}
+	serviceProvider.AllowedUserGroups = userGroups
+
+	return nil
+}
+
+// Metadata returns the metadata document of the identity provider
+func (s *Service) Metadata(ctx context.Context) ([]byte, error) {
+	signer, err := s.messageSigner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate of the active key comes first, followed by the ones of the next and the retained keys
+	certificates := [][]byte{signer.certificate}
+	publishedKeys := s.signer.GetPublishedPrivateKeys()
+	for _, keyID := range slices.Sorted(maps.Keys(publishedKeys)) {
+		key, ok := publishedKeys[keyID].(crypto.Signer)
+		if keyID == signer.keyID || !ok {
+			continue
+		}
+
+		certificate, err := s.signingCertificate(ctx, keyID, key)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return marshalXML(identityProviderMetadata(s.EntityID(), s.ssoURL(), s.sloURL(), certificates)), nil
+}
+
+// ssoRequest is a validated request to sign the user in to a service provider
+type ssoRequest struct {
+	ServiceProvider ServiceProvider
+	// RequestID is the ID of the AuthnRequest, empty for IdP-initiated sign ins
+	RequestID    string
+	ACSURL       string
+	RelayState   string
+	NameIDFormat string
+	IsPassive    bool
+}
+
+// signIn describes the browser session of the user that signs in to a service provider
+type signIn struct {
+	UserID             string
+	AuthenticationTime time.Time
+	IPAddress          string
+	UserAgent          string
+}
+
+// outboundMessage is a message the browser delivers to an endpoint of a service provider
+type outboundMessage struct {
+	Binding    string
+	URL        string
+	Parameter  string
+	Message    string
+	RelayState string
+}
+
+// parseAuthnRequest decodes, verifies and validates an AuthnRequest of a service provider
+// Errors that can't be reported to the service provider are returned as ValidationErrors, so they can be shown to the user
+func (s *Service) parseAuthnRequest(ctx context.Context, message inboundMessage) (ssoRequest, error) {
+	root, serviceProvider, err := s.parseRequest(ctx, message)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+	root, err = verifyRequestSignature(message, root, serviceProvider, serviceProvider.AuthnRequestsSigned)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	request, err := parseAuthnRequest(root)
+	if err != nil {
+		return ssoRequest{}, &common.ValidationError{Message: err.Error()}
+	}
+
+	if request.Destination != "" && request.Destination != s.ssoURL() {
+		return ssoRequest{}, &common.ValidationError{Message: "the request was sent to another destination"}
+	}
+	if request.ProtocolBinding != "" && request.ProtocolBinding != bindingHTTPPost {
+		return ssoRequest{}, &common.ValidationError{Message: "only the HTTP-POST binding is supported for responses"}
+	}
+
+	acsURL, err := assertionConsumerService(serviceProvider, request.AssertionConsumerServiceURL, request.AssertionConsumerServiceIndex)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	nameIDFormat := request.NameIDFormat
+	if nameIDFormat == "" || nameIDFormat == nameIDFormatUnspecified {
+		nameIDFormat = serviceProvider.NameIDFormat
+	}
+
+	return ssoRequest{
+		ServiceProvider: serviceProvider,
+		RequestID:       request.ID,
+		ACSURL:          acsURL,
+		RelayState:      message.RelayState,
+		NameIDFormat:    nameIDFormat,
+		IsPassive:       request.IsPassive,
+	}, nil
+}
+
+// idpInitiatedRequest creates the request for an unsolicited response, which signs the user in to a service provider
+// without it having asked for it
+func (s *Service) idpInitiatedRequest(ctx context.Context, serviceProviderID, relayState string) (ssoRequest, error) {
+	serviceProvider, err := s.GetServiceProvider(ctx, serviceProviderID)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	acsURL, err := assertionConsumerService(serviceProvider, "", nil)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	return ssoRequest{
+		ServiceProvider: serviceProvider,
+		ACSURL:          acsURL,
+		RelayState:      relayState,
+		NameIDFormat:    serviceProvider.NameIDFormat,
+	}, nil
+}
+
+// storePendingRequest stores the request while the user signs in and returns the ID to resume it with
+func (s *Service) storePendingRequest(ctx context.Context, request ssoRequest) (string, error) {
+	pending := PendingAuthnRequest{
+		RequestID:                   request.RequestID,
+		AssertionConsumerServiceURL: request.ACSURL,
+		RelayState:                  request.RelayState,
+		NameIDFormat:                request.NameIDFormat,
+		IsPassive:                   request.IsPassive,
+		ExpiresAt:                   datatype.DateTime(time.Now().Add(pendingAuthnRequestLifetime)),
+		ServiceProviderID:           request.ServiceProvider.ID,
+	}
+	err := s.db.
+		WithContext(ctx).
+		Create(&pending).
+		Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store authentication request: %w", err)
+	}
+
+	return pending.ID, nil
+}
+
+// peekPendingRequest returns the request that waits for the user to sign in, without consuming it
+func (s *Service) peekPendingRequest(ctx context.Context, id string) (ssoRequest, error) {
+	pending, err := loadPendingRequest(s.db.WithContext(ctx), id)
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	return pending.toSSORequest(), nil
+}
+
+// consumePendingRequest returns the request that waited for the user to sign in and deletes it
+func (s *Service) consumePendingRequest(ctx context.Context, id string) (ssoRequest, error) {
+	var pending PendingAuthnRequest
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		pending, err = loadPendingRequest(tx, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&pending).Error
+	})
+	if err != nil {
+		return ssoRequest{}, err
+	}
+
+	return pending.toSSORequest(), nil
+}
+
+func loadPendingRequest(tx *gorm.DB, id string) (PendingAuthnRequest, error) {
+	var pending PendingAuthnRequest
+	err := tx.
+		Preload("ServiceProvider.AllowedUserGroups").
+		Where("id = ? AND expires_at > ?", id, datatype.DateTime(time.Now())).
+		First(&pending).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PendingAuthnRequest{}, &common.ValidationError{Message: "the sign in request has expired, please try again"}
+	}
+	return pending, err
+}
+
+func (p PendingAuthnRequest) toSSORequest() ssoRequest {
+	return ssoRequest{
+		ServiceProvider: p.ServiceProvider,
+		RequestID:       p.RequestID,
+		ACSURL:          p.AssertionConsumerServiceURL,
+		RelayState:      p.RelayState,
+		NameIDFormat:    p.NameIDFormat,
+		IsPassive:       p.IsPassive,
+	}
+}
+
+// issueResponse signs the user in to the service provider and returns the response with the assertion, or a response
+// with the reason why the user can't sign in
+func (s *Service) issueResponse(ctx context.Context, request ssoRequest, signIn signIn) (outboundMessage, error) {
+	serviceProvider := request.ServiceProvider
+
+	var user model.User
+	err := s.db.
+		WithContext(ctx).
+		Preload("UserGroups").
+		First(&user, "id = ?", signIn.UserID).
+		Error
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	if !isUserGroupAllowed(user, serviceProvider) {
+		return s.errorResponse(ctx, request, statusResponder, statusRequestDenied, "You're not allowed to access this service")
+	}
+	if !isSupportedNameIDFormat(request.NameIDFormat) {
+		return s.errorResponse(ctx, request, statusRequester, statusInvalidNameIDPolicy, "The requested NameID format is not supported")
+	}
+
+	nameID := nameIDFor(user, request.NameIDFormat)
+	if nameID == "" {
+		return s.errorResponse(ctx, request, statusResponder, statusInvalidNameIDPolicy, "The user has no value for the requested NameID format")
+	}
+
+	attributes, err := s.attributesFor(ctx, user, serviceProvider.AttributeMapping)
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	signer, err := s.messageSigner(ctx)
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	now := time.Now()
+	session := Session{
+		Base:              model.Base{ID: newID()},
+		NameID:            nameID,
+		NameIDFormat:      request.NameIDFormat,
+		ExpiresAt:         datatype.DateTime(now.Add(s.appConfig.GetDbConfig().SessionDuration.AsDurationMinutes())),
+		ServiceProviderID: serviceProvider.ID,
+		UserID:            user.ID,
+	}
+
+	authenticationTime := signIn.AuthenticationTime
+	if authenticationTime.IsZero() {
+		authenticationTime = now
+	}
+
+	response, err := buildResponse(assertion{
+		Issuer:               s.EntityID(),
+		Audience:             serviceProvider.EntityID,
+		Recipient:            request.ACSURL,
+		InResponseTo:         request.RequestID,
+		NameID:               nameID,
+		NameIDFormat:         request.NameIDFormat,
+		SessionIndex:         session.ID,
+		SessionNotOnOrAfter:  session.ExpiresAt.ToTime(),
+		AuthnInstant:         authenticationTime,
+		AuthnContextClassRef: authnContextUnspecified,
+		Attributes:           attributes,
+	}, signer, serviceProvider.SignResponse)
+	if err != nil {
+		return outboundMessage{}, fmt.Errorf("failed to build response: %w", err)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&session).Error
+		if err != nil {
+			return fmt.Errorf("failed to create SAML session: %w", err)
+		}
+
+		s.auditLog.Create(ctx, model.AuditLogEventSamlAuthorization, signIn.IPAddress, signIn.UserAgent, user.ID, model.AuditLogData{"clientName": serviceProvider.Name}, tx)
+		return nil
+	})
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	return outboundMessage{
+		Binding:    bindingHTTPPost,
+		URL:        request.ACSURL,
+		Parameter:  "SAMLResponse",
+		Message:    encodePostMessage(response),
+		RelayState: request.RelayState,
+	}, nil
+}
+
+// errorResponse returns a response that tells the service provider why the user can't be signed in
+func (s *Service) errorResponse(ctx context.Context, request ssoRequest, statusCode, subStatusCode, message string) (outboundMessage, error) {
+	signer, err := s.messageSigner(ctx)
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	response, err := buildErrorResponse(s.EntityID(), request.ACSURL, request.RequestID, statusCode, subStatusCode, message, signer)
+	if err != nil {
+		return outboundMessage{}, fmt.Errorf("failed to build response: %w", err)
+	}
+
+	return outboundMessage{
+		Binding:    bindingHTTPPost,
+		URL:        request.ACSURL,
+		Parameter:  "SAMLResponse",
+		Message:    encodePostMessage(response),
+		RelayState: request.RelayState,
+	}, nil
+}
+
+// noPassiveResponse returns the response to a passive request of a user that isn't signed in
+func (s *Service) noPassiveResponse(ctx context.Context, request ssoRequest) (outboundMessage, error) {
+	return s.errorResponse(ctx, request, statusResponder, statusNoPassive, "The user is not signed in")
+}
+
+// logout handles a LogoutRequest of a service provider
+// It ends the user's sessions with the service provider and, if the browser is signed in as the same user, the browser
+// session as well. It returns the LogoutResponse and whether the browser session was ended.
+func (s *Service) logout(ctx context.Context, message inboundMessage, userID, sessionID string) (outboundMessage, bool, error) {
+	root, serviceProvider, err := s.parseRequest(ctx, message)
+	if err != nil {
+		return outboundMessage{}, false, err
+	}
+	// Logout requests must be signed if the service provider has a signing certificate, otherwise anyone could end the
+	// sessions of users with it
+	root, err = verifyRequestSignature(message, root, serviceProvider, len(serviceProvider.SigningCertificates) > 0)
+	if err != nil {
+		return outboundMessage{}, false, err
+	}
+
+	request, err := parseLogoutRequest(root)
+	if err != nil {
+		return outboundMessage{}, false, &common.ValidationError{Message: err.Error()}
+	}
+	if request.Destination != "" && request.Destination != s.sloURL() {
+		return outboundMessage{}, false, &common.ValidationError{Message: "the request was sent to another destination"}
+	}
+
+	endpoint, ok := singleLogoutService(serviceProvider, message.Binding)
+	if !ok {
+		return outboundMessage{}, false, &common.ValidationError{Message: "the service provider has no single logout service"}
+	}
+
+	var sessions []Session
+	query := s.db.
+		WithContext(ctx).
+		Where("service_provider_id = ? AND name_id = ?", serviceProvider.ID, request.NameID)
+	if len(request.SessionIndexes) > 0 {
+		query = query.Where("id IN ?", request.SessionIndexes)
+	}
+	err = query.Find(&sessions).Error
+	if err != nil {
+		return outboundMessage{}, false, err
+	}
+
+	signedOut := false
+	if len(sessions) > 0 {
+		err = s.db.
+			WithContext(ctx).
+			Delete(&sessions).
+			Error
+		if err != nil {
+			return outboundMessage{}, false, fmt.Errorf("failed to delete SAML sessions: %w", err)
+		}
+
+		if userID != "" && slices.ContainsFunc(sessions, func(session Session) bool { return session.UserID == userID }) {
+			err = s.sessions.Logout(ctx, userID, sessionID)
+			if err != nil {
+				return outboundMessage{}, false, fmt.Errorf("failed to end the user session: %w", err)
+			}
+			signedOut = true
+		}
+	}
+
+	response, err := s.logoutResponse(ctx, endpoint, request.ID, message.RelayState)
+	if err != nil {
+		return outboundMessage{}, false, err
+	}
+
+	return response, signedOut, nil
+}
+
+// logoutResponse builds the LogoutResponse for the single logout service of a service provider
+func (s *Service) logoutResponse(ctx context.Context, endpoint Endpoint, inResponseTo, relayState string) (outboundMessage, error) {
+	signer, err := s.messageSigner(ctx)
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	location := endpoint.Location
+	if endpoint.ResponseLocation != "" {
+		location = endpoint.ResponseLocation
+	}
+
+	response, err := buildLogoutResponse(s.EntityID(), location, inResponseTo, signer, endpoint.Binding == bindingHTTPPost)
+	if err != nil {
+		return outboundMessage{}, fmt.Errorf("failed to build logout response: %w", err)
+	}
+
+	if endpoint.Binding == bindingHTTPPost {
+		return outboundMessage{
+			Binding:    bindingHTTPPost,
+			URL:        location,
+			Parameter:  "SAMLResponse",
+			Message:    encodePostMessage(response),
+			RelayState: relayState,
+		}, nil
+	}
+
+	encoded, err := encodeRedirectMessage(response)
+	if err != nil {
+		return outboundMessage{}, fmt.Errorf("failed to encode logout response: %w", err)
+	}
+	query, err := signRedirectQuery("SAMLResponse", encoded, relayState, signer.key)
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	return outboundMessage{
+		Binding: bindingHTTPRedirect,
+		URL:     location + separator + query,
+	}, nil
+}
+
+// parseRequest decodes a request of a service provider and looks up the service provider by its issuer
+func (s *Service) parseRequest(ctx context.Context, message inboundMessage) (*xmlElement, ServiceProvider, error) {
+	data, err := message.decode()
+	if err != nil {
+		return nil, ServiceProvider{}, &common.ValidationError{Message: err.Error()}
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, ServiceProvider{}, &common.ValidationError{Message: err.Error()}
+	}
+
+	var serviceProvider ServiceProvider
+	err = s.db.
+		WithContext(ctx).
+		Preload("AllowedUserGroups").
+		First(&serviceProvider, "entity_id = ?", issuerOf(root)).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ServiceProvider{}, &common.ValidationError{Message: "the service provider is not registered"}
+	}
+	if err != nil {
+		return nil, ServiceProvider{}, err
+	}
+
+	return root, serviceProvider, nil
+}
+
+// verifyRequestSignature verifies the signature of a request with the certificates of the service provider and returns
+// the request that is processed, which is the signed element for an enveloped signature
+// An unsigned request is only accepted if the service provider doesn't have to sign its requests
+func verifyRequestSignature(message inboundMessage, root *xmlElement, serviceProvider ServiceProvider, required bool) (*xmlElement, error) {
+	certificates, err := parseCertificates(serviceProvider.SigningCertificates)
+	if err != nil && required {
+		return nil, &common.ValidationError{Message: "the service provider must sign its requests, but it has no valid signing certificate"}
+	}
+
+	verified := root
+	if message.Binding == bindingHTTPRedirect {
+		err = verifyRedirectSignature(message.Parameters, "SAMLRequest", certificates)
+	} else {
+		verified, err = verifyEnvelopedSignature(root, certificates)
+	}
+	if errors.Is(err, errSignatureMissing) {
+		if required {
+			return nil, &common.ValidationError{Message: "the request of the service provider must be signed"}
+		}
+		return root, nil
+	}
+	if err != nil {
+		return nil, &common.ValidationError{Message: "the signature of the request is invalid: " + err.Error()}
+	}
+
+	return verified, nil
+}
+
+// assertionConsumerService returns the assertion consumer service the response is delivered to
+// Requests may only ask for an assertion consumer service from the metadata, either by URL or by index
+func assertionConsumerService(serviceProvider ServiceProvider, acsURL string, index *int) (string, error) {
+	services := serviceProvider.AssertionConsumerServices
+	switch {
+	case acsURL != "":
+		if slices.ContainsFunc(services, func(e Endpoint) bool { return e.Location == acsURL }) {
+			return acsURL, nil
+		}
+	case index != nil:
+		i := slices.IndexFunc(services, func(e Endpoint) bool { return e.Index == *index })
+		if i >= 0 {
+			return services[i].Location, nil
+		}
+	default:
+		if i := slices.IndexFunc(services, func(e Endpoint) bool { return e.IsDefault }); i >= 0 {
+			return services[i].Location, nil
+		}
+		if len(services) > 0 {
+			return services[0].Location, nil
+		}
+	}
+
+	return "", &common.ValidationError{Message: "the requested assertion consumer service is not in the metadata of the service provider"}
+}
+
+// singleLogoutService returns the single logout service of the service provider, preferring the one with the binding
+// the request was received with
+func singleLogoutService(serviceProvider ServiceProvider, binding string) (Endpoint, bool) {
+	services := serviceProvider.SingleLogoutServices
+	if i := slices.IndexFunc(services, func(e Endpoint) bool { return e.Binding == binding }); i >= 0 {
+		return services[i], true
+	}
+	if len(services) > 0 {
+		return services[0], true
+	}
+	return Endpoint{}, false
+}
+
+// isUserGroupAllowed reports whether the user may sign in to the group-restricted service provider
+func isUserGroupAllowed(user model.User, serviceProvider ServiceProvider) bool {
+	if !serviceProvider.IsGroupRestricted {
+		return true
+	}
+
+	for _, allowedGroup := range serviceProvider.AllowedUserGroups {
+		for _, userGroup := range user.UserGroups {
+			if allowedGroup.ID == userGroup.ID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// nameIDFor returns the NameID of the user in the format, or an empty string if the user has no value for it
+// Transient NameIDs are random for every sign in
+func nameIDFor(user model.User, format string) string {
+	switch format {
+	case nameIDFormatEmailAddress:
+		if user.Email == nil {
+			return ""
+		}
+		return *user.Email
+	case nameIDFormatPersistent:
+		return user.ID
+	case nameIDFormatTransient:
+		return newID()
+	case nameIDFormatUnspecified:
+		return user.Username
+	default:
+		return ""
+	}
+}
+
+// attributesFor returns the attributes the mapping releases for the user; empty values are left out
+func (s *Service) attributesFor(ctx context.Context, user model.User, mapping AttributeMapping) ([]attribute, error) {
+	if len(mapping) == 0 {
+		mapping = defaultAttributeMapping
+	}
+
+	var customClaims map[string]string
+	if slices.ContainsFunc(mapping, func(e AttributeMappingEntry) bool { return strings.HasPrefix(e.Source, customClaimSourcePrefix) }) {
+		claims, err := s.customClaims.GetCustomClaimsForUserWithUserGroups(ctx, user.ID, s.db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get custom claims: %w", err)
+		}
+		customClaims = make(map[string]string, len(claims))
+		for _, claim := range claims {
+			customClaims[claim.Key] = claim.Value
+		}
+	}
+
+	attributes := make([]attribute, 0, len(mapping))
+	for _, entry := range mapping {
+		var values []string
+		switch entry.Source {
+		case "id":
+			values = []string{user.ID}
+		case "username":
+			values = []string{user.Username}
+		case "email":
+			if user.Email != nil {
+				values = []string{*user.Email}
+			}
+		case "first_name":
+			values = []string{user.FirstName}
+		case "last_name":
+			values = []string{user.LastName}
+		case "display_name":
+			values = []string{user.DisplayName}
+		case "groups":
+			for _, group := range user.UserGroups {
+				values = append(values, group.Name)
+			}
+		default:
+			if value, ok := customClaims[strings.TrimPrefix(entry.Source, customClaimSourcePrefix)]; ok {
+				values = []string{value}
+			}
+		}
+
+		values = slices.DeleteFunc(values, func(v string) bool { return v == "" })
+		if len(values) > 0 {
+			attributes = append(attributes, attribute{Name: entry.Name, Values: values})
+		}
+	}
+
+	return attributes, nil
+}
+
+// messageSigner returns the signer for messages with the active signing key and its certificate
+func (s *Service) messageSigner(ctx context.Context) (messageSigner, error) {
+	rawKey, keyID, _, err := s.signer.GetSigningKey()
+	if err != nil {
+		return messageSigner{}, err
+	}
+	key, ok := rawKey.(crypto.Signer)
+	if !ok {
+		return messageSigner{}, errors.New("signing key is not initialized")
+	}
+	if keyID == "" {
+		keyID = "default"
+	}
+
+	certificate, err := s.signingCertificate(ctx, keyID, key)
+	if err != nil {
+		return messageSigner{}, err
+	}
+
+	return messageSigner{key: key, keyID: keyID, certificate: certificate}, nil
+}
+
+// signingCertificate returns the self-signed certificate for the signing key, which service providers get from the
+// metadata to verify the signatures of the identity provider
+// The certificate is stored by key ID so it stays the same across restarts and instances; a new key gets a new certificate
+func (s *Service) signingCertificate(ctx context.Context, keyID string, key crypto.Signer) ([]byte, error) {
+	s.certificateLock.Lock()
+	defer s.certificateLock.Unlock()
+
+	if certificate, ok := s.certificates[keyID]; ok {
+		return certificate, nil
+	}
+
+	kvKey := certificateKVPrefix + keyID
+	var row model.KV
+	err := s.db.
+		WithContext(ctx).
+		Where("key = ?", kvKey).
+		Limit(1).
+		Find(&row).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing certificate: %w", err)
+	}
+
+	if row.Value == nil {
+		der, err := createCertificate(key, s.appURL)
+		if err != nil {
+			return nil, err
+		}
+
+		// Another instance may have created a certificate for the key in the meantime, in which case that one is used
+		value := base64.StdEncoding.EncodeToString(der)
+		err = s.db.
+			WithContext(ctx).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.KV{Key: kvKey, Value: &value}).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to store signing certificate: %w", err)
+		}
+
+		err = s.db.
+			WithContext(ctx).
+			Where("key = ?", kvKey).
+			First(&row).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing certificate: %w", err)
+		}
+	}
+
+	certificate, err := base64.StdEncoding.DecodeString(*row.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	s.certificates[keyID] = certificate
+	return certificate, nil
+}
+
+// createCertificate creates a self-signed certificate for the signing key
+// Service providers use the certificate only as a container for the public key, so it's valid for a long time
+func createCertificate(key crypto.Signer, appURL string) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	commonName := appURL
+	if u, err := url.Parse(appURL); err == nil && u.Hostname() != "" {
+		commonName = u.Hostname()
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing certificate: %w", err)
+	}
+	return der, nil
+}
+
+// CleanupExpired deletes authentication requests nobody signed in for and SAML sessions that have expired
+func CleanupExpired(ctx context.Context, db *gorm.DB) (int64, error) {
+	now := datatype.DateTime(time.Now())
+
+	requests := db.
+		WithContext(ctx).
+		Delete(&PendingAuthnRequest{}, "expires_at < ?", now)
+	if requests.Error != nil {
+		return 0, requests.Error
+	}
+
+	sessions := db.
+		WithContext(ctx).
+		Delete(&Session{}, "expires_at < ?", now)
+	return requests.RowsAffected + sessions.RowsAffected, sessions.Error
+}
@@ -0,0 +1,373 @@
+package saml
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+type testSigner struct {
+	key crypto.Signer
+	// nextKey is published before it's used, like the next key of a key rotation
+	nextKey crypto.Signer
+}
+
+func (s testSigner) GetSigningKey() (any, string, jwa.KeyAlgorithm, error) {
+	return s.key, "test-key", nil, nil
+}
+
+func (s testSigner) GetPublishedPrivateKeys() map[string]any {
+	keys := map[string]any{"test-key": s.key}
+	if s.nextKey != nil {
+		keys["next-key"] = s.nextKey
+	}
+	return keys
+}
+
+type testCustomClaims struct{}
+
+func (testCustomClaims) GetCustomClaimsForUserWithUserGroups(_ context.Context, _ string, _ *gorm.DB) ([]model.CustomClaim, error) {
+	return []model.CustomClaim{{Key: "department", Value: "Engineering"}}, nil
+}
+
+type testSessions struct {
+	loggedOut []string
+}
+
+func (s *testSessions) Logout(_ context.Context, _, sessionID string) error {
+	s.loggedOut = append(s.loggedOut, sessionID)
+	return nil
+}
+
+type testAuditLog struct{}
+
+func (testAuditLog) Create(_ context.Context, event model.AuditLogEvent, _, _, userID string, data model.AuditLogData, _ *gorm.DB) (model.AuditLog, bool) {
+	return model.AuditLog{Event: event, UserID: userID, Data: data}, true
+}
+
+type testAppConfig struct{}
+
+func (testAppConfig) GetDbConfig() *model.AppConfig {
+	return &model.AppConfig{SessionDuration: model.AppConfigVariable{Value: "60"}}
+}
+
+const testServiceProviderEntityID = "https://sp.example.com/saml"
+
+// testServiceProviderMetadata returns the metadata of a service provider that signs its requests with the key
+func testServiceProviderMetadata(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+
+	certificate := base64.StdEncoding.EncodeToString(newTestCertificate(t, key).Raw)
+	return `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testServiceProviderEntityID + `">
+  <md:SPSSODescriptor AuthnRequestsSigned="true" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>` + certificate + `</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleLogoutService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://sp.example.com/saml/slo"/>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact" Location="https://sp.example.com/saml/artifact" index="0"/>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://sp.example.com/saml/acs" index="1" isDefault="true"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>`
+}
+
+func TestServiceSaveServiceProvider(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := newService(Dependencies{DB: db})
+
+	spKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.UserGroup{Base: model.Base{ID: "staff"}, Name: "staff", FriendlyName: "Staff"}).Error)
+
+	serviceProvider, err := service.CreateServiceProvider(t.Context(), serviceProviderInputDto{
+		Name:                "Wiki",
+		Metadata:            testServiceProviderMetadata(t, spKey),
+		AttributeMapping:    []attributeMappingDto{{Name: "mail", Source: "email"}, {Name: "department", Source: "custom:department"}},
+		IsGroupRestricted:   true,
+		AllowedUserGroupIDs: []string{"staff"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, testServiceProviderEntityID, serviceProvider.EntityID)
+	require.Equal(t, Endpoints{{Binding: bindingHTTPPost, Location: "https://sp.example.com/saml/acs", Index: 1, IsDefault: true}}, serviceProvider.AssertionConsumerServices)
+	require.Len(t, serviceProvider.SingleLogoutServices, 1)
+	require.Len(t, serviceProvider.SigningCertificates, 1)
+	require.True(t, serviceProvider.AuthnRequestsSigned)
+	// The NameID format defaults to the first supported format of the metadata
+	require.Equal(t, nameIDFormatEmailAddress, serviceProvider.NameIDFormat)
+
+	loaded, err := service.GetServiceProvider(t.Context(), serviceProvider.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.AllowedUserGroups, 1)
+	require.Len(t, loaded.AttributeMapping, 2)
+
+	t.Run("duplicate entity ID is rejected", func(t *testing.T) {
+		_, err := service.CreateServiceProvider(t.Context(), serviceProviderInputDto{Name: "Wiki", Metadata: testServiceProviderMetadata(t, spKey)})
+		require.ErrorIs(t, err, &common.AlreadyInUseError{})
+	})
+
+	t.Run("invalid input is rejected", func(t *testing.T) {
+		inputs := map[string]serviceProviderInputDto{
+			"invalid metadata":         {Name: "Wiki", Metadata: "<EntityDescriptor"},
+			"unsupported format":       {Name: "Wiki", Metadata: testServiceProviderMetadata(t, spKey), NameIDFormat: "urn:example:format"},
+			"unknown attribute source": {Name: "Wiki", Metadata: testServiceProviderMetadata(t, spKey), AttributeMapping: []attributeMappingDto{{Name: "mail", Source: "mail"}}},
+			"unknown user group":       {Name: "Wiki", Metadata: testServiceProviderMetadata(t, spKey), AllowedUserGroupIDs: []string{"missing"}},
+		}
+		for name, input := range inputs {
+			_, err := service.UpdateServiceProvider(t.Context(), serviceProvider.ID, input)
+			var validationErr *common.ValidationError
+			require.ErrorAs(t, err, &validationErr, name)
+		}
+	})
+}
+
+func TestServiceMetadataPublishesAllKeys(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	activeKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	nextKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	service := newService(Dependencies{
+		DB:        db,
+		AppURL:    "https://idp.example.com",
+		Signer:    testSigner{key: activeKey, nextKey: nextKey},
+		AppConfig: testAppConfig{},
+	})
+
+	metadata, err := service.Metadata(t.Context())
+	require.NoError(t, err)
+	root, err := parseXML(metadata)
+	require.NoError(t, err)
+
+	descriptor := root.childElement(metadataNamespace, "IDPSSODescriptor")
+	keyDescriptors := descriptor.childElements(metadataNamespace, "KeyDescriptor")
+	require.Len(t, keyDescriptors, 2)
+
+	// The active key comes first, so service providers that only use the first certificate verify current signatures
+	for i, key := range []*ecdsa.PrivateKey{activeKey, nextKey} {
+		require.Equal(t, "signing", keyDescriptors[i].attr("use"))
+		der, err := decodeBase64(keyDescriptors[i].childElement(dsNamespace, "KeyInfo").text())
+		require.NoError(t, err)
+		certificate, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		require.True(t, key.PublicKey.Equal(certificate.PublicKey))
+	}
+
+	again, err := service.Metadata(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, metadata, again, "certificates should be stable")
+}
+
+func TestServiceSingleSignOnAndLogout(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	idpKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sessions := &testSessions{}
+	service := newService(Dependencies{
+		DB:           db,
+		AppURL:       "https://idp.example.com",
+		Signer:       testSigner{key: idpKey},
+		CustomClaims: testCustomClaims{},
+		Sessions:     sessions,
+		AuditLog:     testAuditLog{},
+		AppConfig:    testAppConfig{},
+	})
+
+	spKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	spCertificate := newTestCertificate(t, spKey)
+
+	email := "alice@example.com"
+	user := model.User{Base: model.Base{ID: "alice"}, Username: "alice", Email: &email, FirstName: "Alice"}
+	require.NoError(t, db.Create(&user).Error)
+	group := model.UserGroup{Base: model.Base{ID: "staff"}, Name: "staff", FriendlyName: "Staff"}
+	require.NoError(t, db.Create(&group).Error)
+
+	serviceProvider, err := service.CreateServiceProvider(t.Context(), serviceProviderInputDto{
+		Name:             "Wiki",
+		Metadata:         testServiceProviderMetadata(t, spKey),
+		AttributeMapping: []attributeMappingDto{{Name: "mail", Source: "email"}, {Name: "groups", Source: "groups"}, {Name: "department", Source: "custom:department"}},
+	})
+	require.NoError(t, err)
+
+	idpCertificate := func(t *testing.T) *x509.Certificate {
+		metadata, err := service.Metadata(t.Context())
+		require.NoError(t, err)
+		root, err := parseXML(metadata)
+		require.NoError(t, err)
+		require.Equal(t, "https://idp.example.com/api/saml/metadata", root.attr("entityID"))
+
+		descriptor := root.childElement(metadataNamespace, "IDPSSODescriptor")
+		certificate := descriptor.childElement(metadataNamespace, "KeyDescriptor").childElement(dsNamespace, "KeyInfo").text()
+		der, err := decodeBase64(certificate)
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return parsed
+	}(t)
+
+	newAuthnRequest := func(t *testing.T, sign bool) string {
+		request := newElement("samlp", "AuthnRequest").
+			declareNamespace("samlp", protocolNamespace).
+			declareNamespace("saml", assertionNamespace).
+			setAttr("ID", "_request").
+			setAttr("Version", "2.0").
+			setAttr("IssueInstant", formatTime(spCertificate.NotBefore)).
+			setAttr("Destination", "https://idp.example.com/api/saml/sso").
+			setAttr("AssertionConsumerServiceURL", "https://sp.example.com/saml/acs")
+		request.appendChild(newElement("saml", "Issuer")).appendText(testServiceProviderEntityID)
+		request.appendChild(newElement("samlp", "NameIDPolicy")).setAttr("Format", nameIDFormatPersistent)
+		if sign {
+			require.NoError(t, signEnveloped(request, 1, spKey, spCertificate.Raw))
+		}
+		return encodePostMessage(marshalXML(request))
+	}
+
+	// parseResponse decodes the response posted to the service provider and verifies the signature of its assertion
+	parseResponse := func(t *testing.T, message outboundMessage) *xmlElement {
+		t.Helper()
+
+		require.Equal(t, bindingHTTPPost, message.Binding)
+		require.Equal(t, "https://sp.example.com/saml/acs", message.URL)
+		data, err := decodeBase64(message.Message)
+		require.NoError(t, err)
+		response, err := parseXML(data)
+		require.NoError(t, err)
+		require.Equal(t, "_request", response.attr("InResponseTo"))
+		return response
+	}
+
+	var sessionIndex string
+	t.Run("signs the user in with a signed request", func(t *testing.T) {
+		request, err := service.parseAuthnRequest(t.Context(), inboundMessage{Binding: bindingHTTPPost, Message: newAuthnRequest(t, true), RelayState: "/page"})
+		require.NoError(t, err)
+		require.Equal(t, nameIDFormatPersistent, request.NameIDFormat)
+
+		message, err := service.issueResponse(t.Context(), request, signIn{UserID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, "/page", message.RelayState)
+
+		response := parseResponse(t, message)
+		require.Equal(t, statusSuccess, response.childElement(protocolNamespace, "Status").childElement(protocolNamespace, "StatusCode").attr("Value"))
+
+		assertion := response.childElement(assertionNamespace, "Assertion")
+		_, err = verifyEnvelopedSignature(assertion, []*x509.Certificate{idpCertificate})
+		require.NoError(t, err)
+
+		subject := assertion.childElement(assertionNamespace, "Subject")
+		require.Equal(t, user.ID, subject.childElement(assertionNamespace, "NameID").text())
+		audience := assertion.childElement(assertionNamespace, "Conditions").childElement(assertionNamespace, "AudienceRestriction").childElement(assertionNamespace, "Audience")
+		require.Equal(t, testServiceProviderEntityID, audience.text())
+
+		attributes := map[string]string{}
+		for _, attribute := range assertion.childElement(assertionNamespace, "AttributeStatement").childElements(assertionNamespace, "Attribute") {
+			attributes[attribute.attr("Name")] = attribute.text()
+		}
+		// The user has no groups, so the groups attribute is left out
+		require.Equal(t, map[string]string{"mail": email, "department": "Engineering"}, attributes)
+
+		sessionIndex = assertion.childElement(assertionNamespace, "AuthnStatement").attr("SessionIndex")
+		require.NotEmpty(t, sessionIndex)
+	})
+
+	t.Run("unsigned request is rejected", func(t *testing.T) {
+		_, err := service.parseAuthnRequest(t.Context(), inboundMessage{Binding: bindingHTTPPost, Message: newAuthnRequest(t, false)})
+		require.ErrorContains(t, err, "must be signed")
+	})
+
+	t.Run("pending request is resumed once", func(t *testing.T) {
+		request, err := service.parseAuthnRequest(t.Context(), inboundMessage{Binding: bindingHTTPPost, Message: newAuthnRequest(t, true)})
+		require.NoError(t, err)
+
+		id, err := service.storePendingRequest(t.Context(), request)
+		require.NoError(t, err)
+
+		resumed, err := service.consumePendingRequest(t.Context(), id)
+		require.NoError(t, err)
+		require.Equal(t, serviceProvider.ID, resumed.ServiceProvider.ID)
+		require.Equal(t, "https://sp.example.com/saml/acs", resumed.ACSURL)
+
+		_, err = service.consumePendingRequest(t.Context(), id)
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("group restriction denies the sign in", func(t *testing.T) {
+		err := db.Model(&ServiceProvider{Base: model.Base{ID: serviceProvider.ID}}).Update("is_group_restricted", true).Error
+		require.NoError(t, err)
+		defer db.Model(&ServiceProvider{Base: model.Base{ID: serviceProvider.ID}}).Update("is_group_restricted", false)
+
+		request, err := service.parseAuthnRequest(t.Context(), inboundMessage{Binding: bindingHTTPPost, Message: newAuthnRequest(t, true)})
+		require.NoError(t, err)
+
+		message, err := service.issueResponse(t.Context(), request, signIn{UserID: user.ID})
+		require.NoError(t, err)
+
+		response := parseResponse(t, message)
+		_, err = verifyEnvelopedSignature(response, []*x509.Certificate{idpCertificate})
+		require.NoError(t, err)
+		statusCode := response.childElement(protocolNamespace, "Status").childElement(protocolNamespace, "StatusCode")
+		require.Equal(t, statusResponder, statusCode.attr("Value"))
+		require.Equal(t, statusRequestDenied, statusCode.childElement(protocolNamespace, "StatusCode").attr("Value"))
+		require.Nil(t, response.childElement(assertionNamespace, "Assertion"))
+	})
+
+	t.Run("single logout ends the sessions", func(t *testing.T) {
+		request := newElement("samlp", "LogoutRequest").
+			declareNamespace("samlp", protocolNamespace).
+			declareNamespace("saml", assertionNamespace).
+			setAttr("ID", "_logout").
+			setAttr("Version", "2.0").
+			setAttr("IssueInstant", formatTime(spCertificate.NotBefore))
+		request.appendChild(newElement("saml", "Issuer")).appendText(testServiceProviderEntityID)
+		request.appendChild(newElement("saml", "NameID")).appendText(user.ID)
+		request.appendChild(newElement("samlp", "SessionIndex")).appendText(sessionIndex)
+
+		encoded, err := encodeRedirectMessage(marshalXML(request))
+		require.NoError(t, err)
+		query, err := signRedirectQuery("SAMLRequest", encoded, "", spKey)
+		require.NoError(t, err)
+		inbound, err := parseRedirectMessage(query, "SAMLRequest")
+		require.NoError(t, err)
+
+		message, signedOut, err := service.logout(t.Context(), inbound, user.ID, "browser-session")
+		require.NoError(t, err)
+		require.True(t, signedOut)
+		require.Equal(t, []string{"browser-session"}, sessions.loggedOut)
+
+		var count int64
+		require.NoError(t, db.Model(&Session{}).Where("id = ?", sessionIndex).Count(&count).Error)
+		require.Zero(t, count)
+
+		// The response is delivered with the HTTP-Redirect binding and signed by the identity provider
+		require.Equal(t, bindingHTTPRedirect, message.Binding)
+		responseURL, err := url.Parse(message.URL)
+		require.NoError(t, err)
+		require.Equal(t, "sp.example.com", responseURL.Host)
+		response, err := parseRedirectMessage(responseURL.RawQuery, "SAMLResponse")
+		require.NoError(t, err)
+		require.NoError(t, verifyRedirectSignature(response.Parameters, "SAMLResponse", []*x509.Certificate{idpCertificate}))
+
+		t.Run("unsigned logout request is rejected", func(t *testing.T) {
+			unsigned, err := parseRedirectMessage("SAMLRequest="+url.QueryEscape(inbound.Message), "SAMLRequest")
+			require.NoError(t, err)
+			_, _, err = service.logout(t.Context(), unsigned, user.ID, "browser-session")
+			require.ErrorContains(t, err, "must be signed")
+		})
+	})
+}
@@ -0,0 +1,391 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	dsNamespace    = "http://www.w3.org/2000/09/xmldsig#"
+	excC14NMethod  = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSig   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	digestSHA256   = "http://www.w3.org/2001/04/xmlenc#sha256"
+	digestSHA512   = "http://www.w3.org/2001/04/xmlenc#sha512"
+	sigRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	sigRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	sigECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	sigECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	sigEd25519     = "http://www.w3.org/2021/04/xmldsig-more#eddsa-ed25519"
+)
+
+// errSignatureMissing is returned when a message isn't signed at all, which is only acceptable if the service provider
+// doesn't have to sign its messages
+var errSignatureMissing = errors.New("message is not signed")
+
+// digestMethods are the supported digest algorithms; SHA-1 is deliberately not supported
+var digestMethods = map[string]crypto.Hash{
+	digestSHA256: crypto.SHA256,
+	digestSHA512: crypto.SHA512,
+}
+
+// signatureMethods are the supported signature algorithms and the hash they use; Ed25519 signs the message itself
+var signatureMethods = map[string]crypto.Hash{
+	sigRSASHA256:   crypto.SHA256,
+	sigRSASHA512:   crypto.SHA512,
+	sigECDSASHA256: crypto.SHA256,
+	sigECDSASHA512: crypto.SHA512,
+	sigEd25519:     0,
+}
+
+// signatureMethodForKey returns the signature algorithm the key signs with
+func signatureMethodForKey(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return sigRSASHA256, nil
+	case *ecdsa.PrivateKey:
+		return sigECDSASHA256, nil
+	case ed25519.PrivateKey:
+		return sigEd25519, nil
+	default:
+		return "", fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// signData signs the data with the key, using the signature algorithm returned by signatureMethodForKey
+func signData(key crypto.Signer, data []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write(data)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write(data)
+		return ecdsaSign(rand.Reader, k, digest.Sum(nil))
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// verifyData verifies the signature of the data with the public key of one of the certificates
+func verifyData(certificates []*x509.Certificate, method string, data, signature []byte) error {
+	hash, ok := signatureMethods[method]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm '%s'", method)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+
+	for _, certificate := range certificates {
+		switch pub := certificate.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if (method == sigRSASHA256 || method == sigRSASHA512) && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if (method == sigECDSASHA256 || method == sigECDSASHA512) && len(signature)%2 == 0 {
+				r := new(big.Int).SetBytes(signature[:len(signature)/2])
+				s := new(big.Int).SetBytes(signature[len(signature)/2:])
+				if ecdsa.Verify(pub, digest, r, s) {
+					return nil
+				}
+			}
+		case ed25519.PublicKey:
+			if method == sigEd25519 && ed25519.Verify(pub, data, signature) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("signature is invalid")
+}
+
+// signEnveloped adds an enveloped signature over the element to it, at the given child index
+// The signature references the element by its ID attribute and embeds the certificate, so service providers can match it
+// against the certificate in the identity provider's metadata
+func signEnveloped(e *xmlElement, index int, key crypto.Signer, certificate []byte) error {
+	if e.attr("ID") == "" {
+		return errors.New("element to sign has no ID")
+	}
+	method, err := signatureMethodForKey(key)
+	if err != nil {
+		return err
+	}
+
+	var signer crypto.Signer
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signer = k
+	case *ecdsa.PrivateKey:
+		signer = ecdsaXMLSigner{key: k}
+	default:
+		return fmt.Errorf("XML signatures with %T keys are not supported, SAML requires an RSA or ECDSA signing key", key)
+	}
+
+	signingContext, err := dsig.NewSigningContext(signer, [][]byte{certificate})
+	if err != nil {
+		return err
+	}
+	signingContext.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	err = signingContext.SetSignatureMethod(method)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signingContext.ConstructSignature(e.detachedEtree(), true)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+
+	e.insertChild(index, fromEtree(signature))
+	return nil
+}
+
+// verifyEnvelopedSignature verifies the enveloped signature of the root element of a message with the certificates of the
+// service provider and returns the signed element, without the signature
+// Only a signature that is a direct child of the root and covers the whole root element is accepted, so the signed
+// content is exactly the message that is processed afterwards, which prevents signature wrapping attacks
+func verifyEnvelopedSignature(root *xmlElement, certificates []*x509.Certificate) (*xmlElement, error) {
+	signatures := root.childElements(dsNamespace, "Signature")
+	if len(signatures) == 0 {
+		return nil, errSignatureMissing
+	}
+	if len(signatures) > 1 {
+		return nil, errors.New("message has more than one signature")
+	}
+	signature := signatures[0]
+
+	// The XML signature library accepts more than SAML messages need, so the signature is restricted to an enveloped
+	// signature with exclusive canonicalization and without SHA-1 first
+	signedInfo := signature.childElement(dsNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("signature has no SignedInfo")
+	}
+
+	c14nMethod := signedInfo.childElement(dsNamespace, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != excC14NMethod {
+		return nil, errors.New("unsupported canonicalization method, only exclusive canonicalization is supported")
+	}
+	signatureMethod := signedInfo.childElement(dsNamespace, "SignatureMethod")
+	if signatureMethod == nil {
+		return nil, errors.New("signature has no SignatureMethod")
+	}
+	method := signatureMethod.attr("Algorithm")
+	if _, ok := signatureMethods[method]; !ok || method == sigEd25519 {
+		return nil, fmt.Errorf("unsupported signature algorithm '%s'", method)
+	}
+
+	references := signedInfo.childElements(dsNamespace, "Reference")
+	if len(references) != 1 {
+		return nil, errors.New("signature must have exactly one reference")
+	}
+	reference := references[0]
+	id := root.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return nil, errors.New("signature doesn't reference the message")
+	}
+
+	enveloped := false
+	canonicalized := false
+	if transforms := reference.childElement(dsNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.childElements(dsNamespace, "Transform") {
+			switch transform.attr("Algorithm") {
+			case envelopedSig:
+				enveloped = true
+			case excC14NMethod:
+				canonicalized = true
+			default:
+				return nil, fmt.Errorf("unsupported transform '%s'", transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !canonicalized {
+		return nil, errors.New("signature must be an enveloped signature with exclusive canonicalization")
+	}
+
+	digestMethod := reference.childElement(dsNamespace, "DigestMethod")
+	if digestMethod == nil {
+		return nil, errors.New("reference has no DigestMethod")
+	}
+	if _, ok := digestMethods[digestMethod.attr("Algorithm")]; !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm '%s'", digestMethod.attr("Algorithm"))
+	}
+
+	// The element trees have the same children in the same order
+	el := root.detachedEtree()
+	signatureElement := el.Child[slices.Index(root.Children, any(signature))].(*etree.Element)
+
+	signatureValue := signature.childElement(dsNamespace, "SignatureValue")
+	if signatureValue == nil {
+		return nil, errors.New("signature has no SignatureValue")
+	}
+	if method == sigECDSASHA256 || method == sigECDSASHA512 {
+		value, err := ecdsaSignatureToASN1(signatureValue.text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid SignatureValue: %w", err)
+		}
+		signatureElement.Child[slices.Index(signature.Children, any(signatureValue))].(*etree.Element).SetText(value)
+	}
+
+	// Only the certificates from the metadata of the service provider are trusted, so the certificate in the KeyInfo
+	// isn't needed
+	for i := len(signature.Children) - 1; i >= 0; i-- {
+		if child, ok := signature.Children[i].(*xmlElement); ok && child.is(dsNamespace, "KeyInfo") {
+			signatureElement.RemoveChildAt(i)
+		}
+	}
+
+	var errs []error
+	for _, certificate := range certificates {
+		// The certificates in the metadata are trusted for their keys, as other SAML implementations do, so they're still
+		// accepted after they expired; the library checks the validity period against its clock, which is set to the
+		// start of it for that reason
+		validationContext := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{certificate}})
+		validationContext.Clock = dsig.NewFakeClockAt(certificate.NotBefore)
+
+		validated, err := validationContext.Validate(el)
+		if err == nil {
+			return fromEtree(validated), nil
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, fmt.Errorf("signature is invalid: %w", errors.Join(errs...))
+}
+
+// ecdsaXMLSigner signs with an ECDSA key in the format of XML signatures, which is the concatenation of r and s, instead
+// of the ASN.1 structure that crypto.Signer returns
+type ecdsaXMLSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s ecdsaXMLSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s ecdsaXMLSigner) Sign(random io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return ecdsaSign(random, s.key, digest)
+}
+
+// ecdsaSign signs the digest with an ECDSA key and returns the signature in the format of XML signatures, the
+// concatenation of r and s, each padded to the size of the curve
+func ecdsaSign(random io.Reader, key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(random, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature, nil
+}
+
+// ecdsaSignatureToASN1 converts a base64 encoded ECDSA signature of an XML signature to the base64 encoded ASN.1
+// structure that the XML signature library verifies
+func ecdsaSignatureToASN1(value string) (string, error) {
+	signature, err := decodeBase64(value)
+	if err != nil {
+		return "", err
+	}
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return "", errors.New("ECDSA signature has an invalid length")
+	}
+
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:len(signature)/2]),
+		S: new(big.Int).SetBytes(signature[len(signature)/2:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// signRedirectQuery signs a message for the HTTP-Redirect binding and returns the query string to append to the endpoint
+// (SAML bindings section 3.4.4.1)
+func signRedirectQuery(parameter, encodedMessage, relayState string, key crypto.Signer) (string, error) {
+	method, err := signatureMethodForKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	query := parameter + "=" + url.QueryEscape(encodedMessage)
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query += "&SigAlg=" + url.QueryEscape(method)
+
+	signature, err := signData(key, []byte(query))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign: %w", err)
+	}
+
+	return query + "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+// verifyRedirectSignature verifies the signature of a message received with the HTTP-Redirect binding
+// The signature covers the parameters exactly as they were encoded by the sender, so they're taken from the raw query
+func verifyRedirectSignature(parameters redirectParameters, parameter string, certificates []*x509.Certificate) error {
+	signature, ok := parameters["Signature"]
+	if !ok || signature == "" {
+		return errSignatureMissing
+	}
+	sigAlg, ok := parameters["SigAlg"]
+	if !ok {
+		return errors.New("signed message has no SigAlg")
+	}
+	message, ok := parameters[parameter]
+	if !ok {
+		return fmt.Errorf("signed message has no %s", parameter)
+	}
+
+	method, err := url.QueryUnescape(sigAlg)
+	if err != nil {
+		return fmt.Errorf("invalid SigAlg: %w", err)
+	}
+	decodedSignature, err := url.QueryUnescape(signature)
+	if err != nil {
+		return fmt.Errorf("invalid Signature: %w", err)
+	}
+	signatureValue, err := decodeBase64(decodedSignature)
+	if err != nil {
+		return fmt.Errorf("invalid Signature: %w", err)
+	}
+
+	signedQuery := parameter + "=" + message
+	if relayState, ok := parameters["RelayState"]; ok {
+		signedQuery += "&RelayState=" + relayState
+	}
+	signedQuery += "&SigAlg=" + sigAlg
+
+	return verifyData(certificates, method, []byte(signedQuery), signatureValue)
+}
+
+// decodeBase64 decodes base64 that may be wrapped over multiple lines, as it often is in XML documents
+func decodeBase64(value string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+}
@@ -0,0 +1,388 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndMarshalXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "keeps namespace prefixes and declarations",
+			input:    `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" b:y="2"><a:child xmlns="urn:default">text</a:child></a:root>`,
+			expected: `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" b:y="2"><a:child xmlns="urn:default">text</a:child></a:root>`,
+		},
+		{
+			name:     "expands empty elements and drops comments and the declaration",
+			input:    "<?xml version=\"1.0\"?>\n<root><!-- comment --><empty/></root>",
+			expected: `<root><empty></empty></root>`,
+		},
+		{
+			name:     "escapes text and attribute values",
+			input:    `<root attr="&quot;&lt;&gt;&#9;&#10;">a &amp; b &lt; c &gt; d<![CDATA[<e>]]></root>`,
+			expected: `<root attr="&quot;&lt;>&#x9;&#xA;">a &amp; b &lt; c &gt; d&lt;e&gt;</root>`,
+		},
+		{
+			name:     "normalizes literal whitespace in attribute values, but not in character references, comments or CDATA",
+			input:    "<root attr=\"a\tb\r\nc&#9;\" other='d\ne'><!-- \"\t --><![CDATA[\"\t]]></root>",
+			expected: "<root attr=\"a b c&#x9;\" other=\"d e\">\"\t</root>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseXML([]byte(tt.input))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(marshalXML(root)))
+		})
+	}
+
+	t.Run("detached element declares the namespaces it inherits", func(t *testing.T) {
+		root, err := parseXML([]byte(`<a:root xmlns:a="urn:a" xmlns:b="urn:b"><a:child b:attr="1"><c/></a:child></a:root>`))
+		require.NoError(t, err)
+
+		child := root.childElement("urn:a", "child")
+		require.Equal(t, map[string]string{"a": "urn:a", "b": "urn:b"}, fromEtree(child.detachedEtree()).Namespaces)
+	})
+
+	t.Run("rejects DTDs", func(t *testing.T) {
+		_, err := parseXML([]byte(`<!DOCTYPE root [<!ENTITY x "x">]><root>&x;</root>`))
+		require.Error(t, err)
+	})
+}
+
+func TestEnvelopedSignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecdsaKey} {
+		t.Run(name, func(t *testing.T) {
+			certificate := newTestCertificate(t, key)
+
+			message := newElement("samlp", "Message").
+				declareNamespace("samlp", protocolNamespace).
+				declareNamespace("saml", assertionNamespace).
+				setAttr("ID", newID())
+			message.appendChild(newElement("saml", "Issuer")).appendText("https://sp.example.com")
+			message.appendChild(newElement("saml", "NameID")).appendText("user & co")
+			require.NoError(t, signEnveloped(message, 1, key, certificate.Raw))
+
+			signed := string(marshalXML(message))
+			certificates := []*x509.Certificate{certificate}
+
+			root, err := parseXML([]byte(signed))
+			require.NoError(t, err)
+			verified, err := verifyEnvelopedSignature(root, certificates)
+			require.NoError(t, err)
+
+			// The signature must follow the Issuer, and the verified message is the signed one without it
+			require.True(t, root.Children[1].(*xmlElement).is(dsNamespace, "Signature"))
+			require.Nil(t, verified.childElement(dsNamespace, "Signature"))
+			require.Equal(t, "user & co", verified.childElement(assertionNamespace, "NameID").text())
+
+			tampered, err := parseXML([]byte(strings.Replace(signed, "user &amp; co", "admin", 1)))
+			require.NoError(t, err)
+			_, err = verifyEnvelopedSignature(tampered, certificates)
+			require.ErrorContains(t, err, "signature is invalid")
+
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			_, err = verifyEnvelopedSignature(root, []*x509.Certificate{newTestCertificate(t, otherKey)})
+			require.Error(t, err)
+
+			// A certificate of the service provider that isn't the signing one doesn't matter
+			verified, err = verifyEnvelopedSignature(root, []*x509.Certificate{newTestCertificate(t, otherKey), certificate})
+			require.NoError(t, err)
+			require.NotNil(t, verified)
+
+			unsigned, err := parseXML([]byte(`<samlp:Message xmlns:samlp="` + protocolNamespace + `" ID="_1"></samlp:Message>`))
+			require.NoError(t, err)
+			_, err = verifyEnvelopedSignature(unsigned, certificates)
+			require.ErrorIs(t, err, errSignatureMissing)
+		})
+	}
+
+	t.Run("accepts whitespace in attribute values that XML processors normalize", func(t *testing.T) {
+		certificate := newTestCertificate(t, rsaKey)
+
+		message := newElement("samlp", "Message").
+			declareNamespace("samlp", protocolNamespace).
+			setAttr("ID", newID()).
+			setAttr("Consent", "literal tab and newline").
+			setAttr("ProviderName", "refs\t\n\r\"<>&'")
+		require.NoError(t, signEnveloped(message, 0, rsaKey, certificate.Raw))
+
+		document := strings.Replace(string(marshalXML(message)), `Consent="literal tab and newline"`, "Consent=\"literal\ttab and\r\nnewline\"", 1)
+		root, err := parseXML([]byte(document))
+		require.NoError(t, err)
+		verified, err := verifyEnvelopedSignature(root, []*x509.Certificate{certificate})
+		require.NoError(t, err)
+		require.Equal(t, "refs\t\n\r\"<>&'", verified.attr("ProviderName"))
+	})
+
+	t.Run("signs a nested element with the namespaces it inherits", func(t *testing.T) {
+		certificate := newTestCertificate(t, ecdsaKey)
+
+		response := newElement("samlp", "Response").
+			declareNamespace("samlp", protocolNamespace).
+			declareNamespace("saml", assertionNamespace).
+			setAttr("ID", newID())
+		assertion := response.appendChild(newElement("saml", "Assertion")).setAttr("ID", newID())
+		assertion.appendChild(newElement("saml", "Issuer")).appendText("https://idp.example.com")
+		require.NoError(t, signEnveloped(assertion, 1, ecdsaKey, certificate.Raw))
+
+		root, err := parseXML(marshalXML(response))
+		require.NoError(t, err)
+		_, err = verifyEnvelopedSignature(root.childElement(assertionNamespace, "Assertion"), []*x509.Certificate{certificate})
+		require.NoError(t, err)
+	})
+
+	t.Run("Ed25519 keys are rejected", func(t *testing.T) {
+		message := newElement("samlp", "Message").declareNamespace("samlp", protocolNamespace).setAttr("ID", "_signed")
+		require.ErrorContains(t, signEnveloped(message, 0, ed25519Key, newTestCertificate(t, ed25519Key).Raw), "requires an RSA or ECDSA signing key")
+	})
+
+	t.Run("signature must reference the root element", func(t *testing.T) {
+		certificate := newTestCertificate(t, rsaKey)
+
+		message := newElement("samlp", "Message").declareNamespace("samlp", protocolNamespace).setAttr("ID", "_signed")
+		require.NoError(t, signEnveloped(message, 0, rsaKey, certificate.Raw))
+		message.setAttr("ID", "_other")
+
+		root, err := parseXML(marshalXML(message))
+		require.NoError(t, err)
+		_, err = verifyEnvelopedSignature(root, []*x509.Certificate{certificate})
+		require.ErrorContains(t, err, "doesn't reference the message")
+	})
+}
+
+// The fixtures in testdata were signed by libxmlsec1, so they verify the canonicalization and signature verification
+// against an independent implementation (see testdata/README.md)
+func TestEnvelopedSignatureInterop(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		certificate string
+	}{
+		{"authn-request-rsa.xml", "sp-rsa.crt"},
+		{"logout-request-ecdsa.xml", "sp-ecdsa.crt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			root, err := parseXML([]byte(readFixture(t, tt.fixture)))
+			require.NoError(t, err)
+			_, err = verifyEnvelopedSignature(root, []*x509.Certificate{readFixtureCertificate(t, tt.certificate)})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("accepts line breaks that XML processors normalize", func(t *testing.T) {
+		document := strings.ReplaceAll(readFixture(t, "authn-request-rsa.xml"), "\n", "\r\n")
+
+		root, err := parseXML([]byte(document))
+		require.NoError(t, err)
+		_, err = verifyEnvelopedSignature(root, []*x509.Certificate{readFixtureCertificate(t, "sp-rsa.crt")})
+		require.NoError(t, err)
+	})
+
+	// The canonicalization of the XML signature library differs from libxmlsec1 for attributes with different namespace
+	// prefixes and for undeclarations of an unused default namespace, which c14n-rsa.xml contains
+	// Such messages must be rejected, and never be read differently than they were signed
+	t.Run("rejects canonicalization the library doesn't support", func(t *testing.T) {
+		root, err := parseXML([]byte(readFixture(t, "c14n-rsa.xml")))
+		require.NoError(t, err)
+		_, err = verifyEnvelopedSignature(root, []*x509.Certificate{readFixtureCertificate(t, "sp-rsa.crt")})
+		require.ErrorContains(t, err, "signature is invalid")
+	})
+
+	t.Run("rejects modified messages", func(t *testing.T) {
+		document := strings.Replace(readFixture(t, "authn-request-rsa.xml"), `AllowCreate="true"`, `AllowCreate="false"`, 1)
+
+		root, err := parseXML([]byte(document))
+		require.NoError(t, err)
+		_, err = verifyEnvelopedSignature(root, []*x509.Certificate{readFixtureCertificate(t, "sp-rsa.crt")})
+		require.ErrorContains(t, err, "signature is invalid")
+	})
+}
+
+func TestEnvelopedSignatureWrapping(t *testing.T) {
+	certificates := []*x509.Certificate{readFixtureCertificate(t, "sp-rsa.crt")}
+
+	signed := readFixture(t, "authn-request-rsa.xml")
+	signed = signed[strings.Index(signed, "<samlp:AuthnRequest"):]
+	signature := signed[strings.Index(signed, "<ds:Signature") : strings.Index(signed, "</ds:Signature>")+len("</ds:Signature>")]
+	unsigned := strings.Replace(signed, signature, "", 1)
+	id := "_8e8dc5f69a98cc4c1ff3427e5ce34606fd672f91e6"
+
+	forged := func(id, content string) string {
+		return `<samlp:AuthnRequest xmlns:samlp="` + protocolNamespace + `" xmlns:saml="` + assertionNamespace + `" ID="` + id + `" Version="2.0">` +
+			`<saml:Issuer>https://sp.example.com/metadata</saml:Issuer>` + content + `</samlp:AuthnRequest>`
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{
+			name:     "signed message wrapped in an unsigned one",
+			document: forged("_forged", "<samlp:Extensions>"+signed+"</samlp:Extensions>"),
+			err:      errSignatureMissing.Error(),
+		},
+		{
+			name:     "signature moved to a message that wraps the signed one",
+			document: forged("_forged", signature+"<samlp:Extensions>"+unsigned+"</samlp:Extensions>"),
+			err:      "doesn't reference the message",
+		},
+		{
+			name:     "signed message wrapped in one with the same ID",
+			document: forged(id, signature+"<samlp:Extensions>"+unsigned+"</samlp:Extensions>"),
+			err:      "signature is invalid",
+		},
+		{
+			name:     "signature moved into a child element",
+			document: strings.Replace(unsigned, "</samlp:RequestedAuthnContext>", signature+"</samlp:RequestedAuthnContext>", 1),
+			err:      errSignatureMissing.Error(),
+		},
+		{
+			name:     "second signature",
+			document: strings.Replace(signed, signature, signature+signature, 1),
+			err:      "more than one signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseXML([]byte(tt.document))
+			require.NoError(t, err)
+			_, err = verifyEnvelopedSignature(root, certificates)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+// Comments and CDATA sections aren't part of the canonical form, so inserting them keeps the signature valid
+// The values read from the message must still be the complete signed values, and not end at the comment
+func TestEnvelopedSignatureCommentInjection(t *testing.T) {
+	certificates := []*x509.Certificate{readFixtureCertificate(t, "sp-ecdsa.crt")}
+	signed := readFixture(t, "logout-request-ecdsa.xml")
+
+	for name, separator := range map[string]string{"comment": "<!---->", "CDATA section": "<![CDATA[]]>"} {
+		t.Run(name, func(t *testing.T) {
+			document := strings.Replace(signed, "jürgen@example.com.evil.example", "jürgen@example.com"+separator+".evil.example", 1)
+			document = strings.Replace(document, ">https://sp.example.com/metadata<", ">https://sp.example.com"+separator+"/metadata<", 1)
+
+			root, err := parseXML([]byte(document))
+			require.NoError(t, err)
+			verified, err := verifyEnvelopedSignature(root, certificates)
+			require.NoError(t, err)
+
+			request, err := parseLogoutRequest(verified)
+			require.NoError(t, err)
+			require.Equal(t, "jürgen@example.com.evil.example", request.NameID)
+			require.Equal(t, "https://sp.example.com/metadata", request.Issuer)
+		})
+	}
+}
+
+func TestRedirectSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	certificates := []*x509.Certificate{newTestCertificate(t, key)}
+
+	encoded, err := encodeRedirectMessage([]byte(`<samlp:LogoutResponse xmlns:samlp="` + protocolNamespace + `"></samlp:LogoutResponse>`))
+	require.NoError(t, err)
+
+	query, err := signRedirectQuery("SAMLResponse", encoded, "state with spaces", key)
+	require.NoError(t, err)
+
+	verify := func(query string) error {
+		message, err := parseRedirectMessage(query, "SAMLResponse")
+		if err != nil {
+			return err
+		}
+		return verifyRedirectSignature(message.Parameters, "SAMLResponse", certificates)
+	}
+
+	require.NoError(t, verify(query))
+
+	message, err := parseRedirectMessage(query, "SAMLResponse")
+	require.NoError(t, err)
+	require.Equal(t, "state with spaces", message.RelayState)
+	decoded, err := message.decode()
+	require.NoError(t, err)
+	require.Contains(t, string(decoded), "LogoutResponse")
+
+	tampered := strings.Replace(query, "RelayState=state", "RelayState=other", 1)
+	require.Error(t, verify(tampered))
+
+	require.ErrorIs(t, verify("SAMLResponse="+encoded), errSignatureMissing)
+
+	t.Run("duplicate parameters are rejected", func(t *testing.T) {
+		forged, err := encodeRedirectMessage([]byte(`<samlp:LogoutResponse xmlns:samlp="` + protocolNamespace + `" ID="forged"></samlp:LogoutResponse>`))
+		require.NoError(t, err)
+
+		for name, query := range map[string]string{
+			"message before a signed query":   "SAMLResponse=" + url.QueryEscape(forged) + "&" + query,
+			"message after a signed query":    query + "&SAMLResponse=" + url.QueryEscape(forged),
+			"encoded parameter name":          "SAML%52esponse=" + url.QueryEscape(forged) + "&" + query,
+			"relay state before signed query": "RelayState=other&" + query,
+			"second signature":                query + "&Signature=AAAA",
+			"second signature algorithm":      query + "&SigAlg=" + url.QueryEscape(sigRSASHA256),
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := parseRedirectMessage(query, "SAMLResponse")
+				require.ErrorContains(t, err, "must not appear more than once")
+			})
+		}
+	})
+}
+
+func newTestCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	der, err := createCertificate(key, "https://example.com")
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func readFixtureCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(readFixture(t, name)))
+	require.NotNil(t, block)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return certificate
+}
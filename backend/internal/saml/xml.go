@@ -0,0 +1,394 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// maxXMLDepth limits how deeply elements of messages from service providers may be nested
+const maxXMLDepth = 64
+
+// xmlElement is an element of a parsed or generated XML document
+// The standard library's encoding/xml doesn't keep namespace prefixes and declarations, which XML signatures depend on,
+// so SAML messages are handled as a small tree that keeps them exactly as they were in the document
+// It's converted to the tree of the etree package to sign and verify messages
+type xmlElement struct {
+	Prefix string
+	Local  string
+	// Namespaces are the namespace declarations on this element, keyed by prefix; the default namespace has an empty prefix
+	Namespaces map[string]string
+	Attrs      []xmlAttr
+	// Children are *xmlElement and xmlText nodes in document order
+	Children []any
+
+	parent *xmlElement
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+type xmlText string
+
+// newElement creates an element with the prefix of the namespace it belongs to
+func newElement(prefix, local string) *xmlElement {
+	return &xmlElement{Prefix: prefix, Local: local}
+}
+
+// declareNamespace declares a namespace on the element
+func (e *xmlElement) declareNamespace(prefix, uri string) *xmlElement {
+	if e.Namespaces == nil {
+		e.Namespaces = map[string]string{}
+	}
+	e.Namespaces[prefix] = uri
+	return e
+}
+
+// setAttr sets an attribute without namespace, replacing an existing attribute with the same name
+func (e *xmlElement) setAttr(local, value string) *xmlElement {
+	for i := range e.Attrs {
+		if e.Attrs[i].Prefix == "" && e.Attrs[i].Local == local {
+			e.Attrs[i].Value = value
+			return e
+		}
+	}
+	e.Attrs = append(e.Attrs, xmlAttr{Local: local, Value: value})
+	return e
+}
+
+// attr returns the value of the attribute without namespace with the given name
+func (e *xmlElement) attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// appendChild appends the child element and returns it
+func (e *xmlElement) appendChild(child *xmlElement) *xmlElement {
+	child.parent = e
+	e.Children = append(e.Children, child)
+	return child
+}
+
+// insertChild inserts the child element before the child node at the given index
+func (e *xmlElement) insertChild(index int, child *xmlElement) {
+	child.parent = e
+	e.Children = slices.Insert(e.Children, index, any(child))
+}
+
+// appendText appends a text node
+func (e *xmlElement) appendText(text string) *xmlElement {
+	e.Children = append(e.Children, xmlText(text))
+	return e
+}
+
+// text returns the concatenated text content of the element
+func (e *xmlElement) text() string {
+	var sb strings.Builder
+	for _, child := range e.Children {
+		switch n := child.(type) {
+		case xmlText:
+			sb.WriteString(string(n))
+		case *xmlElement:
+			sb.WriteString(n.text())
+		}
+	}
+	return sb.String()
+}
+
+// namespaceURI returns the namespace the element belongs to
+func (e *xmlElement) namespaceURI() string {
+	return e.lookupNamespace(e.Prefix)
+}
+
+// lookupNamespace resolves the prefix with the namespace declarations that are in scope for the element
+func (e *xmlElement) lookupNamespace(prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespace
+	}
+	for el := e; el != nil; el = el.parent {
+		if uri, ok := el.Namespaces[prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// is reports whether the element has the given namespace and local name
+func (e *xmlElement) is(namespace, local string) bool {
+	return e.Local == local && e.namespaceURI() == namespace
+}
+
+// childElements returns the child elements with the given namespace and local name
+func (e *xmlElement) childElements(namespace, local string) []*xmlElement {
+	var elements []*xmlElement
+	for _, child := range e.Children {
+		if el, ok := child.(*xmlElement); ok && el.is(namespace, local) {
+			elements = append(elements, el)
+		}
+	}
+	return elements
+}
+
+// childElement returns the first child element with the given namespace and local name, or nil
+func (e *xmlElement) childElement(namespace, local string) *xmlElement {
+	elements := e.childElements(namespace, local)
+	if len(elements) == 0 {
+		return nil
+	}
+	return elements[0]
+}
+
+// parseXML parses a document into an element tree
+// Documents with a DTD are rejected to prevent entity expansion attacks, and processing instructions are only allowed
+// before the root element, because the tree doesn't keep them
+func parseXML(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(normalizeAttributeWhitespace(data)))
+	decoder.Strict = true
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 && root != nil {
+				return nil, errors.New("invalid XML: multiple root elements")
+			}
+			if len(stack) >= maxXMLDepth {
+				return nil, errors.New("invalid XML: elements are nested too deeply")
+			}
+
+			el := &xmlElement{Prefix: t.Name.Space, Local: t.Name.Local}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					el.declareNamespace(a.Name.Local, a.Value)
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.declareNamespace("", a.Value)
+				default:
+					el.Attrs = append(el.Attrs, xmlAttr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+				}
+			}
+
+			if len(stack) == 0 {
+				root = el
+			} else {
+				stack[len(stack)-1].appendChild(el)
+			}
+			stack = append(stack, el)
+
+			if el.Prefix != "" && el.lookupNamespace(el.Prefix) == "" {
+				return nil, fmt.Errorf("invalid XML: undeclared namespace prefix '%s'", el.Prefix)
+			}
+			for _, a := range el.Attrs {
+				if a.Prefix != "" && el.lookupNamespace(a.Prefix) == "" {
+					return nil, fmt.Errorf("invalid XML: undeclared namespace prefix '%s'", a.Prefix)
+				}
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("invalid XML: unexpected end element")
+			}
+			current := stack[len(stack)-1]
+			if current.Prefix != t.Name.Space || current.Local != t.Name.Local {
+				return nil, fmt.Errorf("invalid XML: element '%s' closed by '%s'", current.Local, t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].appendText(string(t))
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("invalid XML: text outside of the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("invalid XML: DTDs are not allowed")
+		case xml.ProcInst:
+			if root != nil {
+				return nil, errors.New("invalid XML: processing instructions are only allowed before the root element")
+			}
+		case xml.Comment:
+			// Comments are not part of the canonical form that signatures cover
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("invalid XML: no root element")
+	}
+	if len(stack) > 0 {
+		return nil, errors.New("invalid XML: unexpected end of document")
+	}
+
+	return root, nil
+}
+
+// normalizeAttributeWhitespace replaces the literal whitespace characters in attribute values with spaces, as XML
+// processors must (https://www.w3.org/TR/xml/#AVNormalize), which encoding/xml doesn't do
+// Canonicalization depends on it, as it escapes whitespace in attribute values, so without it the canonical form
+// wouldn't match the one the sender signed
+// It's done on the raw document, because whitespace written as a character reference must be kept
+func normalizeAttributeWhitespace(data []byte) []byte {
+	normalized := make([]byte, 0, len(data))
+	var quote byte
+	inTag := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case quote != 0:
+			switch c {
+			case quote:
+				quote = 0
+			case '\r':
+				// A line break is normalized to a single newline before it's replaced
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+				c = ' '
+			case '\n', '\t':
+				c = ' '
+			}
+		case inTag:
+			switch c {
+			case '"', '\'':
+				quote = c
+			case '>':
+				inTag = false
+			}
+		case c == '<':
+			// Comments, CDATA sections and processing instructions may contain quotes and are copied as they are
+			if end := markupSectionEnd(data[i:]); end > 0 {
+				normalized = append(normalized, data[i:i+end]...)
+				i += end - 1
+				continue
+			}
+			inTag = true
+		}
+		normalized = append(normalized, c)
+	}
+	return normalized
+}
+
+// markupSectionEnd returns the length of the comment, CDATA section or processing instruction the data starts with,
+// or 0 if it doesn't start with one
+// An unterminated section extends to the end of the data, so the decoder reports it
+func markupSectionEnd(data []byte) int {
+	for _, delimiters := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}, {"<?", "?>"}} {
+		start, end := delimiters[0], delimiters[1]
+		if !bytes.HasPrefix(data, []byte(start)) {
+			continue
+		}
+		if i := bytes.Index(data[len(start):], []byte(end)); i >= 0 {
+			return len(start) + i + len(end)
+		}
+		return len(data)
+	}
+	return 0
+}
+
+// marshalXML serializes the element tree into a document
+func marshalXML(e *xmlElement) []byte {
+	doc := etree.NewDocument()
+	doc.WriteSettings = etree.WriteSettings{CanonicalEndTags: true, CanonicalText: true, CanonicalAttrVal: true}
+	doc.SetRoot(e.toEtree())
+
+	var buf bytes.Buffer
+	// Writing to a buffer can't fail
+	_, _ = doc.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// toEtree converts the element tree into the tree of the etree package, which the XML signature library works with
+func (e *xmlElement) toEtree() *etree.Element {
+	el := etree.NewElement(e.Local)
+	el.Space = e.Prefix
+	for _, prefix := range slices.Sorted(maps.Keys(e.Namespaces)) {
+		el.CreateAttr(namespaceAttrName(prefix), e.Namespaces[prefix])
+	}
+	for _, a := range e.Attrs {
+		if a.Prefix == "" {
+			el.CreateAttr(a.Local, a.Value)
+		} else {
+			el.CreateAttr(a.Prefix+":"+a.Local, a.Value)
+		}
+	}
+	for _, child := range e.Children {
+		switch n := child.(type) {
+		case xmlText:
+			el.CreateText(string(n))
+		case *xmlElement:
+			el.AddChild(n.toEtree())
+		}
+	}
+	return el
+}
+
+// detachedEtree converts the element like toEtree, but also declares the namespaces it inherits from its ancestors on it,
+// so it can be processed on its own
+func (e *xmlElement) detachedEtree() *etree.Element {
+	el := e.toEtree()
+	declared := maps.Clone(e.Namespaces)
+	if declared == nil {
+		declared = map[string]string{}
+	}
+	for ancestor := e.parent; ancestor != nil; ancestor = ancestor.parent {
+		for _, prefix := range slices.Sorted(maps.Keys(ancestor.Namespaces)) {
+			if _, ok := declared[prefix]; !ok {
+				declared[prefix] = ancestor.Namespaces[prefix]
+				el.CreateAttr(namespaceAttrName(prefix), ancestor.Namespaces[prefix])
+			}
+		}
+	}
+	return el
+}
+
+func namespaceAttrName(prefix string) string {
+	if prefix == "" {
+		return "xmlns"
+	}
+	return "xmlns:" + prefix
+}
+
+// fromEtree converts an element of the etree package into the element tree
+// Comments and processing instructions are dropped, as parseXML does
+func fromEtree(el *etree.Element) *xmlElement {
+	e := newElement(el.Space, el.Tag)
+	for _, a := range el.Attr {
+		switch {
+		case a.Space == "xmlns":
+			e.declareNamespace(a.Key, a.Value)
+		case a.Space == "" && a.Key == "xmlns":
+			e.declareNamespace("", a.Value)
+		default:
+			e.Attrs = append(e.Attrs, xmlAttr{Prefix: a.Space, Local: a.Key, Value: a.Value})
+		}
+	}
+	for _, token := range el.Child {
+		switch t := token.(type) {
+		case *etree.CharData:
+			e.appendText(t.Data)
+		case *etree.Element:
+			e.appendChild(fromEtree(t))
+		}
+	}
+	return e
+}
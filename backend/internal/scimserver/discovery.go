@@ -0,0 +1,186 @@
+package scimserver
+
+import (
+	"encoding/json"
+)
+
+// schemaAttribute describes an attribute of a schema as defined in RFC 7643 section 7
+type schemaAttribute struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	MultiValued    bool              `json:"multiValued"`
+	Required       bool              `json:"required"`
+	CaseExact      bool              `json:"caseExact"`
+	Mutability     string            `json:"mutability"`
+	Returned       string            `json:"returned"`
+	Uniqueness     string            `json:"uniqueness"`
+	ReferenceTypes []string          `json:"referenceTypes,omitempty"`
+	SubAttributes  []schemaAttribute `json:"subAttributes,omitempty"`
+}
+
+func attribute(name, attributeType string, subAttributes ...schemaAttribute) schemaAttribute {
+	return schemaAttribute{
+		Name:          name,
+		Type:          attributeType,
+		Mutability:    "readWrite",
+		Returned:      "default",
+		Uniqueness:    "none",
+		SubAttributes: subAttributes,
+	}
+}
+
+func (a schemaAttribute) required() schemaAttribute {
+	a.Required = true
+	return a
+}
+
+func (a schemaAttribute) unique() schemaAttribute {
+	a.Uniqueness = "server"
+	return a
+}
+
+func (a schemaAttribute) readOnly() schemaAttribute {
+	a.Mutability = "readOnly"
+	return a
+}
+
+func (a schemaAttribute) multiValued() schemaAttribute {
+	a.MultiValued = true
+	return a
+}
+
+func (a schemaAttribute) references(types ...string) schemaAttribute {
+	a.ReferenceTypes = types
+	return a
+}
+
+// referenceAttribute is a multi-valued attribute that references other resources
+func referenceAttribute(name string, types ...string) schemaAttribute {
+	return attribute(name, "complex",
+		attribute("value", "string"),
+		attribute("$ref", "reference").references(types...),
+		attribute("display", "string"),
+		attribute("type", "string"),
+	).multiValued()
+}
+
+func serviceProviderConfig(appURL string) map[string]any {
+	return map[string]any{
+		"schemas":          []string{schemaServiceProviderConfig},
+		"documentationUri": "https://pocket-id.org/docs",
+		"patch":            map[string]any{"supported": true},
+		"bulk":             map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]any{"supported": true, "maxResults": maxCount},
+		"changePassword":   map[string]any{"supported": false},
+		"sort":             map[string]any{"supported": false},
+		"etag":             map[string]any{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "API key",
+			"description": "Authentication with an API key that was granted the SCIM scope",
+			"primary":     true,
+		}},
+		"meta": map[string]any{
+			"resourceType": "ServiceProviderConfig",
+			"location":     appURL + "/scim/v2/ServiceProviderConfig",
+		},
+	}
+}
+
+func resourceTypes(appURL string) []map[string]any {
+	return []map[string]any{
+		{
+			"schemas":     []string{schemaResourceType},
+			"id":          resourceTypeUser,
+			"name":        resourceTypeUser,
+			"endpoint":    "/Users",
+			"description": "User",
+			"schema":      schemaUser,
+			"schemaExtensions": []map[string]any{
+				{"schema": schemaEnterpriseUser, "required": false},
+			},
+			"meta": map[string]any{
+				"resourceType": "ResourceType",
+				"location":     appURL + "/scim/v2/ResourceTypes/" + resourceTypeUser,
+			},
+		},
+		{
+			"schemas":     []string{schemaResourceType},
+			"id":          resourceTypeGroup,
+			"name":        resourceTypeGroup,
+			"endpoint":    "/Groups",
+			"description": "Group",
+			"schema":      schemaGroup,
+			"meta": map[string]any{
+				"resourceType": "ResourceType",
+				"location":     appURL + "/scim/v2/ResourceTypes/" + resourceTypeGroup,
+			},
+		},
+	}
+}
+
+func schemas(appURL string) []map[string]any {
+	schema := func(id, name string, attributes ...schemaAttribute) map[string]any {
+		// Round trip through JSON so the attributes have the same representation as in the response
+		encoded, _ := json.Marshal(attributes)
+		var decoded []any
+		_ = json.Unmarshal(encoded, &decoded)
+
+		return map[string]any{
+			"schemas":    []string{schemaSchema},
+			"id":         id,
+			"name":       name,
+			"attributes": decoded,
+			"meta": map[string]any{
+				"resourceType": "Schema",
+				"location":     appURL + "/scim/v2/Schemas/" + id,
+			},
+		}
+	}
+
+	return []map[string]any{
+		schema(schemaUser, "User",
+			attribute("userName", "string").required().unique(),
+			attribute("name", "complex",
+				attribute("formatted", "string"),
+				attribute("givenName", "string"),
+				attribute("familyName", "string"),
+			),
+			attribute("displayName", "string"),
+			attribute("locale", "string"),
+			attribute("active", "boolean"),
+			attribute("emails", "complex",
+				attribute("value", "string"),
+				attribute("type", "string"),
+				attribute("primary", "boolean"),
+			).multiValued(),
+			referenceAttribute("groups", resourceTypeGroup).readOnly(),
+		),
+		schema(schemaGroup, "Group",
+			attribute("displayName", "string").required(),
+			referenceAttribute("members", resourceTypeUser),
+		),
+		schema(schemaEnterpriseUser, "EnterpriseUser",
+			attribute("employeeNumber", "string"),
+			attribute("costCenter", "string"),
+			attribute("organization", "string"),
+			attribute("division", "string"),
+			attribute("department", "string"),
+			attribute("manager", "complex",
+				attribute("value", "string"),
+				attribute("$ref", "reference").references(resourceTypeUser),
+				attribute("displayName", "string").readOnly(),
+			),
+		),
+	}
+}
+
+func newListResponse(resources []map[string]any) listResponse {
+	return listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
@@ -0,0 +1,569 @@
+package scimserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// filter is a parsed SCIM filter expression as defined in RFC 7644 section 3.4.2.2
+// Filters are evaluated against the JSON representation of a resource
+type filter interface {
+	matches(resource map[string]any) bool
+}
+
+type logicalFilter struct {
+	and         bool
+	left, right filter
+}
+
+func (f logicalFilter) matches(resource map[string]any) bool {
+	if f.and {
+		return f.left.matches(resource) && f.right.matches(resource)
+	}
+	return f.left.matches(resource) || f.right.matches(resource)
+}
+
+type notFilter struct {
+	inner filter
+}
+
+func (f notFilter) matches(resource map[string]any) bool {
+	return !f.inner.matches(resource)
+}
+
+type presentFilter struct {
+	path attributePath
+}
+
+func (f presentFilter) matches(resource map[string]any) bool {
+	if f.path.subAttribute != "" {
+		return len(f.path.values(resource)) > 0
+	}
+	value, _ := f.path.lookup(resource)
+	return !isEmpty(value)
+}
+
+type comparisonFilter struct {
+	path     attributePath
+	operator string
+	value    any
+}
+
+func (f comparisonFilter) matches(resource map[string]any) bool {
+	values := f.path.values(resource)
+
+	switch f.operator {
+	case "ne":
+		return !comparisonFilter{path: f.path, operator: "eq", value: f.value}.matches(resource)
+	case "eq":
+		if f.value == nil {
+			return len(values) == 0
+		}
+	}
+
+	caseExact := f.path.caseExact()
+	for _, value := range values {
+		if compare(value, f.operator, f.value, caseExact) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches resources with at least one value of a multi-valued attribute that matches the inner filter,
+// e.g. emails[type eq "work"]
+type valuePathFilter struct {
+	path  attributePath
+	inner filter
+}
+
+func (f valuePathFilter) matches(resource map[string]any) bool {
+	value, _ := f.path.lookup(resource)
+	for _, element := range asList(value) {
+		if element, ok := element.(map[string]any); ok && f.inner.matches(element) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(actual any, operator string, expected any, caseExact bool) bool {
+	switch expected := expected.(type) {
+	case string:
+		actual, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		if !caseExact {
+			actual, expected = strings.ToLower(actual), strings.ToLower(expected)
+		}
+
+		switch operator {
+		case "eq":
+			return actual == expected
+		case "co":
+			return strings.Contains(actual, expected)
+		case "sw":
+			return strings.HasPrefix(actual, expected)
+		case "ew":
+			return strings.HasSuffix(actual, expected)
+		case "gt":
+			return actual > expected
+		case "ge":
+			return actual >= expected
+		case "lt":
+			return actual < expected
+		case "le":
+			return actual <= expected
+		}
+	case float64:
+		actual, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+
+		switch operator {
+		case "eq":
+			return actual == expected
+		case "gt":
+			return actual > expected
+		case "ge":
+			return actual >= expected
+		case "lt":
+			return actual < expected
+		case "le":
+			return actual <= expected
+		}
+	case bool:
+		actual, ok := actual.(bool)
+		return ok && operator == "eq" && actual == expected
+	}
+	return false
+}
+
+// attributePath references an attribute of a resource, optionally qualified with the URN of its schema
+type attributePath struct {
+	schema       string
+	attribute    string
+	subAttribute string
+}
+
+func parseAttributePath(path string) (attributePath, error) {
+	var result attributePath
+	if len(path) > 4 && strings.EqualFold(path[:4], "urn:") {
+		result.schema, path = splitSchema(path)
+	}
+
+	result.attribute, result.subAttribute, _ = strings.Cut(path, ".")
+	if (result.attribute == "" && result.schema == "") || strings.Contains(result.subAttribute, ".") {
+		return attributePath{}, newScimError(http.StatusBadRequest, "invalidPath", "invalid attribute path %q", path)
+	}
+	return result, nil
+}
+
+// splitSchema splits a fully qualified attribute path into the URN of the schema and the attribute path
+func splitSchema(path string) (schema, attribute string) {
+	for _, schema := range []string{schemaEnterpriseUser, schemaUser, schemaGroup} {
+		if strings.EqualFold(path, schema) {
+			return schema, ""
+		}
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)], schema) && path[len(schema)] == ':' {
+			return schema, path[len(schema)+1:]
+		}
+	}
+
+	i := strings.LastIndex(path, ":")
+	return path[:i], path[i+1:]
+}
+
+// isExtension reports whether the attribute belongs to a schema extension, whose attributes are nested in an object
+// named after the URN of the schema
+func (p attributePath) isExtension() bool {
+	return p.schema != "" && p.schema != schemaUser && p.schema != schemaGroup
+}
+
+// caseExact reports whether values of the attribute are compared case-sensitively
+func (p attributePath) caseExact() bool {
+	return p.schema == "" && p.subAttribute == "" && (strings.EqualFold(p.attribute, "id") || strings.EqualFold(p.attribute, "externalId"))
+}
+
+// container returns the object that holds the attribute, creating the object of an extension if create is set
+func (p attributePath) container(resource map[string]any, create bool) map[string]any {
+	if !p.isExtension() || p.attribute == "" {
+		return resource
+	}
+
+	key := findKey(resource, p.schema)
+	if extension, ok := resource[key].(map[string]any); ok {
+		return extension
+	}
+	if !create {
+		return nil
+	}
+
+	extension := map[string]any{}
+	resource[key] = extension
+	return extension
+}
+
+// key returns the name of the attribute in its container
+func (p attributePath) key() string {
+	if p.attribute == "" {
+		return p.schema
+	}
+	return p.attribute
+}
+
+// lookup returns the raw value of the attribute, which is an object or list for complex or multi-valued attributes
+func (p attributePath) lookup(resource map[string]any) (any, bool) {
+	container := p.container(resource, false)
+	if container == nil {
+		return nil, false
+	}
+
+	value, ok := container[findKey(container, p.key())]
+	if !ok || p.subAttribute == "" {
+		return value, ok
+	}
+	if object, isObject := value.(map[string]any); isObject {
+		value, ok = object[findKey(object, p.subAttribute)]
+		return value, ok
+	}
+	return nil, false
+}
+
+// values returns the simple values of the attribute that filters compare against
+// Complex attributes are compared by their "value" sub-attribute and multi-valued attributes by each of their values
+func (p attributePath) values(resource map[string]any) []any {
+	container := p.container(resource, false)
+	if container == nil {
+		return nil
+	}
+	return collectValues(container[findKey(container, p.key())], p.subAttribute)
+}
+
+func collectValues(value any, subAttribute string) []any {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		var values []any
+		for _, element := range value {
+			values = append(values, collectValues(element, subAttribute)...)
+		}
+		return values
+	case map[string]any:
+		if subAttribute == "" {
+			subAttribute = "value"
+		}
+		inner, ok := value[findKey(value, subAttribute)]
+		if _, isObject := inner.(map[string]any); !ok || isObject {
+			return nil
+		}
+		return collectValues(inner, "")
+	default:
+		if subAttribute != "" {
+			return nil
+		}
+		return []any{value}
+	}
+}
+
+// findKey returns the key of the object that matches the attribute name case-insensitively, as attribute names in
+// SCIM are case-insensitive
+// If the object has no such key, the attribute name itself is returned
+func findKey(object map[string]any, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func asList(value any) []any {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		return value
+	default:
+		return []any{value}
+	}
+}
+
+func isEmpty(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case []any:
+		return len(value) == 0
+	case map[string]any:
+		return len(value) == 0
+	default:
+		return false
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		switch c := input[i]; c {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, text: "("})
+			i++
+		case ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, text: ")"})
+			i++
+		case '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket, text: "["})
+			i++
+		case ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket, text: "]"})
+			i++
+		case '"':
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, newScimError(http.StatusBadRequest, "invalidFilter", "unterminated string in filter")
+			}
+
+			var text string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &text); err != nil {
+				return nil, newScimError(http.StatusBadRequest, "invalidFilter", "invalid string in filter: %v", err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: input[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser for filters, where "not" binds stronger than "and", which binds stronger
+// than "or"
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func parseFilter(input string) (filter, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, newScimError(http.StatusBadRequest, "invalidFilter", "unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) next() (token, error) {
+	t := p.peek()
+	if t == nil {
+		return token{}, newScimError(http.StatusBadRequest, "invalidFilter", "unexpected end of filter")
+	}
+	p.pos++
+	return *t, nil
+}
+
+func (p *filterParser) expect(kind tokenKind, text string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != kind {
+		return newScimError(http.StatusBadRequest, "invalidFilter", "expected %q but got %q in filter", text, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filter, error) {
+	if !p.peekKeyword("not") {
+		return p.parseExpression()
+	}
+
+	p.pos++
+	if err := p.expect(tokenOpenParen, "("); err != nil {
+		return nil, err
+	}
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenCloseParen, ")"); err != nil {
+		return nil, err
+	}
+	return notFilter{inner: inner}, nil
+}
+
+func (p *filterParser) parseExpression() (filter, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.kind {
+	case tokenOpenParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenCloseParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenWord:
+	default:
+		return nil, newScimError(http.StatusBadRequest, "invalidFilter", "unexpected %q in filter", t.text)
+	}
+
+	path, err := parseAttributePath(t.text)
+	if err != nil {
+		return nil, newScimError(http.StatusBadRequest, "invalidFilter", "invalid attribute path %q in filter", t.text)
+	}
+
+	if next := p.peek(); next != nil && next.kind == tokenOpenBracket {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenCloseBracket, "]"); err != nil {
+			return nil, err
+		}
+		return valuePathFilter{path: path, inner: inner}, nil
+	}
+
+	operatorToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	operator := strings.ToLower(operatorToken.text)
+	switch operator {
+	case "pr":
+		return presentFilter{path: path}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, newScimError(http.StatusBadRequest, "invalidFilter", "unsupported operator %q in filter", operatorToken.text)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return comparisonFilter{path: path, operator: operator, value: value}, nil
+}
+
+func (p *filterParser) parseValue() (any, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.kind == tokenString {
+		return t.text, nil
+	}
+	if t.kind == tokenWord {
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if number, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return number, nil
+		}
+	}
+	return nil, newScimError(http.StatusBadRequest, "invalidFilter", "invalid value %q in filter", t.text)
+}
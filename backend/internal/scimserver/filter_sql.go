@@ -0,0 +1,221 @@
+package scimserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// sqlCondition is a filter translated to a WHERE condition
+type sqlCondition struct {
+	query string
+	args  []any
+}
+
+// sqlAttribute describes where the values of an attribute that filters compare against are stored
+type sqlAttribute struct {
+	// column is the expression that holds the values of the attribute
+	column string
+	// subquery is set if the values are stored in another table, and selects the resources with a value that matches
+	// the condition in its %s placeholder
+	subquery string
+	// caseExact is set if values are compared case-sensitively
+	caseExact bool
+	// boolean is set for boolean attributes, and inverted if the column stores the negation of the attribute
+	boolean  bool
+	inverted bool
+}
+
+// sqlAttributes maps the lower-case paths of the attributes filters can use to the database
+// Attributes of schema extensions are prefixed with the lower-case URN of the schema
+type sqlAttributes map[string]sqlAttribute
+
+var userSQLAttributes = func() sqlAttributes {
+	attributes := sqlAttributes{
+		"id":              {column: "CAST(users.id AS TEXT)", caseExact: true},
+		"externalid":      {column: "external_id", subquery: "users.id IN (SELECT user_id FROM scim_external_ids WHERE user_id IS NOT NULL AND %s)", caseExact: true},
+		"username":        {column: "users.username"},
+		"displayname":     {column: "users.display_name"},
+		"name.givenname":  {column: "users.first_name"},
+		"name.familyname": {column: "users.last_name"},
+		"emails.value":    {column: "users.email"},
+		"locale":          {column: "users.locale"},
+		"active":          {column: "users.disabled", boolean: true, inverted: true},
+		"groups.value":    {column: "CAST(user_group_id AS TEXT)", subquery: "users.id IN (SELECT user_id FROM user_groups_users WHERE %s)", caseExact: true},
+		"groups.display":  {column: "user_groups.friendly_name", subquery: "users.id IN (SELECT user_groups_users.user_id FROM user_groups_users JOIN user_groups ON user_groups.id = user_groups_users.user_group_id WHERE %s)"},
+	}
+
+	// The keys are constants, so they can be part of the query
+	for _, key := range enterpriseClaimKeys {
+		path := strings.ToLower(schemaEnterpriseUser + ":" + key)
+		if key == "manager" {
+			path += ".value"
+		}
+		attributes[path] = sqlAttribute{
+			column:   "custom_claims.value",
+			subquery: "users.id IN (SELECT user_id FROM custom_claims WHERE user_id IS NOT NULL AND key = '" + key + "' AND %s)",
+		}
+	}
+	return attributes
+}()
+
+var groupSQLAttributes = sqlAttributes{
+	"id":            {column: "CAST(user_groups.id AS TEXT)", caseExact: true},
+	"externalid":    {column: "external_id", subquery: "user_groups.id IN (SELECT user_group_id FROM scim_external_ids WHERE user_group_id IS NOT NULL AND %s)", caseExact: true},
+	"displayname":   {column: "user_groups.friendly_name"},
+	"members.value": {column: "CAST(user_id AS TEXT)", subquery: "user_groups.id IN (SELECT user_group_id FROM user_groups_users WHERE %s)", caseExact: true},
+}
+
+// toSQL translates a filter to a WHERE condition on the attributes
+// Filters on attributes that aren't stored in a way the database can filter by are rejected
+func toSQL(f filter, attributes sqlAttributes) (sqlCondition, error) {
+	switch f := f.(type) {
+	case logicalFilter:
+		left, err := toSQL(f.left, attributes)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		right, err := toSQL(f.right, attributes)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		operator := " OR "
+		if f.and {
+			operator = " AND "
+		}
+		return sqlCondition{
+			query: "(" + left.query + operator + right.query + ")",
+			args:  slices.Concat(left.args, right.args),
+		}, nil
+	case notFilter:
+		inner, err := toSQL(f.inner, attributes)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		return sqlCondition{query: "NOT " + inner.query, args: inner.args}, nil
+	case presentFilter:
+		attribute, err := attributes.lookup(f.path)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		return attribute.present(), nil
+	case comparisonFilter:
+		attribute, err := attributes.lookup(f.path)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		return attribute.compare(f.operator, f.value)
+	case valuePathFilter:
+		// The sub-attributes of the multi-valued attribute become the attributes of the inner filter
+		prefix := attributes.key(f.path) + "."
+		inner := sqlAttributes{}
+		for key, attribute := range attributes {
+			if subAttribute, ok := strings.CutPrefix(key, prefix); ok {
+				inner[subAttribute] = attribute
+			}
+		}
+		return toSQL(f.inner, inner)
+	default:
+		return sqlCondition{}, newScimError(http.StatusBadRequest, "invalidFilter", "unsupported filter")
+	}
+}
+
+func (a sqlAttributes) key(path attributePath) string {
+	key := strings.ToLower(path.attribute)
+	if path.subAttribute != "" {
+		key += "." + strings.ToLower(path.subAttribute)
+	}
+	if path.isExtension() {
+		key = strings.ToLower(path.schema) + ":" + key
+	}
+	return key
+}
+
+// lookup returns the attribute referenced by the path
+// Complex attributes are compared by their "value" sub-attribute, like filters that are evaluated in memory
+func (a sqlAttributes) lookup(path attributePath) (sqlAttribute, error) {
+	key := a.key(path)
+	if attribute, ok := a[key]; ok {
+		return attribute, nil
+	}
+	if attribute, ok := a[key+".value"]; ok && path.subAttribute == "" {
+		return attribute, nil
+	}
+	return sqlAttribute{}, newScimError(http.StatusBadRequest, "invalidFilter", "filtering by %q is not supported", key)
+}
+
+func (a sqlAttribute) present() sqlCondition {
+	condition := a.column + " IS NOT NULL"
+	if !a.boolean {
+		condition += " AND " + a.column + " <> ''"
+	}
+	return sqlCondition{query: a.scope(condition)}
+}
+
+func (a sqlAttribute) compare(operator string, value any) (sqlCondition, error) {
+	switch operator {
+	case "ne":
+		condition, err := a.compare("eq", value)
+		if err != nil {
+			return sqlCondition{}, err
+		}
+		return sqlCondition{query: "NOT " + condition.query, args: condition.args}, nil
+	case "eq":
+		if value == nil {
+			condition := a.present()
+			return sqlCondition{query: "NOT " + condition.query}, nil
+		}
+	}
+
+	switch value := value.(type) {
+	case bool:
+		if !a.boolean || operator != "eq" {
+			break
+		}
+		return sqlCondition{query: a.scope(a.column + " = ?"), args: []any{value != a.inverted}}, nil
+	case string:
+		if a.boolean {
+			break
+		}
+
+		column, placeholder := a.column, "?"
+		if !a.caseExact {
+			column, placeholder = "LOWER("+column+")", "LOWER(?)"
+		}
+
+		// Comparisons are only true for values that are set, so a negated condition matches resources without a value
+		condition := a.column + " IS NOT NULL AND " + column
+		switch operator {
+		case "eq":
+			return sqlCondition{query: a.scope(condition + " = " + placeholder), args: []any{value}}, nil
+		case "co":
+			return a.like(condition, placeholder, "%"+escapeLike(value)+"%"), nil
+		case "sw":
+			return a.like(condition, placeholder, escapeLike(value)+"%"), nil
+		case "ew":
+			return a.like(condition, placeholder, "%"+escapeLike(value)), nil
+		case "gt", "ge", "lt", "le":
+			sqlOperator := map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}[operator]
+			return sqlCondition{query: a.scope(condition + " " + sqlOperator + " " + placeholder), args: []any{value}}, nil
+		}
+	}
+
+	return sqlCondition{}, newScimError(http.StatusBadRequest, "invalidFilter", "unsupported comparison %q with %v", operator, value)
+}
+
+func (a sqlAttribute) like(condition, placeholder, pattern string) sqlCondition {
+	return sqlCondition{query: a.scope(condition + " LIKE " + placeholder + ` ESCAPE '\'`), args: []any{pattern}}
+}
+
+// scope applies the condition to the table the values are stored in
+func (a sqlAttribute) scope(condition string) string {
+	if a.subquery == "" {
+		return "(" + condition + ")"
+	}
+	return "(" + fmt.Sprintf(a.subquery, condition) + ")"
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
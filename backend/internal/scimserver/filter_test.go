@@ -0,0 +1,96 @@
+package scimserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	resource := map[string]any{
+		"schemas":     []any{schemaUser, schemaEnterpriseUser},
+		"id":          "2819c223",
+		"externalId":  "EXT-1",
+		"userName":    "Alice",
+		"displayName": "Alice Liddell",
+		"active":      true,
+		"name":        map[string]any{"givenName": "Alice", "familyName": "Liddell"},
+		"emails": []any{
+			map[string]any{"value": "alice@example.com", "type": "work", "primary": true},
+			map[string]any{"value": "alice@home.example", "type": "home"},
+		},
+		"groups": []any{map[string]any{"value": "g1", "display": "Staff"}},
+		schemaEnterpriseUser: map[string]any{
+			"department": "Engineering",
+			"manager":    map[string]any{"value": "bob"},
+		},
+		"meta": map[string]any{"lastModified": "2026-10-18T12:00:00Z"},
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "alice"`, true},
+		{`USERNAME EQ "ALICE"`, true},
+		{`userName eq "bob"`, false},
+		{`userName ne "bob"`, true},
+		{`name.givenName sw "Al"`, true},
+		{`name.familyName ew "dell"`, true},
+		{`displayName co "Lid"`, true},
+		{`emails co "home.example"`, true},
+		{`emails.value ew "@example.com"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "home" and primary eq true]`, false},
+		{`externalId eq "EXT-1"`, true},
+		{`externalId eq "ext-1"`, false},
+		{`id eq "2819c223"`, true},
+		{`active eq true`, true},
+		{`not (active eq false)`, true},
+		{`title pr`, false},
+		{`displayName pr`, true},
+		{`name pr`, true},
+		{`title eq null`, true},
+		{`groups.value eq "g1"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "alice"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "engineering"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "bob"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:division pr`, false},
+		{`meta.lastModified gt "2026-01-01T00:00:00Z"`, true},
+		{`meta.lastModified lt "2026-01-01T00:00:00Z"`, false},
+		{`userName eq "bob" and active eq true or displayName eq "Alice Liddell"`, true},
+		{`userName eq "bob" and (active eq true or displayName eq "Alice Liddell")`, false},
+		{`userName eq "bob" or not (userName eq "bob")`, true},
+		{`displayName eq "Alice \"Al\" Liddell"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := parseFilter(tt.filter)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, f.matches(resource))
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	filters := []string{
+		`userName eq`,
+		`userName foo "alice"`,
+		`(userName eq "alice"`,
+		`userName eq "alice" junk`,
+		`userName eq alice`,
+		`emails[type eq "work"`,
+		`not userName eq "alice"`,
+		`userName eq "alice`,
+		`and`,
+	}
+
+	for _, filter := range filters {
+		t.Run(filter, func(t *testing.T) {
+			_, err := parseFilter(filter)
+			require.Error(t, err)
+			require.Equal(t, "invalidFilter", toScimError(err).scimType)
+		})
+	}
+}
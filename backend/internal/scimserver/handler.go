@@ -0,0 +1,440 @@
+package scimserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"github.com/pocket-id/pocket-id/backend/internal/apikey"
+)
+
+const (
+	contentType = "application/scim+json"
+
+	defaultCount = 100
+	maxCount     = 1000
+	// maxBodySize limits the size of request bodies, which is large enough for groups with many members
+	maxBodySize = 10 << 20
+)
+
+type handler struct {
+	service *service
+	apiKeys ApiKeyValidator
+}
+
+func newHandler(service *service, apiKeys ApiKeyValidator) *handler {
+	return &handler{service: service, apiKeys: apiKeys}
+}
+
+// authenticate authenticates provisioning clients with the bearer token, which must be an API key with the SCIM scope
+// that belongs to an admin
+func (h *handler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		h.abort(c, newScimError(http.StatusUnauthorized, "", "authentication required"))
+		return
+	}
+
+	user, err := h.apiKeys.ValidateScopedApiKey(c.Request.Context(), token, apikey.ScopeScim)
+	if err != nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		h.abort(c, err)
+		return
+	}
+	if !user.IsAdmin || user.Disabled {
+		h.abort(c, newScimError(http.StatusForbidden, "", "the API key must belong to an admin"))
+		return
+	}
+
+	c.Set("userID", user.ID)
+	c.Next()
+}
+
+// listUsers godoc
+// @Summary List SCIM users
+// @Description List users as SCIM resources, optionally filtered with a SCIM filter
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param filter query string false "SCIM filter, e.g. userName eq \"tim\""
+// @Param startIndex query int false "1-based index of the first result" default(1)
+// @Param count query int false "Maximum number of results" default(100)
+// @Success 200 {object} listResponse
+// @Router /scim/v2/Users [get]
+func (h *handler) listUsers(c *gin.Context) {
+	query, err := parseListQuery(c)
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	response, err := h.service.listUsers(c.Request.Context(), query)
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+	respond(c, http.StatusOK, response)
+}
+
+// getUser godoc
+// @Summary Get SCIM user
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param id path string true "User ID"
+// @Success 200 {object} userResource
+// @Router /scim/v2/Users/{id} [get]
+func (h *handler) getUser(c *gin.Context) {
+	resource, err := h.service.getUser(c.Request.Context(), c.Param("id"))
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// createUser godoc
+// @Summary Create SCIM user
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param user body userResource true "User resource"
+// @Success 201 {object} userResource
+// @Router /scim/v2/Users [post]
+func (h *handler) createUser(c *gin.Context) {
+	var input userResource
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.createUser(c.Request.Context(), actorOf(c), input)
+	if err == nil {
+		c.Header("Location", resource.Meta.Location)
+	}
+	h.respondWithResource(c, http.StatusCreated, resource, err)
+}
+
+// replaceUser godoc
+// @Summary Replace SCIM user
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param id path string true "User ID"
+// @Param user body userResource true "User resource"
+// @Success 200 {object} userResource
+// @Router /scim/v2/Users/{id} [put]
+func (h *handler) replaceUser(c *gin.Context) {
+	var input userResource
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.replaceUser(c.Request.Context(), actorOf(c), c.Param("id"), input)
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// patchUser godoc
+// @Summary Patch SCIM user
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param id path string true "User ID"
+// @Param operations body patchRequest true "PATCH operations"
+// @Success 200 {object} userResource
+// @Router /scim/v2/Users/{id} [patch]
+func (h *handler) patchUser(c *gin.Context) {
+	var input patchRequest
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.patchUser(c.Request.Context(), actorOf(c), c.Param("id"), input.Operations)
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// deleteUser godoc
+// @Summary Delete SCIM user
+// @Tags SCIM
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Router /scim/v2/Users/{id} [delete]
+func (h *handler) deleteUser(c *gin.Context) {
+	if err := h.service.deleteUser(c.Request.Context(), actorOf(c), c.Param("id")); err != nil {
+		h.abort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listGroups godoc
+// @Summary List SCIM groups
+// @Description List user groups as SCIM resources, optionally filtered with a SCIM filter
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param filter query string false "SCIM filter, e.g. displayName eq \"Admins\""
+// @Param startIndex query int false "1-based index of the first result" default(1)
+// @Param count query int false "Maximum number of results" default(100)
+// @Success 200 {object} listResponse
+// @Router /scim/v2/Groups [get]
+func (h *handler) listGroups(c *gin.Context) {
+	query, err := parseListQuery(c)
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	response, err := h.service.listGroups(c.Request.Context(), query)
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+	respond(c, http.StatusOK, response)
+}
+
+// getGroup godoc
+// @Summary Get SCIM group
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param id path string true "User group ID"
+// @Success 200 {object} groupResource
+// @Router /scim/v2/Groups/{id} [get]
+func (h *handler) getGroup(c *gin.Context) {
+	resource, err := h.service.getGroup(c.Request.Context(), c.Param("id"))
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// createGroup godoc
+// @Summary Create SCIM group
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param group body groupResource true "Group resource"
+// @Success 201 {object} groupResource
+// @Router /scim/v2/Groups [post]
+func (h *handler) createGroup(c *gin.Context) {
+	var input groupResource
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.createGroup(c.Request.Context(), actorOf(c), input)
+	if err == nil {
+		c.Header("Location", resource.Meta.Location)
+	}
+	h.respondWithResource(c, http.StatusCreated, resource, err)
+}
+
+// replaceGroup godoc
+// @Summary Replace SCIM group
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param id path string true "User group ID"
+// @Param group body groupResource true "Group resource"
+// @Success 200 {object} groupResource
+// @Router /scim/v2/Groups/{id} [put]
+func (h *handler) replaceGroup(c *gin.Context) {
+	var input groupResource
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.replaceGroup(c.Request.Context(), actorOf(c), c.Param("id"), input)
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// patchGroup godoc
+// @Summary Patch SCIM group
+// @Tags SCIM
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param id path string true "User group ID"
+// @Param operations body patchRequest true "PATCH operations"
+// @Success 200 {object} groupResource
+// @Router /scim/v2/Groups/{id} [patch]
+func (h *handler) patchGroup(c *gin.Context) {
+	var input patchRequest
+	if err := decode(c, &input); err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	resource, err := h.service.patchGroup(c.Request.Context(), actorOf(c), c.Param("id"), input.Operations)
+	h.respondWithResource(c, http.StatusOK, resource, err)
+}
+
+// deleteGroup godoc
+// @Summary Delete SCIM group
+// @Tags SCIM
+// @Param id path string true "User group ID"
+// @Success 204 "No Content"
+// @Router /scim/v2/Groups/{id} [delete]
+func (h *handler) deleteGroup(c *gin.Context) {
+	if err := h.service.deleteGroup(c.Request.Context(), actorOf(c), c.Param("id")); err != nil {
+		h.abort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// serviceProviderConfig godoc
+// @Summary Get SCIM service provider configuration
+// @Description Get the SCIM features the server supports
+// @Tags SCIM
+// @Produce application/scim+json
+// @Success 200 {object} object
+// @Router /scim/v2/ServiceProviderConfig [get]
+func (h *handler) serviceProviderConfig(c *gin.Context) {
+	respond(c, http.StatusOK, serviceProviderConfig(h.service.appURL))
+}
+
+// listResourceTypes godoc
+// @Summary List SCIM resource types
+// @Tags SCIM
+// @Produce application/scim+json
+// @Success 200 {object} listResponse
+// @Router /scim/v2/ResourceTypes [get]
+func (h *handler) listResourceTypes(c *gin.Context) {
+	respond(c, http.StatusOK, newListResponse(resourceTypes(h.service.appURL)))
+}
+
+// getResourceType godoc
+// @Summary Get SCIM resource type
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param id path string true "Resource type name, e.g. User"
+// @Success 200 {object} object
+// @Router /scim/v2/ResourceTypes/{id} [get]
+func (h *handler) getResourceType(c *gin.Context) {
+	respondWithDiscoveryResource(c, resourceTypes(h.service.appURL))
+}
+
+// listSchemas godoc
+// @Summary List SCIM schemas
+// @Tags SCIM
+// @Produce application/scim+json
+// @Success 200 {object} listResponse
+// @Router /scim/v2/Schemas [get]
+func (h *handler) listSchemas(c *gin.Context) {
+	respond(c, http.StatusOK, newListResponse(schemas(h.service.appURL)))
+}
+
+// getSchema godoc
+// @Summary Get SCIM schema
+// @Tags SCIM
+// @Produce application/scim+json
+// @Param id path string true "Schema URN"
+// @Success 200 {object} object
+// @Router /scim/v2/Schemas/{id} [get]
+func (h *handler) getSchema(c *gin.Context) {
+	respondWithDiscoveryResource(c, schemas(h.service.appURL))
+}
+
+// respondWithResource responds with a single resource, with only the attributes selected by the query parameters
+func (h *handler) respondWithResource(c *gin.Context, status int, resource any, err error) {
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+
+	object, err := toMap(resource)
+	if err != nil {
+		h.abort(c, err)
+		return
+	}
+	respond(c, status, selectAttributes(object, splitList(c.Query("attributes")), splitList(c.Query("excludedAttributes"))))
+}
+
+func respondWithDiscoveryResource(c *gin.Context, resources []map[string]any) {
+	for _, resource := range resources {
+		if id, _ := resource["id"].(string); strings.EqualFold(id, c.Param("id")) {
+			respond(c, http.StatusOK, resource)
+			return
+		}
+	}
+	respondWithError(c, newScimError(http.StatusNotFound, "", "resource %q not found", c.Param("id")))
+}
+
+// abort responds with the SCIM error response for the error
+func (h *handler) abort(c *gin.Context, err error) {
+	respondWithError(c, toScimError(err))
+	c.Abort()
+}
+
+func respondWithError(c *gin.Context, err *scimError) {
+	respond(c, err.status, errorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(err.status),
+		ScimType: err.scimType,
+		Detail:   err.detail,
+	})
+}
+
+func respond(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", contentType)
+	c.Render(status, render.JSON{Data: body})
+}
+
+// decode decodes the request body, which clients send as application/scim+json or application/json
+func decode(c *gin.Context, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+	if err := decoder.Decode(v); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body: %v", err)
+	}
+	return nil
+}
+
+func parseListQuery(c *gin.Context) (listQuery, error) {
+	query := listQuery{
+		startIndex:         1,
+		count:              defaultCount,
+		attributes:         splitList(c.Query("attributes")),
+		excludedAttributes: splitList(c.Query("excludedAttributes")),
+	}
+
+	if value := c.Query("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return listQuery{}, newScimError(http.StatusBadRequest, "invalidValue", "invalid startIndex %q", value)
+		}
+		query.startIndex = max(startIndex, 1)
+	}
+	if value := c.Query("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return listQuery{}, newScimError(http.StatusBadRequest, "invalidValue", "invalid count %q", value)
+		}
+		query.count = min(max(count, 0), maxCount)
+	}
+	if value := c.Query("filter"); value != "" {
+		f, err := parseFilter(value)
+		if err != nil {
+			return listQuery{}, err
+		}
+		query.filter = f
+	}
+
+	return query, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for part := range strings.SplitSeq(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func actorOf(c *gin.Context) actor {
+	return actor{
+		userID:    c.GetString("userID"),
+		ipAddress: c.ClientIP(),
+		userAgent: c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,473 @@
+package scimserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+type testApiKeys struct {
+	users map[string]model.User
+}
+
+func (k testApiKeys) ValidateScopedApiKey(_ context.Context, apiKey, scope string) (model.User, error) {
+	if apiKey == "unscoped" {
+		return model.User{}, &common.APIKeyScopeError{}
+	}
+	user, ok := k.users[apiKey]
+	if !ok || scope != "scim" {
+		return model.User{}, &common.InvalidAPIKeyError{}
+	}
+	return user, nil
+}
+
+// testUsers and testGroups store the changes directly, in place of the user and user group services
+type testUsers struct {
+	db *gorm.DB
+}
+
+func (s testUsers) CreateUser(ctx context.Context, input dto.UserCreateDto) (model.User, error) {
+	var count int64
+	s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", input.Username).Count(&count)
+	if count > 0 {
+		return model.User{}, &common.AlreadyInUseError{Property: "username"}
+	}
+
+	user := model.User{}
+	applyUserInput(&user, input)
+	err := s.db.WithContext(ctx).Create(&user).Error
+	return user, err
+}
+
+func (s testUsers) UpdateUser(ctx context.Context, userID string, input dto.UserCreateDto, _ bool, _ bool) (model.User, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return model.User{}, err
+	}
+	applyUserInput(&user, input)
+	err := s.db.WithContext(ctx).Save(&user).Error
+	return user, err
+}
+
+func (s testUsers) DeleteUser(ctx context.Context, userID string, _ bool) error {
+	return s.db.WithContext(ctx).Delete(&model.User{}, "id = ?", userID).Error
+}
+
+func applyUserInput(user *model.User, input dto.UserCreateDto) {
+	user.Username = input.Username
+	user.Email = input.Email
+	user.EmailVerified = input.EmailVerified
+	user.FirstName = input.FirstName
+	user.LastName = input.LastName
+	user.DisplayName = input.DisplayName
+	user.IsAdmin = input.IsAdmin
+	user.Locale = input.Locale
+	user.Disabled = input.Disabled
+}
+
+type testGroups struct {
+	db *gorm.DB
+}
+
+func (s testGroups) Create(ctx context.Context, input dto.UserGroupCreateDto) (model.UserGroup, error) {
+	group := model.UserGroup{FriendlyName: input.FriendlyName, Name: input.Name}
+	err := s.db.WithContext(ctx).Create(&group).Error
+	return group, err
+}
+
+func (s testGroups) Update(ctx context.Context, id string, input dto.UserGroupCreateDto) (model.UserGroup, error) {
+	group := model.UserGroup{Base: model.Base{ID: id}}
+	err := s.db.WithContext(ctx).Model(&group).Updates(map[string]any{"friendly_name": input.FriendlyName, "name": input.Name}).Error
+	return group, err
+}
+
+func (s testGroups) UpdateUsers(ctx context.Context, id string, userIds []string) (model.UserGroup, error) {
+	group := model.UserGroup{Base: model.Base{ID: id}}
+	var users []model.User
+	if len(userIds) > 0 {
+		if err := s.db.WithContext(ctx).Find(&users, "id IN ?", userIds).Error; err != nil {
+			return model.UserGroup{}, err
+		}
+	}
+	err := s.db.WithContext(ctx).Model(&group).Association("Users").Replace(users)
+	return group, err
+}
+
+func (s testGroups) Delete(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Delete(&model.UserGroup{}, "id = ?", id).Error
+}
+
+type testCustomClaims struct {
+	db *gorm.DB
+}
+
+func (s testCustomClaims) UpdateCustomClaimsForUser(ctx context.Context, userID string, claims []dto.CustomClaimCreateDto) ([]model.CustomClaim, error) {
+	if err := s.db.WithContext(ctx).Delete(&model.CustomClaim{}, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	created := make([]model.CustomClaim, len(claims))
+	for i, claim := range claims {
+		created[i] = model.CustomClaim{Key: claim.Key, Value: claim.Value, UserID: &userID}
+	}
+	if len(created) == 0 {
+		return created, nil
+	}
+	err := s.db.WithContext(ctx).Create(&created).Error
+	return created, err
+}
+
+type testAuditLog struct {
+	entries []model.AuditLog
+}
+
+func (a *testAuditLog) Create(_ context.Context, event model.AuditLogEvent, _, _, userID string, data model.AuditLogData, _ *gorm.DB) (model.AuditLog, bool) {
+	entry := model.AuditLog{Event: event, UserID: userID, Data: data}
+	a.entries = append(a.entries, entry)
+	return entry, true
+}
+
+type scimClient struct {
+	t      *testing.T
+	router *gin.Engine
+	token  string
+}
+
+// do sends the request and decodes the JSON response into a map
+func (c scimClient) do(method, path string, body any) (int, map[string]any) {
+	c.t.Helper()
+
+	var reader *strings.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		require.NoError(c.t, err)
+		reader = strings.NewReader(string(encoded))
+	} else {
+		reader = strings.NewReader("")
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+
+	var response map[string]any
+	if rec.Body.Len() > 0 {
+		require.Equal(c.t, contentType, rec.Header().Get("Content-Type"))
+		require.NoError(c.t, json.Unmarshal(rec.Body.Bytes(), &response))
+	}
+	return rec.Code, response
+}
+
+func TestScimServer(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	auditLog := &testAuditLog{}
+
+	admin := model.User{Base: model.Base{ID: "admin"}, Username: "admin", IsAdmin: true}
+	member := model.User{Base: model.Base{ID: "member"}, Username: "member"}
+	require.NoError(t, db.Create([]*model.User{&admin, &member}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	New(Dependencies{
+		DB:     db,
+		AppURL: "https://id.example.com",
+		ApiKeys: testApiKeys{users: map[string]model.User{
+			"admin-key":  admin,
+			"member-key": member,
+		}},
+		Users:        testUsers{db: db},
+		Groups:       testGroups{db: db},
+		CustomClaims: testCustomClaims{db: db},
+		AuditLog:     auditLog,
+	}).RegisterRoutes(router.Group("/"))
+
+	client := scimClient{t: t, router: router, token: "admin-key"}
+
+	t.Run("discovery endpoints", func(t *testing.T) {
+		anonymous := scimClient{t: t, router: router}
+
+		status, config := anonymous.do(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, true, config["patch"].(map[string]any)["supported"])
+
+		status, list := anonymous.do(http.MethodGet, "/scim/v2/Schemas", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 3, list["totalResults"], 0)
+
+		status, resourceType := anonymous.do(http.MethodGet, "/scim/v2/ResourceTypes/User", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "/Users", resourceType["endpoint"])
+
+		status, _ = anonymous.do(http.MethodGet, "/scim/v2/Schemas/"+url.PathEscape(schemaEnterpriseUser), nil)
+		require.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		tests := []struct {
+			token  string
+			status int
+		}{
+			{"", http.StatusUnauthorized},
+			{"invalid", http.StatusUnauthorized},
+			{"unscoped", http.StatusForbidden},
+			{"member-key", http.StatusForbidden},
+		}
+
+		for _, tt := range tests {
+			status, response := scimClient{t: t, router: router, token: tt.token}.do(http.MethodGet, "/scim/v2/Users", nil)
+			require.Equal(t, tt.status, status, tt.token)
+			require.Equal(t, []any{schemaError}, response["schemas"])
+		}
+	})
+
+	var userID string
+	t.Run("create user", func(t *testing.T) {
+		status, user := client.do(http.MethodPost, "/scim/v2/Users", map[string]any{
+			"schemas":    []string{schemaUser, schemaEnterpriseUser},
+			"externalId": "00u1",
+			"userName":   "alice",
+			"name":       map[string]any{"givenName": "Alice", "familyName": "Liddell"},
+			"emails":     []map[string]any{{"value": "alice@example.com", "type": "work", "primary": true}},
+			"active":     true,
+			schemaEnterpriseUser: map[string]any{
+				"department": "Engineering",
+				"manager":    map[string]any{"value": "admin"},
+			},
+		})
+		require.Equal(t, http.StatusCreated, status)
+
+		userID = user["id"].(string)
+		require.Equal(t, "00u1", user["externalId"])
+		require.Equal(t, "Alice Liddell", user["displayName"])
+		require.Equal(t, "Engineering", user[schemaEnterpriseUser].(map[string]any)["department"])
+		require.Equal(t, "https://id.example.com/scim/v2/Users/"+userID, user["meta"].(map[string]any)["location"])
+
+		var claims []model.CustomClaim
+		require.NoError(t, db.Order("key").Find(&claims, "user_id = ?", userID).Error)
+		require.Len(t, claims, 2)
+		require.Equal(t, "department", claims[0].Key)
+		require.Equal(t, "manager", claims[1].Key)
+		require.Equal(t, "admin", claims[1].Value)
+
+		status, response := client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"userName": "alice"})
+		require.Equal(t, http.StatusConflict, status)
+		require.Equal(t, "uniqueness", response["scimType"])
+
+		status, response = client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"userName": "not valid!"})
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, "invalidValue", response["scimType"])
+	})
+
+	t.Run("list users", func(t *testing.T) {
+		status, list := client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq "ALICE"`), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 1, list["totalResults"], 0)
+		require.Equal(t, userID, list["Resources"].([]any)[0].(map[string]any)["id"])
+
+		status, list = client.do(http.MethodGet, "/scim/v2/Users?startIndex=2&count=1&attributes=userName", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 3, list["totalResults"], 0)
+		require.InDelta(t, 1, list["itemsPerPage"], 0)
+		resource := list["Resources"].([]any)[0].(map[string]any)
+		require.Contains(t, resource, "userName")
+		require.NotContains(t, resource, "active")
+
+		status, list = client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`externalId eq "00u1" and`), nil)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, "invalidFilter", list["scimType"])
+
+		status, list = client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`title eq "Engineer"`), nil)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, "invalidFilter", list["scimType"])
+	})
+
+	t.Run("list users with filters evaluated by the database", func(t *testing.T) {
+		tests := []struct {
+			filter string
+			ids    []any
+		}{
+			{`externalId eq "00u1"`, []any{userID}},
+			{`externalId eq "00U1"`, nil},
+			{`name.familyName sw "LIDD" and active eq true`, []any{userID}},
+			{`emails[value co "@example.com"]`, []any{userID}},
+			{`emails pr`, []any{userID}},
+			{`not (emails pr)`, []any{"admin", "member"}},
+			{`userName ne "alice"`, []any{"admin", "member"}},
+			{`userName eq "admin" or userName ew "BER"`, []any{"admin", "member"}},
+			{`userName co "%"`, nil},
+			{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "engineering"`, []any{userID}},
+			{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "admin"`, []any{userID}},
+		}
+
+		for _, tt := range tests {
+			status, list := client.do(http.MethodGet, "/scim/v2/Users?attributes=id&filter="+url.QueryEscape(tt.filter), nil)
+			require.Equal(t, http.StatusOK, status, tt.filter)
+			require.InDelta(t, len(tt.ids), list["totalResults"], 0, tt.filter)
+
+			var ids []any
+			for _, resource := range list["Resources"].([]any) {
+				ids = append(ids, resource.(map[string]any)["id"])
+			}
+			require.Equal(t, tt.ids, ids, tt.filter)
+		}
+
+		status, list := client.do(http.MethodGet, "/scim/v2/Users?count=0&filter="+url.QueryEscape(`userName pr`), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 3, list["totalResults"], 0)
+		require.Empty(t, list["Resources"])
+	})
+
+	t.Run("patch user keeps other custom claims", func(t *testing.T) {
+		require.NoError(t, db.Create(&model.CustomClaim{Key: "team", Value: "Identity", UserID: &userID}).Error)
+
+		status, user := client.do(http.MethodPatch, "/scim/v2/Users/"+userID, map[string]any{
+			"schemas": []string{schemaPatchOp},
+			"Operations": []map[string]any{
+				{"op": "Replace", "path": "active", "value": "False"},
+				{"op": "Replace", "path": schemaEnterpriseUser + ":department", "value": "Research"},
+				{"op": "Remove", "path": schemaEnterpriseUser + ":manager"},
+			},
+		})
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, false, user["active"])
+
+		var stored model.User
+		require.NoError(t, db.Preload("CustomClaims").First(&stored, "id = ?", userID).Error)
+		require.True(t, stored.Disabled)
+		claims := map[string]string{}
+		for _, claim := range stored.CustomClaims {
+			claims[claim.Key] = claim.Value
+		}
+		require.Equal(t, map[string]string{"department": "Research", "team": "Identity"}, claims)
+	})
+
+	t.Run("admin accounts can't be modified", func(t *testing.T) {
+		status, response := client.do(http.MethodPut, "/scim/v2/Users/admin", map[string]any{
+			"schemas":  []string{schemaUser},
+			"userName": "admin",
+			"emails":   []map[string]any{{"value": "attacker@example.com", "primary": true}},
+		})
+		require.Equal(t, http.StatusForbidden, status)
+		require.Equal(t, "403", response["status"])
+
+		for _, operation := range []map[string]any{
+			{"op": "Replace", "path": "emails", "value": []map[string]any{{"value": "attacker@example.com", "primary": true}}},
+			{"op": "Replace", "path": "active", "value": false},
+			{"op": "Replace", "path": "userName", "value": "renamed"},
+		} {
+			status, _ = client.do(http.MethodPatch, "/scim/v2/Users/admin", map[string]any{
+				"schemas":    []string{schemaPatchOp},
+				"Operations": []map[string]any{operation},
+			})
+			require.Equal(t, http.StatusForbidden, status, operation["path"])
+		}
+
+		status, _ = client.do(http.MethodDelete, "/scim/v2/Users/admin", nil)
+		require.Equal(t, http.StatusForbidden, status)
+
+		var stored model.User
+		require.NoError(t, db.First(&stored, "id = ?", "admin").Error)
+		require.Equal(t, "admin", stored.Username)
+		require.Nil(t, stored.Email)
+		require.False(t, stored.Disabled)
+	})
+
+	var groupID string
+	t.Run("groups", func(t *testing.T) {
+		status, group := client.do(http.MethodPost, "/scim/v2/Groups", map[string]any{
+			"schemas":     []string{schemaGroup},
+			"displayName": "Engineering",
+			"externalId":  "00g1",
+			"members":     []map[string]any{{"value": userID}},
+		})
+		require.Equal(t, http.StatusCreated, status)
+		groupID = group["id"].(string)
+		require.Len(t, group["members"], 1)
+
+		status, group = client.do(http.MethodPatch, "/scim/v2/Groups/"+groupID, map[string]any{
+			"schemas": []string{schemaPatchOp},
+			"Operations": []map[string]any{
+				{"op": "Add", "path": "members", "value": []map[string]any{{"value": "member"}}},
+				{"op": "Remove", "path": `members[value eq "` + userID + `"]`},
+				{"op": "Replace", "path": "displayName", "value": "R&D"},
+			},
+		})
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "R&D", group["displayName"])
+		members := group["members"].([]any)
+		require.Len(t, members, 1)
+		require.Equal(t, "member", members[0].(map[string]any)["value"])
+
+		var stored model.UserGroup
+		require.NoError(t, db.First(&stored, "id = ?", groupID).Error)
+		require.Equal(t, "Engineering", stored.Name)
+
+		status, response := client.do(http.MethodPatch, "/scim/v2/Groups/"+groupID, map[string]any{
+			"Operations": []map[string]any{{"op": "Add", "path": "members", "value": []map[string]any{{"value": "unknown"}}}},
+		})
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, "invalidValue", response["scimType"])
+
+		status, list := client.do(http.MethodGet, "/scim/v2/Groups?excludedAttributes=members&filter="+url.QueryEscape(`externalId eq "00g1"`), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 1, list["totalResults"], 0)
+		require.NotContains(t, list["Resources"].([]any)[0], "members")
+
+		status, list = client.do(http.MethodGet, "/scim/v2/Groups?filter="+url.QueryEscape(`members[value eq "member"] and displayName eq "r&d"`), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 1, list["totalResults"], 0)
+
+		status, list = client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`groups.value eq "`+groupID+`"`), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.InDelta(t, 1, list["totalResults"], 0)
+		require.Equal(t, "member", list["Resources"].([]any)[0].(map[string]any)["id"])
+
+		status, user := client.do(http.MethodGet, "/scim/v2/Users/member", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, groupID, user["groups"].([]any)[0].(map[string]any)["value"])
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		status, _ := client.do(http.MethodDelete, "/scim/v2/Groups/"+groupID, nil)
+		require.Equal(t, http.StatusNoContent, status)
+		status, _ = client.do(http.MethodDelete, "/scim/v2/Users/"+userID, nil)
+		require.Equal(t, http.StatusNoContent, status)
+
+		status, response := client.do(http.MethodGet, "/scim/v2/Users/"+userID, nil)
+		require.Equal(t, http.StatusNotFound, status)
+		require.Equal(t, "404", response["status"])
+	})
+
+	t.Run("changes are audited as the owner of the API key", func(t *testing.T) {
+		var operations []string
+		for _, entry := range auditLog.entries {
+			require.Equal(t, model.AuditLogEventScimProvisioning, entry.Event)
+			require.Equal(t, "admin", entry.UserID)
+			operations = append(operations, entry.Data["operation"]+" "+entry.Data["resourceType"])
+		}
+		require.Equal(t, []string{"create User", "update User", "create Group", "update Group", "delete Group", "delete User"}, operations)
+	})
+}
+
+func TestToScimError(t *testing.T) {
+	require.Equal(t, http.StatusNotFound, toScimError(gorm.ErrRecordNotFound).status)
+	require.Equal(t, http.StatusForbidden, toScimError(&common.LdapUserUpdateError{}).status)
+	require.Equal(t, http.StatusInternalServerError, toScimError(errors.New("boom")).status)
+}
@@ -0,0 +1,18 @@
+package scimserver
+
+import (
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// ExternalID is the identifier a provisioning client assigned to a user or group it created in Pocket ID
+type ExternalID struct {
+	model.Base
+
+	UserID      *string
+	UserGroupID *string
+	ExternalID  string
+}
+
+func (ExternalID) TableName() string {
+	return "scim_external_ids"
+}
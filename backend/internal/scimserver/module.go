@@ -0,0 +1,89 @@
+package scimserver
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+// ApiKeyValidator resolves the owner of an API key that was granted the given scope
+type ApiKeyValidator interface {
+	ValidateScopedApiKey(ctx context.Context, apiKey, scope string) (model.User, error)
+}
+
+// UserManager applies the changes of provisioning clients to users, so they go through the same checks and
+// side effects as changes made by admins
+type UserManager interface {
+	CreateUser(ctx context.Context, input dto.UserCreateDto) (model.User, error)
+	UpdateUser(ctx context.Context, userID string, input dto.UserCreateDto, updateOwnUser bool, isLdapSync bool) (model.User, error)
+	DeleteUser(ctx context.Context, userID string, allowLdapDelete bool) error
+}
+
+// GroupManager applies the changes of provisioning clients to user groups
+type GroupManager interface {
+	Create(ctx context.Context, input dto.UserGroupCreateDto) (model.UserGroup, error)
+	Update(ctx context.Context, id string, input dto.UserGroupCreateDto) (model.UserGroup, error)
+	UpdateUsers(ctx context.Context, id string, userIds []string) (model.UserGroup, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// CustomClaimManager stores the enterprise extension attributes of users as custom claims
+type CustomClaimManager interface {
+	UpdateCustomClaimsForUser(ctx context.Context, userID string, claims []dto.CustomClaimCreateDto) ([]model.CustomClaim, error)
+}
+
+type AuditLogger interface {
+	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
+}
+
+type Dependencies struct {
+	DB     *gorm.DB
+	AppURL string
+
+	ApiKeys      ApiKeyValidator
+	Users        UserManager
+	Groups       GroupManager
+	CustomClaims CustomClaimManager
+	AuditLog     AuditLogger
+}
+
+type Module struct {
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	return &Module{
+		handler: newHandler(newService(deps), deps.ApiKeys),
+	}
+}
+
+// RegisterRoutes mounts the SCIM 2.0 endpoints provisioning clients manage users and groups with
+// The resource endpoints authenticate with API keys that were granted the SCIM scope
+func (m *Module) RegisterRoutes(baseGroup *gin.RouterGroup) {
+	group := baseGroup.Group("/scim/v2")
+	group.GET("/ServiceProviderConfig", m.handler.serviceProviderConfig)
+	group.GET("/ResourceTypes", m.handler.listResourceTypes)
+	group.GET("/ResourceTypes/:id", m.handler.getResourceType)
+	group.GET("/Schemas", m.handler.listSchemas)
+	group.GET("/Schemas/:id", m.handler.getSchema)
+
+	users := group.Group("/Users", m.handler.authenticate)
+	users.GET("", m.handler.listUsers)
+	users.POST("", m.handler.createUser)
+	users.GET("/:id", m.handler.getUser)
+	users.PUT("/:id", m.handler.replaceUser)
+	users.PATCH("/:id", m.handler.patchUser)
+	users.DELETE("/:id", m.handler.deleteUser)
+
+	groups := group.Group("/Groups", m.handler.authenticate)
+	groups.GET("", m.handler.listGroups)
+	groups.POST("", m.handler.createGroup)
+	groups.GET("/:id", m.handler.getGroup)
+	groups.PUT("/:id", m.handler.replaceGroup)
+	groups.PATCH("/:id", m.handler.patchGroup)
+	groups.DELETE("/:id", m.handler.deleteGroup)
+}
@@ -0,0 +1,279 @@
+package scimserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// patchPath is the target of a PATCH operation, e.g. emails[type eq "work"].value
+type patchPath struct {
+	attribute    attributePath
+	filter       filter
+	subAttribute string
+}
+
+func parsePatchPath(input string) (patchPath, error) {
+	invalidPath := newScimError(http.StatusBadRequest, "invalidPath", "invalid path %q", input)
+
+	tokens, err := tokenize(input)
+	if err != nil || len(tokens) == 0 || tokens[0].kind != tokenWord {
+		return patchPath{}, invalidPath
+	}
+
+	attribute, err := parseAttributePath(tokens[0].text)
+	if err != nil {
+		return patchPath{}, invalidPath
+	}
+	result := patchPath{attribute: attribute}
+	if len(tokens) == 1 {
+		return result, nil
+	}
+
+	if tokens[1].kind != tokenOpenBracket || attribute.subAttribute != "" {
+		return patchPath{}, invalidPath
+	}
+	p := &filterParser{tokens: tokens, pos: 2}
+	result.filter, err = p.parseOr()
+	if err != nil {
+		return patchPath{}, newScimError(http.StatusBadRequest, "invalidPath", "invalid filter in path %q: %v", input, err)
+	}
+	if err := p.expect(tokenCloseBracket, "]"); err != nil {
+		return patchPath{}, invalidPath
+	}
+
+	if t := p.peek(); t != nil {
+		if t.kind != tokenWord || !strings.HasPrefix(t.text, ".") || len(t.text) < 2 || p.pos+1 != len(tokens) {
+			return patchPath{}, invalidPath
+		}
+		result.subAttribute = t.text[1:]
+	}
+	return result, nil
+}
+
+// applyPatch applies the operations of a PATCH request to the JSON representation of a resource
+// as defined in RFC 7644 section 3.5.2
+func applyPatch(resource map[string]any, operations []patchOperation) error {
+	for _, operation := range operations {
+		var value any
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return newScimError(http.StatusBadRequest, "invalidSyntax", "invalid value: %v", err)
+			}
+		}
+
+		var err error
+		switch op := strings.ToLower(operation.Op); op {
+		case "add", "replace":
+			err = applyValue(resource, operation.Path, value, op == "replace")
+		case "remove":
+			err = removeValue(resource, operation.Path, value)
+		default:
+			err = newScimError(http.StatusBadRequest, "invalidSyntax", "unsupported operation %q", operation.Op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyValue adds or replaces the value at the path
+// Without path, the value is an object whose attributes are applied one by one
+func applyValue(resource map[string]any, path string, value any, replace bool) error {
+	if path == "" {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return newScimError(http.StatusBadRequest, "invalidValue", "the value of an operation without path must be an object")
+		}
+		for key, value := range object {
+			if err := applyValue(resource, key, value, replace); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	target, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+
+	// The attributes of an extension can be set with its URN as path and an object as value
+	if object, ok := value.(map[string]any); ok && target.attribute.isExtension() && target.attribute.attribute == "" {
+		for key, value := range object {
+			if err := applyValue(resource, target.attribute.schema+":"+key, value, replace); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	container := target.attribute.container(resource, true)
+	key := findKey(container, target.attribute.key())
+
+	if target.filter == nil {
+		if subAttribute := target.attribute.subAttribute; subAttribute != "" {
+			parent, ok := container[key].(map[string]any)
+			if !ok {
+				if container[key] != nil {
+					return newScimError(http.StatusBadRequest, "invalidPath", "%q is not a complex attribute", target.attribute.key())
+				}
+				parent = map[string]any{}
+				container[key] = parent
+			}
+			parent[findKey(parent, subAttribute)] = value
+			return nil
+		}
+
+		container[key] = mergeValue(container[key], value, replace)
+		return nil
+	}
+
+	// Apply the value to the values of the multi-valued attribute that match the filter
+	elements := asList(container[key])
+	matched := false
+	for i, element := range elements {
+		object, ok := element.(map[string]any)
+		if !ok || !target.filter.matches(object) {
+			continue
+		}
+		matched = true
+		elements[i] = applyToElement(object, target.subAttribute, value)
+	}
+
+	if !matched {
+		// Clients replace e.g. emails[type eq "work"].value without knowing whether the resource has such an email,
+		// so a new value is added that matches a filter on a single sub-attribute
+		comparison, ok := target.filter.(comparisonFilter)
+		if !ok || comparison.operator != "eq" || comparison.path.subAttribute != "" || comparison.path.schema != "" {
+			return newScimError(http.StatusBadRequest, "noTarget", "no value matches the path %q", path)
+		}
+		element := map[string]any{comparison.path.attribute: comparison.value}
+		elements = append(elements, applyToElement(element, target.subAttribute, value))
+	}
+
+	container[key] = elements
+	return nil
+}
+
+func applyToElement(element map[string]any, subAttribute string, value any) any {
+	if subAttribute != "" {
+		element[findKey(element, subAttribute)] = value
+		return element
+	}
+	if object, ok := value.(map[string]any); ok {
+		for key, value := range object {
+			element[findKey(element, key)] = value
+		}
+		return element
+	}
+	return value
+}
+
+// mergeValue returns the new value of an attribute
+// Values are added to multi-valued attributes unless they are replaced, and the sub-attributes of complex attributes
+// are always merged
+func mergeValue(existing, value any, replace bool) any {
+	if existingList, ok := existing.([]any); ok && !replace {
+		for _, element := range asList(value) {
+			if !containsValue(existingList, element) {
+				existingList = append(existingList, element)
+			}
+		}
+		return existingList
+	}
+
+	existingObject, existingIsObject := existing.(map[string]any)
+	object, isObject := value.(map[string]any)
+	if existingIsObject && isObject {
+		for key, value := range object {
+			existingObject[findKey(existingObject, key)] = value
+		}
+		return existingObject
+	}
+
+	return value
+}
+
+// removeValue removes the value at the path
+func removeValue(resource map[string]any, path string, value any) error {
+	if path == "" {
+		return newScimError(http.StatusBadRequest, "noTarget", "remove operations require a path")
+	}
+
+	target, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+
+	container := target.attribute.container(resource, false)
+	if container == nil {
+		return nil
+	}
+	key := findKey(container, target.attribute.key())
+
+	if target.filter == nil {
+		if subAttribute := target.attribute.subAttribute; subAttribute != "" {
+			if parent, ok := container[key].(map[string]any); ok {
+				delete(parent, findKey(parent, subAttribute))
+			}
+			return nil
+		}
+
+		// Some clients remove values from multi-valued attributes by passing them as value instead of a filter
+		if existing, ok := container[key].([]any); ok && value != nil {
+			var remaining []any
+			for _, element := range existing {
+				if !containsValue(asList(value), element) {
+					remaining = append(remaining, element)
+				}
+			}
+			container[key] = remaining
+			return nil
+		}
+
+		delete(container, key)
+		return nil
+	}
+
+	var remaining []any
+	for _, element := range asList(container[key]) {
+		object, ok := element.(map[string]any)
+		if !ok || !target.filter.matches(object) {
+			remaining = append(remaining, element)
+			continue
+		}
+		if target.subAttribute != "" {
+			delete(object, findKey(object, target.subAttribute))
+			remaining = append(remaining, object)
+		}
+	}
+	container[key] = remaining
+	return nil
+}
+
+// containsValue reports whether the list contains the value, where complex values are identified by their "value"
+// sub-attribute
+func containsValue(list []any, value any) bool {
+	for _, element := range list {
+		if sameValue(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameValue(a, b any) bool {
+	objectA, okA := a.(map[string]any)
+	objectB, okB := b.(map[string]any)
+	if okA && okB {
+		valueA, hasA := objectA[findKey(objectA, "value")]
+		valueB, hasB := objectB[findKey(objectB, "value")]
+		if hasA && hasB {
+			return reflect.DeepEqual(valueA, valueB)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,141 @@
+package scimserver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func operation(op, path string, value any) patchOperation {
+	encoded, _ := json.Marshal(value)
+	if value == nil {
+		encoded = nil
+	}
+	return patchOperation{Op: op, Path: path, Value: encoded}
+}
+
+func TestPatchUser(t *testing.T) {
+	newUser := func() userResource {
+		return userResource{
+			Schemas:     []string{schemaUser},
+			ID:          "alice",
+			UserName:    "alice",
+			DisplayName: "Alice",
+			Active:      new(flexibleBool(true)),
+			Name:        &userName{GivenName: "Alice", FamilyName: "Liddell"},
+			Emails:      []email{{Value: "alice@example.com", Type: "work", Primary: true}},
+		}
+	}
+
+	t.Run("replace without path", func(t *testing.T) {
+		var patched userResource
+		err := patch(newUser(), []patchOperation{
+			operation("Replace", "", map[string]any{"active": "False", "name.givenName": "Al", "displayName": "Al"}),
+		}, &patched)
+		require.NoError(t, err)
+		require.False(t, bool(*patched.Active))
+		require.Equal(t, "Al", patched.Name.GivenName)
+		require.Equal(t, "Liddell", patched.Name.FamilyName)
+		require.Equal(t, "Al", patched.DisplayName)
+	})
+
+	t.Run("replace value selected by filter", func(t *testing.T) {
+		var patched userResource
+		err := patch(newUser(), []patchOperation{
+			operation("replace", `emails[type eq "work"].value`, "alice@wonderland.example"),
+			operation("add", `emails[type eq "home"].value`, "alice@home.example"),
+		}, &patched)
+		require.NoError(t, err)
+		require.Equal(t, []email{
+			{Value: "alice@wonderland.example", Type: "work", Primary: true},
+			{Value: "alice@home.example", Type: "home"},
+		}, patched.Emails)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		var patched userResource
+		err := patch(newUser(), []patchOperation{
+			operation("remove", `emails[type eq "work"]`, nil),
+			operation("remove", "name.givenName", nil),
+			operation("remove", "displayName", nil),
+		}, &patched)
+		require.NoError(t, err)
+		require.Empty(t, patched.Emails)
+		require.Empty(t, patched.DisplayName)
+		require.Empty(t, patched.Name.GivenName)
+	})
+
+	t.Run("enterprise extension", func(t *testing.T) {
+		var patched userResource
+		err := patch(newUser(), []patchOperation{
+			operation("Add", schemaEnterpriseUser+":department", "Engineering"),
+			operation("Add", schemaEnterpriseUser+":manager", "bob"),
+			operation("replace", "", map[string]any{schemaEnterpriseUser: map[string]any{"costCenter": "4130"}}),
+		}, &patched)
+		require.NoError(t, err)
+		require.Equal(t, &enterpriseUser{
+			Department: "Engineering",
+			CostCenter: "4130",
+			Manager:    &managerReference{Value: "bob"},
+		}, patched.Enterprise)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			operation patchOperation
+			scimType  string
+		}{
+			{operation("remove", "", nil), "noTarget"},
+			{operation("move", "displayName", "Al"), "invalidSyntax"},
+			{operation("replace", `emails[type eq "work"`, "x"), "invalidPath"},
+			{operation("replace", `emails[type co "other"].value`, "x"), "noTarget"},
+			{operation("replace", "", "Al"), "invalidValue"},
+			{operation("replace", "active", "maybe"), "invalidValue"},
+		}
+
+		for _, tt := range tests {
+			var patched userResource
+			err := patch(newUser(), []patchOperation{tt.operation}, &patched)
+			require.Error(t, err, tt.operation)
+			require.Equal(t, tt.scimType, toScimError(err).scimType, tt.operation)
+		}
+	})
+}
+
+func TestPatchGroupMembers(t *testing.T) {
+	group := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          "staff",
+		DisplayName: "Staff",
+		Members:     []reference{{Value: "alice"}, {Value: "bob"}},
+	}
+
+	memberIDs := func(t *testing.T, operations ...patchOperation) []string {
+		t.Helper()
+
+		var patched groupResource
+		require.NoError(t, patch(group, operations, &patched))
+		ids := []string{}
+		for _, member := range patched.Members {
+			ids = append(ids, member.Value)
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"alice", "bob", "carol"}, memberIDs(t,
+		operation("Add", "members", []map[string]any{{"value": "carol"}, {"value": "alice"}}),
+	))
+	require.Equal(t, []string{"alice"}, memberIDs(t,
+		operation("Remove", `members[value eq "bob"]`, nil),
+	))
+	require.Equal(t, []string{"bob"}, memberIDs(t,
+		operation("Remove", "members", []map[string]any{{"value": "alice"}}),
+	))
+	require.Equal(t, []string{"carol"}, memberIDs(t,
+		operation("Replace", "members", []map[string]any{{"value": "carol"}}),
+	))
+	require.Equal(t, []string{}, memberIDs(t,
+		operation("Remove", "members", nil),
+	))
+}
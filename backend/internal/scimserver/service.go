@@ -0,0 +1,907 @@
+package scimserver
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+const (
+	resourceTypeUser  = "User"
+	resourceTypeGroup = "Group"
+
+	userColumn  = "user_id"
+	groupColumn = "user_group_id"
+)
+
+// enterpriseClaimKeys are the custom claim keys the attributes of the enterprise user extension are stored as
+var enterpriseClaimKeys = []string{"employeeNumber", "costCenter", "organization", "division", "department", "manager"}
+
+// scimError is an error that is returned to provisioning clients as SCIM error response
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func newScimError(status int, scimType, format string, args ...any) *scimError {
+	return &scimError{status: status, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+// toScimError maps the errors of the services to the status codes they have in the regular API
+func toScimError(err error) *scimError {
+	if scimErr, ok := errors.AsType[*scimError](err); ok {
+		return scimErr
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return newScimError(http.StatusNotFound, "", "resource not found")
+	}
+	if errors.Is(err, &common.AlreadyInUseError{}) {
+		// SCIM expects conflicts with existing resources to be reported as 409 rather than 400
+		return newScimError(http.StatusConflict, "uniqueness", "%s", err.Error())
+	}
+	if appErr, ok := errors.AsType[common.AppError](err); ok {
+		switch status := appErr.HttpStatusCode(); status {
+		case http.StatusBadRequest:
+			return newScimError(status, "invalidValue", "%s", appErr.Error())
+		default:
+			return newScimError(status, "", "%s", appErr.Error())
+		}
+	}
+
+	slog.Error("Failed to handle SCIM request", slog.Any("error", err))
+	return newScimError(http.StatusInternalServerError, "", "internal server error")
+}
+
+// actor is the admin whose API key a provisioning client authenticated with
+type actor struct {
+	userID    string
+	ipAddress string
+	userAgent string
+}
+
+// listQuery holds the query parameters of list requests
+type listQuery struct {
+	filter             filter
+	startIndex         int
+	count              int
+	attributes         []string
+	excludedAttributes []string
+}
+
+type service struct {
+	db     *gorm.DB
+	appURL string
+
+	users        UserManager
+	groups       GroupManager
+	customClaims CustomClaimManager
+	auditLog     AuditLogger
+}
+
+func newService(deps Dependencies) *service {
+	return &service{
+		db:           deps.DB,
+		appURL:       strings.TrimSuffix(deps.AppURL, "/"),
+		users:        deps.Users,
+		groups:       deps.Groups,
+		customClaims: deps.CustomClaims,
+		auditLog:     deps.AuditLog,
+	}
+}
+
+func (s *service) listUsers(ctx context.Context, query listQuery) (listResponse, error) {
+	filtered, err := filterScope(query.filter, userSQLAttributes)
+	if err != nil {
+		return listResponse{}, err
+	}
+	scope := func(db *gorm.DB) *gorm.DB {
+		return filtered(db.Where("users.id <> ?", common.StaticApiKeyUserID))
+	}
+
+	var total int64
+	err = s.db.
+		WithContext(ctx).
+		Model(&model.User{}).
+		Scopes(scope).
+		Count(&total).
+		Error
+	if err != nil {
+		return listResponse{}, err
+	}
+
+	var users []model.User
+	if query.count > 0 {
+		users, err = s.loadUsers(ctx, scope, pageScope(query))
+		if err != nil {
+			return listResponse{}, err
+		}
+	}
+
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	externalIDs, err := s.loadExternalIDs(ctx, userColumn, ids...)
+	if err != nil {
+		return listResponse{}, err
+	}
+
+	resources := make([]map[string]any, 0, len(users))
+	for _, user := range users {
+		resource, err := toMap(s.toUserResource(user, externalIDs[user.ID]))
+		if err != nil {
+			return listResponse{}, err
+		}
+		resources = append(resources, resource)
+	}
+	return newPageResponse(resources, query, total), nil
+}
+
+func (s *service) getUser(ctx context.Context, id string) (userResource, error) {
+	users, err := s.loadUsers(ctx, idScope(id))
+	if err != nil {
+		return userResource{}, err
+	}
+	if len(users) == 0 {
+		return userResource{}, newScimError(http.StatusNotFound, "", "user %q not found", id)
+	}
+
+	externalIDs, err := s.loadExternalIDs(ctx, userColumn, id)
+	if err != nil {
+		return userResource{}, err
+	}
+	return s.toUserResource(users[0], externalIDs[id]), nil
+}
+
+func (s *service) createUser(ctx context.Context, actor actor, resource userResource) (userResource, error) {
+	input, err := userInput(resource, nil)
+	if err != nil {
+		return userResource{}, err
+	}
+
+	user, err := s.users.CreateUser(ctx, input)
+	if err != nil {
+		return userResource{}, err
+	}
+	if err := s.saveUserDetails(ctx, user.ID, resource); err != nil {
+		return userResource{}, err
+	}
+
+	s.audit(ctx, actor, "create", resourceTypeUser, user.ID, user.Username)
+	return s.getUser(ctx, user.ID)
+}
+
+func (s *service) replaceUser(ctx context.Context, actor actor, id string, resource userResource) (userResource, error) {
+	existing, err := s.loadModifiableUser(ctx, id)
+	if err != nil {
+		return userResource{}, err
+	}
+
+	input, err := userInput(resource, &existing)
+	if err != nil {
+		return userResource{}, err
+	}
+
+	user, err := s.users.UpdateUser(ctx, id, input, false, false)
+	if err != nil {
+		return userResource{}, err
+	}
+	if err := s.saveUserDetails(ctx, id, resource); err != nil {
+		return userResource{}, err
+	}
+
+	s.audit(ctx, actor, "update", resourceTypeUser, id, user.Username)
+	return s.getUser(ctx, id)
+}
+
+func (s *service) patchUser(ctx context.Context, actor actor, id string, operations []patchOperation) (userResource, error) {
+	if _, err := s.loadModifiableUser(ctx, id); err != nil {
+		return userResource{}, err
+	}
+
+	current, err := s.getUser(ctx, id)
+	if err != nil {
+		return userResource{}, err
+	}
+
+	var patched userResource
+	if err := patch(current, operations, &patched); err != nil {
+		return userResource{}, err
+	}
+	return s.replaceUser(ctx, actor, id, patched)
+}
+
+func (s *service) deleteUser(ctx context.Context, actor actor, id string) error {
+	user, err := s.loadModifiableUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.DeleteUser(ctx, id, false); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, "delete", resourceTypeUser, id, user.Username)
+	return nil
+}
+
+// loadModifiableUser loads the user with the given ID and refuses admins
+// The API key is handed to an external identity provider, which must not be able to take over an admin account, e.g.
+// by changing its email address
+func (s *service) loadModifiableUser(ctx context.Context, id string) (model.User, error) {
+	users, err := s.loadUsers(ctx, idScope(id))
+	if err != nil {
+		return model.User{}, err
+	}
+	if len(users) == 0 {
+		return model.User{}, newScimError(http.StatusNotFound, "", "user %q not found", id)
+	}
+	if users[0].IsAdmin {
+		return model.User{}, newScimError(http.StatusForbidden, "", "admin accounts can't be modified through SCIM")
+	}
+	return users[0], nil
+}
+
+// loadUsers loads the users selected by the scopes with their groups and custom claims
+func (s *service) loadUsers(ctx context.Context, scopes ...func(*gorm.DB) *gorm.DB) ([]model.User, error) {
+	var users []model.User
+	err := s.db.
+		WithContext(ctx).
+		Preload("UserGroups").
+		Preload("CustomClaims").
+		Where("users.id <> ?", common.StaticApiKeyUserID).
+		Scopes(scopes...).
+		Order("users.created_at, users.id").
+		Find(&users).
+		Error
+	return users, err
+}
+
+func (s *service) toUserResource(user model.User, externalID string) userResource {
+	resource := userResource{
+		Schemas:     []string{schemaUser},
+		ID:          user.ID,
+		ExternalID:  externalID,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      new(flexibleBool(!user.Disabled)),
+		Meta: &meta{
+			ResourceType: resourceTypeUser,
+			Created:      formatTime(user.CreatedAt.ToTime()),
+			LastModified: formatTime(user.LastModified()),
+			Location:     s.location("Users", user.ID),
+		},
+	}
+
+	if user.FirstName != "" || user.LastName != "" {
+		resource.Name = &userName{
+			Formatted:  user.FullName(),
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		}
+	}
+	if user.Locale != nil {
+		resource.Locale = *user.Locale
+	}
+	if user.Email != nil {
+		resource.Emails = []email{{Value: *user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range user.UserGroups {
+		resource.Groups = append(resource.Groups, reference{
+			Value:   group.ID,
+			Ref:     s.location("Groups", group.ID),
+			Display: group.FriendlyName,
+		})
+	}
+
+	claims := make(map[string]string, len(user.CustomClaims))
+	for _, claim := range user.CustomClaims {
+		claims[claim.Key] = claim.Value
+	}
+	if enterprise := s.toEnterpriseUser(claims); enterprise != nil {
+		resource.Schemas = append(resource.Schemas, schemaEnterpriseUser)
+		resource.Enterprise = enterprise
+	}
+
+	return resource
+}
+
+func (s *service) toEnterpriseUser(claims map[string]string) *enterpriseUser {
+	enterprise := enterpriseUser{
+		EmployeeNumber: claims["employeeNumber"],
+		CostCenter:     claims["costCenter"],
+		Organization:   claims["organization"],
+		Division:       claims["division"],
+		Department:     claims["department"],
+	}
+	if manager := claims["manager"]; manager != "" {
+		enterprise.Manager = &managerReference{Value: manager, Ref: s.location("Users", manager)}
+	}
+
+	if enterprise == (enterpriseUser{}) {
+		return nil
+	}
+	return &enterprise
+}
+
+// enterpriseClaims returns the attributes of the enterprise user extension as custom claims
+func enterpriseClaims(enterprise *enterpriseUser) map[string]string {
+	claims := map[string]string{}
+	if enterprise == nil {
+		return claims
+	}
+
+	values := map[string]string{
+		"employeeNumber": enterprise.EmployeeNumber,
+		"costCenter":     enterprise.CostCenter,
+		"organization":   enterprise.Organization,
+		"division":       enterprise.Division,
+		"department":     enterprise.Department,
+	}
+	if enterprise.Manager != nil {
+		values["manager"] = enterprise.Manager.Value
+	}
+	for key, value := range values {
+		if value != "" {
+			claims[key] = value
+		}
+	}
+	return claims
+}
+
+// userInput maps a user resource to the input of the user service
+// Attributes SCIM doesn't know about, like the admin flag, are kept from the existing user
+func userInput(resource userResource, existing *model.User) (dto.UserCreateDto, error) {
+	input := dto.UserCreateDto{
+		Username:    resource.UserName,
+		DisplayName: resource.DisplayName,
+		Email:       primaryEmail(resource.Emails),
+		Disabled:    resource.Active != nil && !bool(*resource.Active),
+	}
+	if resource.Name != nil {
+		input.FirstName = resource.Name.GivenName
+		input.LastName = resource.Name.FamilyName
+		input.DisplayName = cmp.Or(input.DisplayName, resource.Name.Formatted, strings.TrimSpace(input.FirstName+" "+input.LastName))
+	}
+	if resource.Locale != "" {
+		input.Locale = &resource.Locale
+	}
+
+	if existing != nil {
+		input.IsAdmin = existing.IsAdmin
+		input.EmailVerified = existing.EmailVerified && existing.Email != nil && input.Email != nil && *existing.Email == *input.Email
+		if input.Locale == nil {
+			input.Locale = existing.Locale
+		}
+	}
+
+	dto.Normalize(&input)
+	if err := input.Validate(); err != nil {
+		return dto.UserCreateDto{}, newScimError(http.StatusBadRequest, "invalidValue", "invalid user: %v", err)
+	}
+	return input, nil
+}
+
+func primaryEmail(emails []email) *string {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	primary := emails[0]
+	for _, email := range emails {
+		if email.Primary {
+			primary = email
+			break
+		}
+	}
+	if primary.Value == "" {
+		return nil
+	}
+	return &primary.Value
+}
+
+// saveUserDetails stores the attributes of a user resource the user service doesn't manage
+func (s *service) saveUserDetails(ctx context.Context, userID string, resource userResource) error {
+	var claims []model.CustomClaim
+	err := s.db.
+		WithContext(ctx).
+		Where("user_id = ?", userID).
+		Find(&claims).
+		Error
+	if err != nil {
+		return err
+	}
+
+	// Replace the enterprise claims and keep all other custom claims of the user
+	current := map[string]string{}
+	updated := make([]dto.CustomClaimCreateDto, 0, len(claims))
+	for _, claim := range claims {
+		if slices.Contains(enterpriseClaimKeys, claim.Key) {
+			current[claim.Key] = claim.Value
+		} else {
+			updated = append(updated, dto.CustomClaimCreateDto{Key: claim.Key, Value: claim.Value})
+		}
+	}
+
+	values := enterpriseClaims(resource.Enterprise)
+	if !maps.Equal(current, values) {
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			updated = append(updated, dto.CustomClaimCreateDto{Key: key, Value: values[key]})
+		}
+		if _, err := s.customClaims.UpdateCustomClaimsForUser(ctx, userID, updated); err != nil {
+			return err
+		}
+	}
+
+	return s.saveExternalID(ctx, userColumn, userID, resource.ExternalID)
+}
+
+func (s *service) listGroups(ctx context.Context, query listQuery) (listResponse, error) {
+	scope, err := filterScope(query.filter, groupSQLAttributes)
+	if err != nil {
+		return listResponse{}, err
+	}
+
+	var total int64
+	err = s.db.
+		WithContext(ctx).
+		Model(&model.UserGroup{}).
+		Scopes(scope).
+		Count(&total).
+		Error
+	if err != nil {
+		return listResponse{}, err
+	}
+
+	var groups []model.UserGroup
+	if query.count > 0 {
+		groups, err = s.loadGroups(ctx, scope, pageScope(query))
+		if err != nil {
+			return listResponse{}, err
+		}
+	}
+
+	ids := make([]string, len(groups))
+	for i, group := range groups {
+		ids[i] = group.ID
+	}
+	externalIDs, err := s.loadExternalIDs(ctx, groupColumn, ids...)
+	if err != nil {
+		return listResponse{}, err
+	}
+
+	resources := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		resource, err := toMap(s.toGroupResource(group, externalIDs[group.ID]))
+		if err != nil {
+			return listResponse{}, err
+		}
+		resources = append(resources, resource)
+	}
+	return newPageResponse(resources, query, total), nil
+}
+
+func (s *service) getGroup(ctx context.Context, id string) (groupResource, error) {
+	groups, err := s.loadGroups(ctx, idScope(id))
+	if err != nil {
+		return groupResource{}, err
+	}
+	if len(groups) == 0 {
+		return groupResource{}, newScimError(http.StatusNotFound, "", "group %q not found", id)
+	}
+
+	externalIDs, err := s.loadExternalIDs(ctx, groupColumn, id)
+	if err != nil {
+		return groupResource{}, err
+	}
+	return s.toGroupResource(groups[0], externalIDs[id]), nil
+}
+
+func (s *service) createGroup(ctx context.Context, actor actor, resource groupResource) (groupResource, error) {
+	input := dto.UserGroupCreateDto{
+		FriendlyName: resource.DisplayName,
+		Name:         resource.DisplayName,
+	}
+	if err := validateGroupInput(&input); err != nil {
+		return groupResource{}, err
+	}
+
+	group, err := s.groups.Create(ctx, input)
+	if err != nil {
+		return groupResource{}, err
+	}
+	if err := s.saveGroupDetails(ctx, group.ID, nil, resource); err != nil {
+		return groupResource{}, err
+	}
+
+	s.audit(ctx, actor, "create", resourceTypeGroup, group.ID, group.FriendlyName)
+	return s.getGroup(ctx, group.ID)
+}
+
+func (s *service) replaceGroup(ctx context.Context, actor actor, id string, resource groupResource) (groupResource, error) {
+	groups, err := s.loadGroups(ctx, idScope(id))
+	if err != nil {
+		return groupResource{}, err
+	}
+	if len(groups) == 0 {
+		return groupResource{}, newScimError(http.StatusNotFound, "", "group %q not found", id)
+	}
+	existing := groups[0]
+
+	// The name stays the same, so the values of the groups claim don't change when a group is renamed
+	input := dto.UserGroupCreateDto{
+		FriendlyName: resource.DisplayName,
+		Name:         existing.Name,
+	}
+	if err := validateGroupInput(&input); err != nil {
+		return groupResource{}, err
+	}
+
+	if input.FriendlyName != existing.FriendlyName {
+		if _, err := s.groups.Update(ctx, id, input); err != nil {
+			return groupResource{}, err
+		}
+	}
+
+	memberIDs := make([]string, len(existing.Users))
+	for i, user := range existing.Users {
+		memberIDs[i] = user.ID
+	}
+	if err := s.saveGroupDetails(ctx, id, memberIDs, resource); err != nil {
+		return groupResource{}, err
+	}
+
+	s.audit(ctx, actor, "update", resourceTypeGroup, id, input.FriendlyName)
+	return s.getGroup(ctx, id)
+}
+
+func (s *service) patchGroup(ctx context.Context, actor actor, id string, operations []patchOperation) (groupResource, error) {
+	current, err := s.getGroup(ctx, id)
+	if err != nil {
+		return groupResource{}, err
+	}
+
+	var patched groupResource
+	if err := patch(current, operations, &patched); err != nil {
+		return groupResource{}, err
+	}
+	return s.replaceGroup(ctx, actor, id, patched)
+}
+
+func (s *service) deleteGroup(ctx context.Context, actor actor, id string) error {
+	groups, err := s.loadGroups(ctx, idScope(id))
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return newScimError(http.StatusNotFound, "", "group %q not found", id)
+	}
+
+	if err := s.groups.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, "delete", resourceTypeGroup, id, groups[0].FriendlyName)
+	return nil
+}
+
+// loadGroups loads the user groups selected by the scopes with their members
+func (s *service) loadGroups(ctx context.Context, scopes ...func(*gorm.DB) *gorm.DB) ([]model.UserGroup, error) {
+	var groups []model.UserGroup
+	err := s.db.
+		WithContext(ctx).
+		Preload("Users", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Scopes(scopes...).
+		Order("user_groups.created_at, user_groups.id").
+		Find(&groups).
+		Error
+	return groups, err
+}
+
+// idScope selects the resource with the given ID
+func idScope(id string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id = ?", id)
+	}
+}
+
+// filterScope returns a scope that selects the resources that match the filter
+func filterScope(f filter, attributes sqlAttributes) (func(*gorm.DB) *gorm.DB, error) {
+	if f == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	condition, err := toSQL(f, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(condition.query, condition.args...)
+	}, nil
+}
+
+// pageScope selects the page of resources requested by the list query
+func pageScope(query listQuery) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset(query.startIndex - 1).Limit(query.count)
+	}
+}
+
+func (s *service) toGroupResource(group model.UserGroup, externalID string) groupResource {
+	lastModified := group.CreatedAt.ToTime()
+	if group.UpdatedAt != nil {
+		lastModified = group.UpdatedAt.ToTime()
+	}
+
+	resource := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          group.ID,
+		ExternalID:  externalID,
+		DisplayName: group.FriendlyName,
+		Meta: &meta{
+			ResourceType: resourceTypeGroup,
+			Created:      formatTime(group.CreatedAt.ToTime()),
+			LastModified: formatTime(lastModified),
+			Location:     s.location("Groups", group.ID),
+		},
+	}
+	for _, user := range group.Users {
+		resource.Members = append(resource.Members, reference{
+			Value:   user.ID,
+			Ref:     s.location("Users", user.ID),
+			Display: cmp.Or(user.DisplayName, user.Username),
+			Type:    resourceTypeUser,
+		})
+	}
+	return resource
+}
+
+func validateGroupInput(input *dto.UserGroupCreateDto) error {
+	dto.Normalize(input)
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "invalid group: %v", err)
+	}
+	return nil
+}
+
+// saveGroupDetails stores the members and the external ID of a group
+// currentMemberIDs are the IDs of the members before the change, which is used to skip unchanged memberships
+func (s *service) saveGroupDetails(ctx context.Context, groupID string, currentMemberIDs []string, resource groupResource) error {
+	memberIDs := make([]string, 0, len(resource.Members))
+	for _, member := range resource.Members {
+		if !slices.Contains(memberIDs, member.Value) {
+			memberIDs = append(memberIDs, member.Value)
+		}
+	}
+
+	if len(memberIDs) > 0 {
+		var count int64
+		err := s.db.
+			WithContext(ctx).
+			Model(&model.User{}).
+			Where("id IN ?", memberIDs).
+			Count(&count).
+			Error
+		if err != nil {
+			return err
+		}
+		if int(count) != len(memberIDs) {
+			return newScimError(http.StatusBadRequest, "invalidValue", "members must reference existing users")
+		}
+	}
+
+	slices.Sort(memberIDs)
+	currentMemberIDs = slices.Sorted(slices.Values(currentMemberIDs))
+	if !slices.Equal(memberIDs, currentMemberIDs) {
+		if _, err := s.groups.UpdateUsers(ctx, groupID, memberIDs); err != nil {
+			return err
+		}
+	}
+
+	return s.saveExternalID(ctx, groupColumn, groupID, resource.ExternalID)
+}
+
+// loadExternalIDs returns the external IDs of the users or groups with the given IDs by their ID
+func (s *service) loadExternalIDs(ctx context.Context, column string, ids ...string) (map[string]string, error) {
+	if len(ids) == 0 {
+		return map[string]string{}, nil
+	}
+
+	var records []ExternalID
+	err := s.db.
+		WithContext(ctx).
+		Where(column+" IN ?", ids).
+		Find(&records).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	externalIDs := make(map[string]string, len(records))
+	for _, record := range records {
+		if record.UserID != nil {
+			externalIDs[*record.UserID] = record.ExternalID
+		} else if record.UserGroupID != nil {
+			externalIDs[*record.UserGroupID] = record.ExternalID
+		}
+	}
+	return externalIDs, nil
+}
+
+func (s *service) saveExternalID(ctx context.Context, column, id, externalID string) error {
+	if externalID == "" {
+		return s.db.
+			WithContext(ctx).
+			Where(column+" = ?", id).
+			Delete(&ExternalID{}).
+			Error
+	}
+
+	var record ExternalID
+	err := s.db.
+		WithContext(ctx).
+		Where(column+" = ?", id).
+		First(&record).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		record = ExternalID{ExternalID: externalID}
+		if column == userColumn {
+			record.UserID = &id
+		} else {
+			record.UserGroupID = &id
+		}
+		return s.db.WithContext(ctx).Create(&record).Error
+	} else if err != nil {
+		return err
+	}
+
+	if record.ExternalID == externalID {
+		return nil
+	}
+	return s.db.
+		WithContext(ctx).
+		Model(&record).
+		Update("external_id", externalID).
+		Error
+}
+
+// audit records a change made by a provisioning client in the audit log of the admin whose API key it used
+func (s *service) audit(ctx context.Context, actor actor, operation, resourceType, resourceID, resourceName string) {
+	data := model.AuditLogData{
+		"operation":    operation,
+		"resourceType": resourceType,
+		"resourceId":   resourceID,
+		"resourceName": resourceName,
+	}
+	s.auditLog.Create(ctx, model.AuditLogEventScimProvisioning, actor.ipAddress, actor.userAgent, actor.userID, data, s.db)
+}
+
+func (s *service) location(endpoint, id string) string {
+	return s.appURL + "/scim/v2/" + endpoint + "/" + id
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// patch applies the operations of a PATCH request to the resource and decodes the result into patched
+func patch(resource any, operations []patchOperation, patched any) error {
+	object, err := toMap(resource)
+	if err != nil {
+		return err
+	}
+	if err := applyPatch(object, operations); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(encoded, patched); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "invalid value: %v", err)
+	}
+	return nil
+}
+
+// toMap returns the JSON representation of a resource, which filters, PATCH operations and attribute selection
+// operate on
+func toMap(resource any) (map[string]any, error) {
+	encoded, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]any
+	err = json.Unmarshal(encoded, &object)
+	return object, err
+}
+
+// newPageResponse returns the page of resources with the requested attributes
+// total is the number of resources that match the filter of the query
+func newPageResponse(page []map[string]any, query listQuery, total int64) listResponse {
+	for i, resource := range page {
+		page[i] = selectAttributes(resource, query.attributes, query.excludedAttributes)
+	}
+
+	return listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: int(total),
+		StartIndex:   query.startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// selectAttributes returns the resource with only the requested attributes, or without the excluded attributes
+// The attributes that are always returned, like the ID, can't be excluded
+func selectAttributes(resource map[string]any, attributes, excludedAttributes []string) map[string]any {
+	if len(attributes) > 0 {
+		selected := map[string]any{}
+		for _, key := range []string{"schemas", "id", "meta"} {
+			if value, ok := resource[key]; ok {
+				selected[key] = value
+			}
+		}
+		for _, attribute := range attributes {
+			path, err := parseAttributePath(attribute)
+			if err != nil {
+				continue
+			}
+			key := path.key()
+			if path.isExtension() {
+				key = path.schema
+			}
+			key = findKey(resource, key)
+			if value, ok := resource[key]; ok {
+				selected[key] = value
+			}
+		}
+		resource = selected
+	}
+
+	for _, attribute := range excludedAttributes {
+		path, err := parseAttributePath(attribute)
+		if err != nil {
+			continue
+		}
+
+		container := path.container(resource, false)
+		if container == nil {
+			continue
+		}
+		key := findKey(container, path.key())
+		if key == "id" || key == "schemas" {
+			continue
+		}
+		if path.subAttribute == "" {
+			delete(container, key)
+		} else if object, ok := container[key].(map[string]any); ok {
+			delete(object, findKey(object, path.subAttribute))
+		}
+	}
+
+	return resource
+}
@@ -21,8 +21,9 @@ import (
 )
 
 type AppConfigService struct {
-	dbConfig atomic.Pointer[model.AppConfig]
-	db       *gorm.DB
+	dbConfig        atomic.Pointer[model.AppConfig]
+	db              *gorm.DB
+	auditLogService *AuditLogService
 }
 
 func NewAppConfigService(ctx context.Context, db *gorm.DB) (*AppConfigService, error) {
@@ -43,6 +44,12 @@ func NewAppConfigService(ctx context.Context, db *gorm.DB) (*AppConfigService, e
 	return service, nil
 }
 
+// SetAuditLogService sets the service that records changes of the configuration in the audit log.
+// It's set after construction, as the audit log service depends on this service.
+func (s *AppConfigService) SetAuditLogService(auditLogService *AuditLogService) {
+	s.auditLogService = auditLogService
+}
+
 // GetDbConfig returns the application configuration.
 // Important: Treat the object as read-only: do not modify its properties directly!
 func (s *AppConfigService) GetDbConfig() *model.AppConfig {
@@ -178,6 +185,7 @@ func (s *AppConfigService) UpdateAppConfig(ctx context.Context, input dto.AppCon
 	if err != nil {
 		return nil, fmt.Errorf("failed to reload config from database: %w", err)
 	}
+	previousState := newAppConfigAuditLogState(cfg)
 
 	defaultCfg := s.getDefaultDbConfig()
 
@@ -223,6 +231,14 @@ func (s *AppConfigService) UpdateAppConfig(ctx context.Context, input dto.AppCon
 		return nil, err
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:  model.AuditLogEventAppConfigUpdated,
+			Before: previousState,
+			After:  newAppConfigAuditLogState(cfg),
+		}, tx)
+	}
+
 	// Commit the changes to the DB, then finally save the updated config in the object
 	err = tx.Commit().Error
 	if err != nil {
@@ -316,6 +332,16 @@ func (s *AppConfigService) UpdateAppConfigValues(ctx context.Context, keysAndVal
 	return nil
 }
 
+// newAppConfigAuditLogState returns the configuration values that are recorded in the audit log when the configuration is changed
+func newAppConfigAuditLogState(cfg *model.AppConfig) map[string]string {
+	variables := cfg.ToAppConfigVariableSlice(true, false)
+	state := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		state[variable.Key] = variable.Value
+	}
+	return state
+}
+
 func (s *AppConfigService) ListAppConfig(showAll bool) []model.AppConfigVariable {
 	return s.GetDbConfig().ToAppConfigVariableSlice(showAll, true)
 }
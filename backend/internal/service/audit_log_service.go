@@ -1,9 +1,16 @@
 package service
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 
 	userAgentParser "github.com/mileusna/useragent"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
@@ -13,19 +20,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// AuditLogNotifier is notified about every audit log in the transaction it's created in
+type AuditLogNotifier interface {
+	NotifyAuditLog(ctx context.Context, tx *gorm.DB, auditLog model.AuditLog) error
+}
+
 type AuditLogService struct {
 	db               *gorm.DB
 	appConfigService *AppConfigService
 	emailService     *EmailService
 	geoliteService   *GeoLiteService
+	notifier         AuditLogNotifier
 }
 
-func NewAuditLogService(db *gorm.DB, appConfigService *AppConfigService, emailService *EmailService, geoliteService *GeoLiteService) *AuditLogService {
+func NewAuditLogService(db *gorm.DB, appConfigService *AppConfigService, emailService *EmailService, geoliteService *GeoLiteService, notifier AuditLogNotifier) *AuditLogService {
 	return &AuditLogService{
 		db:               db,
 		appConfigService: appConfigService,
 		emailService:     emailService,
 		geoliteService:   geoliteService,
+		notifier:         notifier,
 	}
 }
 
@@ -61,9 +75,158 @@ func (s *AuditLogService) Create(ctx context.Context, event model.AuditLogEvent,
 		return model.AuditLog{}, false
 	}
 
+	if s.notifier != nil {
+		err = s.notifier.NotifyAuditLog(ctx, tx, auditLog)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to notify about audit log", slog.Any("error", err))
+			return model.AuditLog{}, false
+		}
+	}
+
 	return auditLog, true
 }
 
+// CreateChange records a change that an authenticated user made through the API, with the differences between the
+// states before and after the change. Changes without an actor in the context, like the ones made by the LDAP sync,
+// aren't recorded. Updates that didn't change anything aren't recorded either.
+func (s *AuditLogService) CreateChange(ctx context.Context, change model.AuditLogChange, tx *gorm.DB) {
+	actor, ok := model.AuditLogActorFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	fieldChanges, err := diffAuditLogStates(change.Before, change.After)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to compute audit log changes", slog.String("event", string(change.Event)), slog.Any("error", err))
+		return
+	}
+	if change.Before != nil && change.After != nil && len(fieldChanges) == 0 {
+		return
+	}
+
+	data := model.AuditLogData{
+		"actorUserID": actor.UserID,
+	}
+	if change.TargetID != "" {
+		data["targetID"] = change.TargetID
+	}
+	if change.TargetName != "" {
+		data["targetName"] = change.TargetName
+	}
+	if len(fieldChanges) > 0 {
+		encoded, err := json.Marshal(fieldChanges)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to encode audit log changes", slog.Any("error", err))
+			return
+		}
+		data["changes"] = string(encoded)
+	}
+
+	var actorUsername string
+	err = tx.
+		WithContext(ctx).
+		Model(&model.User{}).
+		Where("id = ?", actor.UserID).
+		Pluck("username", &actorUsername).
+		Error
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load username of audit log actor", slog.Any("error", err))
+	}
+	if actorUsername != "" {
+		data["actorUsername"] = actorUsername
+	}
+
+	s.Create(ctx, change.Event, actor.IPAddress, actor.UserAgent, cmp.Or(change.TargetUserID, actor.UserID), data, tx)
+}
+
+// auditLogFieldChange is the change of a single field of a resource, the values are JSON encoded
+type auditLogFieldChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// auditLogIgnoredFields aren't included in the differences because they're either part of the audit log already or
+// change on every update
+var auditLogIgnoredFields = []string{"id", "createdAt", "updatedAt"}
+
+const auditLogRedactedValue = `"[REDACTED]"`
+
+// diffAuditLogStates returns the fields whose JSON values differ between the two states.
+// The values of fields that hold credentials are redacted, so only the fact that they changed is recorded.
+func diffAuditLogStates(before, after any) (map[string]auditLogFieldChange, error) {
+	beforeFields, err := auditLogStateFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditLogStateFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]auditLogFieldChange)
+	keys := slices.Collect(maps.Keys(beforeFields))
+	for key := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		beforeValue, afterValue := beforeFields[key], afterFields[key]
+		if slices.Contains(auditLogIgnoredFields, key) || bytes.Equal(beforeValue, afterValue) {
+			continue
+		}
+
+		if isSensitiveAuditLogField(key) {
+			if beforeValue != nil {
+				beforeValue = json.RawMessage(auditLogRedactedValue)
+			}
+			if afterValue != nil {
+				afterValue = json.RawMessage(auditLogRedactedValue)
+			}
+		}
+		changes[key] = auditLogFieldChange{Before: beforeValue, After: afterValue}
+	}
+
+	return changes, nil
+}
+
+// auditLogStateFields returns the normalized JSON values of the top-level fields of a state, null values are omitted
+func auditLogStateFields(state any) (map[string]json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	var decoded map[string]any
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		return nil, errors.New("state must be encoded as a JSON object")
+	}
+
+	fields := make(map[string]json.RawMessage, len(decoded))
+	for key, value := range decoded {
+		if value == nil {
+			continue
+		}
+		// Encoding the decoded value sorts the keys of nested objects, so equal values have equal encodings
+		fields[key], err = json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field '%s': %w", key, err)
+		}
+	}
+
+	return fields, nil
+}
+
+func isSensitiveAuditLogField(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "password") || strings.HasSuffix(key, "secret") || strings.HasSuffix(key, "token")
+}
+
 // CreateNewSignInWithEmail creates a new audit log entry in the database and sends an email if the device hasn't been used before
 func (s *AuditLogService) CreateNewSignInWithEmail(ctx context.Context, ipAddress, userAgent, userID string, tx *gorm.DB) model.AuditLog {
 	createdAuditLog, ok := s.Create(ctx, model.AuditLogEventSignIn, ipAddress, userAgent, userID, model.AuditLogData{}, tx)
@@ -147,6 +310,10 @@ func (s *AuditLogService) ListAuditLogsForUser(ctx context.Context, userID strin
 }
 
 func (s *AuditLogService) DeviceStringFromUserAgent(userAgent string) string {
+	return deviceStringFromUserAgent(userAgent)
+}
+
+func deviceStringFromUserAgent(userAgent string) string {
 	ua := userAgentParser.Parse(userAgent)
 	return ua.Name + " on " + ua.OS + " " + ua.OSVersion
 }
@@ -171,6 +338,19 @@ func (s *AuditLogService) ListAllAuditLogs(ctx context.Context, listRequestOptio
 		}
 	}
 
+	if actorUserIDs, ok := listRequestOptions.Filters["actorUserID"]; ok {
+		// Events without an actor, like sign-ins, were performed by the user they belong to
+		dialect := s.db.Name()
+		switch dialect {
+		case "sqlite":
+			query = query.Where("(json_extract(data, '$.actorUserID') IN ? OR (json_extract(data, '$.actorUserID') IS NULL AND user_id IN ?))", actorUserIDs, actorUserIDs)
+		case "postgres":
+			query = query.Where("(data->>'actorUserID' IN ? OR (data->>'actorUserID' IS NULL AND user_id IN ?))", actorUserIDs, actorUserIDs)
+		default:
+			return nil, utils.PaginationResponse{}, fmt.Errorf("unsupported database dialect: %s", dialect)
+		}
+	}
+
 	if locations, ok := listRequestOptions.Filters["location"]; ok {
 		mapped := make([]string, 0, len(locations))
 		for _, v := range locations {
@@ -223,6 +403,44 @@ func (s *AuditLogService) ListUsernamesWithIds(ctx context.Context) (users map[s
 	return users, nil
 }
 
+// ListActorsWithIds returns the users that performed an event in the audit log. These are the users that made a
+// change and the users of events without an actor, like sign-ins.
+func (s *AuditLogService) ListActorsWithIds(ctx context.Context) (users map[string]string, err error) {
+	var actorCondition string
+	switch dialect := s.db.Name(); dialect {
+	case "sqlite":
+		actorCondition = "id IN (SELECT COALESCE(json_extract(data, '$.actorUserID'), user_id) FROM audit_logs)"
+	case "postgres":
+		actorCondition = "id::text IN (SELECT COALESCE(data->>'actorUserID', user_id::text) FROM audit_logs)"
+	default:
+		return nil, fmt.Errorf("unsupported database dialect: %s", dialect)
+	}
+
+	query := s.db.
+		WithContext(ctx).
+		Model(&model.User{}).
+		Select("id, username").
+		Where(actorCondition)
+
+	type Result struct {
+		ID       string `gorm:"column:id"`
+		Username string `gorm:"column:username"`
+	}
+
+	var results []Result
+	err = query.Find(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query actors: %w", err)
+	}
+
+	users = make(map[string]string, len(results))
+	for _, result := range results {
+		users[result.ID] = result.Username
+	}
+
+	return users, nil
+}
+
 func (s *AuditLogService) ListClientNames(ctx context.Context) (clientNames []string, err error) {
 	dialect := s.db.Name()
 	query := s.db.
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+func TestDiffAuditLogStates(t *testing.T) {
+	type state struct {
+		ID           string            `json:"id"`
+		Name         string            `json:"name"`
+		Email        *string           `json:"email"`
+		SmtpPassword string            `json:"smtpPassword"`
+		Claims       map[string]string `json:"claims"`
+	}
+
+	before := state{ID: "1", Name: "before", SmtpPassword: "old", Claims: map[string]string{"a": "1", "b": "2"}}
+	after := state{ID: "2", Name: "after", Email: new("user@example.com"), SmtpPassword: "new", Claims: map[string]string{"b": "2", "a": "1"}}
+
+	changes, err := diffAuditLogStates(before, after)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]auditLogFieldChange{
+		"name":         {Before: json.RawMessage(`"before"`), After: json.RawMessage(`"after"`)},
+		"email":        {After: json.RawMessage(`"user@example.com"`)},
+		"smtpPassword": {Before: json.RawMessage(auditLogRedactedValue), After: json.RawMessage(auditLogRedactedValue)},
+	}, changes)
+
+	changes, err = diffAuditLogStates(before, before)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = diffAuditLogStates([]string{"not", "an", "object"}, nil)
+	require.Error(t, err)
+}
+
+func TestAuditLogServiceCreateChange(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	service := NewAuditLogService(db, nil, nil, NewGeoLiteService(nil), nil)
+
+	admin := model.User{Username: "admin", IsAdmin: true}
+	require.NoError(t, db.Create(&admin).Error)
+	user := model.User{Username: "user"}
+	require.NoError(t, db.Create(&user).Error)
+
+	ctx := model.ContextWithAuditLogActor(t.Context(), model.AuditLogActor{UserID: admin.ID, UserAgent: "test-agent"})
+
+	t.Run("records the actor, the target and the changes", func(t *testing.T) {
+		service.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventUserUpdated,
+			TargetID:     user.ID,
+			TargetName:   user.Username,
+			TargetUserID: user.ID,
+			Before:       map[string]any{"isAdmin": false},
+			After:        map[string]any{"isAdmin": true},
+		}, db)
+
+		var auditLog model.AuditLog
+		require.NoError(t, db.Last(&auditLog).Error)
+		assert.Equal(t, model.AuditLogEventUserUpdated, auditLog.Event)
+		assert.Equal(t, user.ID, auditLog.UserID)
+		assert.Equal(t, admin.ID, auditLog.Data["actorUserID"])
+		assert.Equal(t, "admin", auditLog.Data["actorUsername"])
+		assert.Equal(t, user.ID, auditLog.Data["targetID"])
+		assert.JSONEq(t, `{"isAdmin":{"before":false,"after":true}}`, auditLog.Data["changes"])
+	})
+
+	t.Run("skips updates without changes and changes without an actor", func(t *testing.T) {
+		var count int64
+		require.NoError(t, db.Model(&model.AuditLog{}).Count(&count).Error)
+
+		service.CreateChange(ctx, model.AuditLogChange{
+			Event:  model.AuditLogEventAppConfigUpdated,
+			Before: map[string]string{"appName": "Pocket ID"},
+			After:  map[string]string{"appName": "Pocket ID"},
+		}, db)
+		service.CreateChange(t.Context(), model.AuditLogChange{
+			Event: model.AuditLogEventUserCreated,
+			After: map[string]string{"username": "ldap-user"},
+		}, db)
+
+		var newCount int64
+		require.NoError(t, db.Model(&model.AuditLog{}).Count(&newCount).Error)
+		assert.Equal(t, count, newCount)
+	})
+
+	t.Run("filters by actor", func(t *testing.T) {
+		service.Create(t.Context(), model.AuditLogEventSignIn, "", "test-agent", user.ID, model.AuditLogData{}, db)
+
+		logs, _, err := service.ListAllAuditLogs(t.Context(), utils.ListRequestOptions{
+			Filters: map[string][]any{"actorUserID": {admin.ID}},
+		})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		assert.Equal(t, model.AuditLogEventUserUpdated, logs[0].Event)
+
+		logs, _, err = service.ListAllAuditLogs(t.Context(), utils.ListRequestOptions{
+			Filters: map[string][]any{"actorUserID": {user.ID}},
+		})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		assert.Equal(t, model.AuditLogEventSignIn, logs[0].Event)
+
+		actors, err := service.ListActorsWithIds(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{admin.ID: "admin", user.ID: "user"}, actors)
+	})
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"slices"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
 	"github.com/pocket-id/pocket-id/backend/internal/dto"
@@ -10,11 +11,19 @@ import (
 )
 
 type CustomClaimService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	scimService     *ScimService
+	auditLogService *AuditLogService
 }
 
-func NewCustomClaimService(db *gorm.DB) *CustomClaimService {
-	return &CustomClaimService{db: db}
+func NewCustomClaimService(db *gorm.DB, auditLogService *AuditLogService) *CustomClaimService {
+	return &CustomClaimService{db: db, auditLogService: auditLogService}
+}
+
+// SetScimService sets the service that pushes changes of claims to SCIM service providers.
+// It's set after construction, as the SCIM service depends on the OIDC module, which depends on this service.
+func (s *CustomClaimService) SetScimService(scimService *ScimService) {
+	s.scimService = scimService
 }
 
 // isReservedClaim checks if a claim key is reserved e.g. email, preferred_username
@@ -72,6 +81,10 @@ func (s *CustomClaimService) UpdateCustomClaimsForUser(ctx context.Context, user
 		return nil, err
 	}
 
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return updatedClaims, nil
 }
 
@@ -92,6 +105,10 @@ func (s *CustomClaimService) UpdateCustomClaimsForUserGroup(ctx context.Context,
 		return nil, err
 	}
 
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return updatedClaims, nil
 }
 
@@ -177,9 +194,99 @@ func (s *CustomClaimService) updateCustomClaimsInternal(ctx context.Context, idT
 		return nil, err
 	}
 
+	err = s.recordScimChanges(ctx, idType, value, existingClaims, updatedClaims, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.recordAuditLogChange(ctx, idType, value, existingClaims, updatedClaims, tx)
+	if err != nil {
+		return nil, err
+	}
+
 	return updatedClaims, nil
 }
 
+// recordAuditLogChange records the changed claims of the user or user group in the audit log
+func (s *CustomClaimService) recordAuditLogChange(ctx context.Context, idType idType, value string, previousClaims, updatedClaims []model.CustomClaim, tx *gorm.DB) error {
+	if s.auditLogService == nil {
+		return nil
+	}
+
+	change := model.AuditLogChange{
+		Event:    model.AuditLogEventCustomClaimsUpdated,
+		TargetID: value,
+		Before:   newCustomClaimsAuditLogState(previousClaims),
+		After:    newCustomClaimsAuditLogState(updatedClaims),
+	}
+
+	var err error
+	switch idType {
+	case UserID:
+		change.TargetUserID = value
+		err = tx.
+			WithContext(ctx).
+			Model(&model.User{}).
+			Where("id = ?", value).
+			Pluck("username", &change.TargetName).
+			Error
+	case UserGroupID:
+		err = tx.
+			WithContext(ctx).
+			Model(&model.UserGroup{}).
+			Where("id = ?", value).
+			Pluck("friendly_name", &change.TargetName).
+			Error
+	}
+	if err != nil {
+		return err
+	}
+
+	s.auditLogService.CreateChange(ctx, change, tx)
+	return nil
+}
+
+// customClaimsAuditLogState are the claims of a user or user group that are recorded in the audit log when they're changed
+type customClaimsAuditLogState struct {
+	Claims map[string]string `json:"claims"`
+}
+
+func newCustomClaimsAuditLogState(claims []model.CustomClaim) customClaimsAuditLogState {
+	state := customClaimsAuditLogState{Claims: make(map[string]string, len(claims))}
+	for _, claim := range claims {
+		state.Claims[claim.Key] = claim.Value
+	}
+	return state
+}
+
+// recordScimChanges records a SCIM change for the users whose provisioned claims may have changed
+func (s *CustomClaimService) recordScimChanges(ctx context.Context, idType idType, value string, previousClaims, updatedClaims []model.CustomClaim, tx *gorm.DB) error {
+	if s.scimService == nil {
+		return nil
+	}
+
+	provisioned := func(claim model.CustomClaim) bool { return isEnterpriseClaim(claim.Key) }
+	if !slices.ContainsFunc(previousClaims, provisioned) && !slices.ContainsFunc(updatedClaims, provisioned) {
+		return nil
+	}
+
+	userIDs := []string{value}
+	if idType == UserGroupID {
+		userIDs = nil
+		err := tx.
+			WithContext(ctx).
+			Table("user_groups_users").
+			Where("user_group_id = ?", value).
+			Pluck("user_id", &userIDs).
+			Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.scimService.RecordUserChange(ctx, tx, userIDs...)
+}
+
 func (s *CustomClaimService) GetCustomClaimsForUser(ctx context.Context, userID string, tx *gorm.DB) ([]model.CustomClaim, error) {
 	var customClaims []model.CustomClaim
 	err := tx.
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	htemplate "html/template"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/textproto"
@@ -19,10 +20,12 @@ import (
 	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
 	"github.com/pocket-id/pocket-id/backend/internal/utils/email"
 )
 
@@ -73,6 +76,34 @@ func (srv *EmailService) SendTestEmail(ctx context.Context, recipientUserId stri
 		}, TestTemplate, nil)
 }
 
+// NotifyBackchannelAuthenticationRequest emails the user a link to approve the backchannel authentication request of a client.
+// The email is only sent if SMTP is configured and the user has an email address.
+func (srv *EmailService) NotifyBackchannelAuthenticationRequest(ctx context.Context, user model.User, client model.OidcClient, bindingMessage, approvalURL string, expiresAt time.Time) {
+	if srv.appConfigService.GetDbConfig().SmtpHost.Value == "" || user.Email == nil {
+		return
+	}
+
+	// #nosec G118 - We use a background context here as this is running in a goroutine
+	//nolint:contextcheck
+	go func() {
+		span := trace.SpanFromContext(ctx)
+		innerCtx := trace.ContextWithSpan(context.Background(), span)
+
+		err := SendEmail(innerCtx, srv, email.Address{
+			Name:  user.FullName(),
+			Email: *user.Email,
+		}, BackchannelAuthenticationTemplate, &BackchannelAuthenticationTemplateData{
+			ClientName:       client.Name,
+			BindingMessage:   bindingMessage,
+			ApprovalLink:     approvalURL,
+			ExpirationString: utils.DurationToString(time.Until(expiresAt).Round(time.Minute)),
+		})
+		if err != nil {
+			slog.ErrorContext(innerCtx, "Failed to send backchannel authentication email", slog.Any("error", err), slog.String("address", *user.Email))
+		}
+	}()
+}
+
 func SendEmail[V any](ctx context.Context, srv *EmailService, toEmail email.Address, template email.Template[V], tData *V) error {
 	dbConfig := srv.appConfigService.GetDbConfig()
 
@@ -56,6 +56,13 @@ var EmailVerificationTemplate = email.Template[EmailVerificationTemplateData]{
 	},
 }
 
+var BackchannelAuthenticationTemplate = email.Template[BackchannelAuthenticationTemplateData]{
+	Path: "backchannel-authentication",
+	Title: func(data *email.TemplateData[BackchannelAuthenticationTemplateData]) string {
+		return fmt.Sprintf("Sign-in request from %s", data.Data.ClientName)
+	},
+}
+
 type NewLoginTemplateData struct {
 	IPAddress string
 	Country   string
@@ -82,5 +89,12 @@ type EmailVerificationTemplateData struct {
 	VerificationLink string
 }
 
+type BackchannelAuthenticationTemplateData struct {
+	ClientName       string
+	BindingMessage   string
+	ApprovalLink     string
+	ExpirationString string
+}
+
 // this is list of all template paths used for preloading templates
-var emailTemplatesPaths = []string{NewLoginTemplate.Path, OneTimeAccessTemplate.Path, TestTemplate.Path, ApiKeyExpiringSoonTemplate.Path, EmailVerificationTemplate.Path}
+var emailTemplatesPaths = []string{NewLoginTemplate.Path, OneTimeAccessTemplate.Path, TestTemplate.Path, ApiKeyExpiringSoonTemplate.Path, EmailVerificationTemplate.Path, BackchannelAuthenticationTemplate.Path}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,6 +31,9 @@ const (
 	// TokenTypeClaim is the claim used to identify the type of token
 	TokenTypeClaim = "type"
 
+	// SessionIDClaim is the claim used in access tokens to reference the user session they belong to
+	SessionIDClaim = "sid"
+
 	// AuthenticationMethodPhishingResistant identifies phishing-resistant authentication, such as passkeys
 	AuthenticationMethodPhishingResistant = "phr"
 
@@ -40,15 +45,28 @@ const (
 
 	// Acceptable clock skew for verifying tokens
 	clockSkew = time.Minute
+
+	// Maximum lifetime of the tokens issued by the OIDC provider
+	// Clients and API resources can configure access and ID token lifetimes of up to 24 hours
+	maxOidcTokenLifetime = 24 * time.Hour
+
+	// Maximum time a new signing key is published before it's used to sign tokens
+	// This gives relying parties the time to refresh their cached JWKS
+	signingKeyPublishLeadTime = 24 * time.Hour
 )
 
 type JwtService struct {
 	db               *gorm.DB
 	envConfig        *common.EnvConfigSchema
-	privateKey       jwk.Key
-	keyId            string
 	appConfigService *AppConfigService
-	jwksEncoded      []byte
+
+	// keyLock protects the fields below, which change when the keys are rotated
+	keyLock     sync.RWMutex
+	keySet      *jwkutils.KeySet
+	privateKey  jwk.Key
+	keyId       string
+	publicKeys  jwk.Set
+	jwksEncoded []byte
 }
 
 func NewJwtService(ctx context.Context, db *gorm.DB, appConfigService *AppConfigService) (*JwtService, error) {
@@ -73,56 +91,139 @@ func (s *JwtService) init(ctx context.Context, db *gorm.DB, appConfigService *Ap
 
 func (s *JwtService) LoadOrGenerateKey(ctx context.Context) error {
 	// Get the key provider
-	keyProvider, err := jwkutils.GetKeyProvider(s.db, s.envConfig, s.appConfigService.GetDbConfig().InstanceID.Value)
+	keyProvider, err := s.getKeyProvider()
 	if err != nil {
-		return fmt.Errorf("failed to get key provider: %w", err)
+		return err
 	}
 
-	// Try loading a key
-	key, err := keyProvider.LoadKey(ctx)
+	// Try loading the key set
+	keySet, err := keyProvider.LoadKeySet(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load key: %w", err)
+		return fmt.Errorf("failed to load key set: %w", err)
 	}
 
-	// If we have a key, store it in the object and we're done
-	if key != nil {
-		err = s.SetKey(key)
+	// If we have a key set, store it in the object and we're done
+	if keySet != nil {
+		err = s.SetKeySet(keySet)
 		if err != nil {
-			return fmt.Errorf("failed to set private key: %w", err)
+			return fmt.Errorf("failed to set key set: %w", err)
 		}
 		return nil
 	}
 
 	// If we are here, we need to generate a new key
-	err = s.generateKey()
+	// Default is to generate RS256 (RSA-2048) keys
+	key, err := jwkutils.GenerateKey(jwa.RS256().String(), "")
 	if err != nil {
-		return fmt.Errorf("failed to generate key: %w", err)
+		return fmt.Errorf("failed to generate new private key: %w", err)
 	}
+	keySet = jwkutils.NewKeySet(key, time.Now())
 
-	// Save the newly-generated key
-	err = keyProvider.SaveKey(ctx, s.privateKey)
+	// Set the key set in the object, which also validates it
+	err = s.SetKeySet(keySet)
 	if err != nil {
-		return fmt.Errorf("failed to save private key: %w", err)
+		return fmt.Errorf("failed to set key set: %w", err)
+	}
+
+	// Save the newly-generated key set
+	err = keyProvider.SaveKeySet(ctx, keySet)
+	if err != nil {
+		return fmt.Errorf("failed to save key set: %w", err)
 	}
 
 	return nil
 }
 
-// generateKey generates a new key and stores it in the object
-func (s *JwtService) generateKey() error {
-	// Default is to generate RS256 (RSA-2048) keys
-	key, err := jwkutils.GenerateKey(jwa.RS256().String(), "")
+// RotateKeys reloads the key set from the database and advances the rotation of the signing keys:
+//   - Retired keys are removed once the tokens signed with them have expired
+//   - When the active key is about to reach the rotation interval, a new key is generated and published as next key
+//   - A next key that has been published for long enough becomes the active key
+//
+// Reloading the key set also picks up keys rotated by other replicas or with the key-rotate command.
+func (s *JwtService) RotateKeys(ctx context.Context) error {
+	keyProvider, err := s.getKeyProvider()
 	if err != nil {
-		return fmt.Errorf("failed to generate new private key: %w", err)
+		return err
 	}
 
-	// Set the key in the object, which also validates it
-	err = s.SetKey(key)
+	keySet, err := keyProvider.LoadKeySet(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to set private key: %w", err)
+		return fmt.Errorf("failed to load key set: %w", err)
+	}
+	if keySet == nil {
+		return errors.New("key set not found in the database")
 	}
 
-	return nil
+	changed, err := advanceKeyRotation(keySet, time.Now(), s.keyRotationInterval(), SigningKeyRetention(s.appConfigService))
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		err = keyProvider.SaveKeySet(ctx, keySet)
+		if err != nil {
+			return fmt.Errorf("failed to save key set: %w", err)
+		}
+	}
+
+	return s.SetKeySet(keySet)
+}
+
+func advanceKeyRotation(keySet *jwkutils.KeySet, now time.Time, interval time.Duration, retention time.Duration) (changed bool, err error) {
+	changed = keySet.Prune(now)
+
+	// Publish the next key before the active key reaches the end of the interval
+	leadTime := signingKeyPublishLeadTime
+	if interval > 0 {
+		leadTime = min(leadTime, interval/2)
+	}
+
+	active := keySet.Active()
+	if interval > 0 && keySet.Next() == nil && active.ActivatedAt != nil && !now.Before(active.ActivatedAt.Add(interval-leadTime)) {
+		// Generate a key of the same type as the active one
+		alg, _ := active.Key.Algorithm()
+		var crv string
+		if alg == jwa.EdDSA() {
+			crv = jwa.Ed25519().String()
+		}
+		key, err := jwkutils.GenerateKey(alg.String(), crv)
+		if err != nil {
+			return false, fmt.Errorf("failed to generate next key: %w", err)
+		}
+
+		keySet.Stage(key, now)
+		changed = true
+	}
+
+	// Start using the next key once relying parties had the time to fetch it
+	next := keySet.Next()
+	if next != nil && !now.Before(next.CreatedAt.Add(leadTime)) {
+		err = keySet.Promote(now, retention)
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+func (s *JwtService) keyRotationInterval() time.Duration {
+	return time.Duration(s.envConfig.KeyRotationDays) * 24 * time.Hour
+}
+
+func (s *JwtService) getKeyProvider() (jwkutils.KeyProvider, error) {
+	keyProvider, err := jwkutils.GetKeyProvider(s.db, s.envConfig, s.appConfigService.GetDbConfig().InstanceID.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key provider: %w", err)
+	}
+	return keyProvider, nil
+}
+
+// SigningKeyRetention returns for how long a retired signing key must remain published, which is the lifetime of the longest-lived token signed with it
+func SigningKeyRetention(appConfigService *AppConfigService) time.Duration {
+	sessionDuration := appConfigService.GetDbConfig().SessionDuration.AsDurationMinutes()
+	return max(sessionDuration, maxOidcTokenLifetime) + clockSkew
 }
 
 func ValidateKey(privateKey jwk.Key) error {
@@ -147,41 +248,54 @@ func ValidateKey(privateKey jwk.Key) error {
 	return nil
 }
 
-func (s *JwtService) SetKey(privateKey jwk.Key) error {
-	// Validate the loaded key
-	err := ValidateKey(privateKey)
+// SetKeySet sets the keys used by the service: the active key is used for signing, and all non-expired keys are published and accepted for verification
+func (s *JwtService) SetKeySet(keySet *jwkutils.KeySet) error {
+	err := keySet.Validate()
 	if err != nil {
-		return fmt.Errorf("private key is not valid: %w", err)
+		return fmt.Errorf("key set is not valid: %w", err)
 	}
 
-	// Set the private key and key id in the object
-	s.privateKey = privateKey
+	// Create a JWKS containing the public keys
+	publicKeys := jwk.NewSet()
+	for _, k := range keySet.Published(time.Now()) {
+		err = ValidateKey(k.Key)
+		if err != nil {
+			return fmt.Errorf("private key '%s' is not valid: %w", k.KeyID(), err)
+		}
 
-	keyId, ok := privateKey.KeyID()
-	if !ok {
-		return errors.New("key object does not contain a key ID")
-	}
-	s.keyId = keyId
+		publicKey, err := k.Key.PublicKey()
+		if err != nil {
+			return fmt.Errorf("failed to get public key: %w", err)
+		}
+		jwkutils.EnsureAlgInKey(publicKey, "", "")
 
-	// Create and encode a JWKS containing the public key
-	publicKey, err := s.GetPublicJWK()
-	if err != nil {
-		return fmt.Errorf("failed to get public JWK: %w", err)
-	}
-	jwks := jwk.NewSet()
-	err = jwks.AddKey(publicKey)
-	if err != nil {
-		return fmt.Errorf("failed to add public key to JWKS: %w", err)
+		err = publicKeys.AddKey(publicKey)
+		if err != nil {
+			return fmt.Errorf("failed to add public key to JWKS: %w", err)
+		}
 	}
-	s.jwksEncoded, err = json.Marshal(jwks)
+
+	jwksEncoded, err := json.Marshal(publicKeys)
 	if err != nil {
 		return fmt.Errorf("failed to encode JWKS to JSON: %w", err)
 	}
 
+	active := keySet.Active()
+
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+
+	s.keySet = keySet
+	s.privateKey = active.Key
+	s.keyId = active.KeyID()
+	s.publicKeys = publicKeys
+	s.jwksEncoded = jwksEncoded
+
 	return nil
 }
 
-func (s *JwtService) GenerateAccessToken(user model.User, authenticationMethod string) (string, error) {
+// GenerateAccessToken creates the access token for a browser session of the user
+func (s *JwtService) GenerateAccessToken(user model.User, authenticationMethod string, sessionID string) (string, error) {
 
 	now := time.Now()
 	token, err := jwt.NewBuilder().
@@ -215,8 +329,14 @@ func (s *JwtService) GenerateAccessToken(user model.User, authenticationMethod s
 		return "", fmt.Errorf("failed to set '%s' claim in token: %w", common.AuthenticationMethodsClaim, err)
 	}
 
-	alg, _ := s.privateKey.Algorithm()
-	signed, err := jwt.Sign(token, jwt.WithKey(alg, s.privateKey))
+	err = SetSessionID(token, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to set '%s' claim in token: %w", SessionIDClaim, err)
+	}
+
+	privateKey := s.getPrivateJWK()
+	alg, _ := privateKey.Algorithm()
+	signed, err := jwt.Sign(token, jwt.WithKey(alg, privateKey))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -225,11 +345,14 @@ func (s *JwtService) GenerateAccessToken(user model.User, authenticationMethod s
 }
 
 func (s *JwtService) VerifyAccessToken(tokenString string) (jwt.Token, error) {
-	alg, _ := s.privateKey.Algorithm()
+	s.keyLock.RLock()
+	publicKeys := s.publicKeys
+	s.keyLock.RUnlock()
+
 	token, err := jwt.ParseString(
 		tokenString,
 		jwt.WithValidate(true),
-		jwt.WithKey(alg, s.privateKey),
+		jwt.WithKeySet(publicKeys),
 		jwt.WithAcceptableSkew(clockSkew),
 		jwt.WithAudience(s.envConfig.AppURL),
 		jwt.WithIssuer(s.envConfig.AppURL),
@@ -242,13 +365,20 @@ func (s *JwtService) VerifyAccessToken(tokenString string) (jwt.Token, error) {
 	return token, nil
 }
 
-// GetPublicJWK returns the JSON Web Key (JWK) for the public key.
+func (s *JwtService) getPrivateJWK() jwk.Key {
+	s.keyLock.RLock()
+	defer s.keyLock.RUnlock()
+	return s.privateKey
+}
+
+// GetPublicJWK returns the JSON Web Key (JWK) for the public key of the active key.
 func (s *JwtService) GetPublicJWK() (jwk.Key, error) {
-	if s.privateKey == nil {
+	privateKey := s.getPrivateJWK()
+	if privateKey == nil {
 		return nil, errors.New("key is not initialized")
 	}
 
-	pubKey, err := s.privateKey.PublicKey()
+	pubKey, err := privateKey.PublicKey()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get public key: %w", err)
 	}
@@ -258,9 +388,24 @@ func (s *JwtService) GetPublicJWK() (jwk.Key, error) {
 	return pubKey, nil
 }
 
-// GetPublicJWKSAsJSON returns the JSON Web Key Set (JWKS) for the public key, encoded as JSON.
-// The value is cached since the key is static.
+// GetPublicKeySet returns the public keys of all the keys that are published, which are accepted to verify tokens.
+func (s *JwtService) GetPublicKeySet() (jwk.Set, error) {
+	s.keyLock.RLock()
+	defer s.keyLock.RUnlock()
+
+	if s.publicKeys == nil {
+		return nil, errors.New("key is not initialized")
+	}
+
+	return s.publicKeys, nil
+}
+
+// GetPublicJWKSAsJSON returns the JSON Web Key Set (JWKS) with the published public keys, encoded as JSON.
+// The value is cached and updated when the keys are rotated.
 func (s *JwtService) GetPublicJWKSAsJSON() ([]byte, error) {
+	s.keyLock.RLock()
+	defer s.keyLock.RUnlock()
+
 	if len(s.jwksEncoded) == 0 {
 		return nil, errors.New("key is not initialized")
 	}
@@ -268,13 +413,57 @@ func (s *JwtService) GetPublicJWKSAsJSON() ([]byte, error) {
 	return s.jwksEncoded, nil
 }
 
-// GetKeyAlg returns the algorithm of the key
+// GetSigningKey returns the active signing key with its key ID and algorithm
+// They're taken from the same key, so they belong together even if the keys are rotated at the same time
+func (s *JwtService) GetSigningKey() (privateKey any, keyID string, alg jwa.KeyAlgorithm, err error) {
+	privateJWK := s.getPrivateJWK()
+	if privateJWK == nil {
+		return nil, "", nil, errors.New("key is not initialized")
+	}
+
+	alg, ok := privateJWK.Algorithm()
+	if !ok || alg == nil {
+		return nil, "", nil, errors.New("failed to retrieve algorithm for key")
+	}
+	err = jwk.Export(privateJWK, &privateKey)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to export private key: %w", err)
+	}
+	keyID, _ = privateJWK.KeyID()
+
+	return privateKey, keyID, alg, nil
+}
+
+// GetPublishedKeyAlgs returns the algorithms of the published keys, which tokens are signed with now or after the
+// next rotation
+func (s *JwtService) GetPublishedKeyAlgs() []string {
+	s.keyLock.RLock()
+	publicKeys := s.publicKeys
+	s.keyLock.RUnlock()
+
+	if publicKeys == nil {
+		return nil
+	}
+
+	algs := make([]string, 0, publicKeys.Len())
+	for i := range publicKeys.Len() {
+		publicKey, _ := publicKeys.Key(i)
+		alg, ok := publicKey.Algorithm()
+		if ok && alg != nil && !slices.Contains(algs, alg.String()) {
+			algs = append(algs, alg.String())
+		}
+	}
+	return algs
+}
+
+// GetKeyAlg returns the algorithm of the active key
 func (s *JwtService) GetKeyAlg() (jwa.KeyAlgorithm, error) {
-	if len(s.jwksEncoded) == 0 {
+	privateKey := s.getPrivateJWK()
+	if privateKey == nil {
 		return nil, errors.New("key is not initialized")
 	}
 
-	alg, ok := s.privateKey.Algorithm()
+	alg, ok := privateKey.Algorithm()
 	if !ok || alg == nil {
 		return nil, errors.New("failed to retrieve algorithm for key")
 	}
@@ -282,14 +471,6 @@ func (s *JwtService) GetKeyAlg() (jwa.KeyAlgorithm, error) {
 	return alg, nil
 }
 
-// GetKeyID returns the key ID (kid) of the signing key, if one is set.
-func (s *JwtService) GetKeyID() (string, bool) {
-	if s.privateKey == nil {
-		return "", false
-	}
-	return s.privateKey.KeyID()
-}
-
 // GetAuthenticationMethod returns the first authentication method in the "amr" claim in the token
 func (s *JwtService) GetAuthenticationMethod(token jwt.Token) (string, error) {
 	if !token.Has(common.AuthenticationMethodsClaim) {
@@ -311,6 +492,19 @@ func (s *JwtService) GetAuthenticationMethod(token jwt.Token) (string, error) {
 	return authenticationMethod, nil
 }
 
+// GetSessionID returns the ID of the user session referenced by the "sid" claim in the token
+func (s *JwtService) GetSessionID(token jwt.Token) (string, error) {
+	if !token.Has(SessionIDClaim) {
+		return "", nil
+	}
+	var sessionID string
+	err := token.Get(SessionIDClaim, &sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get '%s' claim from token: %w", SessionIDClaim, err)
+	}
+	return sessionID, nil
+}
+
 // SetTokenType sets the "type" claim in the token
 func SetTokenType(token jwt.Token, tokenType string) error {
 	if tokenType == "" {
@@ -336,6 +530,14 @@ func SetAuthenticationMethods(token jwt.Token, authenticationMethod string) erro
 	return token.Set(common.AuthenticationMethodsClaim, []string{authenticationMethod})
 }
 
+// SetSessionID sets the "sid" claim in the token
+func SetSessionID(token jwt.Token, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return token.Set(SessionIDClaim, sessionID)
+}
+
 // SetAudienceString sets the "aud" claim with a value that is a string, and not an array
 // This is permitted by RFC 7519, and it's done here for backwards-compatibility
 func SetAudienceString(token jwt.Token, audience string) error {
@@ -357,8 +559,23 @@ func TokenTypeValidator(expectedTokenType string) jwt.ValidatorFunc {
 	}
 }
 
-func (s *JwtService) GetPrivateKey() any {
-	var privateKey any
-	_ = jwk.Export(s.privateKey, &privateKey)
-	return privateKey
+// GetPublishedPrivateKeys returns the private keys of all published keys by their key ID, which are the active key, the
+// next key before it's used and the retired keys that are still retained
+func (s *JwtService) GetPublishedPrivateKeys() map[string]any {
+	s.keyLock.RLock()
+	keySet := s.keySet
+	s.keyLock.RUnlock()
+
+	if keySet == nil {
+		return nil
+	}
+
+	privateKeys := map[string]any{}
+	for _, k := range keySet.Published(time.Now()) {
+		var privateKey any
+		if err := jwk.Export(k.Key, &privateKey); err == nil {
+			privateKeys[k.KeyID()] = privateKey
+		}
+	}
+	return privateKeys
 }
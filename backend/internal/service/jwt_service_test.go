@@ -66,7 +66,7 @@ func saveKeyToDatabase(t *testing.T, db *gorm.DB, envConfig *common.EnvConfigSch
 	keyProvider, err := jwkutils.GetKeyProvider(db, envConfig, appConfig.GetDbConfig().InstanceID.Value)
 	require.NoError(t, err, "Failed to init key provider")
 
-	err = keyProvider.SaveKey(t.Context(), key)
+	err = keyProvider.SaveKeySet(t.Context(), jwkutils.NewKeySet(key, time.Now()))
 	require.NoError(t, err, "Failed to save key")
 
 	kid, ok := key.KeyID()
@@ -94,9 +94,10 @@ func TestJwtService_Init(t *testing.T) {
 		// Verify the key has been persisted in the database
 		keyProvider, err := jwkutils.GetKeyProvider(db, mockEnvConfig, mockConfig.GetDbConfig().InstanceID.Value)
 		require.NoError(t, err, "Failed to init key provider")
-		key, err := keyProvider.LoadKey(t.Context())
-		require.NoError(t, err, "Failed to load key from provider")
-		require.NotNil(t, key, "Key should be present in the database")
+		keySet, err := keyProvider.LoadKeySet(t.Context())
+		require.NoError(t, err, "Failed to load key set from provider")
+		require.NotNil(t, keySet, "Key set should be present in the database")
+		key := keySet.Active().Key
 
 		// Key should have required properties
 		keyID, ok := key.KeyID()
@@ -309,7 +310,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			IsAdmin: false,
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, "")
+		tokenString, err := service.GenerateAccessToken(user, "", "")
 		require.NoError(t, err, "Failed to generate access token")
 		assert.NotEmpty(t, tokenString, "Token should not be empty")
 
@@ -350,7 +351,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			IsAdmin: true,
 		}
 
-		tokenString, err := service.GenerateAccessToken(adminUser, "")
+		tokenString, err := service.GenerateAccessToken(adminUser, "", "")
 		require.NoError(t, err, "Failed to generate access token")
 
 		claims, err := service.VerifyAccessToken(tokenString)
@@ -373,7 +374,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			Base: model.Base{ID: "user-with-auth-method"},
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, AuthenticationMethodPhishingResistant)
+		tokenString, err := service.GenerateAccessToken(user, AuthenticationMethodPhishingResistant, "")
 		require.NoError(t, err, "Failed to generate access token")
 
 		claims, err := service.VerifyAccessToken(tokenString)
@@ -384,6 +385,24 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			assert.Equal(t, AuthenticationMethodPhishingResistant, authenticationMethod, "amr should match")
 	})
 
+	t.Run("sets session ID claim when provided", func(t *testing.T) {
+		service, _, _ := setupJwtService(t, mockConfig)
+
+		user := model.User{
+			Base: model.Base{ID: "user-with-session"},
+		}
+
+		tokenString, err := service.GenerateAccessToken(user, "", "session-123")
+		require.NoError(t, err, "Failed to generate access token")
+
+		claims, err := service.VerifyAccessToken(tokenString)
+		require.NoError(t, err, "Failed to verify generated token")
+
+		sessionID, err := service.GetSessionID(claims)
+		_ = assert.NoError(t, err, "Failed to get sid claim") &&
+			assert.Equal(t, "session-123", sessionID, "sid should match")
+	})
+
 	t.Run("uses session duration from config", func(t *testing.T) {
 		customMockConfig := NewTestAppConfigService(&model.AppConfig{
 			SessionDuration: model.AppConfigVariable{Value: "30"}, // 30 minutes
@@ -394,7 +413,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			Base: model.Base{ID: "user456"},
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, "")
+		tokenString, err := service.GenerateAccessToken(user, "", "")
 		require.NoError(t, err, "Failed to generate access token")
 
 		claims, err := service.VerifyAccessToken(tokenString)
@@ -422,7 +441,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			IsAdmin: true,
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, "")
+		tokenString, err := service.GenerateAccessToken(user, "", "")
 		require.NoError(t, err, "Failed to generate access token with Ed25519 key")
 		assert.NotEmpty(t, tokenString, "Token should not be empty")
 
@@ -461,7 +480,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			IsAdmin: true,
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, "")
+		tokenString, err := service.GenerateAccessToken(user, "", "")
 		require.NoError(t, err, "Failed to generate access token with ECDSA key")
 		assert.NotEmpty(t, tokenString, "Token should not be empty")
 
@@ -500,7 +519,7 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 			IsAdmin: true,
 		}
 
-		tokenString, err := service.GenerateAccessToken(user, "")
+		tokenString, err := service.GenerateAccessToken(user, "", "")
 		require.NoError(t, err, "Failed to generate access token with RSA key")
 		assert.NotEmpty(t, tokenString, "Token should not be empty")
 
@@ -525,6 +544,189 @@ func TestGenerateVerifyAccessToken(t *testing.T) {
 	})
 }
 
+func TestJwtService_RotateKeys(t *testing.T) {
+	mockConfig := NewTestAppConfigService(&model.AppConfig{
+		SessionDuration: model.AppConfigVariable{Value: "60"}, // 60 minutes
+	})
+
+	db, envConfig := newTestDbAndEnv(t)
+	envConfig.KeyRotationDays = 30
+	service := initJwtService(t, db, mockConfig, envConfig)
+
+	keyProvider, err := jwkutils.GetKeyProvider(db, envConfig, mockConfig.GetDbConfig().InstanceID.Value)
+	require.NoError(t, err)
+
+	// Move the activation of the key back, so the rotation becomes due
+	setActivatedAt := func(t *testing.T, activatedAt time.Time) {
+		t.Helper()
+
+		keySet, err := keyProvider.LoadKeySet(t.Context())
+		require.NoError(t, err)
+		keySet.Active().ActivatedAt = &activatedAt
+		if next := keySet.Next(); next != nil {
+			next.CreatedAt = activatedAt
+		}
+		require.NoError(t, keyProvider.SaveKeySet(t.Context(), keySet))
+	}
+
+	user := model.User{Base: model.Base{ID: "user123"}}
+	oldKeyID := service.keyId
+	oldToken, err := service.GenerateAccessToken(user, "", "")
+	require.NoError(t, err)
+
+	// Clients can configure tokens that are valid for much longer than the session
+	clientToken, err := jwt.NewBuilder().Subject(user.ID).Expiration(time.Now().Add(maxOidcTokenLifetime)).Build()
+	require.NoError(t, err)
+	oldKey := service.getPrivateJWK()
+	oldAlg, _ := oldKey.Algorithm()
+	signedClientToken, err := jwt.Sign(clientToken, jwt.WithKey(oldAlg, oldKey))
+	require.NoError(t, err)
+
+	t.Run("does nothing before the rotation is due", func(t *testing.T) {
+		require.NoError(t, service.RotateKeys(t.Context()))
+
+		publicKeys, err := service.GetPublicKeySet()
+		require.NoError(t, err)
+		assert.Equal(t, 1, publicKeys.Len())
+		assert.Equal(t, oldKeyID, service.keyId)
+	})
+
+	t.Run("publishes the next key before using it", func(t *testing.T) {
+		setActivatedAt(t, time.Now().Add(-29*24*time.Hour-time.Minute))
+		require.NoError(t, service.RotateKeys(t.Context()))
+
+		publicKeys, err := service.GetPublicKeySet()
+		require.NoError(t, err)
+		assert.Equal(t, 2, publicKeys.Len(), "Next key should be published")
+		assert.Equal(t, oldKeyID, service.keyId, "Active key should still be used for signing")
+		assert.Len(t, service.GetPublishedPrivateKeys(), 2, "Private key of the next key should be available for the SAML metadata")
+		assert.Equal(t, []string{oldAlg.String()}, service.GetPublishedKeyAlgs(), "Algorithms of the published keys should be listed once")
+	})
+
+	t.Run("promotes the next key and keeps the retired key published", func(t *testing.T) {
+		setActivatedAt(t, time.Now().Add(-30*24*time.Hour-time.Minute))
+		require.NoError(t, service.RotateKeys(t.Context()))
+
+		assert.NotEqual(t, oldKeyID, service.keyId, "Next key should be used for signing")
+
+		privateKey, keyID, alg, err := service.GetSigningKey()
+		require.NoError(t, err)
+		assert.NotNil(t, privateKey)
+		assert.Equal(t, service.keyId, keyID, "Signing key should be returned with the key ID of the next key")
+		assert.Equal(t, oldAlg, alg)
+
+		publicKeys, err := service.GetPublicKeySet()
+		require.NoError(t, err)
+		assert.Equal(t, 2, publicKeys.Len(), "Retired key should still be published")
+
+		// Tokens signed with the retired key are still valid
+		_, err = service.VerifyAccessToken(oldToken)
+		require.NoError(t, err)
+
+		newToken, err := service.GenerateAccessToken(user, "", "")
+		require.NoError(t, err)
+		_, err = service.VerifyAccessToken(newToken)
+		require.NoError(t, err)
+	})
+
+	t.Run("keeps the retired key published while long-lived client tokens are valid", func(t *testing.T) {
+		keySet, err := keyProvider.LoadKeySet(t.Context())
+		require.NoError(t, err)
+
+		later := time.Now().Add(maxOidcTokenLifetime - time.Minute)
+		_, err = advanceKeyRotation(keySet, later, service.keyRotationInterval(), SigningKeyRetention(mockConfig))
+		require.NoError(t, err)
+
+		publicKeys := jwk.NewSet()
+		for _, k := range keySet.Published(later) {
+			publicKey, err := k.Key.PublicKey()
+			require.NoError(t, err)
+			require.NoError(t, publicKeys.AddKey(publicKey))
+		}
+
+		_, err = jwt.Parse(signedClientToken,
+			jwt.WithKeySet(publicKeys),
+			jwt.WithClock(jwt.ClockFunc(func() time.Time { return later })),
+		)
+		require.NoError(t, err, "Token signed with the retired key should still verify against the JWKS")
+	})
+
+	t.Run("another instance loads the rotated keys", func(t *testing.T) {
+		otherService := initJwtService(t, db, mockConfig, envConfig)
+		assert.Equal(t, service.keyId, otherService.keyId)
+
+		jwks, err := otherService.GetPublicJWKSAsJSON()
+		require.NoError(t, err)
+		assert.Contains(t, string(jwks), oldKeyID)
+	})
+}
+
+func TestAdvanceKeyRotation(t *testing.T) {
+	now := time.Now()
+	retention := 2 * time.Hour
+
+	newKeySet := func(t *testing.T, activatedAt time.Time) *jwkutils.KeySet {
+		t.Helper()
+
+		key, err := jwkutils.GenerateKey(jwa.ES256().String(), "")
+		require.NoError(t, err)
+		return jwkutils.NewKeySet(key, activatedAt)
+	}
+
+	t.Run("does not rotate when rotation is disabled", func(t *testing.T) {
+		keySet := newKeySet(t, now.Add(-365*24*time.Hour))
+		changed, err := advanceKeyRotation(keySet, now, 0, retention)
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.Len(t, keySet.Keys, 1)
+	})
+
+	t.Run("promotes a staged key after the lead time when rotation is disabled", func(t *testing.T) {
+		keySet := newKeySet(t, now.Add(-365*24*time.Hour))
+		staged := newKeySet(t, now).Active().Key
+		keySet.Stage(staged, now.Add(-signingKeyPublishLeadTime))
+
+		changed, err := advanceKeyRotation(keySet, now, 0, retention)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		stagedKeyID, _ := staged.KeyID()
+		assert.Equal(t, stagedKeyID, keySet.Active().KeyID())
+		require.Len(t, keySet.Keys, 2)
+		assert.Equal(t, now.Add(retention), *keySet.Keys[0].ExpiresAt)
+	})
+
+	t.Run("generates a next key of the same type", func(t *testing.T) {
+		keySet := newKeySet(t, now.Add(-7*24*time.Hour))
+		changed, err := advanceKeyRotation(keySet, now, 7*24*time.Hour, retention)
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		next := keySet.Next()
+		require.NotNil(t, next)
+		alg, _ := next.Key.Algorithm()
+		assert.Equal(t, jwa.ES256().String(), alg.String())
+	})
+
+	t.Run("caps the lead time to half of the interval", func(t *testing.T) {
+		keySet := newKeySet(t, now.Add(-13*time.Hour))
+		changed, err := advanceKeyRotation(keySet, now, 24*time.Hour, retention)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.NotNil(t, keySet.Next())
+	})
+
+	t.Run("removes expired retired keys", func(t *testing.T) {
+		keySet := newKeySet(t, now.Add(-time.Hour))
+		keySet.Stage(newKeySet(t, now).Active().Key, now.Add(-time.Hour))
+		require.NoError(t, keySet.Promote(now.Add(-time.Hour), time.Minute))
+
+		changed, err := advanceKeyRotation(keySet, now, 0, retention)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.Len(t, keySet.Keys, 1)
+	})
+}
+
 func TestTokenTypeValidator(t *testing.T) {
 	// Create a context for the validator function
 	ctx := context.Background()
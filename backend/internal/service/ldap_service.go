@@ -145,6 +145,11 @@ func (s *LdapService) SyncAll(ctx context.Context) error {
 		return fmt.Errorf("failed to commit changes to database: %w", err)
 	}
 
+	// Push the changes of users and groups to SCIM service providers
+	if s.userService.scimService != nil {
+		s.userService.scimService.ScheduleDelivery()
+	}
+
 	// Now that we've committed the transaction, we can perform operations on the storage layer
 	// First, save all new pictures
 	for _, sp := range savePictures {
@@ -455,7 +460,7 @@ func (s *LdapService) reconcileGroups(ctx context.Context, tx *gorm.DB, desiredG
 			}
 			ldapGroupsByID[desiredGroup.ldapID] = newGroup
 
-			_, err = s.groupService.updateUsersInternal(ctx, newGroup.ID, memberUserIDs, tx)
+			_, err = s.groupService.updateUsersInternal(ctx, newGroup.ID, memberUserIDs, true, tx)
 			if err != nil {
 				return fmt.Errorf("failed to sync users for group '%s': %w", desiredGroup.input.Name, err)
 			}
@@ -467,7 +472,7 @@ func (s *LdapService) reconcileGroups(ctx context.Context, tx *gorm.DB, desiredG
 			return fmt.Errorf("failed to update group '%s': %w", desiredGroup.input.Name, err)
 		}
 
-		_, err = s.groupService.updateUsersInternal(ctx, databaseGroup.ID, memberUserIDs, tx)
+		_, err = s.groupService.updateUsersInternal(ctx, databaseGroup.ID, memberUserIDs, true, tx)
 		if err != nil {
 			return fmt.Errorf("failed to sync users for group '%s': %w", desiredGroup.input.Name, err)
 		}
@@ -491,6 +496,13 @@ func (s *LdapService) reconcileGroups(ctx context.Context, tx *gorm.DB, desiredG
 			return fmt.Errorf("failed to delete group '%s': %w", group.Name, err)
 		}
 
+		if s.groupService.scimService != nil {
+			err = s.groupService.scimService.RecordGroupChange(ctx, tx, group.ID)
+			if err != nil {
+				return fmt.Errorf("failed to record SCIM change of group '%s': %w", group.Name, err)
+			}
+		}
+
 		slog.Info("Deleted group", slog.String("group", group.Name))
 	}
 
@@ -525,6 +537,13 @@ func (s *LdapService) reconcileUsers(ctx context.Context, tx *gorm.DB, desiredUs
 				return nil, nil, fmt.Errorf("failed to enable user %s: %w", databaseUser.Username, err)
 			}
 
+			if s.userService.scimService != nil {
+				err = s.userService.scimService.RecordUserChange(ctx, tx, databaseUser.ID)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to record SCIM change of user %s: %w", databaseUser.Username, err)
+				}
+			}
+
 			databaseUser.Disabled = false
 			ldapUsersByID[desiredUser.ldapID] = databaseUser
 		}
@@ -318,16 +318,17 @@ func newTestLdapServiceWithAppConfig(t *testing.T, appConfigModel *model.AppConf
 
 	appConfig := NewTestAppConfigService(appConfigModel)
 
-	groupService := NewUserGroupService(db, appConfig, nil)
+	groupService := NewUserGroupService(db, appConfig, nil, nil)
 	userService := NewUserService(
 		db,
 		nil,
 		nil,
 		nil,
 		appConfig,
-		NewCustomClaimService(db),
+		NewCustomClaimService(db, nil),
 		NewAppImagesService(map[string]string{}, fileStorage),
 		nil,
+		nil,
 		fileStorage,
 	)
 
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -42,6 +44,9 @@ type OidcService struct {
 	appConfigService *AppConfigService
 	previewBuilder   oidcClientPreviewBuilder
 	scimService      *ScimService
+	auditLogService  *AuditLogService
+	// backchannelLogout notifies clients when the authorization of a user is revoked
+	backchannelLogout *oidc.BackchannelLogoutService
 
 	httpClient  *http.Client
 	fileStorage storage.FileStorage
@@ -57,17 +62,21 @@ func NewOidcService(
 	appConfigService *AppConfigService,
 	previewBuilder oidcClientPreviewBuilder,
 	scimService *ScimService,
+	auditLogService *AuditLogService,
+	backchannelLogout *oidc.BackchannelLogoutService,
 	httpClient *http.Client,
 	fileStorage storage.FileStorage,
 ) (s *OidcService, err error) {
 	s = &OidcService{
-		db:               db,
-		jwtService:       jwtService,
-		appConfigService: appConfigService,
-		previewBuilder:   previewBuilder,
-		scimService:      scimService,
-		httpClient:       httpClient,
-		fileStorage:      fileStorage,
+		db:                db,
+		jwtService:        jwtService,
+		appConfigService:  appConfigService,
+		previewBuilder:    previewBuilder,
+		scimService:       scimService,
+		auditLogService:   auditLogService,
+		backchannelLogout: backchannelLogout,
+		httpClient:        httpClient,
+		fileStorage:       fileStorage,
 	}
 
 	return s, nil
@@ -121,6 +130,47 @@ func (s *OidcService) ListClients(ctx context.Context, name string, listRequestO
 }
 
 func (s *OidcService) CreateClient(ctx context.Context, input dto.OidcClientCreateDto, userID string) (model.OidcClient, error) {
+	tx := s.db.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	client, err := s.CreateClientInternal(ctx, input, userID, tx)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
+	// All storage operations must be executed outside of a transaction
+	if input.LogoURL != nil {
+		err = s.SaveClientLogoFromURL(ctx, client.ID, *input.LogoURL, true)
+		if err != nil {
+			return model.OidcClient{}, err
+		}
+	}
+
+	if input.DarkLogoURL != nil {
+		err = s.SaveClientLogoFromURL(ctx, client.ID, *input.DarkLogoURL, false)
+		if err != nil {
+			return model.OidcClient{}, err
+		}
+	}
+
+	return client, nil
+}
+
+// CreateClientInternal creates the client in the transaction
+// Logos aren't downloaded, because storage operations must be executed outside of a transaction
+func (s *OidcService) CreateClientInternal(ctx context.Context, input dto.OidcClientCreateDto, userID string, tx *gorm.DB) (model.OidcClient, error) {
+	err := s.validateClient(ctx, &input.OidcClientUpdateDto)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
 	client := model.OidcClient{
 		Base: model.Base{
 			ID: input.ID,
@@ -129,7 +179,7 @@ func (s *OidcService) CreateClient(ctx context.Context, input dto.OidcClientCrea
 	}
 	updateOIDCClientModelFromDto(&client, &input.OidcClientUpdateDto)
 
-	err := s.db.
+	err = tx.
 		WithContext(ctx).
 		Create(&client).
 		Error
@@ -140,30 +190,87 @@ func (s *OidcService) CreateClient(ctx context.Context, input dto.OidcClientCrea
 		return model.OidcClient{}, err
 	}
 
+	if s.auditLogService != nil {
+		state, err := newOidcClientAuditLogState(client)
+		if err != nil {
+			return model.OidcClient{}, err
+		}
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventOidcClientCreated,
+			TargetID:   client.ID,
+			TargetName: client.Name,
+			After:      state,
+		}, tx)
+	}
+
+	return client, nil
+}
+
+// SaveClientLogoFromURL downloads the logo of the client from a public URL and stores it
+// It must be called outside of a transaction
+func (s *OidcService) SaveClientLogoFromURL(ctx context.Context, clientID string, logoURL string, light bool) error {
+	err := s.downloadAndSaveLogoFromURL(ctx, clientID, logoURL, light)
+	if err != nil {
+		if light {
+			return fmt.Errorf("failed to download logo: %w", err)
+		}
+		return fmt.Errorf("failed to download dark logo: %w", err)
+	}
+	return nil
+}
+
+func (s *OidcService) UpdateClient(ctx context.Context, clientID string, input dto.OidcClientUpdateDto) (model.OidcClient, error) {
+	// The sector identifier URI is fetched before the transaction is started
+	err := s.validateClient(ctx, &input)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	client, err := s.updateClientInternal(ctx, clientID, input, tx)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
 	// All storage operations must be executed outside of a transaction
 	if input.LogoURL != nil {
-		err = s.downloadAndSaveLogoFromURL(ctx, client.ID, *input.LogoURL, true)
+		err = s.SaveClientLogoFromURL(ctx, client.ID, *input.LogoURL, true)
 		if err != nil {
-			return model.OidcClient{}, fmt.Errorf("failed to download logo: %w", err)
+			return model.OidcClient{}, err
 		}
 	}
 
 	if input.DarkLogoURL != nil {
-		err = s.downloadAndSaveLogoFromURL(ctx, client.ID, *input.DarkLogoURL, false)
+		err = s.SaveClientLogoFromURL(ctx, client.ID, *input.DarkLogoURL, false)
 		if err != nil {
-			return model.OidcClient{}, fmt.Errorf("failed to download dark logo: %w", err)
+			return model.OidcClient{}, err
 		}
 	}
 
 	return client, nil
 }
 
-func (s *OidcService) UpdateClient(ctx context.Context, clientID string, input dto.OidcClientUpdateDto) (model.OidcClient, error) {
-	tx := s.db.Begin()
-	defer func() {
-		tx.Rollback()
-	}()
+// UpdateClientInternal updates the client in the transaction
+// Logos aren't downloaded, because storage operations must be executed outside of a transaction
+func (s *OidcService) UpdateClientInternal(ctx context.Context, clientID string, input dto.OidcClientUpdateDto, tx *gorm.DB) (model.OidcClient, error) {
+	err := s.validateClient(ctx, &input)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
+	return s.updateClientInternal(ctx, clientID, input, tx)
+}
 
+func (s *OidcService) updateClientInternal(ctx context.Context, clientID string, input dto.OidcClientUpdateDto, tx *gorm.DB) (model.OidcClient, error) {
 	var client model.OidcClient
 	err := tx.WithContext(ctx).
 		Preload("CreatedBy").
@@ -172,6 +279,11 @@ func (s *OidcService) UpdateClient(ctx context.Context, clientID string, input d
 		return model.OidcClient{}, err
 	}
 
+	previousState, err := newOidcClientAuditLogState(client)
+	if err != nil {
+		return model.OidcClient{}, err
+	}
+
 	updateOIDCClientModelFromDto(&client, &input)
 
 	if !input.IsGroupRestricted {
@@ -187,27 +299,44 @@ func (s *OidcService) UpdateClient(ctx context.Context, clientID string, input d
 		return model.OidcClient{}, err
 	}
 
-	err = tx.Commit().Error
-	if err != nil {
-		return model.OidcClient{}, err
-	}
-
-	// All storage operations must be executed outside of a transaction
-	if input.LogoURL != nil {
-		err = s.downloadAndSaveLogoFromURL(ctx, client.ID, *input.LogoURL, true)
+	if s.auditLogService != nil {
+		state, err := newOidcClientAuditLogState(client)
 		if err != nil {
-			return model.OidcClient{}, fmt.Errorf("failed to download logo: %w", err)
+			return model.OidcClient{}, err
 		}
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventOidcClientUpdated,
+			TargetID:   client.ID,
+			TargetName: client.Name,
+			Before:     previousState,
+			After:      state,
+		}, tx)
 	}
 
-	if input.DarkLogoURL != nil {
-		err = s.downloadAndSaveLogoFromURL(ctx, client.ID, *input.DarkLogoURL, false)
-		if err != nil {
-			return model.OidcClient{}, fmt.Errorf("failed to download dark logo: %w", err)
-		}
+	return client, nil
+}
+
+// validateClient checks the settings of a client that is created or updated
+func (s *OidcService) validateClient(ctx context.Context, input *dto.OidcClientUpdateDto) error {
+	err := s.validateSectorIdentifier(ctx, input)
+	if err != nil {
+		return err
+	}
+	err = s.validateResponseProtection(input)
+	if err != nil {
+		return err
+	}
+	err = validateTLSClientAuth(input)
+	if err != nil {
+		return err
 	}
+	return validateBackchannelAuthentication(input)
+}
 
-	return client, nil
+// newOidcClientAuditLogState returns the state of a client that is recorded in the audit log when the client is changed
+func newOidcClientAuditLogState(client model.OidcClient) (state dto.OidcClientDto, err error) {
+	err = dto.MapStruct(client, &state)
+	return state, err
 }
 
 func updateOIDCClientModelFromDto(client *model.OidcClient, input *dto.OidcClientUpdateDto) {
@@ -224,6 +353,8 @@ func updateOIDCClientModelFromDto(client *model.OidcClient, input *dto.OidcClien
 	}
 	client.RequiresReauthentication = input.RequiresReauthentication
 	client.RequiresPushedAuthorizationRequests = input.RequiresPushedAuthorizationRequests
+	client.RequiresSignedRequestObject = input.RequiresSignedRequestObject
+	client.RequiresDPoP = input.RequiresDPoP
 	client.SkipConsent = input.SkipConsent
 	client.LaunchURL = input.LaunchURL
 	client.IsGroupRestricted = input.IsGroupRestricted
@@ -239,23 +370,124 @@ func updateOIDCClientModelFromDto(client *model.OidcClient, input *dto.OidcClien
 			ReplayProtection: fi.ReplayProtection,
 		}
 	}
+	client.Credentials.JWKS = input.Credentials.JWKS
+	client.Credentials.JWKSURI = input.Credentials.JWKSURI
+	client.Credentials.TLSClientAuthMethod = input.Credentials.TLSClientAuthMethod
+	client.Credentials.TLSClientAuthSubjectDN = input.Credentials.TLSClientAuthSubjectDN
+	client.Credentials.TLSClientAuthSANDNS = input.Credentials.TLSClientAuthSANDNS
+	client.Credentials.TLSClientAuthSANURI = input.Credentials.TLSClientAuthSANURI
+	client.Credentials.TLSClientAuthSANIP = input.Credentials.TLSClientAuthSANIP
+	client.Credentials.TLSClientAuthSANEmail = input.Credentials.TLSClientAuthSANEmail
+
+	client.DefaultResponseMode = input.DefaultResponseMode
+	client.IDTokenEncryptedResponseAlg = input.IDTokenEncryptedResponseAlg
+	client.IDTokenEncryptedResponseEnc = input.IDTokenEncryptedResponseEnc
+	client.UserinfoSignedResponseAlg = input.UserinfoSignedResponseAlg
+	client.UserinfoEncryptedResponseAlg = input.UserinfoEncryptedResponseAlg
+	client.UserinfoEncryptedResponseEnc = input.UserinfoEncryptedResponseEnc
+
+	// Subject identifiers
+	client.SubjectType = model.OidcSubjectTypePublic
+	if input.SubjectType != "" {
+		client.SubjectType = model.OidcSubjectType(input.SubjectType)
+	}
+	client.SectorIdentifierURI = nil
+	if input.SectorIdentifierURI != nil && *input.SectorIdentifierURI != "" {
+		client.SectorIdentifierURI = input.SectorIdentifierURI
+	}
+	client.BackchannelLogoutURI = nil
+	if input.BackchannelLogoutURI != nil && *input.BackchannelLogoutURI != "" {
+		client.BackchannelLogoutURI = input.BackchannelLogoutURI
+	}
+	client.BackchannelLogoutSessionRequired = input.BackchannelLogoutSessionRequired
+	client.FrontchannelLogoutURI = nil
+	if input.FrontchannelLogoutURI != nil && *input.FrontchannelLogoutURI != "" {
+		client.FrontchannelLogoutURI = input.FrontchannelLogoutURI
+	}
+	client.BackchannelTokenDeliveryMode = input.BackchannelTokenDeliveryMode
+	client.BackchannelClientNotificationURI = nil
+	if input.BackchannelClientNotificationURI != nil && *input.BackchannelClientNotificationURI != "" {
+		client.BackchannelClientNotificationURI = input.BackchannelClientNotificationURI
+	}
+
+	client.TokenLifetimes = model.OidcClientTokenLifetimes{
+		AccessToken:             input.TokenLifetimes.AccessToken,
+		IDToken:                 input.TokenLifetimes.IDToken,
+		AuthorizationCode:       input.TokenLifetimes.AuthorizationCode,
+		RefreshToken:            input.TokenLifetimes.RefreshToken,
+		RefreshTokenExpiry:      model.OidcRefreshTokenExpiry(input.TokenLifetimes.RefreshTokenExpiry),
+		RefreshTokenIdleTimeout: input.TokenLifetimes.RefreshTokenIdleTimeout,
+	}
+
+	// Token exchange
+	client.TokenExchange = model.OidcClientTokenExchangePolicy{
+		SubjectTokenTypes:  input.TokenExchange.SubjectTokenTypes,
+		SubjectClientIDs:   input.TokenExchange.SubjectClientIDs,
+		TrustedIssuers:     make([]model.OidcClientTokenExchangeIssuer, len(input.TokenExchange.TrustedIssuers)),
+		AllowedAudiences:   input.TokenExchange.AllowedAudiences,
+		AllowedScopes:      input.TokenExchange.AllowedScopes,
+		AllowDelegation:    input.TokenExchange.AllowDelegation,
+		AllowImpersonation: input.TokenExchange.AllowImpersonation,
+	}
+	for i, ti := range input.TokenExchange.TrustedIssuers {
+		client.TokenExchange.TrustedIssuers[i] = model.OidcClientTokenExchangeIssuer{
+			Issuer:    ti.Issuer,
+			JWKS:      ti.JWKS,
+			Audience:  ti.Audience,
+			UserClaim: ti.UserClaim,
+		}
+	}
 
 }
 
 func (s *OidcService) DeleteClient(ctx context.Context, clientID string) error {
 	var client model.OidcClient
-	err := s.db.
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		client, err = s.DeleteClientInternal(ctx, clientID, tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.DeleteClientImages(ctx, client)
+	return nil
+}
+
+// DeleteClientInternal deletes the client in the transaction and returns it
+// Its images aren't deleted, because storage operations must be executed outside of a transaction
+func (s *OidcService) DeleteClientInternal(ctx context.Context, clientID string, tx *gorm.DB) (model.OidcClient, error) {
+	var client model.OidcClient
+	err := tx.
 		WithContext(ctx).
 		Where("id = ?", clientID).
 		Clauses(clause.Returning{}).
 		Delete(&client).
 		Error
 	if err != nil {
-		return err
+		return model.OidcClient{}, err
 	}
 
-	// Delete images if present
-	// Note that storage operations must be done outside of a transaction
+	if s.auditLogService != nil {
+		state, err := newOidcClientAuditLogState(client)
+		if err != nil {
+			return model.OidcClient{}, err
+		}
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventOidcClientDeleted,
+			TargetID:   client.ID,
+			TargetName: client.Name,
+			Before:     state,
+		}, tx)
+	}
+
+	return client, nil
+}
+
+// DeleteClientImages deletes the logos of a deleted client
+// It must be called outside of a transaction, once the deletion is committed
+func (s *OidcService) DeleteClientImages(ctx context.Context, client model.OidcClient) {
 	if client.ImageType != nil && *client.ImageType != "" {
 		old := path.Join("oidc-client-images", client.ID+"."+*client.ImageType)
 		_ = s.fileStorage.Delete(ctx, old)
@@ -264,8 +496,6 @@ func (s *OidcService) DeleteClient(ctx context.Context, clientID string) error {
 		old := path.Join("oidc-client-images", client.ID+"-dark."+*client.DarkImageType)
 		_ = s.fileStorage.Delete(ctx, old)
 	}
-
-	return nil
 }
 
 func (s *OidcService) CreateClientSecret(ctx context.Context, clientID string) (string, error) {
@@ -274,6 +504,20 @@ func (s *OidcService) CreateClientSecret(ctx context.Context, clientID string) (
 		tx.Rollback()
 	}()
 
+	clientSecret, err := s.CreateClientSecretInternal(ctx, clientID, tx)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return "", err
+	}
+
+	return clientSecret, nil
+}
+
+func (s *OidcService) CreateClientSecretInternal(ctx context.Context, clientID string, tx *gorm.DB) (string, error) {
 	var client model.OidcClient
 	err := tx.
 		WithContext(ctx).
@@ -302,9 +546,12 @@ func (s *OidcService) CreateClientSecret(ctx context.Context, clientID string) (
 		return "", err
 	}
 
-	err = tx.Commit().Error
-	if err != nil {
-		return "", err
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventOidcClientSecretCreated,
+			TargetID:   client.ID,
+			TargetName: client.Name,
+		}, tx)
 	}
 
 	return clientSecret, nil
@@ -547,6 +794,13 @@ func (s *OidcService) RevokeAuthorizedClient(ctx context.Context, userID string,
 		return err
 	}
 
+	if s.backchannelLogout != nil {
+		// The sessions have to be looked up before the authorization and sessions are removed
+		if err = s.backchannelLogout.LogoutUserClient(ctx, tx, userID, clientID); err != nil {
+			return err
+		}
+	}
+
 	err = tx.WithContext(ctx).Delete(&authorizedClient).Error
 	if err != nil {
 		return err
@@ -561,6 +815,10 @@ func (s *OidcService) RevokeAuthorizedClient(ctx context.Context, userID string,
 		return err
 	}
 
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+
 	return nil
 }
 
@@ -692,6 +950,22 @@ func httpClientWithCheckRedirect(source *http.Client, checkRedirect func(req *ht
 	return client
 }
 
+// checkPublicRedirect prevents SSRF by following redirects only to public IPs
+func checkPublicRedirect(r *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	ok, err := utils.IsURLPrivate(r.Context(), r.URL)
+	if err != nil {
+		return err
+	} else if ok {
+		return errors.New("private IP addresses are not allowed")
+	}
+
+	return nil
+}
+
 func (s *OidcService) downloadAndSaveLogoFromURL(parentCtx context.Context, clientID string, raw string, light bool) error {
 	u, err := url.Parse(raw)
 	if err != nil {
@@ -710,20 +984,7 @@ func (s *OidcService) downloadAndSaveLogoFromURL(parentCtx context.Context, clie
 	}
 
 	// We need to check this on redirects too
-	client := httpClientWithCheckRedirect(s.httpClient, func(r *http.Request, via []*http.Request) error {
-		if len(via) >= 10 {
-			return errors.New("stopped after 10 redirects")
-		}
-
-		ok, err := utils.IsURLPrivate(r.Context(), r.URL)
-		if err != nil {
-			return err
-		} else if ok {
-			return errors.New("private IP addresses are not allowed")
-		}
-
-		return nil
-	})
+	client := httpClientWithCheckRedirect(s.httpClient, checkPublicRedirect)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
 	if err != nil {
@@ -852,3 +1113,170 @@ func (s *OidcService) GetClientScimServiceProvider(ctx context.Context, clientID
 
 	return provider, nil
 }
+
+// validateSectorIdentifier checks that the sector of a client with pairwise subjects is unambiguous, as required by
+// OpenID Connect Core section 8.1: either all callback URLs share the same host, or they are all listed in the
+// JSON document of the sector identifier URI
+func (s *OidcService) validateSectorIdentifier(ctx context.Context, input *dto.OidcClientUpdateDto) error {
+	if input.SubjectType != string(model.OidcSubjectTypePairwise) {
+		return nil
+	}
+
+	if input.SectorIdentifierURI == nil || *input.SectorIdentifierURI == "" {
+		hosts := make(map[string]struct{}, len(input.CallbackURLs))
+		for _, callbackURL := range input.CallbackURLs {
+			if u, err := url.Parse(callbackURL); err == nil {
+				hosts[u.Host] = struct{}{}
+			}
+		}
+		if len(hosts) > 1 {
+			return &common.OidcInvalidSectorIdentifierError{Reason: "a sector identifier URI is required if the callback URLs have different hosts"}
+		}
+		return nil
+	}
+
+	redirectURIs, err := s.fetchSectorRedirectURIs(ctx, *input.SectorIdentifierURI)
+	if err != nil {
+		return &common.OidcInvalidSectorIdentifierError{Reason: err.Error()}
+	}
+	for _, callbackURL := range input.CallbackURLs {
+		if !slices.Contains(redirectURIs, callbackURL) {
+			return &common.OidcInvalidSectorIdentifierError{Reason: "the callback URL " + callbackURL + " is not listed in the sector identifier URI"}
+		}
+	}
+
+	return nil
+}
+
+// validateResponseProtection checks that the ID tokens and userinfo responses of a client can be signed and encrypted
+// as configured: responses are encrypted with the keys of the client and signed with the active key of Pocket ID
+func (s *OidcService) validateResponseProtection(input *dto.OidcClientUpdateDto) error {
+	encrypted := input.IDTokenEncryptedResponseAlg != "" || input.UserinfoEncryptedResponseAlg != ""
+	if encrypted && input.Credentials.JWKS == "" && input.Credentials.JWKSURI == "" {
+		return &common.ValidationError{Message: "encrypted responses require the client to have a JWKS or JWKS URI"}
+	}
+
+	if input.UserinfoSignedResponseAlg != "" {
+		alg, err := s.jwtService.GetKeyAlg()
+		if err != nil {
+			return fmt.Errorf("failed to get the algorithm of the signing key: %w", err)
+		}
+		if input.UserinfoSignedResponseAlg != alg.String() {
+			return &common.ValidationError{Message: "userinfo responses can only be signed with " + alg.String()}
+		}
+	}
+
+	return nil
+}
+
+// validateTLSClientAuth checks the mutual-TLS client authentication of a client, as defined in RFC 8705 section 2:
+// tls_client_auth clients must register exactly one subject their certificate must match, while
+// self_signed_tls_client_auth clients must register the keys of their certificates
+func validateTLSClientAuth(input *dto.OidcClientUpdateDto) error {
+	credentials := input.Credentials
+	subjects := 0
+	for _, subject := range []string{
+		credentials.TLSClientAuthSubjectDN, credentials.TLSClientAuthSANDNS, credentials.TLSClientAuthSANURI,
+		credentials.TLSClientAuthSANIP, credentials.TLSClientAuthSANEmail,
+	} {
+		if subject != "" {
+			subjects++
+		}
+	}
+
+	switch credentials.TLSClientAuthMethod {
+	case "":
+		if subjects > 0 {
+			return &common.ValidationError{Message: "a certificate subject can only be set for clients that authenticate with tls_client_auth"}
+		}
+		return nil
+	case "tls_client_auth":
+		if subjects != 1 {
+			return &common.ValidationError{Message: "clients that authenticate with tls_client_auth must set exactly one certificate subject"}
+		}
+	case "self_signed_tls_client_auth":
+		if subjects > 0 {
+			return &common.ValidationError{Message: "a certificate subject can only be set for clients that authenticate with tls_client_auth"}
+		}
+		if credentials.JWKS == "" && credentials.JWKSURI == "" {
+			return &common.ValidationError{Message: "clients that authenticate with self_signed_tls_client_auth require a JWKS or JWKS URI"}
+		}
+	}
+
+	if input.IsPublic {
+		return &common.ValidationError{Message: "public clients can't authenticate with a client certificate"}
+	}
+	return nil
+}
+
+// fetchSectorRedirectURIs downloads the JSON array of redirect URIs that is published at a sector identifier URI
+func (s *OidcService) fetchSectorRedirectURIs(parentCtx context.Context, sectorIdentifierURI string) ([]string, error) {
+	u, err := url.Parse(sectorIdentifierURI)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, 15*time.Second)
+	defer cancel()
+
+	// Prevents SSRF by allowing only public IPs
+	ok, err := utils.IsURLPrivate(ctx, u)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		return nil, errors.New("private IP addresses are not allowed")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sectorIdentifierURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pocket-id/oidc-sector-identifier-fetcher")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClientWithCheckRedirect(s.httpClient, checkPublicRedirect).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch sector identifier URI: %s", resp.Status)
+	}
+
+	var redirectURIs []string
+	const maxSectorIdentifierSize = 64 * 1024
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxSectorIdentifierSize)).Decode(&redirectURIs)
+	if err != nil {
+		return nil, errors.New("the sector identifier URI must return a JSON array of redirect URIs")
+	}
+
+	return redirectURIs, nil
+}
+
+// validateBackchannelAuthentication checks the CIBA settings of a client: only confidential clients can use CIBA, and
+// clients that use the ping mode are notified at their client notification endpoint
+func validateBackchannelAuthentication(input *dto.OidcClientUpdateDto) error {
+	hasNotificationURI := input.BackchannelClientNotificationURI != nil && *input.BackchannelClientNotificationURI != ""
+
+	switch input.BackchannelTokenDeliveryMode {
+	case "":
+		if hasNotificationURI {
+			return &common.ValidationError{Message: "a client notification endpoint can only be set for clients that use the CIBA ping mode"}
+		}
+		return nil
+	case "ping":
+		if !hasNotificationURI {
+			return &common.ValidationError{Message: "clients that use the CIBA ping mode require a client notification endpoint"}
+		}
+	case "poll":
+		if hasNotificationURI {
+			return &common.ValidationError{Message: "a client notification endpoint can only be set for clients that use the CIBA ping mode"}
+		}
+	}
+
+	if input.IsPublic {
+		return &common.ValidationError{Message: "public clients can't use CIBA"}
+	}
+	return nil
+}
@@ -22,17 +22,17 @@ type OneTimeAccessService struct {
 	db               *gorm.DB
 	userService      *UserService
 	appConfigService *AppConfigService
-	jwtService       *JwtService
+	sessionService   *UserSessionService
 	auditLogService  *AuditLogService
 	emailService     *EmailService
 }
 
-func NewOneTimeAccessService(db *gorm.DB, userService *UserService, jwtService *JwtService, auditLogService *AuditLogService, emailService *EmailService, appConfigService *AppConfigService) *OneTimeAccessService {
+func NewOneTimeAccessService(db *gorm.DB, userService *UserService, sessionService *UserSessionService, auditLogService *AuditLogService, emailService *EmailService, appConfigService *AppConfigService) *OneTimeAccessService {
 	return &OneTimeAccessService{
 		db:               db,
 		userService:      userService,
 		appConfigService: appConfigService,
-		jwtService:       jwtService,
+		sessionService:   sessionService,
 		auditLogService:  auditLogService,
 		emailService:     emailService,
 	}
@@ -197,7 +197,7 @@ func (s *OneTimeAccessService) ExchangeOneTimeAccessToken(ctx context.Context, t
 		return model.User{}, "", &common.DeviceCodeInvalid{}
 	}
 
-	accessToken, err := s.jwtService.GenerateAccessToken(oneTimeAccessToken.User, AuthenticationMethodOneTimePassword)
+	accessToken, err := s.sessionService.CreateSession(ctx, tx, oneTimeAccessToken.User, AuthenticationMethodOneTimePassword, ipAddress, userAgent)
 	if err != nil {
 		return model.User{}, "", err
 	}
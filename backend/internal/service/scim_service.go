@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
 	"path"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -23,16 +25,31 @@ import (
 	"github.com/pocket-id/pocket-id/backend/internal/oidc"
 	"github.com/pocket-id/pocket-id/backend/internal/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
-	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
-	scimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
-	scimContentType = "application/scim+json"
+	scimUserSchema           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimEnterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	scimGroupSchema          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimPatchOpSchema        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimContentType          = "application/scim+json"
 )
 
 const scimErrorBodyLimit = 4096
 
+const (
+	// Rate-limited requests are retried within the same push, waiting at most scimRequestMaxDelay
+	scimRequestMaxDelay = 10 * time.Second
+	scimChangeBatchSize = 500
+	// A change is given up after this many attempts, which spans about two hours with the retry delays of
+	// scimRetryDelay. Changes that were given up are pushed by the next full sync of the service provider.
+	scimChangeMaxAttempts = 15
+	scimChangeMaxDelay    = time.Hour
+	// Changes that were given up are kept for this long, so the error can be looked up
+	scimChangeRetention = 7 * 24 * time.Hour
+)
+
 type scimSyncAction int
 
 const (
@@ -49,18 +66,26 @@ type scimSyncStats struct {
 }
 
 // ScimService handles SCIM provisioning to external service providers.
+// Changes of users and groups are recorded in the database and pushed to the service providers right after, while
+// a periodic full sync reconciles everything that was missed.
 type ScimService struct {
 	db         *gorm.DB
 	scheduler  Scheduler
 	httpClient *http.Client
+	// subjects derives the externalId of provisioned users, which matches the "sub" claim the client receives
+	subjects        oidc.SubjectResolver
+	auditLogService *AuditLogService
+
+	// delivering prevents concurrent pushes of the same changes
+	delivering sync.Mutex
 }
 
-func NewScimService(db *gorm.DB, scheduler Scheduler, httpClient *http.Client) *ScimService {
+func NewScimService(db *gorm.DB, scheduler Scheduler, httpClient *http.Client, subjects oidc.SubjectResolver, auditLogService *AuditLogService) *ScimService {
 	if httpClient == nil {
 		httpClient = &http.Client{Timeout: 20 * time.Second}
 	}
 
-	return &ScimService{db: db, scheduler: scheduler, httpClient: httpClient}
+	return &ScimService{db: db, scheduler: scheduler, httpClient: httpClient, subjects: subjects, auditLogService: auditLogService}
 }
 
 func (s *ScimService) GetServiceProvider(
@@ -104,6 +129,15 @@ func (s *ScimService) CreateServiceProvider(
 		return model.ScimServiceProvider{}, err
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventScimServiceProviderCreated,
+			TargetID:   provider.ID,
+			TargetName: provider.Endpoint,
+			After:      newScimServiceProviderAuditLogState(provider),
+		}, s.db)
+	}
+
 	return provider, nil
 }
 
@@ -119,6 +153,7 @@ func (s *ScimService) UpdateServiceProvider(ctx context.Context,
 		return model.ScimServiceProvider{}, err
 	}
 
+	previousState := newScimServiceProviderAuditLogState(provider)
 	provider.Endpoint = input.Endpoint
 	provider.Token = datatype.EncryptedString(input.Token)
 	provider.OidcClientID = input.OidcClientID
@@ -127,13 +162,49 @@ func (s *ScimService) UpdateServiceProvider(ctx context.Context,
 		return model.ScimServiceProvider{}, err
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventScimServiceProviderUpdated,
+			TargetID:   provider.ID,
+			TargetName: provider.Endpoint,
+			Before:     previousState,
+			After:      newScimServiceProviderAuditLogState(provider),
+		}, s.db)
+	}
+
 	return provider, nil
 }
 
 func (s *ScimService) DeleteServiceProvider(ctx context.Context, serviceProviderID string) error {
-	return s.db.WithContext(ctx).
-		Delete(&model.ScimServiceProvider{}, "id = ?", serviceProviderID).
+	var provider model.ScimServiceProvider
+	err := s.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Delete(&provider, "id = ?", serviceProviderID).
 		Error
+	if err != nil {
+		return err
+	}
+
+	if s.auditLogService != nil && provider.ID != "" {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventScimServiceProviderDeleted,
+			TargetID:   provider.ID,
+			TargetName: provider.Endpoint,
+			Before:     newScimServiceProviderAuditLogState(provider),
+		}, s.db)
+	}
+
+	return nil
+}
+
+// newScimServiceProviderAuditLogState returns the state of a service provider that is recorded in the audit log when
+// the service provider is changed
+func newScimServiceProviderAuditLogState(provider model.ScimServiceProvider) dto.ScimServiceProviderCreateDTO {
+	return dto.ScimServiceProviderCreateDTO{
+		Endpoint:     provider.Endpoint,
+		Token:        string(provider.Token),
+		OidcClientID: provider.OidcClientID,
+	}
 }
 
 //nolint:contextcheck
@@ -236,8 +307,23 @@ func (s *ScimService) SyncServiceProvider(ctx context.Context, serviceProviderID
 		return err
 	}
 
-	provider.LastSyncedAt = new(datatype.DateTime(time.Now()))
-	err = s.db.WithContext(ctx).Save(&provider).Error
+	// The full sync pushed the current state of every resource, so the changes recorded before it are obsolete
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		provider.LastSyncedAt = new(datatype.DateTime(time.Now()))
+		provider.LastPushError = ""
+		err := tx.
+			Model(&provider).
+			Select("LastSyncedAt", "LastPushError").
+			Updates(&provider).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Delete(&model.ScimChange{}, "service_provider_id = ? AND created_at < ?", provider.ID, datatype.DateTime(start)).
+			Error
+	})
 	if err != nil {
 		return err
 	}
@@ -266,7 +352,7 @@ func (s *ScimService) syncUsers(
 
 	// Update or create users
 	for _, u := range users {
-		existing := getResourceByExternalID(u.ID, resourceList.Resources)
+		existing := getResourceByExternalID(s.subjects.Subject(provider.OidcClient, u.ID), resourceList.Resources)
 
 		action, created, err := s.syncUser(ctx, provider, u, existing)
 		if created != nil && existing == nil {
@@ -292,7 +378,7 @@ func (s *ScimService) syncUsers(
 	// Delete users that are present in SCIM provider but not locally.
 	userSet := make(map[string]struct{})
 	for _, u := range users {
-		userSet[u.ID] = struct{}{}
+		userSet[s.subjects.Subject(provider.OidcClient, u.ID)] = struct{}{}
 	}
 
 	for _, r := range resourceList.Resources {
@@ -369,26 +455,7 @@ func (s *ScimService) syncUser(ctx context.Context,
 		return scimActionDeleted, nil, s.deleteScimResource(ctx, provider, fmt.Sprintf("/Users/%s", url.PathEscape(userResource.ID)))
 	}
 
-	payload := dto.ScimUser{
-		ScimResourceData: dto.ScimResourceData{
-			Schemas:    []string{scimUserSchema},
-			ExternalID: user.ID,
-		},
-		UserName: user.Username,
-		Name: &dto.ScimName{
-			GivenName:  user.FirstName,
-			FamilyName: user.LastName,
-		},
-		Display: user.DisplayName,
-		Active:  !user.Disabled,
-	}
-
-	if user.Email != nil {
-		payload.Emails = []dto.ScimEmail{{
-			Value:   *user.Email,
-			Primary: true,
-		}}
-	}
+	payload := s.userPayload(provider, user)
 
 	// If the user exists on the SCIM provider, and it has been modified, update it
 	if userResource != nil {
@@ -427,7 +494,7 @@ func (s *ScimService) syncGroup(
 	// Prepare group members
 	members := make([]dto.ScimGroupMember, len(group.Users))
 	for i, user := range group.Users {
-		userResource := getResourceByExternalID(user.ID, userResources)
+		userResource := getResourceByExternalID(s.subjects.Subject(provider.OidcClient, user.ID), userResources)
 		if userResource == nil {
 			// Groups depend on user IDs already being provisioned
 			return scimActionNone, fmt.Errorf("cannot sync group %s: user %s is not provisioned in SCIM provider", group.ID, user.ID)
@@ -531,7 +598,10 @@ func (s *ScimService) usersForClient(
 			Distinct()
 	}
 
-	query = query.Preload("UserGroups")
+	query = query.
+		Preload("UserGroups").
+		Preload("UserGroups.CustomClaims").
+		Preload("CustomClaims")
 
 	if err := query.Find(&users).Error; err != nil {
 		return nil, err
@@ -539,6 +609,558 @@ func (s *ScimService) usersForClient(
 	return users, nil
 }
 
+// userPayload returns the SCIM representation of the user for the service provider
+func (s *ScimService) userPayload(provider model.ScimServiceProvider, user model.User) dto.ScimUser {
+	payload := dto.ScimUser{
+		ScimResourceData: dto.ScimResourceData{
+			Schemas:    []string{scimUserSchema},
+			ExternalID: s.subjects.Subject(provider.OidcClient, user.ID),
+		},
+		UserName: user.Username,
+		Name: &dto.ScimName{
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		Display:    user.DisplayName,
+		Active:     !user.Disabled,
+		Enterprise: enterpriseUser(user),
+	}
+
+	if user.Email != nil {
+		payload.Emails = []dto.ScimEmail{{
+			Value:   *user.Email,
+			Primary: true,
+		}}
+	}
+
+	if payload.Enterprise != nil {
+		payload.Schemas = append(payload.Schemas, scimEnterpriseUserSchema)
+	}
+
+	return payload
+}
+
+// enterpriseUser returns the attributes of the enterprise user extension, which are taken from the custom claims
+// of the user and its groups. It returns nil if the user has none of them.
+func enterpriseUser(user model.User) *dto.ScimEnterpriseUser {
+	// Claims of the user take precedence over the claims of its groups
+	claims := make(map[string]string)
+	for _, group := range user.UserGroups {
+		for _, claim := range group.CustomClaims {
+			claims[claim.Key] = claim.Value
+		}
+	}
+	for _, claim := range user.CustomClaims {
+		claims[claim.Key] = claim.Value
+	}
+
+	enterprise := dto.ScimEnterpriseUser{
+		EmployeeNumber: claims["employeeNumber"],
+		CostCenter:     claims["costCenter"],
+		Organization:   claims["organization"],
+		Division:       claims["division"],
+		Department:     claims["department"],
+	}
+	if enterprise == (dto.ScimEnterpriseUser{}) {
+		return nil
+	}
+	return &enterprise
+}
+
+// isEnterpriseClaim reports whether the custom claim is provisioned as an attribute of the enterprise user extension
+func isEnterpriseClaim(key string) bool {
+	switch key {
+	case "employeeNumber", "costCenter", "organization", "division", "department":
+		return true
+	default:
+		return false
+	}
+}
+
+// scimUserModified reports whether an update of the user changed any of the attributes that are provisioned
+func scimUserModified(before, after model.User) bool {
+	return before.Username != after.Username ||
+		before.FirstName != after.FirstName ||
+		before.LastName != after.LastName ||
+		before.DisplayName != after.DisplayName ||
+		before.Disabled != after.Disabled ||
+		(before.Email == nil) != (after.Email == nil) ||
+		(before.Email != nil && *before.Email != *after.Email)
+}
+
+// changedMemberIDs returns the IDs that are only in one of the member lists
+func changedMemberIDs(before, after []string) []string {
+	changed := make([]string, 0)
+	for _, id := range before {
+		if !slices.Contains(after, id) {
+			changed = append(changed, id)
+		}
+	}
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			changed = append(changed, id)
+		}
+	}
+	return changed
+}
+
+// RecordUserChange records that the users changed, so their current state is pushed to every service provider.
+// It has to be called in the transaction that changes the users, ScheduleDelivery pushes the changes after the
+// transaction is committed.
+func (s *ScimService) RecordUserChange(ctx context.Context, tx *gorm.DB, userIDs ...string) error {
+	changes := make([]model.ScimChange, len(userIDs))
+	for i, userID := range userIDs {
+		changes[i] = model.ScimChange{ResourceType: model.ScimResourceTypeUser, ResourceID: userID}
+	}
+	return s.recordChanges(ctx, tx, changes)
+}
+
+// RecordGroupChange records that the groups changed, so their current state is pushed to every service provider.
+// Changes of the members of a group have to be recorded with RecordMembershipChange.
+func (s *ScimService) RecordGroupChange(ctx context.Context, tx *gorm.DB, groupIDs ...string) error {
+	changes := make([]model.ScimChange, len(groupIDs))
+	for i, groupID := range groupIDs {
+		changes[i] = model.ScimChange{ResourceType: model.ScimResourceTypeGroup, ResourceID: groupID}
+	}
+	return s.recordChanges(ctx, tx, changes)
+}
+
+// RecordMembershipChange records that the users were added to or removed from the group
+func (s *ScimService) RecordMembershipChange(ctx context.Context, tx *gorm.DB, groupID string, userIDs ...string) error {
+	changes := make([]model.ScimChange, len(userIDs))
+	for i, userID := range userIDs {
+		changes[i] = model.ScimChange{ResourceType: model.ScimResourceTypeGroup, ResourceID: groupID, MemberID: userID}
+	}
+	return s.recordChanges(ctx, tx, changes)
+}
+
+// recordChanges records the changes for every service provider
+func (s *ScimService) recordChanges(ctx context.Context, tx *gorm.DB, changes []model.ScimChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var providerIDs []string
+	err := tx.
+		WithContext(ctx).
+		Model(&model.ScimServiceProvider{}).
+		Pluck("id", &providerIDs).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load SCIM service providers: %w", err)
+	}
+	if len(providerIDs) == 0 {
+		return nil
+	}
+
+	now := datatype.DateTime(time.Now())
+	records := make([]model.ScimChange, 0, len(providerIDs)*len(changes))
+	for _, providerID := range providerIDs {
+		for _, change := range changes {
+			change.ServiceProviderID = providerID
+			change.Status = model.ScimChangeStatusPending
+			change.NextAttemptAt = now
+			records = append(records, change)
+		}
+	}
+
+	err = tx.
+		WithContext(ctx).
+		CreateInBatches(&records, 100).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to record SCIM changes: %w", err)
+	}
+	return nil
+}
+
+// ScheduleDelivery pushes the recorded changes to the service providers in the background.
+// Changes that fail are retried by the job that calls DeliverPending.
+//
+//nolint:contextcheck
+func (s *ScimService) ScheduleDelivery() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if err := s.DeliverPending(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to push SCIM changes", slog.Any("error", err))
+		}
+	}()
+}
+
+// DeliverPending pushes the changes whose next attempt is due to the service providers
+func (s *ScimService) DeliverPending(ctx context.Context) error {
+	// Another delivery is in progress, the changes are picked up by the next run
+	if !s.delivering.TryLock() {
+		return nil
+	}
+	defer s.delivering.Unlock()
+
+	var changes []model.ScimChange
+	err := s.db.
+		WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", model.ScimChangeStatusPending, datatype.DateTime(time.Now())).
+		Order("created_at, id").
+		Limit(scimChangeBatchSize).
+		Find(&changes).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load pending SCIM changes: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changesByProvider := make(map[string][]model.ScimChange)
+	for _, change := range changes {
+		changesByProvider[change.ServiceProviderID] = append(changesByProvider[change.ServiceProviderID], change)
+	}
+
+	var providers []model.ScimServiceProvider
+	err = s.db.
+		WithContext(ctx).
+		Preload("OidcClient").
+		Preload("OidcClient.AllowedUserGroups").
+		Where("id IN ?", slices.Collect(maps.Keys(changesByProvider))).
+		Find(&providers).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load SCIM service providers: %w", err)
+	}
+
+	var errs []error
+	for _, provider := range providers {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		if err := s.deliverChanges(ctx, provider, changesByProvider[provider.ID]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to push SCIM changes to provider %s: %w", provider.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliverChanges pushes the changes to the service provider and records the push status of the provider.
+// Changes of the same resource are pushed once, as the current state of the resource is pushed anyway.
+func (s *ScimService) deliverChanges(ctx context.Context, provider model.ScimServiceProvider, changes []model.ScimChange) error {
+	type resourceKey struct {
+		resourceType model.ScimResourceType
+		resourceID   string
+		memberID     string
+	}
+
+	var keys []resourceKey
+	changesByKey := make(map[resourceKey][]model.ScimChange)
+	for _, change := range changes {
+		key := resourceKey{resourceType: change.ResourceType, resourceID: change.ResourceID, memberID: change.MemberID}
+		if _, ok := changesByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		changesByKey[key] = append(changesByKey[key], change)
+	}
+
+	var pushErr error
+	pushed := 0
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+
+		resourceChanges := changesByKey[key]
+		deliveryErr := s.deliverChange(ctx, provider, resourceChanges[0])
+		if err := s.recordDelivery(ctx, resourceChanges, deliveryErr); err != nil {
+			return err
+		}
+
+		if deliveryErr != nil {
+			pushErr = deliveryErr
+		} else {
+			pushed++
+		}
+	}
+
+	switch {
+	case pushErr != nil:
+		provider.LastPushError = pushErr.Error()
+	case pushed > 0:
+		provider.LastPushedAt = new(datatype.DateTime(time.Now()))
+		provider.LastPushError = ""
+	default:
+		return nil
+	}
+
+	err := s.db.
+		WithContext(ctx).
+		Model(&provider).
+		Select("LastPushedAt", "LastPushError").
+		Updates(&provider).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to record SCIM push status: %w", err)
+	}
+	return nil
+}
+
+// recordDelivery records the outcome of pushing the changes of a resource.
+// The first change keeps track of the attempts, the other changes are obsolete either way.
+func (s *ScimService) recordDelivery(ctx context.Context, changes []model.ScimChange, deliveryErr error) error {
+	ids := make([]string, len(changes))
+	for i, change := range changes {
+		ids[i] = change.ID
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if deliveryErr == nil {
+			return tx.Delete(&model.ScimChange{}, "id IN ?", ids).Error
+		}
+
+		change := &changes[0]
+		change.Attempts++
+		change.LastError = deliveryErr.Error()
+
+		var retryAfter string
+		if statusErr, ok := errors.AsType[*scimStatusError](deliveryErr); ok {
+			retryAfter = statusErr.RetryAfter
+		}
+
+		if change.Attempts >= scimChangeMaxAttempts {
+			change.Status = model.ScimChangeStatusFailed
+		} else {
+			change.NextAttemptAt = datatype.DateTime(time.Now().Add(scimRetryDelay(retryAfter, change.Attempts, scimChangeMaxDelay)))
+		}
+
+		slog.WarnContext(ctx, "Failed to push SCIM change",
+			slog.String("provider_id", change.ServiceProviderID),
+			slog.String("resource_type", string(change.ResourceType)),
+			slog.String("resource_id", change.ResourceID),
+			slog.Int("attempt", change.Attempts),
+			slog.Any("error", deliveryErr),
+		)
+
+		err := tx.
+			Model(change).
+			Select("Status", "Attempts", "LastError", "NextAttemptAt").
+			Updates(change).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 1 {
+			return tx.Delete(&model.ScimChange{}, "id IN ?", ids[1:]).Error
+		}
+		return nil
+	})
+}
+
+// deliverChange pushes the current state of the changed resource to the service provider
+func (s *ScimService) deliverChange(ctx context.Context, provider model.ScimServiceProvider, change model.ScimChange) error {
+	switch {
+	case change.ResourceType == model.ScimResourceTypeUser:
+		_, err := s.pushUser(ctx, provider, change.ResourceID)
+		return err
+	case change.MemberID != "":
+		return s.pushMembership(ctx, provider, change.ResourceID, change.MemberID)
+	default:
+		_, err := s.pushGroup(ctx, provider, change.ResourceID)
+		return err
+	}
+}
+
+// pushUser creates, updates or deletes the user in the service provider.
+// It returns the ID of the user in the service provider, which is empty if the user isn't provisioned.
+func (s *ScimService) pushUser(ctx context.Context, provider model.ScimServiceProvider, userID string) (string, error) {
+	var user model.User
+	err := s.db.
+		WithContext(ctx).
+		Preload("UserGroups").
+		Preload("UserGroups.CustomClaims").
+		Preload("CustomClaims").
+		First(&user, "id = ?", userID).
+		Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	deleted := err != nil
+
+	existing, err := findScimResource[dto.ScimUser](s, ctx, provider, "/Users", s.subjects.Subject(provider.OidcClient, userID))
+	if err != nil {
+		return "", err
+	}
+
+	// Users that were deleted or aren't allowed to use the client anymore are deleted from the service provider
+	if deleted || !oidc.IsUserGroupAllowedToAuthorize(user, provider.OidcClient) {
+		if existing == nil {
+			return "", nil
+		}
+		return "", s.deleteScimResource(ctx, provider, "/Users/"+url.PathEscape(existing.ID))
+	}
+
+	payload := s.userPayload(provider, user)
+	if existing != nil {
+		operation, err := scimReplaceOperation(payload)
+		if err != nil {
+			return "", err
+		}
+		return existing.ID, s.patchScimResource(ctx, provider, "/Users/"+url.PathEscape(existing.ID), operation)
+	}
+
+	created, err := createScimResource(s, ctx, provider, "/Users", payload)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// pushGroup creates, renames or deletes the group in the service provider.
+// It returns the ID of the group in the service provider, which is empty if the group isn't provisioned.
+func (s *ScimService) pushGroup(ctx context.Context, provider model.ScimServiceProvider, groupID string) (string, error) {
+	var group model.UserGroup
+	err := s.db.
+		WithContext(ctx).
+		Preload("Users").
+		First(&group, "id = ?", groupID).
+		Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	deleted := err != nil
+
+	existing, err := findScimResource[dto.ScimGroup](s, ctx, provider, "/Groups", groupID)
+	if err != nil {
+		return "", err
+	}
+
+	// Groups that were deleted or aren't allowed for the client anymore are deleted from the service provider
+	if deleted || !groupAllowedForClient(groupID, provider.OidcClient) {
+		if existing == nil {
+			return "", nil
+		}
+		return "", s.deleteScimResource(ctx, provider, "/Groups/"+url.PathEscape(existing.ID))
+	}
+
+	// The members of an existing group are pushed by their own changes
+	if existing != nil {
+		operation := dto.ScimPatchOperation{Op: "replace", Path: "displayName", Value: group.FriendlyName}
+		return existing.ID, s.patchScimResource(ctx, provider, "/Groups/"+url.PathEscape(existing.ID), operation)
+	}
+
+	// A new group is created with its members that are already provisioned
+	members := make([]dto.ScimGroupMember, 0, len(group.Users))
+	for _, user := range group.Users {
+		userResource, err := findScimResource[dto.ScimUser](s, ctx, provider, "/Users", s.subjects.Subject(provider.OidcClient, user.ID))
+		if err != nil {
+			return "", err
+		}
+		if userResource != nil {
+			members = append(members, dto.ScimGroupMember{Value: userResource.ID})
+		}
+	}
+
+	created, err := createScimResource(s, ctx, provider, "/Groups", dto.ScimGroup{
+		ScimResourceData: dto.ScimResourceData{
+			Schemas:    []string{scimGroupSchema},
+			ExternalID: group.ID,
+		},
+		Display: group.FriendlyName,
+		Members: members,
+	})
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// pushMembership adds the user to or removes it from the group in the service provider, depending on whether the
+// user is currently a member of the group
+func (s *ScimService) pushMembership(ctx context.Context, provider model.ScimServiceProvider, groupID, userID string) error {
+	// Deleted groups and groups that aren't allowed for the client are handled by the changes of the group
+	if !groupAllowedForClient(groupID, provider.OidcClient) {
+		return nil
+	}
+
+	var memberships int64
+	err := s.db.
+		WithContext(ctx).
+		Table("user_groups_users").
+		Where("user_group_id = ? AND user_id = ?", groupID, userID).
+		Count(&memberships).
+		Error
+	if err != nil {
+		return err
+	}
+	isMember := memberships > 0
+
+	var userResourceID string
+	if provider.OidcClient.IsGroupRestricted {
+		// Clients that are restricted to groups only get the users of these groups, so the user may have to be
+		// provisioned or deleted as well
+		userResourceID, err = s.pushUser(ctx, provider, userID)
+		if err != nil {
+			return err
+		}
+	} else {
+		userResource, err := findScimResource[dto.ScimUser](s, ctx, provider, "/Users", s.subjects.Subject(provider.OidcClient, userID))
+		if err != nil {
+			return err
+		}
+
+		if userResource != nil {
+			userResourceID = userResource.ID
+		} else if isMember {
+			// The user is provisioned first, so the group can reference it
+			userResourceID, err = s.pushUser(ctx, provider, userID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if userResourceID == "" {
+		return nil
+	}
+
+	groupResource, err := findScimResource[dto.ScimGroup](s, ctx, provider, "/Groups", groupID)
+	if err != nil {
+		return err
+	}
+
+	path := ""
+	if groupResource != nil {
+		path = "/Groups/" + url.PathEscape(groupResource.ID)
+	}
+
+	switch {
+	case isMember && groupResource == nil:
+		// The group is created with its current members, which include the user
+		_, err = s.pushGroup(ctx, provider, groupID)
+		return err
+	case isMember:
+		return s.patchScimResource(ctx, provider, path, dto.ScimPatchOperation{
+			Op:    "add",
+			Path:  "members",
+			Value: []dto.ScimGroupMember{{Value: userResourceID}},
+		})
+	case groupResource != nil:
+		return s.patchScimResource(ctx, provider, path, dto.ScimPatchOperation{
+			Op:   "remove",
+			Path: "members[value eq " + scimFilterValue(userResourceID) + "]",
+		})
+	default:
+		return nil
+	}
+}
+
+// CleanupFailedScimChanges deletes changes that were given up a while ago
+func CleanupFailedScimChanges(ctx context.Context, db *gorm.DB) (int64, error) {
+	st := db.
+		WithContext(ctx).
+		Delete(&model.ScimChange{}, "status = ? AND created_at < ?", model.ScimChangeStatusFailed, datatype.DateTime(time.Now().Add(-scimChangeRetention)))
+	return st.RowsAffected, st.Error
+}
+
 func getResourceByExternalID[T dto.ScimResource](externalID string, resource []T) *T {
 	for i := range resource {
 		if resource[i].GetExternalID() == externalID {
@@ -647,6 +1269,82 @@ func updateScimResource[T dto.ScimResource](
 	return &resource, nil
 }
 
+// findScimResource looks up the resource with the external ID in the service provider.
+// It returns nil if the resource doesn't exist.
+func findScimResource[T dto.ScimResource](
+	s *ScimService,
+	ctx context.Context,
+	provider model.ScimServiceProvider,
+	path string,
+	externalID string,
+) (*T, error) {
+	queryParams := map[string]string{
+		"filter": "externalId eq " + scimFilterValue(externalID),
+	}
+	resp, err := s.scimRequest(ctx, provider, http.MethodGet, path, nil, queryParams)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := ensureScimStatus(ctx, resp, provider, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var page dto.ScimListResponse[T]
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode SCIM list response: %w", err)
+	}
+
+	// The external ID is compared again, in case the service provider ignored the filter
+	return getResourceByExternalID(externalID, page.Resources), nil
+}
+
+func (s *ScimService) patchScimResource(
+	ctx context.Context,
+	provider model.ScimServiceProvider,
+	path string,
+	operations ...dto.ScimPatchOperation,
+) error {
+	payload := dto.ScimPatchRequest{
+		Schemas:    []string{scimPatchOpSchema},
+		Operations: operations,
+	}
+
+	resp, err := s.scimRequest(ctx, provider, http.MethodPatch, path, payload, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return ensureScimStatus(ctx, resp, provider, http.StatusOK, http.StatusNoContent)
+}
+
+// scimReplaceOperation returns a patch operation that replaces the attributes of a resource with the ones of the
+// payload, without the attributes that are managed by the service provider
+func scimReplaceOperation(payload any) (dto.ScimPatchOperation, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return dto.ScimPatchOperation{}, fmt.Errorf("failed to encode SCIM payload: %w", err)
+	}
+
+	var value map[string]any
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return dto.ScimPatchOperation{}, fmt.Errorf("failed to encode SCIM payload: %w", err)
+	}
+	delete(value, "id")
+	delete(value, "schemas")
+	delete(value, "meta")
+
+	return dto.ScimPatchOperation{Op: "replace", Value: value}, nil
+}
+
+// scimFilterValue encodes the value as a string in a SCIM filter, which uses the JSON string syntax
+func scimFilterValue(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
 func (s *ScimService) deleteScimResource(ctx context.Context, provider model.ScimServiceProvider, path string) error {
 	resp, err := s.scimRequest(ctx, provider, http.MethodDelete, path, nil, nil)
 	if err != nil {
@@ -720,7 +1418,7 @@ func (s *ScimService) scimRequest(
 			return resp, nil
 		}
 
-		retryDelay := scimRetryDelay(resp.Header.Get("Retry-After"), attempt)
+		retryDelay := scimRetryDelay(resp.Header.Get("Retry-After"), attempt, scimRequestMaxDelay)
 		slog.WarnContext(ctx, "SCIM provider rate-limited, retrying",
 			slog.String("provider_id", provider.ID),
 			slog.String("method", method),
@@ -738,7 +1436,7 @@ func (s *ScimService) scimRequest(
 	return nil, fmt.Errorf("scim request retry attempts exceeded")
 }
 
-func scimRetryDelay(retryAfter string, attempt int) time.Duration {
+func scimRetryDelay(retryAfter string, attempt int, maxDelay time.Duration) time.Duration {
 	// Respect Retry-After when provided
 	if retryAfter != "" {
 		if seconds, err := strconv.Atoi(retryAfter); err == nil {
@@ -752,12 +1450,11 @@ func scimRetryDelay(retryAfter string, attempt int) time.Duration {
 	}
 
 	// Exponential backoff otherwise
-	maxDelay := 10 * time.Second
-	delay := 500 * time.Millisecond * (time.Duration(1) << (attempt - 1)) //nolint:gosec // attempt is bounded 1-3
-	if delay > maxDelay {
-		return maxDelay
+	delay := 500 * time.Millisecond
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
 	}
-	return delay
+	return min(delay, maxDelay)
 }
 
 func scimURL(endpoint, p string, queryParams map[string]string) (string, error) {
@@ -796,7 +1493,22 @@ func ensureScimStatus(
 		slog.String("response_body", body),
 	)
 
-	return fmt.Errorf("scim request failed with status %d: %s", resp.StatusCode, body)
+	return &scimStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: resp.Header.Get("Retry-After"),
+		Body:       body,
+	}
+}
+
+// scimStatusError is returned if the service provider responded with an unexpected status
+type scimStatusError struct {
+	StatusCode int
+	RetryAfter string
+	Body       string
+}
+
+func (e *scimStatusError) Error() string {
+	return fmt.Sprintf("scim request failed with status %d: %s", e.StatusCode, e.Body)
 }
 
 func readScimErrorBody(body io.Reader) string {
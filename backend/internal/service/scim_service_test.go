@@ -0,0 +1,282 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/oidc"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+// fakeScimProvider is a minimal SCIM service provider that keeps its resources in memory
+type fakeScimProvider struct {
+	mu        sync.Mutex
+	resources map[string]map[string]any
+	requests  []string
+	// failWith makes every request fail with the status if it's set, asking to retry after a minute
+	failWith int
+}
+
+func newFakeScimProvider(t *testing.T) (*fakeScimProvider, *httptest.Server) {
+	t.Helper()
+
+	provider := &fakeScimProvider{resources: make(map[string]map[string]any)}
+	server := httptest.NewServer(http.HandlerFunc(provider.serveHTTP))
+	t.Cleanup(server.Close)
+
+	return provider, server
+}
+
+func (p *fakeScimProvider) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+	if p.failWith != 0 {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(p.failWith)
+		return
+	}
+
+	collection, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		externalID := strings.Trim(strings.TrimPrefix(r.URL.Query().Get("filter"), "externalId eq "), `"`)
+		resources := []map[string]any{}
+		for key, resource := range p.resources {
+			if strings.HasPrefix(key, collection+"/") && resource["externalId"] == externalID {
+				resources = append(resources, resource)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Resources": resources, "totalResults": len(resources)})
+
+	case r.Method == http.MethodPost:
+		var resource map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&resource)
+		resource["id"] = "remote-" + resource["externalId"].(string)
+		p.resources[collection+"/"+resource["id"].(string)] = resource
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(resource)
+
+	case r.Method == http.MethodPatch:
+		resource, ok := p.resources[collection+"/"+id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var patch dto.ScimPatchRequest
+		_ = json.NewDecoder(r.Body).Decode(&patch)
+		for _, operation := range patch.Operations {
+			switch {
+			case operation.Op == "replace" && operation.Path == "":
+				for key, value := range operation.Value.(map[string]any) {
+					resource[key] = value
+				}
+			case operation.Op == "replace":
+				resource[operation.Path] = operation.Value
+			case operation.Op == "add" && operation.Path == "members":
+				members, _ := resource["members"].([]any)
+				resource["members"] = append(members, operation.Value.([]any)...)
+			case operation.Op == "remove" && strings.HasPrefix(operation.Path, "members[value eq "):
+				value := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(operation.Path, "members[value eq "), "]"), `"`)
+				members, _ := resource["members"].([]any)
+				remaining := []any{}
+				for _, member := range members {
+					if member.(map[string]any)["value"] != value {
+						remaining = append(remaining, member)
+					}
+				}
+				resource["members"] = remaining
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resource)
+
+	case r.Method == http.MethodDelete:
+		delete(p.resources, collection+"/"+id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// resource returns the resource with the external ID
+func (p *fakeScimProvider) resource(collection, externalID string) map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, resource := range p.resources {
+		if strings.HasPrefix(key, collection+"/") && resource["externalId"] == externalID {
+			return resource
+		}
+	}
+	return nil
+}
+
+func (p *fakeScimProvider) takeRequests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	requests := p.requests
+	p.requests = nil
+	return requests
+}
+
+func newTestScimService(t *testing.T) (*ScimService, *fakeScimProvider, model.ScimServiceProvider) {
+	t.Helper()
+
+	db := testutils.NewDatabaseForTest(t)
+	fake, server := newFakeScimProvider(t)
+
+	client := model.OidcClient{
+		Name:         "Test Client",
+		CallbackURLs: model.UrlList{"https://example.com/callback"},
+	}
+	require.NoError(t, db.Create(&client).Error)
+
+	provider := model.ScimServiceProvider{
+		Endpoint:     server.URL,
+		OidcClientID: client.ID,
+	}
+	require.NoError(t, db.Create(&provider).Error)
+
+	return NewScimService(db, nil, server.Client(), oidc.SubjectResolver{}, nil), fake, provider
+}
+
+func TestScimServiceDeliverPending(t *testing.T) {
+	service, fake, provider := newTestScimService(t)
+	db := service.db
+
+	user := model.User{Username: "alice", FirstName: "Alice", DisplayName: "Alice", Email: new("alice@example.com")}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&model.CustomClaim{Key: "department", Value: "Engineering", UserID: &user.ID}).Error)
+	group := model.UserGroup{Name: "staff", FriendlyName: "Staff"}
+	require.NoError(t, db.Create(&group).Error)
+
+	deliver := func(t *testing.T) []string {
+		t.Helper()
+		require.NoError(t, service.DeliverPending(t.Context()))
+
+		var pending int64
+		require.NoError(t, db.Model(&model.ScimChange{}).Count(&pending).Error)
+		assert.Zero(t, pending)
+
+		return fake.takeRequests()
+	}
+
+	t.Run("creates user and group", func(t *testing.T) {
+		require.NoError(t, service.RecordUserChange(t.Context(), db, user.ID))
+		require.NoError(t, service.RecordUserChange(t.Context(), db, user.ID))
+		require.NoError(t, service.RecordGroupChange(t.Context(), db, group.ID))
+
+		// The two changes of the user are pushed once
+		assert.ElementsMatch(t, []string{"GET /Users", "POST /Users", "GET /Groups", "POST /Groups"}, deliver(t))
+
+		remoteUser := fake.resource("Users", user.ID)
+		require.NotNil(t, remoteUser)
+		assert.Equal(t, "alice", remoteUser["userName"])
+		assert.Equal(t, map[string]any{"department": "Engineering"}, remoteUser[scimEnterpriseUserSchema])
+		assert.Equal(t, "Staff", fake.resource("Groups", group.ID)["displayName"])
+	})
+
+	t.Run("patches disabled user", func(t *testing.T) {
+		require.NoError(t, db.Model(&user).Update("disabled", true).Error)
+		require.NoError(t, service.RecordUserChange(t.Context(), db, user.ID))
+
+		assert.Equal(t, []string{"GET /Users", "PATCH /Users/remote-" + user.ID}, deliver(t))
+		assert.Equal(t, false, fake.resource("Users", user.ID)["active"])
+	})
+
+	t.Run("adds and removes members", func(t *testing.T) {
+		require.NoError(t, db.Model(&group).Association("Users").Append(&user))
+		require.NoError(t, service.RecordMembershipChange(t.Context(), db, group.ID, user.ID))
+
+		assert.Equal(t, []string{"GET /Users", "GET /Groups", "PATCH /Groups/remote-" + group.ID}, deliver(t))
+		assert.Equal(t, []any{map[string]any{"value": "remote-" + user.ID}}, fake.resource("Groups", group.ID)["members"])
+
+		require.NoError(t, db.Model(&group).Association("Users").Clear())
+		require.NoError(t, service.RecordMembershipChange(t.Context(), db, group.ID, user.ID))
+
+		assert.Equal(t, []string{"GET /Users", "GET /Groups", "PATCH /Groups/remote-" + group.ID}, deliver(t))
+		assert.Empty(t, fake.resource("Groups", group.ID)["members"])
+	})
+
+	t.Run("deletes user and group", func(t *testing.T) {
+		require.NoError(t, db.Delete(&user).Error)
+		require.NoError(t, db.Delete(&group).Error)
+		require.NoError(t, service.RecordUserChange(t.Context(), db, user.ID))
+		require.NoError(t, service.RecordGroupChange(t.Context(), db, group.ID))
+
+		assert.ElementsMatch(t, []string{"GET /Users", "DELETE /Users/remote-" + user.ID, "GET /Groups", "DELETE /Groups/remote-" + group.ID}, deliver(t))
+		assert.Nil(t, fake.resource("Users", user.ID))
+		assert.Nil(t, fake.resource("Groups", group.ID))
+	})
+
+	var loaded model.ScimServiceProvider
+	require.NoError(t, db.First(&loaded, "id = ?", provider.ID).Error)
+	assert.NotNil(t, loaded.LastPushedAt)
+	assert.Empty(t, loaded.LastPushError)
+}
+
+func TestScimServiceDeliverPendingRetries(t *testing.T) {
+	service, fake, provider := newTestScimService(t)
+	db := service.db
+
+	user := model.User{Username: "alice"}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, service.RecordUserChange(t.Context(), db, user.ID))
+
+	fake.failWith = http.StatusServiceUnavailable
+	require.NoError(t, service.DeliverPending(t.Context()))
+
+	var change model.ScimChange
+	require.NoError(t, db.First(&change).Error)
+	assert.Equal(t, model.ScimChangeStatusPending, change.Status)
+	assert.Equal(t, 1, change.Attempts)
+	assert.Contains(t, change.LastError, "503")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), change.NextAttemptAt.ToTime(), 5*time.Second)
+
+	require.NoError(t, db.First(&provider, "id = ?", provider.ID).Error)
+	assert.Contains(t, provider.LastPushError, "503")
+
+	// The change isn't retried before its retry delay passed
+	fake.takeRequests()
+	require.NoError(t, service.DeliverPending(t.Context()))
+	assert.Empty(t, fake.takeRequests())
+
+	// The change is given up after the last attempt and left to the full sync
+	require.NoError(t, db.Model(&change).Updates(map[string]any{
+		"attempts":        scimChangeMaxAttempts - 1,
+		"next_attempt_at": datatype.DateTime(time.Now().Add(-time.Second)),
+	}).Error)
+	require.NoError(t, service.DeliverPending(t.Context()))
+
+	require.NoError(t, db.First(&change).Error)
+	assert.Equal(t, model.ScimChangeStatusFailed, change.Status)
+	assert.Equal(t, scimChangeMaxAttempts, change.Attempts)
+}
+
+func TestScimRetryDelay(t *testing.T) {
+	assert.Equal(t, 3*time.Second, scimRetryDelay("3", 1, scimRequestMaxDelay))
+	assert.Equal(t, 500*time.Millisecond, scimRetryDelay("", 1, scimRequestMaxDelay))
+	assert.Equal(t, 2*time.Second, scimRetryDelay("", 3, scimRequestMaxDelay))
+	assert.Equal(t, scimRequestMaxDelay, scimRetryDelay("", 10, scimRequestMaxDelay))
+	assert.Equal(t, scimChangeMaxDelay, scimRetryDelay("", 100, scimChangeMaxDelay))
+}
+
+func TestChangedMemberIDs(t *testing.T) {
+	assert.Equal(t, []string{"a", "d"}, changedMemberIDs([]string{"a", "b", "c"}, []string{"b", "c", "d"}))
+	assert.Empty(t, changedMemberIDs([]string{"a"}, []string{"a"}))
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
@@ -18,10 +19,11 @@ type UserGroupService struct {
 	db               *gorm.DB
 	scimService      *ScimService
 	appConfigService *AppConfigService
+	auditLogService  *AuditLogService
 }
 
-func NewUserGroupService(db *gorm.DB, appConfigService *AppConfigService, scimService *ScimService) *UserGroupService {
-	return &UserGroupService{db: db, appConfigService: appConfigService, scimService: scimService}
+func NewUserGroupService(db *gorm.DB, appConfigService *AppConfigService, scimService *ScimService, auditLogService *AuditLogService) *UserGroupService {
+	return &UserGroupService{db: db, appConfigService: appConfigService, scimService: scimService, auditLogService: auditLogService}
 }
 
 func (s *UserGroupService) List(ctx context.Context, name string, listRequestOptions utils.ListRequestOptions) (groups []model.UserGroup, response utils.PaginationResponse, err error) {
@@ -91,20 +93,64 @@ func (s *UserGroupService) Delete(ctx context.Context, id string) error {
 		return err
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserGroupDeleted,
+			TargetID:   group.ID,
+			TargetName: group.FriendlyName,
+			Before:     newUserGroupAuditLogState(group),
+		}, tx)
+	}
+
+	if s.scimService != nil {
+		err = s.scimService.RecordGroupChange(ctx, tx, group.ID)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = tx.Commit().Error
 	if err != nil {
 		return err
 	}
 
 	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+		s.scimService.ScheduleDelivery()
 	}
 
 	return nil
 }
 
 func (s *UserGroupService) Create(ctx context.Context, input dto.UserGroupCreateDto) (group model.UserGroup, err error) {
-	return s.createInternal(ctx, input, s.db)
+	tx := s.db.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	group, err = s.createInternal(ctx, input, tx)
+	if err != nil {
+		return model.UserGroup{}, err
+	}
+
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserGroupCreated,
+			TargetID:   group.ID,
+			TargetName: group.FriendlyName,
+			After:      newUserGroupAuditLogState(group),
+		}, tx)
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return model.UserGroup{}, err
+	}
+
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
+	return group, nil
 }
 
 func (s *UserGroupService) createInternal(ctx context.Context, input dto.UserGroupCreateDto, tx *gorm.DB) (group model.UserGroup, err error) {
@@ -130,7 +176,10 @@ func (s *UserGroupService) createInternal(ctx context.Context, input dto.UserGro
 	}
 
 	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+		err = s.scimService.RecordGroupChange(ctx, tx, group.ID)
+		if err != nil {
+			return model.UserGroup{}, err
+		}
 	}
 
 	return group, nil
@@ -152,6 +201,10 @@ func (s *UserGroupService) Update(ctx context.Context, id string, input dto.User
 		return model.UserGroup{}, err
 	}
 
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return group, nil
 }
 
@@ -166,6 +219,8 @@ func (s *UserGroupService) updateInternal(ctx context.Context, id string, input
 		return model.UserGroup{}, &common.LdapUserGroupUpdateError{}
 	}
 
+	previousState := newUserGroupAuditLogState(group)
+	renamed := group.FriendlyName != input.FriendlyName
 	group.Name = input.Name
 	group.FriendlyName = input.FriendlyName
 	group.UpdatedAt = new(datatype.DateTime(time.Now()))
@@ -181,8 +236,22 @@ func (s *UserGroupService) updateInternal(ctx context.Context, id string, input
 		return model.UserGroup{}, err
 	}
 
-	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+	if s.auditLogService != nil && !isLdapSync {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserGroupUpdated,
+			TargetID:   group.ID,
+			TargetName: group.FriendlyName,
+			Before:     previousState,
+			After:      newUserGroupAuditLogState(group),
+		}, tx)
+	}
+
+	// The friendly name is the only attribute of the group that is provisioned
+	if s.scimService != nil && renamed {
+		err = s.scimService.RecordGroupChange(ctx, tx, group.ID)
+		if err != nil {
+			return model.UserGroup{}, err
+		}
 	}
 
 	return group, nil
@@ -194,7 +263,7 @@ func (s *UserGroupService) UpdateUsers(ctx context.Context, id string, userIds [
 		tx.Rollback()
 	}()
 
-	group, err = s.updateUsersInternal(ctx, id, userIds, tx)
+	group, err = s.updateUsersInternal(ctx, id, userIds, false, tx)
 	if err != nil {
 		return model.UserGroup{}, err
 	}
@@ -204,14 +273,19 @@ func (s *UserGroupService) UpdateUsers(ctx context.Context, id string, userIds [
 		return model.UserGroup{}, err
 	}
 
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return group, nil
 }
 
-func (s *UserGroupService) updateUsersInternal(ctx context.Context, id string, userIds []string, tx *gorm.DB) (group model.UserGroup, err error) {
+func (s *UserGroupService) updateUsersInternal(ctx context.Context, id string, userIds []string, isLdapSync bool, tx *gorm.DB) (group model.UserGroup, err error) {
 	group, err = s.getInternal(ctx, id, tx)
 	if err != nil {
 		return model.UserGroup{}, err
 	}
+	previousState := newUserGroupAuditLogState(group)
 
 	// Fetch the users based on the userIds
 	var users []model.User
@@ -226,6 +300,15 @@ func (s *UserGroupService) updateUsersInternal(ctx context.Context, id string, u
 		}
 	}
 
+	previousUserIDs := make([]string, len(group.Users))
+	for i, user := range group.Users {
+		previousUserIDs[i] = user.ID
+	}
+	currentUserIDs := make([]string, len(users))
+	for i, user := range users {
+		currentUserIDs[i] = user.ID
+	}
+
 	// Replace the current users with the new set of users
 	err = tx.
 		WithContext(ctx).
@@ -236,6 +319,13 @@ func (s *UserGroupService) updateUsersInternal(ctx context.Context, id string, u
 		return model.UserGroup{}, err
 	}
 
+	if s.scimService != nil {
+		err = s.scimService.RecordMembershipChange(ctx, tx, group.ID, changedMemberIDs(previousUserIDs, currentUserIDs)...)
+		if err != nil {
+			return model.UserGroup{}, err
+		}
+	}
+
 	// Save the updated group
 	group.UpdatedAt = new(datatype.DateTime(time.Now()))
 
@@ -247,8 +337,14 @@ func (s *UserGroupService) updateUsersInternal(ctx context.Context, id string, u
 		return model.UserGroup{}, err
 	}
 
-	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+	if s.auditLogService != nil && !isLdapSync {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserGroupUpdated,
+			TargetID:   group.ID,
+			TargetName: group.FriendlyName,
+			Before:     previousState,
+			After:      newUserGroupAuditLogState(group),
+		}, tx)
 	}
 
 	return group, nil
@@ -290,6 +386,8 @@ func (s *UserGroupService) UpdateAllowedOidcClient(ctx context.Context, id strin
 		return model.UserGroup{}, err
 	}
 
+	previousState := newUserGroupAuditLogState(group)
+
 	// Fetch the clients based on the client IDs
 	var clients []model.OidcClient
 	if len(input.OidcClientIDs) > 0 {
@@ -322,6 +420,16 @@ func (s *UserGroupService) UpdateAllowedOidcClient(ctx context.Context, id strin
 		return model.UserGroup{}, err
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserGroupUpdated,
+			TargetID:   group.ID,
+			TargetName: group.FriendlyName,
+			Before:     previousState,
+			After:      newUserGroupAuditLogState(group),
+		}, tx)
+	}
+
 	err = tx.Commit().Error
 	if err != nil {
 		return model.UserGroup{}, err
@@ -333,3 +441,27 @@ func (s *UserGroupService) UpdateAllowedOidcClient(ctx context.Context, id strin
 
 	return group, nil
 }
+
+// userGroupAuditLogState is the state of a user group that is recorded in the audit log when the group is changed
+type userGroupAuditLogState struct {
+	FriendlyName         string   `json:"friendlyName"`
+	Name                 string   `json:"name"`
+	UserIDs              []string `json:"userIds,omitempty"`
+	AllowedOidcClientIDs []string `json:"allowedOidcClientIds,omitempty"`
+}
+
+func newUserGroupAuditLogState(group model.UserGroup) userGroupAuditLogState {
+	state := userGroupAuditLogState{
+		FriendlyName: group.FriendlyName,
+		Name:         group.Name,
+	}
+	for _, user := range group.Users {
+		state.UserIDs = append(state.UserIDs, user.ID)
+	}
+	for _, client := range group.AllowedOidcClients {
+		state.AllowedOidcClientIDs = append(state.AllowedOidcClientIDs, client.ID)
+	}
+	slices.Sort(state.UserIDs)
+	slices.Sort(state.AllowedOidcClientIDs)
+	return state
+}
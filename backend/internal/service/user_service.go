@@ -10,6 +10,7 @@ import (
 	"io/fs"
 	"log/slog"
 	"path"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +22,7 @@ import (
 	"github.com/pocket-id/pocket-id/backend/internal/dto"
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/oidc"
 	"github.com/pocket-id/pocket-id/backend/internal/storage"
 	"github.com/pocket-id/pocket-id/backend/internal/utils"
 	profilepicture "github.com/pocket-id/pocket-id/backend/internal/utils/image"
@@ -35,10 +37,11 @@ type UserService struct {
 	customClaimService *CustomClaimService
 	appImagesService   *AppImagesService
 	scimService        *ScimService
+	backchannelLogout  *oidc.BackchannelLogoutService
 	fileStorage        storage.FileStorage
 }
 
-func NewUserService(db *gorm.DB, jwtService *JwtService, auditLogService *AuditLogService, emailService *EmailService, appConfigService *AppConfigService, customClaimService *CustomClaimService, appImagesService *AppImagesService, scimService *ScimService, fileStorage storage.FileStorage) *UserService {
+func NewUserService(db *gorm.DB, jwtService *JwtService, auditLogService *AuditLogService, emailService *EmailService, appConfigService *AppConfigService, customClaimService *CustomClaimService, appImagesService *AppImagesService, scimService *ScimService, backchannelLogout *oidc.BackchannelLogoutService, fileStorage storage.FileStorage) *UserService {
 	return &UserService{
 		db:                 db,
 		jwtService:         jwtService,
@@ -48,6 +51,7 @@ func NewUserService(db *gorm.DB, jwtService *JwtService, auditLogService *AuditL
 		customClaimService: customClaimService,
 		appImagesService:   appImagesService,
 		scimService:        scimService,
+		backchannelLogout:  backchannelLogout,
 		fileStorage:        fileStorage,
 	}
 }
@@ -193,6 +197,13 @@ func (s *UserService) DeleteUser(ctx context.Context, userID string, allowLdapDe
 		return fmt.Errorf("failed to delete user '%s': %w", userID, err)
 	}
 
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	// Storage operations must be executed outside of a transaction
 	profilePicturePath := path.Join("profile-pictures", userID+".png")
 	err = s.fileStorage.Delete(ctx, profilePicturePath)
@@ -221,13 +232,33 @@ func (s *UserService) deleteUserInternal(ctx context.Context, tx *gorm.DB, userI
 		return &common.LdapUserUpdateError{}
 	}
 
+	// The sessions have to be ended before the user is deleted, as the authorized clients are deleted with the user
+	err = s.endUserSessionsInternal(ctx, tx, user.ID)
+	if err != nil {
+		return err
+	}
+
 	err = tx.WithContext(ctx).Delete(&user).Error
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
+	// Deletions of the LDAP sync aren't attributed to the user that triggered the sync
+	if s.auditLogService != nil && !allowLdapDelete {
+		// The audit log is recorded for the actor, as the logs of the deleted user are deleted with it
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:      model.AuditLogEventUserDeleted,
+			TargetID:   user.ID,
+			TargetName: user.Username,
+			Before:     newUserAuditLogState(user),
+		}, tx)
+	}
+
 	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+		err = s.scimService.RecordUserChange(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -249,6 +280,10 @@ func (s *UserService) CreateUser(ctx context.Context, input dto.UserCreateDto) (
 		return model.User{}, err
 	}
 
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return user, nil
 }
 
@@ -314,8 +349,27 @@ func (s *UserService) CreateUserInternal(ctx context.Context, input dto.UserCrea
 		}
 	}
 
+	if s.auditLogService != nil && !isLdapSync {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventUserCreated,
+			TargetID:     user.ID,
+			TargetName:   user.Username,
+			TargetUserID: user.ID,
+			After:        newUserAuditLogState(user),
+		}, tx)
+	}
+
 	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+		err = s.scimService.RecordUserChange(ctx, tx, user.ID)
+		if err != nil {
+			return model.User{}, err
+		}
+		for _, group := range user.UserGroups {
+			err = s.scimService.RecordMembershipChange(ctx, tx, group.ID, user.ID)
+			if err != nil {
+				return model.User{}, err
+			}
+		}
 	}
 
 	return user, nil
@@ -390,6 +444,13 @@ func (s *UserService) UpdateUser(ctx context.Context, userID string, updatedUser
 		return model.User{}, err
 	}
 
+	if user.Disabled && s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+	if s.scimService != nil {
+		s.scimService.ScheduleDelivery()
+	}
+
 	return user, nil
 }
 
@@ -409,6 +470,9 @@ func (s *UserService) updateUserInternal(ctx context.Context, userID string, upd
 		return model.User{}, err
 	}
 
+	wasDisabled := user.Disabled
+	original := user
+
 	// Check if this is an LDAP user and LDAP is enabled
 	isLdapUser := user.LdapID != nil && s.appConfigService.GetDbConfig().LdapEnabled.IsTrue()
 	allowOwnAccountEdit := s.appConfigService.GetDbConfig().AllowOwnAccountEdit.IsTrue()
@@ -463,8 +527,30 @@ func (s *UserService) updateUserInternal(ctx context.Context, userID string, upd
 		return user, err
 	}
 
-	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+	if user.Disabled && !wasDisabled {
+		err = s.endUserSessionsInternal(ctx, tx, user.ID)
+		if err != nil {
+			return user, err
+		}
+	}
+
+	if s.auditLogService != nil && !isLdapSync {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventUserUpdated,
+			TargetID:     user.ID,
+			TargetName:   user.Username,
+			TargetUserID: user.ID,
+			Before:       newUserAuditLogState(original),
+			After:        newUserAuditLogState(user),
+		}, tx)
+	}
+
+	// Only changes of provisioned attributes are pushed, so unchanged LDAP users aren't pushed on every sync
+	if s.scimService != nil && scimUserModified(original, user) {
+		err = s.scimService.RecordUserChange(ctx, tx, user.ID)
+		if err != nil {
+			return user, err
+		}
 	}
 
 	return user, nil
@@ -494,6 +580,12 @@ func (s *UserService) UpdateUserGroups(ctx context.Context, id string, userGroup
 		}
 	}
 
+	previousGroupIDs := make([]string, len(user.UserGroups))
+	for i, group := range user.UserGroups {
+		previousGroupIDs[i] = group.ID
+	}
+	previousState := newUserAuditLogState(user)
+
 	// Replace the current groups with the new set of groups
 	err = tx.
 		WithContext(ctx).
@@ -504,6 +596,15 @@ func (s *UserService) UpdateUserGroups(ctx context.Context, id string, userGroup
 		return model.User{}, err
 	}
 
+	if s.scimService != nil {
+		for _, groupID := range changedMemberIDs(previousGroupIDs, groupIDs(groups)) {
+			err = s.scimService.RecordMembershipChange(ctx, tx, groupID, user.ID)
+			if err != nil {
+				return model.User{}, err
+			}
+		}
+	}
+
 	// Save the updated user
 	err = tx.WithContext(ctx).Save(&user).Error
 	if err != nil {
@@ -520,13 +621,24 @@ func (s *UserService) UpdateUserGroups(ctx context.Context, id string, userGroup
 		}
 	}
 
+	if s.auditLogService != nil {
+		s.auditLogService.CreateChange(ctx, model.AuditLogChange{
+			Event:        model.AuditLogEventUserUpdated,
+			TargetID:     user.ID,
+			TargetName:   user.Username,
+			TargetUserID: user.ID,
+			Before:       previousState,
+			After:        newUserAuditLogState(user),
+		}, tx)
+	}
+
 	err = tx.Commit().Error
 	if err != nil {
 		return model.User{}, err
 	}
 
 	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+		s.scimService.ScheduleDelivery()
 	}
 
 	return user, nil
@@ -578,24 +690,48 @@ func (s *UserService) ResetProfilePicture(ctx context.Context, userID string) er
 }
 
 func (s *UserService) disableUserInternal(ctx context.Context, tx *gorm.DB, userID string) error {
-	err := tx.
+	result := tx.
 		WithContext(ctx).
 		Model(&model.User{}).
-		Where("id = ?", userID).
-		Update("disabled", true).
-		Error
+		Where("id = ? AND disabled = ?", userID, false).
+		Update("disabled", true)
 
-	if err != nil {
-		return err
+	if result.Error != nil {
+		return result.Error
 	}
 
-	if s.scimService != nil {
-		s.scimService.ScheduleSync()
+	// Sessions only have to be ended if the user wasn't disabled already
+	if result.RowsAffected > 0 {
+		err := s.endUserSessionsInternal(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if s.scimService != nil {
+			err = s.scimService.RecordUserChange(ctx, tx, userID)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// endUserSessionsInternal signs the user out of every browser session, revokes the sessions of the user with every
+// client and records back-channel logouts for the clients, which are delivered after the transaction has been committed
+func (s *UserService) endUserSessionsInternal(ctx context.Context, tx *gorm.DB, userID string) error {
+	err := tx.
+		WithContext(ctx).
+		Delete(&model.UserSession{}, "user_id = ?", userID).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to delete browser sessions: %w", err)
+	}
+
+	return revokeOAuth2GrantsInternal(ctx, tx, s.backchannelLogout, userID)
+}
+
 func (s *UserService) SendEmailVerification(ctx context.Context, userID string) error {
 	user, err := s.GetUser(ctx, userID)
 	if err != nil {
@@ -665,3 +801,36 @@ func (s *UserService) VerifyEmail(ctx context.Context, userID string, token stri
 
 	return tx.Commit().Error
 }
+
+// userAuditLogState is the state of a user that is recorded in the audit log when the user is changed
+type userAuditLogState struct {
+	Username      string   `json:"username"`
+	Email         *string  `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	FirstName     string   `json:"firstName"`
+	LastName      string   `json:"lastName"`
+	DisplayName   string   `json:"displayName"`
+	IsAdmin       bool     `json:"isAdmin"`
+	Locale        *string  `json:"locale"`
+	Disabled      bool     `json:"disabled"`
+	UserGroupIDs  []string `json:"userGroupIds,omitempty"`
+}
+
+func newUserAuditLogState(user model.User) userAuditLogState {
+	state := userAuditLogState{
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		DisplayName:   user.DisplayName,
+		IsAdmin:       user.IsAdmin,
+		Locale:        user.Locale,
+		Disabled:      user.Disabled,
+	}
+	if len(user.UserGroups) > 0 {
+		state.UserGroupIDs = groupIDs(user.UserGroups)
+		slices.Sort(state.UserGroupIDs)
+	}
+	return state
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/oidc"
+)
+
+// userSessionLastSeenInterval is how often the last seen time of a session is updated, to avoid a write on every request
+const userSessionLastSeenInterval = time.Minute
+
+// UserSessionService manages the browser sessions of users with Pocket ID
+type UserSessionService struct {
+	db                *gorm.DB
+	jwtService        *JwtService
+	appConfigService  *AppConfigService
+	geoliteService    *GeoLiteService
+	backchannelLogout *oidc.BackchannelLogoutService
+}
+
+func NewUserSessionService(db *gorm.DB, jwtService *JwtService, appConfigService *AppConfigService, geoliteService *GeoLiteService) *UserSessionService {
+	return &UserSessionService{
+		db:               db,
+		jwtService:       jwtService,
+		appConfigService: appConfigService,
+		geoliteService:   geoliteService,
+	}
+}
+
+// SetBackchannelLogout sets the service that notifies clients when the OAuth2 grants of a user are revoked
+// It is set after construction because the OIDC module depends on the modules that sign users in
+func (s *UserSessionService) SetBackchannelLogout(backchannelLogout *oidc.BackchannelLogoutService) {
+	s.backchannelLogout = backchannelLogout
+}
+
+// CreateSession starts a new browser session for the user and returns the access token that belongs to it
+func (s *UserSessionService) CreateSession(ctx context.Context, tx *gorm.DB, user model.User, authenticationMethod, ipAddress, userAgent string) (string, error) {
+	now := time.Now()
+	session := model.UserSession{
+		Base:                 model.Base{ID: uuid.New().String()},
+		AuthenticationMethod: authenticationMethod,
+		UserAgent:            userAgent,
+		LastSeenAt:           datatype.DateTime(now),
+		ExpiresAt:            datatype.DateTime(now.Add(s.appConfigService.GetDbConfig().SessionDuration.AsDurationMinutes())),
+		UserID:               user.ID,
+	}
+
+	if ipAddress != "" {
+		// Only set ipAddress if not empty, because on Postgres we use INET columns that don't allow non-null empty values
+		session.IpAddress = &ipAddress
+
+		if s.geoliteService != nil {
+			country, city, err := s.geoliteService.GetLocationByIP(ipAddress)
+			if err != nil {
+				// Log the error but don't interrupt the sign in
+				slog.WarnContext(ctx, "Failed to get IP location", slog.String("ip", ipAddress), slog.Any("error", err))
+			}
+			session.Country = country
+			session.City = city
+		}
+	}
+
+	err := tx.
+		WithContext(ctx).
+		Create(&session).
+		Error
+	if err != nil {
+		return "", fmt.Errorf("failed to create user session: %w", err)
+	}
+
+	return s.jwtService.GenerateAccessToken(user, authenticationMethod, session.ID)
+}
+
+// ValidateSession checks that the session exists, belongs to the user and hasn't expired, and records that it was seen
+func (s *UserSessionService) ValidateSession(ctx context.Context, sessionID, userID string) error {
+	var session model.UserSession
+	err := s.db.
+		WithContext(ctx).
+		Where("id = ? AND user_id = ? AND expires_at > ?", sessionID, userID, datatype.DateTime(time.Now())).
+		First(&session).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if time.Since(session.LastSeenAt.ToTime()) < userSessionLastSeenInterval {
+		return nil
+	}
+
+	err = s.db.
+		WithContext(ctx).
+		Model(&model.UserSession{}).
+		Where("id = ?", session.ID).
+		Update("last_seen_at", datatype.DateTime(time.Now())).
+		Error
+	if err != nil {
+		// The session is valid regardless of whether its last seen time could be updated
+		slog.WarnContext(ctx, "Failed to update the last seen time of the user session", slog.String("session", session.ID), slog.Any("error", err))
+	}
+
+	return nil
+}
+
+// ListSessions returns the active browser sessions of the user, most recently seen first
+func (s *UserSessionService) ListSessions(ctx context.Context, userID string) ([]model.UserSession, error) {
+	var sessions []model.UserSession
+	err := s.db.
+		WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, datatype.DateTime(time.Now())).
+		Order("last_seen_at DESC").
+		Find(&sessions).
+		Error
+	return sessions, err
+}
+
+// RevokeSession signs a single browser session of the user out and revokes the OAuth2 grants authorized in it
+func (s *UserSessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			WithContext(ctx).
+			Delete(&model.UserSession{}, "id = ? AND user_id = ?", sessionID, userID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke user session: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return revokeUserSessionGrantsInternal(ctx, tx, s.backchannelLogout, userID, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+	return nil
+}
+
+// RevokeAllSessions signs the user out everywhere, except for the session with the given ID if it isn't empty
+// The OAuth2 grants of the user are revoked as well, so clients can't keep using the sessions that were started from them
+func (s *UserSessionService) RevokeAllSessions(ctx context.Context, userID, exceptSessionID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.WithContext(ctx).Where("user_id = ?", userID)
+		if exceptSessionID != "" {
+			query = query.Where("id <> ?", exceptSessionID)
+		}
+		err := query.Delete(&model.UserSession{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke user sessions: %w", err)
+		}
+
+		return revokeOAuth2GrantsInternal(ctx, tx, s.backchannelLogout, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+	return nil
+}
+
+// Logout ends the browser session the user signed out of and revokes the OAuth2 grants authorized in it
+func (s *UserSessionService) Logout(ctx context.Context, userID, sessionID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			WithContext(ctx).
+			Delete(&model.UserSession{}, "id = ? AND user_id = ?", sessionID, userID).
+			Error
+		if err != nil {
+			return fmt.Errorf("failed to delete user session: %w", err)
+		}
+
+		return revokeUserSessionGrantsInternal(ctx, tx, s.backchannelLogout, userID, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.backchannelLogout != nil {
+		s.backchannelLogout.ScheduleDelivery()
+	}
+	return nil
+}
+
+// DeviceStringFromUserAgent describes the browser and operating system of a session
+func (s *UserSessionService) DeviceStringFromUserAgent(userAgent string) string {
+	return deviceStringFromUserAgent(userAgent)
+}
+
+// revokeOAuth2GrantsInternal revokes the sessions of the user with every client and records back-channel logouts for
+// the clients, which are delivered after the transaction has been committed
+func revokeOAuth2GrantsInternal(ctx context.Context, tx *gorm.DB, backchannelLogout *oidc.BackchannelLogoutService, userID string) error {
+	if backchannelLogout != nil {
+		err := backchannelLogout.LogoutUser(ctx, tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to record back-channel logouts: %w", err)
+		}
+	}
+
+	err := oidc.RevokeUserSessions(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// revokeUserSessionGrantsInternal revokes the sessions of the user with clients that were authorized in the browser
+// session with the given ID and records back-channel logouts for them, which are delivered after the transaction has
+// been committed
+func revokeUserSessionGrantsInternal(ctx context.Context, tx *gorm.DB, backchannelLogout *oidc.BackchannelLogoutService, userID, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	if backchannelLogout != nil {
+		err := backchannelLogout.LogoutUserSession(ctx, tx, userID, sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to record back-channel logouts: %w", err)
+		}
+	}
+
+	err := oidc.RevokeUserSessionGrants(ctx, tx, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// CleanupExpiredUserSessions deletes browser sessions that have expired
+func CleanupExpiredUserSessions(ctx context.Context, db *gorm.DB) (int64, error) {
+	st := db.
+		WithContext(ctx).
+		Delete(&model.UserSession{}, "expires_at < ?", datatype.DateTime(time.Now()))
+	return st.RowsAffected, st.Error
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+func TestUserSessionService(t *testing.T) {
+	mockConfig := NewTestAppConfigService(&model.AppConfig{
+		SessionDuration: model.AppConfigVariable{Value: "60"}, // 60 minutes
+	})
+	jwtService, db, _ := setupJwtService(t, mockConfig)
+	service := NewUserSessionService(db, jwtService, mockConfig, nil)
+
+	user := model.User{Base: model.Base{ID: "session-user"}, Username: "session-user"}
+	require.NoError(t, db.Create(&user).Error)
+
+	createSession := func(t *testing.T) string {
+		t.Helper()
+
+		token, err := service.CreateSession(t.Context(), db, user, AuthenticationMethodPhishingResistant, "192.0.2.1", "test-agent")
+		require.NoError(t, err)
+
+		claims, err := jwtService.VerifyAccessToken(token)
+		require.NoError(t, err)
+		sessionID, err := jwtService.GetSessionID(claims)
+		require.NoError(t, err)
+		require.NotEmpty(t, sessionID)
+		return sessionID
+	}
+
+	t.Run("created session is valid until it expires", func(t *testing.T) {
+		sessionID := createSession(t)
+		require.NoError(t, service.ValidateSession(t.Context(), sessionID, user.ID))
+		require.ErrorIs(t, service.ValidateSession(t.Context(), sessionID, "other-user"), gorm.ErrRecordNotFound)
+
+		err := db.Model(&model.UserSession{}).
+			Where("id = ?", sessionID).
+			Update("expires_at", datatype.DateTime(time.Now().Add(-time.Minute))).
+			Error
+		require.NoError(t, err)
+		require.ErrorIs(t, service.ValidateSession(t.Context(), sessionID, user.ID), gorm.ErrRecordNotFound)
+
+		count, err := CleanupExpiredUserSessions(t.Context(), db)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, count)
+	})
+
+	t.Run("revoke a single session", func(t *testing.T) {
+		sessionID := createSession(t)
+		require.ErrorIs(t, service.RevokeSession(t.Context(), "other-user", sessionID), gorm.ErrRecordNotFound)
+
+		require.NoError(t, service.RevokeSession(t.Context(), user.ID, sessionID))
+		require.ErrorIs(t, service.ValidateSession(t.Context(), sessionID, user.ID), gorm.ErrRecordNotFound)
+	})
+
+	t.Run("revoke all sessions except the current one", func(t *testing.T) {
+		currentSessionID := createSession(t)
+		otherSessionID := createSession(t)
+
+		require.NoError(t, service.RevokeAllSessions(t.Context(), user.ID, currentSessionID))
+
+		sessions, err := service.ListSessions(t.Context(), user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		require.Equal(t, currentSessionID, sessions[0].ID)
+		require.Equal(t, "test-agent", sessions[0].UserAgent)
+		require.ErrorIs(t, service.ValidateSession(t.Context(), otherSessionID, user.ID), gorm.ErrRecordNotFound)
+
+		require.NoError(t, service.Logout(t.Context(), user.ID, currentSessionID))
+
+		sessions, err = service.ListSessions(t.Context(), user.ID)
+		require.NoError(t, err)
+		require.Empty(t, sessions)
+	})
+}
@@ -1,6 +1,7 @@
 package usersignup
 
 import (
+	"slices"
 	"time"
 
 	"github.com/pocket-id/pocket-id/backend/internal/model"
@@ -29,3 +30,23 @@ func (st *SignupToken) IsUsageLimitReached() bool {
 func (st *SignupToken) IsValid() bool {
 	return !st.IsExpired() && !st.IsUsageLimitReached()
 }
+
+// auditLogState is the state of a signup token that is recorded in the audit log when the token is changed
+type auditLogState struct {
+	ExpiresAt    datatype.DateTime `json:"expiresAt"`
+	UsageLimit   int               `json:"usageLimit"`
+	UserGroupIDs []string          `json:"userGroupIds"`
+}
+
+func newAuditLogState(signupToken SignupToken) auditLogState {
+	state := auditLogState{
+		ExpiresAt:    signupToken.ExpiresAt,
+		UsageLimit:   signupToken.UsageLimit,
+		UserGroupIDs: make([]string, len(signupToken.UserGroups)),
+	}
+	for i, group := range signupToken.UserGroups {
+		state.UserGroupIDs[i] = group.ID
+	}
+	slices.Sort(state.UserGroupIDs)
+	return state
+}
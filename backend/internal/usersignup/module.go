@@ -10,12 +10,13 @@ import (
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 )
 
-type TokenService interface {
-	GenerateAccessToken(user model.User, authenticationMethod string) (string, error)
+type SessionCreator interface {
+	CreateSession(ctx context.Context, tx *gorm.DB, user model.User, authenticationMethod, ipAddress, userAgent string) (string, error)
 }
 
 type AuditLogger interface {
 	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
+	CreateChange(ctx context.Context, change model.AuditLogChange, tx *gorm.DB)
 }
 
 type AppConfigProvider interface {
@@ -29,7 +30,7 @@ type UserCreator interface {
 type Dependencies struct {
 	DB *gorm.DB
 
-	Signer      TokenService
+	Sessions    SessionCreator
 	AuditLog    AuditLogger
 	AppConfig   AppConfigProvider
 	UserCreator UserCreator
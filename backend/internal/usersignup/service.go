@@ -23,7 +23,7 @@ const authenticationMethodOneTimePassword = "otp"
 type Service struct {
 	db          *gorm.DB
 	userCreator UserCreator
-	signer      TokenService
+	sessions    SessionCreator
 	auditLog    AuditLogger
 	appConfig   AppConfigProvider
 }
@@ -32,7 +32,7 @@ func newService(deps Dependencies) *Service {
 	return &Service{
 		db:          deps.DB,
 		userCreator: deps.UserCreator,
-		signer:      deps.Signer,
+		sessions:    deps.Sessions,
 		auditLog:    deps.AuditLog,
 		appConfig:   deps.AppConfig,
 	}
@@ -92,7 +92,7 @@ func (s *Service) SignUp(ctx context.Context, signupData signUpDto, ipAddress, u
 		return model.User{}, "", err
 	}
 
-	accessToken, err := s.signer.GenerateAccessToken(user, "")
+	accessToken, err := s.sessions.CreateSession(ctx, tx, user, "", ipAddress, userAgent)
 	if err != nil {
 		return model.User{}, "", err
 	}
@@ -122,7 +122,7 @@ func (s *Service) SignUp(ctx context.Context, signupData signUpDto, ipAddress, u
 	return user, accessToken, nil
 }
 
-func (s *Service) SignUpInitialAdmin(ctx context.Context, signUpData signUpDto) (model.User, string, error) {
+func (s *Service) SignUpInitialAdmin(ctx context.Context, signUpData signUpDto, ipAddress, userAgent string) (model.User, string, error) {
 	tx := s.db.Begin()
 	defer func() {
 		tx.Rollback()
@@ -150,7 +150,7 @@ func (s *Service) SignUpInitialAdmin(ctx context.Context, signUpData signUpDto)
 		return model.User{}, "", err
 	}
 
-	token, err := s.signer.GenerateAccessToken(user, authenticationMethodOneTimePassword)
+	token, err := s.sessions.CreateSession(ctx, tx, user, authenticationMethodOneTimePassword, ipAddress, userAgent)
 	if err != nil {
 		return model.User{}, "", err
 	}
@@ -187,7 +187,36 @@ func (s *Service) ListSignupTokens(ctx context.Context, listRequestOptions utils
 }
 
 func (s *Service) DeleteSignupToken(ctx context.Context, tokenID string) error {
-	return s.db.WithContext(ctx).Delete(&SignupToken{}, "id = ?", tokenID).Error
+	tx := s.db.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	var signupToken SignupToken
+	err := tx.
+		WithContext(ctx).
+		Preload("UserGroups").
+		Where("id = ?", tokenID).
+		Find(&signupToken).
+		Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.WithContext(ctx).Delete(&SignupToken{}, "id = ?", tokenID).Error
+	if err != nil {
+		return err
+	}
+
+	if signupToken.ID != "" {
+		s.auditLog.CreateChange(ctx, model.AuditLogChange{
+			Event:    model.AuditLogEventSignupTokenDeleted,
+			TargetID: signupToken.ID,
+			Before:   newAuditLogState(signupToken),
+		}, tx)
+	}
+
+	return tx.Commit().Error
 }
 
 func (s *Service) CreateSignupToken(ctx context.Context, ttl time.Duration, usageLimit int, userGroupIDs []string) (SignupToken, error) {
@@ -211,6 +240,12 @@ func (s *Service) CreateSignupToken(ctx context.Context, ttl time.Duration, usag
 		return SignupToken{}, err
 	}
 
+	s.auditLog.CreateChange(ctx, model.AuditLogChange{
+		Event:    model.AuditLogEventSignupTokenCreated,
+		TargetID: signupToken.ID,
+		After:    newAuditLogState(*signupToken),
+	}, s.db)
+
 	return *signupToken, nil
 }
 
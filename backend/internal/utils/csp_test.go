@@ -28,3 +28,17 @@ func TestBuildFormPostCSP(t *testing.T) {
 	assert.True(t, found, "csp must contain a script-src directive")
 	assert.NotContains(t, scriptSrc, "unsafe-inline")
 }
+
+func TestBuildFrontchannelLogoutCSP(t *testing.T) {
+	csp := BuildFrontchannelLogoutCSP("test-nonce", []string{"https://a.example.com", "https://b.example.com:8443"}, "'sha256-abc123'")
+
+	// Only the origins of the clients' front-channel logout URIs may be framed
+	assert.Contains(t, csp, "frame-src 'self' https://a.example.com https://b.example.com:8443;")
+	assert.Contains(t, csp, "script-src 'self' 'nonce-test-nonce' 'sha256-abc123'")
+
+	// The page itself must still not be framed
+	assert.Contains(t, csp, "frame-ancestors 'none';")
+
+	// Other pages keep falling back to default-src for frames
+	assert.NotContains(t, BuildCSP("test-nonce"), "frame-src")
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
 )
@@ -55,8 +58,12 @@ func IsTailscaleIP(ip net.IP) bool {
 	return listContainsIP(tailscaleIPNets, ip)
 }
 
+// IsPrivateIP reports whether the IP address isn't a public one
+// Besides the ranges above, this includes link-local addresses, like the metadata endpoints of cloud providers, unique
+// local IPv6 addresses and the unspecified address, which connects to the host itself
 func IsPrivateIP(ip net.IP) bool {
-	return IsLocalhostIP(ip) || IsPrivateLanIP(ip) || IsTailscaleIP(ip) || IsLocalIPv6(ip)
+	return IsLocalhostIP(ip) || IsPrivateLanIP(ip) || IsTailscaleIP(ip) || IsLocalIPv6(ip) ||
+		ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
 }
 
 func IsURLPrivate(ctx context.Context, u *url.URL) (bool, error) {
@@ -76,6 +83,50 @@ func IsURLPrivate(ctx context.Context, u *url.URL) (bool, error) {
 	return false, nil
 }
 
+// ErrPrivateIPAddress is returned when a URL that users or clients can choose points to a private IP address
+var ErrPrivateIPAddress = errors.New("private IP addresses are not allowed")
+
+// PublicOnlyHTTPClient returns a copy of the client that can only connect to public IP addresses
+// The address is checked when the connection is made, so neither redirects nor DNS records that changed after a URL was
+// checked with IsURLPrivate can make it reach a private address. Requests aren't sent through a proxy, because the proxy
+// would connect to the address instead.
+// A client with a transport that isn't an *http.Transport, like the ones in tests, is copied without the check.
+func PublicOnlyHTTPClient(source *http.Client) *http.Client {
+	if source == nil {
+		source = http.DefaultClient
+	}
+	client := *source
+
+	transport, ok := source.Transport.(*http.Transport)
+	if source.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return &client
+	}
+
+	transport = transport.Clone()
+	transport.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || IsPrivateIP(ip) {
+				return ErrPrivateIPAddress
+			}
+			return nil
+		},
+	}
+	transport.DialContext = dialer.DialContext
+	client.Transport = transport
+
+	return &client
+}
+
 func listContainsIP(ipNets []*net.IPNet, ip net.IP) bool {
 	for _, ipNet := range ipNets {
 		if ipNet.Contains(ip) {
@@ -3,6 +3,8 @@ package utils
 import (
 	"context"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -114,6 +116,11 @@ func TestIsPrivateIP(t *testing.T) {
 		{"192.168.1.1", true},           // private LAN
 		{"100.64.0.1", true},            // Tailscale
 		{"fd00::1", true},               // local IPv6
+		{"fc00::1", true},               // unique local IPv6
+		{"169.254.169.254", true},       // link-local, like cloud metadata endpoints
+		{"fe80::1", true},               // link-local IPv6
+		{"0.0.0.0", true},               // unspecified
+		{"::ffff:127.0.0.1", true},      // IPv4-mapped localhost
 		{"8.8.8.8", false},              // public IPv4
 		{"2001:4860:4860::8888", false}, // public IPv6
 	}
@@ -341,3 +348,22 @@ func TestIsURLPrivate_ContextCancellation(t *testing.T) {
 	_, err = IsURLPrivate(ctx, u)
 	assert.Error(t, err, "IsURLPrivate with cancelled context expected error but got none")
 }
+
+func TestPublicOnlyHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// The server listens on a loopback address, so the client must not connect to it
+	res, err := PublicOnlyHTTPClient(server.Client()).Get(server.URL)
+	if err == nil {
+		res.Body.Close()
+	}
+	require.ErrorIs(t, err, ErrPrivateIPAddress)
+
+	// The source client isn't changed
+	res, err = server.Client().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/lestrrat-go/jwx/v3/jwk"
 	"gorm.io/gorm"
 
 	"github.com/pocket-id/pocket-id/backend/internal/common"
@@ -18,8 +17,9 @@ type KeyProviderOpts struct {
 
 type KeyProvider interface {
 	Init(opts KeyProviderOpts) error
-	LoadKey(ctx context.Context) (jwk.Key, error)
-	SaveKey(ctx context.Context, key jwk.Key) error
+	// LoadKeySet returns the stored key set, or nil if there's no key stored yet
+	LoadKeySet(ctx context.Context) (*KeySet, error)
+	SaveKeySet(ctx context.Context, keySet *KeySet) error
 }
 
 func GetKeyProvider(db *gorm.DB, envConfig *common.EnvConfigSchema, instanceID string) (keyProvider KeyProvider, err error) {
@@ -3,6 +3,7 @@ package jwk
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -15,7 +16,13 @@ import (
 	cryptoutils "github.com/pocket-id/pocket-id/backend/internal/utils/crypto"
 )
 
-const PrivateKeyDBKey = "jwt_private_key.json"
+const (
+	// KeySetDBKey is the key of the row in the KV table that stores the encrypted key set
+	KeySetDBKey = "jwt_key_set.json"
+	// PrivateKeyDBKey is the key of the row in the KV table that stored the single private key used by older versions
+	// It is only read when there's no key set yet, and it's deleted when the key set is saved
+	PrivateKeyDBKey = "jwt_private_key.json"
+)
 
 type KeyProviderDatabase struct {
 	db  *gorm.DB
@@ -33,79 +40,129 @@ func (f *KeyProviderDatabase) Init(opts KeyProviderOpts) error {
 	return nil
 }
 
-func (f *KeyProviderDatabase) LoadKey(ctx context.Context) (key jwk.Key, err error) {
+func (f *KeyProviderDatabase) LoadKeySet(ctx context.Context) (*KeySet, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	data, err := f.loadEncrypted(ctx, KeySetDBKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set: %w", err)
+	}
+
+	if data == nil {
+		// Fall back to the single private key stored by older versions, which becomes the active key
+		return f.loadLegacyKey(ctx)
+	}
+
+	keySet := &KeySet{}
+	err = json.Unmarshal(data, keySet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted key set: %w", err)
+	}
+
+	err = keySet.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("stored key set is invalid: %w", err)
+	}
+
+	return keySet, nil
+}
+
+func (f *KeyProviderDatabase) loadLegacyKey(ctx context.Context) (*KeySet, error) {
+	data, err := f.loadEncrypted(ctx, PrivateKeyDBKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	if data == nil {
+		// Key not present in the database - return nil so a new one can be generated
+		return nil, nil
+	}
+
+	key, err := jwk.ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %w", err)
+	}
+
+	return NewKeySet(key, time.Now()), nil
+}
+
+// loadEncrypted reads and decrypts the value of a row in the KV table
+// It returns nil if the row doesn't exist or is empty
+func (f *KeyProviderDatabase) loadEncrypted(ctx context.Context, dbKey string) ([]byte, error) {
 	row := model.KV{
-		Key: PrivateKeyDBKey,
+		Key: dbKey,
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	err = f.db.WithContext(ctx).First(&row).Error
+	err := f.db.WithContext(ctx).First(&row).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// Key not present in the database - return nil so a new one can be generated
 		return nil, nil
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to retrieve private key from the database: %w", err)
+		return nil, fmt.Errorf("failed to retrieve value from the database: %w", err)
 	}
 
 	if row.Value == nil || *row.Value == "" {
-		// Key not present in the database - return nil so a new one can be generated
 		return nil, nil
 	}
 
 	// Decode from base64
 	enc, err := base64.StdEncoding.DecodeString(*row.Value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read encrypted private key: not a valid base64-encoded value: %w", err)
+		return nil, fmt.Errorf("failed to read encrypted value: not a valid base64-encoded value: %w", err)
 	}
 
 	// Decrypt the data
 	data, err := cryptoutils.Decrypt(f.kek, enc, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
 	}
 
-	// Parse the key
-	key, err = jwk.ParseKey(data)
+	return data, nil
+}
+
+func (f *KeyProviderDatabase) SaveKeySet(ctx context.Context, keySet *KeySet) error {
+	err := keySet.Validate()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse encrypted private key: %w", err)
+		return fmt.Errorf("key set is invalid: %w", err)
 	}
 
-	return key, nil
-}
-
-func (f *KeyProviderDatabase) SaveKey(ctx context.Context, key jwk.Key) error {
-	// Encode the key to JSON
-	data, err := EncodeJWKBytes(key)
+	// Encode the key set to JSON
+	data, err := json.Marshal(keySet)
 	if err != nil {
-		return fmt.Errorf("failed to encode key to JSON: %w", err)
+		return fmt.Errorf("failed to encode key set to JSON: %w", err)
 	}
 
-	// Encrypt the key then encode to Base64
+	// Encrypt the key set then encode to Base64
 	enc, err := cryptoutils.Encrypt(f.kek, data, nil)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt key: %w", err)
+		return fmt.Errorf("failed to encrypt key set: %w", err)
 	}
-	// Save to database
 	row := model.KV{
-		Key:   PrivateKeyDBKey,
+		Key:   KeySetDBKey,
 		Value: new(base64.StdEncoding.EncodeToString(enc)),
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	err = f.db.
-		WithContext(ctx).
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "key"}},
-			DoUpdates: clause.AssignmentColumns([]string{"value"}),
-		}).
-		Create(&row).
-		Error
+	err = f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value"}),
+			}).
+			Create(&row).
+			Error
+		if err != nil {
+			return err
+		}
+
+		// The legacy private key is now part of the key set
+		return tx.Delete(&model.KV{}, "key = ?", PrivateKeyDBKey).Error
+	})
 	if err != nil {
-		// There's one scenario where if Pocket ID is started fresh with more than 1 replica, they both could be trying to create the private key in the database at the same time
-		// In this case, only one of the replicas will succeed; the other one(s) will return an error here, which will cascade down and cause the replica(s) to crash and be restarted (at that point they'll load the then-existing key from the database)
-		return fmt.Errorf("failed to store private key in database: %w", err)
+		// There's one scenario where if Pocket ID is started fresh with more than 1 replica, they both could be trying to create the key set in the database at the same time
+		// In this case, only one of the replicas will succeed; the other one(s) will return an error here, which will cascade down and cause the replica(s) to crash and be restarted (at that point they'll load the then-existing key set from the database)
+		return fmt.Errorf("failed to store key set in database: %w", err)
 	}
 
 	return nil
@@ -5,11 +5,14 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 
 	"github.com/pocket-id/pocket-id/backend/internal/model"
 	cryptoutils "github.com/pocket-id/pocket-id/backend/internal/utils/crypto"
@@ -39,15 +42,11 @@ func TestKeyProviderDatabase_Init(t *testing.T) {
 	})
 }
 
-func TestKeyProviderDatabase_LoadKey(t *testing.T) {
+func TestKeyProviderDatabase_LoadKeySet(t *testing.T) {
 	// Generate a test key to use in our tests
-	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	require.NoError(t, err)
+	key := generateTestKey(t)
 
-	key, err := jwk.Import(pk)
-	require.NoError(t, err)
-
-	t.Run("LoadKey with no existing key", func(t *testing.T) {
+	t.Run("LoadKeySet with no existing key", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -58,13 +57,13 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Load key when none exists
-		loadedKey, err := provider.LoadKey(t.Context())
+		// Load key set when none exists
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
 		require.NoError(t, err)
-		assert.Nil(t, loadedKey, "Expected nil key when no key exists in database")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when no key exists in database")
 	})
 
-	t.Run("LoadKey with existing key", func(t *testing.T) {
+	t.Run("LoadKeySet with existing key set", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -75,26 +74,50 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Save a key
-		err = provider.SaveKey(t.Context(), key)
+		// Save a key set with an active and a next key
+		now := time.Now().Truncate(time.Second)
+		keySet := NewKeySet(key, now)
+		nextKey := generateTestKey(t)
+		keySet.Stage(nextKey, now)
+		err = provider.SaveKeySet(t.Context(), keySet)
 		require.NoError(t, err)
 
-		// Load the key
-		loadedKey, err := provider.LoadKey(t.Context())
+		// Load the key set
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
 		require.NoError(t, err)
-		assert.NotNil(t, loadedKey, "Expected non-nil key when key exists in database")
+		require.NotNil(t, loadedKeySet, "Expected non-nil key set when key set exists in database")
+		require.Len(t, loadedKeySet.Keys, 2)
 
-		// Verify the loaded key is the same as the original
-		keyBytes, err := EncodeJWKBytes(key)
+		// Verify the loaded keys are the same as the original ones
+		assertSameKey(t, key, loadedKeySet.Active().Key)
+		assertSameKey(t, nextKey, loadedKeySet.Next().Key)
+		assert.True(t, now.Equal(*loadedKeySet.Active().ActivatedAt), "Expected activation time to be preserved")
+	})
+
+	t.Run("LoadKeySet with legacy private key", func(t *testing.T) {
+		db := testutils.NewDatabaseForTest(t)
+		kek := generateTestKEK(t)
+
+		provider := &KeyProviderDatabase{}
+		err := provider.Init(KeyProviderOpts{
+			DB:  db,
+			Kek: kek,
+		})
 		require.NoError(t, err)
 
-		loadedKeyBytes, err := EncodeJWKBytes(loadedKey)
+		keyBytes, err := EncodeJWKBytes(key)
 		require.NoError(t, err)
+		saveEncryptedValue(t, db, kek, PrivateKeyDBKey, keyBytes)
 
-		assert.Equal(t, keyBytes, loadedKeyBytes, "Expected loaded key to match original key")
+		// The legacy key is loaded as the active key
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
+		require.NoError(t, err)
+		require.NotNil(t, loadedKeySet)
+		require.Len(t, loadedKeySet.Keys, 1)
+		assertSameKey(t, key, loadedKeySet.Active().Key)
 	})
 
-	t.Run("LoadKey with invalid base64", func(t *testing.T) {
+	t.Run("LoadKeySet with invalid base64", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -107,19 +130,19 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 
 		// Insert invalid base64 data
 		err = db.Create(&model.KV{
-			Key:   PrivateKeyDBKey,
+			Key:   KeySetDBKey,
 			Value: new("not-valid-base64"),
 		}).Error
 		require.NoError(t, err)
 
-		// Attempt to load the key
-		loadedKey, err := provider.LoadKey(t.Context())
-		require.Error(t, err, "Expected error when loading key with invalid base64")
+		// Attempt to load the key set
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
+		require.Error(t, err, "Expected error when loading key set with invalid base64")
 		require.ErrorContains(t, err, "not a valid base64-encoded value")
-		assert.Nil(t, loadedKey, "Expected nil key when loading fails")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when loading fails")
 	})
 
-	t.Run("LoadKey with invalid encrypted data", func(t *testing.T) {
+	t.Run("LoadKeySet with invalid encrypted data", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -137,18 +160,18 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		}).Error
 		require.NoError(t, err)
 
-		// Attempt to load the key
-		loadedKey, err := provider.LoadKey(t.Context())
+		// Attempt to load the key set
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
 		require.Error(t, err, "Expected error when loading key with invalid encrypted data")
 		require.ErrorContains(t, err, "failed to decrypt")
-		assert.Nil(t, loadedKey, "Expected nil key when loading fails")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when loading fails")
 	})
 
-	t.Run("LoadKey with valid encrypted data but wrong KEK", func(t *testing.T) {
+	t.Run("LoadKeySet with valid encrypted data but wrong KEK", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		originalKek := generateTestKEK(t)
 
-		// Save a key with the original KEK
+		// Save a key set with the original KEK
 		originalProvider := &KeyProviderDatabase{}
 		err := originalProvider.Init(KeyProviderOpts{
 			DB:  db,
@@ -156,7 +179,7 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		err = originalProvider.SaveKey(t.Context(), key)
+		err = originalProvider.SaveKeySet(t.Context(), NewKeySet(key, time.Now()))
 		require.NoError(t, err)
 
 		// Now try to load with a different KEK
@@ -168,14 +191,14 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Attempt to load the key with the wrong KEK
-		loadedKey, err := differentProvider.LoadKey(t.Context())
-		require.Error(t, err, "Expected error when loading key with wrong KEK")
+		// Attempt to load the key set with the wrong KEK
+		loadedKeySet, err := differentProvider.LoadKeySet(t.Context())
+		require.Error(t, err, "Expected error when loading key set with wrong KEK")
 		require.ErrorContains(t, err, "failed to decrypt")
-		assert.Nil(t, loadedKey, "Expected nil key when loading fails")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when loading fails")
 	})
 
-	t.Run("LoadKey with invalid key data", func(t *testing.T) {
+	t.Run("LoadKeySet with invalid key data", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -186,37 +209,44 @@ func TestKeyProviderDatabase_LoadKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Create invalid key data (valid JSON but not a valid JWK)
-		invalidKeyData := []byte(`{"not": "a valid jwk"}`)
+		// Save invalid key data (valid JSON but not a valid JWK)
+		saveEncryptedValue(t, db, kek, KeySetDBKey, []byte(`{"keys": [{"key": {"not": "a valid jwk"}, "state": "active"}]}`))
 
-		// Encrypt the invalid key data
-		encryptedData, err := cryptoutils.Encrypt(kek, invalidKeyData, nil)
+		// Attempt to load the key set
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
+		require.Error(t, err, "Expected error when loading invalid key data")
+		require.ErrorContains(t, err, "failed to parse")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when loading fails")
+	})
+
+	t.Run("LoadKeySet with key set without active key", func(t *testing.T) {
+		db := testutils.NewDatabaseForTest(t)
+		kek := generateTestKEK(t)
+
+		provider := &KeyProviderDatabase{}
+		err := provider.Init(KeyProviderOpts{
+			DB:  db,
+			Kek: kek,
+		})
 		require.NoError(t, err)
 
-		// Save to database
-		err = db.Create(&model.KV{
-			Key:   PrivateKeyDBKey,
-			Value: new(base64.StdEncoding.EncodeToString(encryptedData)),
-		}).Error
+		keyBytes, err := EncodeJWKBytes(key)
 		require.NoError(t, err)
+		saveEncryptedValue(t, db, kek, KeySetDBKey, []byte(`{"keys": [{"key": `+string(keyBytes)+`, "state": "retired"}]}`))
 
-		// Attempt to load the key
-		loadedKey, err := provider.LoadKey(t.Context())
-		require.Error(t, err, "Expected error when loading invalid key data")
-		require.ErrorContains(t, err, "failed to parse")
-		assert.Nil(t, loadedKey, "Expected nil key when loading fails")
+		// Attempt to load the key set
+		loadedKeySet, err := provider.LoadKeySet(t.Context())
+		require.Error(t, err, "Expected error when loading a key set without active key")
+		require.ErrorContains(t, err, "exactly one active key")
+		assert.Nil(t, loadedKeySet, "Expected nil key set when loading fails")
 	})
 }
 
-func TestKeyProviderDatabase_SaveKey(t *testing.T) {
+func TestKeyProviderDatabase_SaveKeySet(t *testing.T) {
 	// Generate a test key to use in our tests
-	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	require.NoError(t, err)
-
-	key, err := jwk.Import(pk)
-	require.NoError(t, err)
+	key := generateTestKey(t)
 
-	t.Run("SaveKey and verify database record", func(t *testing.T) {
+	t.Run("SaveKeySet and verify database record", func(t *testing.T) {
 		db := testutils.NewDatabaseForTest(t)
 		kek := generateTestKEK(t)
 
@@ -227,14 +257,17 @@ func TestKeyProviderDatabase_SaveKey(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Save the key
-		err = provider.SaveKey(t.Context(), key)
-		require.NoError(t, err, "Expected no error when saving key")
+		// Store a legacy key, which must be removed when the key set is saved
+		saveEncryptedValue(t, db, kek, PrivateKeyDBKey, []byte("{}"))
+
+		// Save the key set
+		err = provider.SaveKeySet(t.Context(), NewKeySet(key, time.Now()))
+		require.NoError(t, err, "Expected no error when saving key set")
 
 		// Verify record exists in database
 		var kv model.KV
-		err = db.Where("key = ?", PrivateKeyDBKey).First(&kv).Error
-		require.NoError(t, err, "Expected to find key in database")
+		err = db.Where("key = ?", KeySetDBKey).First(&kv).Error
+		require.NoError(t, err, "Expected to find key set in database")
 		require.NotNil(t, kv.Value, "Expected non-nil value in database")
 		assert.NotEmpty(t, *kv.Value, "Expected non-empty value in database")
 
@@ -245,20 +278,71 @@ func TestKeyProviderDatabase_SaveKey(t *testing.T) {
 		decBytes, err := cryptoutils.Decrypt(kek, encBytes, nil)
 		require.NoError(t, err, "Expected valid encrypted data")
 
-		parsedKey, err := jwk.ParseKey(decBytes)
-		require.NoError(t, err, "Expected valid JWK data")
+		var parsedKeySet KeySet
+		err = json.Unmarshal(decBytes, &parsedKeySet)
+		require.NoError(t, err, "Expected valid key set data")
+		require.Len(t, parsedKeySet.Keys, 1)
+		assertSameKey(t, key, parsedKeySet.Keys[0].Key)
 
-		// Compare keys
-		keyBytes, err := EncodeJWKBytes(key)
+		// The legacy key was removed
+		var count int64
+		err = db.Model(&model.KV{}).Where("key = ?", PrivateKeyDBKey).Count(&count).Error
 		require.NoError(t, err)
+		assert.Zero(t, count, "Expected legacy private key to be removed")
+	})
+
+	t.Run("SaveKeySet rejects invalid key set", func(t *testing.T) {
+		db := testutils.NewDatabaseForTest(t)
 
-		parsedKeyBytes, err := EncodeJWKBytes(parsedKey)
+		provider := &KeyProviderDatabase{}
+		err := provider.Init(KeyProviderOpts{
+			DB:  db,
+			Kek: generateTestKEK(t),
+		})
 		require.NoError(t, err)
 
-		assert.Equal(t, keyBytes, parsedKeyBytes, "Expected saved key to match original key")
+		err = provider.SaveKeySet(t.Context(), &KeySet{})
+		require.Error(t, err)
+		require.ErrorContains(t, err, "exactly one active key")
 	})
 }
 
+func saveEncryptedValue(t *testing.T, db *gorm.DB, kek []byte, dbKey string, data []byte) {
+	t.Helper()
+
+	encryptedData, err := cryptoutils.Encrypt(kek, data, nil)
+	require.NoError(t, err)
+
+	err = db.Create(&model.KV{
+		Key:   dbKey,
+		Value: new(base64.StdEncoding.EncodeToString(encryptedData)),
+	}).Error
+	require.NoError(t, err)
+}
+
+func assertSameKey(t *testing.T, expected jwk.Key, actual jwk.Key) {
+	t.Helper()
+
+	expectedBytes, err := EncodeJWKBytes(expected)
+	require.NoError(t, err)
+
+	actualBytes, err := EncodeJWKBytes(actual)
+	require.NoError(t, err)
+
+	assert.Equal(t, expectedBytes, actualBytes, "Expected keys to match")
+}
+
+func generateTestKey(t *testing.T) jwk.Key {
+	t.Helper()
+
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	key, err := ImportRawKey(pk, "", "")
+	require.NoError(t, err)
+	return key
+}
+
 func generateTestKEK(t *testing.T) []byte {
 	t.Helper()
 
@@ -0,0 +1,220 @@
+package jwk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// KeyState is the lifecycle state of a signing key in a KeySet
+type KeyState string
+
+const (
+	// KeyStateNext is a key that is published in the JWKS, but not used for signing yet
+	// This gives relying parties the time to fetch it before the first token signed with it is issued
+	KeyStateNext KeyState = "next"
+	// KeyStateActive is the key that is used to sign new tokens
+	KeyStateActive KeyState = "active"
+	// KeyStateRetired is a key that isn't used for signing anymore, but that is still published until the tokens signed with it expire
+	KeyStateRetired KeyState = "retired"
+)
+
+// SigningKey is a private key in a KeySet, together with its lifecycle metadata
+type SigningKey struct {
+	Key         jwk.Key
+	State       KeyState
+	CreatedAt   time.Time
+	ActivatedAt *time.Time
+	RetiredAt   *time.Time
+	// ExpiresAt is the time after which a retired key is removed from the set
+	ExpiresAt *time.Time
+}
+
+// KeyID returns the "kid" of the key
+func (k *SigningKey) KeyID() string {
+	kid, _ := k.Key.KeyID()
+	return kid
+}
+
+// IsExpired returns true if the key is retired and shouldn't be published anymore
+func (k *SigningKey) IsExpired(now time.Time) bool {
+	return k.State == KeyStateRetired && k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+type signingKeyJSON struct {
+	Key         json.RawMessage `json:"key"`
+	State       KeyState        `json:"state"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	ActivatedAt *time.Time      `json:"activatedAt,omitempty"`
+	RetiredAt   *time.Time      `json:"retiredAt,omitempty"`
+	ExpiresAt   *time.Time      `json:"expiresAt,omitempty"`
+}
+
+func (k SigningKey) MarshalJSON() ([]byte, error) {
+	keyBytes, err := EncodeJWKBytes(k.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	return json.Marshal(signingKeyJSON{
+		Key:         keyBytes,
+		State:       k.State,
+		CreatedAt:   k.CreatedAt,
+		ActivatedAt: k.ActivatedAt,
+		RetiredAt:   k.RetiredAt,
+		ExpiresAt:   k.ExpiresAt,
+	})
+}
+
+func (k *SigningKey) UnmarshalJSON(data []byte) error {
+	var raw signingKeyJSON
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	key, err := jwk.ParseKey(raw.Key)
+	if err != nil {
+		return fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	*k = SigningKey{
+		Key:         key,
+		State:       raw.State,
+		CreatedAt:   raw.CreatedAt,
+		ActivatedAt: raw.ActivatedAt,
+		RetiredAt:   raw.RetiredAt,
+		ExpiresAt:   raw.ExpiresAt,
+	}
+	return nil
+}
+
+// KeySet is the set of token signing keys
+// It contains exactly one active key, at most one next key, and any number of retired keys
+type KeySet struct {
+	Keys []*SigningKey `json:"keys"`
+}
+
+// NewKeySet returns a key set with the given key as active key
+func NewKeySet(key jwk.Key, now time.Time) *KeySet {
+	return &KeySet{
+		Keys: []*SigningKey{{
+			Key:         key,
+			State:       KeyStateActive,
+			CreatedAt:   now,
+			ActivatedAt: &now,
+		}},
+	}
+}
+
+// Validate checks that the set contains exactly one active key and at most one next key
+func (s *KeySet) Validate() error {
+	var active, next int
+	kids := make(map[string]struct{}, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Key == nil {
+			return errors.New("key set contains an empty key")
+		}
+
+		kid := k.KeyID()
+		if _, ok := kids[kid]; ok {
+			return fmt.Errorf("key set contains duplicate key ID '%s'", kid)
+		}
+		kids[kid] = struct{}{}
+
+		switch k.State {
+		case KeyStateActive:
+			active++
+		case KeyStateNext:
+			next++
+		case KeyStateRetired:
+			// Nothing to check
+		default:
+			return fmt.Errorf("key '%s' has invalid state '%s'", kid, k.State)
+		}
+	}
+
+	if active != 1 {
+		return fmt.Errorf("key set must contain exactly one active key, but it contains %d", active)
+	}
+	if next > 1 {
+		return fmt.Errorf("key set must contain at most one next key, but it contains %d", next)
+	}
+
+	return nil
+}
+
+// Active returns the key used to sign new tokens
+func (s *KeySet) Active() *SigningKey {
+	return s.findByState(KeyStateActive)
+}
+
+// Next returns the key that will become active on the next rotation, if any
+func (s *KeySet) Next() *SigningKey {
+	return s.findByState(KeyStateNext)
+}
+
+func (s *KeySet) findByState(state KeyState) *SigningKey {
+	for _, k := range s.Keys {
+		if k.State == state {
+			return k
+		}
+	}
+	return nil
+}
+
+// Published returns all keys that are not expired, which are the keys that must be published in the JWKS
+func (s *KeySet) Published(now time.Time) []*SigningKey {
+	published := make([]*SigningKey, 0, len(s.Keys))
+	for _, k := range s.Keys {
+		if !k.IsExpired(now) {
+			published = append(published, k)
+		}
+	}
+	return published
+}
+
+// Stage adds a key as next key, replacing the current next key if there's one
+func (s *KeySet) Stage(key jwk.Key, now time.Time) {
+	s.Keys = slices.DeleteFunc(s.Keys, func(k *SigningKey) bool {
+		return k.State == KeyStateNext
+	})
+	s.Keys = append(s.Keys, &SigningKey{
+		Key:       key,
+		State:     KeyStateNext,
+		CreatedAt: now,
+	})
+}
+
+// Promote makes the next key the active one
+// The previously-active key is retired, and it remains in the set until the retention has passed
+func (s *KeySet) Promote(now time.Time, retention time.Duration) error {
+	next := s.Next()
+	if next == nil {
+		return errors.New("key set does not contain a next key")
+	}
+
+	if active := s.Active(); active != nil {
+		active.State = KeyStateRetired
+		active.RetiredAt = &now
+		active.ExpiresAt = new(now.Add(retention))
+	}
+
+	next.State = KeyStateActive
+	next.ActivatedAt = &now
+
+	return nil
+}
+
+// Prune removes the expired keys from the set, and returns true if any key was removed
+func (s *KeySet) Prune(now time.Time) bool {
+	l := len(s.Keys)
+	s.Keys = slices.DeleteFunc(s.Keys, func(k *SigningKey) bool {
+		return k.IsExpired(now)
+	})
+	return len(s.Keys) != l
+}
@@ -0,0 +1,81 @@
+package jwk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet_Rotation(t *testing.T) {
+	now := time.Now()
+	activeKey := generateTestKey(t)
+	keySet := NewKeySet(activeKey, now)
+	require.NoError(t, keySet.Validate())
+
+	t.Run("Promote fails without next key", func(t *testing.T) {
+		err := keySet.Promote(now, time.Hour)
+		require.Error(t, err)
+		assert.Equal(t, KeyStateActive, keySet.Active().State)
+	})
+
+	t.Run("Stage replaces the existing next key", func(t *testing.T) {
+		keySet.Stage(generateTestKey(t), now)
+		nextKey := generateTestKey(t)
+		keySet.Stage(nextKey, now)
+
+		require.NoError(t, keySet.Validate())
+		require.Len(t, keySet.Keys, 2)
+		assertSameKey(t, nextKey, keySet.Next().Key)
+		assertSameKey(t, activeKey, keySet.Active().Key)
+	})
+
+	t.Run("Promote retires the active key", func(t *testing.T) {
+		nextKey := keySet.Next().Key
+		require.NoError(t, keySet.Promote(now, time.Hour))
+
+		require.NoError(t, keySet.Validate())
+		assertSameKey(t, nextKey, keySet.Active().Key)
+		assert.Nil(t, keySet.Next())
+
+		retired := keySet.Keys[0]
+		assert.Equal(t, KeyStateRetired, retired.State)
+		require.NotNil(t, retired.ExpiresAt)
+		assert.Equal(t, now.Add(time.Hour), *retired.ExpiresAt)
+	})
+
+	t.Run("Retired keys are published until they expire", func(t *testing.T) {
+		assert.Len(t, keySet.Published(now.Add(59*time.Minute)), 2)
+		assert.Len(t, keySet.Published(now.Add(time.Hour)), 1)
+
+		assert.False(t, keySet.Prune(now.Add(59*time.Minute)))
+		assert.True(t, keySet.Prune(now.Add(time.Hour)))
+		require.Len(t, keySet.Keys, 1)
+		assert.Equal(t, KeyStateActive, keySet.Keys[0].State)
+	})
+}
+
+func TestKeySet_Validate(t *testing.T) {
+	now := time.Now()
+
+	t.Run("rejects multiple active keys", func(t *testing.T) {
+		keySet := NewKeySet(generateTestKey(t), now)
+		keySet.Keys = append(keySet.Keys, NewKeySet(generateTestKey(t), now).Keys...)
+		require.ErrorContains(t, keySet.Validate(), "exactly one active key")
+	})
+
+	t.Run("rejects duplicate key IDs", func(t *testing.T) {
+		key := generateTestKey(t)
+		keySet := NewKeySet(key, now)
+		keySet.Stage(key, now)
+		require.ErrorContains(t, keySet.Validate(), "duplicate key ID")
+	})
+
+	t.Run("rejects unknown states", func(t *testing.T) {
+		keySet := NewKeySet(generateTestKey(t), now)
+		keySet.Stage(generateTestKey(t), now)
+		keySet.Next().State = "unknown"
+		require.ErrorContains(t, keySet.Validate(), "invalid state")
+	})
+}
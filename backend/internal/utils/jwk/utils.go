@@ -25,6 +25,8 @@ import (
 const (
 	// KeyUsageSigning is the usage for the private keys, for the "use" property
 	KeyUsageSigning = "sig"
+	// KeyUsageEncryption is the usage for keys that clients encrypt data with, for the "use" property
+	KeyUsageEncryption = "enc"
 )
 
 // EncodeJWK encodes a jwk.Key to a writable stream.
@@ -155,6 +155,12 @@ func (h *handler) updateCredential(c *gin.Context) {
 }
 
 func (h *handler) logout(c *gin.Context) {
+	err := h.service.Logout(c.Request.Context(), c.GetString("userID"), c.GetString("sessionID"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
 	cookie.AddAccessTokenCookie(c, 0, "")
 	c.Status(http.StatusNoContent)
 }
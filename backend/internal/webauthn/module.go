@@ -12,11 +12,15 @@ import (
 )
 
 type TokenService interface {
-	GenerateAccessToken(user model.User, authenticationMethod string) (string, error)
 	VerifyAccessToken(tokenString string) (jwt.Token, error)
 	GetAuthenticationMethod(token jwt.Token) (string, error)
 }
 
+type SessionManager interface {
+	CreateSession(ctx context.Context, tx *gorm.DB, user model.User, authenticationMethod, ipAddress, userAgent string) (string, error)
+	Logout(ctx context.Context, userID, sessionID string) error
+}
+
 type AuditLogger interface {
 	Create(ctx context.Context, event model.AuditLogEvent, ipAddress, userAgent, userID string, data model.AuditLogData, tx *gorm.DB) (model.AuditLog, bool)
 	CreateNewSignInWithEmail(ctx context.Context, ipAddress, userAgent, userID string, tx *gorm.DB) model.AuditLog
@@ -31,6 +35,7 @@ type Dependencies struct {
 	AppURL string
 
 	Signer    TokenService
+	Sessions  SessionManager
 	AuditLog  AuditLogger
 	AppConfig AppConfigProvider
 }
@@ -27,6 +27,7 @@ type Service struct {
 	db        *gorm.DB
 	webAuthn  *gowebauthn.WebAuthn
 	signer    TokenService
+	sessions  SessionManager
 	auditLog  AuditLogger
 	appConfig AppConfigProvider
 }
@@ -60,6 +61,7 @@ func newService(deps Dependencies) (*Service, error) {
 		db:        deps.DB,
 		webAuthn:  wa,
 		signer:    deps.Signer,
+		sessions:  deps.Sessions,
 		auditLog:  deps.AuditLog,
 		appConfig: deps.AppConfig,
 	}, nil
@@ -270,7 +272,7 @@ func (s *Service) VerifyLogin(ctx context.Context, sessionID string, credentialA
 		return model.User{}, "", &common.UserDisabledError{}
 	}
 
-	token, err := s.signer.GenerateAccessToken(*user, authenticationMethodPhishingResistant)
+	token, err := s.sessions.CreateSession(ctx, tx, *user, authenticationMethodPhishingResistant, ipAddress, userAgent)
 	if err != nil {
 		return model.User{}, "", err
 	}
@@ -285,6 +287,14 @@ func (s *Service) VerifyLogin(ctx context.Context, sessionID string, credentialA
 	return *user, token, nil
 }
 
+// Logout ends the browser session of the user, if the request was authenticated with one
+func (s *Service) Logout(ctx context.Context, userID, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return s.sessions.Logout(ctx, userID, sessionID)
+}
+
 func (s *Service) ListCredentials(ctx context.Context, userID string) ([]model.WebauthnCredential, error) {
 	var credentials []model.WebauthnCredential
 	err := s.db.
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+type webhookInputDto struct {
+	Name   string   `json:"name" binding:"required,max=128" unorm:"nfc"`
+	URL    string   `json:"url" binding:"required,max=2048"`
+	Events []string `json:"events" binding:"dive,min=1"`
+	// Secret is generated when a webhook is created without one, and kept when a webhook is updated without one
+	Secret  string `json:"secret" binding:"omitempty,min=16,max=256"`
+	Enabled bool   `json:"enabled"`
+}
+
+type webhookDto struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Events    []string          `json:"events"`
+	Secret    string            `json:"secret"`
+	Enabled   bool              `json:"enabled"`
+	CreatedAt datatype.DateTime `json:"createdAt"`
+}
+
+type deliveryDto struct {
+	ID             string             `json:"id"`
+	EventID        string             `json:"eventId"`
+	Event          string             `json:"event"`
+	Payload        string             `json:"payload"`
+	Status         string             `json:"status"`
+	Attempts       int                `json:"attempts"`
+	LastError      string             `json:"lastError"`
+	ResponseStatus *int               `json:"responseStatus"`
+	NextAttemptAt  datatype.DateTime  `json:"nextAttemptAt"`
+	DeliveredAt    *datatype.DateTime `json:"deliveredAt"`
+	CreatedAt      datatype.DateTime  `json:"createdAt"`
+}
@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pocket-id/pocket-id/backend/internal/dto"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler {
+	return &handler{service: service}
+}
+
+// list godoc
+// @Summary List webhooks
+// @Description Get a paginated list of the endpoints that are notified about events
+// @Tags Webhooks
+// @Param search query string false "Search term to filter webhooks by name or URL"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[webhookDto]
+// @Router /api/webhooks [get]
+func (h *handler) list(c *gin.Context) {
+	searchTerm := c.Query("search")
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	webhooks, pagination, err := h.service.ListWebhooks(c.Request.Context(), searchTerm, listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var webhooksDto []webhookDto
+	if err := dto.MapStructList(webhooks, &webhooksDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[webhookDto]{
+		Data:       webhooksDto,
+		Pagination: pagination,
+	})
+}
+
+// listEvents godoc
+// @Summary List webhook events
+// @Description Get the events webhooks can subscribe to
+// @Tags Webhooks
+// @Success 200 {array} string
+// @Router /api/webhooks/events [get]
+func (h *handler) listEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, Events())
+}
+
+// get godoc
+// @Summary Get webhook
+// @Description Get a webhook by ID
+// @Tags Webhooks
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} webhookDto
+// @Router /api/webhooks/{id} [get]
+func (h *handler) get(c *gin.Context) {
+	webhook, err := h.service.GetWebhook(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto webhookDto
+	if err := dto.MapStruct(webhook, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// create godoc
+// @Summary Create webhook
+// @Description Create an endpoint that is notified about the events it subscribes to. A signing secret is generated if none is given.
+// @Tags Webhooks
+// @Param webhook body webhookInputDto true "Webhook information"
+// @Success 201 {object} webhookDto "Created webhook"
+// @Router /api/webhooks [post]
+func (h *handler) create(c *gin.Context) {
+	var input webhookInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto webhookDto
+	if err := dto.MapStruct(webhook, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, responseDto)
+}
+
+// update godoc
+// @Summary Update webhook
+// @Description Update a webhook by ID. The signing secret is kept if none is given.
+// @Tags Webhooks
+// @Param id path string true "Webhook ID"
+// @Param webhook body webhookInputDto true "Webhook information"
+// @Success 200 {object} webhookDto "Updated webhook"
+// @Router /api/webhooks/{id} [put]
+func (h *handler) update(c *gin.Context) {
+	var input webhookInputDto
+	if err := dto.ShouldBindWithNormalizedJSON(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	webhook, err := h.service.UpdateWebhook(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var responseDto webhookDto
+	if err := dto.MapStruct(webhook, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseDto)
+}
+
+// delete godoc
+// @Summary Delete webhook
+// @Description Delete a webhook and its deliveries by ID
+// @Tags Webhooks
+// @Param id path string true "Webhook ID"
+// @Success 204 "No Content"
+// @Router /api/webhooks/{id} [delete]
+func (h *handler) delete(c *gin.Context) {
+	if err := h.service.DeleteWebhook(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Get a paginated list of the deliveries of a webhook
+// @Tags Webhooks
+// @Param id path string true "Webhook ID"
+// @Param pagination[page] query int false "Page number for pagination" default(1)
+// @Param pagination[limit] query int false "Number of items per page" default(20)
+// @Param sort[column] query string false "Column to sort by"
+// @Param sort[direction] query string false "Sort direction (asc or desc)" default("asc")
+// @Success 200 {object} dto.Paginated[deliveryDto]
+// @Router /api/webhooks/{id}/deliveries [get]
+func (h *handler) listDeliveries(c *gin.Context) {
+	listRequestOptions := utils.ParseListRequestOptions(c)
+
+	deliveries, pagination, err := h.service.ListDeliveries(c.Request.Context(), c.Param("id"), listRequestOptions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var deliveriesDto []deliveryDto
+	if err := dto.MapStructList(deliveries, &deliveriesDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.Paginated[deliveryDto]{
+		Data:       deliveriesDto,
+		Pagination: pagination,
+	})
+}
+
+// redeliver godoc
+// @Summary Redeliver webhook event
+// @Description Deliver the event of a delivery to the webhook again. The redelivery has the same event ID and payload.
+// @Tags Webhooks
+// @Param id path string true "Webhook ID"
+// @Param deliveryId path string true "Delivery ID"
+// @Success 201 {object} deliveryDto "Created delivery"
+// @Router /api/webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (h *handler) redeliver(c *gin.Context) {
+	delivery, err := h.service.Redeliver(c.Request.Context(), c.Param("id"), c.Param("deliveryId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.service.ScheduleDelivery()
+
+	var responseDto deliveryDto
+	if err := dto.MapStruct(delivery, &responseDto); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, responseDto)
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"slices"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+)
+
+// Webhook is an endpoint that is notified about the events it subscribed to
+type Webhook struct {
+	model.Base
+
+	Name string `sortable:"true"`
+	URL  string `sortable:"true"`
+	// Events are the events the endpoint is notified about, it's notified about every event if it's empty
+	Events datatype.StringList
+	// Secret is the key the deliveries are signed with
+	Secret  datatype.EncryptedString
+	Enabled bool `sortable:"true"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// subscribedTo returns whether the webhook is notified about the event
+func (w Webhook) subscribedTo(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is an event that has to be delivered to a webhook.
+// The payload is stored when the event occurs, so retries and redeliveries send the same body.
+type Delivery struct {
+	model.Base
+
+	WebhookID string
+	Webhook   Webhook
+	// EventID is shared by the deliveries of the same event, so receivers can detect redeliveries
+	EventID string
+	Event   string `sortable:"true" filterable:"true"`
+	Payload string
+
+	Status         DeliveryStatus `sortable:"true" filterable:"true"`
+	Attempts       int
+	LastError      string
+	ResponseStatus *int
+	NextAttemptAt  datatype.DateTime
+	DeliveredAt    *datatype.DateTime `sortable:"true"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+)
+
+type Dependencies struct {
+	DB         *gorm.DB
+	HTTPClient *http.Client
+}
+
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(deps.DB, deps.HTTPClient)
+	return &Module{
+		service: service,
+		handler: newHandler(service),
+	}
+}
+
+// RegisterRoutes mounts the admin endpoints to manage webhooks and their deliveries
+func (m *Module) RegisterRoutes(apiGroup *gin.RouterGroup, adminAuth gin.HandlerFunc) {
+	group := apiGroup.Group("/webhooks", adminAuth)
+	group.GET("", m.handler.list)
+	group.POST("", m.handler.create)
+	group.GET("/events", m.handler.listEvents)
+	group.GET("/:id", m.handler.get)
+	group.PUT("/:id", m.handler.update)
+	group.DELETE("/:id", m.handler.delete)
+	group.GET("/:id/deliveries", m.handler.listDeliveries)
+	group.POST("/:id/deliveries/:deliveryId/redeliver", m.handler.redeliver)
+}
+
+// NotifyAuditLog records a delivery of the audit log event for every webhook that subscribed to it.
+// It has to be called in the transaction the audit log is created in, the deliveries are picked up by the job once
+// the transaction has been committed.
+func (m *Module) NotifyAuditLog(ctx context.Context, tx *gorm.DB, auditLog model.AuditLog) error {
+	return m.service.NotifyAuditLog(ctx, tx, auditLog)
+}
+
+// RecordAdminMutation notifies the webhooks about a request an admin made to change something.
+// It's called by the authentication middleware after the request has been handled successfully.
+func (m *Module) RecordAdminMutation(c *gin.Context) {
+	var params map[string]string
+	if len(c.Params) > 0 {
+		params = make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			params[param.Key] = param.Value
+		}
+	}
+
+	err := m.service.NotifyAdminMutation(c.Request.Context(), adminMutationEventData{
+		ActorID:   c.GetString("userID"),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Path:      c.Request.URL.Path,
+		Params:    params,
+		Status:    c.Writer.Status(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record webhook deliveries of admin mutation", slog.Any("error", err))
+	}
+}
+
+// DeliverPending delivers the events whose next delivery attempt is due
+func (m *Module) DeliverPending(ctx context.Context) error {
+	return m.service.DeliverPending(ctx)
+}
@@ -0,0 +1,540 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	"github.com/pocket-id/pocket-id/backend/internal/utils"
+)
+
+const (
+	// EventAdminMutation is the event of a successful change an admin made through the API
+	EventAdminMutation = "ADMIN_MUTATION"
+
+	signatureHeader = "X-Pocket-ID-Signature"
+	timestampHeader = "X-Pocket-ID-Timestamp"
+	eventHeader     = "X-Pocket-ID-Event"
+	deliveryHeader  = "X-Pocket-ID-Delivery"
+
+	secretLength      = 32
+	deliveryTimeout   = 10 * time.Second
+	deliveryBatchSize = 100
+	// Events of audit logs are delivered after this delay, as they can only be delivered once the transaction they
+	// were recorded in has been committed. Events whose transaction takes longer are picked up by the job.
+	auditLogDeliveryDelay = 2 * time.Second
+	// A delivery is given up after this many attempts, which spans about 3 hours with the retry delays below
+	deliveryMaxAttempts = 10
+	deliveryRetryDelay  = 30 * time.Second
+	deliveryMaxDelay    = time.Hour
+	// Delivered and failed deliveries are kept for this long, so they can be looked up and redelivered
+	deliveryRetention = 7 * 24 * time.Hour
+)
+
+// Service holds the business logic for managing webhooks and delivering events to them.
+// Events are recorded as deliveries in the database first and delivered afterwards, failed deliveries are retried
+// by a job.
+type Service struct {
+	db         *gorm.DB
+	httpClient *http.Client
+
+	// delivering prevents concurrent deliveries of the same events
+	delivering sync.Mutex
+}
+
+func newService(db *gorm.DB, httpClient *http.Client) *Service {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Service{db: db, httpClient: httpClient}
+}
+
+// Events returns the events webhooks can subscribe to
+func Events() []string {
+	events := make([]string, 0, len(model.AuditLogEvents)+1)
+	for _, event := range model.AuditLogEvents {
+		events = append(events, string(event))
+	}
+	return append(events, EventAdminMutation)
+}
+
+func (s *Service) ListWebhooks(ctx context.Context, search string, listRequestOptions utils.ListRequestOptions) ([]Webhook, utils.PaginationResponse, error) {
+	query := s.db.
+		WithContext(ctx).
+		Model(&Webhook{})
+
+	if search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("name LIKE ? OR url LIKE ?", searchPattern, searchPattern)
+	}
+
+	var webhooks []Webhook
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &webhooks)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return webhooks, pagination, nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, id string) (Webhook, error) {
+	var webhook Webhook
+	err := s.db.
+		WithContext(ctx).
+		First(&webhook, "id = ?", id).
+		Error
+	return webhook, err
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, input webhookInputDto) (Webhook, error) {
+	if input.Secret == "" {
+		secret, err := utils.GenerateRandomAlphanumericString(secretLength)
+		if err != nil {
+			return Webhook{}, err
+		}
+		input.Secret = secret
+	}
+
+	var webhook Webhook
+	if err := applyInput(&webhook, input); err != nil {
+		return Webhook{}, err
+	}
+
+	err := s.db.
+		WithContext(ctx).
+		Create(&webhook).
+		Error
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (s *Service) UpdateWebhook(ctx context.Context, id string, input webhookInputDto) (Webhook, error) {
+	var webhook Webhook
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&webhook, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		// The secret is kept if no new one is given
+		if input.Secret == "" {
+			input.Secret = string(webhook.Secret)
+		}
+		if err := applyInput(&webhook, input); err != nil {
+			return err
+		}
+
+		return tx.Save(&webhook).Error
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+	result := s.db.
+		WithContext(ctx).
+		Delete(&Webhook{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// applyInput validates the input and copies it to the webhook
+func applyInput(webhook *Webhook, input webhookInputDto) error {
+	endpoint, err := url.Parse(input.URL)
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return &common.ValidationError{Message: "url must be an absolute http or https URL"}
+	}
+
+	events := Events()
+	for _, event := range input.Events {
+		if !slices.Contains(events, event) {
+			return &common.ValidationError{Message: fmt.Sprintf("unknown event %q", event)}
+		}
+	}
+
+	webhook.Name = input.Name
+	webhook.URL = input.URL
+	webhook.Events = slices.Compact(slices.Sorted(slices.Values(input.Events)))
+	webhook.Secret = datatype.EncryptedString(input.Secret)
+	webhook.Enabled = input.Enabled
+	return nil
+}
+
+func (s *Service) ListDeliveries(ctx context.Context, webhookID string, listRequestOptions utils.ListRequestOptions) ([]Delivery, utils.PaginationResponse, error) {
+	// The webhook is loaded first, so a missing webhook isn't reported as an empty list
+	if _, err := s.GetWebhook(ctx, webhookID); err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	query := s.db.
+		WithContext(ctx).
+		Model(&Delivery{}).
+		Where("webhook_id = ?", webhookID)
+
+	var deliveries []Delivery
+	pagination, err := utils.PaginateFilterAndSort(listRequestOptions, query, &deliveries)
+	if err != nil {
+		return nil, utils.PaginationResponse{}, err
+	}
+
+	return deliveries, pagination, nil
+}
+
+// Redeliver records a new delivery of the event of a delivery, with the same event ID and payload.
+// The original delivery is left as is.
+func (s *Service) Redeliver(ctx context.Context, webhookID, deliveryID string) (Delivery, error) {
+	var original Delivery
+	err := s.db.
+		WithContext(ctx).
+		Preload("Webhook").
+		First(&original, "id = ? AND webhook_id = ?", deliveryID, webhookID).
+		Error
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !original.Webhook.Enabled {
+		return Delivery{}, &common.ValidationError{Message: "the webhook is disabled"}
+	}
+
+	delivery := Delivery{
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        DeliveryStatusPending,
+		NextAttemptAt: datatype.DateTime(time.Now()),
+	}
+	err = s.db.
+		WithContext(ctx).
+		Create(&delivery).
+		Error
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// eventPayload is the JSON body that is sent to webhooks
+type eventPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+type auditLogEventData struct {
+	AuditLogID string             `json:"auditLogId"`
+	UserID     string             `json:"userId"`
+	Username   string             `json:"username"`
+	IPAddress  *string            `json:"ipAddress"`
+	Country    string             `json:"country"`
+	City       string             `json:"city"`
+	UserAgent  string             `json:"userAgent"`
+	Data       model.AuditLogData `json:"data"`
+}
+
+type adminMutationEventData struct {
+	ActorID       string            `json:"actorId"`
+	ActorUsername string            `json:"actorUsername"`
+	Method        string            `json:"method"`
+	Route         string            `json:"route"`
+	Path          string            `json:"path"`
+	Params        map[string]string `json:"params,omitempty"`
+	Status        int               `json:"status"`
+	IPAddress     string            `json:"ipAddress"`
+}
+
+// NotifyAuditLog records a delivery of the audit log event for every webhook that subscribed to it.
+// It has to be called in the transaction the audit log is created in.
+func (s *Service) NotifyAuditLog(ctx context.Context, tx *gorm.DB, auditLog model.AuditLog) error {
+	enqueued, err := s.enqueue(ctx, tx, string(auditLog.Event), auditLog.CreatedAt.ToTime(), func(username string) any {
+		return auditLogEventData{
+			AuditLogID: auditLog.ID,
+			UserID:     auditLog.UserID,
+			Username:   username,
+			IPAddress:  auditLog.IpAddress,
+			Country:    auditLog.Country,
+			City:       auditLog.City,
+			UserAgent:  auditLog.UserAgent,
+			Data:       auditLog.Data,
+		}
+	}, auditLog.UserID)
+	if err != nil || !enqueued {
+		return err
+	}
+
+	time.AfterFunc(auditLogDeliveryDelay, s.ScheduleDelivery)
+	return nil
+}
+
+// NotifyAdminMutation records a delivery of the admin mutation for every webhook that subscribed to it and
+// delivers them in the background
+func (s *Service) NotifyAdminMutation(ctx context.Context, data adminMutationEventData) error {
+	enqueued, err := s.enqueue(ctx, s.db, EventAdminMutation, time.Now(), func(username string) any {
+		data.ActorUsername = username
+		return data
+	}, data.ActorID)
+	if err != nil || !enqueued {
+		return err
+	}
+
+	s.ScheduleDelivery()
+	return nil
+}
+
+// enqueue records a pending delivery of the event for every enabled webhook that subscribed to it, and returns
+// whether any delivery was recorded. The data is only built if a webhook subscribed to the event, with the username
+// of the user the event is about.
+func (s *Service) enqueue(ctx context.Context, tx *gorm.DB, event string, createdAt time.Time, data func(username string) any, userID string) (bool, error) {
+	// The secrets aren't selected, as they don't have to be decrypted to record deliveries
+	var webhooks []Webhook
+	err := tx.
+		WithContext(ctx).
+		Select("id", "events").
+		Where("enabled = ?", true).
+		Find(&webhooks).
+		Error
+	if err != nil {
+		return false, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	webhooks = slices.DeleteFunc(webhooks, func(webhook Webhook) bool {
+		return !webhook.subscribedTo(event)
+	})
+	if len(webhooks) == 0 {
+		return false, nil
+	}
+
+	var username string
+	if userID != "" {
+		err = tx.
+			WithContext(ctx).
+			Model(&model.User{}).
+			Where("id = ?", userID).
+			Pluck("username", &username).
+			Error
+		if err != nil {
+			return false, fmt.Errorf("failed to load user: %w", err)
+		}
+	}
+
+	eventID := uuid.NewString()
+	payload, err := json.Marshal(eventPayload{
+		ID:        eventID,
+		Event:     event,
+		CreatedAt: createdAt.UTC(),
+		Data:      data(username),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	now := datatype.DateTime(time.Now())
+	deliveries := make([]Delivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, Delivery{
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        DeliveryStatusPending,
+			NextAttemptAt: now,
+		})
+	}
+
+	err = tx.
+		WithContext(ctx).
+		Create(&deliveries).
+		Error
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook deliveries: %w", err)
+	}
+	return true, nil
+}
+
+// ScheduleDelivery delivers the pending deliveries in the background.
+// Deliveries that fail are retried by the job that calls DeliverPending.
+//
+//nolint:contextcheck
+func (s *Service) ScheduleDelivery() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if err := s.DeliverPending(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to deliver webhook events", slog.Any("error", err))
+		}
+	}()
+}
+
+// DeliverPending delivers the events whose next delivery attempt is due
+func (s *Service) DeliverPending(ctx context.Context) error {
+	// Another delivery is in progress, the events are picked up by the next run
+	if !s.delivering.TryLock() {
+		return nil
+	}
+	defer s.delivering.Unlock()
+
+	var deliveries []Delivery
+	err := s.db.
+		WithContext(ctx).
+		Preload("Webhook").
+		Where("status = ? AND next_attempt_at <= ?", DeliveryStatusPending, datatype.DateTime(time.Now())).
+		Order("next_attempt_at").
+		Order("created_at").
+		Limit(deliveryBatchSize).
+		Find(&deliveries).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to load pending webhook deliveries: %w", err)
+	}
+
+	var errs []error
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		if err := s.deliverAndRecord(ctx, &deliveries[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliverAndRecord delivers an event and records the outcome of the attempt
+func (s *Service) deliverAndRecord(ctx context.Context, delivery *Delivery) error {
+	now := time.Now()
+	delivery.Attempts++
+
+	responseStatus, deliveryErr := s.deliver(ctx, delivery)
+	delivery.ResponseStatus = responseStatus
+	switch {
+	case deliveryErr == nil:
+		delivery.Status = DeliveryStatusDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = new(datatype.DateTime(now))
+	case errors.Is(deliveryErr, errWebhookDisabled) || delivery.Attempts >= deliveryMaxAttempts:
+		delivery.Status = DeliveryStatusFailed
+		delivery.LastError = deliveryErr.Error()
+	default:
+		delivery.LastError = deliveryErr.Error()
+		delivery.NextAttemptAt = datatype.DateTime(now.Add(deliveryBackoff(delivery.Attempts)))
+	}
+
+	if deliveryErr != nil {
+		slog.WarnContext(ctx, "Failed to deliver webhook event",
+			slog.String("webhook", delivery.WebhookID),
+			slog.String("event", delivery.Event),
+			slog.Int("attempt", delivery.Attempts),
+			slog.Any("error", deliveryErr),
+		)
+	}
+
+	err := s.db.
+		WithContext(ctx).
+		Model(delivery).
+		Select("Status", "Attempts", "LastError", "ResponseStatus", "NextAttemptAt", "DeliveredAt").
+		Updates(delivery).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+var errWebhookDisabled = errors.New("the webhook is disabled")
+
+// deliver posts the signed payload to the webhook and returns the status the webhook responded with
+func (s *Service) deliver(ctx context.Context, delivery *Delivery) (*int, error) {
+	webhook := delivery.Webhook
+	if !webhook.Enabled {
+		return nil, errWebhookDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is created on every attempt, so receivers can reject old timestamps to prevent replays
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(eventHeader, delivery.Event)
+	req.Header.Set(deliveryHeader, delivery.ID)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, "sha256="+sign(string(webhook.Secret), timestamp, delivery.Payload))
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &res.StatusCode, fmt.Errorf("the webhook responded with status %d", res.StatusCode)
+	}
+	return &res.StatusCode, nil
+}
+
+// sign returns the hex-encoded HMAC-SHA256 of the timestamp and the payload, separated by a dot
+func sign(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveryBackoff returns the delay before the next delivery attempt, which doubles with every attempt
+func deliveryBackoff(attempts int) time.Duration {
+	delay := deliveryRetryDelay
+	for i := 1; i < attempts && delay < deliveryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, deliveryMaxDelay)
+}
+
+// CleanupDeliveries deletes deliveries that were delivered or given up on before the retention period
+func CleanupDeliveries(ctx context.Context, db *gorm.DB) (int64, error) {
+	st := db.
+		WithContext(ctx).
+		Delete(&Delivery{}, "status != ? AND created_at < ?", DeliveryStatusPending, datatype.DateTime(time.Now().Add(-deliveryRetention)))
+	return st.RowsAffected, st.Error
+}
@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pocket-id/pocket-id/backend/internal/common"
+	"github.com/pocket-id/pocket-id/backend/internal/model"
+	datatype "github.com/pocket-id/pocket-id/backend/internal/model/types"
+	testutils "github.com/pocket-id/pocket-id/backend/internal/utils/testing"
+)
+
+// receivedRequest is a request the test receiver got
+type receivedRequest struct {
+	header http.Header
+	body   string
+}
+
+func newTestReceiver(t *testing.T, status *int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, receivedRequest{header: r.Header, body: string(body)})
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		taken := requests
+		requests = nil
+		return taken
+	}
+}
+
+func TestServiceDeliverPending(t *testing.T) {
+	db := testutils.NewDatabaseForTest(t)
+	status := http.StatusNoContent
+	server, takeRequests := newTestReceiver(t, &status)
+	service := newService(db, server.Client())
+
+	user := model.User{Username: "alice"}
+	require.NoError(t, db.Create(&user).Error)
+
+	subscribed, err := service.CreateWebhook(t.Context(), webhookInputDto{
+		Name:    "Sign-ins",
+		URL:     server.URL,
+		Events:  []string{string(model.AuditLogEventSignIn)},
+		Enabled: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, subscribed.Secret, secretLength)
+
+	_, err = service.CreateWebhook(t.Context(), webhookInputDto{
+		Name:    "Passkeys",
+		URL:     server.URL,
+		Events:  []string{string(model.AuditLogEventPasskeyAdded)},
+		Enabled: true,
+	})
+	require.NoError(t, err)
+
+	// Events are recorded without scheduling a delivery in the background, so the test controls the deliveries
+	record := func(t *testing.T, event string) {
+		t.Helper()
+		_, err := service.enqueue(t.Context(), db, event, time.Now(), func(username string) any {
+			return map[string]string{"username": username}
+		}, user.ID)
+		require.NoError(t, err)
+	}
+	record(t, string(model.AuditLogEventSignIn))
+
+	t.Run("delivers signed event to subscribed webhooks", func(t *testing.T) {
+		require.NoError(t, service.DeliverPending(t.Context()))
+
+		requests := takeRequests()
+		require.Len(t, requests, 1)
+
+		header := requests[0].header
+		assert.Equal(t, string(model.AuditLogEventSignIn), header.Get(eventHeader))
+		assert.Equal(t, "sha256="+sign(string(subscribed.Secret), header.Get(timestampHeader), requests[0].body), header.Get(signatureHeader))
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal([]byte(requests[0].body), &payload))
+		assert.Equal(t, string(model.AuditLogEventSignIn), payload["event"])
+		assert.Equal(t, "alice", payload["data"].(map[string]any)["username"])
+
+		var delivery Delivery
+		require.NoError(t, db.First(&delivery, "webhook_id = ?", subscribed.ID).Error)
+		assert.Equal(t, DeliveryStatusDelivered, delivery.Status)
+		assert.Equal(t, http.StatusNoContent, *delivery.ResponseStatus)
+		assert.NotNil(t, delivery.DeliveredAt)
+	})
+
+	t.Run("retries failed deliveries", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		record(t, EventAdminMutation)
+
+		// The sign-in webhook didn't subscribe to admin mutations, so it isn't notified
+		require.NoError(t, service.DeliverPending(t.Context()))
+		assert.Empty(t, takeRequests())
+
+		_, err := service.UpdateWebhook(t.Context(), subscribed.ID, webhookInputDto{
+			Name:    "Everything",
+			URL:     server.URL,
+			Enabled: true,
+		})
+		require.NoError(t, err)
+		record(t, EventAdminMutation)
+		require.NoError(t, service.DeliverPending(t.Context()))
+		assert.Len(t, takeRequests(), 1)
+
+		var delivery Delivery
+		require.NoError(t, db.First(&delivery, "event = ?", EventAdminMutation).Error)
+		assert.Equal(t, DeliveryStatusPending, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Contains(t, delivery.LastError, "500")
+		assert.WithinDuration(t, time.Now().Add(deliveryRetryDelay), delivery.NextAttemptAt.ToTime(), 5*time.Second)
+
+		// The delivery is given up after the last attempt
+		require.NoError(t, db.Model(&delivery).Updates(map[string]any{
+			"attempts":        deliveryMaxAttempts - 1,
+			"next_attempt_at": datatype.DateTime(time.Now().Add(-time.Second)),
+		}).Error)
+		require.NoError(t, service.DeliverPending(t.Context()))
+		assert.Len(t, takeRequests(), 1)
+
+		require.NoError(t, db.First(&delivery, "id = ?", delivery.ID).Error)
+		assert.Equal(t, DeliveryStatusFailed, delivery.Status)
+
+		t.Run("redelivers with the same event ID", func(t *testing.T) {
+			status = http.StatusOK
+			redelivery, err := service.Redeliver(t.Context(), subscribed.ID, delivery.ID)
+			require.NoError(t, err)
+			assert.Equal(t, delivery.EventID, redelivery.EventID)
+
+			require.NoError(t, service.DeliverPending(t.Context()))
+			requests := takeRequests()
+			require.Len(t, requests, 1)
+			assert.Equal(t, delivery.Payload, requests[0].body)
+			assert.Equal(t, redelivery.ID, requests[0].header.Get(deliveryHeader))
+		})
+	})
+
+	t.Run("unknown events are rejected", func(t *testing.T) {
+		_, err := service.CreateWebhook(t.Context(), webhookInputDto{Name: "Unknown", URL: server.URL, Events: []string{"UNKNOWN"}})
+		var validationErr *common.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	assert.Equal(t, deliveryRetryDelay, deliveryBackoff(1))
+	assert.Equal(t, 4*deliveryRetryDelay, deliveryBackoff(3))
+	assert.Equal(t, deliveryMaxDelay, deliveryBackoff(deliveryMaxAttempts))
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS oidc_client_registrations;
+DROP TABLE IF EXISTS oidc_initial_access_tokens;
@@ -0,0 +1,20 @@
+CREATE TABLE oidc_initial_access_tokens (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL,
+    token VARCHAR(255) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    usage_limit INTEGER NOT NULL DEFAULT 1,
+    usage_count INTEGER NOT NULL DEFAULT 0,
+    created_by_id UUID REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_oidc_initial_access_tokens_expires_at ON oidc_initial_access_tokens (expires_at);
+
+CREATE TABLE oidc_client_registrations (
+    client_id TEXT NOT NULL PRIMARY KEY REFERENCES oidc_clients (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    registration_access_token VARCHAR(255) NOT NULL UNIQUE,
+    token_endpoint_auth_method TEXT NOT NULL DEFAULT '',
+    initial_access_token_id UUID REFERENCES oidc_initial_access_tokens (id) ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE oauth2_sessions DROP COLUMN dpop_jkt;
+ALTER TABLE oidc_clients DROP COLUMN requires_dpop;
@@ -0,0 +1,15 @@
+CREATE TABLE oidc_scopes (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    claim_keys JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE oidc_scopes_allowed_clients (
+    oidc_scope_id UUID NOT NULL REFERENCES oidc_scopes (id) ON DELETE CASCADE,
+    oidc_client_id TEXT NOT NULL REFERENCES oidc_clients (id) ON DELETE CASCADE,
+    PRIMARY KEY (oidc_scope_id, oidc_client_id)
+);
+
+CREATE INDEX idx_oidc_scopes_allowed_clients_client_id ON oidc_scopes_allowed_clients (oidc_client_id);
@@ -0,0 +1,2 @@
+ALTER TABLE oidc_clients ADD COLUMN subject_type TEXT NOT NULL DEFAULT 'public';
+ALTER TABLE oidc_clients ADD COLUMN sector_identifier_uri TEXT NULL;
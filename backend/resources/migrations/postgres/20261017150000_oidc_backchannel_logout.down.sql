@@ -0,0 +1,4 @@
+DROP TABLE oidc_backchannel_logouts;
+
+ALTER TABLE oidc_clients DROP COLUMN backchannel_logout_session_required;
+ALTER TABLE oidc_clients DROP COLUMN backchannel_logout_uri;
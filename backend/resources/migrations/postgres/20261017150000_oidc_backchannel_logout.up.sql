@@ -0,0 +1,18 @@
+ALTER TABLE oidc_clients ADD COLUMN backchannel_logout_uri TEXT NULL;
+ALTER TABLE oidc_clients ADD COLUMN backchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE oidc_backchannel_logouts (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oidc_clients (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    session_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_oidc_backchannel_logouts_status_next_attempt_at ON oidc_backchannel_logouts (status, next_attempt_at);
+CREATE INDEX idx_oidc_backchannel_logouts_client_id ON oidc_backchannel_logouts (client_id);
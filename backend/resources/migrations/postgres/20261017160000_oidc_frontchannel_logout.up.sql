@@ -0,0 +1 @@
+ALTER TABLE oidc_clients ADD COLUMN frontchannel_logout_uri TEXT NULL;
@@ -0,0 +1 @@
+ALTER TABLE oidc_clients DROP COLUMN default_response_mode;
@@ -0,0 +1 @@
+ALTER TABLE oidc_clients ADD COLUMN default_response_mode TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE oidc_clients DROP COLUMN backchannel_token_delivery_mode;
+ALTER TABLE oidc_clients DROP COLUMN backchannel_client_notification_endpoint;
@@ -0,0 +1,2 @@
+ALTER TABLE oidc_clients ADD COLUMN backchannel_token_delivery_mode TEXT NOT NULL DEFAULT '';
+ALTER TABLE oidc_clients ADD COLUMN backchannel_client_notification_endpoint TEXT NULL;
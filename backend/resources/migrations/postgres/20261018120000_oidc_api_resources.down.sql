@@ -0,0 +1,5 @@
+ALTER TABLE user_authorized_oidc_clients DROP COLUMN resources;
+ALTER TABLE interaction_sessions DROP COLUMN resources;
+
+DROP TABLE oidc_api_resources_allowed_clients;
+DROP TABLE oidc_api_resources;
@@ -0,0 +1,4 @@
+DROP TABLE saml_sessions;
+DROP TABLE saml_authn_requests;
+DROP TABLE saml_service_providers_allowed_user_groups;
+DROP TABLE saml_service_providers;
@@ -0,0 +1,2 @@
+DROP TABLE ldap_service_accounts_allowed_user_groups;
+DROP TABLE ldap_service_accounts;
@@ -0,0 +1,15 @@
+CREATE TABLE ldap_service_accounts (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    password_hash TEXT NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    is_group_restricted BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE ldap_service_accounts_allowed_user_groups (
+    ldap_service_account_id UUID NOT NULL REFERENCES ldap_service_accounts (id) ON DELETE CASCADE,
+    user_group_id UUID NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+    PRIMARY KEY (ldap_service_account_id, user_group_id)
+);
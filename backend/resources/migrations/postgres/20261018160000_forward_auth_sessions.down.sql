@@ -0,0 +1 @@
+DROP TABLE forward_auth_sessions;
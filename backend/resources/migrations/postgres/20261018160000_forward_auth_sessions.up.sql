@@ -0,0 +1,14 @@
+CREATE TABLE forward_auth_sessions (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    code_hash TEXT UNIQUE,
+    token_hash TEXT UNIQUE,
+    client_id TEXT NOT NULL REFERENCES oidc_clients (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_session_id UUID NOT NULL REFERENCES user_sessions (id) ON DELETE CASCADE,
+    code_expires_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_forward_auth_sessions_user_session_id ON forward_auth_sessions (user_session_id);
+CREATE INDEX idx_forward_auth_sessions_expires_at ON forward_auth_sessions (expires_at);
@@ -0,0 +1,3 @@
+DROP TABLE scim_external_ids;
+
+ALTER TABLE api_keys DROP COLUMN scopes;
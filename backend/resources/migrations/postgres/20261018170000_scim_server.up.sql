@@ -0,0 +1,9 @@
+ALTER TABLE api_keys ADD COLUMN scopes JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE scim_external_ids (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    user_id UUID UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    user_group_id UUID UNIQUE REFERENCES user_groups (id) ON DELETE CASCADE,
+    external_id TEXT NOT NULL
+);
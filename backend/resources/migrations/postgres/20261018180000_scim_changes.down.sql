@@ -0,0 +1,4 @@
+DROP TABLE scim_changes;
+
+ALTER TABLE scim_service_providers DROP COLUMN last_push_error;
+ALTER TABLE scim_service_providers DROP COLUMN last_pushed_at;
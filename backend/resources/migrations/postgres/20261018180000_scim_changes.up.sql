@@ -0,0 +1,18 @@
+ALTER TABLE scim_service_providers ADD COLUMN last_pushed_at TIMESTAMPTZ NULL;
+ALTER TABLE scim_service_providers ADD COLUMN last_push_error TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE scim_changes (
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    service_provider_id UUID NOT NULL REFERENCES scim_service_providers (id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    member_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_scim_changes_status_next_attempt_at ON scim_changes (status, next_attempt_at);
+CREATE INDEX idx_scim_changes_service_provider_id ON scim_changes (service_provider_id);
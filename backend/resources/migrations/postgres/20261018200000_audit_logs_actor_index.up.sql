@@ -0,0 +1 @@
+CREATE INDEX idx_audit_logs_actor_user_id ON audit_logs(("data"->>'actorUserID'));
@@ -0,0 +1,9 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE IF EXISTS oidc_client_registrations;
+DROP INDEX IF EXISTS idx_oidc_initial_access_tokens_expires_at;
+DROP TABLE IF EXISTS oidc_initial_access_tokens;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
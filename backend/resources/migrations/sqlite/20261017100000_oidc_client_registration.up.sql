@@ -0,0 +1,26 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE oidc_initial_access_tokens (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at INTEGER NOT NULL,
+    usage_limit INTEGER NOT NULL DEFAULT 1,
+    usage_count INTEGER NOT NULL DEFAULT 0,
+    created_by_id TEXT REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_oidc_initial_access_tokens_expires_at ON oidc_initial_access_tokens (expires_at);
+
+CREATE TABLE oidc_client_registrations (
+    client_id TEXT NOT NULL PRIMARY KEY REFERENCES oidc_clients(id) ON DELETE CASCADE,
+    created_at INTEGER NOT NULL,
+    registration_access_token TEXT NOT NULL UNIQUE,
+    token_endpoint_auth_method TEXT NOT NULL DEFAULT '',
+    initial_access_token_id TEXT REFERENCES oidc_initial_access_tokens(id) ON DELETE SET NULL
+);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oauth2_sessions DROP COLUMN dpop_jkt;
+ALTER TABLE oidc_clients DROP COLUMN requires_dpop;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
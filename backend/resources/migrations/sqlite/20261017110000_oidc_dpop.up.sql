@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN requires_dpop BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE oauth2_sessions ADD COLUMN dpop_jkt TEXT NOT NULL DEFAULT '';
+
+COMMIT;
+PRAGMA foreign_keys= ON;
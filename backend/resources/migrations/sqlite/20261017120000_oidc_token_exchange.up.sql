@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN token_exchange TEXT NULL;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
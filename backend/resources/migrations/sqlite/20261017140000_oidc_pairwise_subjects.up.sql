@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN subject_type TEXT NOT NULL DEFAULT 'public';
+ALTER TABLE oidc_clients ADD COLUMN sector_identifier_uri TEXT NULL;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,10 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE oidc_backchannel_logouts;
+
+ALTER TABLE oidc_clients DROP COLUMN backchannel_logout_session_required;
+ALTER TABLE oidc_clients DROP COLUMN backchannel_logout_uri;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,24 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN backchannel_logout_uri TEXT NULL;
+ALTER TABLE oidc_clients ADD COLUMN backchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE oidc_backchannel_logouts (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oidc_clients(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    session_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at INTEGER NOT NULL,
+    delivered_at INTEGER NULL
+);
+
+CREATE INDEX idx_oidc_backchannel_logouts_status_next_attempt_at ON oidc_backchannel_logouts (status, next_attempt_at);
+CREATE INDEX idx_oidc_backchannel_logouts_client_id ON oidc_backchannel_logouts (client_id);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients DROP COLUMN requires_signed_request_object;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN requires_signed_request_object BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
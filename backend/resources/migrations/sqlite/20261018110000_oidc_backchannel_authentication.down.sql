@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients DROP COLUMN backchannel_token_delivery_mode;
+ALTER TABLE oidc_clients DROP COLUMN backchannel_client_notification_endpoint;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE oidc_clients ADD COLUMN backchannel_token_delivery_mode TEXT NOT NULL DEFAULT '';
+ALTER TABLE oidc_clients ADD COLUMN backchannel_client_notification_endpoint TEXT NULL;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
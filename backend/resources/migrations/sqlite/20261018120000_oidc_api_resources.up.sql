@@ -0,0 +1,25 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE oidc_api_resources (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    identifier TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    access_token_lifetime INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE oidc_api_resources_allowed_clients (
+    oidc_api_resource_id TEXT NOT NULL REFERENCES oidc_api_resources(id) ON DELETE CASCADE,
+    oidc_client_id TEXT NOT NULL REFERENCES oidc_clients(id) ON DELETE CASCADE,
+    PRIMARY KEY (oidc_api_resource_id, oidc_client_id)
+);
+
+CREATE INDEX idx_oidc_api_resources_allowed_clients_client_id ON oidc_api_resources_allowed_clients (oidc_client_id);
+
+ALTER TABLE interaction_sessions ADD COLUMN resources TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE user_authorized_oidc_clients ADD COLUMN resources TEXT NOT NULL DEFAULT '[]';
+
+COMMIT;
+PRAGMA foreign_keys= ON;
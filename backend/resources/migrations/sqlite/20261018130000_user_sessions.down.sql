@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE user_sessions;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
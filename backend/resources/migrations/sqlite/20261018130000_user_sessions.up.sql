@@ -0,0 +1,21 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE user_sessions (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    authentication_method TEXT NOT NULL DEFAULT '',
+    ip_address TEXT,
+    user_agent TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    city TEXT NOT NULL DEFAULT '',
+    last_seen_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions (user_id);
+CREATE INDEX idx_user_sessions_expires_at ON user_sessions (expires_at);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
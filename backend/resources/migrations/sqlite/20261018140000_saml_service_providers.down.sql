@@ -0,0 +1,10 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE saml_sessions;
+DROP TABLE saml_authn_requests;
+DROP TABLE saml_service_providers_allowed_user_groups;
+DROP TABLE saml_service_providers;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,55 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE saml_service_providers (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL UNIQUE,
+    metadata TEXT NOT NULL,
+    assertion_consumer_services TEXT NOT NULL DEFAULT '[]',
+    single_logout_services TEXT NOT NULL DEFAULT '[]',
+    signing_certificates TEXT NOT NULL DEFAULT '[]',
+    name_id_format TEXT NOT NULL,
+    authn_requests_signed BOOLEAN NOT NULL DEFAULT FALSE,
+    sign_response BOOLEAN NOT NULL DEFAULT FALSE,
+    attribute_mapping TEXT NOT NULL DEFAULT '[]',
+    is_group_restricted BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE saml_service_providers_allowed_user_groups (
+    saml_service_provider_id TEXT NOT NULL REFERENCES saml_service_providers (id) ON DELETE CASCADE,
+    user_group_id TEXT NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+    PRIMARY KEY (saml_service_provider_id, user_group_id)
+);
+
+CREATE TABLE saml_authn_requests (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    service_provider_id TEXT NOT NULL REFERENCES saml_service_providers (id) ON DELETE CASCADE,
+    request_id TEXT NOT NULL DEFAULT '',
+    assertion_consumer_service_url TEXT NOT NULL,
+    relay_state TEXT NOT NULL DEFAULT '',
+    name_id_format TEXT NOT NULL,
+    is_passive BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_saml_authn_requests_expires_at ON saml_authn_requests (expires_at);
+
+CREATE TABLE saml_sessions (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    service_provider_id TEXT NOT NULL REFERENCES saml_service_providers (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name_id TEXT NOT NULL,
+    name_id_format TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_saml_sessions_service_provider_id_name_id ON saml_sessions (service_provider_id, name_id);
+CREATE INDEX idx_saml_sessions_user_id ON saml_sessions (user_id);
+CREATE INDEX idx_saml_sessions_expires_at ON saml_sessions (expires_at);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE ldap_service_accounts_allowed_user_groups;
+DROP TABLE ldap_service_accounts;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
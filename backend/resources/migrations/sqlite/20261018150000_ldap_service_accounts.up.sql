@@ -0,0 +1,21 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE ldap_service_accounts (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    password_hash TEXT NOT NULL,
+    last_used_at INTEGER,
+    is_group_restricted BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE ldap_service_accounts_allowed_user_groups (
+    ldap_service_account_id TEXT NOT NULL REFERENCES ldap_service_accounts (id) ON DELETE CASCADE,
+    user_group_id TEXT NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+    PRIMARY KEY (ldap_service_account_id, user_group_id)
+);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE forward_auth_sessions;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,20 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE TABLE forward_auth_sessions (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    code_hash TEXT UNIQUE,
+    token_hash TEXT UNIQUE,
+    client_id TEXT NOT NULL REFERENCES oidc_clients(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_session_id TEXT NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    code_expires_at INTEGER,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_forward_auth_sessions_user_session_id ON forward_auth_sessions (user_session_id);
+CREATE INDEX idx_forward_auth_sessions_expires_at ON forward_auth_sessions (expires_at);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
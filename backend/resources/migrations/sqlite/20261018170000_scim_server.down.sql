@@ -0,0 +1,9 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE scim_external_ids;
+
+ALTER TABLE api_keys DROP COLUMN scopes;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
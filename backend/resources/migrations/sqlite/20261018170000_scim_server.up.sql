@@ -0,0 +1,15 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE scim_external_ids (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    user_id TEXT UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    user_group_id TEXT UNIQUE REFERENCES user_groups (id) ON DELETE CASCADE,
+    external_id TEXT NOT NULL
+);
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,10 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE scim_changes;
+
+ALTER TABLE scim_service_providers DROP COLUMN last_push_error;
+ALTER TABLE scim_service_providers DROP COLUMN last_pushed_at;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
@@ -0,0 +1,8 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
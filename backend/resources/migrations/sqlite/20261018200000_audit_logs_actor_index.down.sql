@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+DROP INDEX IF EXISTS idx_audit_logs_actor_user_id;
+
+COMMIT;
+PRAGMA foreign_keys= ON;
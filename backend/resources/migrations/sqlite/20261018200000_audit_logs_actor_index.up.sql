@@ -0,0 +1,7 @@
+PRAGMA foreign_keys= OFF;
+BEGIN;
+
+CREATE INDEX idx_audit_logs_actor_user_id ON audit_logs((json_extract(data, '$.actorUserID')));
+
+COMMIT;
+PRAGMA foreign_keys= ON;
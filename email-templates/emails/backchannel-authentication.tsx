@@ -0,0 +1,63 @@
+import { Text } from "@react-email/components";
+import { BaseTemplate } from "../components/base-template";
+import { Button } from "../components/button";
+import CardHeader from "../components/card-header";
+import { sharedPreviewProps, sharedTemplateProps } from "../props";
+
+interface BackchannelAuthenticationData {
+  clientName: string;
+  bindingMessage: string;
+  approvalLink: string;
+  expirationString: string;
+}
+
+interface BackchannelAuthenticationEmailProps {
+  logoURL: string;
+  appName: string;
+  data: BackchannelAuthenticationData;
+}
+
+export const BackchannelAuthenticationEmail = ({
+  logoURL,
+  appName,
+  data,
+}: BackchannelAuthenticationEmailProps) => (
+  <BaseTemplate logoURL={logoURL} appName={appName}>
+    <CardHeader title="Sign-In Request" />
+
+    <Text>
+      {data.clientName} asks you to sign in with your {appName} account. Click
+      the button below to review the request. If you didn't start this sign-in,
+      you can ignore this email.
+      <br />
+      <br />
+      {"{{if .Data.BindingMessage}}"}Make sure the device shows the code{" "}
+      <strong>{data.bindingMessage}</strong>.<br />
+      {"{{end}}"}This request expires in {data.expirationString}.
+    </Text>
+
+    <Button href={data.approvalLink}>Review Request</Button>
+  </BaseTemplate>
+);
+
+export default BackchannelAuthenticationEmail;
+
+BackchannelAuthenticationEmail.TemplateProps = {
+  ...sharedTemplateProps,
+  data: {
+    clientName: "{{.Data.ClientName}}",
+    bindingMessage: "{{.Data.BindingMessage}}",
+    approvalLink: "{{.Data.ApprovalLink}}",
+    expirationString: "{{.Data.ExpirationString}}",
+  },
+};
+
+BackchannelAuthenticationEmail.PreviewProps = {
+  ...sharedPreviewProps,
+  data: {
+    clientName: "Nextcloud",
+    bindingMessage: "4T7X",
+    approvalLink: "https://localhost:1411/backchannel-authentication",
+    expirationString: "5 minutes",
+  },
+};
@@ -22,4 +22,9 @@ export default class AuditLogService extends APIService {
 		const res = await this.api.get<Record<string, string>>('/audit-logs/filters/users');
 		return res.data;
 	};
+
+	listActors = async () => {
+		const res = await this.api.get<Record<string, string>>('/audit-logs/filters/actors');
+		return res.data;
+	};
 }
@@ -0,0 +1,33 @@
+import type {
+	LdapServerInfo,
+	LdapServiceAccount,
+	LdapServiceAccountInput,
+	LdapServiceAccountWithPassword
+} from '$lib/types/ldap-server.type';
+import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
+import APIService from './api-service';
+
+export default class LdapServerService extends APIService {
+	getInfo = async () => (await this.api.get('/ldap-server')).data as LdapServerInfo;
+
+	listServiceAccounts = async (options?: ListRequestOptions) => {
+		const res = await this.api.get('/ldap-server/service-accounts', { params: options });
+		return res.data as Paginated<LdapServiceAccount>;
+	};
+
+	createServiceAccount = async (serviceAccount: LdapServiceAccountInput) =>
+		(await this.api.post('/ldap-server/service-accounts', serviceAccount))
+			.data as LdapServiceAccountWithPassword;
+
+	updateServiceAccount = async (id: string, serviceAccount: LdapServiceAccountInput) =>
+		(await this.api.put(`/ldap-server/service-accounts/${id}`, serviceAccount))
+			.data as LdapServiceAccount;
+
+	regeneratePassword = async (id: string) =>
+		(await this.api.post(`/ldap-server/service-accounts/${id}/password`))
+			.data as LdapServiceAccountWithPassword;
+
+	removeServiceAccount = async (id: string) => {
+		await this.api.delete(`/ldap-server/service-accounts/${id}`);
+	};
+}
@@ -0,0 +1,23 @@
+import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
+import type { OidcApiResource, OidcApiResourceInput } from '$lib/types/oidc.type';
+import APIService from './api-service';
+
+export default class OidcApiResourceService extends APIService {
+	list = async (options?: ListRequestOptions) => {
+		const res = await this.api.get('/oidc/api-resources', { params: options });
+		return res.data as Paginated<OidcApiResource>;
+	};
+
+	get = async (id: string) =>
+		(await this.api.get(`/oidc/api-resources/${id}`)).data as OidcApiResource;
+
+	create = async (resource: OidcApiResourceInput) =>
+		(await this.api.post('/oidc/api-resources', resource)).data as OidcApiResource;
+
+	update = async (id: string, resource: OidcApiResourceInput) =>
+		(await this.api.put(`/oidc/api-resources/${id}`, resource)).data as OidcApiResource;
+
+	remove = async (id: string) => {
+		await this.api.delete(`/oidc/api-resources/${id}`);
+	};
+}
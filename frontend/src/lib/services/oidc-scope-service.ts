@@ -0,0 +1,22 @@
+import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
+import type { OidcScope, OidcScopeInput } from '$lib/types/oidc.type';
+import APIService from './api-service';
+
+export default class OidcScopeService extends APIService {
+	list = async (options?: ListRequestOptions) => {
+		const res = await this.api.get('/oidc/scopes', { params: options });
+		return res.data as Paginated<OidcScope>;
+	};
+
+	get = async (id: string) => (await this.api.get(`/oidc/scopes/${id}`)).data as OidcScope;
+
+	create = async (scope: OidcScopeInput) =>
+		(await this.api.post('/oidc/scopes', scope)).data as OidcScope;
+
+	update = async (id: string, scope: OidcScopeInput) =>
+		(await this.api.put(`/oidc/scopes/${id}`, scope)).data as OidcScope;
+
+	remove = async (id: string) => {
+		await this.api.delete(`/oidc/scopes/${id}`);
+	};
+}
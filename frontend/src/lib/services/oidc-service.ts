@@ -1,6 +1,7 @@
 import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
 import type {
 	AccessibleOidcClient,
+	BackchannelAuthenticationRequest,
 	CompleteInteractionResponse,
 	InteractionSession,
 	InteractionStep,
@@ -97,6 +98,19 @@ class OidcService extends APIService {
 		return response.data;
 	};
 
+	listBackchannelAuthenticationRequests = async (): Promise<BackchannelAuthenticationRequest[]> => {
+		const response = await this.api.get('/oidc/backchannel-authentication/requests');
+		return response.data;
+	};
+
+	approveBackchannelAuthenticationRequest = async (id: string) => {
+		await this.api.post(`/oidc/backchannel-authentication/requests/${id}/approve`);
+	};
+
+	denyBackchannelAuthenticationRequest = async (id: string) => {
+		await this.api.post(`/oidc/backchannel-authentication/requests/${id}/deny`);
+	};
+
 	getClientPreview = async (id: string, userId: string, scopes: string) => {
 		const response = await this.api.get(`/oidc/clients/${id}/preview/${userId}`, {
 			params: { scopes }
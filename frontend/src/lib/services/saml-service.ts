@@ -0,0 +1,31 @@
+import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
+import type {
+	SamlIdentityProvider,
+	SamlServiceProvider,
+	SamlServiceProviderInput
+} from '$lib/types/saml.type';
+import APIService from './api-service';
+
+export default class SamlService extends APIService {
+	getIdentityProvider = async () =>
+		(await this.api.get('/saml/identity-provider')).data as SamlIdentityProvider;
+
+	listServiceProviders = async (options?: ListRequestOptions) => {
+		const res = await this.api.get('/saml/service-providers', { params: options });
+		return res.data as Paginated<SamlServiceProvider>;
+	};
+
+	getServiceProvider = async (id: string) =>
+		(await this.api.get(`/saml/service-providers/${id}`)).data as SamlServiceProvider;
+
+	createServiceProvider = async (serviceProvider: SamlServiceProviderInput) =>
+		(await this.api.post('/saml/service-providers', serviceProvider)).data as SamlServiceProvider;
+
+	updateServiceProvider = async (id: string, serviceProvider: SamlServiceProviderInput) =>
+		(await this.api.put(`/saml/service-providers/${id}`, serviceProvider))
+			.data as SamlServiceProvider;
+
+	removeServiceProvider = async (id: string) => {
+		await this.api.delete(`/saml/service-providers/${id}`);
+	};
+}
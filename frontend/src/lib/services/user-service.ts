@@ -4,6 +4,7 @@ import type { Passkey } from '$lib/types/passkey.type';
 import type { SignupToken } from '$lib/types/signup-token.type';
 import type { UserGroup } from '$lib/types/user-group.type';
 import type { AccountUpdate, User, UserCreate, UserSignUp } from '$lib/types/user.type';
+import type { UserSession } from '$lib/types/user-session.type';
 import { cachedProfilePicture } from '$lib/utils/cached-image-util';
 import { get } from 'svelte/store';
 import APIService from './api-service';
@@ -39,6 +40,32 @@ export default class UserService extends APIService {
 		return res.data as Passkey[];
 	};
 
+	listCurrentUserSessions = async () => {
+		const res = await this.api.get('/users/me/sessions');
+		return res.data as UserSession[];
+	};
+
+	revokeCurrentUserSession = async (sessionId: string) => {
+		await this.api.delete(`/users/me/sessions/${sessionId}`);
+	};
+
+	revokeOtherCurrentUserSessions = async () => {
+		await this.api.delete('/users/me/sessions');
+	};
+
+	listUserSessions = async (userId: string) => {
+		const res = await this.api.get(`/users/${userId}/sessions`);
+		return res.data as UserSession[];
+	};
+
+	revokeUserSession = async (userId: string, sessionId: string) => {
+		await this.api.delete(`/users/${userId}/sessions/${sessionId}`);
+	};
+
+	revokeAllUserSessions = async (userId: string) => {
+		await this.api.delete(`/users/${userId}/sessions`);
+	};
+
 	update = async (id: string, user: UserCreate) => {
 		const res = await this.api.put(`/users/${id}`, user);
 		return res.data as User;
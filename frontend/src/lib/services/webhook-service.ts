@@ -0,0 +1,33 @@
+import type { ListRequestOptions, Paginated } from '$lib/types/list-request.type';
+import type { Webhook, WebhookDelivery, WebhookInput } from '$lib/types/webhook.type';
+import APIService from './api-service';
+
+export default class WebhookService extends APIService {
+	list = async (options?: ListRequestOptions) => {
+		const res = await this.api.get('/webhooks', { params: options });
+		return res.data as Paginated<Webhook>;
+	};
+
+	listEvents = async () => (await this.api.get('/webhooks/events')).data as string[];
+
+	get = async (id: string) => (await this.api.get(`/webhooks/${id}`)).data as Webhook;
+
+	create = async (webhook: WebhookInput) =>
+		(await this.api.post('/webhooks', webhook)).data as Webhook;
+
+	update = async (id: string, webhook: WebhookInput) =>
+		(await this.api.put(`/webhooks/${id}`, webhook)).data as Webhook;
+
+	remove = async (id: string) => {
+		await this.api.delete(`/webhooks/${id}`);
+	};
+
+	listDeliveries = async (id: string, options?: ListRequestOptions) => {
+		const res = await this.api.get(`/webhooks/${id}/deliveries`, { params: options });
+		return res.data as Paginated<WebhookDelivery>;
+	};
+
+	redeliver = async (id: string, deliveryId: string) =>
+		(await this.api.post(`/webhooks/${id}/deliveries/${deliveryId}/redeliver`))
+			.data as WebhookDelivery;
+}
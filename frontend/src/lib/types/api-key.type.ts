@@ -1,3 +1,5 @@
+export type ApiKeyScope = 'scim';
+
 export type ApiKey = {
 	id: string;
 	name: string;
@@ -5,12 +7,14 @@ export type ApiKey = {
 	expiresAt: string;
 	lastUsedAt?: string;
 	createdAt: string;
+	scopes: ApiKeyScope[];
 };
 
 export type ApiKeyCreate = {
 	name: string;
 	description?: string;
 	expiresAt: Date;
+	scopes?: ApiKeyScope[];
 };
 
 export type ApiKeyResponse = {
@@ -14,7 +14,13 @@ export type AuditLog = {
 
 export type AuditLogFilter = {
 	userID: string;
+	actorUserID: string;
 	event: string;
 	location: string;
 	clientName: string;
 };
+
+export type AuditLogFieldChange = {
+	before?: unknown;
+	after?: unknown;
+};
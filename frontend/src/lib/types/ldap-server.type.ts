@@ -0,0 +1,33 @@
+import type { UserGroupMinimal } from './user-group.type';
+
+export type LdapServerInfo = {
+	enabled: boolean;
+	baseDn: string;
+	usersDn: string;
+	groupsDn: string;
+	ldapAddr?: string;
+	ldapsAddr?: string;
+};
+
+export type LdapServiceAccount = {
+	id: string;
+	name: string;
+	description?: string;
+	bindDn: string;
+	lastUsedAt?: string;
+	isGroupRestricted: boolean;
+	allowedUserGroups: UserGroupMinimal[];
+	createdAt: string;
+};
+
+export type LdapServiceAccountInput = {
+	name: string;
+	description?: string;
+	isGroupRestricted: boolean;
+	allowedUserGroupIds: string[];
+};
+
+export type LdapServiceAccountWithPassword = {
+	serviceAccount: LdapServiceAccount;
+	password: string;
+};
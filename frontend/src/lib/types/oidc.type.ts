@@ -17,10 +17,62 @@ export type OidcClientFederatedIdentity = {
 	replayProtection: boolean;
 };
 
+export type OidcClientTLSClientAuthMethod = '' | 'tls_client_auth' | 'self_signed_tls_client_auth';
+
 export type OidcClientCredentials = {
 	federatedIdentities: OidcClientFederatedIdentity[];
+	jwks?: string;
+	jwksUri?: string;
+	tlsClientAuthMethod?: OidcClientTLSClientAuthMethod;
+	tlsClientAuthSubjectDn?: string;
+	tlsClientAuthSanDns?: string;
+	tlsClientAuthSanUri?: string;
+	tlsClientAuthSanIp?: string;
+	tlsClientAuthSanEmail?: string;
+};
+
+export type OidcClientTokenExchangeIssuer = {
+	issuer: string;
+	jwks?: string;
+	audience?: string;
+	userClaim?: string;
 };
 
+export type OidcClientTokenExchange = {
+	subjectTokenTypes?: string[];
+	subjectClientIds?: string[];
+	trustedIssuers?: OidcClientTokenExchangeIssuer[];
+	allowedAudiences?: string[];
+	allowedScopes?: string[];
+	allowDelegation: boolean;
+	allowImpersonation: boolean;
+};
+
+export type OidcClientRefreshTokenExpiry = 'sliding' | 'absolute';
+
+export type OidcClientTokenLifetimes = {
+	accessToken: number;
+	idToken: number;
+	authorizationCode: number;
+	refreshToken: number;
+	refreshTokenExpiry: '' | OidcClientRefreshTokenExpiry;
+	refreshTokenIdleTimeout: number;
+};
+
+export type OidcClientSubjectType = 'public' | 'pairwise';
+
+export type OidcClientBackchannelTokenDeliveryMode = '' | 'poll' | 'ping';
+
+export type OidcClientResponseMode =
+	| ''
+	| 'query'
+	| 'fragment'
+	| 'form_post'
+	| 'query.jwt'
+	| 'fragment.jwt'
+	| 'form_post.jwt'
+	| 'jwt';
+
 export type OidcClient = OidcClientMetaData & {
 	callbackURLs: string[];
 	logoutCallbackURLs: string[];
@@ -28,8 +80,25 @@ export type OidcClient = OidcClientMetaData & {
 	pkceEnabled: boolean;
 	requiresReauthentication: boolean;
 	requiresPushedAuthorizationRequests: boolean;
+	requiresSignedRequestObject: boolean;
+	requiresDPoP: boolean;
+	subjectType: OidcClientSubjectType;
+	defaultResponseMode: OidcClientResponseMode;
+	idTokenEncryptedResponseAlg: string;
+	idTokenEncryptedResponseEnc: string;
+	userinfoSignedResponseAlg: string;
+	userinfoEncryptedResponseAlg: string;
+	userinfoEncryptedResponseEnc: string;
+	sectorIdentifierUri?: string;
+	backchannelLogoutUri?: string;
+	backchannelLogoutSessionRequired: boolean;
+	frontchannelLogoutUri?: string;
+	backchannelTokenDeliveryMode: OidcClientBackchannelTokenDeliveryMode;
+	backchannelClientNotificationUri?: string;
 	skipConsent: boolean;
 	credentials?: OidcClientCredentials;
+	tokenExchange?: OidcClientTokenExchange;
+	tokenLifetimes?: OidcClientTokenLifetimes;
 	launchURL?: string;
 	isGroupRestricted: boolean;
 	pkceSupported: boolean;
@@ -66,15 +135,37 @@ export type OidcDeviceCodeInfo = {
 	client: OidcClientMetaData;
 };
 
+export type BackchannelAuthenticationRequest = {
+	id: string;
+	scope: string[];
+	bindingMessage?: string;
+	expiresAt: string;
+	authorizationRequired: boolean;
+	reauthenticationRequired: boolean;
+	client: OidcClientMetaData;
+};
+
 export type AccessibleOidcClient = OidcClientMetaData & {
 	lastUsedAt: Date | null;
 };
 
 export type InteractionStep = 'authenticate' | 'select_account' | 'reauthenticate' | 'consent';
 
+export type InteractionScope = {
+	name: string;
+	description: string;
+};
+
+export type InteractionResource = {
+	name: string;
+	identifier: string;
+};
+
 export type InteractionSession = {
 	id: string;
 	scopes: string[];
+	customScopes: InteractionScope[];
+	resources: InteractionResource[];
 	client: OidcClientMetaData;
 	currentStep?: InteractionStep;
 	requiredSteps: InteractionStep[];
@@ -84,3 +175,37 @@ export type CompleteInteractionResponse = {
 	interaction?: InteractionSession;
 	redirectUrl?: string;
 };
+
+export type OidcScope = {
+	id: string;
+	name: string;
+	description: string;
+	claimKeys: string[];
+	allowedClients: OidcClientMetaData[];
+	createdAt: string;
+};
+
+export type OidcScopeInput = {
+	name: string;
+	description: string;
+	claimKeys: string[];
+	allowedClientIds: string[];
+};
+
+export type OidcApiResource = {
+	id: string;
+	name: string;
+	identifier: string;
+	scopes: string[];
+	accessTokenLifetime: number;
+	allowedClients: OidcClientMetaData[];
+	createdAt: string;
+};
+
+export type OidcApiResourceInput = {
+	name: string;
+	identifier: string;
+	scopes: string[];
+	accessTokenLifetime: number;
+	allowedClientIds: string[];
+};
@@ -0,0 +1,47 @@
+import type { UserGroupMinimal } from './user-group.type';
+
+export type SamlEndpoint = {
+	binding: string;
+	location: string;
+	responseLocation?: string;
+	index?: number;
+	isDefault?: boolean;
+};
+
+export type SamlAttributeMapping = {
+	name: string;
+	source: string;
+};
+
+export type SamlServiceProvider = {
+	id: string;
+	name: string;
+	entityId: string;
+	metadata: string;
+	assertionConsumerServices: SamlEndpoint[];
+	singleLogoutServices: SamlEndpoint[];
+	nameIdFormat: string;
+	authnRequestsSigned: boolean;
+	signResponse: boolean;
+	attributeMapping: SamlAttributeMapping[];
+	isGroupRestricted: boolean;
+	allowedUserGroups: UserGroupMinimal[];
+	createdAt: string;
+};
+
+export type SamlServiceProviderInput = {
+	name: string;
+	metadata: string;
+	nameIdFormat: string;
+	signResponse: boolean;
+	attributeMapping: SamlAttributeMapping[];
+	isGroupRestricted: boolean;
+	allowedUserGroupIds: string[];
+};
+
+export type SamlIdentityProvider = {
+	entityId: string;
+	metadataUrl: string;
+	ssoUrl: string;
+	sloUrl: string;
+};
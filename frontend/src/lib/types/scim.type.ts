@@ -5,6 +5,8 @@ export type ScimServiceProvider = {
 	endpoint: string;
 	token?: string;
 	lastSyncedAt?: string;
+	lastPushedAt?: string;
+	lastPushError?: string;
 	createdAt: string;
 	oidcClient: OidcClientMetaData;
 };
@@ -0,0 +1,12 @@
+export type UserSession = {
+	id: string;
+	authenticationMethod: string;
+	ipAddress?: string;
+	device: string;
+	country: string;
+	city: string;
+	current: boolean;
+	createdAt: string;
+	lastSeenAt: string;
+	expiresAt: string;
+};
@@ -0,0 +1,29 @@
+export type Webhook = {
+	id: string;
+	name: string;
+	url: string;
+	events: string[];
+	secret: string;
+	enabled: boolean;
+	createdAt: string;
+};
+
+export type WebhookInput = Pick<Webhook, 'name' | 'url' | 'events' | 'enabled'> & {
+	secret?: string;
+};
+
+export type WebhookDeliveryStatus = 'pending' | 'delivered' | 'failed';
+
+export type WebhookDelivery = {
+	id: string;
+	eventId: string;
+	event: string;
+	payload: string;
+	status: WebhookDeliveryStatus;
+	attempts: number;
+	lastError: string;
+	responseStatus?: number;
+	nextAttemptAt: string;
+	deliveredAt?: string;
+	createdAt: string;
+};
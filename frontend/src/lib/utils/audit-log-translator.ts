@@ -9,7 +9,38 @@ export const eventTypes: Record<string, string> = {
 	DEVICE_CODE_AUTHORIZATION: m.device_code_authorization(),
 	NEW_DEVICE_CODE_AUTHORIZATION: m.new_device_code_authorization(),
 	PASSKEY_ADDED: m.passkey_added(),
-	PASSKEY_REMOVED: m.passkey_removed()
+	PASSKEY_REMOVED: m.passkey_removed(),
+	TOKEN_REVOCATION: m.token_revocation(),
+	CLIENT_REGISTRATION: m.client_registration(),
+	CLIENT_REGISTRATION_UPDATE: m.client_registration_update(),
+	CLIENT_REGISTRATION_DELETE: m.client_registration_delete(),
+	TOKEN_EXCHANGE_DELEGATION: m.token_exchange_delegation(),
+	TOKEN_EXCHANGE_IMPERSONATION: m.token_exchange_impersonation(),
+	BACKCHANNEL_AUTHORIZATION: m.backchannel_authorization(),
+	NEW_BACKCHANNEL_AUTHORIZATION: m.new_backchannel_authorization(),
+	SAML_AUTHORIZATION: m.saml_authorization(),
+	FORWARD_AUTH_AUTHORIZATION: m.forward_auth_authorization(),
+	SCIM_PROVISIONING: m.scim_provisioning(),
+	USER_CREATED: m.user_created(),
+	USER_UPDATED: m.user_updated(),
+	USER_DELETED: m.user_deleted(),
+	USER_GROUP_CREATED: m.user_group_created(),
+	USER_GROUP_UPDATED: m.user_group_updated(),
+	USER_GROUP_DELETED: m.user_group_deleted(),
+	OIDC_CLIENT_CREATED: m.oidc_client_created(),
+	OIDC_CLIENT_UPDATED: m.oidc_client_updated(),
+	OIDC_CLIENT_DELETED: m.oidc_client_deleted(),
+	OIDC_CLIENT_SECRET_CREATED: m.oidc_client_secret_created(),
+	CUSTOM_CLAIMS_UPDATED: m.custom_claims_updated(),
+	APP_CONFIG_UPDATED: m.app_config_updated(),
+	SCIM_SERVICE_PROVIDER_CREATED: m.scim_service_provider_created(),
+	SCIM_SERVICE_PROVIDER_UPDATED: m.scim_service_provider_updated(),
+	SCIM_SERVICE_PROVIDER_DELETED: m.scim_service_provider_deleted(),
+	API_KEY_CREATED: m.api_key_created(),
+	API_KEY_RENEWED: m.api_key_renewed(),
+	API_KEY_REVOKED: m.api_key_revoked(),
+	SIGNUP_TOKEN_CREATED: m.signup_token_created(),
+	SIGNUP_TOKEN_DELETED: m.signup_token_deleted()
 };
 
 /**
@@ -0,0 +1,12 @@
+import { m } from '$lib/paraglide/messages';
+import { translateAuditLogEvent } from '$lib/utils/audit-log-translator';
+
+/**
+ * Translates an event webhooks can subscribe to. The events are the audit log events and admin mutations.
+ */
+export function translateWebhookEvent(event: string): string {
+	if (event === 'ADMIN_MUTATION') {
+		return m.admin_mutation();
+	}
+	return translateAuditLogEvent(event);
+}
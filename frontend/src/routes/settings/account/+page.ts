@@ -6,13 +6,15 @@ export const load: PageLoad = async () => {
 	const webauthnService = new WebAuthnService();
 	const userService = new UserService();
 
-	const [account, passkeys] = await Promise.all([
+	const [account, passkeys, sessions] = await Promise.all([
 		userService.getCurrent(),
-		webauthnService.listCredentials()
+		webauthnService.listCredentials(),
+		userService.listCurrentUserSessions()
 	]);
 
 	return {
 		account,
-		passkeys
+		passkeys,
+		sessions
 	};
 };
@@ -3,13 +3,15 @@ import type { PageLoad } from './$types';
 
 export const load: PageLoad = async ({ params }) => {
 	const userService = new UserService();
-	const [user, passkeys] = await Promise.all([
+	const [user, passkeys, sessions] = await Promise.all([
 		userService.get(params.id),
-		userService.listUserPasskeys(params.id)
+		userService.listUserPasskeys(params.id),
+		userService.listUserSessions(params.id)
 	]);
 
 	return {
 		user,
-		passkeys
+		passkeys,
+		sessions
 	};
 };